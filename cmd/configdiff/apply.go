@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/spf13/cobra"
+)
+
+// applyFlags holds the flags of the apply command.
+type applyFlags struct {
+	// Apply flags
+	applyOutput  string
+	applyDryRun  bool
+	applyInPlace bool
+	applyFormat  string
+	applyAllow   []string
+	applyDeny    []string
+}
+
+// newApplyCmd returns the apply command.
+func newApplyCmd(o *options) *cobra.Command {
+	applyCmd := &cobra.Command{
+		Use:   "apply [flags] <target> <patch>",
+		Short: "Apply a patch to a configuration file",
+		Long: `Apply a patch produced by "configdiff -o patch" to a configuration file.
+
+The patch may be JSON or YAML. The result is written to stdout, to --output,
+or back to the target with --in-place, in the target's format.
+
+--allow and --deny restrict the paths the patch may change, using the same
+glob syntax as --ignore. A patch that touches a denied path, or with --allow a
+path outside the allowed ones, is rejected before anything is applied.`,
+		Example: `  # Generate a patch in one repository and apply it in another
+  configdiff old.yaml new.yaml -o patch > change.json
+  configdiff apply deploy.yaml change.json --in-place
+
+  # Only check that the patch applies
+  configdiff apply deploy.yaml change.json --dry-run
+
+  # Refuse patches that touch anything but the image
+  configdiff apply deploy.yaml change.json --allow '/spec/**/image'`,
+		Args: cobra.ExactArgs(2),
+		RunE: o.runApply,
+	}
+
+	applyCmd.Flags().StringVarP(&o.applyOutput, "output", "o", "", "Write the result to this file instead of stdout")
+	applyCmd.Flags().BoolVar(&o.applyDryRun, "dry-run", false, "Only check that the patch applies and print any conflicts")
+	applyCmd.Flags().BoolVar(&o.applyInPlace, "in-place", false, "Rewrite the target file atomically")
+	applyCmd.Flags().StringVarP(&o.applyFormat, "format", "f", "auto", "Target format (yaml, json, toml, auto)")
+	applyCmd.Flags().StringSliceVar(&o.applyAllow, "allow", nil, "Only allow the patch to change these paths (can be repeated)")
+	applyCmd.Flags().StringSliceVar(&o.applyDeny, "deny", nil, "Reject patches that change these paths (can be repeated)")
+
+	return applyCmd
+}
+
+// runApply is the entry point for the apply command.
+func (o *options) runApply(cmd *cobra.Command, args []string) error {
+	return o.apply(args[0], args[1])
+}
+
+// apply applies the patch in patchFile to targetFile and writes the result.
+func (o *options) apply(targetFile, patchFile string) error {
+	if o.applyInPlace && o.applyOutput != "" {
+		return fmt.Errorf("--in-place and --output cannot be used together")
+	}
+	if o.applyInPlace && targetFile == "-" {
+		return fmt.Errorf("--in-place requires a target file, not stdin")
+	}
+	if targetFile == "-" && patchFile == "-" {
+		return fmt.Errorf("both target and patch cannot be stdin (\"-\")")
+	}
+
+	target, err := cli.ReadInput(targetFile, o.applyFormat)
+	if err != nil {
+		return err
+	}
+	p, err := readPatch(patchFile)
+	if err != nil {
+		return err
+	}
+
+	// Refuse the whole patch if any operation violates the path policy
+	if errs := patch.Validate(*p, o.applyAllow, o.applyDeny); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+		}
+		return fmt.Errorf("patch rejected by path policy: %s", plural(len(errs), "operation", "operations"))
+	}
+
+	if o.applyDryRun {
+		targetTree, err := parse.Parse(target.Data, parse.Format(target.Format))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", targetFile, err)
+		}
+		conflicts := patch.Check(targetTree, *p)
+		if len(conflicts) == 0 {
+			fmt.Printf("Patch applies cleanly to %s (%s)\n", targetFile, plural(p.Size(), "operation", "operations"))
+			return nil
+		}
+		for _, err := range conflicts {
+			fmt.Printf("  %v\n", err)
+		}
+		return fmt.Errorf("patch does not apply: %s", plural(len(conflicts), "conflict", "conflicts"))
+	}
+
+	out, err := configdiff.ApplyPatch(target.Data, target.Format, *p)
+	if err != nil {
+		var parseErr *parse.ParseError
+		if errors.As(err, &parseErr) {
+			return fmt.Errorf("failed to parse %s: %w", targetFile, err)
+		}
+		return err
+	}
+
+	switch {
+	case o.applyInPlace:
+		return writeFileAtomic(targetFile, out)
+	case o.applyOutput != "":
+		if err := os.WriteFile(o.applyOutput, out, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", o.applyOutput, err)
+		}
+		return nil
+	default:
+		if _, err := os.Stdout.Write(out); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
+}
+
+// plural formats a count with the singular or plural noun, e.g. "1 operation".
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, one)
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+// readPatch reads a JSON or YAML patch from a file or stdin.
+func readPatch(path string) (*patch.Patch, error) {
+	input, err := cli.ReadInput(path, "auto")
+	if err != nil {
+		return nil, err
+	}
+
+	var p *patch.Patch
+	switch input.Format {
+	case "json":
+		p, err = patch.FromJSON(input.Data)
+	case "yaml":
+		p, err = patch.FromYAML(input.Data)
+	default:
+		return nil, fmt.Errorf("patch %s must be JSON or YAML, not %s", path, input.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// writeFileAtomic replaces path with data by writing a temporary file in the
+// same directory and renaming it over path, keeping path's permissions.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions of %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// newBatchCmd returns the batch command.
+func newBatchCmd(o *options, compareFlags *pflag.FlagSet) *cobra.Command {
+	batchCmd := &cobra.Command{
+		Use:   "batch [flags] <plan>",
+		Short: "Run the comparisons listed in a plan file",
+		Long: `Run the comparisons listed in a YAML plan file, each with options of its own,
+and report them together like the files of a directory comparison: one
+report, JSON document, or GitHub comment for all of them.
+
+A plan lists comparisons of two files with these keys:
+
+  comparisons:
+    - name: api deployment        # reported as; defaults to new
+      old: release/deploy.yaml    # old file; leave out for a new file
+      new: main/deploy.yaml       # new file; leave out for a removed file
+      format: yaml                # input format, instead of --format
+      preset: kubernetes          # instead of --preset
+      ignore: [/metadata/labels]  # added to --ignore
+      array_keys: [/env=name]     # added to --array-key
+      fail_on: [remove]           # instead of --fail-on
+
+Relative paths are relative to the directory of the plan, and may be git
+revisions, archive paths, or URLs as in any comparison. The other flags,
+e.g. -o and --mask-secrets, apply to every comparison. With --exit-code the
+batch exits 1 if any comparison has changes its fail_on, or else --fail-on,
+selects.`,
+		Example: `  configdiff batch plan.yaml --exit-code -o github-comment`,
+		Args:    cobra.ExactArgs(1),
+		RunE:    o.runBatch,
+	}
+
+	// Every comparison flag applies
+	batchCmd.Flags().AddFlagSet(compareFlags)
+
+	return batchCmd
+}
+
+// runBatch is the entry point for the batch command.
+func (o *options) runBatch(cmd *cobra.Command, args []string) error {
+	return o.runComparison(cmd, func() (bool, error) {
+		return o.compareBatch(args[0])
+	})
+}
+
+// compareBatch runs the comparisons of a plan file, reported like the files
+// of a directory comparison. Errors in one comparison are reported without
+// stopping the others.
+// Returns true if any comparison has changes selected by its fail_on, or by
+// --fail-on, false otherwise.
+func (o *options) compareBatch(planFile string) (bool, error) {
+	if len(o.selectPaths) > 0 {
+		return false, fmt.Errorf("--select can only be used when comparing two files")
+	}
+	plan, err := cli.LoadPlan(planFile)
+	if err != nil {
+		return false, err
+	}
+
+	result := report.DirResult{OldDir: planFile, NewDir: planFile}
+	diffs := make(map[string]*fileDiff)
+	failed := 0
+	for _, entry := range plan.Comparisons {
+		file := report.FileResult{Path: entry.Label()}
+		switch {
+		case entry.Old == "":
+			file.Status = report.FileAdded
+		case entry.New == "":
+			file.Status = report.FileRemoved
+		default:
+			fd, err := o.diffPlanEntry(entry)
+			if err != nil {
+				fmt.Fprintf(o.errorOutput(), "Error: %s: %v\n", file.Path, err)
+				failed++
+				file.Status, file.Error = report.FileError, err.Error()
+				break
+			}
+			file.Status = report.FileUnchanged
+			if fd.result.HasChanges() {
+				file.Status = report.FileModified
+			}
+			file.Changes = fd.result.Changes
+			diffs[file.Path] = fd
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	if err := o.renderDirectory(result, diffs); err != nil {
+		return false, err
+	}
+
+	fails := false
+	for i, f := range result.FileChanges() {
+		entryFailOn := plan.Comparisons[i].FailOn
+		if len(entryFailOn) == 0 {
+			entryFailOn = o.failOn
+		}
+		fails = fails || cli.FailsOn(f.Changes, entryFailOn)
+	}
+	return fails, compareFailures(failed)
+}
+
+// diffPlanEntry reads and diffs the files of a plan comparison with the
+// options of flags and the config file, overridden by those of the entry.
+func (o *options) diffPlanEntry(entry cli.PlanEntry) (*fileDiff, error) {
+	cliOpts, err := o.cliOptions(entry.Old, entry.New)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Format != "" {
+		cliOpts.Format, cliOpts.OldFormat, cliOpts.NewFormat = entry.Format, "", ""
+	}
+	if entry.Preset != "" {
+		cliOpts.Preset = entry.Preset
+	}
+	cliOpts.IgnorePaths = slices.Concat(cliOpts.IgnorePaths, entry.Ignore)
+	cliOpts.ArrayKeys = slices.Concat(cliOpts.ArrayKeys, entry.ArrayKeys)
+	if err := cliOpts.Validate(); err != nil {
+		return nil, err
+	}
+
+	oldTree, err := o.readTree(entry.Old, cliOpts.GetOldFormat())
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := o.readTree(entry.New, cliOpts.GetNewFormat())
+	if err != nil {
+		return nil, err
+	}
+	return o.diffTrees(cliOpts, oldTree, newTree)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/report"
+	"golang.org/x/term"
+)
+
+// browseTypes are the change types the browser cycles through with "t";
+// the empty type shows every change.
+var browseTypes = []diff.ChangeType{"", diff.ChangeTypeAdd, diff.ChangeTypeRemove, diff.ChangeTypeModify, diff.ChangeTypeMove}
+
+// browseHelp is the key help shown in the browser's status line.
+const browseHelp = "up/down move  enter expand  / filter  t type  q quit"
+
+// validateInteractive checks that --interactive can take over the terminal.
+func (o *options) validateInteractive() error {
+	if !o.interactive {
+		return nil
+	}
+	if o.quiet >= quietAll {
+		return fmt.Errorf("--interactive and -qq cannot be used together")
+	}
+	if o.outputFile != "" {
+		return fmt.Errorf("--interactive and --output-file cannot be used together")
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("--interactive requires a terminal, but stdin or stdout is redirected\nHint: Drop --interactive to print the report, or pipe it to a pager")
+	}
+	return nil
+}
+
+// browseEntry is a change listed by the browser.
+type browseEntry struct {
+	report.BrowseItem
+
+	// file is the compared file the change is in, or "" for a single pair
+	file string
+}
+
+// group returns the heading the entry is listed under: its top-level key,
+// after its file in directory comparisons.
+func (e browseEntry) group() string {
+	if e.file == "" {
+		return e.Group
+	}
+	return e.file + ": " + e.Group
+}
+
+// browseFileDiff lists the changes of one compared pair in the browser.
+func (o *options) browseFileDiff(oldFile, newFile string, fd *fileDiff) error {
+	items, err := cli.BrowseItems(fd.result, o.outputOptions(oldFile, newFile, fd))
+	if err != nil {
+		return err
+	}
+	entries := make([]browseEntry, len(items))
+	for i, item := range items {
+		entries[i] = browseEntry{BrowseItem: item}
+	}
+	return runBrowser(newBrowser(entries))
+}
+
+// browseDirectory lists the changes of every compared file of a directory
+// comparison in the browser, grouped by file.
+func (o *options) browseDirectory(dir report.DirResult, diffs map[string]*fileDiff) error {
+	var entries []browseEntry
+	for _, file := range dir.Files {
+		fd := diffs[file.Path]
+		if fd == nil || (file.Status != report.FileModified && file.Status != report.FileRenamed && file.Status != report.FileReplaced) {
+			continue
+		}
+		items, err := cli.BrowseItems(fd.result, o.outputOptions(filepath.ToSlash(fd.opts.OldFile), filepath.ToSlash(fd.opts.NewFile), fd))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+		for _, item := range items {
+			entries = append(entries, browseEntry{BrowseItem: item, file: file.Path})
+		}
+	}
+	return runBrowser(newBrowser(entries))
+}
+
+// runBrowser shows b full screen on the terminal until it is quit.
+func runBrowser(b *browser) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to set up the terminal: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	out := bufio.NewWriter(os.Stdout)
+	// Switch to the alternate screen, hiding the cursor, and back on return
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		out.WriteString("\x1b[?25h\x1b[?1049l")
+		out.Flush()
+	}()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || width <= 0 || height <= 1 {
+			width, height = 80, 24
+		}
+		out.WriteString(b.view(width, height))
+		if err := out.Flush(); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+
+		key, err := readKey(in)
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if b.update(key) {
+			return nil
+		}
+	}
+}
+
+// readKey reads a key press from a terminal in raw mode, naming special
+// keys ("up", "enter", "ctrl-c", ...) and returning others as typed.
+func readKey(in *bufio.Reader) (string, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, '\b':
+		return "backspace", nil
+	case 0x03:
+		return "ctrl-c", nil
+	case 0x1b:
+		// A lone escape, unless a sequence follows at once
+		if in.Buffered() == 0 {
+			return "esc", nil
+		}
+		seq := []byte{}
+		for in.Buffered() > 0 {
+			c, err := in.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			seq = append(seq, c)
+			if len(seq) > 1 && c >= 0x40 && c <= 0x7e {
+				break
+			}
+		}
+		switch strings.TrimLeft(string(seq), "[O") {
+		case "A":
+			return "up", nil
+		case "B":
+			return "down", nil
+		case "5~":
+			return "pgup", nil
+		case "6~":
+			return "pgdn", nil
+		case "H", "1~":
+			return "home", nil
+		case "F", "4~":
+			return "end", nil
+		}
+		return "", nil
+	}
+	return string(r), nil
+}
+
+// browser is the state of the interactive change browser.
+type browser struct {
+	entries []browseEntry
+
+	types     int    // index into browseTypes
+	filter    string // path substring changes must contain
+	filtering bool   // the filter is being typed
+	expanded  map[int]bool
+
+	cursor int // index into the visible entries
+	top    int // first row shown
+	page   int // rows shown at once, as of the last view
+}
+
+// newBrowser returns a browser listing entries.
+func newBrowser(entries []browseEntry) *browser {
+	return &browser{entries: entries, expanded: make(map[int]bool), page: 1}
+}
+
+// visible returns the indexes of the entries matching the filter and type.
+func (b *browser) visible() []int {
+	var visible []int
+	for i, e := range b.entries {
+		if t := browseTypes[b.types]; t != "" && e.Change.Type != t {
+			continue
+		}
+		if b.filter != "" && !strings.Contains(e.file+e.Change.Path, b.filter) {
+			continue
+		}
+		visible = append(visible, i)
+	}
+	return visible
+}
+
+// update applies a key press and reports whether the browser was quit.
+func (b *browser) update(key string) bool {
+	if b.filtering {
+		switch key {
+		case "enter":
+			b.filtering = false
+		case "esc", "ctrl-c":
+			b.filter, b.filtering = "", false
+		case "backspace":
+			_, size := utf8.DecodeLastRuneInString(b.filter)
+			b.filter = b.filter[:len(b.filter)-size]
+		default:
+			if r, _ := utf8.DecodeRuneInString(key); utf8.RuneCountInString(key) == 1 && unicode.IsPrint(r) {
+				b.filter += key
+			}
+		}
+		b.cursor, b.top = 0, 0
+		return false
+	}
+
+	visible := b.visible()
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "up", "k":
+		b.cursor--
+	case "down", "j":
+		b.cursor++
+	case "pgup":
+		b.cursor -= b.page
+	case "pgdn":
+		b.cursor += b.page
+	case "home", "g":
+		b.cursor = 0
+	case "end", "G":
+		b.cursor = len(visible) - 1
+	case "enter", " ":
+		if b.cursor < len(visible) {
+			i := visible[b.cursor]
+			b.expanded[i] = !b.expanded[i]
+		}
+	case "/":
+		b.filtering = true
+	case "t":
+		b.types = (b.types + 1) % len(browseTypes)
+		b.cursor, b.top = 0, 0
+	case "esc":
+		b.filter = ""
+		b.cursor, b.top = 0, 0
+	}
+	b.cursor = max(0, min(b.cursor, len(b.visible())-1))
+	return false
+}
+
+// rows renders the visible entries under their group headings and returns
+// the rows, the row of the entry under the cursor, and the first row to keep
+// in sight with it: its group heading if it is the first of its group.
+func (b *browser) rows(visible []int) ([]string, int, int) {
+	counts := make(map[string]int)
+	for _, i := range visible {
+		counts[b.entries[i].group()]++
+	}
+
+	var rows []string
+	cursorRow, cursorTop := 0, 0
+	group := ""
+	for n, i := range visible {
+		e := b.entries[i]
+		heading := n == 0 || e.group() != group
+		if heading {
+			group = e.group()
+			rows = append(rows, fmt.Sprintf("%s (%s)", group, plural(counts[group], "change", "changes")))
+		}
+		marker := "  "
+		if n == b.cursor {
+			marker, cursorRow, cursorTop = "> ", len(rows), len(rows)
+			if heading {
+				cursorTop--
+			}
+		}
+		rows = append(rows, "  "+marker+e.Line)
+		if b.expanded[i] {
+			for _, line := range e.Details {
+				rows = append(rows, "        "+line)
+			}
+		}
+	}
+	return rows, cursorRow, cursorTop
+}
+
+// view renders the browser on a screen of the given size: the list, scrolled
+// to keep the cursor in sight, and a status line.
+func (b *browser) view(width, height int) string {
+	visible := b.visible()
+	rows, cursorRow, cursorTop := b.rows(visible)
+
+	b.page = max(1, height-1)
+	if cursorTop < b.top {
+		b.top = cursorTop
+	}
+	if cursorRow >= b.top+b.page {
+		b.top = cursorRow - b.page + 1
+	}
+
+	var s strings.Builder
+	s.WriteString("\x1b[H")
+	for r := b.top; r < b.top+b.page; r++ {
+		if r < len(rows) {
+			s.WriteString(clipANSI(rows[r], width))
+		} else if r == 0 {
+			s.WriteString("No changes to show")
+		}
+		s.WriteString("\x1b[K\r\n")
+	}
+
+	status := fmt.Sprintf("%d of %s", len(visible), plural(len(b.entries), "change", "changes"))
+	if t := browseTypes[b.types]; t != "" {
+		status += "  type: " + string(t)
+	}
+	switch {
+	case b.filtering:
+		status += "  filter: " + b.filter + "_  (enter to apply, esc to clear)"
+	case b.filter != "":
+		status += "  filter: " + b.filter + "  " + browseHelp
+	default:
+		status += "  " + browseHelp
+	}
+	s.WriteString("\x1b[7m" + clipANSI(status, width) + "\x1b[K\x1b[0m")
+	return s.String()
+}
+
+// clipANSI shortens s to width visible characters, passing ANSI escape
+// sequences through and resetting styles after a styled string.
+func clipANSI(s string, width int) string {
+	var b strings.Builder
+	visible := 0
+	styled := false
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b && i+1 < len(s) && s[i+1] == '[' {
+			j := i + 2
+			for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+				j++
+			}
+			end := min(j+1, len(s))
+			b.WriteString(s[i:end])
+			styled = true
+			i = end
+			continue
+		}
+		if visible == width {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteString(s[i : i+size])
+		visible++
+		i += size
+	}
+	if styled {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
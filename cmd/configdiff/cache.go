@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// cacheVersion is the version of the entries of the --cache-dir cache.
+// Bump it when cacheEntry or cacheFingerprint changes in a way that would
+// decode an older entry wrongly.
+const cacheVersion = 1
+
+// cacheEntry is a diffed pair of files, as stored in the cache: the result
+// and documents, normalized and masked, that are rendered.
+type cacheEntry struct {
+	Result  *configdiff.Result `json:"result"`
+	OldTree *tree.Node         `json:"oldTree"`
+	NewTree *tree.Node         `json:"newTree"`
+}
+
+// cacheFingerprint is everything other than the contents of two files that
+// their diff depends on, so that changing any of it misses the cache: the
+// build, since a new version may diff differently, the options for the
+// pair, with the config file and .configdiffignore merged in, the formats
+// the files are parsed as, and the parser limits. Only the file names are
+// left out, so that a file moved or compared under another name still hits.
+type cacheFingerprint struct {
+	Version   int            `json:"version"`
+	Build     string         `json:"build"`
+	Options   cli.CLIOptions `json:"options"`
+	OldFormat string         `json:"oldFormat"`
+	NewFormat string         `json:"newFormat"`
+	Limits    [3]int         `json:"limits"`
+}
+
+// openCache opens the cache of --cache-dir, or $CONFIGDIFF_CACHE_DIR,
+// unless --no-cache is given. A cache directory that cannot be created is
+// only a warning, since comparing without the cache gives the same result.
+func (o *options) openCache() error {
+	o.cache = nil
+	dir := o.cacheDir
+	if dir == "" {
+		dir = os.Getenv("CONFIGDIFF_CACHE_DIR")
+	}
+	if dir == "" || o.noCache {
+		return nil
+	}
+	maxSize, err := cli.ParseSize(o.cacheMaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid --cache-max-size: %w", err)
+	}
+	if o.cacheMaxAge < 0 {
+		return fmt.Errorf("invalid --cache-max-age %s, must not be negative", o.cacheMaxAge)
+	}
+	cache, err := cli.OpenCache(dir, o.cacheMaxAge, maxSize)
+	if err != nil {
+		fmt.Fprintf(o.messages(), "Warning: Not caching results: %v\n", err)
+		return nil
+	}
+	o.cache = cache
+	return nil
+}
+
+// closeCache evicts the entries past --cache-max-age and --cache-max-size
+// once a comparison is done.
+func (o *options) closeCache() {
+	if o.cache == nil {
+		return
+	}
+	removed, err := o.cache.Evict()
+	if err != nil {
+		fmt.Fprintf(o.messages(), "Warning: Failed to evict cache entries: %v\n", err)
+	}
+	if l := o.logger(); l != nil && removed > 0 {
+		l.Info("evicted cache entries", "count", removed)
+	}
+	o.cache = nil
+}
+
+// diffFilesCached diffs two files as diffFilesContext does, but takes the
+// result from the cache if the same contents were compared before with the
+// same fingerprint, and stores it there otherwise. The contents are always
+// read, and only parsed and diffed on a miss.
+func (o *options) diffFilesCached(ctx context.Context, cliOpts cli.CLIOptions, oldFile, newFile string) (*fileDiff, error) {
+	start := time.Now()
+	oldInput, err := cli.ReadInputWith(oldFile, cliOpts.GetOldFormat(), o.inputOptions())
+	if err != nil {
+		return nil, withSide("old", "", err)
+	}
+	newInput, err := cli.ReadInputWith(newFile, cliOpts.GetNewFormat(), o.inputOptions())
+	if err != nil {
+		return nil, withSide("new", "", err)
+	}
+
+	key, err := cacheKey(cliOpts, oldInput, newInput)
+	if err != nil {
+		return nil, err
+	}
+	if fd, ok := o.cachedDiff(key, cliOpts); ok {
+		if l := o.logger(); l != nil {
+			l.Info("cache hit", "old", oldInput.Path, "new", newInput.Path)
+		}
+		fd.parseTime = time.Since(start)
+		return fd, nil
+	}
+
+	oldTree, err := o.parseInput(oldFile, oldInput)
+	if err != nil {
+		return nil, withSide("old", "", err)
+	}
+	newTree, err := o.parseInput(newFile, newInput)
+	if err != nil {
+		return nil, withSide("new", "", err)
+	}
+	parsed := time.Now()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fd, err := o.diffTreesContext(ctx, cliOpts, oldTree, newTree)
+	if err != nil {
+		return nil, err
+	}
+	fd.parseTime, fd.diffTime = parsed.Sub(start), time.Since(parsed)
+
+	data, err := json.Marshal(cacheEntry{Result: fd.result, OldTree: fd.oldTree, NewTree: fd.newTree})
+	if err == nil {
+		err = o.cache.Put(key, data)
+	}
+	if err != nil {
+		fmt.Fprintf(o.messages(), "Warning: Failed to cache the diff of %s and %s: %v\n", oldFile, newFile, err)
+	}
+	return fd, nil
+}
+
+// cacheKey returns the key of the diff of two inputs compared with cliOpts.
+func cacheKey(cliOpts cli.CLIOptions, oldInput, newInput *cli.InputSource) (string, error) {
+	opts := cliOpts
+	opts.OldFile, opts.NewFile = "", ""
+	fingerprint, err := json.Marshal(cacheFingerprint{
+		Version:   cacheVersion,
+		Build:     version + " " + commit,
+		Options:   opts,
+		OldFormat: oldInput.Format,
+		NewFormat: newInput.Format,
+		Limits:    [3]int{parse.MaxSize, parse.MaxDepth, parse.MaxAliasExpansion},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint options: %w", err)
+	}
+	return cli.CacheKey(fingerprint, oldInput.Data, newInput.Data), nil
+}
+
+// cachedDiff returns the diff stored under key, if any. An entry that does
+// not decode, e.g. one written by an older version, is a miss, and is
+// replaced by the diff computed instead.
+func (o *options) cachedDiff(key string, cliOpts cli.CLIOptions) (*fileDiff, bool) {
+	data, ok := o.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Result == nil {
+		return nil, false
+	}
+	return &fileDiff{opts: cliOpts, result: entry.Result, oldTree: entry.OldTree, newTree: entry.NewTree}, true
+}
@@ -1,262 +1,1156 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pfrederiksen/configdiff"
 	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/internal/config"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
 )
 
-// compare performs the diff operation between two files or directories
-func compare(oldFile, newFile string) error {
+// compare performs the diff operation between two files or directories.
+// Returns true if changes selected by --fail-on were found, false otherwise.
+func (o *options) compare(oldFile, newFile string) (bool, error) {
+	// Glob patterns compare every pair of matching files
+	if cli.IsGlob(oldFile) || cli.IsGlob(newFile) {
+		if len(o.selectPaths) > 0 {
+			return false, fmt.Errorf("--select can only be used when comparing two files")
+		}
+		return o.compareGlobs(oldFile, newFile)
+	}
+
 	// Check if inputs are directories
-	oldInfo, oldErr := os.Stat(oldFile)
-	newInfo, newErr := os.Stat(newFile)
+	oldIsDir, err := isDir(oldFile)
+	if err != nil {
+		return false, err
+	}
+	newIsDir, err := isDir(newFile)
+	if err != nil {
+		return false, err
+	}
 
 	// Handle directory comparison
-	if oldErr == nil && newErr == nil && oldInfo.IsDir() && newInfo.IsDir() {
-		if !recursive {
-			return fmt.Errorf("comparing directories requires --recursive flag")
+	if oldIsDir && newIsDir {
+		// Archives are always compared by the files inside them
+		if !o.recursive && !cli.IsArchive(oldFile) && !cli.IsArchive(newFile) {
+			return false, fmt.Errorf("comparing directories requires --recursive flag")
 		}
-		hasChanges, err := compareDirectories(oldFile, newFile)
-		if err != nil {
-			return err
+		if len(o.selectPaths) > 0 {
+			return false, fmt.Errorf("--select can only be used when comparing two files")
 		}
-
-		// Handle exit code mode for directory comparison
-		if exitCode && hasChanges {
-			os.Exit(1)
-		}
-
-		return nil
+		return o.compareDirectories(oldFile, newFile)
 	}
 
 	// One is a directory and one isn't
-	if oldErr == nil && oldInfo.IsDir() {
-		return fmt.Errorf("cannot compare directory %q with file %q", oldFile, newFile)
+	if oldIsDir {
+		return false, fmt.Errorf("cannot compare directory %q with file %q", oldFile, newFile)
 	}
-	if newErr == nil && newInfo.IsDir() {
-		return fmt.Errorf("cannot compare file %q with directory %q", oldFile, newFile)
+	if newIsDir {
+		return false, fmt.Errorf("cannot compare file %q with directory %q", oldFile, newFile)
 	}
 
 	// Both are files (or stdin), proceed with normal comparison
-	hasChanges, err := compareFiles(oldFile, newFile)
+	return o.compareFiles(oldFile, newFile)
+}
+
+// fileDiff is the outcome of diffing one pair of files, masked and ready to render.
+type fileDiff struct {
+	opts    cli.CLIOptions
+	result  *configdiff.Result
+	oldTree *tree.Node
+	newTree *tree.Node
+
+	// parseTime and diffTime are how long reading and parsing both files,
+	// and diffing them, took, when diffFiles measured them
+	parseTime, diffTime time.Duration
+}
+
+// compareFiles performs the diff operation between two files.
+// Returns true if changes selected by --fail-on were found, false otherwise.
+func (o *options) compareFiles(oldFile, newFile string) (bool, error) {
+	if len(o.selectPaths) > 0 {
+		return o.compareSelections(oldFile, newFile)
+	}
+	fd, err := o.diffFiles(oldFile, newFile)
 	if err != nil {
-		return err
+		return false, err
 	}
+	return o.reportFileDiff(oldFile, newFile, fd)
+}
+
+// reportFileDiff renders a diffed pair of inputs and writes GitHub Actions
+// outputs. Returns true if changes selected by --fail-on were found, false
+// otherwise.
+func (o *options) reportFileDiff(oldFile, newFile string, fd *fileDiff) (bool, error) {
+	var err error
+	cliOpts, result := fd.opts, fd.result
 
-	// Handle exit code mode for single file comparison
-	if exitCode && hasChanges {
-		os.Exit(1)
+	// GitHub Actions outputs need the rendered text, unless a separate
+	// comment is rendered for them; otherwise output is streamed
+	githubOutput := os.Getenv("GITHUB_OUTPUT")
+	capture := githubOutput != "" && !o.githubComment
+
+	if o.interactive {
+		if err := o.browseFileDiff(oldFile, newFile, fd); err != nil {
+			return false, err
+		}
+		return cli.FailsOn(result.Changes, o.failOn), nil
+	}
+
+	// Format and output results (unless -qq)
+	var output string
+	if o.quiet < quietAll {
+		outOpts := o.outputOptions(oldFile, newFile, fd)
+		if capture {
+			output, err = cli.FormatOutput(result, outOpts)
+			if err != nil {
+				return false, err
+			}
+			if cli.IsRecordFormat(cliOpts.OutputFormat) {
+				// Records already end in a newline; a blank line would break NDJSON readers
+				fmt.Fprint(o.stdout(), output)
+			} else {
+				fmt.Fprintln(o.stdout(), output)
+			}
+		} else if err := o.writeOutput(result, outOpts); err != nil {
+			return false, err
+		}
 	}
 
+	// Write GitHub Actions outputs if in GHA environment
+	hasChanges := result.HasChanges()
+	if githubOutput != "" {
+		diffOutput := output
+		if o.githubComment {
+			diffOutput, err = cli.FormatOutput(result, o.githubCommentOptions(newFile, cliOpts))
+			if err != nil {
+				return false, err
+			}
+		}
+		filesChanged := 0
+		if hasChanges {
+			filesChanged = 1
+		}
+		err := o.writeGitHubDiff(githubOutput, hasChanges, diffOutput)
+		if err == nil {
+			err = writeGitHubCounts(githubOutput, result.Summary(), filesChanged)
+		}
+		if err != nil {
+			// Log error but don't fail the command
+			fmt.Fprintf(o.messages(), "Warning: Failed to write GitHub Actions outputs: %v\n", err)
+		}
+	}
+	if summaryFile := os.Getenv("GITHUB_STEP_SUMMARY"); summaryFile != "" {
+		opts := o.githubCommentOptions(newFile, cliOpts)
+		opts.MaxSize = report.GitHubStepSummaryLimit
+		summary, err := cli.FormatOutput(result, opts)
+		if err != nil {
+			return false, err
+		}
+		if err := writeGitHubStepSummary(summaryFile, summary); err != nil {
+			fmt.Fprintf(o.messages(), "Warning: Failed to write GitHub Actions step summary: %v\n", err)
+		}
+	}
+
+	// Return whether changes selected by --fail-on were found
+	return cli.FailsOn(result.Changes, o.failOn), nil
+}
+
+// githubCommentOptions builds the options for rendering the changes to
+// newFile as Markdown for GitHub: a PR comment or the job step summary.
+func (o *options) githubCommentOptions(newFile string, cliOpts cli.CLIOptions) cli.OutputOptions {
+	return cli.OutputOptions{
+		Format:         "github-comment",
+		MaxValueLength: cliOpts.MaxValueLength,
+		NoCollapse:     o.noCollapse,
+		NewFile:        newFile,
+		Sort:           cliOpts.Sort,
+		FilterTypes:    cliOpts.FilterTypes,
+		MaxChanges:     cliOpts.MaxShown,
+		Severity:       o.severity,
+		SeverityRules:  cliOpts.SeverityRules,
+	}
+}
+
+// outputOptions builds the rendering options for a diffed pair of files.
+func (o *options) outputOptions(oldFile, newFile string, fd *fileDiff) cli.OutputOptions {
+	cliOpts := fd.opts
+	return cli.OutputOptions{
+		Format:           cliOpts.OutputFormat,
+		NoColor:          cli.ColorDisabled(cliOpts.ColorMode(), o.terminal()),
+		MaxValueLength:   cliOpts.MaxValueLength,
+		NoCollapse:       o.noCollapse,
+		OldFile:          oldFile,
+		NewFile:          newFile,
+		GroupBy:          cliOpts.GroupBy,
+		ContextLines:     o.contextLines,
+		ContextKeys:      o.contextKeys,
+		Width:            o.outputWidth(),
+		OldTree:          fd.oldTree,
+		NewTree:          fd.newTree,
+		Sort:             cliOpts.Sort,
+		FilterTypes:      cliOpts.FilterTypes,
+		TemplateFile:     cliOpts.TemplateFile,
+		MaxChanges:       cliOpts.MaxShown,
+		LineNumbers:      o.lineNumbers,
+		AnnotationLevels: cliOpts.AnnotationLevels,
+		ASCII:            cli.ASCIIRequired(o.asciiOutput),
+		ExpandValues:     o.expandValues,
+		ExpandLimit:      o.expandLimit,
+		MaxPathSegments:  o.maxPathSegments(),
+		ShowLegend:       o.showLegend(cliOpts.OutputFormat),
+		ZeroCounts:       o.zeroCounts,
+		Severity:         o.severity,
+		SeverityRules:    cliOpts.SeverityRules,
+		ValueStyle:       cliOpts.ValueStyle,
+	}
+}
+
+// maxPathSegments returns the path depth human output is shortened to, or 0
+// with --full-paths.
+func (o *options) maxPathSegments() int {
+	if o.fullPaths {
+		return 0
+	}
+	return report.DefaultMaxPathSegments
+}
+
+// showLegend reports whether to explain the change symbols in output of
+// format: by default in report output only, unless --legend is given
+// explicitly.
+func (o *options) showLegend(format string) bool {
+	if o.legendSet {
+		return o.legend
+	}
+	return format == "report"
+}
+
+// outputDefaults returns --output and --max-value-length with the config
+// file and environment applied when not given, as cliOptions resolves them
+// for each pair of files, for what is decided once per run, such as paging.
+func (o *options) outputDefaults() (format string, maxValueLength int) {
+	opts := cli.CLIOptions{OutputFormat: o.outputFormat, MaxValueLength: o.maxValueLength, Changed: o.flagChanged}
+	if o.cfg != nil {
+		opts.ApplyConfigDefaults(o.cfg)
+	}
+	return opts.OutputFormat, opts.MaxValueLength
+}
+
+// writeOutput streams the formatted result to stdout, followed by a blank
+// line for formats other than record exports.
+func (o *options) writeOutput(result *configdiff.Result, opts cli.OutputOptions) error {
+	w := bufio.NewWriter(o.stdout())
+	if err := cli.WriteOutput(w, result, opts); err != nil {
+		return err
+	}
+	if !cli.IsRecordFormat(opts.Format) {
+		// Records already end in a newline; a blank line would break NDJSON readers
+		w.WriteString("\n")
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
 	return nil
 }
 
-// compareFiles performs the diff operation between two files.
-// Returns true if changes were found, false otherwise.
-func compareFiles(oldFile, newFile string) (bool, error) {
+// cliOptions builds the CLI options for comparing oldFile with newFile from
+// flags and config file defaults, and validates them.
+func (o *options) cliOptions(oldFile, newFile string) (cli.CLIOptions, error) {
 	// Build CLI options from flags
 	cliOpts := cli.CLIOptions{
-		OldFile:        oldFile,
-		NewFile:        newFile,
-		Format:         format,
-		OldFormat:      oldFormat,
-		NewFormat:      newFormat,
-		IgnorePaths:    ignorePaths,
-		ArrayKeys:      arrayKeys,
-		NumericStrings: numericStrings,
-		BoolStrings:    boolStrings,
-		StableOrder:    stableOrder,
-		OutputFormat:   outputFormat,
-		NoColor:        noColor,
-		MaxValueLength: maxValueLength,
-		Quiet:          quiet,
-		ExitCode:       exitCode,
+		OldFile:          oldFile,
+		NewFile:          newFile,
+		Format:           o.format,
+		OldFormat:        o.oldFormat,
+		NewFormat:        o.newFormat,
+		ArrayKeys:        o.arrayKeys,
+		Preset:           o.preset,
+		NumericStrings:   o.numericStrings,
+		BoolStrings:      o.boolStrings,
+		StableOrder:      o.stableOrder,
+		OutputFormat:     o.outputFormat,
+		Color:            o.colorMode,
+		NoColor:          o.noColor,
+		MaxValueLength:   o.maxValueLength,
+		Quiet:            o.quiet >= quietAll,
+		ExitCode:         o.exitCode,
+		GroupBy:          o.groupBy,
+		MaskPaths:        o.maskPaths,
+		MaskSecrets:      o.maskSecrets,
+		MaskMode:         o.maskMode,
+		Sort:             o.sortOrder,
+		FilterTypes:      o.filterTypes,
+		TemplateFile:     o.templateFile,
+		MaxShown:         o.maxShown,
+		AnnotationLevels: o.annotationLevels,
+		ValueStyle:       o.valueStyle,
+		Changed:          o.flagChanged,
+	}
+
+	// Ignore file rules come after the config file's and before the flags'
+	rules, err := o.ignoreFileRules(oldFile, newFile)
+	if err != nil {
+		return cli.CLIOptions{}, err
+	}
+	sources := make(map[string]string)
+	for _, rule := range rules {
+		cliOpts.IgnorePaths = append(cliOpts.IgnorePaths, rule.Pattern)
+		sources[rule.Pattern] = rule.Source
+	}
+	for _, p := range o.ignorePaths {
+		cliOpts.IgnorePaths = append(cliOpts.IgnorePaths, p)
+		sources[p] = "--ignore"
 	}
 
 	// Apply config file defaults (CLI flags take precedence)
-	if cfg != nil {
-		cliOpts.ApplyConfigDefaults(cfg)
+	if o.cfg != nil {
+		cliOpts.ApplyConfigDefaults(o.cfg)
+	}
+
+	if o.verbose {
+		for _, p := range cliOpts.IgnorePaths {
+			source, ok := sources[p]
+			if !ok {
+				source = "config file " + strings.Join(o.cfg.Files, ", ")
+				if slices.Contains(o.cfg.Env, "ignore_paths") {
+					source = "env " + config.EnvVar("ignore_paths")
+				}
+			}
+			fmt.Fprintf(o.messages(), "%s: ignore rule %s (from %s)\n", newFile, p, source)
+		}
 	}
 
 	// Validate options
 	if err := cliOpts.Validate(); err != nil {
-		return false, err
+		return cli.CLIOptions{}, err
 	}
 
-	// Read old file
-	oldInput, err := cli.ReadInput(oldFile, cliOpts.GetOldFormat())
+	return cliOpts, nil
+}
+
+// ignoreFileRules returns the rules of the .configdiffignore file for a pair
+// of inputs: the one found from the new file, or from the old file if the
+// new one is not local. Stdin and URLs have none.
+func (o *options) ignoreFileRules(oldFile, newFile string) ([]cli.IgnoreRule, error) {
+	for _, arg := range []string{newFile, oldFile} {
+		file, ok := localFile(arg)
+		if !ok {
+			continue
+		}
+		dir := filepath.Dir(file)
+		cached, ok := o.ignoreFiles.Load(dir)
+		if !ok {
+			f, err := cli.LoadIgnoreFile(dir)
+			if err != nil {
+				return nil, err
+			}
+			cached, _ = o.ignoreFiles.LoadOrStore(dir, f)
+		}
+		return cached.(*cli.IgnoreFile).RulesFor(file), nil
+	}
+	return nil, nil
+}
+
+// localFile returns the path on disk an input corresponds to: the path of a
+// git revision, or the path of a file inside an archive as if it were
+// unpacked next to it. ok is false for stdin and URLs.
+func localFile(arg string) (string, bool) {
+	if arg == "-" || cli.IsURL(arg) {
+		return "", false
+	}
+	if path, _, ok := cli.SplitGitRevision(arg); ok {
+		return path, true
+	}
+	if archive, inner, ok := cli.SplitArchivePath(arg); ok {
+		return filepath.Join(filepath.Dir(archive), filepath.FromSlash(inner)), true
+	}
+	return arg, true
+}
+
+// diffFiles reads, parses, and diffs two files, masking secrets in the
+// result before anything is rendered or written to GitHub outputs.
+func (o *options) diffFiles(oldFile, newFile string) (*fileDiff, error) {
+	return o.diffFilesContext(context.Background(), oldFile, newFile)
+}
+
+// diffFilesContext diffs two files as diffFiles does, timing each step, and
+// stops with ctx.Err() once ctx is done: before diffing, or while diffing.
+func (o *options) diffFilesContext(ctx context.Context, oldFile, newFile string) (*fileDiff, error) {
+	cliOpts, err := o.cliOptions(oldFile, newFile)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	// Large JSON files are compared a member at a time, and not cached
+	if o.incremental(cliOpts, oldFile, newFile) {
+		return o.diffFilesIncremental(cliOpts, oldFile, newFile)
+	}
+	// Documents split from stdin are read together, and values masked by
+	// hash only match within a run, so neither is cached
+	if o.cache != nil && o.stdinSeparator == "" && cliOpts.MaskOptions().MaskMode != report.MaskModeHash {
+		return o.diffFilesCached(ctx, cliOpts, oldFile, newFile)
 	}
 
-	// Read new file
-	newInput, err := cli.ReadInput(newFile, cliOpts.GetNewFormat())
+	start := time.Now()
+	oldTree, newTree, err := o.readTrees(cliOpts, oldFile, newFile)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	parsed := time.Now()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fd, err := o.diffTreesContext(ctx, cliOpts, oldTree, newTree)
+	if err != nil {
+		return nil, err
+	}
+	fd.parseTime, fd.diffTime = parsed.Sub(start), time.Since(parsed)
+	return fd, nil
+}
+
+// readTrees reads and parses the old and new inputs of a comparison. With
+// --stdin-separator both are read from stdin at once, split at the separator.
+func (o *options) readTrees(cliOpts cli.CLIOptions, oldFile, newFile string) (oldTree, newTree *tree.Node, err error) {
+	if oldFile == "-" && newFile == "-" && o.stdinSeparator != "" {
+		oldInput, newInput, err := cli.ReadStdinPair(o.stdinSeparator, cliOpts.GetOldFormat(), cliOpts.GetNewFormat())
+		if err != nil {
+			return nil, nil, err
+		}
+		if oldTree, err = parse.Parse(oldInput.Data, parse.Format(oldInput.Format)); err != nil {
+			return nil, nil, withSide("old", "-", err)
+		}
+		if newTree, err = parse.Parse(newInput.Data, parse.Format(newInput.Format)); err != nil {
+			return nil, nil, withSide("new", "-", err)
+		}
+		return oldTree, newTree, nil
+	}
+
+	if oldTree, err = o.readTree(oldFile, cliOpts.GetOldFormat()); err != nil {
+		return nil, nil, withSide("old", "", err)
+	}
+	if newTree, err = o.readTree(newFile, cliOpts.GetNewFormat()); err != nil {
+		return nil, nil, withSide("new", "", err)
+	}
+	return oldTree, newTree, nil
+}
+
+// withSide records the side of a comparison, and the file if not empty,
+// in err if it is a parse error.
+func withSide(side, file string, err error) error {
+	var parseErr *parse.ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.Side = side
+		if file != "" {
+			parseErr.File = file
+		}
+	}
+	return err
+}
+
+// readTree reads and parses a file, stdin, git revision, or URL.
+func (o *options) readTree(path, formatHint string) (*tree.Node, error) {
+	input, err := cli.ReadInputWith(path, formatHint, o.inputOptions())
+	if err != nil {
+		return nil, err
+	}
+	return o.parseInput(path, input)
+}
+
+// parseInput parses the input read from path.
+func (o *options) parseInput(path string, input *cli.InputSource) (*tree.Node, error) {
+	start := time.Now()
+	node, err := parse.Parse(input.Data, parse.Format(input.Format))
+	if err != nil {
+		var parseErr *parse.ParseError
+		if errors.As(err, &parseErr) {
+			parseErr.File = input.Path
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if l := o.logger(); l != nil {
+		l.Info("parsed", "file", input.Path, "format", input.Format, "bytes", len(input.Data), "duration", time.Since(start))
 	}
+	return node, nil
+}
+
+// diffTrees diffs two parsed documents and masks secrets in the result.
+func (o *options) diffTrees(cliOpts cli.CLIOptions, oldTree, newTree *tree.Node) (*fileDiff, error) {
+	return o.diffTreesContext(context.Background(), cliOpts, oldTree, newTree)
+}
+
+// diffTreesContext diffs two parsed documents as diffTrees does, but stops
+// with an error wrapping ctx.Err() once ctx is done.
+func (o *options) diffTreesContext(ctx context.Context, cliOpts cli.CLIOptions, oldTree, newTree *tree.Node) (*fileDiff, error) {
+	oldTree, newTree = cliOpts.NormalizeTree(oldTree), cliOpts.NormalizeTree(newTree)
 
 	// Convert CLI options to library options
 	diffOpts, err := cliOpts.ToLibraryOptions()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
+	diffOpts.Logger = o.logger()
+
 	// Perform the diff
-	result, err := configdiff.DiffBytes(
-		oldInput.Data, oldInput.Format,
-		newInput.Data, newInput.Format,
-		diffOpts,
-	)
+	result, err := configdiff.DiffTreesContext(ctx, oldTree, newTree, diffOpts)
 	if err != nil {
-		return false, fmt.Errorf("diff failed: %w", err)
+		return nil, err
 	}
 
-	// Format and output results (unless quiet mode)
-	var output string
-	if !quiet {
-		output, err = cli.FormatOutput(result, cli.OutputOptions{
-			Format:         outputFormat,
-			NoColor:        noColor,
-			MaxValueLength: maxValueLength,
-			OldFile:        oldFile,
-			NewFile:        newFile,
-		})
+	// Mask secrets. Documents for unified output are masked by hash so
+	// that a changed secret still produces a hunk.
+	if maskOpts := cliOpts.MaskOptions(); len(maskOpts.MaskPaths) > 0 || maskOpts.MaskSecrets {
+		result, err = cli.MaskResult(result, maskOpts)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-
-		fmt.Println(output)
+		maskOpts.MaskMode = report.MaskModeHash
+		oldTree = report.MaskTree(oldTree, maskOpts)
+		newTree = report.MaskTree(newTree, maskOpts)
 	}
 
-	// Write GitHub Actions outputs if in GHA environment
-	hasChanges := cli.HasChanges(result)
-	if githubOutput := os.Getenv("GITHUB_OUTPUT"); githubOutput != "" {
-		if err := writeGitHubOutputs(githubOutput, hasChanges, output); err != nil {
-			// Log error but don't fail the command
-			fmt.Fprintf(os.Stderr, "Warning: Failed to write GitHub Actions outputs: %v\n", err)
-		}
+	return &fileDiff{
+		opts:    cliOpts,
+		result:  result,
+		oldTree: oldTree,
+		newTree: newTree,
+	}, nil
+}
+
+// inputOptions returns the options for reading inputs from URLs.
+func (o *options) inputOptions() cli.InputOptions {
+	return cli.InputOptions{
+		HTTPTimeout: o.httpTimeout,
+		HTTPHeaders: o.httpHeaders,
+		Insecure:    o.insecure,
+
+		StripComponents: o.stripComponents,
 	}
+}
 
-	// Return whether changes were found
-	return hasChanges, nil
+// outputWidth returns the --width flag value, or the terminal width of stdout.
+func (o *options) outputWidth() int {
+	if o.width > 0 {
+		return o.width
+	}
+	return cli.TerminalWidth(o.terminal())
 }
 
-// compareDirectories recursively compares two directories.
+// compareDirectories recursively compares two directories, collecting the
+// result of every file before rendering them together.
 // Returns true if any changes were found, false otherwise.
-func compareDirectories(oldDir, newDir string) (bool, error) {
+func (o *options) compareDirectories(oldDir, newDir string) (bool, error) {
+	// An archive's index holds its files only until the pairs are diffed
+	defer cli.ReleaseArchive(oldDir)
+	defer cli.ReleaseArchive(newDir)
+
 	// Collect all config files from both directories
-	oldFiles, err := collectConfigFiles(oldDir)
+	oldFiles, oldTooLarge, err := o.listConfigFiles(oldDir)
 	if err != nil {
 		return false, fmt.Errorf("failed to scan old directory: %w", err)
 	}
 
-	newFiles, err := collectConfigFiles(newDir)
+	newFiles, newTooLarge, err := o.listConfigFiles(newDir)
 	if err != nil {
 		return false, fmt.Errorf("failed to scan new directory: %w", err)
 	}
 
 	// Build set of all relative paths
 	allPaths := make(map[string]bool)
-	for _, path := range oldFiles {
-		rel, _ := filepath.Rel(oldDir, path)
-		allPaths[rel] = true
+	for _, files := range []map[string]bool{oldFiles, newFiles, oldTooLarge, newTooLarge} {
+		for relPath := range files {
+			allPaths[relPath] = true
+		}
 	}
-	for _, path := range newFiles {
-		rel, _ := filepath.Rel(newDir, path)
-		allPaths[rel] = true
+
+	// Visit files in a stable order
+	relPaths := make([]string, 0, len(allPaths))
+	for relPath := range allPaths {
+		relPaths = append(relPaths, relPath)
 	}
+	sortSlashed(relPaths)
 
-	// Track if any differences found
-	hasAnyChanges := false
-	filesCompared := 0
-	filesAdded := 0
-	filesRemoved := 0
+	pairs := make([]filePair, 0, len(relPaths))
+	for _, relPath := range relPaths {
+		pair := filePair{label: filepath.ToSlash(relPath)}
+		if oldFiles[relPath] || oldTooLarge[relPath] {
+			pair.oldPath = joinPath(oldDir, relPath)
+		}
+		if newFiles[relPath] || newTooLarge[relPath] {
+			pair.newPath = joinPath(newDir, relPath)
+		}
+		if oldTooLarge[relPath] || newTooLarge[relPath] {
+			pair.skipped = o.tooLargeReason()
+		}
+		pairs = append(pairs, pair)
+	}
 
-	// Compare each file
-	for relPath := range allPaths {
-		oldPath := filepath.Join(oldDir, relPath)
-		newPath := filepath.Join(newDir, relPath)
+	if o.matchStem {
+		pairs = o.matchStems(pairs)
+	}
+	if !o.noRenameDetect {
+		if pairs, err = o.detectRenames(oldDir, newDir, pairs); err != nil {
+			return false, err
+		}
+	}
 
-		oldExists := fileExists(oldPath)
-		newExists := fileExists(newPath)
+	return o.comparePairs(report.DirResult{OldDir: oldDir, NewDir: newDir, MaxDepth: o.maxWalkDepth}, pairs)
+}
 
-		if oldExists && newExists {
-			// File exists in both directories - compare them
-			if !quiet {
-				fmt.Printf("\n=== %s ===\n", relPath)
-			}
+// filePair is a file compared as part of a directory or list of files. A
+// file that only exists on one side has an empty path on the other. Files
+// paired across paths, by --match-stem or as a rename, have the label of
+// the old path as oldLabel. A pair left out of the comparison has the
+// reason why as skipped.
+type filePair struct {
+	label   string
+	oldPath string
+	newPath string
+	skipped string
 
-			fileHasChanges, err := compareFiles(oldPath, newPath)
-			if err != nil {
-				if !quiet {
-					fmt.Printf("Error: %v\n", err)
+	oldLabel   string
+	renamed    bool
+	similarity float64
+}
+
+// comparePairs diffs each pair of files, collecting the results into dir
+// before rendering them together. Up to --jobs pairs are diffed at once;
+// results keep the order of pairs whatever order they finish in. Errors in
+// one pair are reported, and recorded as the pair's result, without stopping
+// the others, and then fail the comparison as a whole once the rest is
+// rendered.
+// Returns true if any changes selected by --fail-on were found, false otherwise.
+func (o *options) comparePairs(dir report.DirResult, pairs []filePair) (bool, error) {
+	type pairResult struct {
+		fd       *fileDiff
+		err      error
+		messages []byte // shown in the order of the pairs, not as compared
+	}
+	results := make([]pairResult, len(pairs))
+
+	workers := o.jobs
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				var messages bytes.Buffer
+				fd, err := o.withMessages(&messages).diffFilesWithin(pairs[i].oldPath, pairs[i].newPath)
+				results[i] = pairResult{fd: fd, err: err}
+				// A comparison given up on may still be writing to messages
+				if !isTimeout(err) {
+					results[i].messages = messages.Bytes()
 				}
-				continue
 			}
-			filesCompared++
-			if fileHasChanges {
-				hasAnyChanges = true
+		}()
+	}
+	for i, pair := range pairs {
+		if pair.oldPath != "" && pair.newPath != "" && pair.skipped == "" {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	diffs := make(map[string]*fileDiff)
+	failed := 0
+	for i, pair := range pairs {
+		file := report.FileResult{Path: pair.label, OldPath: pair.oldLabel}
+		o.messages().Write(results[i].messages)
+
+		switch {
+		case pair.skipped != "":
+			file.Status, file.Error = report.FileSkipped, pair.skipped
+			if l := o.logger(); l != nil {
+				l.Debug("file skipped", "file", pair.label, "reason", pair.skipped)
 			}
-		} else if newExists && !oldExists {
-			// File added
-			filesAdded++
-			if !quiet {
-				fmt.Printf("\n+++ %s (added)\n", relPath)
+		case pair.oldPath != "" && pair.newPath != "":
+			fd, err := results[i].fd, results[i].err
+			if err != nil {
+				fmt.Fprintf(o.errorOutput(), "Error: %s: %v\n", pair.label, err)
+				failed++
+				file.Status, file.Error, file.TimedOut = report.FileError, err.Error(), isTimeout(err)
+				break
 			}
-			hasAnyChanges = true
-		} else if oldExists && !newExists {
-			// File removed
-			filesRemoved++
-			if !quiet {
-				fmt.Printf("\n--- %s (removed)\n", relPath)
+			file.ParseDuration, file.DiffDuration = fd.parseTime, fd.diffTime
+			file.Status = report.FileUnchanged
+			if pair.renamed {
+				file.Status = report.FileRenamed
+				file.Similarity = pair.similarity
+			} else if fd.result.HasChanges() {
+				file.Status = report.FileModified
 			}
-			hasAnyChanges = true
+			file.Changes = fd.result.Changes
+			diffs[file.Path] = fd
+		case pair.newPath != "":
+			file.Status = report.FileAdded
+		case pair.oldPath != "":
+			file.Status = report.FileRemoved
+		default:
+			continue
 		}
+		dir.Files = append(dir.Files, file)
 	}
 
-	// Print summary
-	if !quiet {
-		fmt.Printf("\n")
-		fmt.Printf("Summary: %d files compared, %d added, %d removed\n",
-			filesCompared, filesAdded, filesRemoved)
+	if err := o.renderDirectory(dir, diffs); err != nil {
+		return false, err
+	}
+	if o.verbose {
+		o.reportSlowestFiles(dir)
 	}
+	return cli.DirFailsOn(dir, o.failOn), compareFailures(failed)
+}
 
-	// Return whether any changes were found
-	return hasAnyChanges, nil
+// compareFailures returns the error for a directory comparison in which
+// failed files could not be compared, or nil if none failed.
+func compareFailures(failed int) error {
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s could not be compared", plural(failed, "file", "files"))
 }
 
-// collectConfigFiles recursively finds all config files in a directory
-func collectConfigFiles(dir string) ([]string, error) {
-	var files []string
+// renderDirectory prints a directory comparison and writes it to GitHub
+// Actions outputs when available. Formats without an aggregate rendering
+// print one output per compared file; in a machine format, the headers and
+// summary around them go to stderr. With --interactive the changes are
+// browsed instead.
+func (o *options) renderDirectory(dir report.DirResult, diffs map[string]*fileDiff) error {
+	if o.interactive {
+		return o.browseDirectory(dir, diffs)
+	}
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	cliOpts, err := o.cliOptions(dir.OldDir, dir.NewDir)
+	if err != nil {
+		return err
+	}
+
+	var output, notes string
+	if cli.AggregatesDirectory(cliOpts.OutputFormat) {
+		output, err = cli.FormatDirectory(dir, cli.OutputOptions{
+			Format:          cliOpts.OutputFormat,
+			NoColor:         cli.ColorDisabled(cliOpts.ColorMode(), o.terminal()),
+			MaxValueLength:  cliOpts.MaxValueLength,
+			NoCollapse:      o.noCollapse,
+			GroupBy:         cliOpts.GroupBy,
+			Width:           o.outputWidth(),
+			Sort:            cliOpts.Sort,
+			FilterTypes:     cliOpts.FilterTypes,
+			MaxChanges:      cliOpts.MaxShown,
+			LineNumbers:     o.lineNumbers,
+			ASCII:           cli.ASCIIRequired(o.asciiOutput),
+			ExpandValues:    o.expandValues,
+			ExpandLimit:     o.expandLimit,
+			MaxPathSegments: o.maxPathSegments(),
+			ShowLegend:      o.showLegend(cliOpts.OutputFormat),
+			ZeroCounts:      o.zeroCounts,
+			Severity:        o.severity,
+			SeverityRules:   cliOpts.SeverityRules,
+			ValueStyle:      cliOpts.ValueStyle,
+		})
+	} else {
+		output, notes, err = o.formatDirectoryFiles(dir, diffs)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(o.messages(), notes)
+	if o.quiet < quietAll && output != "" {
+		fmt.Fprint(o.stdout(), output)
+		if !strings.HasSuffix(output, "\n") {
+			fmt.Fprintln(o.stdout())
+		}
+	}
+
+	if githubOutput := os.Getenv("GITHUB_OUTPUT"); githubOutput != "" {
+		s := dir.Summarize(report.Options{})
+		err := o.writeGitHubDiff(githubOutput, dir.HasChanges(), output)
+		if err == nil {
+			err = writeGitHubFileCounts(githubOutput, s)
+		}
+		if err == nil {
+			err = writeGitHubCounts(githubOutput, s.Changes, s.Changed+s.Added+s.Removed+s.Renamed+s.Replaced)
+		}
+		if err != nil {
+			fmt.Fprintf(o.messages(), "Warning: Failed to write GitHub Actions outputs: %v\n", err)
+		}
+	}
+	if summaryFile := os.Getenv("GITHUB_STEP_SUMMARY"); summaryFile != "" {
+		summary, err := cli.FormatDirectory(dir, cli.OutputOptions{
+			Format:         "markdown",
+			MaxValueLength: cliOpts.MaxValueLength,
+			NoCollapse:     o.noCollapse,
+			Sort:           cliOpts.Sort,
+			FilterTypes:    cliOpts.FilterTypes,
+			MaxChanges:     cliOpts.MaxShown,
+			Severity:       o.severity,
+			SeverityRules:  cliOpts.SeverityRules,
+		})
 		if err != nil {
 			return err
 		}
+		if err := writeGitHubStepSummary(summaryFile, summary); err != nil {
+			fmt.Fprintf(o.messages(), "Warning: Failed to write GitHub Actions step summary: %v\n", err)
+		}
+	}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
+	return nil
+}
+
+// formatDirectoryFiles renders each compared file under a "=== path ==="
+// header, "=== old → new ===" for files paired across paths, or a
+// "renamed: old → new (similarity N%)" header for renamed files, or a
+// "-/+ path (replaced)" header for replaced files, followed by added and
+// removed files and a summary. In a machine format, the headers, added and
+// removed files, and summary are returned separately as notes, so that the
+// output holds nothing but the outputs of the files.
+func (o *options) formatDirectoryFiles(dir report.DirResult, diffs map[string]*fileDiff) (string, string, error) {
+	var b, n strings.Builder
+	headers := &b
+	if format, _ := o.outputDefaults(); cli.IsMachineFormat(format) {
+		headers = &n
+	}
+	compared, added, removed, renamed, replaced, failed, skipped := 0, 0, 0, 0, 0, 0, 0
+	arrow := "→"
+	if cli.ASCIIRequired(o.asciiOutput) {
+		arrow = "->"
+	}
+	for _, file := range dir.Files {
+		switch file.Status {
+		case report.FileAdded:
+			added++
+			fmt.Fprintf(headers, "\n+++ %s (added)\n", file.Path)
+			continue
+		case report.FileRemoved:
+			removed++
+			fmt.Fprintf(headers, "\n--- %s (removed)\n", file.Path)
+			continue
+		case report.FileError:
+			// Already reported on stderr
+			failed++
+			continue
+		case report.FileSkipped:
+			skipped++
+			fmt.Fprintf(headers, "\n!!! %s (skipped: %s)\n", file.Path, file.Error)
+			continue
 		}
 
-		// Check if it's a config file by extension
-		ext := strings.ToLower(filepath.Ext(path))
-		switch ext {
-		case ".yaml", ".yml", ".json", ".hcl", ".tf", ".toml":
-			files = append(files, path)
+		header := fmt.Sprintf("=== %s ===", file.Path)
+		if file.OldPath != "" {
+			header = fmt.Sprintf("=== %s %s %s ===", file.OldPath, arrow, file.Path)
+		}
+		switch file.Status {
+		case report.FileRenamed:
+			renamed++
+			header = fmt.Sprintf("renamed: %s %s %s (similarity %d%%)", file.OldPath, arrow, file.Path, int(file.Similarity*100))
+		case report.FileReplaced:
+			replaced++
+			header = fmt.Sprintf("-/+ %s (replaced)", file.Path)
+		default:
+			compared++
 		}
+		fd := diffs[file.Path]
+		output, err := cli.FormatOutput(fd.result, o.outputOptions(filepath.ToSlash(fd.opts.OldFile), filepath.ToSlash(fd.opts.NewFile), fd))
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", file.Path, err)
+		}
+		fmt.Fprintf(headers, "\n%s\n", header)
+		fmt.Fprintf(&b, "%s\n", output)
+	}
+	fmt.Fprintf(headers, "\nSummary: %d files compared, %d added, %d removed", compared, added, removed)
+	if renamed > 0 {
+		fmt.Fprintf(headers, ", %d renamed", renamed)
+	}
+	if replaced > 0 {
+		fmt.Fprintf(headers, ", %d replaced", replaced)
+	}
+	if failed > 0 {
+		fmt.Fprintf(headers, ", %d failed", failed)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(headers, ", %d skipped", skipped)
+	}
+	headers.WriteString("\n")
+	return b.String(), n.String(), nil
+}
+
+// collectConfigFiles recursively finds all config files in a directory,
+// skipping excluded files and never entering excluded directories or those
+// deeper than --max-walk-depth. Files larger than --max-file-size are
+// returned separately as tooLarge, to be reported without being read.
+//
+// Symlinked files are always read. Symlinked directories are only entered
+// with --follow-symlinks, and never when they lead back to a directory
+// being walked. Broken symlinks are skipped with a warning.
+func (o *options) collectConfigFiles(dir string) (files, tooLarge []string, err error) {
+	limit := o.maxFileBytes()
+	root, err := os.Stat(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// ancestors are the directories from dir down to the one being read,
+	// compared by device and inode to detect symlink cycles
+	var walk func(path string, ancestors []os.FileInfo) error
+	walk = func(path string, ancestors []os.FileInfo) error {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entryPath := filepath.Join(path, entry.Name())
+			rel, err := filepath.Rel(dir, entryPath)
+			if err != nil {
+				return err
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			link := info.Mode()&os.ModeSymlink != 0
+			if link {
+				target, err := os.Stat(entryPath)
+				if err != nil {
+					if !o.isExcluded(rel, false) {
+						dest, _ := os.Readlink(entryPath)
+						fmt.Fprintf(o.messages(), "Warning: skipping broken symlink %s -> %s\n", entryPath, dest)
+					}
+					continue
+				}
+				info = target
+			}
+
+			// Skip excluded directories and those too deep or already open
+			if info.IsDir() {
+				if o.isExcluded(rel, true) {
+					if l := o.logger(); l != nil {
+						l.Debug("directory excluded", "dir", entryPath)
+					}
+					continue
+				}
+				if link && !o.followSymlinks {
+					if o.verbose {
+						fmt.Fprintf(o.messages(), "%s: symlinked directory not entered without --follow-symlinks\n", entryPath)
+					}
+					continue
+				}
+				if o.beyondWalkDepth(rel) {
+					if o.verbose {
+						fmt.Fprintf(o.messages(), "%s: not entered, deeper than --max-walk-depth %d\n", entryPath, o.maxWalkDepth)
+					}
+					continue
+				}
+				if slices.ContainsFunc(ancestors, func(a os.FileInfo) bool { return os.SameFile(a, info) }) {
+					fmt.Fprintf(o.messages(), "Warning: not following symlink %s: it leads back to a directory being compared\n", entryPath)
+					continue
+				}
+				if err := walk(entryPath, append(ancestors, info)); err != nil {
+					return err
+				}
+				continue
+			}
 
+			if !isConfigFile(entryPath) {
+				continue
+			}
+			if o.isExcluded(rel, false) {
+				if l := o.logger(); l != nil {
+					l.Debug("file excluded", "file", entryPath)
+				}
+				continue
+			}
+			if limit > 0 && info.Size() > limit {
+				tooLarge = append(tooLarge, entryPath)
+			} else {
+				files = append(files, entryPath)
+			}
+		}
 		return nil
+	}
+
+	if err := walk(dir, []os.FileInfo{root}); err != nil {
+		return nil, nil, err
+	}
+	return files, tooLarge, nil
+}
+
+// maxFileBytes returns --max-file-size in bytes, 0 for no limit. The flag is
+// validated before any comparison starts.
+func (o *options) maxFileBytes() int64 {
+	limit, _ := cli.ParseSize(o.maxFileSize)
+	return limit
+}
+
+// maxParseBytes returns the largest document parsed, in bytes, 0 for no
+// limit: --max-parse-size if given, or else the config file's
+// max_parse_size, or else the flag's default.
+func (o *options) maxParseBytes() (int64, error) {
+	size, name := o.maxParseSize, "--max-parse-size"
+	if o.cfg != nil && o.cfg.MaxParseSize != "" && (o.flagChanged == nil || !o.flagChanged("max-parse-size")) {
+		size, name = o.cfg.MaxParseSize, "max_parse_size"
+	}
+	limit, err := cli.ParseSize(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return limit, nil
+}
+
+// tooLargeReason explains why a file larger than --max-file-size is skipped.
+func (o *options) tooLargeReason() string {
+	return "too large, over --max-file-size " + cli.FormatSize(o.maxFileBytes())
+}
+
+// beyondWalkDepth reports whether a directory, or the directory of a file
+// listed from a git revision or an archive, relative to a compared
+// directory is deeper than --max-walk-depth allows entering. Files directly
+// in the compared directory are at depth 1.
+func (o *options) beyondWalkDepth(relDir string) bool {
+	if o.maxWalkDepth <= 0 || relDir == "." || relDir == "" {
+		return false
+	}
+	return strings.Count(filepath.ToSlash(relDir), "/")+1 >= o.maxWalkDepth
+}
+
+// defaultExcludes are the directories recursive comparisons skip unless
+// --no-default-excludes is given: hidden directories such as .git and
+// .terraform, and dependency directories.
+var defaultExcludes = []string{".*", "node_modules", "vendor"}
+
+// isExcluded reports whether a file or directory, relative to a compared
+// directory, matches --exclude or the config file's exclude_paths, or for
+// directories the default excludes.
+func (o *options) isExcluded(relPath string, dir bool) bool {
+	var patterns []string
+	patterns = append(patterns, o.excludePaths...)
+	if o.cfg != nil {
+		patterns = append(patterns, o.cfg.ExcludePaths...)
+	}
+	if dir && !o.noDefaultExclude {
+		patterns = append(patterns, defaultExcludes...)
+	}
+	return cli.MatchExclude(filepath.ToSlash(relPath), patterns)
+}
+
+// isExcludedFile reports whether a file listed from a git revision or an
+// archive is excluded, itself or by one of its directories.
+func (o *options) isExcludedFile(relPath string) bool {
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := 1; i < len(segments); i++ {
+		if o.isExcluded(strings.Join(segments[:i], "/"), true) {
+			return true
+		}
+	}
+	return o.isExcluded(relPath, false)
+}
+
+// isConfigFile reports whether path has a configuration file extension.
+func isConfigFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json", ".hcl", ".tf", ".toml":
+		return true
+	}
+	return false
+}
+
+// listConfigFiles returns the set of config files in a directory, relative
+// to it, and separately those larger than --max-file-size. A "dir@{rev}"
+// directory is listed at that git revision, and an archive by the files
+// inside it; their files are never skipped for size.
+func (o *options) listConfigFiles(dir string) (files, tooLarge map[string]bool, err error) {
+	files = make(map[string]bool)
+	tooLarge = make(map[string]bool)
+
+	var names []string
+	switch path, rev, ok := cli.SplitGitRevision(dir); {
+	case ok:
+		names, err = cli.ListGitFiles(path, rev)
+	case cli.IsArchive(dir):
+		names, err = cli.ListArchiveFiles(dir, o.stripComponents)
+	default:
+		paths, large, err := o.collectConfigFiles(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, path := range paths {
+			rel, _ := filepath.Rel(dir, path)
+			files[rel] = true
+		}
+		for _, path := range large {
+			rel, _ := filepath.Rel(dir, path)
+			tooLarge[rel] = true
+		}
+		return files, tooLarge, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		if isConfigFile(name) && !o.isExcludedFile(name) && !o.beyondWalkDepth(filepath.Dir(filepath.FromSlash(name))) {
+			files[filepath.FromSlash(name)] = true
+		}
+	}
+	return files, tooLarge, nil
+}
+
+// joinPath joins a file's path relative to a compared directory onto it,
+// keeping the revision of a "dir@{rev}" directory, or as "archive!path"
+// for an archive.
+func joinPath(dir, relPath string) string {
+	if path, rev, ok := cli.SplitGitRevision(dir); ok {
+		return cli.JoinGitRevision(filepath.Join(path, relPath), rev)
+	}
+	if cli.IsArchive(dir) {
+		return cli.JoinArchivePath(dir, filepath.ToSlash(relPath))
+	}
+	return filepath.Join(dir, relPath)
+}
+
+// sortSlashed sorts relative paths in the order of their slash-separated
+// forms, the forms shown in output, so that files are listed in the same
+// order on every OS.
+func sortSlashed(relPaths []string) {
+	sort.Slice(relPaths, func(i, j int) bool {
+		return filepath.ToSlash(relPaths[i]) < filepath.ToSlash(relPaths[j])
 	})
+}
 
-	return files, err
+// isDir reports whether a compared argument is a directory: in the working
+// tree, at the revision of a "path@{rev}" argument, or an archive. Missing
+// paths are not directories; reading them reports the error.
+func isDir(arg string) (bool, error) {
+	if path, rev, ok := cli.SplitGitRevision(arg); ok {
+		return cli.IsGitDir(path, rev)
+	}
+	if cli.IsArchive(arg) {
+		return true, nil
+	}
+	info, err := os.Stat(arg)
+	return err == nil && info.IsDir(), nil
 }
 
 // fileExists checks if a file exists
@@ -268,8 +1162,27 @@ func fileExists(path string) bool {
 	return !info.IsDir()
 }
 
-// writeGitHubOutputs writes GitHub Actions outputs to the GITHUB_OUTPUT file
-func writeGitHubOutputs(outputFile string, hasChanges bool, diffOutput string) error {
+// defaultGitHubOutputLimit is the default --github-output-limit, well under
+// the 1MB GitHub accepts for the outputs of a job.
+const defaultGitHubOutputLimit = 256 << 10
+
+// writeGitHubDiff writes the GitHub Actions outputs for a comparison, with
+// diff-output cut to --github-output-limit, and the whole of diffOutput to
+// the --github-artifact file, if given.
+func (o *options) writeGitHubDiff(outputFile string, hasChanges bool, diffOutput string) error {
+	if o.githubArtifact != "" {
+		if err := os.WriteFile(o.githubArtifact, []byte(diffOutput), 0644); err != nil {
+			return fmt.Errorf("failed to write --github-artifact: %w", err)
+		}
+	}
+	return writeGitHubOutputs(outputFile, hasChanges, diffOutput, o.githubMaxOutput)
+}
+
+// writeGitHubOutputs writes GitHub Actions outputs to the GITHUB_OUTPUT file,
+// with diff-output cut to limit bytes, 0 for no limit
+func writeGitHubOutputs(outputFile string, hasChanges bool, diffOutput string, limit int) error {
+	diffOutput, truncated := truncateGitHubOutput(diffOutput, limit)
+
 	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
@@ -277,7 +1190,7 @@ func writeGitHubOutputs(outputFile string, hasChanges bool, diffOutput string) e
 	defer f.Close()
 
 	// Write has-changes output
-	if _, err := fmt.Fprintf(f, "has-changes=%v\n", hasChanges); err != nil {
+	if _, err := fmt.Fprintf(f, "has-changes=%v\ndiff-output-truncated=%v\n", hasChanges, truncated); err != nil {
 		return err
 	}
 
@@ -296,3 +1209,119 @@ func writeGitHubOutputs(outputFile string, hasChanges bool, diffOutput string) e
 
 	return nil
 }
+
+// truncateGitHubOutput cuts output to at most limit bytes, 0 for no limit,
+// at a line boundary that does not split a change, and ends it with a note
+// of the changes left out. It reports whether output was cut.
+func truncateGitHubOutput(output string, limit int) (string, bool) {
+	if limit <= 0 || len(output) <= limit {
+		return output, false
+	}
+	// The note is at its longest when every change is left out
+	budget := limit - len(truncatedNote(strings.Count(output, "\n")+1))
+	if budget < 0 {
+		budget = 0
+	}
+
+	// Keep the lines that fit, noting where the last change kept starts
+	cut, lastChange := 0, -1
+	for cut < len(output) {
+		line, _, _ := strings.Cut(output[cut:], "\n")
+		if cut+len(line)+1 > budget {
+			break
+		}
+		if isChangeLine(line) {
+			lastChange = cut
+		}
+		cut += len(line) + 1
+	}
+	// A cut in the indented lines that continue a change, such as a
+	// multi-line value, moves back to the line it starts on
+	next, _, _ := strings.Cut(output[cut:], "\n")
+	if lastChange >= 0 && strings.HasPrefix(next, " ") && !isChangeLine(next) {
+		cut = lastChange
+	}
+	omitted := 0
+	for _, line := range strings.Split(output[cut:], "\n") {
+		if isChangeLine(line) {
+			omitted++
+		}
+	}
+	return output[:cut] + truncatedNote(omitted), true
+}
+
+// truncatedNote returns the line ending diff-output cut with omitted
+// changes left out.
+func truncatedNote(omitted int) string {
+	return fmt.Sprintf("... truncated, %d changes omitted\n", omitted)
+}
+
+// isChangeLine reports whether line starts a change in text output, such as
+// "  ~ /spec/replicas: 2 → 3", or in a Markdown table, such as
+// "| `/spec/replicas` | modified | ...".
+func isChangeLine(line string) bool {
+	if strings.HasPrefix(line, "| `/") {
+		return true
+	}
+	line = strings.TrimLeft(line, " ")
+	for _, symbol := range []string{"+", "-", "~", "↔", "<->"} {
+		if strings.HasPrefix(line, symbol+" /") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeGitHubFileCounts appends the number of files by status in a
+// directory comparison to the GITHUB_OUTPUT file
+func writeGitHubFileCounts(outputFile string, s report.DirSummary) error {
+	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "files-added=%d\nfiles-removed=%d\nfiles-modified=%d\nfiles-renamed=%d\nfiles-failed=%d\n",
+		s.Added, s.Removed, s.Changed, s.Renamed, s.Errors)
+	return err
+}
+
+// writeGitHubCounts appends the number of changes by type, and of files with
+// changes, to the GITHUB_OUTPUT file
+func writeGitHubCounts(outputFile string, s report.Summary, filesChanged int) error {
+	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "added-count=%d\nremoved-count=%d\nmodified-count=%d\nfiles-changed=%d\n",
+		s.Added, s.Removed, s.Modified, filesChanged)
+	return err
+}
+
+// writeGitHubStepSummary appends Markdown to the GITHUB_STEP_SUMMARY file,
+// cut at a line boundary with a notice when it exceeds the size GitHub
+// accepts
+func writeGitHubStepSummary(summaryFile, markdown string) error {
+	if len(markdown) > report.GitHubStepSummaryLimit {
+		const notice = "\n\n_Summary truncated to fit the 1MB step summary limit; see the job log for the full diff._\n"
+		cut := report.GitHubStepSummaryLimit - len(notice)
+		if i := strings.LastIndexByte(markdown[:cut], '\n'); i > 0 {
+			cut = i
+		}
+		markdown = markdown[:cut] + notice
+	}
+	if !strings.HasSuffix(markdown, "\n") {
+		markdown += "\n"
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(markdown)
+	return err
+}
@@ -2,14 +2,25 @@ package main
 
 import (
 	"os"
+	"sort"
+	"strings"
 
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
 	"github.com/spf13/cobra"
 )
 
-var completionCmd = &cobra.Command{
-	Use:   "completion [bash|zsh|fish|powershell]",
-	Short: "Generate completion script",
-	Long: `To load completions:
+// configExtensions are the file extensions offered first when completing
+// file arguments.
+var configExtensions = []string{"yaml", "yml", "json", "hcl", "tf", "toml"}
+
+// newCompletionCmd returns the completion command.
+func newCompletionCmd() *cobra.Command {
+	completionCmd := &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate completion script",
+		Long: `To load completions:
 
 Bash:
 
@@ -48,25 +59,156 @@ PowerShell:
   PS> configdiff completion powershell > configdiff.ps1
   # and source this file from your PowerShell profile.
 `,
-	DisableFlagsInUseLine: true,
-	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
-	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		var err error
-		switch args[0] {
-		case "bash":
-			err = cmd.Root().GenBashCompletion(os.Stdout)
-		case "zsh":
-			err = cmd.Root().GenZshCompletion(os.Stdout)
-		case "fish":
-			err = cmd.Root().GenFishCompletion(os.Stdout, true)
-		case "powershell":
-			err = cmd.Root().GenPowerShellCompletionWithDesc(os.Stdout)
+		DisableFlagsInUseLine: true,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			switch args[0] {
+			case "bash":
+				err = cmd.Root().GenBashCompletion(os.Stdout)
+			case "zsh":
+				err = cmd.Root().GenZshCompletion(os.Stdout)
+			case "fish":
+				err = cmd.Root().GenFishCompletion(os.Stdout, true)
+			case "powershell":
+				err = cmd.Root().GenPowerShellCompletionWithDesc(os.Stdout)
+			}
+			return err
+		},
+	}
+
+	return completionCmd
+}
+
+// registerCompletions adds dynamic completion of flag values and arguments
+// to the compare command, once its flags are defined.
+func (o *options) registerCompletions(cmd *cobra.Command) {
+	cmd.ValidArgsFunction = completeArgs
+
+	fixed := map[string][]string{
+		"output":      cli.OutputFormats,
+		"format":      cli.InputFormats,
+		"old-format":  cli.InputFormats,
+		"new-format":  cli.InputFormats,
+		"sort":        {report.SortPath, report.SortType, report.SortSeverity},
+		"value-style": {report.ValueStyleAuto, report.ValueStyleJSON, report.ValueStyleYAML, report.ValueStyleGo},
+		"mask-mode":   {report.MaskModeRedact, report.MaskModeHash},
+		"filter-type": {"add", "remove", "modify", "move"},
+		"fail-on":     {"add", "remove", "modify", "move", cli.FailOnTypeChange, cli.FailOnDestroy, cli.FailOnAny},
+		"color":       cli.ColorModes,
+		"preset":      cli.Presets,
+	}
+	for name, values := range fixed {
+		_ = cmd.RegisterFlagCompletionFunc(name, cobra.FixedCompletions(values, cobra.ShellCompDirectiveNoFileComp))
+	}
+
+	_ = cmd.RegisterFlagCompletionFunc("ignore", o.completeIgnorePath)
+	_ = cmd.RegisterFlagCompletionFunc("mask-path", o.completeIgnorePath)
+	_ = cmd.RegisterFlagCompletionFunc("array-key", o.completeArrayKey)
+}
+
+// completeArgs completes the old and new file arguments, offering
+// configuration files and directories.
+func completeArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) >= 2 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return configExtensions, cobra.ShellCompDirectiveFilterFileExt
+}
+
+// completeIgnorePath completes a path in the first file argument, one
+// segment at a time: "/spec/te" offers the keys of /spec starting with "te".
+func (o *options) completeIgnorePath(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	root := o.completionTree(args)
+	if root == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return childPaths(root, toComplete, false), cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeArrayKey completes "path=key" array keys: the path of an array in
+// the first file argument, then a field of the objects in it.
+func (o *options) completeArrayKey(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	root := o.completionTree(args)
+	if root == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	path, keyPrefix, ok := strings.Cut(toComplete, "=")
+	if !ok {
+		return childPaths(root, toComplete, true), cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+	}
+
+	array := root.GetByPath(path)
+	if array == nil || array.Kind != tree.KindArray {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	seen := make(map[string]bool)
+	var completions []string
+	for _, elem := range array.Array {
+		if elem.Kind != tree.KindObject {
+			continue
 		}
-		return err
-	},
+		for key := range elem.Object {
+			if strings.HasPrefix(key, keyPrefix) && !seen[key] {
+				seen[key] = true
+				completions = append(completions, path+"="+key)
+			}
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
 }
 
-func init() {
-	rootCmd.AddCommand(completionCmd)
+// completionTree parses the first file argument for path completion, or
+// returns nil if there is none or it cannot be read.
+func (o *options) completionTree(args []string) *tree.Node {
+	if len(args) == 0 || args[0] == "-" {
+		return nil
+	}
+	formatHint := o.format
+	if o.oldFormat != "" {
+		formatHint = o.oldFormat
+	}
+	root, err := o.readTree(args[0], formatHint)
+	if err != nil {
+		return nil
+	}
+	return root
+}
+
+// childPaths returns the paths of the fields of the object at the parent of
+// toComplete that start with its last segment. Objects and arrays end in
+// "/" so that completion can continue below them; with arraysOnly, only
+// arrays and the objects that may contain them are offered.
+func childPaths(root *tree.Node, toComplete string, arraysOnly bool) []string {
+	parentPath := "/"
+	prefix := strings.TrimPrefix(toComplete, "/")
+	if i := strings.LastIndex(toComplete, "/"); i > 0 {
+		parentPath, prefix = toComplete[:i], toComplete[i+1:]
+	}
+
+	parent := root.GetByPath(parentPath)
+	if parent == nil || parent.Kind != tree.KindObject {
+		return nil
+	}
+
+	base := strings.TrimSuffix(parentPath, "/") + "/"
+	var completions []string
+	for key, child := range parent.Object {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		switch {
+		case child.Kind == tree.KindObject:
+			completions = append(completions, base+key+"/")
+		case child.Kind == tree.KindArray:
+			completions = append(completions, base+key)
+		case !arraysOnly:
+			completions = append(completions, base+key)
+		}
+	}
+	sort.Strings(completions)
+	return completions
 }
@@ -0,0 +1,762 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/internal/config"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFlags holds the flags that select the config file, and the state
+// of loading it.
+type configFlags struct {
+	// Config flags
+	configInitForce bool
+	noDiscover      bool
+	noMergeConfig   bool
+	lenientConfig   bool
+	configFile      string
+
+	// cfgDir is the directory the config file is looked for from, or "" for
+	// the current directory, see discoverConfig
+	cfgDir string
+
+	// cfgErr is the error loading the config file and environment, if any
+	cfgErr error
+}
+
+// newConfigCmd returns the config command and its subcommands.
+func newConfigCmd(o *options) *cobra.Command {
+	configValidateCmd := &cobra.Command{
+		Use:   "validate [path]",
+		Short: "Check a configuration file for unknown keys and invalid values",
+		Long: `Parse a configuration file strictly and report unknown keys, values of the
+wrong type, and invalid values with their line numbers. Without a path the
+configuration files in use are checked.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: o.runConfigValidate,
+	}
+
+	configShowCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the effective configuration and where each value comes from",
+		Long: `Print the configuration in effect, merged from the configuration files, the
+environment, and the built-in defaults, with the source of each value.`,
+		Args: cobra.NoArgs,
+		RunE: o.runConfigShow,
+	}
+
+	configSchemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print a JSON Schema of the configuration file",
+		Long: `Print a JSON Schema describing the configuration file, with the type,
+allowed values, and flag of each setting, for editors to complete and check
+config files with. It is generated from the settings configdiff reads, so
+it matches the version that printed it.`,
+		Args: cobra.NoArgs,
+		RunE: runConfigSchema,
+	}
+
+	configInitCmd := &cobra.Command{
+		Use:   "init [path]",
+		Short: "Write a commented starter configuration file",
+		Long: `Write a starter configuration file listing every setting with a comment,
+to .configdiffrc unless a path is given. An existing file is only replaced
+with --force.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: o.runConfigInit,
+	}
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Validate, show, or create the configuration file",
+		Long: `Work with the configuration file that sets defaults for configdiff flags.
+
+Config files are looked for at ./.configdiffrc, ./.configdiff.yaml,
+~/.configdiffrc, and ~/.configdiff.yaml. When comparing files, .configdiffrc
+and .configdiff.yaml are first looked for in the directory of the first
+input that exists and then in each of its parents, up to the repository
+root (the directory containing .git) or the filesystem root. --no-discover
+turns this off.
+
+Every file found is used, like git's config files: each is merged over the
+ones further away, so ~/.configdiff.yaml can hold personal defaults that a
+repository's .configdiffrc overrides. Lists (ignore_paths, exclude_paths,
+and rules) are added together, array_keys are merged by path, and other
+settings in a nearer file replace those further away; in one directory,
+.configdiffrc is nearer than .configdiff.yaml. Rules are matched relative to
+the nearest file's directory. "config show" names the files each setting
+comes from. --no-merge-config uses only the nearest file, as configdiff did
+before files were merged.
+
+Config files are parsed strictly: a key that is not a setting, such as
+ignorePaths for ignore_paths, or an invalid value is an error naming the
+file and line. --lenient-config ignores unknown keys and invalid values
+instead.
+
+--config PATH uses that file and no other, e.g. for reproducible CI runs: it
+is not looked for, and must exist and load. From lowest to highest
+precedence, settings come from:
+
+  1. config files: the one given by --config, or else the ones found
+  2. CONFIGDIFF_* environment variables
+  3. flags given on the command line
+
+Each setting can also be set by an environment variable named after its
+key, which takes precedence over the file:
+
+  CONFIGDIFF_IGNORE_PATHS       ignore_paths, e.g. "/status/**,/metadata/generation"
+  CONFIGDIFF_ARRAY_KEYS         array_keys, e.g. "/spec/containers=name,/spec/volumes=name"
+  CONFIGDIFF_NUMERIC_STRINGS    numeric_strings (1, true, 0, false)
+  CONFIGDIFF_BOOL_STRINGS       bool_strings
+  CONFIGDIFF_STABLE_ORDER       stable_order
+  CONFIGDIFF_OUTPUT_FORMAT      output_format
+  CONFIGDIFF_MAX_VALUE_LENGTH   max_value_length
+  CONFIGDIFF_NO_COLOR           no_color
+  CONFIGDIFF_TEMPLATE_FILE      template_file
+  CONFIGDIFF_EXCLUDE_PATHS      exclude_paths
+  CONFIGDIFF_MAX_PARSE_SIZE     max_parse_size, e.g. 256MB
+  CONFIGDIFF_PRESET             preset
+  CONFIGDIFF_MASK_PATHS         mask_paths
+  CONFIGDIFF_MASK_MODE          mask_mode
+
+Lists are separated by commas; write "\," for a comma within an item.
+Variables set to the empty string are ignored. Flags given on the command
+line take precedence over both.
+
+The rules key lists settings for the files matching a glob, e.g.:
+
+  rules:
+    - match: "*.tf"
+      ignore_paths: [/provider/**]
+    - match: k8s/**/*.yaml
+      preset: kubernetes
+      array_keys:
+        /spec/template/spec/containers: name
+
+A rule applies when the new file of a comparison matches its glob, which is
+matched like --exclude patterns against the file's path relative to the
+config file's directory: a glob without a slash matches the file name. The
+rules that match are applied in order over the settings above: their
+ignore_paths and array_keys are added, and their preset, numeric_strings,
+and bool_strings replace earlier values, so later rules win. Flags still
+take precedence.
+
+The severity_rules key rates the changes at the paths matching a glob when
+--severity classifies them, instead of by change type, e.g.:
+
+  severity_rules:
+    - match: /metadata/labels/**
+      severity: info
+    - match: /spec/replicas
+      severity: breaking     # or error; warning or warn; info
+
+The last rule matching a path wins. mask_paths and mask_mode are defaults
+for --mask-path and --mask-mode, so secrets stay masked without the flags.
+
+The extends key names config files, relative to the file naming them, that
+the file is applied over, e.g. rules shared by a team:
+
+  extends: ../platform/configdiff/base.yaml   # or a list of files
+
+Extended files are applied in order and can extend files themselves. A
+setting in the file replaces theirs, except that array_keys are merged by
+path and rules are added after theirs. "config show" names the file each
+setting comes from.
+
+"config schema" prints a JSON Schema of the file, for editors to complete
+and check settings with, e.g. with yaml-language-server:
+
+  configdiff config schema > configdiff.schema.json
+  # then on the first line of .configdiff.yaml:
+  # yaml-language-server: $schema=./configdiff.schema.json
+
+The schema of each release is also in docs/schema/config.v1.json.`,
+	}
+
+	configInitCmd.Flags().BoolVar(&o.configInitForce, "force", false, "Replace an existing file")
+
+	configCmd.AddCommand(configValidateCmd, configShowCmd, configSchemaCmd, configInitCmd)
+
+	return configCmd
+}
+
+// discoverConfig sets the config file to be loaded to the one nearest the
+// first of paths that exists, unless --no-discover is given. Stdin and URLs
+// are skipped; without a local path the one in the current or home
+// directory is used.
+func (o *options) discoverConfig(paths []string) {
+	o.cfgDir = ""
+	if o.noDiscover {
+		return
+	}
+	for _, path := range paths {
+		if path == "-" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		o.cfgDir = path
+		if !info.IsDir() {
+			o.cfgDir = filepath.Dir(path)
+		}
+		return
+	}
+}
+
+// loadConfig loads the config file given by --config, or else the ones
+// found from cfgDir, or only the nearest of them with --no-merge-config, and
+// the environment, into cfg. A file that cannot be loaded,
+// including one with unknown keys or invalid values, is an error, unless
+// --lenient-config is given: unknown keys are then ignored, and a file that
+// still cannot be loaded is warned about and skipped, unless it was given
+// by --config. Invalid environment variables are warned about.
+func (o *options) loadConfig() error {
+	switch {
+	case o.configFile != "":
+		o.cfg, o.cfgErr = config.LoadPath(o.configFile, o.lenientConfig)
+	case o.noMergeConfig:
+		o.cfg, o.cfgErr = config.LoadNearest(o.cfgDir, o.lenientConfig)
+	default:
+		o.cfg, o.cfgErr = config.LoadFrom(o.cfgDir, o.lenientConfig)
+	}
+
+	// Values are checked here so errors point at the file, not a flag;
+	// settings taken from the environment are checked with the flags
+	if o.cfg.Path != "" && !o.lenientConfig {
+		var path string
+		var msgs []string
+		for _, p := range checkConfigValues(o.cfg) {
+			if slices.Contains(o.cfg.Env, p.Key) {
+				continue
+			}
+			// The error names the file of the first problem, the nearest
+			// of those setting it, or the file extending it
+			source := o.cfg.Sources[p.Key]
+			if i := strings.LastIndex(source, ", "); i >= 0 {
+				source = source[i+2:]
+			}
+			if path == "" {
+				path = o.cfg.Path
+				if i := strings.LastIndex(source, ":"); i >= 0 && slices.Contains(o.cfg.Files, source[:i]) {
+					path = source[:i]
+				}
+			}
+			if line, ok := strings.CutPrefix(source, path+":"); ok {
+				source = "line " + line
+			}
+			msgs = append(msgs, source+": "+p.Message)
+		}
+		if len(msgs) > 0 {
+			o.cfgErr = errors.Join(&config.FileError{Path: path, Err: errors.New(strings.Join(msgs, "; "))}, o.cfgErr)
+			o.cfg = &config.Config{}
+		}
+	}
+
+	if o.cfgErr == nil {
+		return nil
+	}
+	var fileErr *config.FileError
+	if !errors.As(o.cfgErr, &fileErr) {
+		fmt.Fprintf(o.messages(), "Warning: %v\n", o.cfgErr)
+		return nil
+	}
+	if o.configFile != "" {
+		// A file asked for is never skipped
+		return o.cfgErr
+	}
+	if !o.lenientConfig {
+		return fmt.Errorf("%w\nHint: Run \"configdiff config validate\" for details, or use --lenient-config to ignore unknown keys", o.cfgErr)
+	}
+	// Its settings would otherwise be silently missing
+	fmt.Fprintf(o.messages(), "Warning: %v\nHint: Run \"configdiff config validate\" for details\n", o.cfgErr)
+	return nil
+}
+
+// configFiles returns the config files in use outside of a comparison, from
+// lowest to highest precedence.
+func (o *options) configFiles() []string {
+	if o.configFile != "" {
+		return []string{o.configFile}
+	}
+	paths := config.FindAll()
+	if o.noMergeConfig && len(paths) > 0 {
+		paths = paths[len(paths)-1:]
+	}
+	return paths
+}
+
+// configPaths returns the config file named by args, or the ones in use.
+func (o *options) configPaths(args []string) ([]string, error) {
+	if len(args) > 0 {
+		return args[:1], nil
+	}
+	paths := o.configFiles()
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no config file found (looked for %s)", strings.Join(config.Locations(), ", "))
+	}
+	return paths, nil
+}
+
+// runConfigValidate is the entry point for the config validate command.
+func (o *options) runConfigValidate(cmd *cobra.Command, args []string) error {
+	paths, err := o.configPaths(args)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range paths {
+		errs = append(errs, validateConfigFile(cmd, path))
+	}
+	return errors.Join(errs...)
+}
+
+// validateConfigFile reports the problems of the config file at path.
+func validateConfigFile(cmd *cobra.Command, path string) error {
+	f, problems, err := config.Validate(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	// Extended files are only loaded once the file itself parses
+	if len(problems) == 0 && len(f.Config.Extends) > 0 {
+		if _, err := config.LoadFile(path, false); err != nil {
+			problems = append(problems, config.Problem{Line: f.Lines["extends"], Message: err.Error()})
+		}
+	}
+	for _, p := range checkConfigValues(f.Config) {
+		p.Line = f.Lines[p.Key]
+		problems = append(problems, p)
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+
+	if len(problems) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: OK\n", path)
+		return nil
+	}
+	for _, p := range problems {
+		if p.Line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, p.Line, p.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, p.Message)
+		}
+	}
+	return fmt.Errorf("%s has %s", path, plural(len(problems), "problem", "problems"))
+}
+
+// checkConfigValues reports settings of c that parse but are not valid
+// values for the flags they set, with the keys they are under.
+func checkConfigValues(c *config.Config) []config.Problem {
+	var problems []config.Problem
+	if c.OutputFormat != "" && !slices.Contains(cli.OutputFormats, c.OutputFormat) {
+		problems = append(problems, config.Problem{
+			Key:     "output_format",
+			Message: fmt.Sprintf("invalid output_format %q, must be one of: %s", c.OutputFormat, strings.Join(cli.OutputFormats, ", ")),
+		})
+	}
+	if c.MaxValueLength < 0 {
+		problems = append(problems, config.Problem{
+			Key:     "max_value_length",
+			Message: fmt.Sprintf("invalid max_value_length %d, must not be negative", c.MaxValueLength),
+		})
+	}
+	if c.MaxParseSize != "" {
+		if _, err := cli.ParseSize(c.MaxParseSize); err != nil {
+			problems = append(problems, config.Problem{
+				Key:     "max_parse_size",
+				Message: fmt.Sprintf("invalid max_parse_size: %v", err),
+			})
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(c.ArrayKeys)) {
+		if key := c.ArrayKeys[path]; path == "" || key == "" {
+			problems = append(problems, config.Problem{
+				Key:     "array_keys",
+				Message: fmt.Sprintf("invalid array_keys entry %q: %q, path and key must not be empty", path, key),
+			})
+		}
+	}
+	if c.Preset != "" && !slices.Contains(cli.Presets, c.Preset) {
+		problems = append(problems, config.Problem{
+			Key:     "preset",
+			Message: fmt.Sprintf("invalid preset %q, must be one of: %s", c.Preset, strings.Join(cli.Presets, ", ")),
+		})
+	}
+	for _, pattern := range c.MaskPaths {
+		if err := diff.ValidatePathPattern(pattern); err != nil {
+			problems = append(problems, config.Problem{
+				Key:     "mask_paths",
+				Message: fmt.Sprintf("invalid mask_paths entry: %v", err),
+			})
+		}
+	}
+	if c.MaskMode != "" && report.ValidateMaskMode(c.MaskMode) != nil {
+		problems = append(problems, config.Problem{
+			Key:     "mask_mode",
+			Message: fmt.Sprintf("invalid mask_mode %q, must be one of: %s, %s", c.MaskMode, report.MaskModeRedact, report.MaskModeHash),
+		})
+	}
+	for i, rule := range c.SeverityRules {
+		var msgs []string
+		if err := diff.ValidatePathPattern(rule.Match); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+		if _, err := report.ParseSeverity(rule.Severity); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+		for _, msg := range msgs {
+			problems = append(problems, config.Problem{
+				Key:     "severity_rules",
+				Message: fmt.Sprintf("severity rule %d: %s", i+1, msg),
+			})
+		}
+	}
+	for i, rule := range c.Rules {
+		var msgs []string
+		if rule.Match == "" {
+			msgs = append(msgs, "match must not be empty")
+		} else if _, err := path.Match(rule.Match, ""); err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid match %q: %v", rule.Match, err))
+		}
+		if rule.Preset != "" && !slices.Contains(cli.Presets, rule.Preset) {
+			msgs = append(msgs, fmt.Sprintf("invalid preset %q, must be one of: %s", rule.Preset, strings.Join(cli.Presets, ", ")))
+		}
+		for _, path := range slices.Sorted(maps.Keys(rule.ArrayKeys)) {
+			if key := rule.ArrayKeys[path]; path == "" || key == "" {
+				msgs = append(msgs, fmt.Sprintf("invalid array_keys entry %q: %q, path and key must not be empty", path, key))
+			}
+		}
+		for _, msg := range msgs {
+			problems = append(problems, config.Problem{
+				Key:     "rules",
+				Message: fmt.Sprintf("rule %d: %s", i+1, msg),
+			})
+		}
+	}
+	return problems
+}
+
+// configSetting is a config file key, the flag it sets a default for, and
+// its value in a config.
+type configSetting struct {
+	key   string
+	flag  string
+	value func(*config.Config) any
+}
+
+// configSettings lists the config file keys in the order they are shown.
+var configSettings = []configSetting{
+	{"ignore_paths", "ignore", func(c *config.Config) any { return c.IgnorePaths }},
+	{"array_keys", "array-key", func(c *config.Config) any { return c.ArrayKeys }},
+	{"numeric_strings", "numeric-strings", func(c *config.Config) any { return c.NumericStrings }},
+	{"bool_strings", "bool-strings", func(c *config.Config) any { return c.BoolStrings }},
+	{"stable_order", "stable-order", func(c *config.Config) any { return c.StableOrder }},
+	{"output_format", "output", func(c *config.Config) any { return c.OutputFormat }},
+	{"max_value_length", "max-value-length", func(c *config.Config) any { return c.MaxValueLength }},
+	{"no_color", "no-color", func(c *config.Config) any { return c.NoColor }},
+	{"template_file", "template-file", func(c *config.Config) any { return c.TemplateFile }},
+	{"exclude_paths", "exclude", func(c *config.Config) any { return c.ExcludePaths }},
+	{"max_parse_size", "max-parse-size", func(c *config.Config) any { return c.MaxParseSize }},
+	{"preset", "preset", func(c *config.Config) any { return c.Preset }},
+	{"mask_paths", "mask-path", func(c *config.Config) any { return c.MaskPaths }},
+	{"mask_mode", "mask-mode", func(c *config.Config) any { return c.MaskMode }},
+	{"severity_rules", "", func(c *config.Config) any { return c.SeverityRules }},
+	{"rules", "", func(c *config.Config) any { return c.Rules }},
+	{"extends", "", func(c *config.Config) any { return c.Extends }},
+}
+
+// runConfigShow is the entry point for the config show command.
+func (o *options) runConfigShow(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+
+	fileCfg := &config.Config{}
+	paths := o.configFiles()
+	for _, path := range paths {
+		f, problems, err := config.Validate(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		if len(problems) > 0 {
+			fmt.Fprintf(o.messages(), "Warning: %s has %s; run \"configdiff config validate\" for details\n",
+				path, plural(len(problems), "problem", "problems"))
+		}
+		loaded, err := config.LoadFile(path, false)
+		if err != nil {
+			// Show what the file itself sets
+			if len(problems) == 0 {
+				fmt.Fprintf(o.messages(), "Warning: %v\n", err)
+			}
+			loaded = f.Config
+			loaded.Sources = make(map[string]string, len(f.Lines))
+			for key, line := range f.Lines {
+				loaded.Sources[key] = fmt.Sprintf("%s:%d", path, line)
+			}
+		}
+		fileCfg.Merge(loaded)
+		fmt.Fprintf(out, "# Config file: %s\n", path)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(out, "# Config file: none")
+	}
+
+	env := &config.Config{}
+	envKeys, err := env.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		fmt.Fprintf(o.messages(), "Warning: %v\n", err)
+	}
+
+	for _, setting := range configSettings {
+		value, source := effectiveSetting(setting, cmd.Root().Flags(), fileCfg, env, envKeys)
+		// Unset lists and maps are shown empty rather than null
+		switch v := value.(type) {
+		case []string:
+			if v == nil {
+				value = []string{}
+			}
+		case map[string]string:
+			if v == nil {
+				value = map[string]string{}
+			}
+		case []config.Rule:
+			if v == nil {
+				value = []config.Rule{}
+			}
+		case []config.SeverityRule:
+			if v == nil {
+				value = []config.SeverityRule{}
+			}
+		case config.Paths:
+			if v == nil {
+				value = config.Paths{}
+			}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s: %s  # %s\n", setting.key, data, source)
+	}
+	return nil
+}
+
+// effectiveSetting returns the value of a setting in effect when its flag in
+// flags is not given, and where it comes from: the environment, whose
+// settings env sets the keys envKeys of, the config files merged into
+// fileCfg, or the flag's default.
+func effectiveSetting(setting configSetting, flags *pflag.FlagSet, fileCfg *config.Config, env *config.Config, envKeys []string) (any, string) {
+	if setting.key == "no_color" && os.Getenv("NO_COLOR") != "" {
+		return true, "env NO_COLOR"
+	}
+	if slices.Contains(envKeys, setting.key) {
+		return setting.value(env), "env " + config.EnvVar(setting.key)
+	}
+	if fileCfg != nil {
+		if source, ok := fileCfg.Sources[setting.key]; ok {
+			return setting.value(fileCfg), source
+		}
+	}
+
+	// Flag defaults are parsed as the setting to show them with its type
+	var defaults config.Config
+	if fl := flags.Lookup(setting.flag); fl != nil && fl.DefValue != "" && fl.DefValue != "[]" {
+		_ = yaml.Unmarshal([]byte(setting.key+": "+fl.DefValue), &defaults)
+	}
+	return setting.value(&defaults), "default"
+}
+
+// configSchemaID is where the config schema is published, see
+// docs/schema/config.v1.json.
+const configSchemaID = "https://github.com/pfrederiksen/configdiff/docs/schema/config.v1.json"
+
+// schemaDescriptions describe the settings without a flag in the config
+// schema; the others are described by their flag's usage.
+var schemaDescriptions = map[string]string{
+	"rules":          "Settings for the files matching a glob, applied in order over the others",
+	"severity_rules": "Severities for the changes at the paths matching a glob, when --severity classifies them",
+	"extends":        "Config files this one is applied over, relative to it",
+}
+
+// configSchema returns the JSON Schema of config files, with the
+// description of each setting from its flag in flags and the allowed values
+// of those with a fixed set.
+func configSchema(flags *pflag.FlagSet) map[string]any {
+	schema := config.Schema()
+	schema["$id"] = configSchemaID
+	for _, setting := range configSettings {
+		description := schemaDescriptions[setting.key]
+		if fl := flags.Lookup(setting.flag); fl != nil {
+			description = fmt.Sprintf("Default for --%s: %s", setting.flag, fl.Usage)
+		}
+		if prop := schemaProperty(schema, setting.key); prop != nil && description != "" {
+			prop["description"] = description
+		}
+	}
+
+	// "" leaves a setting unset
+	enums := map[string][]string{
+		"output_format":           append([]string{""}, cli.OutputFormats...),
+		"preset":                  append([]string{""}, cli.Presets...),
+		"rules.preset":            append([]string{""}, cli.Presets...),
+		"mask_mode":               {"", report.MaskModeRedact, report.MaskModeHash},
+		"severity_rules.severity": {string(report.SeverityBreaking), string(report.SeverityWarning), string(report.SeverityInfo), "error", "warn"},
+	}
+	for path, values := range enums {
+		if prop := schemaProperty(schema, strings.Split(path, ".")...); prop != nil {
+			prop["enum"] = values
+		}
+	}
+	if prop := schemaProperty(schema, "max_value_length"); prop != nil {
+		prop["minimum"] = 0
+	}
+	return schema
+}
+
+// schemaProperty returns the schema of the setting at the path of keys in
+// schema, descending into the items of lists, or nil if there is none.
+func schemaProperty(schema map[string]any, keys ...string) map[string]any {
+	for _, key := range keys {
+		if items, ok := schema["items"].(map[string]any); ok {
+			schema = items
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		prop, ok := properties[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		schema = prop
+	}
+	return schema
+}
+
+// runConfigSchema is the entry point for the config schema command.
+func runConfigSchema(cmd *cobra.Command, args []string) error {
+	data, err := json.MarshalIndent(configSchema(cmd.Root().Flags()), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s\n", data)
+	return nil
+}
+
+// starterConfig is the file written by config init.
+const starterConfig = `# configdiff configuration
+#
+# Settings here are defaults for the flags named in the comments; flags given
+# on the command line take precedence. Check this file with
+# "configdiff config validate".
+
+# Paths to ignore in every comparison (--ignore)
+ignore_paths: []
+#  - /metadata/generation
+#  - /status
+
+# Array paths compared as sets, keyed by a field of their elements (--array-key)
+array_keys: {}
+#  /spec/containers: name
+
+# Coerce numeric strings to numbers and "true"/"false" strings to booleans
+# (--numeric-strings, --bool-strings)
+numeric_strings: false
+bool_strings: false
+
+# Sort changes by path rather than in the order compared (--stable-order)
+stable_order: true
+
+# Default output format: report, compact, json, patch, markdown, ... (--output)
+output_format: report
+
+# Truncate values longer than this many characters, 0 for no limit
+# (--max-value-length)
+max_value_length: 80
+
+# Disable colored output (--no-color)
+no_color: false
+
+# Go text/template file for the template output format (--template-file)
+template_file: ""
+
+# Files and directories skipped in recursive comparisons (--exclude)
+exclude_paths: []
+#  - generated
+
+# Fail to parse documents larger than this, e.g. 256MB, 0 for no limit
+# (--max-parse-size)
+max_parse_size: 64MB
+
+# Preset for a kind of file: compose or kubernetes (--preset)
+preset: ""
+
+# Paths whose values are masked in all output (--mask-path)
+mask_paths: []
+#  - /spec/database/password
+
+# How masked values are shown: redact or hash (--mask-mode)
+mask_mode: redact
+
+# Severities for the changes at the paths matching a glob when --severity
+# classifies them: info, warning, or breaking; later rules win
+severity_rules: []
+#  - match: /metadata/labels/**
+#    severity: info
+#  - match: /spec/replicas
+#    severity: breaking
+
+# Settings for the files matching a glob, applied in order over those above:
+# ignore_paths and array_keys are added, and preset, numeric_strings, and
+# bool_strings replaced, so later rules win
+rules: []
+#  - match: "*.tf"
+#    ignore_paths: [/provider/**]
+#  - match: k8s/**/*.yaml
+#    preset: kubernetes
+
+# Config files this one is applied over, relative to it; settings here
+# replace theirs
+extends: []
+#  - ../shared/configdiff.yaml
+`
+
+// runConfigInit is the entry point for the config init command.
+func (o *options) runConfigInit(cmd *cobra.Command, args []string) error {
+	path := ".configdiffrc"
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if o.configInitForce {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists\nHint: Use --force to replace it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create config file: %w", err)
+	}
+	if _, err := file.WriteString(starterConfig); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\n", path)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+)
+
+// convertFlags holds the flags of the convert command.
+type convertFlags struct {
+	// Convert flags
+	convertTo     string
+	convertFormat string
+	convertOutput string
+}
+
+// newConvertCmd returns the convert command.
+func newConvertCmd(o *options) *cobra.Command {
+	convertCmd := &cobra.Command{
+		Use:   "convert [flags] <file>",
+		Short: "Convert a configuration file to another format",
+		Long: `Parse a configuration file and write it in another format, as the document
+configdiff compares: object keys sorted, numbers normalized, and comments
+dropped. The result is written to stdout, or to --output.
+
+Any input format can be converted to yaml, json, or toml; HCL can be read but
+not written. YAML keys that are not strings, such as 80 or true, become
+strings. A YAML stream with several documents becomes a JSON array of them,
+or stays a stream of documents as YAML; TOML holds a single document, so such
+a stream cannot be converted to it.`,
+		Example: `  # Convert Terraform variables to JSON
+  configdiff convert terraform.tfvars --to json
+
+  # Convert a TOML file to YAML
+  configdiff convert config.toml --to yaml -o config.yaml
+
+  # Convert a multi-document manifest to a JSON array
+  configdiff convert manifests.yaml --to json`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.runConvert,
+	}
+
+	convertCmd.Flags().StringVar(&o.convertTo, "to", "", "Output format (yaml, json, toml)")
+	convertCmd.Flags().StringVarP(&o.convertFormat, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
+	convertCmd.Flags().StringVarP(&o.convertOutput, "output", "o", "", "Write the result to this file instead of stdout")
+	_ = convertCmd.MarkFlagRequired("to")
+	_ = convertCmd.RegisterFlagCompletionFunc("to", cobra.FixedCompletions(
+		[]string{string(parse.FormatYAML), string(parse.FormatJSON), string(parse.FormatTOML)}, cobra.ShellCompDirectiveNoFileComp))
+
+	return convertCmd
+}
+
+// runConvert is the entry point for the convert command.
+func (o *options) runConvert(cmd *cobra.Command, args []string) error {
+	return o.convert(args[0])
+}
+
+// convert writes path in the --to format.
+func (o *options) convert(path string) error {
+	to := parse.Format(o.convertTo)
+	switch to {
+	case parse.FormatYAML, parse.FormatJSON, parse.FormatTOML:
+	case parse.FormatHCL:
+		return fmt.Errorf("cannot convert to hcl: HCL can only be read (valid --to: yaml, json, toml)")
+	default:
+		return fmt.Errorf("invalid --to %q (valid: yaml, json, toml)", o.convertTo)
+	}
+
+	input, err := cli.ReadInput(path, o.convertFormat)
+	if err != nil {
+		return err
+	}
+	docs, err := parseDocuments(input)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var out []byte
+	switch {
+	case len(docs) == 1:
+		out, err = parse.Marshal(docs[0], to)
+	case to == parse.FormatJSON:
+		out, err = parse.Marshal(tree.NewArray(docs), to)
+	case to == parse.FormatYAML:
+		var parts [][]byte
+		for _, doc := range docs {
+			part, err := parse.Marshal(doc, to)
+			if err != nil {
+				return fmt.Errorf("failed to write %s as %s: %w", path, to, err)
+			}
+			parts = append(parts, part)
+		}
+		out = bytes.Join(parts, []byte("---\n"))
+	default:
+		return fmt.Errorf("cannot convert %s to %s: it has %d YAML documents and %s holds one; convert to json or yaml instead",
+			path, to, len(docs), to)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s as %s: %w", path, to, err)
+	}
+
+	if o.convertOutput != "" {
+		if err := os.WriteFile(o.convertOutput, out, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", o.convertOutput, err)
+		}
+		return nil
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// parseDocuments parses input into its documents: every document of a YAML
+// stream, or the single document of other formats.
+func parseDocuments(input *cli.InputSource) ([]*tree.Node, error) {
+	if parse.Format(input.Format) == parse.FormatYAML {
+		return parse.ParseYAMLDocuments(input.Data)
+	}
+	node, err := parse.Parse(input.Data, parse.Format(input.Format))
+	if err != nil {
+		return nil, err
+	}
+	return []*tree.Node{node}, nil
+}
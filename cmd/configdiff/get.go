@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+)
+
+// getFlags holds the flags of the get command.
+type getFlags struct {
+	// Get flags
+	getOutput string
+	getFormat string
+}
+
+// newGetCmd returns the get command.
+func newGetCmd(o *options) *cobra.Command {
+	getCmd := &cobra.Command{
+		Use:   "get [flags] <file> <path>",
+		Short: "Print the value at a path in a configuration file",
+		Long: `Parse a configuration file and print the value at a path, as used by
+--ignore and shown in diffs, e.g. /spec/template/spec/containers[0]/image.
+Scalars are printed raw; objects and arrays as YAML, or JSON with --output.
+
+A path with "*" segments, each matching any number of segments, prints every
+match as a "path: value" line with the value as compact JSON. Of a match and
+the matches inside it, only the innermost are printed.
+
+Exit status is 0 if the path exists, 1 if it does not, and 2 on errors.`,
+		Example: `  # Print a container image
+  configdiff get deploy.yaml /spec/template/spec/containers[0]/image
+
+  # Print a block of a Terraform file as JSON
+  configdiff get -o json main.tf /resource/aws_instance
+
+  # Print every image in a manifest
+  configdiff get deploy.yaml '/spec/*/image'`,
+		Args: cobra.ExactArgs(2),
+		RunE: o.runGet,
+	}
+
+	getCmd.Flags().StringVarP(&o.getOutput, "output", "o", "yaml", "Format of objects and arrays (yaml, json)")
+	getCmd.Flags().StringVarP(&o.getFormat, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
+	_ = getCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(
+		[]string{string(parse.FormatYAML), string(parse.FormatJSON)}, cobra.ShellCompDirectiveNoFileComp))
+
+	return getCmd
+}
+
+// runGet is the entry point for the get command.
+func (o *options) runGet(cmd *cobra.Command, args []string) error {
+	return o.get(args[0], args[1])
+}
+
+// get prints the value at path in file, or every match of a wildcard path.
+func (o *options) get(file, path string) error {
+	if o.getOutput != string(parse.FormatYAML) && o.getOutput != string(parse.FormatJSON) {
+		return fmt.Errorf("invalid --output %q for get (valid: yaml, json)", o.getOutput)
+	}
+
+	input, err := cli.ReadInput(file, o.getFormat)
+	if err != nil {
+		return err
+	}
+	root, err := parse.Parse(input.Data, parse.Format(input.Format))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	if !strings.Contains(path, "*") {
+		node := root.GetByPath(path)
+		if node == nil {
+			return &exitError{code: exitDifferences, err: fmt.Errorf("%s: no value at %s", file, path)}
+		}
+		out, err := formatValue(node, parse.Format(o.getOutput))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	root.SetPaths("/")
+	matches := matchNodes(root, path)
+	if len(matches) == 0 {
+		return &exitError{code: exitDifferences, err: fmt.Errorf("%s: no value matches %s", file, path)}
+	}
+	for _, node := range matches {
+		value, err := json.Marshal(node.ToInterface())
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", node.Path, err)
+		}
+		fmt.Fprintf(os.Stdout, "%s: %s\n", node.Path, value)
+	}
+	return nil
+}
+
+// matchNodes returns the nodes below root, in document order, whose paths
+// match a diff.MatchPath pattern and contain no other match.
+func matchNodes(root *tree.Node, pattern string) []*tree.Node {
+	var matches []*tree.Node
+	var visit func(n *tree.Node) bool
+	visit = func(n *tree.Node) bool {
+		inner := false
+		switch n.Kind {
+		case tree.KindObject:
+			for _, key := range n.SortedKeys() {
+				inner = visit(n.Object[key]) || inner
+			}
+		case tree.KindArray:
+			for _, elem := range n.Array {
+				inner = visit(elem) || inner
+			}
+		}
+		if inner {
+			return true
+		}
+		if diff.MatchPath(n.Path, pattern) {
+			matches = append(matches, n)
+			return true
+		}
+		return false
+	}
+	visit(root)
+	return matches
+}
+
+// formatValue renders a scalar raw, with a newline, and an object or array
+// in format.
+func formatValue(node *tree.Node, format parse.Format) ([]byte, error) {
+	switch node.Kind {
+	case tree.KindObject, tree.KindArray:
+		return parse.Marshal(node, format)
+	case tree.KindString:
+		return []byte(fmt.Sprint(node.Value) + "\n"), nil
+	default:
+		value, err := json.Marshal(node.ToInterface())
+		if err != nil {
+			return nil, fmt.Errorf("failed to format value: %w", err)
+		}
+		return append(value, '\n'), nil
+	}
+}
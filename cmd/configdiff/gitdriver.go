@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+)
+
+// devNull is the file git passes for the missing side of an added or deleted file.
+const devNull = "/dev/null"
+
+// newGitDriverCmd returns the git-driver command.
+func newGitDriverCmd(o *options) *cobra.Command {
+	gitDriverCmd := &cobra.Command{
+		Use:   "git-driver <path> <old-file> <old-hex> <old-mode> <new-file> <new-hex> <new-mode>",
+		Short: "Run as git's external diff driver",
+		Long: `Run as git's external diff driver, so that "git diff" shows semantic diffs of
+configuration files.
+
+Git calls the driver with seven arguments (path, old-file, old-hex, old-mode,
+new-file, new-hex, new-mode), or nine for renames. Added and deleted files
+are shown as a full report of everything added or removed. Differences never
+make the driver fail, as git requires.
+
+To use it for YAML files, add to .git/config or ~/.gitconfig:
+
+  [diff "configdiff"]
+      command = configdiff git-driver
+
+and to .gitattributes:
+
+  *.yaml diff=configdiff
+  *.yml diff=configdiff
+
+Flags such as --ignore go in the command, e.g.
+"configdiff git-driver --ignore /metadata/generation".`,
+		Hidden: true,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 7 && len(args) != 9 {
+				return fmt.Errorf("git-driver expects the 7 or 9 arguments git passes to external diff drivers, received %d", len(args))
+			}
+			return nil
+		},
+		RunE: o.runGitDriver,
+	}
+
+	gitDriverCmd.Flags().StringVarP(&o.outputFormat, "output", "o", "report", "Output format (see configdiff --help)")
+	gitDriverCmd.Flags().StringSliceVarP(&o.ignorePaths, "ignore", "i", nil, "Paths to ignore (can be repeated)")
+	gitDriverCmd.Flags().StringSliceVar(&o.arrayKeys, "array-key", nil, "Array paths to key fields (format: path=key)")
+	gitDriverCmd.Flags().StringVar(&o.colorMode, "color", "auto", "When to color output: auto, always, or never")
+	gitDriverCmd.Flags().BoolVar(&o.noColor, "no-color", false, "Disable colored output, same as --color=never")
+
+	return gitDriverCmd
+}
+
+// runGitDriver is the entry point for the git-driver command.
+func (o *options) runGitDriver(cmd *cobra.Command, args []string) error {
+	return o.gitDriver(args)
+}
+
+// gitDriver compares the two files of a git external diff invocation,
+// labeled with the path in the repository rather than git's temporary names.
+func (o *options) gitDriver(args []string) error {
+	oldPath, newPath := args[0], args[0]
+	if len(args) == 9 {
+		// Renames add the new path and git's similarity information
+		newPath = args[7]
+	}
+	oldFile, oldMode, newFile, newMode := args[1], args[3], args[4], args[6]
+	if oldFile == devNull && newFile == devNull {
+		return fmt.Errorf("git-driver: both files are %s", devNull)
+	}
+
+	cliOpts, err := o.cliOptions(oldFile, newFile)
+	if err != nil {
+		return err
+	}
+
+	// The missing side of an added or deleted file is an empty document of
+	// the same kind, so every top-level key shows up as added or removed
+	var oldTree, newTree *tree.Node
+	if oldFile != devNull {
+		if oldTree, err = o.readTree(oldFile, cliOpts.GetOldFormat()); err != nil {
+			return err
+		}
+	}
+	if newFile != devNull {
+		if newTree, err = o.readTree(newFile, cliOpts.GetNewFormat()); err != nil {
+			return err
+		}
+	}
+	oldLabel, newLabel := "a/"+oldPath, "b/"+newPath
+	switch {
+	case oldFile == devNull:
+		oldTree, oldLabel = emptyLike(newTree), devNull
+	case newFile == devNull:
+		newTree, newLabel = emptyLike(oldTree), devNull
+	}
+	if cliOpts.OutputFormat == "git-diff" {
+		// The format adds the a/ and b/ prefixes itself
+		oldLabel, newLabel = oldPath, newPath
+	}
+
+	fd, err := o.diffTrees(cliOpts, oldTree, newTree)
+	if err != nil {
+		return err
+	}
+
+	// git-diff output carries its own header
+	if cliOpts.OutputFormat != "git-diff" {
+		fmt.Printf("diff --configdiff a/%s b/%s\n", oldPath, newPath)
+		switch {
+		case oldFile == devNull:
+			fmt.Printf("new file mode %s\n", newMode)
+		case newFile == devNull:
+			fmt.Printf("deleted file mode %s\n", oldMode)
+		case oldMode != newMode:
+			fmt.Printf("old mode %s\nnew mode %s\n", oldMode, newMode)
+		}
+	}
+
+	outOpts := o.outputOptions(oldLabel, newLabel, fd)
+	outOpts.Format = cliOpts.OutputFormat
+	return o.writeOutput(fd.result, outOpts)
+}
+
+// emptyLike returns an empty document of the same kind as n: an empty object
+// or array, or nil for scalars, whose addition is then a single change.
+func emptyLike(n *tree.Node) *tree.Node {
+	switch n.Kind {
+	case tree.KindObject:
+		return tree.NewObject(map[string]*tree.Node{})
+	case tree.KindArray:
+		return tree.NewArray([]*tree.Node{})
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+)
+
+// helmFlags holds the flags of the helm command.
+type helmFlags struct {
+	// Helm flags
+	helmValues     []string
+	helmOldValues  []string
+	helmNewValues  []string
+	helmSet        []string
+	helmRelease    string
+	helmNamespace  string
+	helmOldVersion string
+	helmNewVersion string
+	helmNoPreset   bool
+}
+
+// newHelmCmd returns the helm command and its subcommands.
+func newHelmCmd(o *options) *cobra.Command {
+	templateDiffCmd := &cobra.Command{
+		Use:   "template-diff [flags] <old-chart> <new-chart>",
+		Short: "Compare the manifests two charts render, resource by resource",
+		Long: `Render two charts with "helm template" and compare the Kubernetes resources
+they produce, matched by kind, namespace, and name, whatever order they are
+rendered in. Resources only one chart renders are reported as added or
+removed.
+
+A chart is a chart directory, a packaged chart, a repository reference such
+as bitnami/nginx, or an OCI reference; --old-version and --new-version pick
+the version of charts from a repository. Values files given with --values
+apply to both charts, and --old-values and --new-values to one of them. A
+YAML or JSON file, or "-" for stdin, is read as manifests rendered
+beforehand, and helm is not needed for it.
+
+Resources are compared with a preset for Kubernetes: fields the API server
+maintains and the helm.sh/chart label are ignored, and the containers,
+volumes, and image pull secrets of pod specs are matched by name. Use
+--no-preset to turn it off; --ignore and --array-key add to it.`,
+		Example: `  # Compare two versions of a chart with the same values
+  configdiff helm template-diff bitnami/nginx bitnami/nginx --old-version 15.0.0 --new-version 16.0.0 --values values.yaml
+
+  # Compare the effect of a values change
+  configdiff helm template-diff ./chart ./chart --old-values values.yaml --new-values values-prod.yaml
+
+  # Compare manifests rendered beforehand
+  configdiff helm template-diff old-manifests.yaml new-manifests.yaml`,
+		Args: cobra.ExactArgs(2),
+		RunE: o.runTemplateDiff,
+	}
+
+	helmCmd := &cobra.Command{
+		Use:   "helm",
+		Short: "Compare Helm charts",
+		Long:  `Compare Helm charts by the Kubernetes manifests they render.`,
+	}
+
+	templateDiffCmd.Flags().StringArrayVarP(&o.helmValues, "values", "f", nil, "Values file for both charts (can be repeated)")
+	templateDiffCmd.Flags().StringArrayVar(&o.helmOldValues, "old-values", nil, "Values file for the old chart only, after --values (can be repeated)")
+	templateDiffCmd.Flags().StringArrayVar(&o.helmNewValues, "new-values", nil, "Values file for the new chart only, after --values (can be repeated)")
+	templateDiffCmd.Flags().StringArrayVar(&o.helmSet, "set", nil, "Set a value for both charts as key=value (can be repeated)")
+	templateDiffCmd.Flags().StringVar(&o.helmRelease, "release", "release-name", "Release name the charts are rendered with")
+	templateDiffCmd.Flags().StringVarP(&o.helmNamespace, "namespace", "n", "", "Namespace the charts are rendered for")
+	templateDiffCmd.Flags().StringVar(&o.helmOldVersion, "old-version", "", "Version of the old chart, for charts from a repository")
+	templateDiffCmd.Flags().StringVar(&o.helmNewVersion, "new-version", "", "Version of the new chart, for charts from a repository")
+	templateDiffCmd.Flags().BoolVar(&o.helmNoPreset, "no-preset", false, "Compare resources without the Kubernetes ignore paths and array keys")
+	templateDiffCmd.Flags().StringVarP(&o.outputFormat, "output", "o", "report", "Output format (see configdiff --help)")
+	templateDiffCmd.Flags().StringSliceVarP(&o.ignorePaths, "ignore", "i", nil, "Paths to ignore in every resource (can be repeated)")
+	templateDiffCmd.Flags().StringSliceVar(&o.arrayKeys, "array-key", nil, "Array paths to key fields in every resource (format: path=key)")
+	templateDiffCmd.Flags().StringVar(&o.colorMode, "color", "auto", "When to color output: auto, always, or never")
+	templateDiffCmd.Flags().BoolVar(&o.noColor, "no-color", false, "Disable colored output, same as --color=never")
+	templateDiffCmd.Flags().CountVarP(&o.quiet, "quiet", "q", "Silence warnings, headers, and summaries on stderr (-q), or all output (-qq)")
+	templateDiffCmd.Flags().BoolVar(&o.exitCode, "exit-code", false, "Exit with code 1 if differences found (0 = none, 2 = error)")
+	templateDiffCmd.Flags().BoolVar(&o.lenientConfig, "lenient-config", false, "Ignore unknown keys and invalid values in the config file instead of failing")
+
+	helmCmd.AddCommand(templateDiffCmd)
+
+	return helmCmd
+}
+
+// runTemplateDiff is the entry point for the helm template-diff command.
+func (o *options) runTemplateDiff(cmd *cobra.Command, args []string) error {
+	o.flagChanged = cmd.Flags().Changed
+	if err := o.loadConfig(); err != nil {
+		return err
+	}
+	hasChanges, err := o.templateDiff(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if o.exitCode && hasChanges {
+		return errDifferences
+	}
+	return nil
+}
+
+// templateDiff compares the resources two charts render, reported like the
+// files of a directory comparison.
+// Returns true if any changes selected by --fail-on were found, false otherwise.
+func (o *options) templateDiff(oldChart, newChart string) (bool, error) {
+	if oldChart == "-" && newChart == "-" {
+		return false, fmt.Errorf("both old-chart and new-chart cannot be stdin (\"-\")")
+	}
+	oldResources, err := o.chartResources(oldChart, o.helmOldValues, o.helmOldVersion)
+	if err != nil {
+		return false, err
+	}
+	newResources, err := o.chartResources(newChart, o.helmNewValues, o.helmNewVersion)
+	if err != nil {
+		return false, err
+	}
+
+	cliOpts, err := o.cliOptions(oldChart, newChart)
+	if err != nil {
+		return false, err
+	}
+	if !o.helmNoPreset {
+		cliOpts.Preset = cli.PresetKubernetes
+	}
+
+	ids := make([]string, 0, len(oldResources)+len(newResources))
+	for id := range oldResources {
+		ids = append(ids, id)
+	}
+	for id := range newResources {
+		if _, ok := oldResources[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	dir := report.DirResult{OldDir: oldChart, NewDir: newChart}
+	diffs := make(map[string]*fileDiff)
+	for _, id := range ids {
+		file := report.FileResult{Path: id}
+		oldResource, newResource := oldResources[id], newResources[id]
+		switch {
+		case oldResource == nil:
+			file.Status = report.FileAdded
+		case newResource == nil:
+			file.Status = report.FileRemoved
+		default:
+			fd, err := o.diffTrees(cliOpts, oldResource, newResource)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", id, err)
+			}
+			file.Status = report.FileUnchanged
+			if fd.result.HasChanges() {
+				file.Status = report.FileModified
+			}
+			file.Changes = fd.result.Changes
+			diffs[id] = fd
+		}
+		dir.Files = append(dir.Files, file)
+	}
+
+	if err := o.renderDirectory(dir, diffs); err != nil {
+		return false, err
+	}
+	return cli.DirFailsOn(dir, o.failOn), nil
+}
+
+// chartResources renders a chart with helm template, with --values and then
+// values, or reads manifests rendered beforehand, and indexes the resulting
+// resources by their identity.
+func (o *options) chartResources(chart string, values []string, version string) (map[string]*tree.Node, error) {
+	var input *cli.InputSource
+	var err error
+	if isManifestFile(chart) {
+		input, err = cli.ReadInputWith(chart, string(parse.FormatYAML), o.inputOptions())
+	} else {
+		input, err = cli.RenderHelmChart(chart, cli.HelmOptions{
+			Release:   o.helmRelease,
+			Namespace: o.helmNamespace,
+			Version:   version,
+			Values:    append(append([]string{}, o.helmValues...), values...),
+			Set:       o.helmSet,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := parse.ParseYAMLDocuments(input.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", input.Path, err)
+	}
+	resources, err := cli.SplitKubeResources(docs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", input.Path, err)
+	}
+	return resources, nil
+}
+
+// isManifestFile reports whether a template-diff argument names manifests
+// rendered beforehand rather than a chart: stdin, or a YAML or JSON file or
+// URL.
+func isManifestFile(arg string) bool {
+	if arg == "-" {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(arg)) {
+	case ".yaml", ".yml", ".json":
+		if cli.IsURL(arg) {
+			return true
+		}
+		info, err := os.Stat(arg)
+		return err == nil && !info.IsDir()
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+)
+
+// incremental reports whether two inputs are compared incrementally, one
+// top-level member at a time, rather than parsed whole: when both are JSON
+// files on disk, either is larger than configdiff.IncrementalThreshold, and
+// nothing needs the whole documents, which are not kept. Unified output,
+// --context-keys, --interactive, and presets that rewrite documents need
+// them.
+func (o *options) incremental(cliOpts cli.CLIOptions, oldFile, newFile string) bool {
+	if configdiff.IncrementalThreshold <= 0 || cliOpts.OutputFormat == "unified" || o.contextKeys > 0 || o.interactive || cliOpts.Normalizes() {
+		return false
+	}
+	var size int64
+	for _, f := range []struct{ path, format string }{
+		{oldFile, cliOpts.GetOldFormat()},
+		{newFile, cliOpts.GetNewFormat()},
+	} {
+		if f.path == "-" || cli.IsURL(f.path) {
+			return false
+		}
+		if _, _, ok := cli.SplitGitRevision(f.path); ok {
+			return false
+		}
+		if _, _, ok := cli.SplitArchivePath(f.path); ok {
+			return false
+		}
+		// configdiff.DiffFiles detects the format from the extension
+		if f.format != "" && f.format != "auto" && f.format != string(parse.FormatJSON) || parse.DetectFileFormat(f.path, nil) != parse.FormatJSON {
+			return false
+		}
+		info, err := os.Stat(f.path)
+		if err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+		size = max(size, info.Size())
+	}
+	return size > configdiff.IncrementalThreshold
+}
+
+// diffFilesIncremental diffs two large JSON files with configdiff.DiffFiles,
+// which reads them a top-level member at a time instead of whole, and masks
+// secrets in the result. It keeps no documents, so report output shows the
+// changes without the lines around them. Parsing and diffing are not told
+// apart, and are timed together as diffing.
+func (o *options) diffFilesIncremental(cliOpts cli.CLIOptions, oldFile, newFile string) (*fileDiff, error) {
+	diffOpts, err := cliOpts.ToLibraryOptions()
+	if err != nil {
+		return nil, err
+	}
+	diffOpts.Logger = o.logger()
+
+	start := time.Now()
+	result, err := configdiff.DiffFiles(oldFile, newFile, diffOpts)
+	if err != nil {
+		return nil, err
+	}
+	if maskOpts := cliOpts.MaskOptions(); len(maskOpts.MaskPaths) > 0 || maskOpts.MaskSecrets {
+		if result, err = cli.MaskResult(result, maskOpts); err != nil {
+			return nil, err
+		}
+	}
+	return &fileDiff{opts: cliOpts, result: result, diffTime: time.Since(start)}, nil
+}
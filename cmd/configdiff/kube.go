@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/report"
+)
+
+// errNotManifest reports a local file that does not describe a Kubernetes object.
+var errNotManifest = errors.New("not a Kubernetes manifest: apiVersion, kind, and metadata.name are required")
+
+// kubeClusterDir labels the live side of a directory comparison.
+const kubeClusterDir = "cluster"
+
+// compareKube compares live Kubernetes objects, fetched with kubectl from
+// the current context, with the local manifest or directory of manifests
+// at localPath.
+// Returns true if changes selected by --fail-on were found, false otherwise.
+func (o *options) compareKube(localPath string) (bool, error) {
+	dir, err := isDir(localPath)
+	if err != nil {
+		return false, err
+	}
+
+	if dir {
+		if !o.recursive {
+			return false, fmt.Errorf("comparing a directory of manifests requires --recursive flag")
+		}
+		if o.kubeObject != "" {
+			return false, fmt.Errorf("--kube compares a single manifest; use --kube-match to compare a directory")
+		}
+		return o.compareKubeDirectory(localPath)
+	}
+
+	liveLabel, fd, err := o.diffKube(localPath)
+	if err != nil {
+		return false, err
+	}
+	return o.reportFileDiff(liveLabel, localPath, fd)
+}
+
+// diffKube diffs the live object for a local manifest, given by --kube or
+// matched by the manifest's kind and name, against the manifest.
+// Returns the label of the live object and the diff.
+func (o *options) diffKube(localPath string) (string, *fileDiff, error) {
+	cliOpts, err := o.cliOptions(kubeClusterDir, localPath)
+	if err != nil {
+		return "", nil, err
+	}
+	local, err := o.readTree(localPath, cliOpts.GetNewFormat())
+	if err != nil {
+		return "", nil, err
+	}
+
+	var ref cli.KubeRef
+	if o.kubeObject != "" {
+		if ref, err = cli.ParseKubeRef(o.kubeObject, o.kubeNamespace); err != nil {
+			return "", nil, err
+		}
+	} else {
+		var ok bool
+		if ref, ok = cli.KubeRefFor(local, o.kubeNamespace); !ok {
+			return "", nil, fmt.Errorf("%s: %w", localPath, errNotManifest)
+		}
+	}
+
+	input, err := cli.ReadKubeObject(ref)
+	if err != nil {
+		return "", nil, err
+	}
+	live, err := parse.Parse(input.Data, parse.FormatYAML)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse live object %s: %w", ref, err)
+	}
+	cliOpts.OldFile = input.Path
+
+	fd, err := o.diffTrees(cliOpts, cli.NormalizeKubeObject(live, local), local)
+	if err != nil {
+		return "", nil, err
+	}
+	return input.Path, fd, nil
+}
+
+// compareKubeDirectory compares every manifest in a directory with its live
+// object. Manifests without a live object are reported as added; files that
+// are not manifests are skipped.
+// Returns true if any changes selected by --fail-on were found, false otherwise.
+func (o *options) compareKubeDirectory(localDir string) (bool, error) {
+	files, tooLarge, err := o.listConfigFiles(localDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to scan directory: %w", err)
+	}
+	relPaths := make([]string, 0, len(files)+len(tooLarge))
+	for relPath := range files {
+		relPaths = append(relPaths, relPath)
+	}
+	for relPath := range tooLarge {
+		relPaths = append(relPaths, relPath)
+	}
+	sortSlashed(relPaths)
+
+	dir := report.DirResult{OldDir: kubeClusterDir, NewDir: localDir, MaxDepth: o.maxWalkDepth}
+	diffs := make(map[string]*fileDiff)
+	failed := 0
+
+	for _, relPath := range relPaths {
+		file := report.FileResult{Path: filepath.ToSlash(relPath)}
+		if tooLarge[relPath] {
+			file.Status, file.Error = report.FileSkipped, o.tooLargeReason()
+			dir.Files = append(dir.Files, file)
+			continue
+		}
+
+		_, fd, err := o.diffKube(joinPath(localDir, relPath))
+		switch {
+		case errors.Is(err, errNotManifest):
+			continue
+		case errors.Is(err, cli.ErrKubeNotFound):
+			file.Status = report.FileAdded
+		case err != nil:
+			fmt.Fprintf(o.errorOutput(), "Error: %s: %v\n", file.Path, err)
+			failed++
+			file.Status, file.Error = report.FileError, err.Error()
+		default:
+			file.Status = report.FileUnchanged
+			if fd.result.HasChanges() {
+				file.Status = report.FileModified
+			}
+			file.Changes = fd.result.Changes
+			diffs[file.Path] = fd
+		}
+		dir.Files = append(dir.Files, file)
+	}
+
+	if err := o.renderDirectory(dir, diffs); err != nil {
+		return false, err
+	}
+	return cli.DirFailsOn(dir, o.failOn), compareFailures(failed)
+}
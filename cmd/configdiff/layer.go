@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+)
+
+// layerFlags holds the flags of the layer command.
+type layerFlags struct {
+	// Layer flags
+	layerOutput    string
+	layerTo        string
+	layerFormat    string
+	layerArrays    string
+	layerArrayKeys []string
+	layerNulls     bool
+	layerStrict    bool
+	layerFile      string
+}
+
+// newLayerCmd returns the layer command.
+func newLayerCmd(o *options) *cobra.Command {
+	layerCmd := &cobra.Command{
+		Use:   "layer [flags] <base> <override>...",
+		Short: "Merge configuration files, each overriding the ones before it",
+		Long: `Layer configuration files: start from the first and merge each following file
+on top of the result, as Helm does with values files.
+
+Objects are merged key by key and other values are replaced. Arrays are
+replaced by default; --arrays concat appends them, and --arrays merge-by-key
+merges the arrays named with --array-key element by element, matching
+elements by their key field as comparisons do. A null value sets the key to
+null, or removes it with --nulls-delete.
+
+A value replaced by one of a different kind, such as an object by a string,
+is reported as a warning, or as an error with --strict-merge.
+
+The result is written in the format of the first file unless --to says
+otherwise. --layers-file reads layers from a file, one path per line, with
+blank lines and # comments skipped; they come before any given as arguments.`,
+		Example: `  # Layer environment overrides onto a base
+  configdiff layer base.yaml prod.yaml prod-eu.yaml -o merged.yaml
+
+  # Merge containers by name
+  configdiff layer base.yaml override.yaml --arrays merge-by-key --array-key /spec/containers=name
+
+  # Read the layers from a file and write JSON
+  configdiff layer --layers-file layers.txt --to json`,
+		Args: cobra.ArbitraryArgs,
+		RunE: o.runLayer,
+	}
+
+	layerCmd.Flags().StringVarP(&o.layerOutput, "output", "o", "", "Write the merged document to this file instead of stdout")
+	layerCmd.Flags().StringVar(&o.layerTo, "to", "", "Output format (yaml, json, toml); defaults to the first file's format")
+	layerCmd.Flags().StringVarP(&o.layerFormat, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
+	layerCmd.Flags().StringVar(&o.layerArrays, "arrays", string(tree.ArraysReplace), "How to combine arrays (replace, concat, merge-by-key)")
+	layerCmd.Flags().StringSliceVar(&o.layerArrayKeys, "array-key", nil, "Array paths to key fields for --arrays merge-by-key (format: path=key)")
+	layerCmd.Flags().BoolVar(&o.layerNulls, "nulls-delete", false, "Remove keys set to null instead of setting them to null")
+	layerCmd.Flags().BoolVar(&o.layerStrict, "strict-merge", false, "Fail when a value is replaced by one of a different kind")
+	layerCmd.Flags().StringVar(&o.layerFile, "layers-file", "", "Read layers from this file, one path per line")
+	layerCmd.Flags().BoolVar(&o.noDiscover, "no-discover", false, "Only look for the config file in the current and home directories, not in the directory of the layers and its parents")
+	layerCmd.Flags().BoolVar(&o.noMergeConfig, "no-merge-config", false, "Only use the nearest config file found, instead of merging it over the ones further away")
+	layerCmd.Flags().BoolVar(&o.lenientConfig, "lenient-config", false, "Ignore unknown keys and invalid values in the config file instead of failing")
+	_ = layerCmd.RegisterFlagCompletionFunc("to", cobra.FixedCompletions(
+		[]string{string(parse.FormatYAML), string(parse.FormatJSON), string(parse.FormatTOML)}, cobra.ShellCompDirectiveNoFileComp))
+	_ = layerCmd.RegisterFlagCompletionFunc("arrays", cobra.FixedCompletions(
+		[]string{string(tree.ArraysReplace), string(tree.ArraysConcat), string(tree.ArraysMergeByKey)}, cobra.ShellCompDirectiveNoFileComp))
+
+	return layerCmd
+}
+
+// runLayer is the entry point for the layer command.
+func (o *options) runLayer(cmd *cobra.Command, args []string) error {
+	o.discoverConfig(args)
+	if err := o.loadConfig(); err != nil {
+		return err
+	}
+	return o.layer(args)
+}
+
+// layer merges the layers in --layers-file and files in order and writes the
+// result.
+func (o *options) layer(files []string) error {
+	opts := tree.MergeOptions{Arrays: tree.ArrayStrategy(o.layerArrays), DeleteNulls: o.layerNulls}
+	switch opts.Arrays {
+	case tree.ArraysReplace, tree.ArraysConcat, tree.ArraysMergeByKey:
+	default:
+		return fmt.Errorf("invalid --arrays %q, must be one of: replace, concat, merge-by-key", o.layerArrays)
+	}
+
+	cliOpts := cli.CLIOptions{ArrayKeys: o.layerArrayKeys}
+	if o.cfg != nil {
+		cliOpts.ApplyConfigDefaults(o.cfg)
+	}
+	diffOpts, err := cliOpts.ToLibraryOptions()
+	if err != nil {
+		return err
+	}
+	opts.ArrayKeys = diffOpts.ArraySetKeys
+
+	if o.layerFile != "" {
+		listed, err := readLayers(o.layerFile)
+		if err != nil {
+			return err
+		}
+		files = append(listed, files...)
+	}
+	if len(files) < 2 {
+		return fmt.Errorf("layer requires at least two files, got %d", len(files))
+	}
+
+	var result *tree.Node
+	var to parse.Format
+	for i, file := range files {
+		input, err := cli.ReadInput(file, o.layerFormat)
+		if err != nil {
+			return err
+		}
+		node, err := parse.Parse(input.Data, parse.Format(input.Format))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if i == 0 {
+			result, to = node, parse.Format(input.Format)
+			continue
+		}
+
+		var conflicts []tree.MergeConflict
+		result, conflicts = tree.Merge(result, node, opts)
+		for _, c := range conflicts {
+			msg := fmt.Sprintf("%s: %s at %s replaces %s", file, c.Override, c.Path, c.Base)
+			if o.layerStrict {
+				return fmt.Errorf("%s (--strict-merge)", msg)
+			}
+			fmt.Fprintf(o.messages(), "Warning: %s\n", msg)
+		}
+	}
+
+	if o.layerTo != "" {
+		to = parse.Format(o.layerTo)
+	}
+	out, err := parse.Marshal(result, to)
+	if err != nil {
+		return fmt.Errorf("failed to write merged document as %s: %w", to, err)
+	}
+	if o.layerOutput != "" {
+		if err := os.WriteFile(o.layerOutput, out, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", o.layerOutput, err)
+		}
+		return nil
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// readLayers reads a --layers-file of paths, one per line. Blank lines and
+// lines starting with # are skipped.
+func readLayers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layers file: %w", err)
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		files = append(files, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read layers file: %w", err)
+	}
+	return files, nil
+}
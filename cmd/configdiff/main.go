@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+
+	"github.com/pfrederiksen/configdiff"
 )
 
 var (
@@ -13,9 +16,63 @@ var (
 	builtBy = "unknown"
 )
 
+// Exit codes, following diff(1)
+const (
+	exitDifferences = 1 // --exit-code found differences
+	exitTrouble     = 2 // bad flags, unreadable input, parse errors, failed diffs
+)
+
+// errDifferences is returned for --exit-code when differences were found.
+// It is not an error to report, only an exit code.
+var errDifferences = errors.New("differences found")
+
+// exitError is an error that sets the process exit code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	err := newRootCmd(&options{}).Execute()
+	if err != nil && !errors.Is(err, errDifferences) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errorMessage(err))
+	}
+	os.Exit(exitStatus(err))
+}
+
+// errorMessage returns the message for an error: for a parse error with a
+// known position, the parse error alone, starting with file:line:col so
+// that editors and terminals can jump to it.
+func errorMessage(err error) error {
+	var parseErr *configdiff.ParseError
+	if errors.As(err, &parseErr) && parseErr.File != "" && parseErr.Line > 0 {
+		return parseErr
+	}
+	return err
+}
+
+// exitStatus maps the outcome of a command to the process exit code. Every
+// error category is trouble: a *configdiff.ReadError or *configdiff.ParseError
+// for an input, configdiff.ErrUnsupportedFormat, and a *configdiff.DiffError
+// for a comparison that failed.
+func exitStatus(err error) int {
+	var exitErr *exitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errDifferences):
+		return exitDifferences
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	default:
+		return exitTrouble
 	}
 }
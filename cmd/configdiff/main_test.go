@@ -1,13 +1,38 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/internal/config"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
+var updateGolden = flag.Bool("update", false, "update golden files")
+
 func TestCLI(t *testing.T) {
+	o := testOptions(t)
 	// Create temporary test files
 	tmpDir := t.TempDir()
 
@@ -59,10 +84,10 @@ func TestCLI(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Set quiet mode to avoid output during tests
-			quiet = true
-			exitCode = false
+			o.quiet = quietAll
+			o.exitCode = false
 
-			err := compare(tt.oldFile, tt.newFile)
+			_, err := o.compare(tt.oldFile, tt.newFile)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("compare() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -87,6 +112,7 @@ func TestVersionInfo(t *testing.T) {
 }
 
 func TestCollectConfigFiles(t *testing.T) {
+	o := testOptions(t)
 	tmpDir := t.TempDir()
 
 	// Create test files
@@ -98,8 +124,8 @@ func TestCollectConfigFiles(t *testing.T) {
 		"vars.hcl",
 		"Cargo.toml",
 		"subdir/nested.yaml",
-		"README.md",     // Should not be collected
-		"script.sh",     // Should not be collected
+		"README.md", // Should not be collected
+		"script.sh", // Should not be collected
 	}
 
 	for _, f := range testFiles {
@@ -113,7 +139,7 @@ func TestCollectConfigFiles(t *testing.T) {
 		}
 	}
 
-	files, err := collectConfigFiles(tmpDir)
+	files, _, err := o.collectConfigFiles(tmpDir)
 	if err != nil {
 		t.Fatalf("collectConfigFiles() error = %v", err)
 	}
@@ -147,6 +173,131 @@ func TestCollectConfigFiles(t *testing.T) {
 	}
 }
 
+func TestCollectConfigFiles_Excludes(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	for _, f := range []string{
+		"app.yaml",
+		"app.bak.yaml",
+		".golangci.yml",
+		".git/config.yaml",
+		".github/workflows/ci.yml",
+		".terraform/modules/modules.json",
+		"node_modules/pkg/package.json",
+		"vendor/chart/values.yaml",
+		"charts/sub/values.yaml",
+		"generated/out.yaml",
+		"env/generated/out.yaml",
+	} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("a: 1\n"), 0644); err != nil {
+			t.Fatalf("Failed to create test file %s: %v", f, err)
+		}
+	}
+
+	o.cfg = &config.Config{ExcludePaths: []string{"*.bak.yaml"}}
+
+	tests := []struct {
+		name      string
+		exclude   []string
+		noDefault bool
+		want      []string
+	}{
+		{
+			name: "default excludes",
+			want: []string{".golangci.yml", "app.yaml", "charts/sub/values.yaml", "env/generated/out.yaml", "generated/out.yaml"},
+		},
+		{
+			name:    "name at any depth",
+			exclude: []string{"generated"},
+			want:    []string{".golangci.yml", "app.yaml", "charts/sub/values.yaml"},
+		},
+		{
+			name:    "relative path",
+			exclude: []string{"charts/**", "/generated"},
+			want:    []string{".golangci.yml", "app.yaml", "env/generated/out.yaml"},
+		},
+		{
+			name:      "no default excludes",
+			noDefault: true,
+			want: []string{".git/config.yaml", ".github/workflows/ci.yml", ".golangci.yml", ".terraform/modules/modules.json",
+				"app.yaml", "charts/sub/values.yaml", "env/generated/out.yaml", "generated/out.yaml",
+				"node_modules/pkg/package.json", "vendor/chart/values.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.excludePaths, o.noDefaultExclude = tt.exclude, tt.noDefault
+			files, _, err := o.listConfigFiles(tmpDir)
+			if err != nil {
+				t.Fatalf("listConfigFiles() error = %v", err)
+			}
+			var got []string
+			for f := range files {
+				got = append(got, filepath.ToSlash(f))
+			}
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("listConfigFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectConfigFilesSymlinks(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "overlay")
+	for _, d := range []string{filepath.Join(dir, "sub"), filepath.Join(tmpDir, "shared")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", d, err)
+		}
+	}
+	for _, f := range []string{"overlay/app.yaml", "overlay/sub/x.yaml", "shared/common.yaml"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), []byte("a: 1\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", f, err)
+		}
+	}
+	links := map[string]string{
+		"linked.yaml": "app.yaml",     // file link
+		"broken.yaml": "missing.yaml", // broken link
+		"shared":      "../shared",    // directory link
+		"sub/up":      "..",           // cycle back to the compared directory
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		follow bool
+		want   []string
+	}{
+		{false, []string{"app.yaml", "linked.yaml", "sub/x.yaml"}},
+		{true, []string{"app.yaml", "linked.yaml", "shared/common.yaml", "sub/x.yaml"}},
+	}
+	for _, tt := range tests {
+		o.followSymlinks = tt.follow
+		files, _, err := o.collectConfigFiles(dir)
+		if err != nil {
+			t.Fatalf("collectConfigFiles(follow=%v) error = %v", tt.follow, err)
+		}
+		var got []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(dir, f)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("collectConfigFiles(follow=%v) = %v, want %v", tt.follow, got, tt.want)
+		}
+	}
+}
+
 func TestFileExists(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -188,6 +339,7 @@ func TestFileExists(t *testing.T) {
 }
 
 func TestCompareDirectories(t *testing.T) {
+	o := testOptions(t)
 	tmpDir := t.TempDir()
 
 	oldDir := filepath.Join(tmpDir, "old")
@@ -224,16 +376,16 @@ func TestCompareDirectories(t *testing.T) {
 	}
 
 	// Test the comparison
-	quiet = true // Suppress output during test
-	exitCode = false
+	o.quiet = quietAll // Suppress output during test
 
-	_, err := compareDirectories(oldDir, newDir)
+	_, err := o.compareDirectories(oldDir, newDir)
 	if err != nil {
 		t.Errorf("compareDirectories() error = %v", err)
 	}
 }
 
 func TestCompareWithDirectories(t *testing.T) {
+	o := testOptions(t)
 	tmpDir := t.TempDir()
 
 	dir := filepath.Join(tmpDir, "dir")
@@ -278,11 +430,11 @@ func TestCompareWithDirectories(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			recursive = false
-			quiet = true
-			exitCode = false
+			o.recursive = false
+			o.quiet = quietAll
+			o.exitCode = false
 
-			err := compare(tt.oldPath, tt.newPath)
+			_, err := o.compare(tt.oldPath, tt.newPath)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("compare() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -326,6 +478,7 @@ func splitLines(s string) []string {
 }
 
 func TestCompareFilesReturnValue(t *testing.T) {
+	o := testOptions(t)
 	tmpDir := t.TempDir()
 
 	// Create files with no changes
@@ -373,10 +526,10 @@ func TestCompareFilesReturnValue(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			quiet = true
-			exitCode = false
+			o.quiet = quietAll
+			o.exitCode = false
 
-			hasChanges, err := compareFiles(tt.oldFile, tt.newFile)
+			hasChanges, err := o.compareFiles(tt.oldFile, tt.newFile)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("compareFiles() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -388,6 +541,7 @@ func TestCompareFilesReturnValue(t *testing.T) {
 }
 
 func TestDirectoryComparisonDoesNotExitEarly(t *testing.T) {
+	o := testOptions(t)
 	tmpDir := t.TempDir()
 
 	oldDir := filepath.Join(tmpDir, "old")
@@ -416,10 +570,10 @@ func TestDirectoryComparisonDoesNotExitEarly(t *testing.T) {
 
 	// Run with quiet mode and exit-code flag
 	// The function should compare all files and return normally (not call os.Exit)
-	quiet = true
-	exitCode = true // This used to cause early exit, now it should work correctly
+	o.quiet = quietAll
+	o.exitCode = true // This used to cause early exit, now it should work correctly
 
-	hasChanges, err := compareDirectories(oldDir, newDir)
+	hasChanges, err := o.compareDirectories(oldDir, newDir)
 	if err != nil {
 		t.Errorf("compareDirectories() error = %v", err)
 	}
@@ -433,6 +587,114 @@ func TestDirectoryComparisonDoesNotExitEarly(t *testing.T) {
 	// The os.Exit would happen in the caller (compare function), not in compareDirectories
 }
 
+func TestDirectoryComparisonRendersOnce(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldDir := filepath.Join(tmpDir, "old")
+	newDir := filepath.Join(tmpDir, "new")
+	for _, dir := range []string{oldDir, newDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for i, f := range []string{"a.yaml", "b.yaml"} {
+		if err := os.WriteFile(filepath.Join(oldDir, f), []byte(fmt.Sprintf("value: %d", i)), 0644); err != nil {
+			t.Fatalf("Failed to write old file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(newDir, f), []byte(fmt.Sprintf("value: %d", i+10)), 0644); err != nil {
+			t.Fatalf("Failed to write new file: %v", err)
+		}
+	}
+
+	outputFile := filepath.Join(tmpDir, "github_output.txt")
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+	o.quiet = quietAll
+	o.outputFormat = "json"
+
+	if _, err := o.compareDirectories(oldDir, newDir); err != nil {
+		t.Fatalf("compareDirectories() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read GitHub output: %v", err)
+	}
+	// Both files belong to a single JSON document
+	if n := strings.Count(string(content), `"schemaVersion"`); n != 1 {
+		t.Errorf("GitHub output has %d JSON documents, want 1:\n%s", n, content)
+	}
+	for _, want := range []string{`"path": "a.yaml"`, `"path": "b.yaml"`, "has-changes=true"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("GitHub output missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestDirectoryJSONReportsErrors(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldDir := filepath.Join(tmpDir, "old")
+	newDir := filepath.Join(tmpDir, "new")
+	files := map[string]string{
+		"old/a.yaml":      "value: 1\n",
+		"new/a.yaml":      "value: 2\n",
+		"old/broken.yaml": "value: 1\n",
+		"new/broken.yaml": "value: [\n",
+		"old/gone.yaml":   "removed: true\n",
+		"new/extra.yaml":  "added: true\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	outputFile := filepath.Join(tmpDir, "github_output.txt")
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+	o.quiet, o.outputFormat, o.exitCode, o.noRenameDetect = 0, "json", false, true
+
+	out, err := captureStdout(t, func() error {
+		_, err := o.compareDirectories(oldDir, newDir)
+		return err
+	})
+	if err == nil || err.Error() != "1 file could not be compared" {
+		t.Fatalf("compareDirectories() error = %v, want 1 file could not be compared", err)
+	}
+
+	var doc report.JSONDirOutput
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+	}
+	statuses := map[string]string{}
+	for _, f := range doc.Files {
+		statuses[f.Path] = f.Status
+		if f.Status == "error" && !strings.Contains(f.Error, "failed to parse") {
+			t.Errorf("%s error = %q, want the parse error", f.Path, f.Error)
+		}
+	}
+	want := map[string]string{"a.yaml": "modified", "broken.yaml": "error", "gone.yaml": "removed", "extra.yaml": "added"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("file statuses = %v, want %v", statuses, want)
+	}
+	if s := doc.Summary; s.Compared != 1 || s.Changed != 1 || s.Added != 1 || s.Removed != 1 || s.Errors != 1 {
+		t.Errorf("summary = %+v, want 1 compared and changed, 1 added, 1 removed, 1 error", s)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read GitHub output: %v", err)
+	}
+	for _, want := range []string{"files-added=1\n", "files-removed=1\n", "files-modified=1\n", "files-renamed=0\n", "files-failed=1\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("GitHub output missing %q:\n%s", want, content)
+		}
+	}
+}
+
 func TestWriteGitHubOutputs(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputFile := filepath.Join(tmpDir, "github_output.txt")
@@ -474,7 +736,7 @@ func TestWriteGitHubOutputs(t *testing.T) {
 			// Remove output file between tests
 			os.Remove(outputFile)
 
-			err := writeGitHubOutputs(outputFile, tt.hasChanges, tt.diffOutput)
+			err := writeGitHubOutputs(outputFile, tt.hasChanges, tt.diffOutput, 0)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("writeGitHubOutputs() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -550,7 +812,7 @@ func TestWriteGitHubOutputsAppend(t *testing.T) {
 	}
 
 	// Append GitHub outputs
-	err := writeGitHubOutputs(outputFile, true, "diff content")
+	err := writeGitHubOutputs(outputFile, true, "diff content", 0)
 	if err != nil {
 		t.Fatalf("writeGitHubOutputs() error = %v", err)
 	}
@@ -573,3 +835,3607 @@ func TestWriteGitHubOutputsAppend(t *testing.T) {
 		t.Error("New content was not appended")
 	}
 }
+
+func TestWriteGitHubCounts(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "github_output.txt")
+	if err := os.WriteFile(outputFile, []byte("existing-output=test\n"), 0644); err != nil {
+		t.Fatalf("Failed to write initial content: %v", err)
+	}
+
+	err := writeGitHubCounts(outputFile, report.Summary{Total: 6, Added: 1, Removed: 2, Modified: 3}, 1)
+	if err != nil {
+		t.Fatalf("writeGitHubCounts() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	want := "existing-output=test\nadded-count=1\nremoved-count=2\nmodified-count=3\nfiles-changed=1\n"
+	if string(content) != want {
+		t.Errorf("GitHub output = %q, want %q", content, want)
+	}
+}
+
+func TestWriteGitHubStepSummary(t *testing.T) {
+	tmpDir := t.TempDir()
+	summaryFile := filepath.Join(tmpDir, "step_summary.md")
+
+	// Summaries are appended after those of earlier steps
+	if err := writeGitHubStepSummary(summaryFile, "#### first"); err != nil {
+		t.Fatalf("writeGitHubStepSummary() error = %v", err)
+	}
+	if err := writeGitHubStepSummary(summaryFile, "#### second\n"); err != nil {
+		t.Fatalf("writeGitHubStepSummary() error = %v", err)
+	}
+	content, err := os.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatalf("Failed to read step summary: %v", err)
+	}
+	if want := "#### first\n#### second\n"; string(content) != want {
+		t.Errorf("step summary = %q, want %q", content, want)
+	}
+
+	// Oversized summaries are cut at a line with a notice
+	os.Remove(summaryFile)
+	row := "| `/key` | modified | `1` | `2` |\n"
+	large := strings.Repeat(row, report.GitHubStepSummaryLimit/len(row)+10)
+	if err := writeGitHubStepSummary(summaryFile, large); err != nil {
+		t.Fatalf("writeGitHubStepSummary() error = %v", err)
+	}
+	content, err = os.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatalf("Failed to read step summary: %v", err)
+	}
+	if len(content) > report.GitHubStepSummaryLimit {
+		t.Errorf("step summary is %d bytes, want at most %d", len(content), report.GitHubStepSummaryLimit)
+	}
+	body, notice, ok := strings.Cut(string(content), "\n\n_Summary truncated")
+	if !ok || !strings.HasSuffix(notice, "_\n") {
+		t.Fatalf("step summary does not end with a truncation notice: %q", notice)
+	}
+	if strings.Count(body, row) != strings.Count(body, "\n") {
+		t.Error("step summary was not cut at a line boundary")
+	}
+}
+
+func TestTruncateGitHubOutput(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	report := "Summary: ~3 modified (3 total)\n\nChanges:\n  ~ /a: 1 → 2\n\n  ~ /b: |\n      line 1\n      line 2\n\n  ~ /c: 5 → " + long + "\n"
+	note := func(omitted int) string { return truncatedNote(omitted) }
+	room := len(note(strings.Count(report, "\n") + 1))
+
+	tests := []struct {
+		name          string
+		output        string
+		limit         int
+		want          string
+		wantTruncated bool
+	}{
+		{
+			name:   "no limit",
+			output: report,
+			want:   report,
+		},
+		{
+			name:   "within limit",
+			output: report,
+			limit:  len(report),
+			want:   report,
+		},
+		{
+			name:          "cut between changes",
+			output:        report,
+			limit:         strings.Index(report, "  ~ /c") + room,
+			want:          report[:strings.Index(report, "  ~ /c")] + note(1),
+			wantTruncated: true,
+		},
+		{
+			name:          "cut inside a multi-line change",
+			output:        report,
+			limit:         strings.Index(report, "      line 2") + room,
+			want:          report[:strings.Index(report, "  ~ /b")] + note(2),
+			wantTruncated: true,
+		},
+		{
+			name:          "cut before the first change",
+			output:        report,
+			limit:         strings.Index(report, "  ~ /a") + room,
+			want:          report[:strings.Index(report, "  ~ /a")] + note(3),
+			wantTruncated: true,
+		},
+		{
+			name:          "markdown table rows",
+			output:        "| Path | Change |\n| --- | --- |\n| `/a` | added |\n| `/b` | " + long + " |\n",
+			limit:         len("| Path | Change |\n| --- | --- |\n| `/a` | added |\n") + len(note(5)),
+			want:          "| Path | Change |\n| --- | --- |\n| `/a` | added |\n" + note(1),
+			wantTruncated: true,
+		},
+		{
+			name:          "no change lines",
+			output:        "line one\nline two\nline " + long + "\n",
+			limit:         len("line one\nline two\n") + len(note(4)),
+			want:          "line one\nline two\n" + note(0),
+			wantTruncated: true,
+		},
+		{
+			name:          "limit smaller than the note",
+			output:        report,
+			limit:         1,
+			want:          note(3),
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateGitHubOutput(tt.output, tt.limit)
+			if got != tt.want {
+				t.Errorf("truncateGitHubOutput() = %q, want %q", got, tt.want)
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncateGitHubOutput() truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if tt.limit > room && len(got) > tt.limit {
+				t.Errorf("truncateGitHubOutput() is %d bytes, want at most %d", len(got), tt.limit)
+			}
+		})
+	}
+}
+
+func TestGitHubOutputTruncated(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.yaml")
+	newFile := filepath.Join(tmpDir, "new.yaml")
+	var oldDoc, newDoc strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&oldDoc, "key%03d: %d\n", i, i)
+		fmt.Fprintf(&newDoc, "key%03d: %d\n", i, i+1)
+	}
+	if err := os.WriteFile(oldFile, []byte(oldDoc.String()), 0644); err != nil {
+		t.Fatalf("Failed to write old file: %v", err)
+	}
+	if err := os.WriteFile(newFile, []byte(newDoc.String()), 0644); err != nil {
+		t.Fatalf("Failed to write new file: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		limit         int
+		artifact      bool
+		wantTruncated bool
+	}{
+		{name: "default limit", limit: defaultGitHubOutputLimit},
+		{name: "over limit", limit: 1024, wantTruncated: true},
+		{name: "over limit with artifact", limit: 1024, artifact: true, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOptions(t)
+			outputFile := filepath.Join(t.TempDir(), "github_output.txt")
+			t.Setenv("GITHUB_OUTPUT", outputFile)
+			o.outputFormat, o.noColor = "compact", true
+			o.githubMaxOutput = tt.limit
+			if tt.artifact {
+				o.githubArtifact = filepath.Join(t.TempDir(), "diff.txt")
+			}
+
+			if _, err := captureStdout(t, func() error {
+				_, err := o.compareFiles(oldFile, newFile)
+				return err
+			}); err != nil {
+				t.Fatalf("compareFiles() error = %v", err)
+			}
+
+			content, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read GitHub output: %v", err)
+			}
+			output := string(content)
+			if want := fmt.Sprintf("diff-output-truncated=%v\n", tt.wantTruncated); !strings.Contains(output, want) {
+				t.Errorf("GitHub output missing %q", want)
+			}
+			_, diffOutput, _ := strings.Cut(output, "diff-output<<")
+			_, diffOutput, _ = strings.Cut(diffOutput, "\n")
+			if tt.wantTruncated {
+				kept := strings.Count(diffOutput, "  ~ /key")
+				if kept == 0 || kept == 200 {
+					t.Errorf("diff-output kept %d of 200 changes", kept)
+				}
+				if want := truncatedNote(200 - kept); !strings.Contains(diffOutput, want) {
+					t.Errorf("diff-output missing %q", want)
+				}
+			} else if n := strings.Count(diffOutput, "  ~ /key"); n != 200 {
+				t.Errorf("diff-output has %d changes, want 200", n)
+			}
+
+			if tt.artifact {
+				artifact, err := os.ReadFile(o.githubArtifact)
+				if err != nil {
+					t.Fatalf("Failed to read artifact: %v", err)
+				}
+				if n := strings.Count(string(artifact), "  ~ /key"); n != 200 {
+					t.Errorf("artifact has %d changes, want 200", n)
+				}
+			}
+		})
+	}
+}
+
+func TestGitHubStepSummaryAndCounts(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.yaml")
+	newFile := filepath.Join(tmpDir, "new.yaml")
+	if err := os.WriteFile(oldFile, []byte("a: 1\nb: 2\nc: 3\n"), 0644); err != nil {
+		t.Fatalf("Failed to write old file: %v", err)
+	}
+	if err := os.WriteFile(newFile, []byte("a: 1\nb: 3\nd: 4\n"), 0644); err != nil {
+		t.Fatalf("Failed to write new file: %v", err)
+	}
+
+	outputFile := filepath.Join(tmpDir, "github_output.txt")
+	summaryFile := filepath.Join(tmpDir, "step_summary.md")
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryFile)
+	o.quiet, o.outputFormat = quietAll, "report"
+
+	if _, err := o.compareFiles(oldFile, newFile); err != nil {
+		t.Fatalf("compareFiles() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read GitHub output: %v", err)
+	}
+	for _, want := range []string{"added-count=1\n", "removed-count=1\n", "modified-count=1\n", "files-changed=1\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("GitHub output missing %q:\n%s", want, content)
+		}
+	}
+
+	summary, err := os.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatalf("Failed to read step summary: %v", err)
+	}
+	for _, want := range []string{"#### " + newFile, "| `/b` | modified | `2` | `3` |"} {
+		if !strings.Contains(string(summary), want) {
+			t.Errorf("step summary missing %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	base := write("base.yaml", "name: app\nreplicas: 2\ncontainers:\n  - name: a\n    image: a1\n  - name: b\n    image: b1\n")
+	ours := write("ours.yaml", "name: app\nreplicas: 3\ncontainers:\n  - name: b\n    image: b1\n  - name: a\n    image: a2\n")
+	theirs := write("theirs.yaml", "name: app2\nreplicas: 2\ncontainers:\n  - name: a\n    image: a1\n  - name: b\n    image: b2\n")
+	conflicting := write("conflicting.yaml", "name: app\nreplicas: 4\ncontainers:\n  - name: a\n    image: a1\n")
+	merged := filepath.Join(tmpDir, "merged.yaml")
+
+	o.mergeOutput = merged
+	o.mergeArrayKeys = []string{"/containers=name"}
+
+	tests := []struct {
+		name          string
+		theirs        string
+		prefer        string
+		markers       bool
+		wantConflicts int
+		wantOutput    []string
+	}{
+		{
+			name:       "clean merge with reordered keyed array",
+			theirs:     theirs,
+			wantOutput: []string{"name: app2", "replicas: 3", "image: b2", "image: a2"},
+		},
+		{
+			name:          "conflicts write nothing",
+			theirs:        conflicting,
+			wantConflicts: 1,
+		},
+		{
+			name:       "prefer theirs resolves conflicts",
+			theirs:     conflicting,
+			prefer:     "theirs",
+			wantOutput: []string{"replicas: 4"},
+		},
+		{
+			name:          "markers keep conflicts",
+			theirs:        conflicting,
+			markers:       true,
+			wantConflicts: 1,
+			wantOutput:    []string{"<<<<<<< " + ours, "replicas: 3", "=======", "replicas: 4", ">>>>>>> " + conflicting},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(merged)
+			o.mergePrefer, o.mergeMarkers = tt.prefer, tt.markers
+
+			conflicts, err := o.merge(base, ours, tt.theirs)
+			if err != nil {
+				t.Fatalf("merge() error = %v", err)
+			}
+			if conflicts != tt.wantConflicts {
+				t.Errorf("merge() conflicts = %d, want %d", conflicts, tt.wantConflicts)
+			}
+
+			content, err := os.ReadFile(merged)
+			if len(tt.wantOutput) == 0 {
+				if err == nil {
+					t.Errorf("merge() wrote output despite conflicts:\n%s", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to read merged output: %v", err)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("merged output missing %q:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeExitCodes(t *testing.T) {
+	mergeCmd, o := testCommand(t, "merge")
+	tmpDir := t.TempDir()
+	base := filepath.Join(tmpDir, "base.yaml")
+	if err := os.WriteFile(base, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write base: %v", err)
+	}
+
+	o.mergeOutput, o.mergePrefer, o.mergeMarkers = filepath.Join(tmpDir, "merged.yaml"), "", false
+
+	if err := o.runMerge(mergeCmd, []string{base, base, base}); err != nil {
+		t.Errorf("runMerge() of identical files error = %v", err)
+	}
+
+	err := o.runMerge(mergeCmd, []string{base, base, filepath.Join(tmpDir, "missing.yaml")})
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != mergeExitError {
+		t.Errorf("runMerge() of a missing file error = %v, want exit code %d", err, mergeExitError)
+	}
+}
+
+func TestApply(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	jsonPatch := write("patch.json", `{"operations":[{"op":"replace","path":"/spec/replicas","value":3},{"op":"add","path":"/spec/image","value":"web:2"}]}`)
+	yamlPatch := write("patch.yaml", "operations:\n  - op: remove\n    path: /spec/missing\n")
+
+	reset := func() {
+		o.applyOutput, o.applyDryRun, o.applyInPlace, o.applyAllow, o.applyDeny = "", false, false, nil, nil
+	}
+
+	t.Run("in place keeps format and permissions", func(t *testing.T) {
+		reset()
+		target := write("deploy.yaml", "spec:\n  replicas: 1\n")
+		o.applyInPlace = true
+		if err := o.apply(target, jsonPatch); err != nil {
+			t.Fatalf("apply() error = %v", err)
+		}
+		content, _ := os.ReadFile(target)
+		if want := "spec:\n  image: web:2\n  replicas: 3\n"; string(content) != want {
+			t.Errorf("target = %q, want %q", content, want)
+		}
+		info, _ := os.Stat(target)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("target mode = %v, want 0600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("output file", func(t *testing.T) {
+		reset()
+		target := write("deploy.json", `{"spec": {"replicas": 1}}`)
+		o.applyOutput = filepath.Join(tmpDir, "out.json")
+		if err := o.apply(target, jsonPatch); err != nil {
+			t.Fatalf("apply() error = %v", err)
+		}
+		content, _ := os.ReadFile(o.applyOutput)
+		if !strings.Contains(string(content), `"replicas": 3`) {
+			t.Errorf("output = %s, want JSON with replicas 3", content)
+		}
+	})
+
+	t.Run("dry run reports conflicts", func(t *testing.T) {
+		reset()
+		target := write("dry.yaml", "spec:\n  replicas: 1\n")
+		o.applyDryRun = true
+		if err := o.apply(target, yamlPatch); err == nil || !strings.Contains(err.Error(), "1 conflict") {
+			t.Errorf("apply() error = %v, want 1 conflict", err)
+		}
+		if err := o.apply(target, jsonPatch); err != nil {
+			t.Errorf("apply() error = %v", err)
+		}
+		content, _ := os.ReadFile(target)
+		if string(content) != "spec:\n  replicas: 1\n" {
+			t.Errorf("dry run modified the target: %q", content)
+		}
+	})
+
+	t.Run("path policy", func(t *testing.T) {
+		reset()
+		target := write("policy.yaml", "spec:\n  replicas: 1\n")
+		o.applyInPlace = true
+		o.applyDeny = []string{"/spec/replicas"}
+		if err := o.apply(target, jsonPatch); err == nil || !strings.Contains(err.Error(), "path policy") {
+			t.Errorf("apply() error = %v, want path policy rejection", err)
+		}
+		o.applyDeny, o.applyAllow = nil, []string{"/spec/**"}
+		if err := o.apply(target, jsonPatch); err != nil {
+			t.Errorf("apply() error = %v", err)
+		}
+	})
+}
+
+// testOptions returns options with every flag at its default, as for a
+// command run without flags.
+func testOptions(tb testing.TB) *options {
+	tb.Helper()
+	_, o := testCommand(tb)
+	return o
+}
+
+// testCommand returns the subcommand at path, or the root command for none,
+// of a new command tree, and the options its flags are bound to.
+func testCommand(tb testing.TB, path ...string) (*cobra.Command, *options) {
+	tb.Helper()
+	o := &options{}
+	cmd, _, err := newRootCmd(o).Find(path)
+	if err != nil {
+		tb.Fatalf("no command %v: %v", path, err)
+	}
+	return cmd, o
+}
+
+// captureStdout returns what fn writes to stdout.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	fnErr := fn()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out), fnErr
+}
+
+// captureOutput runs fn with stdout and stderr redirected, returning what
+// was written to each.
+func captureOutput(t *testing.T, fn func() error) (string, string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	out, fnErr := captureStdout(t, fn)
+	os.Stderr = stderr
+	w.Close()
+	errOut, _ := io.ReadAll(r)
+	return out, string(errOut), fnErr
+}
+
+func TestGitRevisionFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--git-old", "--output=x", "values.yaml"},
+		{"--git-new", "-p", "values.yaml"},
+	} {
+		cmd, _ := testCommand(t)
+		cmd.SetArgs(args)
+		_, _, err := captureOutput(t, cmd.Execute)
+		if err == nil || !strings.Contains(err.Error(), "invalid git revision") {
+			t.Errorf("Execute(%v) error = %v, want an invalid git revision", args, err)
+		}
+	}
+}
+
+func TestGitDriver(t *testing.T) {
+	gitDriverCmd, o := testCommand(t, "git-driver")
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "XXab12_values.yaml")
+	newFile := filepath.Join(tmpDir, "values.yaml")
+	if err := os.WriteFile(oldFile, []byte("replicas: 1\nimage: web:1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write old file: %v", err)
+	}
+	if err := os.WriteFile(newFile, []byte("replicas: 2\nimage: web:1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write new file: %v", err)
+	}
+
+	o.outputFormat, o.noColor = "report", true
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "modified file",
+			args:    []string{"deploy/values.yaml", oldFile, "1111111", "100644", newFile, "2222222", "100644"},
+			want:    []string{"diff --configdiff a/deploy/values.yaml b/deploy/values.yaml", "a/deploy/values.yaml → b/deploy/values.yaml", "/replicas: 1 → 2"},
+			notWant: []string{"XXab12", "mode"},
+		},
+		{
+			name: "added file",
+			args: []string{"values.yaml", devNull, "0000000", "0000000", newFile, "2222222", "100644"},
+			want: []string{"new file mode 100644", "/dev/null → b/values.yaml", "+ /image", "+ /replicas"},
+		},
+		{
+			name: "deleted file",
+			args: []string{"values.yaml", oldFile, "1111111", "100644", devNull, "0000000", "0000000"},
+			want: []string{"deleted file mode 100644", "a/values.yaml → /dev/null", "- /image", "- /replicas"},
+		},
+		{
+			name: "mode change",
+			args: []string{"values.yaml", oldFile, "1111111", "100644", newFile, "2222222", "100755"},
+			want: []string{"old mode 100644\nnew mode 100755"},
+		},
+		{
+			name: "rename",
+			args: []string{"old.yaml", oldFile, "1111111", "100644", newFile, "2222222", "100644", "new.yaml", "similarity index 90%\n"},
+			want: []string{"diff --configdiff a/old.yaml b/new.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := gitDriverCmd.Args(gitDriverCmd, tt.args); err != nil {
+				t.Fatalf("Args() error = %v", err)
+			}
+			out, err := captureStdout(t, func() error { return o.gitDriver(tt.args) })
+			if err != nil {
+				t.Fatalf("gitDriver() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output missing %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("output contains %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+
+	if err := gitDriverCmd.Args(gitDriverCmd, []string{"a", "b"}); err == nil {
+		t.Error("Args() with 2 arguments should fail")
+	}
+}
+
+// fakeKubectl puts a kubectl on PATH that prints the live Deployment "web"
+// and reports every other object as not found.
+func fakeKubectl(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl is a shell script")
+	}
+	binDir := t.TempDir()
+	script := `#!/bin/sh
+case "$2" in
+deploy/web|deployment.v1.apps/web)
+	printf 'apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  uid: abc\nspec:\n  replicas: 2\n  revisionHistoryLimit: 10\nstatus:\n  readyReplicas: 2\n'
+	;;
+*)
+	echo "Error from server (NotFound): $2 not found" >&2
+	exit 1
+	;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCompareKube(t *testing.T) {
+	o := testOptions(t)
+	fakeKubectl(t)
+
+	tmpDir := t.TempDir()
+	manifests := map[string]string{
+		"web.yaml":   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n",
+		"api.yaml":   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\nspec:\n  replicas: 1\n",
+		"other.yaml": "replicas: 1\n",
+	}
+	for name, content := range manifests {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	o.outputFormat, o.noColor = "compact", true
+
+	t.Run("named object", func(t *testing.T) {
+		o.kubeObject, o.kubeMatch, o.recursive = "deploy/web", false, false
+		out, err := captureStdout(t, func() error {
+			_, err := o.compareKube(filepath.Join(tmpDir, "web.yaml"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("compareKube() error = %v", err)
+		}
+		if !strings.Contains(out, "~ /spec/replicas") {
+			t.Errorf("output missing the replicas change:\n%s", out)
+		}
+		// Server fields and defaults are not differences
+		for _, notWant := range []string{"status", "uid", "revisionHistoryLimit"} {
+			if strings.Contains(out, notWant) {
+				t.Errorf("output contains %q:\n%s", notWant, out)
+			}
+		}
+	})
+
+	t.Run("matched directory", func(t *testing.T) {
+		o.kubeObject, o.kubeMatch, o.recursive = "", true, true
+		out, err := captureStdout(t, func() error {
+			_, err := o.compareKube(tmpDir)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("compareKube() error = %v", err)
+		}
+		for _, want := range []string{"+++ api.yaml (added)", "=== web.yaml ===", "1 file compared (1 changed), 1 added"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+		if strings.Contains(out, "other.yaml") {
+			t.Errorf("output contains a file that is not a manifest:\n%s", out)
+		}
+	})
+
+	t.Run("not a manifest", func(t *testing.T) {
+		o.kubeObject, o.kubeMatch, o.recursive = "", true, false
+		_, err := o.compareKube(filepath.Join(tmpDir, "other.yaml"))
+		if !errors.Is(err, errNotManifest) {
+			t.Errorf("compareKube() error = %v, want errNotManifest", err)
+		}
+	})
+}
+
+func TestCompareArchives(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+
+	// Chart packages whose top-level directory is versioned
+	oldArchive := filepath.Join(tmpDir, "chart-1.0.0.zip")
+	newArchive := filepath.Join(tmpDir, "chart-1.1.0.zip")
+	writeArchive := func(path string, files map[string]string) {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+		defer f.Close()
+		zw := zip.NewWriter(f)
+		for name, content := range files {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatalf("Failed to add %s: %v", name, err)
+			}
+			w.Write([]byte(content))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	writeArchive(oldArchive, map[string]string{
+		"chart-1.0.0/values.yaml": "replicas: 1\n",
+		"chart-1.0.0/old.yaml":    "a: 1\n",
+	})
+	writeArchive(newArchive, map[string]string{
+		"chart-1.1.0/values.yaml": "replicas: 2\n",
+		"chart-1.1.0/README.md":   "not config\n",
+	})
+
+	o.outputFormat, o.stripComponents, o.quiet, o.exitCode = "compact", 1, 0, false
+
+	out, err := captureStdout(t, func() error {
+		_, err := o.compare(oldArchive, newArchive)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compare() error = %v", err)
+	}
+	for _, want := range []string{"=== values.yaml ===", "~ /replicas", "--- old.yaml (removed)", "1 file compared (1 changed), 0 added, 1 removed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "README") {
+		t.Errorf("output contains a file that is not config:\n%s", out)
+	}
+
+	// A single file is read from inside an archive
+	out, err = captureStdout(t, func() error {
+		_, err := o.compare(oldArchive+"!values.yaml", newArchive+"!values.yaml")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compare() of archive entries error = %v", err)
+	}
+	if !strings.Contains(out, "~ /replicas") {
+		t.Errorf("output missing the replicas change:\n%s", out)
+	}
+}
+
+func TestCompareGlobsAndPairs(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"prod/app.yaml":      "replicas: 3\n",
+		"prod/db.yaml":       "size: large\n",
+		"staging/app.yaml":   "replicas: 1\n",
+		"staging/cache.yaml": "ttl: 60\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	o.outputFormat, o.quiet, o.exitCode = "compact", 0, false
+
+	t.Run("globs", func(t *testing.T) {
+		var hasChanges bool
+		out, err := captureStdout(t, func() error {
+			var err error
+			hasChanges, err = o.compareGlobs(filepath.Join(tmpDir, "prod", "*.yaml"), filepath.Join(tmpDir, "staging", "*.yaml"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("compareGlobs() error = %v", err)
+		}
+		if !hasChanges {
+			t.Error("compareGlobs() reported no changes")
+		}
+		for _, want := range []string{"=== app.yaml ===", "+++ cache.yaml (added)", "--- db.yaml (removed)", "1 file compared (1 changed), 1 added, 1 removed"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+
+		if _, err := o.compareGlobs(filepath.Join(tmpDir, "prod", "*.yaml"), filepath.Join(tmpDir, "staging", "app.yaml")); err == nil {
+			t.Error("compareGlobs() with a plain path should fail")
+		}
+		if _, err := o.compareGlobs(filepath.Join(tmpDir, "prod", "*.toml"), filepath.Join(tmpDir, "staging", "*.toml")); err == nil {
+			t.Error("compareGlobs() without matches should fail")
+		}
+	})
+
+	t.Run("pairs file", func(t *testing.T) {
+		pairs := filepath.Join(tmpDir, "pairs.txt")
+		content := fmt.Sprintf("# prod against staging\n%s\t%s\n\n\t%s\n",
+			filepath.Join(tmpDir, "prod", "app.yaml"), filepath.Join(tmpDir, "staging", "app.yaml"),
+			filepath.Join(tmpDir, "staging", "cache.yaml"))
+		if err := os.WriteFile(pairs, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write pairs file: %v", err)
+		}
+
+		out, err := captureStdout(t, func() error {
+			_, err := o.compareFileList(pairs)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("compareFileList() error = %v", err)
+		}
+		for _, want := range []string{"~ /replicas", "cache.yaml (added)", "1 file compared (1 changed), 1 added, 0 removed"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+
+		if err := os.WriteFile(pairs, []byte("only-one-path.yaml\n"), 0644); err != nil {
+			t.Fatalf("Failed to write pairs file: %v", err)
+		}
+		if _, err := readPairs(pairs); err == nil || !strings.Contains(err.Error(), "pairs.txt:1") {
+			t.Errorf("readPairs() error = %v, want the bad line", err)
+		}
+	})
+}
+
+// writeTree writes n small config files, half of them changed, under old
+// and new directories in dir.
+func writeTree(tb testing.TB, dir string, n int) (string, string) {
+	tb.Helper()
+	oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	for i := 0; i < n; i++ {
+		name := filepath.Join(fmt.Sprintf("group%02d", i%10), fmt.Sprintf("file%04d.yaml", i))
+		for _, side := range []string{oldDir, newDir} {
+			replicas := i
+			if side == newDir && i%2 == 0 {
+				replicas++
+			}
+			path := filepath.Join(side, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				tb.Fatalf("Failed to create directory: %v", err)
+			}
+			content := fmt.Sprintf("name: app%d\nspec:\n  replicas: %d\n  image: web:1\n", i, replicas)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				tb.Fatalf("Failed to write %s: %v", path, err)
+			}
+		}
+	}
+	return oldDir, newDir
+}
+
+func TestCompareDirectoriesParallel(t *testing.T) {
+	o := testOptions(t)
+	oldDir, newDir := writeTree(t, t.TempDir(), 60)
+	// A file that fails to parse must not stop the others, but still fails
+	// the comparison
+	broken := filepath.Join(newDir, "group00", "file0000.yaml")
+	if err := os.WriteFile(broken, []byte("a: [\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", broken, err)
+	}
+
+	o.outputFormat, o.quiet, o.exitCode = "stat", 0, false
+
+	var outputs []string
+	for _, j := range []int{1, 8} {
+		o.jobs = j
+		out, err := captureStdout(t, func() error {
+			_, err := o.compareDirectories(oldDir, newDir)
+			return err
+		})
+		if err == nil || err.Error() != "1 file could not be compared" {
+			t.Fatalf("compareDirectories() with %d jobs error = %v, want 1 file could not be compared", j, err)
+		}
+		outputs = append(outputs, out)
+	}
+
+	if outputs[0] != outputs[1] {
+		t.Errorf("output differs between 1 and 8 jobs:\n%s\n---\n%s", outputs[0], outputs[1])
+	}
+	if !strings.Contains(outputs[1], "29 files changed") {
+		t.Errorf("output should report the 29 changed files that parse:\n%s", outputs[1])
+	}
+}
+
+func TestCompareDirectoriesTimings(t *testing.T) {
+	oldDir, newDir := writeTree(t, t.TempDir(), 12)
+
+	t.Run("verbose", func(t *testing.T) {
+		cmd, _ := testCommand(t)
+		cmd.SetArgs([]string{"-r", "--verbose", oldDir, newDir})
+		_, errOut, err := captureOutput(t, cmd.Execute)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		_, list, ok := strings.Cut(errOut, "Slowest files:\n")
+		if !ok {
+			t.Fatalf("--verbose should list the slowest files:\n%s", errOut)
+		}
+		if n := strings.Count(list, "(parse "); n != slowestFiles {
+			t.Errorf("listed %d slowest files, want %d:\n%s", n, slowestFiles, list)
+		}
+	})
+
+	t.Run("not verbose", func(t *testing.T) {
+		cmd, _ := testCommand(t)
+		cmd.SetArgs([]string{"-r", "-o", "json", oldDir, newDir})
+		out, errOut, err := captureOutput(t, cmd.Execute)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		var doc report.JSONDirOutput
+		if err := json.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("output is not JSON: %v\n%s", err, out)
+		}
+		for _, f := range doc.Files {
+			if f.ParseMs+f.DiffMs <= 0 {
+				t.Errorf("%s: no timings in the JSON output without --verbose", f.Path)
+			}
+		}
+		if strings.Contains(errOut, "Slowest files") {
+			t.Errorf("slowest files listed without --verbose:\n%s", errOut)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cmd, _ := testCommand(t)
+		cmd.SetArgs([]string{"-r", "--timeout-per-file", "1ns", oldDir, newDir})
+		out, errOut, err := captureOutput(t, cmd.Execute)
+		if err == nil || err.Error() != "12 files could not be compared" {
+			t.Fatalf("Execute() error = %v, want 12 files could not be compared", err)
+		}
+		if !strings.Contains(errOut, "timed out after 1ns (--timeout-per-file)") {
+			t.Errorf("stderr should report the files that timed out:\n%s", errOut)
+		}
+		if !strings.Contains(out+errOut, "12 timed out") || strings.Contains(out+errOut, "failed") {
+			t.Errorf("summary should count the files as timed out:\n%s\n%s", out, errOut)
+		}
+	})
+}
+
+func TestMaxParseSize(t *testing.T) {
+	defer func(size int) { parse.MaxSize = size }(parse.MaxSize)
+	t.Setenv("CONFIGDIFF_MAX_PARSE_SIZE", "")
+	dir := t.TempDir()
+	oldFile, newFile := filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")
+	value := strings.Repeat("x", 2000)
+	if err := os.WriteFile(oldFile, []byte(`{"a": "`+value+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte(`{"a": "`+value+`", "b": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "configdiff.yaml")
+	if err := os.WriteFile(configFile, []byte("max_parse_size: 1K\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		cmd, _ := testCommand(t)
+		cmd.SetArgs(append(append([]string{"-o", "compact"}, args...), oldFile, newFile))
+		out, _, err := captureOutput(t, cmd.Execute)
+		return out, err
+	}
+
+	// The config file lowers the limit below the size of the files
+	if _, err := run("--config", configFile); err == nil || !strings.Contains(err.Error(), "more than 1024") {
+		t.Errorf("comparing files over max_parse_size error = %v, want a limit error", err)
+	}
+	// The flag, or the environment, raises it again
+	for _, args := range [][]string{
+		{"--config", configFile, "--max-parse-size", "1MB"},
+		{"--config", configFile, "--max-parse-size", "0"},
+		{"--max-parse-size", "4K"},
+	} {
+		if out, err := run(args...); err != nil || !strings.Contains(out, "/b") {
+			t.Errorf("comparing with %v = %q, %v, want the change to /b", args, out, err)
+		}
+	}
+	t.Setenv("CONFIGDIFF_MAX_PARSE_SIZE", "1MB")
+	if out, err := run("--config", configFile); err != nil || !strings.Contains(out, "/b") {
+		t.Errorf("comparing with CONFIGDIFF_MAX_PARSE_SIZE=1MB = %q, %v, want the change to /b", out, err)
+	}
+
+	if _, err := run("--max-parse-size", "big"); err == nil || !strings.Contains(err.Error(), "--max-parse-size") {
+		t.Errorf("invalid --max-parse-size error = %v", err)
+	}
+}
+
+func TestCompareIncremental(t *testing.T) {
+	defer func(threshold int64) { configdiff.IncrementalThreshold = threshold }(configdiff.IncrementalThreshold)
+	configdiff.IncrementalThreshold = 16
+	dir := t.TempDir()
+	files := map[string]string{
+		"old.json":   "{\n  \"a\": {\"x\": 1},\n  \"b\": [1, 2],\n  \"password\": \"hunter2\"\n}\n",
+		"new.json":   "{\n  \"a\": {\"x\": 2},\n  \"b\": [1, 2],\n  \"password\": \"hunter3\",\n  \"c\": true\n}\n",
+		"old.yaml":   "a:\n  x: 1\n",
+		"new.yaml":   "a:\n  x: 2\n",
+		"small.json": "{}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(args ...string) (string, string, error) {
+		t.Helper()
+		cmd, _ := testCommand(t)
+		cmd.SetArgs(append([]string{"--verbose", "--no-cache"}, args...))
+		return captureOutput(t, cmd.Execute)
+	}
+
+	// Large JSON files are compared a member at a time, with the same
+	// changes and masking as when parsed whole
+	out, errOut, err := run("-o", "compact", "--mask-secrets", filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json"))
+	if err != nil {
+		t.Fatalf("comparing JSON files error = %v", err)
+	}
+	if !strings.Contains(errOut, "comparing incrementally") {
+		t.Errorf("JSON files larger than the threshold were not compared incrementally:\n%s", errOut)
+	}
+	for _, want := range []string{"/a/x", "/c", "/password"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing the change to %s:\n%s", want, out)
+		}
+	}
+	jsonOut, _, err := run("-o", "json", "--mask-secrets", filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json"))
+	if err != nil || strings.Contains(jsonOut, "hunter") {
+		t.Errorf("secret not masked in incremental output: %v\n%s", err, jsonOut)
+	}
+	configdiff.IncrementalThreshold = 0
+	whole, _, _ := run("-o", "compact", "--mask-secrets", filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json"))
+	if whole != out {
+		t.Errorf("incremental output differs from comparing whole:\n%s\n---\n%s", out, whole)
+	}
+	configdiff.IncrementalThreshold = 16
+
+	// Other formats, small files, and output that needs the documents are
+	// compared whole
+	for _, args := range [][]string{
+		{filepath.Join(dir, "old.yaml"), filepath.Join(dir, "new.yaml")},
+		{filepath.Join(dir, "small.json"), filepath.Join(dir, "small.json")},
+		{"-o", "unified", filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")},
+	} {
+		_, errOut, err := run(args...)
+		if err != nil {
+			t.Errorf("comparing %v error = %v", args, err)
+		}
+		if strings.Contains(errOut, "comparing incrementally") {
+			t.Errorf("comparing %v was incremental:\n%s", args, errOut)
+		}
+	}
+}
+
+func TestCompareCache(t *testing.T) {
+	oldDir, newDir := writeTree(t, t.TempDir(), 6)
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	t.Setenv("CONFIGDIFF_CACHE_DIR", "")
+
+	// run compares the directories and returns the output, but for the
+	// timings of --verbose, and the number of pairs taken from the cache
+	timings := regexp.MustCompile(`(?m)^\s*"(parse|diff)Ms": .*\n`)
+	run := func(args ...string) (string, int) {
+		t.Helper()
+		cmd, _ := testCommand(t)
+		cmd.SetArgs(append(append([]string{"-r", "--verbose", "--exit-code=false"}, args...), oldDir, newDir))
+		out, errOut, err := captureOutput(t, cmd.Execute)
+		if err != nil {
+			t.Fatalf("Execute(%v) error = %v", args, err)
+		}
+		return timings.ReplaceAllString(out, ""), strings.Count(errOut, `msg="cache hit"`)
+	}
+	// check compares with and without the cache and expects the same output
+	check := func(wantHits int, args ...string) string {
+		t.Helper()
+		want, _ := run(args...)
+		got, hits := run(append(args, "--cache-dir", cacheDir)...)
+		if got != want {
+			t.Errorf("output %v with the cache differs:\n%s\n---\n%s", args, got, want)
+		}
+		if hits != wantHits {
+			t.Errorf("%d cache hits %v, want %d", hits, args, wantHits)
+		}
+		return got
+	}
+
+	for _, format := range []string{"report", "json", "unified"} {
+		check(0, "-o", format)
+		check(6, "-o", format)
+	}
+
+	// A file changed by one byte misses
+	path := filepath.Join(newDir, "group01", "file0001.yaml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := check(6)
+	if err := os.WriteFile(path, bytes.Replace(data, []byte("replicas: 1"), []byte("replicas: 7"), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after := check(5); after == before {
+		t.Errorf("output unchanged after a file changed:\n%s", after)
+	}
+	check(6)
+
+	// Options that change the diff miss
+	check(0, "--ignore", "/spec/replicas")
+	check(0, "--mask-path", "/name")
+	check(6, "--mask-path", "/name")
+
+	// --no-cache ignores the cache, also when set in the environment
+	t.Setenv("CONFIGDIFF_CACHE_DIR", cacheDir)
+	if _, hits := run(); hits != 6 {
+		t.Errorf("%d cache hits with $CONFIGDIFF_CACHE_DIR, want 6", hits)
+	}
+	if _, hits := run("--no-cache"); hits != 0 {
+		t.Errorf("%d cache hits with --no-cache, want 0", hits)
+	}
+}
+
+func TestOutputDeterministic(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir, newDir := writeTree(t, tmpDir, 30)
+	// Objects with many keys, in every format, so that iterating them in map
+	// order would show
+	var yamlDoc, jsonDoc, hclDoc, tomlDoc strings.Builder
+	for side, dir := range []string{oldDir, newDir} {
+		yamlDoc.Reset()
+		jsonDoc.Reset()
+		hclDoc.Reset()
+		tomlDoc.Reset()
+		jsonDoc.WriteString("{")
+		for i := 0; i < 40; i++ {
+			fmt.Fprintf(&yamlDoc, "key%02d:\n  value: %d\n  items: [{name: a, v: %d}, {name: b, v: %d}]\n", i, i*side, i, i+side)
+			if i > 0 {
+				jsonDoc.WriteString(",")
+			}
+			fmt.Fprintf(&jsonDoc, `"key%02d": {"value": %d}`, i, i*side)
+			fmt.Fprintf(&hclDoc, "key%02d = { value = %d }\n", i, i*side)
+			fmt.Fprintf(&tomlDoc, "[key%02d]\nvalue = %d\n", i, i*side)
+		}
+		jsonDoc.WriteString("}")
+		files := map[string]string{
+			"many/keys.yaml": yamlDoc.String(),
+			"many/keys.json": jsonDoc.String(),
+			"many/keys.hcl":  hclDoc.String(),
+			"many/keys.toml": tomlDoc.String(),
+			"broken.yaml":    "a: 1\n",
+		}
+		if side == 1 {
+			files["broken.yaml"] = "a: [\n"
+			files["added.yaml"] = "added: true\n"
+		} else {
+			files["removed.yaml"] = "removed: true\n"
+		}
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", path, err)
+			}
+		}
+	}
+
+	// --verbose logs when and how long each step took, and lists the
+	// slowest files; JSON output has each file's timings
+	timings := regexp.MustCompile(`(time|duration)=\S+`)
+	slowest := regexp.MustCompile(`Slowest files:\n(  .*\n)*`)
+	jsonTimings := regexp.MustCompile(`"(parseMs|diffMs)": [0-9.e+-]+`)
+	run := func(args []string) string {
+		t.Helper()
+		cmd, _ := testCommand(t)
+		cmd.SetArgs(args)
+		out, errOut, err := captureOutput(t, cmd.Execute)
+		out = jsonTimings.ReplaceAllString(out, `"$1": X`)
+		errOut = slowest.ReplaceAllString(timings.ReplaceAllString(errOut, "$1=X"), "Slowest files: X\n")
+		return fmt.Sprintf("stdout:\n%s\nstderr:\n%s\nerror: %v", out, errOut, err)
+	}
+
+	for _, args := range [][]string{
+		{"-r", "-j", "8"},
+		{"-r", "-j", "8", "-o", "json"},
+		{"-r", "-j", "8", "-o", "compact", "--stable-order=false"},
+		{"-r", "-j", "8", "-o", "stat", "--array-key", "/*/items=name", "--ignore", "/key00", "--verbose"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			args = append(args, oldDir, newDir)
+			first := run(args)
+			if !strings.Contains(first, "broken.yaml") {
+				t.Fatalf("output does not mention the file that fails to parse:\n%s", first)
+			}
+			for i := 0; i < 3; i++ {
+				if again := run(args); again != first {
+					t.Fatalf("output differs between runs:\n%s\n---\n%s", first, again)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareDirectoriesRenames(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldDir := filepath.Join(tmpDir, "old")
+	newDir := filepath.Join(tmpDir, "new")
+	files := map[string]string{
+		"old/app.yaml":          "name: app\nreplicas: 2\nimage: app:1.0\nport: 80\n",
+		"new/services/app.yaml": "name: app\nreplicas: 3\nimage: app:1.0\nport: 80\n",
+		"old/db.json":           `{"host": "db", "port": 5432}`,
+		"new/database.json":     `{"port": 5432, "host": "db"}`,
+		"old/legacy.yaml":       "enabled: true\n",
+		"new/other.yaml":        "enabled: false\nmode: fast\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	o.outputFormat, o.quiet, o.exitCode, o.noColor = "report", 0, false, true
+
+	tests := []struct {
+		name      string
+		noRename  bool
+		threshold int
+		want      []string
+		notWant   []string
+	}{
+		{
+			name:      "default threshold",
+			threshold: defaultRenameThreshold,
+			want: []string{
+				"renamed: db.json → database.json (similarity 100%)",
+				"renamed: app.yaml → services/app.yaml (similarity 60%)",
+				"/replicas: 2 → 3",
+				"--- legacy.yaml (removed)",
+				"+++ other.yaml (added)",
+				"0 files compared (0 changed), 1 added, 1 removed, 2 renamed",
+			},
+		},
+		{
+			name:      "higher threshold",
+			threshold: 60,
+			want: []string{
+				"renamed: db.json → database.json (similarity 100%)",
+				"--- app.yaml (removed)",
+				"+++ services/app.yaml (added)",
+				"0 files compared (0 changed), 2 added, 2 removed, 1 renamed",
+			},
+		},
+		{
+			name:      "disabled",
+			noRename:  true,
+			threshold: defaultRenameThreshold,
+			want:      []string{"--- db.json (removed)", "+++ database.json (added)", "3 added, 3 removed"},
+			notWant:   []string{"renamed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.noRenameDetect, o.renameThreshold = tt.noRename, tt.threshold
+			out, err := captureStdout(t, func() error {
+				_, err := o.compareDirectories(oldDir, newDir)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("compareDirectories() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output should contain %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("output should not contain %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+
+	// An exact rename alone is still a difference
+	o.noRenameDetect, o.renameThreshold = false, defaultRenameThreshold
+	for _, name := range []string{"old/app.yaml", "new/services/app.yaml", "old/legacy.yaml", "new/other.yaml"} {
+		if err := os.Remove(filepath.Join(tmpDir, name)); err != nil {
+			t.Fatalf("Failed to remove %s: %v", name, err)
+		}
+	}
+	var hasChanges bool
+	_, err := captureStdout(t, func() error {
+		var err error
+		hasChanges, err = o.compareDirectories(oldDir, newDir)
+		return err
+	})
+	if err != nil || !hasChanges {
+		t.Errorf("compareDirectories() = %v, %v, want true for an exact rename", hasChanges, err)
+	}
+}
+
+func TestCompareDirectoriesMatchStem(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldDir := filepath.Join(tmpDir, "old")
+	newDir := filepath.Join(tmpDir, "new")
+	files := map[string]string{
+		"old/config.json":     `{"replicas": 2, "image": "app:1.0"}`,
+		"new/config.yaml":     "replicas: 3\nimage: app:1.0\n",
+		"old/app/values.json": `{"debug": true}`,
+		"new/app/values.yaml": "mode: fast\n",
+		"new/app/values.yml":  "level: 3\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	o.outputFormat, o.quiet, o.exitCode, o.noColor, o.matchStem = "report", 0, false, true, true
+
+	out, err := captureStdout(t, func() error {
+		_, err := o.compareDirectories(oldDir, newDir)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compareDirectories() error = %v", err)
+	}
+	for _, want := range []string{
+		"=== config.json → config.yaml ===",
+		"/replicas: 2 → 3",
+		// Two candidates for app/values.json leave all three unpaired
+		"--- app/values.json (removed)",
+		"+++ app/values.yaml (added)",
+		"+++ app/values.yml (added)",
+		"1 file compared (1 changed), 2 added, 1 removed",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCompareDirectoriesLimits(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldDir := filepath.Join(tmpDir, "old")
+	newDir := filepath.Join(tmpDir, "new")
+	big := "data: \"" + strings.Repeat("x", 2048) + "\"\n"
+	files := map[string]string{
+		"old/top.yaml":         "value: 1\n",
+		"new/top.yaml":         "value: 2\n",
+		"old/dump.json":        "{}",
+		"new/dump.json":        `{"data": "` + strings.Repeat("x", 2048) + `"}`,
+		"new/big.yaml":         big,
+		"old/a/mid.yaml":       "value: 1\n",
+		"new/a/mid.yaml":       "value: 2\n",
+		"old/a/b/deep.yaml":    "value: 1\n",
+		"new/a/b/deep.yaml":    "value: 2\n",
+		"new/a/b/c/added.yaml": "value: 3\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	o.outputFormat, o.quiet, o.exitCode = "json", 0, false
+
+	tests := []struct {
+		name     string
+		size     string
+		depth    int
+		want     map[string]string
+		maxDepth int
+	}{
+		{
+			name: "no limits",
+			size: "0",
+			want: map[string]string{"top.yaml": "modified", "dump.json": "modified", "big.yaml": "added",
+				"a/mid.yaml": "modified", "a/b/deep.yaml": "modified", "a/b/c/added.yaml": "added"},
+		},
+		{
+			name:  "size and depth",
+			size:  "1K",
+			depth: 2,
+			want: map[string]string{"top.yaml": "modified", "dump.json": "skipped", "big.yaml": "skipped",
+				"a/mid.yaml": "modified"},
+			maxDepth: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.maxFileSize, o.maxWalkDepth = tt.size, tt.depth
+			out, err := captureStdout(t, func() error {
+				_, err := o.compareDirectories(oldDir, newDir)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("compareDirectories() error = %v", err)
+			}
+			var doc report.JSONDirOutput
+			if err := json.Unmarshal([]byte(out), &doc); err != nil {
+				t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+			}
+			got := map[string]string{}
+			for _, f := range doc.Files {
+				got[f.Path] = f.Status
+				if f.Status == "skipped" && f.Error != "too large, over --max-file-size 1KB" {
+					t.Errorf("%s error = %q, want the size limit", f.Path, f.Error)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("file statuses = %v, want %v", got, tt.want)
+			}
+			if doc.MaxDepth != tt.maxDepth {
+				t.Errorf("maxDepth = %d, want %d", doc.MaxDepth, tt.maxDepth)
+			}
+		})
+	}
+}
+
+func BenchmarkCompareDirectories(b *testing.B) {
+	o := testOptions(b)
+	oldDir, newDir := writeTree(b, b.TempDir(), 1000)
+
+	o.quiet, o.exitCode = quietAll, false
+
+	for _, j := range []int{1, 2, 4, 8} {
+		if j > 1 && j > runtime.NumCPU() {
+			break
+		}
+		b.Run(fmt.Sprintf("jobs=%d", j), func(b *testing.B) {
+			o.jobs = j
+			for i := 0; i < b.N; i++ {
+				if _, err := o.compareDirectories(oldDir, newDir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.yaml")
+	newFile := filepath.Join(tmpDir, "new.yaml")
+	if err := os.WriteFile(oldFile, []byte("replicas: 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write old file: %v", err)
+	}
+	if err := os.WriteFile(newFile, []byte("replicas: 2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write new file: %v", err)
+	}
+
+	o.outputFormat, o.quiet, o.exitCode = "compact", 0, false
+
+	outFile := filepath.Join(tmpDir, "diff.txt")
+	if err := os.WriteFile(outFile, []byte("previous\n"), 0600); err != nil {
+		t.Fatalf("Failed to write output file: %v", err)
+	}
+
+	// Nothing reaches stdout, and the file keeps its permissions
+	out, err := captureStdout(t, func() error {
+		if err := o.openOutput(outFile); err != nil {
+			return err
+		}
+		if _, err := o.compare(oldFile, newFile); err != nil {
+			o.discardOutput()
+			return err
+		}
+		return o.commitOutput(outFile)
+	})
+	if err != nil {
+		t.Fatalf("compare() error = %v", err)
+	}
+	if out != "" {
+		t.Errorf("stdout = %q, want nothing", out)
+	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(data), "~ /replicas") {
+		t.Errorf("output file missing the change:\n%s", data)
+	}
+	if info, err := os.Stat(outFile); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0600) {
+		t.Errorf("output file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	// A failed comparison leaves the previous output in place
+	if err := o.openOutput(outFile); err != nil {
+		t.Fatalf("o.openOutput() error = %v", err)
+	}
+	if _, err := o.compare(oldFile, filepath.Join(tmpDir, "missing.yaml")); err == nil {
+		t.Fatal("compare() with a missing file should fail")
+	}
+	o.discardOutput()
+	if data, _ := os.ReadFile(outFile); !strings.Contains(string(data), "~ /replicas") {
+		t.Errorf("output file changed after a failure:\n%s", data)
+	}
+	entries, _ := os.ReadDir(tmpDir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestCompareFilesFailOn(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.yaml")
+	newFile := filepath.Join(tmpDir, "new.yaml")
+	if err := os.WriteFile(oldFile, []byte("replicas: 2\nport: 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte("replicas: 3\nport: \"80\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o.quiet, o.exitCode = quietAll, false
+
+	tests := []struct {
+		failOn []string
+		want   bool
+	}{
+		{nil, true},
+		{[]string{"add", "remove"}, false},
+		{[]string{"type-change"}, true},
+		{[]string{"move", "modify"}, true},
+	}
+	for _, tt := range tests {
+		o.failOn = tt.failOn
+		got, err := o.compareFiles(oldFile, newFile)
+		if err != nil {
+			t.Fatalf("compareFiles() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("compareFiles() with --fail-on %v = %v, want %v", tt.failOn, got, tt.want)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	rootCmd, o := testCommand(t)
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.yaml")
+	newFile := filepath.Join(tmpDir, "new.yaml")
+	broken := filepath.Join(tmpDir, "broken.yaml")
+	for path, content := range map[string]string{oldFile: "a: 1\n", newFile: "a: 2\n", broken: "a: [\n"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o.quiet = quietAll
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode bool
+		want     int
+	}{
+		{"no differences", []string{oldFile, oldFile}, true, 0},
+		{"differences", []string{oldFile, newFile}, true, exitDifferences},
+		{"differences without --exit-code", []string{oldFile, newFile}, false, 0},
+		{"unreadable file", []string{oldFile, filepath.Join(tmpDir, "missing.yaml")}, true, exitTrouble},
+		{"parse error", []string{oldFile, broken}, true, exitTrouble},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.exitCode = tt.exitCode
+			if got := exitStatus(o.runCompare(rootCmd, tt.args)); got != tt.want {
+				t.Errorf("exit status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := exitStatus(&exitError{code: mergeExitConflicts, err: errors.New("conflicts")}); got != mergeExitConflicts {
+		t.Errorf("exitStatus(exitError) = %d, want %d", got, mergeExitConflicts)
+	}
+}
+
+func TestCommandsDoNotShareFlags(t *testing.T) {
+	first, o1 := testCommand(t)
+	_, o2 := testCommand(t)
+	if err := first.ParseFlags([]string{"-qq", "--exit-code", "-r", "-o", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	if o1.quiet != quietAll || !o1.exitCode || !o1.recursive || o1.outputFormat != "json" {
+		t.Errorf("parsed options = quiet %d, exit code %v, recursive %v, output %q", o1.quiet, o1.exitCode, o1.recursive, o1.outputFormat)
+	}
+	if o2.quiet != 0 || o2.exitCode || o2.recursive || o2.outputFormat != "report" {
+		t.Errorf("another command's options = quiet %d, exit code %v, recursive %v, output %q, want the defaults", o2.quiet, o2.exitCode, o2.recursive, o2.outputFormat)
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldFile, broken := filepath.Join(tmpDir, "old.yaml"), filepath.Join(tmpDir, "broken.json")
+	if err := os.WriteFile(oldFile, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, []byte("{\n  \"a\": 1,\n  \"b\" 2\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := o.diffFiles(oldFile, broken)
+	var parseErr *configdiff.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("diffFiles() error = %v, want a *configdiff.ParseError", err)
+	}
+	if parseErr.Side != "new" || parseErr.File != broken || parseErr.Line != 3 || parseErr.Column != 7 {
+		t.Errorf("ParseError = %s %s:%d:%d, want new %s:3:7", parseErr.Side, parseErr.File, parseErr.Line, parseErr.Column, broken)
+	}
+	wrapped := fmt.Errorf("comparing: %w", err)
+	if got := errorMessage(wrapped).Error(); !strings.HasPrefix(got, broken+":3:7: failed to parse JSON") {
+		t.Errorf("errorMessage() = %q, want it to start with the file and position", got)
+	}
+	if got := exitStatus(wrapped); got != exitTrouble {
+		t.Errorf("exitStatus() = %d, want %d", got, exitTrouble)
+	}
+
+	_, err = o.diffFiles(oldFile, filepath.Join(tmpDir, "missing.yaml"))
+	var readErr *configdiff.ReadError
+	if !errors.As(err, &readErr) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("diffFiles() of a missing file error = %v, want a *configdiff.ReadError", err)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "deploy.yaml")
+	content := "kind: Deployment\nspec:\n  replicas: 2\n  template:\n    containers:\n      - name: web\n        image: web:1\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	complete := func(args ...string) []string {
+		t.Helper()
+		var out bytes.Buffer
+		rootCmd, _ := testCommand(t)
+		rootCmd.SetOut(&out)
+		rootCmd.SetArgs(append([]string{cobra.ShellCompRequestCmd}, args...))
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("completion of %v error = %v", args, err)
+		}
+		// The last line is the directive
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		return lines[:len(lines)-1]
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"file arguments", []string{"dep"}, configExtensions},
+		{"no third argument", []string{file, file, ""}, []string{}},
+		{"output formats", []string{file, file, "-o", ""}, cli.OutputFormats},
+		{"input formats", []string{file, file, "--format", ""}, cli.InputFormats},
+		{"top-level keys", []string{file, file, "--ignore", ""}, []string{"/kind", "/spec/"}},
+		{"nested keys", []string{file, file, "--ignore", "/spec/re"}, []string{"/spec/replicas"}},
+		{"array paths", []string{file, file, "--array-key", "/spec/template/"}, []string{"/spec/template/containers"}},
+		{"array keys", []string{file, file, "--array-key", "/spec/template/containers="}, []string{"/spec/template/containers=image", "/spec/template/containers=name"}},
+		{"unreadable file", []string{filepath.Join(tmpDir, "missing.yaml"), file, "--ignore", ""}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := complete(tt.args...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("completions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("NO_COLOR", "")
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(fn func(*cobra.Command, []string) error, args ...string) (string, error) {
+		t.Helper()
+		var out bytes.Buffer
+		cmd, _ := testCommand(t, "config")
+		cmd.SetOut(&out)
+		err := fn(cmd, args)
+		return out.String(), err
+	}
+
+	if _, err := run(o.runConfigValidate); err == nil || !strings.Contains(err.Error(), "no config file found") {
+		t.Errorf("config validate without a file error = %v, want no config file found", err)
+	}
+
+	// The starter file is valid and not overwritten without --force
+	if _, err := run(o.runConfigInit); err != nil {
+		t.Fatalf("config init error = %v", err)
+	}
+	if _, err := run(o.runConfigInit); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("config init over an existing file error = %v, want already exists", err)
+	}
+	if out, err := run(o.runConfigValidate); err != nil || out != ".configdiffrc: OK\n" {
+		t.Errorf("config validate of the starter file = %q, %v, want OK", out, err)
+	}
+
+	bad := filepath.Join(tmpDir, "bad.yaml")
+	if err := os.WriteFile(bad, []byte("output_format: jsn\nmax_value_length: -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(o.runConfigValidate, bad); err == nil || !strings.Contains(err.Error(), "2 problems") {
+		t.Errorf("config validate of invalid values error = %v, want 2 problems", err)
+	}
+
+	badRules := filepath.Join(tmpDir, "rules.yaml")
+	rules := "preset: helm\nrules:\n  - ignore_paths: [/a]\n  - match: \"[\"\n    preset: kubernetes\n  - match: \"*.tf\"\n    preset: terraform\n    colour: red\n"
+	if err := os.WriteFile(badRules, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err := captureOutput(t, func() error {
+		_, err := run(o.runConfigValidate, badRules)
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "5 problems") {
+		t.Errorf("config validate of invalid rules error = %v, want 5 problems", err)
+	}
+	for _, want := range []string{
+		`:1: invalid preset "helm"`,
+		`:2: rule 1: match must not be empty`,
+		`:2: rule 2: invalid match "["`,
+		`:2: rule 3: invalid preset "terraform"`,
+		`:8: unknown key "colour"`,
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("config validate output missing %q:\n%s", want, stderr)
+		}
+	}
+
+	if err := os.WriteFile(".configdiffrc", []byte("output_format: compact\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(o.runConfigShow)
+	if err != nil {
+		t.Fatalf("config show error = %v", err)
+	}
+	for _, want := range []string{
+		"# Config file: .configdiffrc\n",
+		"output_format: \"compact\"  # .configdiffrc:1\n",
+		"max_value_length: 80  # default\n",
+		"ignore_paths: []  # default\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("config show output missing %q:\n%s", want, out)
+		}
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if out, _ := run(o.runConfigShow); !strings.Contains(out, "no_color: true  # env NO_COLOR\n") {
+		t.Errorf("config show output should take no_color from NO_COLOR:\n%s", out)
+	}
+
+	// Settings of extended files are shown with the file they come from
+	if err := os.WriteFile(".configdiffrc", []byte("extends: shared.yaml\noutput_format: compact\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(o.runConfigValidate); err == nil || !strings.Contains(err.Error(), "1 problem") {
+		t.Errorf("config validate with a missing extended file error = %v, want 1 problem", err)
+	}
+	if err := os.WriteFile("shared.yaml", []byte("output_format: json\nmax_value_length: 40\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run(o.runConfigValidate); err != nil || out != ".configdiffrc: OK\n" {
+		t.Errorf("config validate with an extended file = %q, %v, want OK", out, err)
+	}
+	out, err = run(o.runConfigShow)
+	if err != nil {
+		t.Fatalf("config show error = %v", err)
+	}
+	for _, want := range []string{
+		"output_format: \"compact\"  # .configdiffrc:2\n",
+		"max_value_length: 40  # shared.yaml:2\n",
+		"extends: [\"shared.yaml\"]  # .configdiffrc:1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("config show output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("NO_COLOR", "")
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(".configdiffrc", []byte("output_format: compact\nnumeric_strings: true\nignore_paths: [/file]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := func() cli.CLIOptions {
+		t.Helper()
+		o.cfg, o.cfgErr = config.Load()
+		if o.cfgErr != nil {
+			t.Fatalf("config.Load() error = %v", o.cfgErr)
+		}
+		opts, err := o.cliOptions("old.yaml", "new.yaml")
+		if err != nil {
+			t.Fatalf("cliOptions() error = %v", err)
+		}
+		return opts
+	}
+
+	// The config file alone
+	opts := options()
+	if opts.OutputFormat != "compact" || !opts.NumericStrings || !reflect.DeepEqual(opts.IgnorePaths, []string{"/file"}) {
+		t.Errorf("options from the config file = %+v", opts)
+	}
+
+	// The environment overrides the config file
+	t.Setenv("CONFIGDIFF_OUTPUT_FORMAT", "json")
+	t.Setenv("CONFIGDIFF_IGNORE_PATHS", `/status/**,/metadata/a\,b`)
+	opts = options()
+	if opts.OutputFormat != "json" || !opts.NumericStrings || !reflect.DeepEqual(opts.IgnorePaths, []string{"/status/**", "/metadata/a,b"}) {
+		t.Errorf("options from the environment = %+v", opts)
+	}
+
+	// Flags override the environment
+	o.outputFormat, o.ignorePaths = "markdown", []string{"/flag"}
+	opts = options()
+	if opts.OutputFormat != "markdown" || !reflect.DeepEqual(opts.IgnorePaths, []string{"/status/**", "/metadata/a,b", "/flag"}) {
+		t.Errorf("options from flags = %+v", opts)
+	}
+
+	var out bytes.Buffer
+	cmd, _ := testCommand(t, "config")
+	cmd.SetOut(&out)
+	if err := o.runConfigShow(cmd, nil); err != nil {
+		t.Fatalf("config show error = %v", err)
+	}
+	for _, want := range []string{
+		"output_format: \"json\"  # env CONFIGDIFF_OUTPUT_FORMAT\n",
+		"ignore_paths: [\"/status/**\",\"/metadata/a,b\"]  # env CONFIGDIFF_IGNORE_PATHS\n",
+		"numeric_strings: true  # .configdiffrc:2\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("config show output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	// An invalid variable is warned about without the config file hint
+	t.Setenv("CONFIGDIFF_MAX_VALUE_LENGTH", "long")
+	_, stderr, err := captureOutput(t, o.loadConfig)
+	if err != nil || !strings.Contains(stderr, "CONFIGDIFF_MAX_VALUE_LENGTH") || strings.Contains(stderr, "Hint") {
+		t.Errorf("warning for an invalid variable = %q, %v", stderr, err)
+	}
+}
+
+func TestConfigDiscovery(t *testing.T) {
+	o := testOptions(t)
+	repo := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".configdiff.yaml": "ignore_paths: [/status]\n",
+		"config/old.yaml":  "name: a\nstatus: 1\n",
+		"config/new.yaml":  "name: b\nstatus: 2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldFile, newFile := filepath.Join(repo, "config", "old.yaml"), filepath.Join(repo, "config", "new.yaml")
+
+	paths := func(args ...string) []string {
+		t.Helper()
+		o.discoverConfig(args)
+		if err := o.loadConfig(); err != nil {
+			t.Fatalf("loadConfig() error = %v", err)
+		}
+		fd, err := o.diffFiles(oldFile, newFile)
+		if err != nil {
+			t.Fatalf("diffFiles() error = %v", err)
+		}
+		var paths []string
+		for _, c := range fd.result.Changes {
+			paths = append(paths, c.Path)
+		}
+		return paths
+	}
+
+	// The repository's config file is found from the first input that exists
+	o.noDiscover = false
+	if got, want := paths("-", oldFile, newFile), []string{"/name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+	if o.cfg.Path != filepath.Join(repo, ".configdiff.yaml") {
+		t.Errorf("config file = %q, want the repository's", o.cfg.Path)
+	}
+
+	o.noDiscover = true
+	if got, want := paths(oldFile, newFile), []string{"/name", "/status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changes with --no-discover = %v, want %v", got, want)
+	}
+}
+
+func TestConfigStrict(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown key", "stable_order: true\nignorePaths: [/status]\n", `failed to load config file .configdiffrc: line 2: unknown key "ignorePaths"`},
+		{"invalid value", "stable_order: true\noutput_format: jsn\n", `failed to load config file .configdiffrc: line 2: invalid output_format "jsn"`},
+		{"invalid value in an extended file", "extends: base.yaml\nstable_order: true\n", `failed to load config file .configdiffrc: base.yaml:1: invalid preset "helm"`},
+	}
+	if err := os.WriteFile("base.yaml", []byte("preset: helm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(".configdiffrc", []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			o.lenientConfig = false
+			err := o.loadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "--lenient-config") {
+				t.Errorf("loadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+			if o.cfg.StableOrder {
+				t.Errorf("loadConfig() = %+v, want none of the file's settings", o.cfg)
+			}
+
+			// The rest of the file applies with --lenient-config
+			o.lenientConfig = true
+			_, stderr, err := captureOutput(t, o.loadConfig)
+			if err != nil || stderr != "" {
+				t.Errorf("loadConfig() with --lenient-config = %q, %v, want no error", stderr, err)
+			}
+			if !o.cfg.StableOrder {
+				t.Errorf("loadConfig() with --lenient-config = %+v, want stable_order set", o.cfg)
+			}
+		})
+	}
+
+	// Files that do not parse are still warned about and skipped
+	if err := os.WriteFile(".configdiffrc", []byte("stable_order: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o.lenientConfig = true
+	_, stderr, err := captureOutput(t, o.loadConfig)
+	if err != nil || !strings.Contains(stderr, "Warning: failed to load config file .configdiffrc") {
+		t.Errorf("loadConfig() of an invalid file with --lenient-config = %q, %v, want a warning", stderr, err)
+	}
+}
+
+func TestConfigMerge(t *testing.T) {
+	o := testOptions(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	homeFile := filepath.Join(home, ".configdiff.yaml")
+	if err := os.WriteFile(homeFile, []byte("no_color: true\nignore_paths: [/status]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".configdiffrc", []byte("ignore_paths: [/metadata]\noutput_format: compact\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Home defaults apply under the current directory's file
+	o.noMergeConfig = false
+	if err := o.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if !o.cfg.NoColor || o.cfg.OutputFormat != "compact" || !reflect.DeepEqual(o.cfg.IgnorePaths, []string{"/status", "/metadata"}) {
+		t.Errorf("loadConfig() = %+v, want both files' settings", o.cfg)
+	}
+
+	var out bytes.Buffer
+	cmd, _ := testCommand(t, "config")
+	cmd.SetOut(&out)
+	if err := o.runConfigShow(cmd, nil); err != nil {
+		t.Fatalf("config show error = %v", err)
+	}
+	for _, want := range []string{
+		"# Config file: " + homeFile + "\n# Config file: .configdiffrc\n",
+		`ignore_paths: ["/status","/metadata"]  # ` + homeFile + ":2, .configdiffrc:1\n",
+		"no_color: true  # " + homeFile + ":1\n",
+		`output_format: "compact"  # .configdiffrc:2` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("config show = %q, want %q", out.String(), want)
+		}
+	}
+
+	// An invalid value names the file it is in
+	if err := os.WriteFile(homeFile, []byte("preset: helm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.loadConfig(); err == nil || !strings.Contains(err.Error(), "failed to load config file "+homeFile+": line 1: invalid preset") {
+		t.Errorf("loadConfig() with an invalid home file error = %v", err)
+	}
+	out.Reset()
+	_, stderr, err := captureOutput(t, func() error { return o.runConfigValidate(cmd, nil) })
+	if err == nil || !strings.Contains(stderr, homeFile+":1: invalid preset") || out.String() != ".configdiffrc: OK\n" {
+		t.Errorf("config validate = %q, %q, %v, want both files checked", out.String(), stderr, err)
+	}
+
+	// --no-merge-config uses the nearest file only
+	o.noMergeConfig = true
+	if err := o.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() with --no-merge-config error = %v", err)
+	}
+	if o.cfg.NoColor || o.cfg.Preset != "" || !reflect.DeepEqual(o.cfg.IgnorePaths, []string{"/metadata"}) {
+		t.Errorf("loadConfig() with --no-merge-config = %+v, want only .configdiffrc's settings", o.cfg)
+	}
+}
+
+func TestConfigMaskingAndSeverity(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	o.cfgDir, o.lenientConfig, o.quiet, o.flagChanged = "", false, 0, nil
+	o.outputFormat, o.noColor, o.maskPaths, o.maskMode, o.severity = "report", true, nil, "redact", false
+
+	files := map[string]string{
+		".configdiffrc": "mask_paths: [/db/password]\nseverity_rules:\n  - match: /replicas\n    severity: error\n",
+		"old.yaml":      "replicas: 1\ndb:\n  password: hunter2\n",
+		"new.yaml":      "replicas: 2\ndb:\n  password: correct-horse\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	// No masking flags are given, yet the config file's mask applies
+	out, _, err := captureOutput(t, func() error { _, err := o.compare("old.yaml", "new.yaml"); return err })
+	if err != nil {
+		t.Fatalf("compare() error = %v", err)
+	}
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "correct-horse") || !strings.Contains(out, report.MaskPlaceholder) {
+		t.Errorf("compare() output shows the password unmasked:\n%s", out)
+	}
+
+	// Severity rules apply when changes are classified
+	o.outputFormat, o.severity = "json", true
+	out, _, err = captureOutput(t, func() error { _, err := o.compare("old.yaml", "new.yaml"); return err })
+	if err != nil {
+		t.Fatalf("compare() -o json error = %v", err)
+	}
+	if !strings.Contains(out, `"severity": "breaking"`) || strings.Contains(out, "hunter2") {
+		t.Errorf("compare() -o json --severity output = %s, want /replicas breaking and the password masked", out)
+	}
+
+	// Invalid globs and severities are errors naming their line
+	if err := os.WriteFile(".configdiffrc", []byte("stable_order: true\nmask_paths: [/db*]\nseverity_rules:\n  - match: /replicas\n    severity: critical\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = o.loadConfig()
+	for _, want := range []string{`line 2: invalid mask_paths entry: invalid path pattern "/db*"`, `line 3: severity rule 1: invalid severity "critical"`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadConfig() error = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	var out bytes.Buffer
+	cmd, _ := testCommand(t, "config")
+	cmd.SetOut(&out)
+	if err := runConfigSchema(cmd, nil); err != nil {
+		t.Fatalf("config schema error = %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(out.Bytes(), &schema); err != nil {
+		t.Fatalf("config schema printed invalid JSON: %v", err)
+	}
+
+	// The published schema is the one printed; run with -update to refresh it
+	schemaPath := filepath.Join("..", "..", "docs", "schema", "config.v1.json")
+	if *updateGolden {
+		if err := os.WriteFile(schemaPath, out.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to update schema file: %v", err)
+		}
+	}
+	if want, err := os.ReadFile(schemaPath); err != nil || !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("%s is out of date (%v); run go test ./cmd/configdiff/ -run TestConfigSchema -update", schemaPath, err)
+	}
+
+	// Every setting is described
+	properties := schema["properties"].(map[string]any)
+	if len(properties) != len(configSettings) {
+		t.Errorf("schema has %d settings, want %d", len(properties), len(configSettings))
+	}
+	for _, setting := range configSettings {
+		prop, ok := properties[setting.key].(map[string]any)
+		if !ok || prop["description"] == nil {
+			t.Errorf("schema setting %s = %v, want it described", setting.key, prop)
+		}
+	}
+
+	// The starter config and every config file in testdata validate
+	files := map[string]string{"starter config": starterConfig}
+	paths, err := filepath.Glob(filepath.Join("..", "..", "testdata", "configfile", "*.yaml"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no testdata config files: %v", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path] = string(data)
+		if _, err := config.LoadFile(path, false); err != nil {
+			t.Errorf("config.LoadFile(%s) error = %v", path, err)
+		}
+	}
+	for name, content := range files {
+		if errs := schemaErrors(schema, yamlToJSON(t, content), ""); len(errs) > 0 {
+			t.Errorf("%s does not validate against the schema: %v", name, errs)
+		}
+	}
+
+	// Structural mistakes do not
+	for _, content := range []string{
+		"ignorePaths: [/status]\n",
+		"output_format: jsn\n",
+		"stable_order: yes please\n",
+		"max_value_length: -1\n",
+		"rules:\n  - preset: kubernetes\n",
+		"severity_rules:\n  - match: /a\n    severity: critical\n",
+		"extends: {path: base.yaml}\n",
+	} {
+		if errs := schemaErrors(schema, yamlToJSON(t, content), ""); len(errs) == 0 {
+			t.Errorf("%q validates against the schema, want errors", content)
+		}
+	}
+}
+
+// yamlToJSON decodes a YAML document as encoding/json would decode it as
+// JSON, for checking against a JSON Schema.
+func yamlToJSON(t *testing.T, content string) any {
+	t.Helper()
+	var value any
+	if err := yaml.Unmarshal([]byte(content), &value); err != nil {
+		t.Fatalf("invalid YAML %q: %v", content, err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("YAML %q has no JSON form: %v", content, err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// schemaErrors checks value against the parts of JSON Schema that config
+// schema uses: type, enum, minimum, properties, additionalProperties,
+// required, items, and anyOf.
+func schemaErrors(schema map[string]any, value any, path string) []string {
+	var errs []string
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if len(schemaErrors(sub.(map[string]any), value, path)) == 0 {
+				matched = true
+			}
+		}
+		if !matched {
+			errs = append(errs, path+": matches none of anyOf")
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+	}
+
+	switch typ, _ := schema["type"].(string); typ {
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %v is not a string", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %v is not a boolean", path, value))
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (typ == "integer" && n != float64(int64(n))) {
+			errs = append(errs, fmt.Sprintf("%s: %v is not an %s", path, value, typ))
+		} else if min, ok := schema["minimum"].(float64); ok && n < min {
+			errs = append(errs, fmt.Sprintf("%s: %v is less than %v", path, n, min))
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: %v is not an array", path, value))
+		}
+		for i, item := range items {
+			errs = append(errs, schemaErrors(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "object":
+		obj, ok := value.(map[string]any)
+		if value == nil {
+			// An empty YAML document or key
+			break
+		}
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: %v is not an object", path, value))
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for key, v := range obj {
+			if prop, ok := properties[key].(map[string]any); ok {
+				errs = append(errs, schemaErrors(prop, v, path+"/"+key)...)
+			} else if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+				errs = append(errs, schemaErrors(additional, v, path+"/"+key)...)
+			} else if schema["additionalProperties"] == false {
+				errs = append(errs, fmt.Sprintf("%s: unknown key %q", path, key))
+			}
+		}
+		required, _ := schema["required"].([]any)
+		for _, key := range required {
+			if _, ok := obj[key.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing %s", path, key))
+			}
+		}
+	}
+	return errs
+}
+
+func TestConfigFlag(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	o.cfgDir, o.lenientConfig = "", false
+
+	files := map[string]string{
+		".configdiffrc":         "output_format: compact\nno_color: true\n",
+		"repo/.configdiff.yaml": "output_format: tree\n",
+		"repo/old.yaml":         "a: 1\n",
+		"ci.yaml":               "output_format: json\nstable_order: true\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Neither the file in the current directory nor a discovered one is used
+	o.configFile = "ci.yaml"
+	o.discoverConfig([]string{"repo/old.yaml"})
+	if err := o.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if o.cfg.Path != "ci.yaml" || o.cfg.OutputFormat != "json" || o.cfg.NoColor || !o.cfg.StableOrder {
+		t.Errorf("loadConfig() with --config = %+v, want only ci.yaml's settings", o.cfg)
+	}
+
+	// The environment still applies over it
+	t.Setenv("CONFIGDIFF_OUTPUT_FORMAT", "markdown")
+	if err := o.loadConfig(); err != nil || o.cfg.OutputFormat != "markdown" {
+		t.Errorf("loadConfig() with --config and the environment = %+v, %v, want markdown", o.cfg, err)
+	}
+
+	var out bytes.Buffer
+	cmd, _ := testCommand(t, "config")
+	cmd.SetOut(&out)
+	if err := o.runConfigShow(cmd, nil); err != nil || !strings.Contains(out.String(), "# Config file: ci.yaml\n") {
+		t.Errorf("config show with --config = %q, %v", out.String(), err)
+	}
+
+	// A missing or broken file is an error, even with --lenient-config
+	o.lenientConfig = true
+	o.configFile = "missing.yaml"
+	if err := o.loadConfig(); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Errorf("loadConfig() with a missing --config file error = %v, want an error naming it", err)
+	}
+	if err := os.WriteFile("broken.yaml", []byte("output_format: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o.configFile = "broken.yaml"
+	if err := o.loadConfig(); err == nil || !strings.Contains(err.Error(), "broken.yaml") {
+		t.Errorf("loadConfig() with a broken --config file error = %v, want an error naming it", err)
+	}
+}
+
+func TestOutputSettingsFromConfig(t *testing.T) {
+	t.Setenv("CONFIGDIFF_OUTPUT_FORMAT", "")
+	t.Setenv("CONFIGDIFF_MAX_VALUE_LENGTH", "")
+	dir := t.TempDir()
+	oldFile, newFile := filepath.Join(dir, "old.yaml"), filepath.Join(dir, "new.yaml")
+	long := strings.Repeat("abcdefghij", 10)
+	if err := os.WriteFile(oldFile, []byte("a: "+long+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte("a: "+long+"z\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "configdiff.yaml")
+	if err := os.WriteFile(configFile, []byte("output_format: compact\nmax_value_length: 20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd, _ := testCommand(t)
+		cmd.SetArgs(append(append([]string{"--config", configFile}, args...), oldFile, newFile))
+		out, _, err := captureOutput(t, cmd.Execute)
+		if err != nil {
+			t.Fatalf("configdiff %v error = %v", args, err)
+		}
+		return out
+	}
+
+	// The config file's output_format and max_value_length
+	if out := run(); !strings.Contains(out, "~ /a") || strings.Contains(out, "+ added") {
+		t.Errorf("output with output_format: compact is not compact:\n%s", out)
+	}
+	if out := run("-o", "report"); !strings.Contains(out, `"abcdefghijabcde..."`) {
+		t.Errorf("output with max_value_length: 20 does not truncate values to 20 characters:\n%s", out)
+	}
+
+	// The environment overrides the config file
+	t.Setenv("CONFIGDIFF_OUTPUT_FORMAT", "json")
+	t.Setenv("CONFIGDIFF_MAX_VALUE_LENGTH", "0")
+	var result struct {
+		Changes []json.RawMessage `json:"changes"`
+	}
+	if out := run(); json.Unmarshal([]byte(out), &result) != nil || len(result.Changes) != 1 {
+		t.Errorf("output with CONFIGDIFF_OUTPUT_FORMAT=json is not JSON with one change:\n%s", out)
+	}
+	if out := run("-o", "report"); !strings.Contains(out, long+"z") {
+		t.Errorf("output with CONFIGDIFF_MAX_VALUE_LENGTH=0 truncates values:\n%s", out)
+	}
+
+	// Flags override both
+	if out := run("-o", "report", "--max-value-length", "12"); !strings.Contains(out, `"abcdefg..."`) {
+		t.Errorf("output with --max-value-length 12 does not truncate values to 12 characters:\n%s", out)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "deploy.yaml")
+	content := "spec:\n    replicas: 2.0\n    script: |\n      echo one\n      echo two\nkind: 'Deployment'\n"
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	o.normalizeTo, o.normalizeFormat, o.normalizeInPlace = "", "auto", false
+
+	want := "kind: Deployment\nspec:\n  replicas: 2\n  script: |\n    echo one\n    echo two\n"
+	out, err := captureStdout(t, func() error { return o.normalize(file) })
+	if err != nil {
+		t.Fatalf("normalize() error = %v", err)
+	}
+	if out != want {
+		t.Errorf("normalize() = %q, want %q", out, want)
+	}
+
+	o.normalizeTo = "json"
+	out, err = captureStdout(t, func() error { return o.normalize(file) })
+	if err != nil {
+		t.Fatalf("normalize() to JSON error = %v", err)
+	}
+	if !strings.Contains(out, `"script": "echo one\necho two\n"`) {
+		t.Errorf("normalize() to JSON = %s", out)
+	}
+
+	// In place, normalizing is idempotent and keeps the file's permissions
+	o.normalizeInPlace = true
+	if err := o.normalize(file); err == nil {
+		t.Error("normalize() --in-place with --to json should fail")
+	}
+	o.normalizeTo = ""
+	for i := 0; i < 2; i++ {
+		if err := o.normalize(file); err != nil {
+			t.Fatalf("normalize() --in-place error = %v", err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("normalize() --in-place pass %d wrote %q, want %q", i+1, data, want)
+		}
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("normalize() --in-place changed permissions: %v, %v", info.Mode(), err)
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".configdiffignore": "/metadata/*\n!/metadata/name\n[file:*.json]\n/spec\n",
+		"old.yaml":          "metadata:\n  name: a\n  uid: 1\nspec: 1\n",
+		"new.yaml":          "metadata:\n  name: b\n  uid: 2\nspec: 2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldFile, newFile := filepath.Join(tmpDir, "old.yaml"), filepath.Join(tmpDir, "new.yaml")
+
+	paths := func() []string {
+		t.Helper()
+		fd, err := o.diffFiles(oldFile, newFile)
+		if err != nil {
+			t.Fatalf("diffFiles() error = %v", err)
+		}
+		var paths []string
+		for _, c := range fd.result.Changes {
+			paths = append(paths, c.Path)
+		}
+		return paths
+	}
+
+	// The *.json section does not apply to YAML files
+	o.ignorePaths = nil
+	if got, want := paths(), []string{"/metadata/name", "/spec"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+
+	// --ignore comes after the file's rules and wins
+	o.ignorePaths = []string{"/metadata/name", "!/metadata/uid"}
+	if got, want := paths(), []string{"/metadata/uid", "/spec"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changes with --ignore = %v, want %v", got, want)
+	}
+}
+
+func TestGet(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "deploy.yaml")
+	content := "spec:\n  replicas: 2\n  containers:\n    - name: web\n      image: web:1.0\n    - name: sidecar\n      image: proxy:2\n"
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		output string
+		want   string
+		status int
+	}{
+		{"string raw", "/spec/containers[1]/image", "yaml", "proxy:2\n", 0},
+		{"number", "/spec/replicas", "yaml", "2\n", 0},
+		{"object as YAML", "/spec/containers[0]", "yaml", "image: web:1.0\nname: web\n", 0},
+		{"object as JSON", "/spec/containers[0]", "json", "{\n  \"image\": \"web:1.0\",\n  \"name\": \"web\"\n}\n", 0},
+		{"wildcard", "/spec/*/image", "yaml", "/spec/containers[0]/image: \"web:1.0\"\n/spec/containers[1]/image: \"proxy:2\"\n", 0},
+		{"innermost matches", "/spec/*", "yaml", "/spec/containers[0]/image: \"web:1.0\"\n/spec/containers[0]/name: \"web\"\n" +
+			"/spec/containers[1]/image: \"proxy:2\"\n/spec/containers[1]/name: \"sidecar\"\n/spec/replicas: 2\n", 0},
+		{"missing path", "/spec/missing", "yaml", "", 1},
+		{"no wildcard match", "/status/*/ready", "yaml", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.getOutput, o.getFormat = tt.output, "auto"
+			out, err := captureStdout(t, func() error { return o.get(file, tt.path) })
+			if got := exitStatus(err); got != tt.status {
+				t.Fatalf("get() exit status = %d (%v), want %d", got, err, tt.status)
+			}
+			if out != tt.want {
+				t.Errorf("get() = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaths(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "deploy.yaml")
+	content := "spec:\n  replicas: 2\n  containers:\n    - name: web\n      image: nginx:1.25\n    - name: sidecar\n      image: proxy:2\n"
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		values  bool
+		suggest bool
+		want    string
+		status  int
+	}{
+		{"all paths", "", "", false, false, "/spec\n/spec/containers\n/spec/containers[0]\n/spec/containers[0]/image\n" +
+			"/spec/containers[0]/name\n/spec/containers[1]\n/spec/containers[1]/image\n/spec/containers[1]/name\n/spec/replicas\n", 0},
+		{"key", "^image$", "", false, false, "/spec/containers[0]/image\n/spec/containers[1]/image\n", 0},
+		{"key and value", "image", "nginx", false, false, "/spec/containers[0]/image\n", 0},
+		{"number value", "", "^2$", true, false, "/spec/replicas: 2\n", 0},
+		{"with values", "name", "", true, false, "/spec/containers[0]/name: \"web\"\n/spec/containers[1]/name: \"sidecar\"\n", 0},
+		{"suggest ignore", "^containers$", "", false, true, "-i '/spec/containers'\n", 0},
+		{"no match", "status", "", false, false, "", 1},
+		{"invalid regex", "(", "", false, false, "", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.pathsKeyRegex, o.pathsValueRegex, o.pathsValues, o.pathsSuggest, o.pathsFormat = tt.key, tt.value, tt.values, tt.suggest, "auto"
+			out, err := captureStdout(t, func() error { return o.paths(file) })
+			if got := exitStatus(err); got != tt.status {
+				t.Fatalf("paths() exit status = %d (%v), want %d", got, err, tt.status)
+			}
+			if out != tt.want {
+				t.Errorf("paths() = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"app.toml":   "name = \"web\"\n\n[server]\nport = 8080\n",
+		"ports.yaml": "ports:\n  80: http\n",
+		"multi.yaml": "a: 1\n---\nb: 2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		to      string
+		want    string
+		wantErr string
+	}{
+		{"toml to yaml", "app.toml", "yaml", "name: web\nserver:\n  port: 8080\n", ""},
+		{"non-string keys to json", "ports.yaml", "json", "{\n  \"ports\": {\n    \"80\": \"http\"\n  }\n}\n", ""},
+		{"documents to json array", "multi.yaml", "json", "[\n  {\n    \"a\": 1\n  },\n  {\n    \"b\": 2\n  }\n]\n", ""},
+		{"documents to yaml", "multi.yaml", "yaml", "a: 1\n---\nb: 2\n", ""},
+		{"documents to toml", "multi.yaml", "toml", "", "has 2 YAML documents"},
+		{"to hcl", "app.toml", "hcl", "", "HCL can only be read"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.convertTo, o.convertFormat, o.convertOutput = tt.to, "auto", ""
+			out, err := captureStdout(t, func() error { return o.convert(filepath.Join(tmpDir, tt.file)) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("convert() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convert() error = %v", err)
+			}
+			if out != tt.want {
+				t.Errorf("convert() = %q, want %q", out, tt.want)
+			}
+		})
+	}
+
+	o.convertTo, o.convertOutput = "json", filepath.Join(tmpDir, "app.json")
+	if err := o.convert(filepath.Join(tmpDir, "app.toml")); err != nil {
+		t.Fatalf("convert() error = %v", err)
+	}
+	data, err := os.ReadFile(o.convertOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"name\": \"web\",\n  \"server\": {\n    \"port\": 8080\n  }\n}\n"; string(data) != want {
+		t.Errorf("--output file = %q, want %q", data, want)
+	}
+}
+
+func TestLayer(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"base.yaml":   "replicas: 1\ncontainers:\n  - name: web\n    image: web:1\n",
+		"prod.yaml":   "replicas: 3\ncontainers:\n  - name: web\n    image: web:2\n  - name: proxy\n    image: proxy:1\n",
+		"debug.json":  "{\"replicas\": \"many\"}\n",
+		"layers.txt":  "# base first\nbase.yaml\n\nprod.yaml\n",
+		"remove.yaml": "replicas: null\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		files   []string
+		arrays  string
+		keys    []string
+		nulls   bool
+		strict  bool
+		list    string
+		to      string
+		want    string
+		wantErr string
+	}{
+		{"arrays replace", []string{"base.yaml", "prod.yaml"}, "replace", nil, false, false, "", "",
+			"containers:\n  - image: web:2\n    name: web\n  - image: proxy:1\n    name: proxy\nreplicas: 3\n", ""},
+		{"arrays concat", []string{"base.yaml", "prod.yaml"}, "concat", nil, false, false, "", "",
+			"containers:\n  - image: web:1\n    name: web\n  - image: web:2\n    name: web\n  - image: proxy:1\n    name: proxy\nreplicas: 3\n", ""},
+		{"arrays merge by key", []string{"base.yaml", "prod.yaml"}, "merge-by-key", []string{"/containers=name"}, false, false, "", "",
+			"containers:\n  - image: web:2\n    name: web\n  - image: proxy:1\n    name: proxy\nreplicas: 3\n", ""},
+		{"layers file and --to", []string{"remove.yaml"}, "replace", nil, true, false, "layers.txt", "json",
+			"{\n  \"containers\": [\n    {\n      \"image\": \"web:2\",\n      \"name\": \"web\"\n    },\n" +
+				"    {\n      \"image\": \"proxy:1\",\n      \"name\": \"proxy\"\n    }\n  ]\n}\n", ""},
+		{"kind conflict warns", []string{"base.yaml", "debug.json"}, "replace", nil, false, false, "", "",
+			"containers:\n  - image: web:1\n    name: web\nreplicas: many\n", ""},
+		{"strict merge", []string{"base.yaml", "debug.json"}, "replace", nil, false, true, "", "", "", "string at /replicas replaces number"},
+		{"one file", []string{"base.yaml"}, "replace", nil, false, false, "", "", "", "at least two files"},
+		{"invalid arrays", []string{"base.yaml", "prod.yaml"}, "append", nil, false, false, "", "", "", "invalid --arrays"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.layerOutput, o.layerTo, o.layerFormat, o.layerArrays = "", tt.to, "auto", tt.arrays
+			o.layerArrayKeys, o.layerNulls, o.layerStrict, o.layerFile = tt.keys, tt.nulls, tt.strict, tt.list
+			out, err := captureStdout(t, func() error { return o.layer(tt.files) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("layer() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("layer() error = %v", err)
+			}
+			if out != tt.want {
+				t.Errorf("layer() = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrowser(t *testing.T) {
+	entries := []browseEntry{
+		{BrowseItem: report.BrowseItem{Change: diff.Change{Type: diff.ChangeTypeModify, Path: "/spec/replicas"},
+			Group: "spec/", Line: "~ /spec/replicas: 1 → 2", Details: []string{"old: 1", "new: 2"}}},
+		{BrowseItem: report.BrowseItem{Change: diff.Change{Type: diff.ChangeTypeAdd, Path: "/spec/image"},
+			Group: "spec/", Line: "+ /spec/image = \"web\"", Details: []string{"new: web"}}},
+		{BrowseItem: report.BrowseItem{Change: diff.Change{Type: diff.ChangeTypeRemove, Path: "/debug"},
+			Group: "/", Line: "- /debug (was: true)", Details: []string{"old: true"}}},
+	}
+	// screen returns the rows of the view without escape sequences
+	screen := func(b *browser, width, height int) []string {
+		view := regexp.MustCompile("\x1b\\[[0-9;?]*[A-Za-z]").ReplaceAllString(b.view(width, height), "")
+		return strings.Split(view, "\r\n")
+	}
+
+	b := newBrowser(entries)
+	want := []string{"spec/ (2 changes)", "  > ~ /spec/replicas: 1 → 2", "    + /spec/image = \"web\"", "/ (1 change)", "    - /debug (was: true)", "",
+		"3 of 3 changes  up/down move  enter expand  / filter  t type  q quit"}
+	if got := screen(b, 80, 7); !reflect.DeepEqual(got, want) {
+		t.Errorf("view() =\n%q\nwant\n%q", got, want)
+	}
+
+	// Expanding shows the full values; the list scrolls to keep the cursor in sight
+	b.update("enter")
+	b.update("down")
+	b.update("down")
+	got := screen(b, 12, 5)
+	want = []string{"        new:", "    + /spec/", "/ (1 change)", "  > - /debug", "3 of 3 chang"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("view() after expanding and scrolling =\n%q\nwant\n%q", got, want)
+	}
+
+	// Filtering by path and cycling types narrow the list
+	for _, key := range []string{"/", "s", "p", "x", "backspace", "enter"} {
+		b.update(key)
+	}
+	if got := b.visible(); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("visible() with filter %q = %v, want [0 1]", b.filter, got)
+	}
+	b.update("t")
+	if got := b.visible(); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("visible() with type %s = %v, want [1]", browseTypes[b.types], got)
+	}
+	b.update("esc")
+	b.update("t")
+	if got := b.visible(); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("visible() with type %s = %v, want [2]", browseTypes[b.types], got)
+	}
+
+	if !b.update("q") {
+		t.Error("update(\"q\") did not quit")
+	}
+}
+
+func TestValidateInteractive(t *testing.T) {
+	o := testOptions(t)
+
+	o.interactive = true
+	// Tests do not run on a terminal
+	if err := o.validateInteractive(); err == nil || !strings.Contains(err.Error(), "requires a terminal") {
+		t.Errorf("validateInteractive() = %v, want a terminal error", err)
+	}
+	o.quiet = quietMessages
+	if err := o.validateInteractive(); err == nil || !strings.Contains(err.Error(), "requires a terminal") {
+		t.Errorf("validateInteractive() with -q = %v, want a terminal error", err)
+	}
+	o.quiet = quietAll
+	if err := o.validateInteractive(); err == nil || !strings.Contains(err.Error(), "-qq") {
+		t.Errorf("validateInteractive() with -qq = %v, want a conflict error", err)
+	}
+}
+
+func TestPagerCommand(t *testing.T) {
+	o := testOptions(t)
+	t.Setenv("PAGER", "more")
+	t.Setenv("CONFIGDIFF_PAGER", "less -S")
+	if got := pagerCommand(); got != "less -S" {
+		t.Errorf("pagerCommand() = %q, want $CONFIGDIFF_PAGER", got)
+	}
+	t.Setenv("CONFIGDIFF_PAGER", "")
+	if got := pagerCommand(); got != "" {
+		t.Errorf("pagerCommand() with an empty $CONFIGDIFF_PAGER = %q, want it empty", got)
+	}
+	os.Unsetenv("CONFIGDIFF_PAGER")
+	if got := pagerCommand(); got != "more" {
+		t.Errorf("pagerCommand() = %q, want $PAGER", got)
+	}
+	t.Setenv("PAGER", "")
+	if got := pagerCommand(); got != defaultPager {
+		t.Errorf("pagerCommand() = %q, want %q", got, defaultPager)
+	}
+
+	// Tests do not run on a terminal, so output is never paged
+	if o.usePager() {
+		t.Error("usePager() = true without a terminal")
+	}
+}
+
+func TestShowPaged(t *testing.T) {
+	o := testOptions(t)
+	show := func(input string) string {
+		t.Helper()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		o.showPaged(strings.NewReader(input), w, 3, "sed s/^/P:/")
+		w.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	if got, want := show("a\nb\n"), "a\nb\n"; got != want {
+		t.Errorf("showPaged() of short output = %q, want %q", got, want)
+	}
+	if got, want := show("a\nb\nc\nd\n"), "P:a\nP:b\nP:c\nP:d\n"; got != want {
+		t.Errorf("showPaged() of long output = %q, want %q", got, want)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.yaml")
+	newFile := filepath.Join(tmpDir, "new.yaml")
+	oldContent := "spec:\n  replicas: 2\n  template:\n    image: web:1\n    ports: [80, 443]\n  containers:\n  - image: web:1\n    port: 80\nmeta:\n  name: a\n"
+	newContent := "spec:\n  replicas: 3\n  template:\n    image: web:2\n    ports: [80]\n  containers:\n  - image: web:2\n    port: 81\n  extra: 1\nmeta:\n  name: a\n"
+	if err := os.WriteFile(oldFile, []byte(oldContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte(newContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	o.noColor = true
+
+	tests := []struct {
+		name     string
+		selects  []string
+		absolute bool
+		output   string
+		ignore   []string
+		want     []string
+		notWant  []string
+		changes  bool
+		wantErr  string
+	}{
+		{
+			name:    "paths relative to the selection",
+			selects: []string{"spec/template/"},
+			output:  "compact",
+			want:    []string{"~ /image\n", "- /ports[1]\n"},
+			notWant: []string{"replicas", "==="},
+			changes: true,
+		},
+		{
+			name:    "ignore paths are relative to the selection",
+			selects: []string{"/spec/template"},
+			output:  "compact",
+			ignore:  []string{"/image"},
+			want:    []string{"- /ports[1]\n"},
+			notWant: []string{"/image"},
+			changes: true,
+		},
+		{
+			name:    "array element with its index as a segment",
+			selects: []string{"/spec/containers/0"},
+			output:  "compact",
+			ignore:  []string{"/port"},
+			want:    []string{"~ /image\n"},
+			notWant: []string{"/port", "[0]"},
+			changes: true,
+		},
+		{
+			name:    "array element with its index in brackets",
+			selects: []string{"/spec/containers[0]"},
+			output:  "compact",
+			ignore:  []string{"/port"},
+			want:    []string{"~ /image\n"},
+			notWant: []string{"/port", "[0]"},
+			changes: true,
+		},
+		{
+			name:     "absolute paths of an array element",
+			selects:  []string{"/spec/containers/0"},
+			absolute: true,
+			output:   "patch",
+			want:     []string{`"path": "/spec/containers[0]/image"`},
+			changes:  true,
+		},
+		{
+			name:     "absolute paths",
+			selects:  []string{"/spec/template"},
+			absolute: true,
+			output:   "patch",
+			want:     []string{`"path": "/spec/template/image"`, `"path": "/spec/template/ports[1]"`},
+			changes:  true,
+		},
+		{
+			name:     "absolute unified output shows only the selection",
+			selects:  []string{"/spec/template"},
+			absolute: true,
+			output:   "unified",
+			want:     []string{" spec:\n   template:\n-    image: web:1\n"},
+			notWant:  []string{"replicas", "meta"},
+			changes:  true,
+		},
+		{
+			name:    "sections per selection",
+			selects: []string{"/spec/template", "/meta", "/spec/extra"},
+			output:  "compact",
+			want:    []string{"=== /spec/template ===\n", "=== /meta ===\n", "=== /spec/extra ===\n", "+ /\n"},
+			changes: true,
+		},
+		{
+			name:    "machine formats join selections",
+			selects: []string{"/spec/template", "/spec/extra"},
+			output:  "patch",
+			want:    []string{`"path": "/spec/template/image"`, `"path": "/spec/extra"`},
+			notWant: []string{"==="},
+			changes: true,
+		},
+		{
+			name:    "unchanged selection",
+			selects: []string{"/meta"},
+			output:  "compact",
+		},
+		{
+			name:    "missing on both sides",
+			selects: []string{"/nope"},
+			output:  "compact",
+			wantErr: "--select /nope: path not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.selectPaths, o.absolutePaths, o.outputFormat, o.ignorePaths = tt.selects, tt.absolute, tt.output, tt.ignore
+			var changes bool
+			out, err := captureStdout(t, func() error {
+				var err error
+				changes, err = o.compareFiles(oldFile, newFile)
+				return err
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("compareFiles() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compareFiles() error = %v", err)
+			}
+			if changes != tt.changes {
+				t.Errorf("compareFiles() = %v, want %v", changes, tt.changes)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output missing %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("output contains %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+
+	o.selectPaths = []string{"/spec"}
+	if _, err := o.compare(tmpDir, tmpDir); err == nil {
+		t.Error("compare() of directories with --select succeeded, want an error")
+	}
+}
+
+func TestTemplateDiff(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldFile := filepath.Join(tmpDir, "old.yaml")
+	newFile := filepath.Join(tmpDir, "new.yaml")
+	oldContent := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: old-settings
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    helm.sh/chart: web-1.0.0
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: proxy:1
+      - name: web
+        image: web:1
+`
+	newContent := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    helm.sh/chart: web-1.1.0
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:2
+      - name: sidecar
+        image: proxy:1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`
+	if err := os.WriteFile(oldFile, []byte(oldContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte(newContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	o.outputFormat, o.noColor = "compact", true
+
+	var changes bool
+	out, err := captureStdout(t, func() error {
+		var err error
+		changes, err = o.templateDiff(oldFile, newFile)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("templateDiff() error = %v", err)
+	}
+	if !changes {
+		t.Error("templateDiff() = false, want changes")
+	}
+	for _, want := range []string{
+		"--- configmap/old-settings (removed)",
+		"+++ configmap/settings (added)",
+		"=== deployment.apps/web ===",
+		"~ /spec/template/spec/containers[name=web]/image",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "helm.sh/chart") {
+		t.Errorf("output reports the chart label the preset ignores:\n%s", out)
+	}
+
+	o.helmNoPreset = true
+	out, err = captureStdout(t, func() error {
+		_, err := o.templateDiff(oldFile, newFile)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("templateDiff() with --no-preset error = %v", err)
+	}
+	for _, want := range []string{"helm.sh/chart", "/spec/template/spec/containers[0]/name"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output with --no-preset missing %q:\n%s", want, out)
+		}
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err := o.templateDiff(filepath.Join(tmpDir, "chart"), newFile); err == nil || !strings.Contains(err.Error(), "requires helm") {
+		t.Errorf("templateDiff() of a chart without helm error = %v, want a missing helm error", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "config")
+	snap := filepath.Join(tmpDir, "baseline.snap")
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("app.yaml", "name: app\nreplicas: 2\n")
+	write("nested/db.json", `{"host": "db", "port": 5432}`)
+	write("stable.toml", "level = \"info\"\n")
+
+	o.outputFormat, o.noColor, o.quiet, o.ignorePaths = "compact", true, 0, nil
+
+	if err := o.saveSnapshot(dir, snap); err != nil {
+		t.Fatalf("saveSnapshot() error = %v", err)
+	}
+	if err := o.saveSnapshot(filepath.Join(dir, "app.yaml"), snap); err == nil {
+		t.Error("saveSnapshot() of a file succeeded, want an error")
+	}
+
+	// Nothing has drifted yet, even though the files are read anew
+	_, err := captureStdout(t, func() error {
+		changes, err := o.compareSnapshot(snap, dir)
+		if changes {
+			t.Error("compareSnapshot() right after saving = true, want no changes")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compareSnapshot() error = %v", err)
+	}
+
+	write("app.yaml", "name: app\nreplicas: 3\n")
+	write("extra.yaml", "added: true\n")
+	if err := os.Remove(filepath.Join(dir, "nested", "db.json")); err != nil {
+		t.Fatal(err)
+	}
+	var changes bool
+	out, err := captureStdout(t, func() error {
+		var err error
+		changes, err = o.compareSnapshot(snap, dir)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compareSnapshot() error = %v", err)
+	}
+	if !changes {
+		t.Error("compareSnapshot() = false, want changes")
+	}
+	for _, want := range []string{
+		"=== app.yaml ===",
+		"~ /replicas",
+		"+++ extra.yaml (added)",
+		"--- nested/db.json (removed)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "stable.toml") {
+		t.Errorf("output reports the unchanged file:\n%s", out)
+	}
+
+	// Comparison flags apply to the snapshot diff
+	o.ignorePaths = []string{"/replicas", "/added"}
+	out, err = captureStdout(t, func() error {
+		_, err := o.compareSnapshot(snap, dir)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compareSnapshot() with --ignore error = %v", err)
+	}
+	if strings.Contains(out, "/replicas") {
+		t.Errorf("output with --ignore reports an ignored path:\n%s", out)
+	}
+
+	if _, err := o.compareSnapshot(filepath.Join(dir, "app.yaml"), dir); err == nil || !strings.Contains(err.Error(), "not a snapshot") {
+		t.Errorf("compareSnapshot() of a non-snapshot error = %v, want a not a snapshot error", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old-deploy.yaml", "kind: Deployment\nmetadata:\n  name: web\n  resourceVersion: \"1\"\nspec:\n  template:\n    spec:\n      containers:\n      - name: a\n        image: a:1\n      - name: b\n        image: b:1\n")
+	write("new-deploy.yaml", "kind: Deployment\nmetadata:\n  name: web\n  resourceVersion: \"2\"\nspec:\n  template:\n    spec:\n      containers:\n      - name: b\n        image: b:1\n      - name: a\n        image: a:2\n")
+	write("old-app.yaml", "env: [{name: X, value: 1}, {name: Y, value: 2}]\nport: 80\n")
+	write("new-app.yaml", "env: [{name: Y, value: 2}, {name: X, value: 1}]\nport: 81\ndebug: true\n")
+	write("plan.yaml", `comparisons:
+  - name: deployment
+    old: old-deploy.yaml
+    new: new-deploy.yaml
+    preset: kubernetes
+  - name: app
+    old: old-app.yaml
+    new: new-app.yaml
+    array_keys: [/env=name]
+    ignore: [/port]
+    fail_on: [remove]
+`)
+	plan := filepath.Join(tmpDir, "plan.yaml")
+
+	o.outputFormat, o.noColor, o.quiet, o.failOn = "compact", true, 0, nil
+
+	var changes bool
+	out, err := captureStdout(t, func() error {
+		var err error
+		changes, err = o.compareBatch(plan)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compareBatch() error = %v", err)
+	}
+	if !changes {
+		t.Error("compareBatch() = false, want changes selected by --fail-on")
+	}
+	for _, want := range []string{
+		"=== deployment ===",
+		"~ /spec/template/spec/containers[name=a]/image",
+		"=== app ===",
+		"+ /debug",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"resourceVersion", "/env", "/port"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output reports %q, which the entries' options leave out:\n%s", unwanted, out)
+		}
+	}
+
+	// The deployment fails on --fail-on modify, the app only on its own
+	// fail_on
+	for _, tt := range []struct {
+		failOn []string
+		want   bool
+	}{
+		{[]string{"modify"}, true},
+		{[]string{"add"}, false},
+	} {
+		o.failOn = tt.failOn
+		_, err := captureStdout(t, func() error {
+			changes, err = o.compareBatch(plan)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("compareBatch() error = %v", err)
+		}
+		if changes != tt.want {
+			t.Errorf("compareBatch() with --fail-on %v = %v, want %v", tt.failOn, changes, tt.want)
+		}
+	}
+}
+
+func TestTFPlan(t *testing.T) {
+	o := testOptions(t)
+	plan := filepath.Join("..", "..", "testdata", "tfplan", "plan.json")
+
+	o.outputFormat, o.noColor, o.quiet, o.failOn, o.ignorePaths = "report", true, 0, nil, []string{"/tags_all", "/arn"}
+
+	var changes bool
+	out, err := captureStdout(t, func() error {
+		var err error
+		changes, err = o.reviewTFPlan(plan)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reviewTFPlan() error = %v", err)
+	}
+	if !changes {
+		t.Error("reviewTFPlan() = false, want changes")
+	}
+	for _, want := range []string{
+		"-/+ aws_instance.web (replaced)",
+		"~ /ami",
+		"(known after apply)",
+		"=== aws_db_instance.main ===",
+		"~ /allocated_storage",
+		"+++ module.queue.aws_sqs_queue.jobs (added)",
+		"--- aws_iam_user.legacy (removed)",
+		"1 replaced",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"aws_s3_bucket.logs", "tags_all", "/arn", "hunter2", "correct-horse", "data.aws_caller_identity"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output reports %q:\n%s", unwanted, out)
+		}
+	}
+
+	// --fail-on destroy fails on the replaced and the destroyed resource,
+	// not on updates alone
+	o.failOn = []string{cli.FailOnDestroy}
+	if _, err := captureStdout(t, func() error {
+		changes, err = o.reviewTFPlan(plan)
+		return err
+	}); err != nil {
+		t.Fatalf("reviewTFPlan() error = %v", err)
+	}
+	if !changes {
+		t.Error("reviewTFPlan() with --fail-on destroy = false, want true")
+	}
+
+	updates := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(updates, []byte(`{"format_version": "1.2", "resource_changes": [
+		{"address": "aws_s3_bucket.logs", "change": {"actions": ["update"], "before": {"acl": "private"}, "after": {"acl": "log-delivery-write"}}}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := captureStdout(t, func() error {
+		changes, err = o.reviewTFPlan(updates)
+		return err
+	}); err != nil {
+		t.Fatalf("reviewTFPlan() error = %v", err)
+	}
+	if changes {
+		t.Error("reviewTFPlan() with --fail-on destroy = true for a plan without destroys, want false")
+	}
+}
+
+func TestQuietLevels(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	oldDir, newDir := filepath.Join(tmpDir, "old"), filepath.Join(tmpDir, "new")
+	for path, content := range map[string]string{
+		"old/app.yaml":    "replicas: 1\n",
+		"new/app.yaml":    "replicas: 2\n",
+		"new/extra.yaml":  "debug: true\n",
+		"old/broken.yaml": "a: 1\n",
+		"new/broken.yaml": "a: [\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, path), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o.noColor, o.noRenameDetect = true, true
+
+	run := func(format string, level int) (string, string) {
+		t.Helper()
+		o.outputFormat, o.quiet = format, level
+		stdout, stderr, err := captureOutput(t, func() error {
+			_, err := o.compareDirectories(oldDir, newDir)
+			return err
+		})
+		if err == nil || !strings.Contains(err.Error(), "could not be compared") {
+			t.Fatalf("compareDirectories() error = %v, want the broken file reported", err)
+		}
+		return stdout, stderr
+	}
+
+	// A machine format writes nothing but its output to stdout; headers
+	// and the summary go to stderr
+	stdout, stderr := run("patch", 0)
+	var patch map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &patch); err != nil {
+		t.Errorf("stdout is not a patch: %v\n%s", err, stdout)
+	}
+	for _, want := range []string{"=== app.yaml ===", "+++ extra.yaml (added)", "Summary:", "Error: broken.yaml"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr missing %q:\n%s", want, stderr)
+		}
+	}
+
+	// -q keeps the output and errors, but not the rest of stderr
+	stdout, stderr = run("patch", quietMessages)
+	if !strings.Contains(stdout, `"/replicas"`) {
+		t.Errorf("stdout with -q = %q, want the patch", stdout)
+	}
+	if strings.Contains(stderr, "Summary:") || !strings.Contains(stderr, "Error: broken.yaml") {
+		t.Errorf("stderr with -q = %q, want only the error", stderr)
+	}
+
+	// -qq silences everything
+	if stdout, stderr = run("patch", quietAll); stdout != "" || stderr != "" {
+		t.Errorf("-qq wrote stdout %q and stderr %q, want nothing", stdout, stderr)
+	}
+
+	// A human format keeps its headers and summary on stdout
+	stdout, stderr = run("report", quietMessages)
+	for _, want := range []string{"=== app.yaml ===", "+++ extra.yaml (added)", "Summary:"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("report stdout missing %q:\n%s", want, stdout)
+		}
+	}
+	if strings.Contains(stderr, "Summary:") {
+		t.Errorf("report stderr = %q, want no summary", stderr)
+	}
+}
+
+func TestDirectoryPathsUseSlashes(t *testing.T) {
+	o := testOptions(t)
+	// Paths are built with the OS separator, so that on Windows the
+	// backslashes of filepath.Rel are what gets normalized
+	tmpDir := t.TempDir()
+	oldDir, newDir := filepath.Join(tmpDir, "old"), filepath.Join(tmpDir, "new")
+	for _, dir := range []string{oldDir, newDir} {
+		for _, rel := range []string{filepath.Join("sub", "app.yaml"), "sub0.yaml"} {
+			path := filepath.Join(dir, rel)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			content := "replicas: 1\n"
+			if dir == newDir {
+				content = "replicas: 2\n"
+			}
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	relPaths := []string{"sub0.yaml", filepath.Join("sub", "app.yaml")}
+	sortSlashed(relPaths)
+	if relPaths[0] != filepath.Join("sub", "app.yaml") {
+		t.Errorf("sortSlashed() = %v, want sub/app.yaml first, as '/' sorts before '0'", relPaths)
+	}
+
+	o.noColor = true
+
+	o.outputFormat = "json"
+	out, err := captureStdout(t, func() error {
+		_, err := o.compareDirectories(oldDir, newDir)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compareDirectories() error = %v", err)
+	}
+	var doc report.JSONDirOutput
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	var paths []string
+	for _, f := range doc.Files {
+		paths = append(paths, f.Path)
+	}
+	if want := []string{"sub/app.yaml", "sub0.yaml"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("JSON paths = %v, want %v", paths, want)
+	}
+
+	// Per-file outputs name the files with slashes too
+	o.outputFormat = "unified"
+	out, err = captureStdout(t, func() error {
+		_, err := o.compareDirectories(oldDir, newDir)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("compareDirectories() error = %v", err)
+	}
+	for _, want := range []string{"=== sub/app.yaml ===", filepath.ToSlash(filepath.Join(newDir, "sub", "app.yaml"))} {
+		if !strings.Contains(out, want) {
+			t.Errorf("unified output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestStdinSeparator(t *testing.T) {
+	o := testOptions(t)
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	o.outputFormat, o.noColor = "compact", true
+
+	run := func(input string, args ...string) (string, error) {
+		t.Helper()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdin = r
+		go func() {
+			w.WriteString(input)
+			w.Close()
+		}()
+		return captureStdout(t, func() error {
+			_, err := o.compareArgs(args)
+			return err
+		})
+	}
+
+	o.stdinSeparator = ""
+	if _, err := run("", "-", "-"); err == nil || !strings.Contains(err.Error(), "--stdin-separator") {
+		t.Errorf("compareArgs(- -) error = %v, want a hint about --stdin-separator", err)
+	}
+
+	o.stdinSeparator = "---8<---"
+	out, err := run("replicas: 1\n---8<---\n{\"replicas\": 2}\n", "-", "-")
+	if err != nil {
+		t.Fatalf("compareArgs() error = %v", err)
+	}
+	if !strings.Contains(out, "/replicas") {
+		t.Errorf("output missing the /replicas change:\n%s", out)
+	}
+
+	if _, err := run("replicas: 1\n", "-", "-"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("compareArgs() without the separator error = %v, want it not found", err)
+	}
+	if _, err := run("", "old.yaml", "-"); err == nil || !strings.Contains(err.Error(), "requires") {
+		t.Errorf("compareArgs(old.yaml -) error = %v, want --stdin-separator rejected", err)
+	}
+}
+
+func TestVerboseLogging(t *testing.T) {
+	o := testOptions(t)
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"old/app.yaml":  "replicas: 1\nmetadata: {uid: a}\n",
+		"new/app.yaml":  "replicas: 2\nmetadata: {uid: b}\n",
+		"old/skip.yaml": "a: 1\n",
+		"new/skip.yaml": "a: 2\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, path), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o.outputFormat, o.quiet, o.ignorePaths, o.excludePaths = "patch", 0, []string{"/metadata/*"}, []string{"skip.yaml"}
+
+	run := func() string {
+		t.Helper()
+		_, stderr, err := captureOutput(t, func() error {
+			_, err := o.compareDirectories(filepath.Join(tmpDir, "old"), filepath.Join(tmpDir, "new"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("compareDirectories() error = %v", err)
+		}
+		return stderr
+	}
+
+	o.verbose = false
+	if stderr := run(); strings.Contains(stderr, "level=") {
+		t.Errorf("stderr without --verbose has log events:\n%s", stderr)
+	}
+
+	o.verbose = true
+	stderr := run()
+	for _, want := range []string{
+		`level=DEBUG msg="file excluded"`,
+		`level=INFO msg=parsed file=`,
+		`level=DEBUG msg="ignore rule matched" pattern=/metadata/* paths=1`,
+		`level=INFO msg="diff complete" changes=1`,
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr with --verbose missing %q:\n%s", want, stderr)
+		}
+	}
+}
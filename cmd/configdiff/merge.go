@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the merge command
+const (
+	mergeExitConflicts = exitDifferences
+	mergeExitError     = exitTrouble
+)
+
+// mergeFlags holds the flags of the merge command.
+type mergeFlags struct {
+	// Merge flags
+	mergeOutput         string
+	mergePrefer         string
+	mergeMarkers        bool
+	mergeFormat         string
+	mergeIgnorePaths    []string
+	mergeArrayKeys      []string
+	mergeNumericStrings bool
+	mergeBoolStrings    bool
+}
+
+// newMergeCmd returns the merge command.
+func newMergeCmd(o *options) *cobra.Command {
+	mergeCmd := &cobra.Command{
+		Use:   "merge [flags] <base> <ours> <theirs>",
+		Short: "Three-way merge of configuration files",
+		Long: `Merge the changes made in ours and theirs since their common base.
+
+Changes made on only one side, or identically on both, are merged
+automatically and the result is written in the format of ours. Paths changed
+differently on both sides are conflicts: by default they are listed on stderr
+and nothing is written. With --prefer they are resolved to one side, and with
+--markers they are written between git-style conflict markers.
+
+Ignore paths and array keys work as they do for comparisons: ignored paths
+keep ours, and arrays keyed with --array-key merge element by element, so
+reordering alone never conflicts.
+
+Exit codes: 0 for a clean merge, 1 for conflicts, 2 for errors.
+
+To layer files on top of each other instead, such as a base and environment
+overrides, use "configdiff layer".
+
+To merge YAML in git with configdiff, add to .git/config or ~/.gitconfig:
+
+  [merge "configdiff"]
+      name = configdiff three-way merge
+      driver = configdiff merge --markers -o %A %O %A %B
+
+and to .gitattributes:
+
+  *.yaml merge=configdiff
+  *.yml merge=configdiff`,
+		Example: `  # Merge into a new file
+  configdiff merge base.yaml ours.yaml theirs.yaml -o merged.yaml
+
+  # Resolve conflicts in favor of theirs
+  configdiff merge base.yaml ours.yaml theirs.yaml --prefer theirs
+
+  # Merge Kubernetes containers by name
+  configdiff merge base.yaml ours.yaml theirs.yaml --array-key /spec/containers=name`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.ExactArgs(3)(cmd, args); err != nil {
+				return &exitError{code: mergeExitError, err: err}
+			}
+			return nil
+		},
+		RunE: o.runMerge,
+	}
+
+	mergeCmd.Flags().StringVarP(&o.mergeOutput, "output", "o", "", "Write the merged document to this file instead of stdout")
+	mergeCmd.Flags().StringVar(&o.mergePrefer, "prefer", "", "Resolve conflicts to one side (ours, theirs)")
+	mergeCmd.Flags().BoolVar(&o.mergeMarkers, "markers", false, "Write conflicts between git-style conflict markers")
+	mergeCmd.Flags().StringVarP(&o.mergeFormat, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
+	mergeCmd.Flags().StringSliceVarP(&o.mergeIgnorePaths, "ignore", "i", nil, "Paths to ignore, keeping ours (can be repeated)")
+	mergeCmd.Flags().StringSliceVar(&o.mergeArrayKeys, "array-key", nil, "Array paths to key fields (format: path=key)")
+	mergeCmd.Flags().BoolVar(&o.mergeNumericStrings, "numeric-strings", false, "Coerce numeric strings to numbers")
+	mergeCmd.Flags().BoolVar(&o.mergeBoolStrings, "bool-strings", false, "Coerce bool strings to booleans")
+	mergeCmd.Flags().StringVar(&o.colorMode, "color", "auto", "When to color conflict reports: auto (when stderr is a terminal), always, or never")
+	mergeCmd.Flags().BoolVar(&o.noColor, "no-color", false, "Disable colored conflict reports, same as --color=never")
+	mergeCmd.Flags().BoolVar(&o.noDiscover, "no-discover", false, "Only look for the config file in the current and home directories, not in the directory of the merged files and its parents")
+	mergeCmd.Flags().BoolVar(&o.noMergeConfig, "no-merge-config", false, "Only use the nearest config file found, instead of merging it over the ones further away")
+	mergeCmd.Flags().BoolVar(&o.lenientConfig, "lenient-config", false, "Ignore unknown keys and invalid values in the config file instead of failing")
+	mergeCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &exitError{code: mergeExitError, err: err}
+	})
+
+	return mergeCmd
+}
+
+// runMerge is the entry point for the merge command.
+func (o *options) runMerge(cmd *cobra.Command, args []string) error {
+	o.flagChanged = cmd.Flags().Changed
+	o.discoverConfig(args)
+	if err := o.loadConfig(); err != nil {
+		return &exitError{code: mergeExitError, err: err}
+	}
+	conflicts, err := o.merge(args[0], args[1], args[2])
+	if err != nil {
+		return &exitError{code: mergeExitError, err: err}
+	}
+	if conflicts > 0 {
+		return &exitError{code: mergeExitConflicts, err: fmt.Errorf("merge conflicts in %s", plural(conflicts, "path", "paths"))}
+	}
+	return nil
+}
+
+// merge merges theirs into ours against base and writes the result,
+// returning the number of conflicts left unresolved.
+func (o *options) merge(baseFile, oursFile, theirsFile string) (int, error) {
+	if o.mergePrefer != "" && o.mergePrefer != "ours" && o.mergePrefer != "theirs" {
+		return 0, fmt.Errorf("invalid prefer %q, must be one of: ours, theirs", o.mergePrefer)
+	}
+	if o.mergePrefer != "" && o.mergeMarkers {
+		return 0, fmt.Errorf("--prefer and --markers cannot be used together")
+	}
+	if _, err := cli.ParseColorMode(o.colorMode); err != nil {
+		return 0, err
+	}
+
+	cliOpts := cli.CLIOptions{
+		Format:         o.mergeFormat,
+		IgnorePaths:    o.mergeIgnorePaths,
+		ArrayKeys:      o.mergeArrayKeys,
+		NumericStrings: o.mergeNumericStrings,
+		BoolStrings:    o.mergeBoolStrings,
+		Changed:        o.flagChanged,
+	}
+	if o.cfg != nil {
+		cliOpts.ApplyConfigDefaults(o.cfg)
+	}
+	diffOpts, err := cliOpts.ToLibraryOptions()
+	if err != nil {
+		return 0, err
+	}
+
+	// Parse all three inputs; the merged document is written as ours
+	inputs := []string{baseFile, oursFile, theirsFile}
+	nodes := make([]*tree.Node, len(inputs))
+	var oursFormat parse.Format
+	for i, path := range inputs {
+		input, err := cli.ReadInput(path, o.mergeFormat)
+		if err != nil {
+			return 0, err
+		}
+		nodes[i], err = parse.Parse(input.Data, parse.Format(input.Format))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if i == 1 {
+			oursFormat = parse.Format(input.Format)
+		}
+	}
+
+	result, err := configdiff.Diff3(nodes[0], nodes[1], nodes[2], diffOpts)
+	if err != nil {
+		return 0, fmt.Errorf("merge failed: %w", err)
+	}
+
+	var out []byte
+	unresolved := 0
+	switch {
+	case !result.HasConflicts() || o.mergePrefer == "ours":
+		out, err = parse.Marshal(result.PreferOurs, oursFormat)
+	case o.mergePrefer == "theirs":
+		out, err = parse.Marshal(result.PreferTheirs, oursFormat)
+	case o.mergeMarkers:
+		var oursDoc, theirsDoc []byte
+		if oursDoc, err = parse.Marshal(result.PreferOurs, oursFormat); err == nil {
+			theirsDoc, err = parse.Marshal(result.PreferTheirs, oursFormat)
+		}
+		out = []byte(report.GenerateConflictMarkers(string(oursDoc), string(theirsDoc), oursFile, theirsFile))
+		unresolved = len(result.Conflicts)
+	default:
+		// Nothing is written; the conflict report below is the output
+		unresolved = len(result.Conflicts)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write merged document as %s: %w", oursFormat, err)
+	}
+
+	if result.HasConflicts() {
+		_, maxValueLength := o.outputDefaults()
+		fmt.Fprint(os.Stderr, report.GenerateConflicts(result.Conflicts, oursFile, theirsFile, report.Options{
+			NoColor:         cli.ColorDisabled(cli.ResolveColorMode(o.colorMode, o.noColor), os.Stderr),
+			MaxValueLength:  maxValueLength,
+			MaxPathSegments: report.DefaultMaxPathSegments,
+		}))
+		if o.mergePrefer != "" {
+			fmt.Fprintf(os.Stderr, "Resolved to %s.\n", o.mergePrefer)
+		}
+	}
+
+	if out != nil {
+		if o.mergeOutput != "" {
+			if err := os.WriteFile(o.mergeOutput, out, 0644); err != nil {
+				return 0, fmt.Errorf("failed to write %s: %w", o.mergeOutput, err)
+			}
+		} else if _, err := os.Stdout.Write(out); err != nil {
+			return 0, fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+
+	return unresolved, nil
+}
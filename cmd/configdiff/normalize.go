@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/spf13/cobra"
+)
+
+// normalizeFlags holds the flags of the normalize command.
+type normalizeFlags struct {
+	// Normalize flags
+	normalizeTo      string
+	normalizeFormat  string
+	normalizeInPlace bool
+}
+
+// newNormalizeCmd returns the normalize command.
+func newNormalizeCmd(o *options) *cobra.Command {
+	normalizeCmd := &cobra.Command{
+		Use:   "normalize [flags] <file>",
+		Short: "Rewrite a configuration file in canonical form",
+		Long: `Parse a configuration file and write it back in canonical form: object keys
+sorted, two-space indentation, consistent quoting, and numbers normalized, so
+1.0 and 1e0 are both written as 1. Multi-line strings are kept as block
+scalars in YAML. This is the document configdiff compares, and normalizing a
+normalized file leaves it unchanged.
+
+The result is written to stdout, or back to the file with --in-place, in the
+file's format unless --to converts it. HCL files can only be written as
+another format.`,
+		Example: `  # See what configdiff sees
+  configdiff normalize deploy.yaml
+
+  # Normalize in place, e.g. in a pre-commit hook
+  configdiff normalize --in-place deploy.yaml
+
+  # Convert YAML to JSON
+  configdiff normalize --to json deploy.yaml > deploy.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.runNormalize,
+	}
+
+	normalizeCmd.Flags().StringVar(&o.normalizeTo, "to", "", "Output format (yaml, json, toml); defaults to the input format")
+	normalizeCmd.Flags().StringVarP(&o.normalizeFormat, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
+	normalizeCmd.Flags().BoolVar(&o.normalizeInPlace, "in-place", false, "Rewrite the file atomically if it is not already normalized")
+	_ = normalizeCmd.RegisterFlagCompletionFunc("to", cobra.FixedCompletions(
+		[]string{string(parse.FormatYAML), string(parse.FormatJSON), string(parse.FormatTOML)}, cobra.ShellCompDirectiveNoFileComp))
+
+	return normalizeCmd
+}
+
+// runNormalize is the entry point for the normalize command.
+func (o *options) runNormalize(cmd *cobra.Command, args []string) error {
+	return o.normalize(args[0])
+}
+
+// normalize writes path in canonical form.
+func (o *options) normalize(path string) error {
+	if o.normalizeInPlace && path == "-" {
+		return fmt.Errorf("--in-place requires a file, not stdin")
+	}
+
+	input, err := cli.ReadInput(path, o.normalizeFormat)
+	if err != nil {
+		return err
+	}
+	to := parse.Format(input.Format)
+	if o.normalizeTo != "" {
+		to = parse.Format(o.normalizeTo)
+	}
+	if o.normalizeInPlace && to != parse.Format(input.Format) {
+		return fmt.Errorf("--in-place cannot convert %s to %s; redirect stdout to a new file instead", input.Format, to)
+	}
+
+	node, err := parse.Parse(input.Data, parse.Format(input.Format))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	out, err := parse.Marshal(node, to)
+	if err != nil {
+		return fmt.Errorf("failed to write %s as %s: %w", path, to, err)
+	}
+
+	if !o.normalizeInPlace {
+		if _, err := os.Stdout.Write(out); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
+	// Leave normalized files untouched, keeping their modification time
+	if bytes.Equal(out, input.Data) {
+		return nil
+	}
+	return writeFileAtomic(path, out)
+}
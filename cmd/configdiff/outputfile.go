@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Levels of --quiet
+const (
+	// quietMessages, -q, silences messages on stderr but keeps the output.
+	quietMessages = 1
+
+	// quietAll, -qq, silences the output as well.
+	quietAll = 2
+)
+
+// stdout returns where formatted output goes: the --output-file being
+// written, the pager, or standard output. Nothing else is written there;
+// messages go to stderr, see messages and errorOutput.
+func (o *options) stdout() *os.File {
+	if o.outputTemp != nil {
+		return o.outputTemp
+	}
+	if o.paging != nil {
+		return o.paging.w
+	}
+	return os.Stdout
+}
+
+// messages returns where progress, per-file headers, summaries, and
+// warnings go: stderr, or nowhere with -q.
+func (o *options) messages() io.Writer {
+	if o.quiet >= quietMessages {
+		return io.Discard
+	}
+	if o.messagesTo != nil {
+		return o.messagesTo
+	}
+	return os.Stderr
+}
+
+// withMessages returns a copy of o whose messages, including the log of
+// --verbose, go to w, e.g. to hold those of a file compared concurrently
+// until the files before it are reported.
+func (o *options) withMessages(w io.Writer) *options {
+	c := *o
+	c.messagesTo = w
+	return &c
+}
+
+// errorOutput returns where errors that do not stop a comparison go, e.g. a
+// file of a directory that does not parse: stderr, or nowhere with -qq.
+// Errors that stop it are always reported.
+func (o *options) errorOutput() io.Writer {
+	if o.quiet >= quietAll {
+		return io.Discard
+	}
+	return os.Stderr
+}
+
+// logger returns the logger of --verbose, which writes the events of the
+// comparison as text to stderr like messages, or nil without --verbose.
+func (o *options) logger() *slog.Logger {
+	if !o.verbose {
+		return nil
+	}
+	return slog.New(slog.NewTextHandler(o.messages(), &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// terminal returns the file formatted output is finally shown on, to decide
+// on colors and width: the --output-file being written, or standard output,
+// also when output goes through the pager.
+func (o *options) terminal() *os.File {
+	if o.outputTemp != nil {
+		return o.outputTemp
+	}
+	return os.Stdout
+}
+
+// openOutput directs formatted output to a temporary file next to path, so
+// that path is only replaced once the output is complete. An empty path or
+// "-" means standard output.
+func (o *options) openOutput(path string) error {
+	if path == "" || path == "-" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	o.outputTemp = tmp
+	return nil
+}
+
+// commitOutput renames the output written since openOutput to path, keeping
+// the permissions of a file it replaces. It does nothing for standard output.
+func (o *options) commitOutput(path string) error {
+	tmp := o.outputTemp
+	if tmp == nil {
+		return nil
+	}
+	o.outputTemp = nil
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions of %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// discardOutput removes a partially written output file, leaving any
+// existing file at the --output-file path untouched.
+func (o *options) discardOutput() {
+	if o.outputTemp == nil {
+		return
+	}
+	o.outputTemp.Close()
+	os.Remove(o.outputTemp.Name())
+	o.outputTemp = nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"golang.org/x/term"
+)
+
+// defaultPager is the pager used when neither CONFIGDIFF_PAGER nor PAGER is
+// set: less, passing colors through and leaving output that fits on screen.
+const defaultPager = "less -FRX"
+
+// pagedOutput is output on its way to the terminal through the pager.
+type pagedOutput struct {
+	w    *os.File      // write end of the pipe formatted output goes to
+	done chan struct{} // closed once the output has been shown
+}
+
+// pagerCommand returns the pager command line: $CONFIGDIFF_PAGER, even when
+// empty, then $PAGER, then less.
+func pagerCommand() string {
+	if command, ok := os.LookupEnv("CONFIGDIFF_PAGER"); ok {
+		return command
+	}
+	if command := os.Getenv("PAGER"); command != "" {
+		return command
+	}
+	return defaultPager
+}
+
+// usePager reports whether the output of a comparison should be paged: it
+// is human-readable and shown on a terminal, and no pager is turned off.
+func (o *options) usePager() bool {
+	format, _ := o.outputDefaults()
+	if o.noPager || o.quiet >= quietAll || o.interactive || o.outputFile != "" || !cli.IsPagedFormat(format) {
+		return false
+	}
+	if command := strings.TrimSpace(pagerCommand()); command == "" || command == "cat" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// startPager directs formatted output through the pager when usePager says
+// so. Output that fits on the terminal is still written directly.
+func (o *options) startPager() error {
+	if !o.usePager() {
+		return nil
+	}
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height <= 0 {
+		return nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to start pager: %w", err)
+	}
+
+	p := &pagedOutput{w: w, done: make(chan struct{})}
+	out, command := os.Stdout, pagerCommand()
+	go func() {
+		defer close(p.done)
+		defer r.Close()
+		o.showPaged(r, out, height, command)
+	}()
+	o.paging = p
+	return nil
+}
+
+// stopPager ends the output and waits until the pager, if one was started,
+// has exited, so that the exit status is only set afterwards.
+func (o *options) stopPager() {
+	p := o.paging
+	if p == nil {
+		return
+	}
+	o.paging = nil
+	p.w.Close()
+	<-p.done
+	signal.Reset(os.Interrupt)
+}
+
+// showPaged copies output from r to out, through the pager command once the
+// output has as many lines as the terminal is high. Output the pager no
+// longer reads, after it is quit, is discarded.
+func (o *options) showPaged(r io.Reader, out *os.File, height int, command string) {
+	in := bufio.NewReader(r)
+	var head bytes.Buffer
+	for lines := 0; lines < height; lines++ {
+		line, err := in.ReadBytes('\n')
+		head.Write(line)
+		if err != nil {
+			out.Write(head.Bytes())
+			return
+		}
+	}
+
+	args := strings.Fields(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = out, os.Stderr
+	// Like git, let less pass colors through and quit on short output
+	// unless configured otherwise
+	cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	pipe, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		fmt.Fprintf(o.messages(), "Warning: failed to start pager %q: %v\n", command, err)
+		out.Write(head.Bytes())
+		io.Copy(out, in)
+		return
+	}
+	// Ctrl-C is for the pager, which restores the terminal when it exits
+	signal.Ignore(os.Interrupt)
+
+	if _, err := io.Copy(pipe, io.MultiReader(&head, in)); err != nil {
+		io.Copy(io.Discard, in)
+	}
+	pipe.Close()
+	cmd.Wait()
+}
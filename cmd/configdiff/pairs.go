@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/report"
+)
+
+// compareGlobs compares the files matching two glob patterns, pairing them
+// by their path below each pattern's first wildcard: for "env/prod/*.yaml",
+// by file name. Files without a counterpart are reported as added or removed.
+// Returns true if any changes were found, false otherwise.
+func (o *options) compareGlobs(oldPattern, newPattern string) (bool, error) {
+	if !cli.IsGlob(oldPattern) || !cli.IsGlob(newPattern) {
+		return false, fmt.Errorf("cannot compare pattern with path: both %q and %q must be glob patterns", oldPattern, newPattern)
+	}
+
+	oldRoot, oldFiles, err := cli.ExpandGlob(oldPattern)
+	if err != nil {
+		return false, err
+	}
+	newRoot, newFiles, err := cli.ExpandGlob(newPattern)
+	if err != nil {
+		return false, err
+	}
+	if len(oldFiles) == 0 && len(newFiles) == 0 {
+		return false, fmt.Errorf("no files match %q or %q", oldPattern, newPattern)
+	}
+
+	pairsByPath := make(map[string]*filePair)
+	pair := func(relPath string) *filePair {
+		if p, ok := pairsByPath[relPath]; ok {
+			return p
+		}
+		p := &filePair{label: filepath.ToSlash(relPath)}
+		pairsByPath[relPath] = p
+		return p
+	}
+	for _, relPath := range oldFiles {
+		pair(relPath).oldPath = filepath.Join(oldRoot, relPath)
+	}
+	for _, relPath := range newFiles {
+		pair(relPath).newPath = filepath.Join(newRoot, relPath)
+	}
+
+	relPaths := make([]string, 0, len(pairsByPath))
+	for relPath := range pairsByPath {
+		relPaths = append(relPaths, relPath)
+	}
+	sortSlashed(relPaths)
+	pairs := make([]filePair, 0, len(relPaths))
+	for _, relPath := range relPaths {
+		pairs = append(pairs, *pairsByPath[relPath])
+	}
+
+	return o.comparePairs(report.DirResult{OldDir: oldPattern, NewDir: newPattern}, pairs)
+}
+
+// compareFileList compares the pairs of files listed in a --pairs file.
+// Returns true if any changes selected by --fail-on were found, false otherwise.
+func (o *options) compareFileList(pairsFile string) (bool, error) {
+	pairs, err := readPairs(pairsFile)
+	if err != nil {
+		return false, err
+	}
+	return o.comparePairs(report.DirResult{OldDir: pairsFile, NewDir: pairsFile}, pairs)
+}
+
+// readPairs reads a --pairs file of "old<TAB>new" lines. Blank lines and
+// lines starting with # are skipped; an empty side marks a file that only
+// exists on the other side.
+func readPairs(path string) ([]filePair, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pairs file: %w", err)
+	}
+	defer f.Close()
+
+	var pairs []filePair
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		oldPath, newPath, ok := strings.Cut(text, "\t")
+		oldPath, newPath = strings.TrimSpace(oldPath), strings.TrimSpace(newPath)
+		if !ok || (oldPath == "" && newPath == "") || strings.Contains(newPath, "\t") {
+			return nil, fmt.Errorf("%s:%d: expected \"old<TAB>new\"", path, line)
+		}
+
+		label := filepath.ToSlash(newPath)
+		if label == "" {
+			label = filepath.ToSlash(oldPath)
+		}
+		pairs = append(pairs, filePair{label: label, oldPath: oldPath, newPath: newPath})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pairs file: %w", err)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("pairs file %s lists no files", path)
+	}
+	return pairs, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+)
+
+// pathsFlags holds the flags of the paths command.
+type pathsFlags struct {
+	// Paths flags
+	pathsKeyRegex   string
+	pathsValueRegex string
+	pathsValues     bool
+	pathsSuggest    bool
+	pathsFormat     string
+}
+
+// newPathsCmd returns the paths command.
+func newPathsCmd(o *options) *cobra.Command {
+	pathsCmd := &cobra.Command{
+		Use:     "paths [flags] <file>",
+		Aliases: []string{"grep"},
+		Short:   "List the paths in a configuration file, optionally filtered by key or value",
+		Long: `Parse a configuration file and list its paths, one per line, in the form
+used by --ignore, --array-key, and get, e.g. /spec/template/spec/containers[0].
+
+--key-regex keeps the paths whose final key matches; array elements have no
+key. --value-regex keeps the paths of scalar values matching it, with strings
+matched as they are and other values as JSON. Given both, a path must match
+both. Without either, every path is listed.
+
+--values prints each path with its value as compact JSON, and
+--suggest-ignore prints each as an -i flag, quoted for the shell, to paste
+into a configdiff command line.
+
+Exit status is 0 if any path matches, 1 if none does, and 2 on errors.`,
+		Example: `  # Find the images in a manifest
+  configdiff paths deploy.yaml --key-regex '^image$' --values
+
+  # Find where nginx is used
+  configdiff grep deploy.yaml --value-regex nginx
+
+  # Build --ignore flags for every timestamp
+  configdiff paths deploy.yaml --key-regex 'Timestamp$' --suggest-ignore`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.runPaths,
+	}
+
+	pathsCmd.Flags().StringVar(&o.pathsKeyRegex, "key-regex", "", "List paths whose final key matches this regular expression")
+	pathsCmd.Flags().StringVar(&o.pathsValueRegex, "value-regex", "", "List paths whose scalar value matches this regular expression")
+	pathsCmd.Flags().BoolVar(&o.pathsValues, "values", false, "Print each path's value as compact JSON")
+	pathsCmd.Flags().BoolVar(&o.pathsSuggest, "suggest-ignore", false, "Print matches as -i flags to paste into a configdiff command")
+	pathsCmd.Flags().StringVarP(&o.pathsFormat, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
+
+	return pathsCmd
+}
+
+// runPaths is the entry point for the paths command.
+func (o *options) runPaths(cmd *cobra.Command, args []string) error {
+	return o.paths(args[0])
+}
+
+// paths lists the paths in file matching --key-regex and --value-regex.
+func (o *options) paths(file string) error {
+	if o.pathsValues && o.pathsSuggest {
+		return fmt.Errorf("--values and --suggest-ignore cannot be used together")
+	}
+	var keyRe, valueRe *regexp.Regexp
+	var err error
+	if o.pathsKeyRegex != "" {
+		if keyRe, err = regexp.Compile(o.pathsKeyRegex); err != nil {
+			return fmt.Errorf("invalid --key-regex %q: %w", o.pathsKeyRegex, err)
+		}
+	}
+	if o.pathsValueRegex != "" {
+		if valueRe, err = regexp.Compile(o.pathsValueRegex); err != nil {
+			return fmt.Errorf("invalid --value-regex %q: %w", o.pathsValueRegex, err)
+		}
+	}
+
+	input, err := cli.ReadInput(file, o.pathsFormat)
+	if err != nil {
+		return err
+	}
+	root, err := parse.Parse(input.Data, parse.Format(input.Format))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	root.SetPaths("/")
+
+	matches := searchPaths(root, keyRe, valueRe)
+	if len(matches) == 0 {
+		return &exitError{code: exitDifferences, err: fmt.Errorf("%s: no paths match", file)}
+	}
+	for _, node := range matches {
+		switch {
+		case o.pathsSuggest:
+			fmt.Fprintf(os.Stdout, "-i %s\n", shellQuote(node.Path))
+		case o.pathsValues:
+			value, err := json.Marshal(node.ToInterface())
+			if err != nil {
+				return fmt.Errorf("failed to format %s: %w", node.Path, err)
+			}
+			fmt.Fprintf(os.Stdout, "%s: %s\n", node.Path, value)
+		default:
+			fmt.Fprintln(os.Stdout, node.Path)
+		}
+	}
+	return nil
+}
+
+// searchPaths returns the nodes below root, in document order, whose final
+// key matches keyRe and whose scalar value matches valueRe. A nil regular
+// expression matches every node.
+func searchPaths(root *tree.Node, keyRe, valueRe *regexp.Regexp) []*tree.Node {
+	var matches []*tree.Node
+	var visit func(key string, keyed bool, n *tree.Node)
+	visit = func(key string, keyed bool, n *tree.Node) {
+		if n != root && matchesKey(key, keyed, keyRe) && matchesValue(n, valueRe) {
+			matches = append(matches, n)
+		}
+		switch n.Kind {
+		case tree.KindObject:
+			for _, k := range n.SortedKeys() {
+				visit(k, true, n.Object[k])
+			}
+		case tree.KindArray:
+			for _, elem := range n.Array {
+				visit("", false, elem)
+			}
+		}
+	}
+	visit("", false, root)
+	return matches
+}
+
+// matchesKey reports whether a node's final key matches re; nodes without
+// a key, the elements of arrays, only match a nil re.
+func matchesKey(key string, keyed bool, re *regexp.Regexp) bool {
+	if re == nil {
+		return true
+	}
+	return keyed && re.MatchString(key)
+}
+
+// matchesValue reports whether a node is a scalar whose value matches re;
+// every node matches a nil re.
+func matchesValue(n *tree.Node, re *regexp.Regexp) bool {
+	if re == nil {
+		return true
+	}
+	switch n.Kind {
+	case tree.KindObject, tree.KindArray:
+		return false
+	case tree.KindString:
+		return re.MatchString(fmt.Sprint(n.Value))
+	default:
+		value, err := json.Marshal(n.ToInterface())
+		return err == nil && re.Match(value)
+	}
+}
+
+// shellQuote quotes s for a POSIX shell, as paths contain brackets and
+// wildcards the shell would expand.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// defaultRenameThreshold is the similarity, in percent, above which a removed
+// and an added file are reported as a rename.
+const defaultRenameThreshold = 50
+
+// validateRenameThreshold checks --rename-threshold.
+func validateRenameThreshold(threshold int) error {
+	if threshold < 0 || threshold > 100 {
+		return fmt.Errorf("invalid --rename-threshold %d, must be between 0 and 100", threshold)
+	}
+	return nil
+}
+
+// detectRenames pairs files present only in the old directory with files
+// present only in the new one whose documents are equal, or whose similarity
+// exceeds --rename-threshold. Each such pair replaces the removed and added
+// entries with a single pair labeled by its new path; the most similar
+// candidates are paired first. Files that cannot be parsed are left as they
+// are, so that comparing them reports the error as usual.
+func (o *options) detectRenames(oldDir, newDir string, pairs []filePair) ([]filePair, error) {
+	removed, added := unpaired(pairs)
+	if len(removed) == 0 || len(added) == 0 {
+		return pairs, nil
+	}
+
+	cliOpts, err := o.cliOptions(oldDir, newDir)
+	if err != nil {
+		return nil, err
+	}
+	type document struct {
+		node   *tree.Node
+		leaves map[string]int
+	}
+	docs := make(map[int]document)
+	for _, i := range removed {
+		if node, err := o.readTree(pairs[i].oldPath, cliOpts.GetOldFormat()); err == nil {
+			docs[i] = document{node, leafCounts(node)}
+		}
+	}
+	for _, i := range added {
+		if node, err := o.readTree(pairs[i].newPath, cliOpts.GetNewFormat()); err == nil {
+			docs[i] = document{node, leafCounts(node)}
+		}
+	}
+
+	type candidate struct {
+		old, new   int
+		similarity float64
+	}
+	var candidates []candidate
+	for _, ri := range removed {
+		for _, ai := range added {
+			a, okA := docs[ri]
+			b, okB := docs[ai]
+			if !okA || !okB {
+				continue
+			}
+			s := similarity(a.leaves, b.leaves)
+			if a.node.Equal(b.node) {
+				s = 1
+			}
+			if s == 1 || s*100 > float64(o.renameThreshold) {
+				candidates = append(candidates, candidate{old: ri, new: ai, similarity: s})
+			}
+		}
+	}
+	// Pairs come in path order, so ties pair files in path order too
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].similarity > candidates[j].similarity
+	})
+
+	matches := make(map[int]int)
+	paired := make(map[int]bool)
+	for _, c := range candidates {
+		if paired[c.old] || paired[c.new] {
+			continue
+		}
+		paired[c.old], paired[c.new] = true, true
+		if o.verbose {
+			fmt.Fprintf(o.messages(), "%s: renamed from %s (similarity %d%%)\n",
+				pairs[c.new].label, pairs[c.old].label, int(c.similarity*100))
+		}
+		matches[c.new] = c.old
+		pairs[c.new].renamed = true
+		pairs[c.new].similarity = c.similarity
+	}
+	return joinPairs(pairs, matches), nil
+}
+
+// matchStems pairs files present only in the old directory with files
+// present only in the new one at the same path without extension, such as
+// config.json and config.yaml, to be compared across formats. A stem shared
+// by more than one such file on either side is ambiguous: its files are
+// left unpaired with a warning.
+func (o *options) matchStems(pairs []filePair) []filePair {
+	removed, added := unpaired(pairs)
+	oldByStem := make(map[string][]int)
+	for _, i := range removed {
+		stem := pathStem(pairs[i].label)
+		oldByStem[stem] = append(oldByStem[stem], i)
+	}
+	newByStem := make(map[string][]int)
+	for _, i := range added {
+		stem := pathStem(pairs[i].label)
+		newByStem[stem] = append(newByStem[stem], i)
+	}
+
+	matches := make(map[int]int)
+	for _, n := range added {
+		stem := pathStem(pairs[n].label)
+		olds, news := oldByStem[stem], newByStem[stem]
+		if len(olds) == 0 || n != news[0] {
+			continue
+		}
+		if len(olds) > 1 || len(news) > 1 {
+			var labels []string
+			for _, i := range append(append([]int{}, olds...), news...) {
+				labels = append(labels, pairs[i].label)
+			}
+			sort.Strings(labels)
+			fmt.Fprintf(o.messages(), "Warning: %s match by stem ambiguously; reporting them as added and removed\n",
+				strings.Join(labels, ", "))
+			continue
+		}
+		matches[n] = olds[0]
+	}
+	return joinPairs(pairs, matches)
+}
+
+// pathStem returns a slash-separated path without its extension.
+func pathStem(p string) string {
+	return strings.TrimSuffix(p, path.Ext(p))
+}
+
+// unpaired returns the indexes of the pairs with only an old file and of
+// those with only a new file, leaving out skipped pairs.
+func unpaired(pairs []filePair) (removed, added []int) {
+	for i, pair := range pairs {
+		switch {
+		case pair.skipped != "":
+		case pair.oldPath != "" && pair.newPath == "":
+			removed = append(removed, i)
+		case pair.newPath != "" && pair.oldPath == "":
+			added = append(added, i)
+		}
+	}
+	return removed, added
+}
+
+// joinPairs merges the old file of each pair matched with a new-only pair,
+// keyed by the index of the new one, into it and drops the old-only pair.
+// The joined pair keeps the new file's label and position.
+func joinPairs(pairs []filePair, matches map[int]int) []filePair {
+	if len(matches) == 0 {
+		return pairs
+	}
+	dropped := make(map[int]bool)
+	for n, o := range matches {
+		pairs[n].oldPath = pairs[o].oldPath
+		pairs[n].oldLabel = pairs[o].label
+		dropped[o] = true
+	}
+	kept := pairs[:0]
+	for i, pair := range pairs {
+		if !dropped[i] {
+			kept = append(kept, pair)
+		}
+	}
+	return kept
+}
+
+// similarity returns the fraction of leaf values shared by two documents:
+// the leaves found in both, with the same path and value, over all distinct
+// leaves of either.
+func similarity(a, b map[string]int) float64 {
+	shared, total := 0, 0
+	for leaf, n := range a {
+		m := b[leaf]
+		shared += min(n, m)
+		total += max(n, m)
+	}
+	for leaf, m := range b {
+		if _, ok := a[leaf]; !ok {
+			total += m
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(shared) / float64(total)
+}
+
+// leafCounts counts the scalar values of a document, and its empty objects
+// and arrays, by path and value.
+func leafCounts(node *tree.Node) map[string]int {
+	counts := make(map[string]int)
+	var walk func(p string, n *tree.Node)
+	walk = func(p string, n *tree.Node) {
+		switch {
+		case n == nil:
+			counts[p+"=null"]++
+		case n.Kind == tree.KindObject && len(n.Object) > 0:
+			for key, child := range n.Object {
+				walk(p+"/"+key, child)
+			}
+		case n.Kind == tree.KindArray && len(n.Array) > 0:
+			for i, child := range n.Array {
+				walk(p+"["+strconv.Itoa(i)+"]", child)
+			}
+		default:
+			counts[fmt.Sprintf("%s=%s:%v", p, n.Kind, n.Value)]++
+		}
+	}
+	walk("", node)
+	return counts
+}
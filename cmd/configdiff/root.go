@@ -2,49 +2,167 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"time"
 
+	"github.com/pfrederiksen/configdiff/internal/cli"
 	"github.com/pfrederiksen/configdiff/internal/config"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/report"
 	"github.com/spf13/cobra"
 )
 
-var (
-	// Global flags
-	format         string
-	oldFormat      string
-	newFormat      string
-	ignorePaths    []string
-	arrayKeys      []string
-	numericStrings bool
-	boolStrings    bool
-	stableOrder    bool
-	outputFormat   string
-	noColor        bool
-	maxValueLength int
-	quiet          bool
-	exitCode       bool
-	recursive      bool
-
-	// Config file loaded at startup
+// options holds the flags of configdiff and its subcommands, and the config
+// file and environment settings they are run with. Each command tree built
+// by newRootCmd binds its flags to an options of its own, so that commands,
+// and tests, do not share state.
+type options struct {
+	// Compare flags
+	format           string
+	oldFormat        string
+	newFormat        string
+	ignorePaths      []string
+	arrayKeys        []string
+	preset           string
+	numericStrings   bool
+	boolStrings      bool
+	stableOrder      bool
+	outputFormat     string
+	colorMode        string
+	noColor          bool
+	maxValueLength   int
+	noCollapse       bool
+	quiet            int // --quiet level, see quietMessages and quietAll
+	interactive      bool
+	noPager          bool
+	exitCode         bool
+	failOn           []string
+	recursive        bool
+	githubComment    bool
+	githubMaxOutput  int
+	githubArtifact   string
+	groupBy          string
+	contextLines     int
+	contextKeys      int
+	width            int
+	maskSecrets      bool
+	maskPaths        []string
+	maskMode         string
+	sortOrder        string
+	filterTypes      []string
+	templateFile     string
+	maxShown         int
+	lineNumbers      bool
+	annotationLevels []string
+	asciiOutput      bool
+	expandValues     bool
+	expandLimit      int
+	fullPaths        bool
+	legend           bool
+	legendSet        bool                   // --legend given explicitly, overriding the per-format default
+	flagChanged      func(name string) bool // reports flags given explicitly, overriding the config file
+	zeroCounts       bool
+	severity         bool
+	valueStyle       string
+	gitOld           string
+	gitNew           string
+	httpHeaders      []string
+	httpTimeout      time.Duration
+	insecure         bool
+	kubeObject       string
+	kubeMatch        bool
+	kubeNamespace    string
+	stripComponents  int
+	pairsFile        string
+	jobs             int
+	timeoutPerFile   time.Duration
+	cacheDir         string
+	noCache          bool
+	cacheMaxAge      time.Duration
+	cacheMaxSize     string
+	outputFile       string
+	excludePaths     []string
+	noDefaultExclude bool
+	noRenameDetect   bool
+	maxFileSize      string
+	maxParseSize     string
+	maxWalkDepth     int
+	followSymlinks   bool
+	matchStem        bool
+	renameThreshold  int
+	verbose          bool
+	selectPaths      []string
+	absolutePaths    bool
+	stdinSeparator   string
+
+	// Config file and environment settings, see loadConfig
 	cfg *config.Config
-)
 
-var rootCmd = &cobra.Command{
-	Use:   "configdiff [flags] <old-file> <new-file>",
-	Short: "Semantic diff for YAML/JSON/HCL configuration files",
-	Long: `configdiff provides semantic, human-grade diffs for configuration files.
+	// Where messages go instead of stderr, see withMessages
+	messagesTo io.Writer
+
+	// The cache of --cache-dir while comparing, see openCache
+	cache *cli.Cache
+
+	// Where formatted output goes while comparing: the temporary file
+	// --output-file writes to until commitOutput renames it into place, and
+	// the output being paged, see startPager
+	outputTemp *os.File
+	paging     *pagedOutput
+
+	// The ignore file found for each directory, or nil, see ignoreFileRules
+	ignoreFiles *sync.Map
+
+	configFlags
+	applyFlags
+	convertFlags
+	getFlags
+	helmFlags
+	layerFlags
+	mergeFlags
+	normalizeFlags
+	pathsFlags
+	snapshotFlags
+}
+
+// newRootCmd returns the configdiff command and its subcommands, with their
+// flags bound to o.
+func newRootCmd(o *options) *cobra.Command {
+	o.ignoreFiles = new(sync.Map)
+	rootCmd := &cobra.Command{
+		Use:   "configdiff [flags] <old-file> <new-file>",
+		Short: "Semantic diff for YAML/JSON/HCL configuration files",
+		Long: `configdiff provides semantic, human-grade diffs for configuration files.
 
 It understands the structure of your configuration and can apply customizable
 rules for semantic comparison, ignore specific paths, treat arrays as sets,
 handle type coercions, and generate both machine-readable patches and
 human-friendly reports.
 
-Use "-" for stdin input (only one file can be stdin).`,
-	Example: `  # Basic comparison
+Use "-" for stdin input. Only one file can be stdin, unless both are and
+--stdin-separator names the line that separates the old document from the
+new one; the format of each is detected on its own. Inputs can also be
+http(s) URLs, fetched with --header, --timeout, and --insecure.
+
+Directories (with --recursive), archives, glob patterns, git revisions, and
+live Kubernetes objects can be compared too; see docs/USAGE.md in the
+configdiff repository.
+
+Exit status is 0 if no differences were found, 1 if --exit-code is set and
+differences were found, and 2 on errors such as bad flags or an unreadable
+or unparsable input, as with diff(1).`,
+		Example: `  # Basic comparison
   configdiff old.yaml new.yaml
 
   # Compare with stdin
   kubectl get deploy myapp -o yaml | configdiff old.yaml -
 
+  # Compare two documents both read from stdin
+  { cat old.yaml; echo '---8<---'; cat new.json; } | configdiff - - --stdin-separator '---8<---'
+
   # Ignore paths
   configdiff old.yaml new.yaml -i /metadata/generation -i /status/*
 
@@ -55,56 +173,300 @@ Use "-" for stdin input (only one file can be stdin).`,
   configdiff old.yaml new.yaml -o compact
   configdiff old.yaml new.yaml -o json
   configdiff old.yaml new.yaml -o patch
+  configdiff old.yaml new.yaml -o markdown
+
+  # Compare a published config with a local file
+  configdiff https://artifacts.example.com/prod/values.yaml values.yaml \
+    --header "Authorization: Bearer $TOKEN"
+
+  # Compare every environment file by name, or an explicit list of pairs
+  configdiff 'env/prod/*.yaml' 'env/staging/*.yaml'
+  configdiff --pairs pairs.txt
+
+  # Compare two Helm chart packages, ignoring the versioned top directory
+  configdiff mychart-1.0.0.tgz mychart-1.1.0.tgz --strip-components 1
+  configdiff 'mychart-1.0.0.tgz!mychart/values.yaml' values.yaml
+
+  # Compare against git revisions
+  configdiff --git HEAD~1 config/values.yaml
+  configdiff 'values.yaml@{HEAD~1}' values.yaml
+  configdiff --git-old v1.2.0 --git-new v1.3.0 -r config/
+
+  # Compare live Kubernetes objects with local manifests
+  configdiff --kube deploy/myapp -n prod local/deploy.yaml
+  configdiff --kube-match -r manifests/
+
+  # Write a SARIF report to a file
+  configdiff old.yaml new.yaml -o sarif -O results.sarif
 
   # Exit code mode for CI
   if configdiff old.yaml new.yaml --exit-code; then
     echo "No changes detected"
   fi`,
-	Args:              cobra.ExactArgs(2),
-	RunE:              runCompare,
-	SilenceUsage:      true,
-	SilenceErrors:     true,
-	DisableAutoGenTag: true,
-}
-
-func init() {
-	// Load config file (errors are ignored - config is optional)
-	cfg, _ = config.Load()
+		Args: func(cmd *cobra.Command, args []string) error {
+			// Pairs come from the pairs file
+			if o.pairsFile != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			// A single manifest is compared with its live object
+			if o.kubeObject != "" || o.kubeMatch {
+				return cobra.ExactArgs(1)(cmd, args)
+			}
+			// A single path is compared with itself at another revision
+			if o.gitOld != "" || o.gitNew != "" {
+				return cobra.RangeArgs(1, 2)(cmd, args)
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE:              o.runCompare,
+		SilenceUsage:      true,
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
 
 	// Format flags
-	rootCmd.Flags().StringVarP(&format, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
-	rootCmd.Flags().StringVar(&oldFormat, "old-format", "", "Old file format override")
-	rootCmd.Flags().StringVar(&newFormat, "new-format", "", "New file format override")
+	rootCmd.Flags().StringVarP(&o.format, "format", "f", "auto", "Input format (yaml, json, hcl, toml, auto)")
+	rootCmd.Flags().StringVar(&o.oldFormat, "old-format", "", "Old file format override")
+	rootCmd.Flags().StringVar(&o.newFormat, "new-format", "", "New file format override")
+
+	// Git revision flags
+	rootCmd.Flags().StringVar(&o.gitOld, "git", "", "Read the old side from this git revision (same as --git-old)")
+	rootCmd.Flags().StringVar(&o.gitOld, "git-old", "", "Read the old side from this git revision")
+	rootCmd.Flags().StringVar(&o.gitNew, "git-new", "", "Read the new side from this git revision")
+
+	// Multiple file flags
+	rootCmd.Flags().StringVar(&o.pairsFile, "pairs", "", "Compare the pairs of files listed in this file, one \"old<TAB>new\" pair per line")
+
+	// Archive flags
+	rootCmd.Flags().IntVar(&o.stripComponents, "strip-components", 0, "Remove N leading directories from file names inside archives")
+
+	// URL input flags
+	rootCmd.Flags().StringArrayVar(&o.httpHeaders, "header", nil, "HTTP header for URL inputs as \"Name: value\" (can be repeated)")
+	rootCmd.Flags().DurationVar(&o.httpTimeout, "timeout", cli.DefaultHTTPTimeout, "Timeout for fetching URL inputs")
+	rootCmd.Flags().BoolVar(&o.insecure, "insecure", false, "Skip TLS certificate verification for URL inputs")
+
+	// Kubernetes flags
+	rootCmd.Flags().StringVar(&o.kubeObject, "kube", "", "Compare the live Kubernetes object KIND/NAME with the local manifest")
+	rootCmd.Flags().BoolVar(&o.kubeMatch, "kube-match", false, "Compare local manifests with the live objects of the same kind, namespace, and name")
+	rootCmd.Flags().StringVarP(&o.kubeNamespace, "namespace", "n", "", "Namespace of live Kubernetes objects (default: the manifest's, then the context's)")
+
+	// Config file flags
+	rootCmd.PersistentFlags().StringVar(&o.configFile, "config", "", "Use this config file only, instead of looking for one; it must exist and load")
+	rootCmd.Flags().BoolVar(&o.noDiscover, "no-discover", false, "Only look for the config file in the current and home directories, not in the directory of the compared files and its parents")
+	rootCmd.Flags().BoolVar(&o.noMergeConfig, "no-merge-config", false, "Only use the nearest config file found, instead of merging it over the ones further away")
+	rootCmd.Flags().BoolVar(&o.lenientConfig, "lenient-config", false, "Ignore unknown keys and invalid values in the config file instead of failing")
 
 	// Diff option flags
-	rootCmd.Flags().StringSliceVarP(&ignorePaths, "ignore", "i", nil, "Paths to ignore (can be repeated)")
-	rootCmd.Flags().StringSliceVar(&arrayKeys, "array-key", nil, "Array paths to key fields (format: path=key)")
-	rootCmd.Flags().BoolVar(&numericStrings, "numeric-strings", false, "Coerce numeric strings to numbers")
-	rootCmd.Flags().BoolVar(&boolStrings, "bool-strings", false, "Coerce bool strings to booleans")
-	rootCmd.Flags().BoolVar(&stableOrder, "stable-order", true, "Sort output deterministically")
+	rootCmd.Flags().StringSliceVarP(&o.ignorePaths, "ignore", "i", nil, "Paths to ignore (can be repeated); also read from .configdiffignore files next to the compared files")
+	rootCmd.Flags().StringSliceVar(&o.arrayKeys, "array-key", nil, "Array paths to key fields (format: path=key)")
+	rootCmd.Flags().StringVar(&o.preset, "preset", "", "Compare with the ignore paths, array keys, and normalization for a kind of file: compose (Docker Compose) or kubernetes")
+	rootCmd.Flags().BoolVar(&o.numericStrings, "numeric-strings", false, "Coerce numeric strings to numbers")
+	rootCmd.Flags().BoolVar(&o.boolStrings, "bool-strings", false, "Coerce bool strings to booleans")
+	rootCmd.Flags().BoolVar(&o.stableOrder, "stable-order", true, "Sort changes by path rather than in the order compared (depth first, keys sorted)")
+	rootCmd.Flags().StringSliceVar(&o.selectPaths, "select", nil, "Only compare the subtree at this path, e.g. /spec/template, with paths relative to it (can be repeated)")
+	rootCmd.Flags().BoolVar(&o.absolutePaths, "absolute-paths", false, "With --select, report paths from the document root instead of the selected subtree")
+	rootCmd.Flags().StringVar(&o.stdinSeparator, "stdin-separator", "", "With \"-\" for both files, read stdin once and split it into the old and new documents at the line equal to this")
 
 	// Output flags
-	rootCmd.Flags().StringVarP(&outputFormat, "output", "o", "report", "Output format (report, compact, json, patch, stat, side-by-side, git-diff)")
-	rootCmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colored output")
-	rootCmd.Flags().IntVar(&maxValueLength, "max-value-length", 80, "Truncate values longer than N chars (0 = no limit)")
-	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Quiet mode (no output)")
-	rootCmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with code 1 if differences found")
-	rootCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Recursively compare directories")
-
-	// Add version command
-	rootCmd.AddCommand(versionCmd)
+	rootCmd.Flags().StringVarP(&o.outputFormat, "output", "o", "report", "Output format (report, compact, json, json-legacy, patch, stat, side-by-side, git-diff, markdown, sarif, gh-annotations, github-comment, tree, unified, template, csv, ndjson, tap)")
+	rootCmd.Flags().StringVarP(&o.outputFile, "output-file", "O", "", "Write output to this file, replaced atomically once complete (\"-\" = stdout); warnings stay on stderr")
+	rootCmd.Flags().StringVar(&o.templateFile, "template-file", "", "Go text/template file for -o template")
+	rootCmd.Flags().StringVar(&o.colorMode, "color", "auto", "When to color output: auto (when writing to a terminal), always, or never; NO_COLOR and CLICOLOR_FORCE apply to auto")
+	rootCmd.Flags().BoolVar(&o.noColor, "no-color", false, "Disable colored output, same as --color=never")
+	rootCmd.Flags().IntVar(&o.width, "width", 0, "Output width for side-by-side (0 = terminal width)")
+	rootCmd.Flags().IntVarP(&o.contextLines, "context", "U", 3, "Lines of context in unified output")
+	rootCmd.Flags().IntVar(&o.contextKeys, "context-keys", 0, "Unchanged sibling keys to show around each change in report output")
+	rootCmd.Flags().StringVar(&o.groupBy, "group-by", "none", "Group report changes by section (none, top-level, depth-N)")
+	rootCmd.Flags().StringVar(&o.sortOrder, "sort", "", "Sort rendered changes (path, type, severity)")
+	rootCmd.Flags().IntVar(&o.maxShown, "max-shown", 0, "Render at most N changes in report, compact, markdown, and github-comment output (0 = all)")
+	rootCmd.Flags().BoolVar(&o.lineNumbers, "line-numbers", false, "Append source file and line (e.g. new.yaml:42) to each change in report and compact output")
+	rootCmd.Flags().StringSliceVar(&o.annotationLevels, "annotation-level", nil, "Override gh-annotations levels as TYPE=LEVEL, e.g. add=warning (types: add, remove, modify, move, type-change; levels: error, warning, notice)")
+	rootCmd.Flags().BoolVar(&o.asciiOutput, "ascii", false, "Use ASCII symbols (->, <->, |, -) instead of Unicode arrows and box drawing; automatic when the locale is not UTF-8")
+	rootCmd.Flags().BoolVar(&o.expandValues, "expand-values", false, "Show added and removed objects and arrays as YAML in report output")
+	rootCmd.Flags().IntVar(&o.expandLimit, "expand-limit", report.DefaultExpandLimit, "Largest object or array, in nodes, shown by --expand-values")
+	rootCmd.Flags().BoolVar(&o.fullPaths, "full-paths", false, fmt.Sprintf("Show full paths instead of eliding the middle of paths deeper than %d segments in report, compact, side-by-side, and tree output", report.DefaultMaxPathSegments))
+	rootCmd.Flags().BoolVar(&o.legend, "legend", false, "Explain the change symbols above report and compact output (default on for report, off for compact)")
+	rootCmd.Flags().BoolVar(&o.zeroCounts, "zero-counts", false, "List every change type in the summary line, including those with no changes")
+	rootCmd.Flags().BoolVar(&o.severity, "severity", false, "Classify changes as breaking, warning, or info: colors and marks report output, adds a Severity column to markdown and github-comment, and orders --sort severity by it")
+	rootCmd.Flags().StringVar(&o.valueStyle, "value-style", report.ValueStyleAuto, "How values are rendered in human-readable output (auto, json, yaml, go)")
+	rootCmd.Flags().StringSliceVar(&o.filterTypes, "filter-type", nil, "Only render these change types (add, remove, modify, move)")
+	rootCmd.Flags().BoolVar(&o.maskSecrets, "mask-secrets", false, "Mask values of keys that look like secrets (password, secret, token, apikey)")
+	rootCmd.Flags().StringSliceVar(&o.maskPaths, "mask-path", nil, "Paths whose values are masked in all output (can be repeated)")
+	rootCmd.Flags().StringVar(&o.maskMode, "mask-mode", "redact", "How masked values are shown: redact, or hash to show a keyed hash that matches equal values within one run")
+	rootCmd.Flags().IntVar(&o.maxValueLength, "max-value-length", 80, "Truncate values longer than N chars (0 = no limit)")
+	rootCmd.Flags().BoolVar(&o.noCollapse, "no-collapse", false, "Truncate long values in markdown and github-comment output instead of showing them in full behind <details> blocks")
+	rootCmd.Flags().CountVarP(&o.quiet, "quiet", "q", "Silence warnings, headers, and summaries on stderr (-q), or all output (-qq)")
+	rootCmd.Flags().BoolVar(&o.noPager, "no-pager", false, "Do not page output longer than the terminal through $CONFIGDIFF_PAGER, $PAGER, or less")
+	rootCmd.Flags().BoolVar(&o.interactive, "interactive", false, "Browse the changes in a full-screen terminal view instead of printing them: up and down move, enter expands, / filters, t cycles change types, q quits")
+	rootCmd.Flags().BoolVarP(&o.verbose, "verbose", "v", false, "Report the ignore paths in effect for each file and where each comes from, skipped files, the rules that matched, timings, and the slowest files, on stderr")
+	rootCmd.Flags().BoolVar(&o.exitCode, "exit-code", false, "Exit with code 1 if differences found (0 = none, 2 = error)")
+	rootCmd.Flags().StringSliceVar(&o.failOn, "fail-on", nil, "With --exit-code, only exit 1 for these change types (add, remove, modify, move, type-change, destroy, any; default any); remove,type-change fails on what --severity classifies as breaking")
+	rootCmd.Flags().BoolVarP(&o.recursive, "recursive", "r", false, "Recursively compare directories")
+	rootCmd.Flags().StringSliceVar(&o.excludePaths, "exclude", nil, "Skip files and directories matching this glob in recursive mode; without a slash it matches names at any depth (can be repeated)")
+	rootCmd.Flags().IntVarP(&o.jobs, "jobs", "j", runtime.NumCPU(), "Number of files compared at once in recursive, glob, and --pairs mode")
+	rootCmd.Flags().DurationVar(&o.timeoutPerFile, "timeout-per-file", 0, "Give up on comparing a file after this long in recursive, glob, and --pairs mode, reporting it as timed out (0 for no limit)")
+	rootCmd.Flags().StringVar(&o.cacheDir, "cache-dir", "", "Cache the diffs of file pairs in this directory, default $CONFIGDIFF_CACHE_DIR, and reuse them while the files, options, and configdiff version are unchanged")
+	rootCmd.Flags().BoolVar(&o.noCache, "no-cache", false, "Do not use the cache of --cache-dir or $CONFIGDIFF_CACHE_DIR")
+	rootCmd.Flags().DurationVar(&o.cacheMaxAge, "cache-max-age", cli.DefaultCacheMaxAge, "Evict cache entries not used for this long (0 = no limit)")
+	rootCmd.Flags().StringVar(&o.cacheMaxSize, "cache-max-size", cli.DefaultCacheMaxSize, "Evict the least recently used cache entries beyond this size, e.g. 512M or 1GB (0 = no limit)")
+	rootCmd.Flags().BoolVar(&o.noDefaultExclude, "no-default-excludes", false, "Also compare hidden, node_modules, and vendor directories in recursive mode")
+	rootCmd.Flags().StringVar(&o.maxFileSize, "max-file-size", cli.DefaultMaxFileSize, "Skip files larger than this in recursive mode, e.g. 512K or 1GB (0 = no limit)")
+	rootCmd.Flags().StringVar(&o.maxParseSize, "max-parse-size", cli.DefaultMaxParseSize, "Fail to parse documents larger than this, e.g. 256MB or 1GB (0 = no limit)")
+	rootCmd.Flags().IntVar(&o.maxWalkDepth, "max-walk-depth", 0, "Compare files at most N directories deep in recursive mode, 1 for only the top level (0 = no limit)")
+	rootCmd.Flags().BoolVar(&o.followSymlinks, "follow-symlinks", false, "Enter symlinked directories in recursive mode, skipping links that loop back (symlinked files are always read)")
+	rootCmd.Flags().BoolVar(&o.noRenameDetect, "no-rename-detection", false, "Report files moved within compared directories as removed and added rather than renamed")
+	rootCmd.Flags().BoolVar(&o.matchStem, "match-stem", false, "In recursive mode, compare a file only in the old directory with one only in the new directory at the same path without extension, e.g. config.json with config.yaml")
+	rootCmd.Flags().IntVar(&o.renameThreshold, "rename-threshold", defaultRenameThreshold, "Similarity, in percent of shared values, above which a removed and an added file are paired as a rename")
+	rootCmd.Flags().BoolVar(&o.githubComment, "github-comment", false, "Write the GitHub Actions diff-output as a PR comment (markdown)")
+	rootCmd.Flags().IntVar(&o.githubMaxOutput, "github-output-limit", defaultGitHubOutputLimit, "Cut the GitHub Actions diff-output before the first change past this many bytes, setting diff-output-truncated (0 = no limit)")
+	rootCmd.Flags().StringVar(&o.githubArtifact, "github-artifact", "", "Also write the whole GitHub Actions diff-output to this file, e.g. to upload as a workflow artifact when it is truncated")
+
+	o.registerCompletions(rootCmd)
+
+	// batch, snapshot diff, and tfplan run comparisons, so they take every
+	// comparison flag
+	rootCmd.AddCommand(
+		newApplyCmd(o),
+		newBatchCmd(o, rootCmd.Flags()),
+		newCompletionCmd(),
+		newConfigCmd(o),
+		newConvertCmd(o),
+		newGetCmd(o),
+		newGitDriverCmd(o),
+		newHelmCmd(o),
+		newLayerCmd(o),
+		newMergeCmd(o),
+		newNormalizeCmd(o),
+		newPathsCmd(o),
+		newSnapshotCmd(o, rootCmd.Flags()),
+		newTFPlanCmd(o, rootCmd.Flags()),
+		newVersionCmd(),
+	)
+	return rootCmd
 }
 
 // runCompare is the main entry point for the compare command
-func runCompare(cmd *cobra.Command, args []string) error {
+func (o *options) runCompare(cmd *cobra.Command, args []string) error {
+	o.discoverConfig(args)
+	return o.runComparison(cmd, func() (bool, error) {
+		return o.compareArgs(args)
+	})
+}
+
+// runComparison validates the comparison flags of cmd and runs compareFn with
+// output set up for them: to --output-file and through the pager. Differences
+// are returned as errDifferences with --exit-code.
+func (o *options) runComparison(cmd *cobra.Command, compareFn func() (bool, error)) error {
+	o.legendSet = cmd.Flags().Changed("legend")
+	o.flagChanged = cmd.Flags().Changed
+	if err := o.loadConfig(); err != nil {
+		return err
+	}
+	if err := cli.ValidateFailOn(o.failOn); err != nil {
+		return err
+	}
+	if err := validateRenameThreshold(o.renameThreshold); err != nil {
+		return err
+	}
+	for _, rev := range []string{o.gitOld, o.gitNew} {
+		if err := cli.ValidateGitRevision(rev); err != nil {
+			return err
+		}
+	}
+	if _, err := cli.ParseSize(o.maxFileSize); err != nil {
+		return fmt.Errorf("invalid --max-file-size: %w", err)
+	}
+	// The parsers read their size limit from the parse package
+	maxParse, err := o.maxParseBytes()
+	if err != nil {
+		return err
+	}
+	parse.MaxSize = int(maxParse)
+	if o.maxWalkDepth < 0 {
+		return fmt.Errorf("invalid --max-walk-depth %d, must not be negative", o.maxWalkDepth)
+	}
+	if _, err := cli.ParseColorMode(o.colorMode); err != nil {
+		return err
+	}
+	if err := o.validateInteractive(); err != nil {
+		return err
+	}
+
+	if err := o.openCache(); err != nil {
+		return err
+	}
+	defer o.closeCache()
+
+	if err := o.openOutput(o.outputFile); err != nil {
+		return err
+	}
+	if err := o.startPager(); err != nil {
+		return err
+	}
+	hasChanges, err := compareFn()
+	o.stopPager()
+	if err != nil {
+		o.discardOutput()
+		return err
+	}
+	if err := o.commitOutput(o.outputFile); err != nil {
+		return err
+	}
+
+	// Differences are only an error for --exit-code, which main reports
+	// with exit code 1
+	if o.exitCode && hasChanges {
+		return errDifferences
+	}
+	return nil
+}
+
+// compareArgs compares the inputs named by the arguments and flags.
+// Returns true if changes selected by --fail-on were found, false otherwise.
+func (o *options) compareArgs(args []string) (bool, error) {
+	if len(o.selectPaths) > 0 && (o.pairsFile != "" || o.kubeObject != "" || o.kubeMatch) {
+		return false, fmt.Errorf("--select can only be used when comparing two files")
+	}
+	if o.pairsFile != "" {
+		return o.compareFileList(o.pairsFile)
+	}
+
+	if o.kubeObject != "" || o.kubeMatch {
+		if o.gitOld != "" || o.gitNew != "" {
+			return false, fmt.Errorf("--kube and --kube-match cannot be combined with git revisions")
+		}
+		if o.kubeObject != "" && o.kubeMatch {
+			return false, fmt.Errorf("--kube and --kube-match cannot be used together")
+		}
+		return o.compareKube(args[0])
+	}
+
 	oldFile := args[0]
-	newFile := args[1]
+	newFile := args[len(args)-1]
 
-	// Validate that both files aren't stdin
-	if oldFile == "-" && newFile == "-" {
-		return fmt.Errorf("both old-file and new-file cannot be stdin (\"-\")\nHint: Save one file to disk or use process substitution:\n  configdiff <(command1) <(command2)")
+	// Git flags read a side from a revision instead of the working tree
+	if o.gitOld != "" {
+		if _, _, ok := cli.SplitGitRevision(oldFile); ok {
+			return false, fmt.Errorf("%q already names a revision; cannot also use --git-old", oldFile)
+		}
+		oldFile = cli.JoinGitRevision(oldFile, o.gitOld)
+	}
+	if o.gitNew != "" {
+		if _, _, ok := cli.SplitGitRevision(newFile); ok {
+			return false, fmt.Errorf("%q already names a revision; cannot also use --git-new", newFile)
+		}
+		newFile = cli.JoinGitRevision(newFile, o.gitNew)
+	}
+
+	// Both files can only be stdin when a separator splits it in two
+	bothStdin := oldFile == "-" && newFile == "-"
+	if bothStdin && o.stdinSeparator == "" {
+		return false, fmt.Errorf("both old-file and new-file cannot be stdin (\"-\")\nHint: Save one file to disk or use process substitution:\n  configdiff <(command1) <(command2)\nor separate the documents with a line of their own and pass it with --stdin-separator")
+	}
+	if !bothStdin && o.stdinSeparator != "" {
+		return false, fmt.Errorf("--stdin-separator requires \"-\" for both old-file and new-file")
 	}
 
 	// This will be implemented in compare.go
-	return compare(oldFile, newFile)
+	return o.compare(oldFile, newFile)
 }
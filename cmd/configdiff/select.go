@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// selection is the diff of one subtree chosen with --select.
+type selection struct {
+	path string
+	fd   *fileDiff
+}
+
+// selectPath returns a --select path in canonical form for the documents,
+// e.g. "/spec/template" for "spec/template/". An array element may be
+// written with its index as a segment of its own, as in ignore paths:
+// "/spec/containers/0" selects "/spec/containers[0]".
+func selectPath(path string, docs ...*tree.Node) string {
+	canonical := "/"
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		switch {
+		case segment == "":
+		case isIndex(segment) && isArrayIn(canonical, docs):
+			canonical += "[" + segment + "]"
+		case canonical == "/":
+			canonical += segment
+		default:
+			canonical += "/" + segment
+		}
+	}
+	return canonical
+}
+
+// isIndex reports whether a path segment is an array index.
+func isIndex(segment string) bool {
+	return segment != "" && strings.Trim(segment, "0123456789") == ""
+}
+
+// isArrayIn reports whether the node at path is an array in any of docs.
+func isArrayIn(path string, docs []*tree.Node) bool {
+	for _, doc := range docs {
+		if n := doc.GetByPath(path); n != nil && n.Kind == tree.KindArray {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSelections compares the subtrees chosen with --select in two files.
+// Each is diffed as a document of its own, so ignore paths, array keys, and
+// patches are relative to it. Several selections are reported in sections,
+// or as one result with absolute paths in machine-readable formats.
+// Returns true if changes selected by --fail-on were found, false otherwise.
+func (o *options) compareSelections(oldFile, newFile string) (bool, error) {
+	cliOpts, err := o.cliOptions(oldFile, newFile)
+	if err != nil {
+		return false, err
+	}
+	oldTree, newTree, err := o.readTrees(cliOpts, oldFile, newFile)
+	if err != nil {
+		return false, err
+	}
+
+	selections := make([]selection, 0, len(o.selectPaths))
+	for _, arg := range o.selectPaths {
+		path := selectPath(arg, oldTree, newTree)
+		oldSub, newSub := oldTree.GetByPath(path), newTree.GetByPath(path)
+		if oldSub == nil && newSub == nil {
+			return false, fmt.Errorf("--select %s: path not found in %s or %s", path, oldFile, newFile)
+		}
+		// A subtree on one side only is diffed as added or removed
+		fd, err := o.diffTrees(cliOpts, oldSub, newSub)
+		if err != nil {
+			return false, fmt.Errorf("--select %s: %w", path, err)
+		}
+		selections = append(selections, selection{path: path, fd: fd})
+	}
+
+	joined := len(selections) > 1 && (o.interactive || !cli.IsPagedFormat(cliOpts.OutputFormat))
+	if o.absolutePaths || joined {
+		for i, s := range selections {
+			// Joined selections are rendered against the whole documents
+			oldDoc, newDoc := oldTree, newTree
+			if !joined {
+				oldDoc, newDoc = pruneTree(oldTree, s.path), pruneTree(newTree, s.path)
+			}
+			fd, err := rebaseSelection(s.fd, s.path, oldDoc, newDoc)
+			if err != nil {
+				return false, err
+			}
+			selections[i].fd = fd
+		}
+	}
+
+	switch {
+	case len(selections) == 1:
+		return o.reportFileDiff(oldFile, newFile, selections[0].fd)
+	case joined:
+		fd, err := joinSelections(selections)
+		if err != nil {
+			return false, err
+		}
+		return o.reportFileDiff(oldFile, newFile, fd)
+	}
+	return o.reportSelections(oldFile, newFile, selections)
+}
+
+// rebaseSelection returns the diff of the subtree at path with the paths of
+// its changes made absolute, rendered against the given documents.
+func rebaseSelection(fd *fileDiff, path string, oldTree, newTree *tree.Node) (*fileDiff, error) {
+	changes := make([]diff.Change, len(fd.result.Changes))
+	for i, change := range fd.result.Changes {
+		change.Path = absolutePath(path, change.Path)
+		changes[i] = change
+	}
+	result, err := changesResult(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	if maskOpts := fd.opts.MaskOptions(); len(maskOpts.MaskPaths) > 0 || maskOpts.MaskSecrets {
+		maskOpts.MaskMode = report.MaskModeHash
+		oldTree = report.MaskTree(oldTree, maskOpts)
+		newTree = report.MaskTree(newTree, maskOpts)
+	}
+	return &fileDiff{opts: fd.opts, result: result, oldTree: oldTree, newTree: newTree}, nil
+}
+
+// pruneTree returns root with only the keys leading to the subtree at path
+// kept in the objects above it, so that whole-document output shows just the
+// subtree, where it is in the document. Arrays on the way are kept whole.
+func pruneTree(root *tree.Node, path string) *tree.Node {
+	segments := tree.ParsePath(path)
+	if root == nil || root.Kind != tree.KindObject || len(segments) == 0 || strings.Contains(segments[0], "[") {
+		return root
+	}
+	pruned := *root
+	pruned.Object = make(map[string]*tree.Node, 1)
+	if child, ok := root.Object[segments[0]]; ok {
+		pruned.Object[segments[0]] = pruneTree(child, "/"+strings.Join(segments[1:], "/"))
+	}
+	return &pruned
+}
+
+// absolutePath returns the path in the whole document of path, relative to
+// the subtree at base.
+func absolutePath(base, path string) string {
+	switch {
+	case path == "/":
+		return base
+	case base == "/":
+		return path
+	case strings.HasPrefix(path, "/["):
+		// An element of a selected array
+		return base + path[1:]
+	}
+	return base + path
+}
+
+// joinSelections returns the rebased diffs of several selections as one.
+func joinSelections(selections []selection) (*fileDiff, error) {
+	var changes []diff.Change
+	for _, s := range selections {
+		changes = append(changes, s.fd.result.Changes...)
+	}
+	result, err := changesResult(changes)
+	if err != nil {
+		return nil, err
+	}
+	fd := *selections[0].fd
+	fd.result = result
+	return &fd, nil
+}
+
+// changesResult returns the result made of changes, with its patch and
+// report.
+func changesResult(changes []diff.Change) (*configdiff.Result, error) {
+	p, err := patch.FromChanges(changes)
+	if err != nil {
+		return nil, fmt.Errorf("patch generation failed: %w", err)
+	}
+	return &configdiff.Result{
+		Changes: changes,
+		Patch:   p,
+		Report:  report.GenerateDetailed(changes),
+	}, nil
+}
+
+// reportSelections renders each selection under a "=== path ===" header and
+// writes GitHub Actions outputs and a step summary for all of them.
+// Returns true if changes selected by --fail-on were found, false otherwise.
+func (o *options) reportSelections(oldFile, newFile string, selections []selection) (bool, error) {
+	var b strings.Builder
+	var counts report.Summary
+	hasChanges, fails := false, false
+	for i, s := range selections {
+		output, err := cli.FormatOutput(s.fd.result, o.outputOptions(oldFile, newFile, s.fd))
+		if err != nil {
+			return false, fmt.Errorf("--select %s: %w", s.path, err)
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "=== %s ===\n%s\n", s.path, strings.TrimRight(output, "\n"))
+		hasChanges = hasChanges || s.fd.result.HasChanges()
+		fails = fails || cli.FailsOn(s.fd.result.Changes, o.failOn)
+		summary := s.fd.result.Summary()
+		counts.Added += summary.Added
+		counts.Removed += summary.Removed
+		counts.Modified += summary.Modified
+	}
+
+	if o.quiet < quietAll {
+		fmt.Fprint(o.stdout(), b.String())
+	}
+	if githubOutput := os.Getenv("GITHUB_OUTPUT"); githubOutput != "" {
+		filesChanged := 0
+		if hasChanges {
+			filesChanged = 1
+		}
+		err := o.writeGitHubDiff(githubOutput, hasChanges, b.String())
+		if err == nil {
+			err = writeGitHubCounts(githubOutput, counts, filesChanged)
+		}
+		if err != nil {
+			fmt.Fprintf(o.messages(), "Warning: Failed to write GitHub Actions outputs: %v\n", err)
+		}
+	}
+	if summaryFile := os.Getenv("GITHUB_STEP_SUMMARY"); summaryFile != "" {
+		var summary strings.Builder
+		for _, s := range selections {
+			opts := o.githubCommentOptions(newFile+" "+s.path, s.fd.opts)
+			opts.MaxSize = report.GitHubStepSummaryLimit / len(selections)
+			markdown, err := cli.FormatOutput(s.fd.result, opts)
+			if err != nil {
+				return false, fmt.Errorf("--select %s: %w", s.path, err)
+			}
+			summary.WriteString(markdown + "\n")
+		}
+		if err := writeGitHubStepSummary(summaryFile, summary.String()); err != nil {
+			fmt.Fprintf(o.messages(), "Warning: Failed to write GitHub Actions step summary: %v\n", err)
+		}
+	}
+	return fails, nil
+}
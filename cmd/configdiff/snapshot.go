@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// snapshotFlags holds the flags of the snapshot command.
+type snapshotFlags struct {
+	// Snapshot flags
+	snapshotOut string
+}
+
+// newSnapshotCmd returns the snapshot command and its subcommands.
+func newSnapshotCmd(o *options, compareFlags *pflag.FlagSet) *cobra.Command {
+	snapshotSaveCmd := &cobra.Command{
+		Use:   "save [flags] <dir> --out <snapshot>",
+		Short: "Save the configuration files of a directory as a snapshot",
+		Long: `Parse the configuration files of a directory, found as in a recursive
+comparison, and save them as a snapshot: a gzipped tar archive of a manifest
+and each file as canonical JSON, with its SHA-256 hash.
+
+The directory may be a "dir@{rev}" git revision or an archive. Snapshots hold
+the full content of the files, secrets included, and are read by this and
+later versions of configdiff.`,
+		Example: `  configdiff snapshot save config/ --out baseline.snap`,
+		Args:    cobra.ExactArgs(1),
+		RunE:    o.runSnapshotSave,
+	}
+
+	snapshotDiffCmd := &cobra.Command{
+		Use:   "diff [flags] <snapshot> <dir>",
+		Short: "Compare a directory with a snapshot",
+		Long: `Compare the configuration files of a directory with a snapshot saved by
+"configdiff snapshot save", reporting the changes in each file and the files
+added or removed since. The comparison takes the flags of a recursive
+comparison, e.g. --ignore, --array-key, -o, and --exit-code; the snapshot is
+the old side.`,
+		Example: `  # Fail a scheduled job when the configuration drifts from the baseline
+  configdiff snapshot diff baseline.snap config/ --exit-code`,
+		Args: cobra.ExactArgs(2),
+		RunE: o.runSnapshotDiff,
+	}
+
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save configuration as a baseline and compare with it later",
+		Long: `Save the configuration files of a directory as a baseline, and compare the
+directory with it later to find drift.`,
+	}
+
+	snapshotSaveCmd.Flags().StringVar(&o.snapshotOut, "out", "", "File to write the snapshot to")
+	snapshotSaveCmd.Flags().StringVarP(&o.format, "format", "f", "auto", "Input format for all files (auto, yaml, json, hcl, toml)")
+	snapshotSaveCmd.Flags().StringSliceVar(&o.excludePaths, "exclude", nil, "Glob patterns of files to leave out (can be repeated)")
+	snapshotSaveCmd.Flags().BoolVar(&o.lenientConfig, "lenient-config", false, "Ignore unknown keys and invalid values in the config file instead of failing")
+	_ = snapshotSaveCmd.MarkFlagRequired("out")
+
+	snapshotCmd.AddCommand(snapshotSaveCmd, snapshotDiffCmd)
+
+	// Every comparison flag applies
+	snapshotDiffCmd.Flags().AddFlagSet(compareFlags)
+
+	return snapshotCmd
+}
+
+// runSnapshotSave is the entry point for the snapshot save command.
+func (o *options) runSnapshotSave(cmd *cobra.Command, args []string) error {
+	if err := o.loadConfig(); err != nil {
+		return err
+	}
+	return o.saveSnapshot(args[0], o.snapshotOut)
+}
+
+// runSnapshotDiff is the entry point for the snapshot diff command.
+func (o *options) runSnapshotDiff(cmd *cobra.Command, args []string) error {
+	return o.runComparison(cmd, func() (bool, error) {
+		return o.compareSnapshot(args[0], args[1])
+	})
+}
+
+// saveSnapshot parses the configuration files of dir and writes them to out
+// as a snapshot. Files larger than --max-file-size are left out with a
+// warning; a file that does not parse fails the whole snapshot.
+func (o *options) saveSnapshot(dir, out string) error {
+	ok, err := isDir(dir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+	files, tooLarge, err := o.listConfigFiles(dir)
+	if err != nil {
+		return fmt.Errorf("failed to scan directory: %w", err)
+	}
+	for _, relPath := range sortedPaths(tooLarge) {
+		fmt.Fprintf(o.messages(), "Warning: %s: left out of the snapshot, %s\n", filepath.ToSlash(relPath), o.tooLargeReason())
+	}
+
+	s := &cli.Snapshot{
+		Manifest: cli.SnapshotManifest{
+			Generator: "configdiff " + version,
+			Created:   time.Now().UTC().Truncate(time.Second),
+			Root:      dir,
+		},
+		Trees: make(map[string]*tree.Node, len(files)),
+	}
+	for _, relPath := range sortedPaths(files) {
+		path := joinPath(dir, relPath)
+		input, err := cli.ReadInputWith(path, o.format, o.inputOptions())
+		if err != nil {
+			return err
+		}
+		node, err := parse.Parse(input.Data, parse.Format(input.Format))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		label := filepath.ToSlash(relPath)
+		s.Trees[label] = node
+		s.Manifest.Files = append(s.Manifest.Files, cli.SnapshotFile{Path: label, Format: input.Format})
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if err := cli.WriteSnapshot(f, s); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	fmt.Fprintf(o.messages(), "Saved %s of %s to %s\n", plural(len(s.Trees), "file", "files"), dir, out)
+	return nil
+}
+
+// compareSnapshot compares the configuration files of dir with a snapshot,
+// reported like a directory comparison with the snapshot as the old side.
+// Errors in one file are reported without stopping the others, as in a
+// directory comparison.
+// Returns true if any changes selected by --fail-on were found, false otherwise.
+func (o *options) compareSnapshot(snapPath, dir string) (bool, error) {
+	if len(o.selectPaths) > 0 {
+		return false, fmt.Errorf("--select can only be used when comparing two files")
+	}
+	f, err := os.Open(snapPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	snap, err := cli.ReadSnapshot(f)
+	f.Close()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", snapPath, err)
+	}
+
+	ok, err := isDir(dir)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("%q is not a directory", dir)
+	}
+	files, tooLarge, err := o.listConfigFiles(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to scan directory: %w", err)
+	}
+
+	// Snapshot paths are slash-separated, listed paths are the OS's
+	current := make(map[string]string)
+	for _, set := range []map[string]bool{files, tooLarge} {
+		for relPath := range set {
+			current[filepath.ToSlash(relPath)] = relPath
+		}
+	}
+	labels := make([]string, 0, len(current)+len(snap.Trees))
+	for label := range current {
+		labels = append(labels, label)
+	}
+	for label := range snap.Trees {
+		if _, ok := current[label]; !ok {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+
+	result := report.DirResult{OldDir: snapPath, NewDir: dir, MaxDepth: o.maxWalkDepth}
+	diffs := make(map[string]*fileDiff)
+	failed := 0
+	for _, label := range labels {
+		file := report.FileResult{Path: label}
+		oldTree := snap.Trees[label]
+		relPath, ok := current[label]
+		switch {
+		case !ok:
+			file.Status = report.FileRemoved
+		case oldTree == nil:
+			file.Status = report.FileAdded
+		case tooLarge[relPath]:
+			file.Status, file.Error = report.FileSkipped, o.tooLargeReason()
+		default:
+			fd, err := o.diffSnapshotFile(cli.JoinArchivePath(snapPath, label), joinPath(dir, relPath), oldTree)
+			if err != nil {
+				fmt.Fprintf(o.errorOutput(), "Error: %s: %v\n", label, err)
+				failed++
+				file.Status, file.Error = report.FileError, err.Error()
+				break
+			}
+			file.Status = report.FileUnchanged
+			if fd.result.HasChanges() {
+				file.Status = report.FileModified
+			}
+			file.Changes = fd.result.Changes
+			diffs[label] = fd
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	if err := o.renderDirectory(result, diffs); err != nil {
+		return false, err
+	}
+	return cli.DirFailsOn(result, o.failOn), compareFailures(failed)
+}
+
+// diffSnapshotFile diffs a file as saved in a snapshot, labeled oldLabel,
+// with its current version.
+func (o *options) diffSnapshotFile(oldLabel, newFile string, oldTree *tree.Node) (*fileDiff, error) {
+	cliOpts, err := o.cliOptions(oldLabel, newFile)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := o.readTree(newFile, cliOpts.GetNewFormat())
+	if err != nil {
+		return nil, err
+	}
+	return o.diffTrees(cliOpts, oldTree, newTree)
+}
+
+// sortedPaths returns the relative paths of a set in order, see sortSlashed.
+func sortedPaths(set map[string]bool) []string {
+	paths := make([]string, 0, len(set))
+	for path := range set {
+		paths = append(paths, path)
+	}
+	sortSlashed(paths)
+	return paths
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pfrederiksen/configdiff/internal/cli"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// newTFPlanCmd returns the tfplan command.
+func newTFPlanCmd(o *options, compareFlags *pflag.FlagSet) *cobra.Command {
+	tfplanCmd := &cobra.Command{
+		Use:   "tfplan [flags] <plan.json>",
+		Short: "Review a Terraform plan resource by resource",
+		Long: `Report the resources a Terraform plan creates, destroys, replaces, and
+updates, with the attributes each update and replacement changes, like the
+files of a directory comparison: one report, JSON document, or GitHub
+comment for the whole plan.
+
+The plan is the JSON of a saved plan, or "-" for stdin:
+
+  terraform plan -out plan.out
+  terraform show -json plan.out > plan.json
+
+Created resources are reported as added, destroyed ones as removed, and
+replaced ones as "-/+ address (replaced)". --ignore and --array-key apply to
+the attributes of every resource, e.g. --ignore /tags_all hides changes
+Terraform derives from provider default tags; an update left without
+changes is reported as unchanged. Values only known after apply are shown
+as "(known after apply)", and values Terraform marks sensitive are masked.
+
+With --exit-code, --fail-on destroy exits 1 only when the plan destroys or
+replaces a resource.`,
+		Example: `  # Review a plan, ignoring noisy attributes
+  configdiff tfplan plan.json --ignore /tags_all --ignore /arn
+
+  # Fail CI only when something would be destroyed
+  terraform show -json plan.out | configdiff tfplan - --exit-code --fail-on destroy
+
+  # Post the plan as a PR comment
+  configdiff tfplan plan.json -o github-comment`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.runTFPlan,
+	}
+
+	// Every comparison flag applies
+	tfplanCmd.Flags().AddFlagSet(compareFlags)
+
+	return tfplanCmd
+}
+
+// runTFPlan is the entry point for the tfplan command.
+func (o *options) runTFPlan(cmd *cobra.Command, args []string) error {
+	return o.runComparison(cmd, func() (bool, error) {
+		return o.reviewTFPlan(args[0])
+	})
+}
+
+// reviewTFPlan reports the resource changes of a Terraform plan like the
+// files of a directory comparison, one per resource address.
+// Returns true if any changes selected by --fail-on were found, false otherwise.
+func (o *options) reviewTFPlan(planFile string) (bool, error) {
+	if len(o.selectPaths) > 0 {
+		return false, fmt.Errorf("--select can only be used when comparing two files")
+	}
+	input, err := cli.ReadInputWith(planFile, "json", o.inputOptions())
+	if err != nil {
+		return false, err
+	}
+	resources, err := cli.ParseTFPlan(input.Data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", input.Path, err)
+	}
+
+	cliOpts, err := o.cliOptions(planFile, planFile)
+	if err != nil {
+		return false, err
+	}
+
+	result := report.DirResult{OldDir: planFile, NewDir: planFile}
+	diffs := make(map[string]*fileDiff)
+	for _, rc := range resources {
+		file := report.FileResult{Path: rc.Address}
+		switch rc.Action {
+		case cli.TFCreate:
+			file.Status = report.FileAdded
+		case cli.TFDelete:
+			file.Status = report.FileRemoved
+		default:
+			// Sensitive attributes are masked like --mask-path
+			opts := cliOpts
+			opts.MaskPaths = slices.Concat(cliOpts.MaskPaths, rc.SensitivePaths)
+			fd, err := o.diffTrees(opts, rc.Before, rc.After)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", rc.Address, err)
+			}
+			switch {
+			case rc.Action == cli.TFReplace:
+				file.Status = report.FileReplaced
+			case fd.result.HasChanges():
+				file.Status = report.FileModified
+			default:
+				file.Status = report.FileUnchanged
+			}
+			file.Changes = fd.result.Changes
+			diffs[file.Path] = fd
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	if err := o.renderDirectory(result, diffs); err != nil {
+		return false, err
+	}
+	return cli.DirFailsOn(result, o.failOn), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/report"
+)
+
+// slowestFiles is how many files --verbose lists as the slowest to compare.
+const slowestFiles = 10
+
+// timeoutError is the error for a file comparison given up on after
+// --timeout-per-file.
+type timeoutError struct {
+	limit time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s (--timeout-per-file)", e.limit)
+}
+
+// isTimeout reports whether err is a comparison given up on after
+// --timeout-per-file.
+func isTimeout(err error) bool {
+	var timeout *timeoutError
+	return errors.As(err, &timeout)
+}
+
+// diffFilesWithin diffs two files as diffFiles does, giving up after
+// --timeout-per-file, if set. Diffing stops when it times out, but parsing
+// cannot be interrupted: a file still being parsed is abandoned to finish
+// in the background, so its messages may still be written after this
+// returns.
+func (o *options) diffFilesWithin(oldFile, newFile string) (*fileDiff, error) {
+	if o.timeoutPerFile <= 0 {
+		return o.diffFiles(oldFile, newFile)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeoutPerFile)
+	defer cancel()
+
+	type result struct {
+		fd  *fileDiff
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		fd, err := o.diffFilesContext(ctx, oldFile, newFile)
+		done <- result{fd, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && errors.Is(r.err, context.DeadlineExceeded) {
+			return nil, &timeoutError{limit: o.timeoutPerFile}
+		}
+		return r.fd, r.err
+	case <-ctx.Done():
+		return nil, &timeoutError{limit: o.timeoutPerFile}
+	}
+}
+
+// reportSlowestFiles lists the files of dir that took longest to compare,
+// slowest first, with how long parsing and diffing each took.
+func (o *options) reportSlowestFiles(dir report.DirResult) {
+	var files []report.FileResult
+	for _, file := range dir.Files {
+		if file.ParseDuration+file.DiffDuration > 0 {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ParseDuration+files[i].DiffDuration > files[j].ParseDuration+files[j].DiffDuration
+	})
+
+	w := o.messages()
+	fmt.Fprintln(w, "Slowest files:")
+	for _, file := range files[:min(len(files), slowestFiles)] {
+		fmt.Fprintf(w, "  %8s  %s (parse %s, diff %s)\n", roundDuration(file.ParseDuration+file.DiffDuration),
+			file.Path, roundDuration(file.ParseDuration), roundDuration(file.DiffDuration))
+	}
+}
+
+// roundDuration rounds d to a precision that reads well in a list of
+// timings: microseconds below a millisecond, and milliseconds above.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -7,16 +7,21 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print version information",
-	Long:  "Print version information including build details",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("configdiff version %s\n", version)
-		fmt.Printf("  commit: %s\n", commit)
-		fmt.Printf("  built at: %s\n", date)
-		fmt.Printf("  built by: %s\n", builtBy)
-		fmt.Printf("  go version: %s\n", runtime.Version())
-		fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
-	},
+// newVersionCmd returns the version command.
+func newVersionCmd() *cobra.Command {
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print version information",
+		Long:  "Print version information including build details",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("configdiff version %s\n", version)
+			fmt.Printf("  commit: %s\n", commit)
+			fmt.Printf("  built at: %s\n", date)
+			fmt.Printf("  built by: %s\n", builtBy)
+			fmt.Printf("  go version: %s\n", runtime.Version())
+			fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		},
+	}
+
+	return versionCmd
 }
@@ -2,10 +2,18 @@
 //
 // It parses configuration files into a normalized tree representation, applies customizable
 // diff rules, and generates both machine-readable patches and human-friendly reports.
+//
+// DiffFiles compares two files, detecting their formats; DiffReaders compares
+// two streams, and DiffBytes two byte slices in known formats. Build their
+// Options with NewOptions, which applies the defaults of the command line.
+// Large JSON documents are compared one top-level member at a time, to
+// bound the memory needed; see IncrementalThreshold.
 package configdiff
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"slices"
 
 	"github.com/pfrederiksen/configdiff/diff"
 	"github.com/pfrederiksen/configdiff/parse"
@@ -14,9 +22,10 @@ import (
 	"github.com/pfrederiksen/configdiff/tree"
 )
 
-// Re-export types from diff and patch packages for convenience.
+// Re-export types from diff, patch, and report packages for convenience.
 type (
-	// Options configures how diffs are computed.
+	// Options configures how diffs are computed. NewOptions builds them
+	// with the defaults of the command line, such as StableOrder.
 	Options = diff.Options
 
 	// Coercions defines rules for type coercion during comparison.
@@ -33,8 +42,40 @@ type (
 
 	// Operation is a single patch operation (JSON Patch-like).
 	Operation = patch.Operation
+
+	// MergeResult is the outcome of a three-way merge.
+	MergeResult = diff.MergeResult
+
+	// Conflict is a path changed differently on both sides of a three-way merge.
+	Conflict = diff.Conflict
+
+	// Summary counts changes by type.
+	Summary = report.Summary
+
+	// ParseError reports an input that is not valid in its format.
+	ParseError = parse.ParseError
 )
 
+// ErrUnsupportedFormat is returned for a format that cannot be parsed.
+var ErrUnsupportedFormat = parse.ErrUnsupportedFormat
+
+// DiffError is returned when comparing two parsed documents fails. Unlike
+// a *ReadError or a *ParseError, it is not caused by the inputs.
+type DiffError struct {
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DiffError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *DiffError) Unwrap() error {
+	return e.Err
+}
+
 // Re-export change type constants.
 const (
 	// ChangeTypeAdd indicates a new value was added.
@@ -58,56 +99,128 @@ type Result struct {
 	// Patch is the machine-readable patch representation.
 	Patch *Patch
 
-	// Report is the human-friendly pretty report.
+	// Report is the human-friendly pretty report, or empty if
+	// Options.SkipReport is set.
 	Report string
 }
 
+// RenderReport renders the changes of the result as a human-friendly
+// report with opts. With report.DefaultOptions it returns the Report that
+// DiffTrees generates unless Options.SkipReport is set.
+func (r *Result) RenderReport(opts report.Options) string {
+	return report.Generate(r.Changes, opts)
+}
+
+// HasChangesOfType reports whether the result contains a change of any of
+// the given types, or any change at all if no types are given.
+func (r *Result) HasChangesOfType(types ...ChangeType) bool {
+	if len(types) == 0 {
+		return len(r.Changes) > 0
+	}
+	for _, c := range r.Changes {
+		for _, t := range types {
+			if c.Type == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasChanges reports whether the result contains any change.
+func (r *Result) HasChanges() bool {
+	return len(r.Changes) > 0
+}
+
+// Summary counts the changes of the result by type.
+func (r *Result) Summary() Summary {
+	return report.Summarize(r.Changes)
+}
+
+// FilterByType returns the changes of any of the given types, in order.
+func (r *Result) FilterByType(types ...ChangeType) []Change {
+	var changes []Change
+	for _, c := range r.Changes {
+		if slices.Contains(types, c.Type) {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// FilterByPath returns the changes whose path matches glob, in order, with
+// the syntax of ignore paths (see diff.MatchPath).
+func (r *Result) FilterByPath(glob string) []Change {
+	var changes []Change
+	for _, c := range r.Changes {
+		if diff.MatchPath(c.Path, glob) {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// ChangedPaths returns the path of each change, in order.
+func (r *Result) ChangedPaths() []string {
+	if len(r.Changes) == 0 {
+		return nil
+	}
+	paths := make([]string, len(r.Changes))
+	for i, c := range r.Changes {
+		paths[i] = c.Path
+	}
+	return paths
+}
+
 // DiffBytes compares two configuration byte slices and returns the diff result.
+// Invalid options are reported before anything is parsed; see Options.Validate.
+// An input that does not parse is a *ParseError for the side "old" or "new",
+// and a format other than the supported ones is ErrUnsupportedFormat.
 //
-// Supported formats: "yaml", "json", "hcl"
+// Supported formats: "yaml", "json", "hcl", "toml"
 func DiffBytes(a []byte, aFormat string, b []byte, bFormat string, opts Options) (*Result, error) {
-	// Parse format a
-	aTree, err := parse.Parse(a, parse.Format(aFormat))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse format %s: %w", aFormat, err)
-	}
-
-	// Parse format b
-	var bTree *tree.Node
-	bTree, err = parse.Parse(b, parse.Format(bFormat))
+	d, err := NewDiffer(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse format %s: %w", bFormat, err)
+		return nil, err
 	}
-
-	return DiffTrees(aTree, bTree, opts)
+	return d.DiffBytes(a, aFormat, b, bFormat)
 }
 
-// DiffTrees compares two normalized tree nodes and returns the diff result.
+// DiffTrees compares two normalized tree nodes and returns the diff result,
+// or an error listing every problem with invalid options. Failures of the
+// comparison itself are a *DiffError.
 func DiffTrees(a, b *tree.Node, opts Options) (*Result, error) {
-	// Compute the diff
-	changes, err := diff.Diff(a, b, opts)
+	d, err := NewDiffer(opts)
 	if err != nil {
-		return nil, fmt.Errorf("diff failed: %w", err)
+		return nil, err
 	}
+	return d.DiffTrees(a, b)
+}
 
-	// Generate patch from changes
-	var patchObj *patch.Patch
-	patchObj, err = patch.FromChanges(changes)
+// DiffTreesContext compares two normalized tree nodes as DiffTrees does,
+// but gives up once ctx is done, returning a *DiffError wrapping ctx.Err(),
+// e.g. context.DeadlineExceeded.
+func DiffTreesContext(ctx context.Context, a, b *tree.Node, opts Options) (*Result, error) {
+	d, err := NewDiffer(opts)
 	if err != nil {
-		return nil, fmt.Errorf("patch generation failed: %w", err)
+		return nil, err
 	}
+	return d.DiffTreesContext(ctx, a, b)
+}
 
-	// Generate pretty report
-	reportText := report.GenerateDetailed(changes)
-
-	// Build result
-	result := &Result{
-		Changes: changes,
-		Patch:   patchObj,
-		Report:  reportText,
+// DiffValues compares two Go values, such as two configuration structs, and
+// returns the diff result. Each is converted with tree.FromValue, so struct
+// fields are named by their json tags and paths match those of the values
+// encoded as JSON or parsed from a file; a *tree.Node is used as is, to
+// compare a struct against a parsed document. Unexported fields are left
+// out, and values that cannot be encoded, such as functions and channels,
+// are an error.
+func DiffValues(a, b interface{}, opts Options) (*Result, error) {
+	d, err := NewDiffer(opts)
+	if err != nil {
+		return nil, err
 	}
-
-	return result, nil
+	return d.DiffValues(a, b)
 }
 
 // DiffYAML is a convenience function for comparing two YAML byte slices.
@@ -119,3 +232,21 @@ func DiffYAML(a, b []byte, opts Options) (*Result, error) {
 func DiffJSON(a, b []byte, opts Options) (*Result, error) {
 	return DiffBytes(a, "json", b, "json", opts)
 }
+
+// MarshalStableJSON encodes the result in the versioned JSON output schema
+// (see report.JSONOutput), naming the compared documents oldName and newName.
+// It is meant for other programs to read; to store a result and load it
+// back, marshal the Result itself and use LoadResult.
+func (r *Result) MarshalStableJSON(oldName, newName string) ([]byte, error) {
+	out, err := report.NewJSONOutput(r.Changes, oldName, newName, report.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// Diff3 performs a three-way merge of ours and theirs against their common
+// base, resolving non-conflicting changes from both sides. See diff.Diff3.
+func Diff3(base, ours, theirs *tree.Node, opts Options) (*MergeResult, error) {
+	return diff.Diff3(base, ours, theirs, opts)
+}
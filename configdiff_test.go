@@ -1,6 +1,25 @@
 package configdiff
 
-import "testing"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
+	"gopkg.in/yaml.v3"
+)
 
 func TestChangeTypeString(t *testing.T) {
 	tests := []struct {
@@ -46,3 +65,432 @@ func TestOptions(t *testing.T) {
 		t.Error("StableOrder = false, want true")
 	}
 }
+
+func TestResult_MarshalStableJSON(t *testing.T) {
+	result, err := DiffYAML([]byte("replicas: 2\nname: web\n"), []byte("replicas: 3\nname: web\n"), Options{})
+	if err != nil {
+		t.Fatalf("DiffYAML() error = %v", err)
+	}
+
+	data, err := result.MarshalStableJSON("old.yaml", "new.yaml")
+	if err != nil {
+		t.Fatalf("MarshalStableJSON() error = %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if got["schemaVersion"] != "1" || got["old"] != "old.yaml" || got["new"] != "new.yaml" {
+		t.Errorf("header = %v/%v/%v, want 1/old.yaml/new.yaml", got["schemaVersion"], got["old"], got["new"])
+	}
+	changes, _ := got["changes"].([]interface{})
+	if len(changes) != 1 {
+		t.Fatalf("changes = %v, want 1 change", got["changes"])
+	}
+	change := changes[0].(map[string]interface{})
+	if change["type"] != "modify" || change["path"] != "/replicas" || change["old"] != 2.0 || change["new"] != 3.0 || change["severity"] != "warning" {
+		t.Errorf("change = %v", change)
+	}
+}
+
+func TestLoadResult(t *testing.T) {
+	result, err := DiffYAML(
+		[]byte("replicas: 2\nimage: nginx:1.25\nports: [80]\nid: \"12345678901234567890\"\n"),
+		[]byte("replicas: \"2\"\nimage: nginx:1.26\nports: [80, 443]\nlabels: {tier: web}\nid: 12345678901234567890\n"),
+		Options{StableOrder: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result.Changes[1].OldHighlights = []diff.Span{{Start: 6, End: 10}}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	loaded, err := LoadResult(data)
+	if err != nil {
+		t.Fatalf("LoadResult() error = %v", err)
+	}
+	again, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatalf("Marshal() of loaded result error = %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("Marshal() of loaded result differs:\n%s\n%s", data, again)
+	}
+	if !reflect.DeepEqual(loaded.Changes, result.Changes) || loaded.Report != result.Report || loaded.Patch.Size() != result.Patch.Size() {
+		t.Errorf("LoadResult() = %+v, want %+v", loaded, result)
+	}
+
+	// The default encoding of Result before it had a version
+	unversioned := `{"Changes":[{"Type":"modify","Path":"/replicas","OldValue":{"Kind":2,"Value":2,"Object":null,"Array":null,"Path":"/replicas"},` +
+		`"NewValue":{"Kind":3,"Value":"2","Object":null,"Array":null,"Path":"/replicas"},"ArrayIndex":0}],` +
+		`"Patch":{"operations":[{"op":"replace","path":"/replicas","value":"2"}]},"Report":"~ /replicas"}`
+	loaded, err = LoadResult([]byte(unversioned))
+	if err != nil {
+		t.Fatalf("LoadResult() of an unversioned result error = %v", err)
+	}
+	if c := loaded.Changes[0]; len(loaded.Changes) != 1 || c.OldValue.Value != 2.0 || c.NewValue.Kind != tree.KindString || loaded.Patch.Size() != 1 || loaded.Report != "~ /replicas" {
+		t.Errorf("LoadResult() of an unversioned result = %+v", loaded)
+	}
+
+	for _, invalid := range []string{`{"version":2,"changes":[]}`, `{"version":0}`, `{"version":1,"changes":[{"type":"rename"}]}`, `[]`} {
+		if _, err := LoadResult([]byte(invalid)); err == nil {
+			t.Errorf("LoadResult(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+type testDeployment struct {
+	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string `json:"kind" yaml:"kind"`
+	Metadata   struct {
+		Name   string            `json:"name" yaml:"name"`
+		Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	} `json:"metadata" yaml:"metadata"`
+	Spec struct {
+		Replicas   int  `json:"replicas" yaml:"replicas"`
+		Paused     bool `json:"paused,omitempty" yaml:"paused,omitempty"`
+		Containers []struct {
+			Name  string   `json:"name" yaml:"name"`
+			Image string   `json:"image" yaml:"image"`
+			Args  []string `json:"args,omitempty" yaml:"args,omitempty"`
+			Ports []struct {
+				ContainerPort int    `json:"containerPort" yaml:"containerPort"`
+				Protocol      string `json:"protocol" yaml:"protocol"`
+			} `json:"ports" yaml:"ports"`
+			Resources map[string]map[string]string `json:"resources" yaml:"resources"`
+		} `json:"containers" yaml:"containers"`
+	} `json:"spec" yaml:"spec"`
+}
+
+func TestDiffValues(t *testing.T) {
+	var d testDeployment
+	data := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels: {app: web, tier: frontend}
+spec:
+  replicas: 3
+  containers:
+    - name: web
+      image: nginx:1.25
+      args: [--port, "8080"]
+      ports: [{containerPort: 8080, protocol: TCP}]
+      resources: {limits: {cpu: 500m, memory: 128Mi}}
+    - name: sidecar
+      image: envoy:1.30
+      ports: []
+      resources: {}
+`)
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := yaml.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parse.ParseYAML(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A struct and its YAML rendering are equal, path for path
+	result, err := DiffValues(d, parsed, Options{})
+	if err != nil {
+		t.Fatalf("DiffValues() error = %v", err)
+	}
+	if result.HasChanges() {
+		t.Errorf("DiffValues() of a struct and its YAML = %v, want no changes", result.ChangedPaths())
+	}
+
+	changed := d
+	changed.Spec.Replicas = 5
+	changed.Metadata.Labels = map[string]string{"app": "web"}
+	result, err = DiffValues(&d, &changed, Options{StableOrder: true, IgnorePaths: []string{"/metadata/labels/*"}})
+	if err != nil {
+		t.Fatalf("DiffValues() error = %v", err)
+	}
+	if got, want := result.ChangedPaths(), []string{"/spec/replicas"}; !slices.Equal(got, want) {
+		t.Errorf("DiffValues() changed paths = %v, want %v", got, want)
+	}
+	if result.Report == "" {
+		t.Error("DiffValues() generated no report")
+	}
+
+	_, err = DiffValues(d, struct{ Hook func() }{}, Options{})
+	if err == nil || !strings.Contains(err.Error(), "new value: /Hook: unsupported type func()") {
+		t.Errorf("DiffValues() error = %v, want the unsupported new field", err)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	old := []byte("name: web\nreplicas: 2\nports: [80]\n")
+	result, err := DiffYAML(old, []byte("name: web\nreplicas: 3\nports: [80, 443]\n"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		doc    string
+		format string
+		want   string
+	}{
+		{"yaml", string(old), "yaml", "name: web\nports:\n  - 80\n  - 443\nreplicas: 3\n"},
+		{"json", `{"name": "web", "replicas": 2, "ports": [80]}`, "json", "{\n  \"name\": \"web\",\n  \"ports\": [\n    80,\n    443\n  ],\n  \"replicas\": 3\n}\n"},
+		{"detected", `{"name": "web", "replicas": 2, "ports": [80]}`, "", "{\n  \"name\": \"web\",\n  \"ports\": [\n    80,\n    443\n  ],\n  \"replicas\": 3\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyPatch([]byte(tt.doc), tt.format, *result.Patch)
+			if err != nil {
+				t.Fatalf("ApplyPatch() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ApplyPatch() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	var parseErr *ParseError
+	if _, err := ApplyPatch([]byte("a: [\n"), "yaml", *result.Patch); !errors.As(err, &parseErr) {
+		t.Errorf("ApplyPatch() of invalid YAML error = %v, want a *ParseError", err)
+	}
+	var conflict *patch.ConflictError
+	if _, err := ApplyPatch([]byte("name: web\n"), "yaml", *result.Patch); !errors.As(err, &conflict) {
+		t.Errorf("ApplyPatch() to another document error = %v, want a *patch.ConflictError", err)
+	}
+	if _, err := ApplyPatch([]byte("replicas = 2\n"), "hcl", Patch{}); err == nil {
+		t.Error("ApplyPatch() to HCL succeeded, want an error")
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	result, err := DiffYAML([]byte("replicas: 2\nname: web\n"), []byte("replicas: 3\nimage: nginx\n"), Options{StableOrder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := report.Options{NoColor: true, ShowValues: true, OldFile: "old.yaml", NewFile: "new.yaml"}
+
+	for _, format := range []string{"report", "compact", "json", "patch", "stat", "side-by-side", "git-diff", "tree",
+		"markdown", "github-comment", "csv", "ndjson", "tap", "gh-annotations", "sarif"} {
+		t.Run(format, func(t *testing.T) {
+			got, err := RenderReport(result, format, opts)
+			if err != nil {
+				t.Fatalf("RenderReport() error = %v", err)
+			}
+			if !strings.Contains(got, "replicas") {
+				t.Errorf("RenderReport() does not show the changes:\n%s", got)
+			}
+		})
+	}
+
+	if got, _ := RenderReport(result, "report", opts); !strings.HasPrefix(got, "Comparing old.yaml") {
+		t.Errorf("report does not name the files:\n%s", got)
+	}
+	got, err := RenderReport(result, "patch", report.Options{FilterTypes: []ChangeType{ChangeTypeAdd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `"/image"`) || strings.Contains(got, "replicas") {
+		t.Errorf("patch of additions =\n%s", got)
+	}
+	for _, format := range []string{"unified", "template", "xml"} {
+		if _, err := RenderReport(result, format, opts); err == nil {
+			t.Errorf("RenderReport(%q) succeeded, want an error", format)
+		}
+	}
+}
+
+func TestResult_HasChangesOfType(t *testing.T) {
+	result, err := DiffYAML([]byte("replicas: 2\nname: web\n"), []byte("replicas: 3\nport: 80\n"), Options{})
+	if err != nil {
+		t.Fatalf("DiffYAML() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		types []ChangeType
+		want  bool
+	}{
+		{"any", nil, true},
+		{"modify", []ChangeType{ChangeTypeModify}, true},
+		{"move", []ChangeType{ChangeTypeMove}, false},
+		{"move or remove", []ChangeType{ChangeTypeMove, ChangeTypeRemove}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := result.HasChangesOfType(tt.types...); got != tt.want {
+				t.Errorf("HasChangesOfType(%v) = %v, want %v", tt.types, got, tt.want)
+			}
+		})
+	}
+
+	if (&Result{}).HasChangesOfType() {
+		t.Error("HasChangesOfType() of an empty result = true, want false")
+	}
+}
+
+func TestResult_Queries(t *testing.T) {
+	result := &Result{Changes: []Change{
+		{Type: ChangeTypeModify, Path: "/spec/replicas"},
+		{Type: ChangeTypeAdd, Path: "/spec/containers[0]/env"},
+		{Type: ChangeTypeRemove, Path: "/metadata/labels/tier"},
+		{Type: ChangeTypeModify, Path: "/spec/containers[0]/image"},
+	}}
+
+	if !result.HasChanges() || (&Result{}).HasChanges() {
+		t.Error("HasChanges() does not report whether there are changes")
+	}
+	if got, want := result.Summary(), (Summary{Total: 4, Added: 1, Removed: 1, Modified: 2}); got != want {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+
+	paths := func(changes []Change) []string {
+		return (&Result{Changes: changes}).ChangedPaths()
+	}
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"all paths", result.ChangedPaths(), []string{"/spec/replicas", "/spec/containers[0]/env", "/metadata/labels/tier", "/spec/containers[0]/image"}},
+		{"modify", paths(result.FilterByType(ChangeTypeModify)), []string{"/spec/replicas", "/spec/containers[0]/image"}},
+		{"add or remove", paths(result.FilterByType(ChangeTypeAdd, ChangeTypeRemove)), []string{"/spec/containers[0]/env", "/metadata/labels/tier"}},
+		{"move", paths(result.FilterByType(ChangeTypeMove)), nil},
+		{"no types", paths(result.FilterByType()), nil},
+		{"glob", paths(result.FilterByPath("/spec/**")), []string{"/spec/replicas", "/spec/containers[0]/env", "/spec/containers[0]/image"}},
+		{"exact", paths(result.FilterByPath("/spec/replicas")), []string{"/spec/replicas"}},
+		{"no match", paths(result.FilterByPath("/status/*")), nil},
+		{"empty result", (&Result{}).ChangedPaths(), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !slices.Equal(tt.got, tt.want) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipReport(t *testing.T) {
+	a, b := []byte(`{"replicas": 1, "image": "nginx:1.25"}`), []byte(`{"replicas": 3}`)
+	full, err := DiffJSON(a, b, Options{StableOrder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := DiffJSON(a, b, Options{StableOrder: true, SkipReport: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if full.Report == "" || skipped.Report != "" {
+		t.Errorf("Report = %q with and %q without SkipReport", full.Report, skipped.Report)
+	}
+	if len(skipped.Changes) != 2 || len(skipped.Patch.Operations) != 2 {
+		t.Errorf("SkipReport changed the changes %v or patch %v", skipped.Changes, skipped.Patch.Operations)
+	}
+	if got := skipped.RenderReport(report.DefaultOptions()); got != full.Report {
+		t.Errorf("RenderReport() =\n%s\nwant the generated Report\n%s", got, full.Report)
+	}
+}
+
+// largeDocuments returns two objects differing in n values.
+func largeDocuments(n int) (a, b *tree.Node) {
+	before, after := make(map[string]*tree.Node, n), make(map[string]*tree.Node, n)
+	for i := range n {
+		key := fmt.Sprintf("key%05d", i)
+		before[key] = tree.NewNumber(float64(i))
+		after[key] = tree.NewNumber(float64(i + 1))
+	}
+	return tree.NewObject(before), tree.NewObject(after)
+}
+
+func benchmarkDiffTrees(b *testing.B, opts Options) {
+	a, c := largeDocuments(50000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DiffTrees(a, c, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDiffTrees(b *testing.B) {
+	benchmarkDiffTrees(b, Options{StableOrder: true})
+}
+
+func BenchmarkDiffTrees_SkipReport(b *testing.B) {
+	benchmarkDiffTrees(b, Options{StableOrder: true, SkipReport: true})
+}
+
+func TestDiffFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	valid, invalid := filepath.Join(dir, "valid.yaml"), filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(valid, []byte("a: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := DiffFiles(valid, filepath.Join(dir, "missing.yaml"), Options{})
+	var readErr *ReadError
+	if !errors.As(err, &readErr) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("DiffFiles() of a missing file error = %v, want a *ReadError", err)
+	}
+
+	_, err = DiffFiles(invalid, valid, Options{})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != invalid || parseErr.Format != "json" {
+		t.Errorf("DiffFiles() of invalid JSON error = %v, want a *ParseError for %s as json", err, invalid)
+	}
+
+	if _, err := DiffFiles("-", "-", Options{}); err == nil {
+		t.Error("DiffFiles(-, -) succeeded, want an error")
+	}
+}
+
+func TestDiffReaders(t *testing.T) {
+	result, err := DiffReaders(strings.NewReader("a = 1\n"), strings.NewReader("a: 2\n"), "toml", "auto", Options{})
+	if err != nil {
+		t.Fatalf("DiffReaders() error = %v", err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Path != "/a" {
+		t.Errorf("DiffReaders() changes = %v, want /a modified", result.Changes)
+	}
+
+	_, err = DiffReaders(strings.NewReader("a: 1\n"), strings.NewReader(":\n:"), "", "", Options{})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Side != "new" || parseErr.Format != "" {
+		t.Errorf("DiffReaders() of undetectable input error = %v, want a *ParseError for new", err)
+	}
+
+	_, err = DiffReaders(iotest.ErrReader(errors.New("boom")), strings.NewReader("a: 1\n"), "yaml", "yaml", Options{})
+	var readErr *ReadError
+	if !errors.As(err, &readErr) || readErr.Side != "old" {
+		t.Errorf("DiffReaders() of a failing reader error = %v, want a *ReadError for old", err)
+	}
+}
+
+func TestDiffBytesErrors(t *testing.T) {
+	_, err := DiffBytes([]byte("a: 1\n"), "yaml", []byte("{\"a\": }"), "json", Options{})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Side != "new" || parseErr.Format != "json" || parseErr.Line != 1 {
+		t.Errorf("DiffBytes() of invalid JSON error = %v, want a *ParseError for new on line 1", err)
+	}
+
+	if _, err := DiffBytes([]byte("a"), "xml", []byte("a"), "xml", Options{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("DiffBytes() with format xml error = %v, want ErrUnsupportedFormat", err)
+	}
+
+	diffErr := &DiffError{Err: errors.New("diff failed")}
+	var target *DiffError
+	if !errors.As(fmt.Errorf("wrapped: %w", diffErr), &target) || target.Error() != "diff failed" {
+		t.Errorf("errors.As() did not find the *DiffError")
+	}
+}
@@ -2,10 +2,16 @@
 package diff
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pfrederiksen/configdiff/tree"
 )
@@ -26,6 +32,18 @@ type Change struct {
 
 	// ArrayIndex is set for array element changes (optional).
 	ArrayIndex int
+
+	// OldHighlights and NewHighlights mark the byte ranges of a modified
+	// string value that differ word-by-word from the other side (optional).
+	OldHighlights []Span `json:",omitempty"`
+	NewHighlights []Span `json:",omitempty"`
+}
+
+// IsKindChange reports whether c modifies a value into one of a different
+// kind, e.g. a string becoming an object.
+func (c Change) IsKindChange() bool {
+	return c.Type == ChangeTypeModify && c.OldValue != nil && c.NewValue != nil &&
+		c.OldValue.Kind != c.NewValue.Kind
 }
 
 // ChangeType categorizes the kind of change.
@@ -48,20 +66,46 @@ const (
 // Options configures how diffs are computed.
 type Options struct {
 	// IgnorePaths specifies paths to ignore in the diff.
-	// Supports glob-like patterns with wildcards (*).
+	// Supports glob-like patterns with wildcards (*). A pattern starting
+	// with "!" re-includes paths an earlier pattern ignored; the last
+	// matching pattern wins. An ignored object or array is still compared
+	// member by member when a "!" pattern may match below it.
 	// Example: []string{"metadata.creationTimestamp", "status.*"}
 	IgnorePaths []string
 
 	// ArraySetKeys maps array paths to their key field names.
-	// Arrays at these paths are treated as sets keyed by the specified field.
+	// Arrays at these paths are treated as sets keyed by the specified field,
+	// a string or number. Elements without the key field are compared by
+	// position among themselves. A path may contain "*" wildcards, as in
+	// IgnorePaths; an exact path takes precedence over patterns.
 	// Example: map[string]string{"/spec/containers": "name"}
 	ArraySetKeys map[string]string
 
 	// Coercions configures type coercion rules.
 	Coercions Coercions
 
-	// StableOrder ensures deterministic ordering in output.
+	// StableOrder sorts the changes by path. Without it they are in the
+	// order compared: depth first, with object keys in sorted order, which
+	// is as deterministic but puts e.g. "/a/b" before "/a-b".
 	StableOrder bool
+
+	// SkipReport leaves the Report of a configdiff.Result empty, saving the
+	// work of rendering it for callers that only use Changes or Patch; it
+	// can still be rendered with Result.RenderReport. The diff package
+	// itself ignores it.
+	SkipReport bool
+
+	// Incremental has configdiff compare two JSON objects one top-level
+	// member at a time, so that a member is parsed only when it is
+	// compared and released after, as it does for documents larger than
+	// configdiff.IncrementalThreshold. The diff package itself ignores it;
+	// see Incremental for comparing trees part by part.
+	Incremental bool
+
+	// Logger receives Debug events for the ignore rules and array keys that
+	// matched, with counts rather than one event per path, and Info events
+	// timing each comparison. Nil logs nothing.
+	Logger *slog.Logger
 }
 
 // Coercions defines rules for type coercion during comparison.
@@ -75,34 +119,181 @@ type Coercions struct {
 	BoolStrings bool
 }
 
+// Validate reports every problem with the options, joined into one error,
+// or nil if there are none. Diff and Diff3 call it before comparing.
+func (o Options) Validate() error {
+	var errs []error
+	for _, pattern := range o.IgnorePaths {
+		if strings.TrimPrefix(pattern, "!") == "" {
+			errs = append(errs, fmt.Errorf("ignore path %q is empty", pattern))
+		}
+	}
+
+	paths := make([]string, 0, len(o.ArraySetKeys))
+	for path := range o.ArraySetKeys {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		switch {
+		case path == "":
+			errs = append(errs, fmt.Errorf("array key path is empty, want \"/\" for the document root"))
+		case !strings.HasPrefix(path, "/"):
+			errs = append(errs, fmt.Errorf("array key path %q must start with \"/\", e.g. %q", path, "/"+strings.ReplaceAll(path, ".", "/")))
+		case path != "/" && slices.Contains(strings.Split(path[1:], "/"), ""):
+			errs = append(errs, fmt.Errorf("array key path %q has an empty segment", path))
+		}
+		if o.ArraySetKeys[path] == "" {
+			errs = append(errs, fmt.Errorf("array key field for %q is empty", path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Diff compares two trees and returns the detected changes.
 func Diff(a, b *tree.Node, opts Options) ([]Change, error) {
-	d := &differ{
-		opts:    opts,
-		changes: make([]Change, 0),
+	d, err := NewDiffer(opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.Diff(a, b)
+}
+
+// Differ compares trees with options validated and compiled once, for
+// comparing many documents with the same options. It is safe for
+// concurrent use by multiple goroutines.
+type Differ struct {
+	opts  Options
+	rules *rules
+}
+
+// NewDiffer validates opts and compiles their ignore paths and array keys.
+// The Differ keeps its own copy of them, so changing opts afterwards does
+// not change it.
+func NewDiffer(opts Options) (*Differ, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	opts.IgnorePaths = slices.Clone(opts.IgnorePaths)
+	opts.ArraySetKeys = maps.Clone(opts.ArraySetKeys)
+	return &Differ{opts: opts, rules: compileRules(opts)}, nil
+}
+
+// Diff compares two trees and returns the detected changes.
+func (dr *Differ) Diff(a, b *tree.Node) ([]Change, error) {
+	return dr.DiffContext(context.Background(), a, b)
+}
+
+// DiffContext compares two trees as Diff does, but stops and returns
+// ctx.Err() once ctx is done, e.g. to give up on documents that take too
+// long to compare. The context is checked every few thousand values.
+func (dr *Differ) DiffContext(ctx context.Context, a, b *tree.Node) ([]Change, error) {
+	inc := dr.Incremental()
+	if ctx.Done() != nil {
+		inc.d.ctx = ctx
 	}
+	inc.Diff(a, b, "/")
+	if err := inc.d.err; err != nil {
+		return nil, err
+	}
+	return inc.Changes(), nil
+}
 
-	d.diffNodes(a, b, "/")
+// Incremental compares two documents part by part, e.g. one top-level
+// member at a time, so that only the parts being compared need to be in
+// memory. Start one with Differ.Incremental.
+type Incremental struct {
+	dr    *Differ
+	d     *differ
+	start time.Time
+}
 
-	if opts.StableOrder {
+// Incremental starts a comparison of two documents part by part. The
+// changes found are those Diff finds comparing the whole documents, as
+// long as each part is compared once, except that no change moves a
+// value from one part to another.
+func (dr *Differ) Incremental() *Incremental {
+	inc := &Incremental{dr: dr, d: dr.newDiffer()}
+	if dr.opts.Logger != nil {
+		inc.start = time.Now()
+		inc.d.stats = newRuleStats(dr.rules)
+	}
+	return inc
+}
+
+// Diff compares a and b, the values at path of the two documents, either
+// of which may be nil where one document has no value. Path is a canonical
+// path such as "/metadata", which the paths of a and b should be set to.
+func (inc *Incremental) Diff(a, b *tree.Node, path string) {
+	inc.d.diffNodes(a, b, path)
+}
+
+// Changes returns the changes found comparing the parts so far, sorted by
+// path if the options ask for a stable order, otherwise in the order
+// compared.
+func (inc *Incremental) Changes() []Change {
+	d, dr := inc.d, inc.dr
+	if dr.opts.StableOrder {
 		sort.Slice(d.changes, func(i, j int) bool {
 			return d.changes[i].Path < d.changes[j].Path
 		})
 	}
 
-	return d.changes, nil
+	if dr.opts.Logger != nil {
+		d.stats.log(dr.opts.Logger, dr.rules)
+		dr.opts.Logger.Info("diff complete", "changes", len(d.changes), "duration", time.Since(inc.start))
+	}
+	return d.changes
+}
+
+// newDiffer returns the state of one comparison.
+func (dr *Differ) newDiffer() *differ {
+	return &differ{
+		opts:    dr.opts,
+		rules:   dr.rules,
+		changes: make([]Change, 0),
+	}
 }
 
 // differ holds state during diff operation.
 type differ struct {
 	opts    Options
+	rules   *rules
 	changes []Change
+	stats   *ruleStats // nil unless logging
+
+	// ctx is the context of DiffContext, nil if it cannot be done, and err
+	// its error once it is done, which stops the comparison
+	ctx     context.Context
+	err     error
+	visited int
+}
+
+// contextCheckInterval is the number of nodes compared between checks of
+// the context of DiffContext.
+const contextCheckInterval = 4096
+
+// stopped reports whether the comparison has stopped because the context
+// of DiffContext is done.
+func (d *differ) stopped() bool {
+	if d.ctx == nil || d.err != nil {
+		return d.err != nil
+	}
+	d.visited++
+	if d.visited%contextCheckInterval == 0 {
+		d.err = d.ctx.Err()
+	}
+	return d.err != nil
 }
 
 // diffNodes compares two nodes at a given path.
 func (d *differ) diffNodes(a, b *tree.Node, path string) {
+	if d.stopped() {
+		return
+	}
+
 	// Check if path should be ignored
-	if d.shouldIgnore(path) {
+	if d.shouldIgnore(path) && !d.reincludesBelow(path, a, b) {
 		return
 	}
 
@@ -149,11 +340,14 @@ func (d *differ) diffNodes(a, b *tree.Node, path string) {
 
 	case tree.KindBool, tree.KindNumber, tree.KindString:
 		if a.Value != b.Value {
+			oldSpans, newSpans := inlineHighlights(a, b)
 			d.addChange(Change{
-				Type:     ChangeTypeModify,
-				Path:     path,
-				OldValue: a,
-				NewValue: b,
+				Type:          ChangeTypeModify,
+				Path:          path,
+				OldValue:      a,
+				NewValue:      b,
+				OldHighlights: oldSpans,
+				NewHighlights: newSpans,
 			})
 		}
 
@@ -180,9 +374,7 @@ func (d *differ) diffObjects(a, b *tree.Node, path string) {
 		keys = append(keys, k)
 	}
 
-	if d.opts.StableOrder {
-		sort.Strings(keys)
-	}
+	sort.Strings(keys)
 
 	for _, key := range keys {
 		childPath := joinPath(path, key)
@@ -202,8 +394,11 @@ func (d *differ) diffObjects(a, b *tree.Node, path string) {
 // diffArrays compares two array nodes.
 func (d *differ) diffArrays(a, b *tree.Node, path string) {
 	// Check if this array should be treated as a set
-	keyField, isSet := d.opts.ArraySetKeys[path]
+	rule, keyField, isSet := d.rules.arrayKeyRule(path)
 	if isSet {
+		if d.stats != nil {
+			d.stats.keyed[rule]++
+		}
 		d.diffArrayAsSet(a, b, path, keyField)
 		return
 	}
@@ -233,15 +428,20 @@ func (d *differ) diffArrayAsSet(a, b *tree.Node, path, keyField string) {
 	aMap := make(map[string]*tree.Node)
 	bMap := make(map[string]*tree.Node)
 
+	var aKeyless, bKeyless []*tree.Node
 	for _, elem := range a.Array {
 		if key := d.extractKey(elem, keyField); key != "" {
 			aMap[key] = elem
+		} else {
+			aKeyless = append(aKeyless, elem)
 		}
 	}
 
 	for _, elem := range b.Array {
 		if key := d.extractKey(elem, keyField); key != "" {
 			bMap[key] = elem
+		} else {
+			bKeyless = append(bKeyless, elem)
 		}
 	}
 
@@ -259,9 +459,7 @@ func (d *differ) diffArrayAsSet(a, b *tree.Node, path, keyField string) {
 		keys = append(keys, k)
 	}
 
-	if d.opts.StableOrder {
-		sort.Strings(keys)
-	}
+	sort.Strings(keys)
 
 	// Compare elements by key
 	for _, key := range keys {
@@ -277,18 +475,58 @@ func (d *differ) diffArrayAsSet(a, b *tree.Node, path, keyField string) {
 			d.diffNodes(aElem, bElem, childPath)
 		}
 	}
+
+	// Elements without a key are compared by their position among the
+	// elements without one
+	for i := 0; i < len(aKeyless) || i < len(bKeyless); i++ {
+		var aElem, bElem *tree.Node
+		if i < len(aKeyless) {
+			aElem = aKeyless[i]
+		}
+		if i < len(bKeyless) {
+			bElem = bKeyless[i]
+		}
+		d.diffNodes(aElem, bElem, fmt.Sprintf("%s[%d]", path, i))
+	}
+}
+
+// ArraySetKey returns the key field of the array at path in keys, which
+// maps array paths or patterns to key fields as Options.ArraySetKeys does.
+// Of several matching patterns, the first in sorted order is used.
+func ArraySetKey(keys map[string]string, path string) (string, bool) {
+	if key, ok := keys[path]; ok {
+		return key, true
+	}
+	var patterns []string
+	for pattern := range keys {
+		if strings.Contains(pattern, "*") && MatchPath(path, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return "", false
+	}
+	sort.Strings(patterns)
+	return keys[patterns[0]], true
 }
 
-// extractKey extracts the key field value from an object node.
+// extractKey extracts the key field value from an object node: a string,
+// or a number in its shortest form.
 func (d *differ) extractKey(node *tree.Node, keyField string) string {
 	if node.Kind != tree.KindObject {
 		return ""
 	}
 	keyNode, exists := node.Object[keyField]
-	if !exists || keyNode.Kind != tree.KindString {
+	if !exists {
 		return ""
 	}
-	return keyNode.Value.(string)
+	switch keyNode.Kind {
+	case tree.KindString:
+		return keyNode.Value.(string)
+	case tree.KindNumber:
+		return keyNode.NumberString()
+	}
+	return ""
 }
 
 // canCoerce checks if two nodes can be considered equal via coercion.
@@ -297,12 +535,12 @@ func (d *differ) canCoerce(a, b *tree.Node) bool {
 	if d.opts.Coercions.NumericStrings {
 		if a.Kind == tree.KindString && b.Kind == tree.KindNumber {
 			if num, err := strconv.ParseFloat(a.Value.(string), 64); err == nil {
-				return num == b.Value.(float64)
+				return num == b.Float()
 			}
 		}
 		if a.Kind == tree.KindNumber && b.Kind == tree.KindString {
 			if num, err := strconv.ParseFloat(b.Value.(string), 64); err == nil {
-				return a.Value.(float64) == num
+				return a.Float() == num
 			}
 		}
 	}
@@ -332,16 +570,48 @@ func (d *differ) canCoerce(a, b *tree.Node) bool {
 
 // shouldIgnore checks if a path should be ignored.
 func (d *differ) shouldIgnore(path string) bool {
-	for _, pattern := range d.opts.IgnorePaths {
-		if matchPath(path, pattern) {
-			return true
-		}
+	i := d.rules.lastMatch(path)
+	if i < 0 {
+		return false
 	}
-	return false
+	if d.stats != nil {
+		d.stats.matched[i]++
+	}
+	return !d.rules.ignore[i].negated
+}
+
+// reincludesBelow reports whether the ignored path must still be descended
+// into because a "!" pattern may re-include a path below it. Only pairs of
+// objects or arrays are descended into.
+func (d *differ) reincludesBelow(path string, a, b *tree.Node) bool {
+	if a == nil || b == nil || a.Kind != b.Kind || (a.Kind != tree.KindObject && a.Kind != tree.KindArray) {
+		return false
+	}
+	return d.rules.reincludedBelow(path)
+}
+
+// matchPrefix reports whether pattern segments may match a path below the
+// path segments.
+func matchPrefix(pathSegs, patternSegs []string) bool {
+	if len(pathSegs) == 0 || (len(pathSegs) == 1 && pathSegs[0] == "") {
+		return len(patternSegs) > 0
+	}
+	if len(patternSegs) == 0 {
+		return false
+	}
+	if isWildcard(patternSegs[0]) {
+		return true
+	}
+	if pathSegs[0] != patternSegs[0] {
+		return false
+	}
+	return matchPrefix(pathSegs[1:], patternSegs[1:])
 }
 
-// matchPath checks if a path matches a pattern (supports * wildcard).
-func matchPath(path, pattern string) bool {
+// MatchPath checks if a path matches a glob-like pattern.
+// A "*" or "**" segment matches any number of path segments.
+// It is shared by ignore rules and patch path policies.
+func MatchPath(path, pattern string) bool {
 	// Simple implementation: support * as wildcard
 	// Convert pattern to segments
 	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
@@ -356,6 +626,21 @@ func matchPath(path, pattern string) bool {
 	return matchSegments(pathSegments, patternSegments)
 }
 
+// ValidatePathPattern returns an error if pattern is not a pattern MatchPath
+// can match: it must not be empty, and "*" and "**" only match as whole
+// segments, so a segment such as "db*" would never match.
+func ValidatePathPattern(pattern string) error {
+	if strings.Trim(pattern, "/") == "" && pattern != "/" {
+		return fmt.Errorf("invalid path pattern %q: must not be empty", pattern)
+	}
+	for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if strings.Contains(segment, "*") && !isWildcard(segment) {
+			return fmt.Errorf("invalid path pattern %q: a wildcard must be a whole segment, * or **", pattern)
+		}
+	}
+	return nil
+}
+
 // matchSegments checks if path segments match pattern segments.
 func matchSegments(pathSegs, patternSegs []string) bool {
 	if len(patternSegs) == 0 {
@@ -365,7 +650,7 @@ func matchSegments(pathSegs, patternSegs []string) bool {
 	if len(pathSegs) == 0 {
 		// Check if all remaining pattern segments are wildcards
 		for _, p := range patternSegs {
-			if p != "*" {
+			if !isWildcard(p) {
 				return false
 			}
 		}
@@ -373,7 +658,7 @@ func matchSegments(pathSegs, patternSegs []string) bool {
 	}
 
 	pattern := patternSegs[0]
-	if pattern == "*" {
+	if isWildcard(pattern) {
 		// Wildcard can match:
 		// 1. Nothing (move to next pattern segment)
 		// 2. One or more path segments (consume path segments)
@@ -394,6 +679,11 @@ func matchSegments(pathSegs, patternSegs []string) bool {
 	return matchSegments(pathSegs[1:], patternSegs[1:])
 }
 
+// isWildcard reports whether a pattern segment matches any number of segments.
+func isWildcard(segment string) bool {
+	return segment == "*" || segment == "**"
+}
+
 // addChange adds a change to the list.
 func (d *differ) addChange(c Change) {
 	d.changes = append(d.changes, c)
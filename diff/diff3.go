@@ -0,0 +1,226 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// Conflict is a path that ours and theirs changed differently from base in a
+// three-way merge. A nil value means the path is absent on that side.
+type Conflict struct {
+	// Path is the location of the conflict.
+	Path string
+
+	// Base, Ours, and Theirs are the values at Path in each input.
+	Base   *tree.Node
+	Ours   *tree.Node
+	Theirs *tree.Node
+}
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	// PreferOurs is the merged tree with every conflict resolved to ours.
+	PreferOurs *tree.Node
+
+	// PreferTheirs is the merged tree with every conflict resolved to theirs.
+	PreferTheirs *tree.Node
+
+	// Conflicts lists the conflicting paths in path order.
+	Conflicts []Conflict
+}
+
+// HasConflicts reports whether the merge has any conflicts. Without them,
+// PreferOurs and PreferTheirs are the same tree.
+func (r *MergeResult) HasConflicts() bool {
+	return len(r.Conflicts) > 0
+}
+
+// Diff3 merges the changes from base to ours and from base to theirs.
+//
+// Values are compared as Diff compares them, so opts decides what counts as
+// a change: ignored paths always keep ours, arrays in ArraySetKeys merge by
+// key so that reordering alone never conflicts, and Coercions apply. Objects
+// and keyed arrays changed on both sides are merged member by member;
+// positional arrays only if all three have the same length. Anything else
+// changed differently on both sides is a conflict.
+func Diff3(base, ours, theirs *tree.Node, opts Options) (*MergeResult, error) {
+	d, err := NewDiffer(opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.Diff3(base, ours, theirs)
+}
+
+// Diff3 merges the changes from base to ours and from base to theirs, as
+// the package-level Diff3 does with the Differ's options.
+func (d *Differ) Diff3(base, ours, theirs *tree.Node) (*MergeResult, error) {
+	if ours == nil || theirs == nil {
+		return nil, fmt.Errorf("three-way merge requires both ours and theirs")
+	}
+
+	start := time.Now()
+	m := &merger{opts: d.opts, differ: d}
+	preferOurs, preferTheirs := m.merge(base, ours, theirs, "/")
+	if preferOurs == nil || preferTheirs == nil {
+		// Both sides removed the root, which only happens when base is nil
+		return nil, fmt.Errorf("three-way merge produced an empty document")
+	}
+	if d.opts.Logger != nil {
+		d.opts.Logger.Info("merge complete", "conflicts", len(m.conflicts), "duration", time.Since(start))
+	}
+
+	return &MergeResult{
+		PreferOurs:   preferOurs.Clone(),
+		PreferTheirs: preferTheirs.Clone(),
+		Conflicts:    m.conflicts,
+	}, nil
+}
+
+// merger holds state during a three-way merge.
+type merger struct {
+	opts      Options
+	differ    *Differ
+	conflicts []Conflict
+}
+
+// merge merges the values at path, returning the result with conflicts
+// resolved to ours and to theirs. A nil result means the path is removed.
+func (m *merger) merge(base, ours, theirs *tree.Node, path string) (preferOurs, preferTheirs *tree.Node) {
+	if m.same(ours, theirs, path) || m.same(base, theirs, path) {
+		return ours, ours
+	}
+	// Only theirs changed. With ignore rules, containers are still merged
+	// below so that ignored paths inside them keep ours.
+	onlyTheirs := m.same(base, ours, path)
+	if onlyTheirs && len(m.opts.IgnorePaths) == 0 {
+		return theirs, theirs
+	}
+
+	// Merge containers of the same kind member by member
+	if ours != nil && theirs != nil && ours.Kind == theirs.Kind && (base == nil || base.Kind == ours.Kind) {
+		switch ours.Kind {
+		case tree.KindObject:
+			return m.mergeObjects(base, ours, theirs, path)
+		case tree.KindArray:
+			if keyField, isSet := m.differ.rules.arrayKey(path); isSet {
+				if o, t, ok := m.mergeArraySet(base, ours, theirs, path, keyField); ok {
+					return o, t
+				}
+			} else if base != nil && len(base.Array) == len(ours.Array) && len(ours.Array) == len(theirs.Array) {
+				return m.mergeArrays(base, ours, theirs, path)
+			}
+		}
+	}
+	if onlyTheirs {
+		return theirs, theirs
+	}
+
+	m.conflicts = append(m.conflicts, Conflict{Path: path, Base: base, Ours: ours, Theirs: theirs})
+	return ours, theirs
+}
+
+// same reports whether a and b have no differences at path under the diff
+// options, including ignored paths, array keys, and coercions.
+func (m *merger) same(a, b *tree.Node, path string) bool {
+	d := m.differ.newDiffer()
+	d.diffNodes(a, b, path)
+	return len(d.changes) == 0
+}
+
+// mergeObjects merges three objects key by key, in key order.
+func (m *merger) mergeObjects(base, ours, theirs *tree.Node, path string) (*tree.Node, *tree.Node) {
+	var baseObj map[string]*tree.Node
+	if base != nil {
+		baseObj = base.Object
+	}
+
+	allKeys := make(map[string]bool)
+	for _, obj := range []map[string]*tree.Node{baseObj, ours.Object, theirs.Object} {
+		for k := range obj {
+			allKeys[k] = true
+		}
+	}
+	keys := make([]string, 0, len(allKeys))
+	for k := range allKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	preferOurs := make(map[string]*tree.Node, len(keys))
+	preferTheirs := make(map[string]*tree.Node, len(keys))
+	for _, key := range keys {
+		o, t := m.merge(baseObj[key], ours.Object[key], theirs.Object[key], joinPath(path, key))
+		if o != nil {
+			preferOurs[key] = o
+		}
+		if t != nil {
+			preferTheirs[key] = t
+		}
+	}
+
+	return tree.NewObject(preferOurs), tree.NewObject(preferTheirs)
+}
+
+// mergeArrays merges three positional arrays of equal length element by element.
+func (m *merger) mergeArrays(base, ours, theirs *tree.Node, path string) (*tree.Node, *tree.Node) {
+	preferOurs := make([]*tree.Node, len(ours.Array))
+	preferTheirs := make([]*tree.Node, len(ours.Array))
+	for i := range ours.Array {
+		childPath := fmt.Sprintf("%s[%d]", path, i)
+		preferOurs[i], preferTheirs[i] = m.merge(base.Array[i], ours.Array[i], theirs.Array[i], childPath)
+	}
+	return tree.NewArray(preferOurs), tree.NewArray(preferTheirs)
+}
+
+// mergeArraySet merges three arrays as sets keyed by keyField. Elements keep
+// ours' order, followed by elements only theirs added, in theirs' order.
+// It returns false if any element lacks a key, leaving the array to conflict.
+func (m *merger) mergeArraySet(base, ours, theirs *tree.Node, path, keyField string) (*tree.Node, *tree.Node, bool) {
+	d := m.differ.newDiffer()
+	var order []string
+	seen := make(map[string]bool)
+	index := func(n *tree.Node) (map[string]*tree.Node, bool) {
+		elems := make(map[string]*tree.Node)
+		if n == nil {
+			return elems, true
+		}
+		for _, elem := range n.Array {
+			key := d.extractKey(elem, keyField)
+			if key == "" {
+				return nil, false
+			}
+			elems[key] = elem
+			if n != base && !seen[key] {
+				seen[key] = true
+				order = append(order, key)
+			}
+		}
+		return elems, true
+	}
+
+	// Elements removed on both sides appear only in base and stay removed
+	baseMap, baseOK := index(base)
+	oursMap, oursOK := index(ours)
+	theirsMap, theirsOK := index(theirs)
+	if !baseOK || !oursOK || !theirsOK {
+		return nil, nil, false
+	}
+
+	preferOurs := make([]*tree.Node, 0, len(order))
+	preferTheirs := make([]*tree.Node, 0, len(order))
+	for _, key := range order {
+		childPath := fmt.Sprintf("%s[%s=%s]", path, keyField, key)
+		o, t := m.merge(baseMap[key], oursMap[key], theirsMap[key], childPath)
+		if o != nil {
+			preferOurs = append(preferOurs, o)
+		}
+		if t != nil {
+			preferTheirs = append(preferTheirs, t)
+		}
+	}
+
+	return tree.NewArray(preferOurs), tree.NewArray(preferTheirs), true
+}
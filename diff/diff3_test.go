@@ -0,0 +1,182 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+func containers(images ...string) *tree.Node {
+	elems := make([]*tree.Node, 0, len(images)/2)
+	for i := 0; i < len(images); i += 2 {
+		elems = append(elems, tree.NewObject(map[string]*tree.Node{
+			"name":  tree.NewString(images[i]),
+			"image": tree.NewString(images[i+1]),
+		}))
+	}
+	return tree.NewArray(elems)
+}
+
+func TestDiff3(t *testing.T) {
+	obj := func(kvs map[string]*tree.Node) *tree.Node { return tree.NewObject(kvs) }
+
+	tests := []struct {
+		name          string
+		base          *tree.Node
+		ours          *tree.Node
+		theirs        *tree.Node
+		opts          Options
+		wantOurs      *tree.Node
+		wantTheirs    *tree.Node // defaults to wantOurs
+		wantConflicts []string
+	}{
+		{
+			name:     "changes on different keys merge",
+			base:     obj(map[string]*tree.Node{"a": tree.NewNumber(1), "b": tree.NewNumber(1), "c": tree.NewNumber(1)}),
+			ours:     obj(map[string]*tree.Node{"a": tree.NewNumber(2), "b": tree.NewNumber(1), "c": tree.NewNumber(1)}),
+			theirs:   obj(map[string]*tree.Node{"a": tree.NewNumber(1), "b": tree.NewNumber(1), "d": tree.NewNumber(4)}),
+			wantOurs: obj(map[string]*tree.Node{"a": tree.NewNumber(2), "b": tree.NewNumber(1), "d": tree.NewNumber(4)}),
+		},
+		{
+			name:     "same change on both sides",
+			base:     obj(map[string]*tree.Node{"a": tree.NewNumber(1)}),
+			ours:     obj(map[string]*tree.Node{"a": tree.NewNumber(2)}),
+			theirs:   obj(map[string]*tree.Node{"a": tree.NewNumber(2)}),
+			wantOurs: obj(map[string]*tree.Node{"a": tree.NewNumber(2)}),
+		},
+		{
+			name:          "different changes conflict",
+			base:          obj(map[string]*tree.Node{"a": tree.NewNumber(1), "b": tree.NewNumber(1)}),
+			ours:          obj(map[string]*tree.Node{"a": tree.NewNumber(2), "b": tree.NewNumber(2)}),
+			theirs:        obj(map[string]*tree.Node{"a": tree.NewNumber(3), "b": tree.NewNumber(1)}),
+			wantOurs:      obj(map[string]*tree.Node{"a": tree.NewNumber(2), "b": tree.NewNumber(2)}),
+			wantTheirs:    obj(map[string]*tree.Node{"a": tree.NewNumber(3), "b": tree.NewNumber(2)}),
+			wantConflicts: []string{"/a"},
+		},
+		{
+			name:          "modify against remove conflicts",
+			base:          obj(map[string]*tree.Node{"a": tree.NewNumber(1)}),
+			ours:          obj(map[string]*tree.Node{"a": tree.NewNumber(2)}),
+			theirs:        obj(map[string]*tree.Node{}),
+			wantOurs:      obj(map[string]*tree.Node{"a": tree.NewNumber(2)}),
+			wantTheirs:    obj(map[string]*tree.Node{}),
+			wantConflicts: []string{"/a"},
+		},
+		{
+			name:          "both add the same key differently",
+			base:          obj(map[string]*tree.Node{}),
+			ours:          obj(map[string]*tree.Node{"a": tree.NewString("x")}),
+			theirs:        obj(map[string]*tree.Node{"a": tree.NewString("y")}),
+			wantOurs:      obj(map[string]*tree.Node{"a": tree.NewString("x")}),
+			wantTheirs:    obj(map[string]*tree.Node{"a": tree.NewString("y")}),
+			wantConflicts: []string{"/a"},
+		},
+		{
+			name:     "nested objects merge",
+			base:     obj(map[string]*tree.Node{"spec": obj(map[string]*tree.Node{"a": tree.NewNumber(1), "b": tree.NewNumber(1)})}),
+			ours:     obj(map[string]*tree.Node{"spec": obj(map[string]*tree.Node{"a": tree.NewNumber(2), "b": tree.NewNumber(1)})}),
+			theirs:   obj(map[string]*tree.Node{"spec": obj(map[string]*tree.Node{"a": tree.NewNumber(1), "b": tree.NewNumber(2)})}),
+			wantOurs: obj(map[string]*tree.Node{"spec": obj(map[string]*tree.Node{"a": tree.NewNumber(2), "b": tree.NewNumber(2)})}),
+		},
+		{
+			name:     "positional arrays of equal length merge by index",
+			base:     tree.NewArray([]*tree.Node{tree.NewNumber(1), tree.NewNumber(2)}),
+			ours:     tree.NewArray([]*tree.Node{tree.NewNumber(9), tree.NewNumber(2)}),
+			theirs:   tree.NewArray([]*tree.Node{tree.NewNumber(1), tree.NewNumber(8)}),
+			wantOurs: tree.NewArray([]*tree.Node{tree.NewNumber(9), tree.NewNumber(8)}),
+		},
+		{
+			name:          "positional arrays of different length conflict",
+			base:          tree.NewArray([]*tree.Node{tree.NewNumber(1)}),
+			ours:          tree.NewArray([]*tree.Node{tree.NewNumber(1), tree.NewNumber(2)}),
+			theirs:        tree.NewArray([]*tree.Node{tree.NewNumber(1), tree.NewNumber(3)}),
+			wantOurs:      tree.NewArray([]*tree.Node{tree.NewNumber(1), tree.NewNumber(2)}),
+			wantTheirs:    tree.NewArray([]*tree.Node{tree.NewNumber(1), tree.NewNumber(3)}),
+			wantConflicts: []string{"/"},
+		},
+		{
+			name:     "keyed arrays merge by key despite reordering",
+			base:     obj(map[string]*tree.Node{"c": containers("a", "a1", "b", "b1")}),
+			ours:     obj(map[string]*tree.Node{"c": containers("b", "b1", "a", "a2")}),
+			theirs:   obj(map[string]*tree.Node{"c": containers("a", "a1", "b", "b2", "c", "c1")}),
+			opts:     Options{ArraySetKeys: map[string]string{"/c": "name"}},
+			wantOurs: obj(map[string]*tree.Node{"c": containers("b", "b2", "a", "a2", "c", "c1")}),
+		},
+		{
+			name:     "keyed arrays drop elements removed on either side",
+			base:     obj(map[string]*tree.Node{"c": containers("a", "a1", "b", "b1", "c", "c1")}),
+			ours:     obj(map[string]*tree.Node{"c": containers("a", "a1", "b", "b1")}),
+			theirs:   obj(map[string]*tree.Node{"c": containers("b", "b1", "c", "c1")}),
+			opts:     Options{ArraySetKeys: map[string]string{"/c": "name"}},
+			wantOurs: obj(map[string]*tree.Node{"c": containers("b", "b1")}),
+		},
+		{
+			name:          "keyed array elements changed on both sides conflict",
+			base:          obj(map[string]*tree.Node{"c": containers("a", "a1")}),
+			ours:          obj(map[string]*tree.Node{"c": containers("a", "a2")}),
+			theirs:        obj(map[string]*tree.Node{"c": containers("a", "a3")}),
+			opts:          Options{ArraySetKeys: map[string]string{"/c": "name"}},
+			wantOurs:      obj(map[string]*tree.Node{"c": containers("a", "a2")}),
+			wantTheirs:    obj(map[string]*tree.Node{"c": containers("a", "a3")}),
+			wantConflicts: []string{"/c[name=a]/image"},
+		},
+		{
+			name:     "ignored paths keep ours",
+			base:     obj(map[string]*tree.Node{"gen": tree.NewNumber(1), "a": tree.NewNumber(1)}),
+			ours:     obj(map[string]*tree.Node{"gen": tree.NewNumber(2), "a": tree.NewNumber(1)}),
+			theirs:   obj(map[string]*tree.Node{"gen": tree.NewNumber(3), "a": tree.NewNumber(2)}),
+			opts:     Options{IgnorePaths: []string{"/gen"}},
+			wantOurs: obj(map[string]*tree.Node{"gen": tree.NewNumber(2), "a": tree.NewNumber(2)}),
+		},
+		{
+			name:     "coerced values are unchanged",
+			base:     obj(map[string]*tree.Node{"port": tree.NewString("80")}),
+			ours:     obj(map[string]*tree.Node{"port": tree.NewNumber(80)}),
+			theirs:   obj(map[string]*tree.Node{"port": tree.NewNumber(8080)}),
+			opts:     Options{Coercions: Coercions{NumericStrings: true}},
+			wantOurs: obj(map[string]*tree.Node{"port": tree.NewNumber(8080)}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Diff3(tt.base, tt.ours, tt.theirs, tt.opts)
+			if err != nil {
+				t.Fatalf("Diff3() error = %v", err)
+			}
+
+			wantTheirs := tt.wantTheirs
+			if wantTheirs == nil {
+				wantTheirs = tt.wantOurs
+			}
+			if !result.PreferOurs.Equal(tt.wantOurs) {
+				t.Errorf("PreferOurs = %v, want %v", result.PreferOurs.ToInterface(), tt.wantOurs.ToInterface())
+			}
+			if !result.PreferTheirs.Equal(wantTheirs) {
+				t.Errorf("PreferTheirs = %v, want %v", result.PreferTheirs.ToInterface(), wantTheirs.ToInterface())
+			}
+
+			var paths []string
+			for _, c := range result.Conflicts {
+				paths = append(paths, c.Path)
+			}
+			if len(paths) != len(tt.wantConflicts) {
+				t.Fatalf("conflicts = %v, want %v", paths, tt.wantConflicts)
+			}
+			for i := range paths {
+				if paths[i] != tt.wantConflicts[i] {
+					t.Errorf("conflict %d = %s, want %s", i, paths[i], tt.wantConflicts[i])
+				}
+			}
+			if result.HasConflicts() != (len(tt.wantConflicts) > 0) {
+				t.Errorf("HasConflicts() = %v", result.HasConflicts())
+			}
+		})
+	}
+}
+
+func TestDiff3_Errors(t *testing.T) {
+	if _, err := Diff3(tree.NewNull(), nil, tree.NewNull(), Options{}); err == nil {
+		t.Error("Diff3() with nil ours should fail")
+	}
+}
@@ -1,6 +1,14 @@
 package diff
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/pfrederiksen/configdiff/tree"
@@ -429,6 +437,38 @@ func TestDiff_IgnorePaths(t *testing.T) {
 			},
 			wantCount: 1, // Only /data changed
 		},
+		{
+			name: "re-include with negated pattern",
+			a: tree.NewObject(map[string]*tree.Node{
+				"metadata": tree.NewObject(map[string]*tree.Node{
+					"timestamp": tree.NewString("old"),
+					"name":      tree.NewString("old"),
+				}),
+			}),
+			b: tree.NewObject(map[string]*tree.Node{
+				"metadata": tree.NewObject(map[string]*tree.Node{
+					"timestamp": tree.NewString("new"),
+					"name":      tree.NewString("new"),
+				}),
+			}),
+			opts: Options{
+				IgnorePaths: []string{"/metadata/*", "!/metadata/name"},
+			},
+			wantCount: 1, // Only /metadata/name changed
+		},
+		{
+			name: "last matching pattern wins",
+			a: tree.NewObject(map[string]*tree.Node{
+				"a": tree.NewString("old"),
+			}),
+			b: tree.NewObject(map[string]*tree.Node{
+				"a": tree.NewString("new"),
+			}),
+			opts: Options{
+				IgnorePaths: []string{"/a", "!/a", "/a"},
+			},
+			wantCount: 0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -477,6 +517,41 @@ func TestDiff_StableOrder(t *testing.T) {
 	}
 }
 
+func TestDiff_UnstableOrderIsDeterministic(t *testing.T) {
+	obj := map[string]*tree.Node{}
+	for i := 0; i < 30; i++ {
+		obj[fmt.Sprintf("key%02d", i)] = tree.NewObject(map[string]*tree.Node{"a": tree.NewNumber(float64(i))})
+	}
+	a := tree.NewObject(obj)
+	b := a.Clone()
+	for _, child := range b.Object {
+		child.Object["a"] = tree.NewNumber(-1)
+	}
+	a.SetPaths("/")
+	b.SetPaths("/")
+
+	// Without StableOrder, changes are in the order compared: keys sorted,
+	// depth first
+	first, err := Diff(a, b, Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	for i := range first {
+		if want := fmt.Sprintf("/key%02d/a", i); first[i].Path != want {
+			t.Fatalf("changes[%d].Path = %s, want %s", i, first[i].Path, want)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		again, err := Diff(a, b, Options{})
+		if err != nil {
+			t.Fatalf("Diff() error = %v", err)
+		}
+		if !reflect.DeepEqual(again, first) {
+			t.Fatalf("Diff() order differs between runs")
+		}
+	}
+}
+
 func TestDiff_ComplexExample(t *testing.T) {
 	// Kubernetes-like deployment diff
 	a := tree.NewObject(map[string]*tree.Node{
@@ -581,13 +656,377 @@ func TestMatchPath(t *testing.T) {
 		{"/metadata/name", "/metadata/*", true},
 		{"/other/timestamp", "/metadata/*", false},
 		{"/status/conditions/0/type", "/status/*", true},
+		{"/spec/template/spec/image", "/spec/**", true},
+		{"/metadata/name", "/spec/**", false},
+		{"/spec/containers[0]/image", "/spec/**/image", true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.path+" vs "+tt.pattern, func(t *testing.T) {
-			if got := matchPath(tt.path, tt.pattern); got != tt.want {
-				t.Errorf("matchPath(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+			if got := MatchPath(tt.path, tt.pattern); got != tt.want {
+				t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePathPattern(t *testing.T) {
+	for _, pattern := range []string{"/", "/spec/*", "/spec/**/image", "metadata/name"} {
+		if err := ValidatePathPattern(pattern); err != nil {
+			t.Errorf("ValidatePathPattern(%q) error = %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"", "//", "/spec/db*", "/**x/name"} {
+		if err := ValidatePathPattern(pattern); err == nil {
+			t.Errorf("ValidatePathPattern(%q) = nil, want error", pattern)
+		}
+	}
+}
+
+func TestInlineHighlights(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		wantOld []string
+		wantNew []string
+	}{
+		{
+			name:    "changed words",
+			old:     "host=db1 port=5432",
+			new:     "host=db2 port=5433",
+			wantOld: []string{"db1", "5432"},
+			wantNew: []string{"db2", "5433"},
+		},
+		{
+			name:    "inserted word",
+			old:     "a b",
+			new:     "a new b",
+			wantOld: nil,
+			wantNew: []string{"new "},
+		},
+		{
+			name: "nothing in common",
+			old:  "old",
+			new:  "new",
+		},
+		{
+			name:    "emoji with modifiers",
+			old:     "deploy \U0001F44D\U0001F3FD ok",
+			new:     "deploy \U0001F468\u200d\U0001F469\u200d\U0001F467 ok",
+			wantOld: []string{"\U0001F44D\U0001F3FD"},
+			wantNew: []string{"\U0001F468\u200d\U0001F469\u200d\U0001F467"},
+		},
+		{
+			name:    "combining characters",
+			old:     "cafe\u0301 open",
+			new:     "cafe open",
+			wantOld: []string{"cafe\u0301"},
+			wantNew: []string{"cafe"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Diff(tree.NewString(tt.old), tree.NewString(tt.new), Options{})
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if len(changes) != 1 {
+				t.Fatalf("got %d changes, want 1", len(changes))
+			}
+
+			gotOld := spanTexts(tt.old, changes[0].OldHighlights)
+			gotNew := spanTexts(tt.new, changes[0].NewHighlights)
+			if !equalStrings(gotOld, tt.wantOld) {
+				t.Errorf("OldHighlights = %q, want %q", gotOld, tt.wantOld)
+			}
+			if !equalStrings(gotNew, tt.wantNew) {
+				t.Errorf("NewHighlights = %q, want %q", gotNew, tt.wantNew)
+			}
+		})
+	}
+}
+
+func TestInlineHighlights_NonString(t *testing.T) {
+	changes, err := Diff(tree.NewNumber(1), tree.NewNumber(2), Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if changes[0].OldHighlights != nil || changes[0].NewHighlights != nil {
+		t.Errorf("expected no highlights for numbers, got %v / %v", changes[0].OldHighlights, changes[0].NewHighlights)
+	}
+}
+
+func spanTexts(s string, spans []Span) []string {
+	var out []string
+	for _, span := range spans {
+		out = append(out, s[span.Start:span.End])
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiff_ArraySetKeyPatterns(t *testing.T) {
+	port := func(published interface{}, target float64) *tree.Node {
+		fields := map[string]*tree.Node{"target": tree.NewNumber(target)}
+		switch p := published.(type) {
+		case string:
+			fields["published"] = tree.NewString(p)
+		case float64:
+			fields["published"] = tree.NewNumber(p)
+		}
+		return tree.NewObject(fields)
+	}
+	doc := func(ports ...*tree.Node) *tree.Node {
+		return tree.NewObject(map[string]*tree.Node{
+			"services": tree.NewObject(map[string]*tree.Node{
+				"web": tree.NewObject(map[string]*tree.Node{"ports": tree.NewArray(ports)}),
+			}),
+		})
+	}
+
+	a := doc(port(8080.0, 80), port(nil, 9000), port("443", 443))
+	b := doc(port("443", 443), port(nil, 9001), port(8080.0, 8080))
+	changes, err := Diff(a, b, Options{
+		ArraySetKeys: map[string]string{"/services/*/ports": "published"},
+		StableOrder:  true,
+	})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, string(c.Type)+" "+c.Path)
+	}
+	want := []string{
+		"modify /services/web/ports[0]/target",
+		"modify /services/web/ports[published=8080]/target",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+
+	if key, ok := ArraySetKey(map[string]string{"/a/*/b": "name", "/a/x/b": "id"}, "/a/x/b"); !ok || key != "id" {
+		t.Errorf("ArraySetKey() = %q, %v, want the exact path's key", key, ok)
+	}
+	if _, ok := ArraySetKey(map[string]string{"/a/*/b": "name"}, "/a/x/c"); ok {
+		t.Error("ArraySetKey() matched a path the pattern does not")
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	valid := Options{
+		IgnorePaths:  []string{"/status", "!/status/phase", "metadata.uid"},
+		ArraySetKeys: map[string]string{"/": "id", "/spec/*/containers": "name"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+	if err := (Options{}).Validate(); err != nil {
+		t.Errorf("Validate() of the zero value error = %v, want nil", err)
+	}
+
+	invalid := Options{
+		IgnorePaths:  []string{"", "/ok", "!"},
+		ArraySetKeys: map[string]string{"spec.containers": "name", "/spec//volumes": "name", "/spec/ports": "", "": "id"},
+	}
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want every problem listed")
+	}
+	want := []string{
+		`ignore path "" is empty`,
+		`ignore path "!" is empty`,
+		`array key path is empty, want "/" for the document root`,
+		`array key path "/spec//volumes" has an empty segment`,
+		`array key field for "/spec/ports" is empty`,
+		`array key path "spec.containers" must start with "/", e.g. "/spec/containers"`,
+	}
+	if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, err := Diff(tree.NewNull(), tree.NewNull(), invalid); err == nil {
+		t.Error("Diff() with invalid options succeeded, want an error")
+	}
+}
+
+func TestCompiledRules(t *testing.T) {
+	patterns := []string{"/a", "a/b/", "/a/*", "/a/**/c", "*", "/a/b[0]", "/", "!/a/b"}
+	paths := []string{"/", "/a", "/a/b", "/a/b/c", "/a/x/y/c", "/b", "/a/b[0]"}
+	for _, pattern := range patterns {
+		p := compilePattern(pattern)
+		for _, path := range paths {
+			if got, want := p.match(path), MatchPath(path, pattern); got != want {
+				t.Errorf("compiled %q matching %q = %v, MatchPath = %v", pattern, path, got, want)
 			}
+		}
+	}
+
+	keys := map[string]string{"/a/*": "name", "/a/b": "id", "/*/b": "key", "a/c": "other"}
+	r := compileRules(Options{ArraySetKeys: keys})
+	for _, path := range append(paths, "a/c") {
+		gotKey, gotOK := r.arrayKey(path)
+		wantKey, wantOK := ArraySetKey(keys, path)
+		if gotKey != wantKey || gotOK != wantOK {
+			t.Errorf("arrayKey(%q) = %q, %v, ArraySetKey = %q, %v", path, gotKey, gotOK, wantKey, wantOK)
+		}
+	}
+}
+
+func TestDiffLogger(t *testing.T) {
+	containers := func(image string) *tree.Node {
+		return tree.NewArray([]*tree.Node{
+			tree.NewObject(map[string]*tree.Node{"name": tree.NewString("web"), "image": tree.NewString(image)}),
 		})
 	}
+	doc := func(image, uid string) *tree.Node {
+		return tree.NewObject(map[string]*tree.Node{
+			"metadata": tree.NewObject(map[string]*tree.Node{"uid": tree.NewString(uid), "name": tree.NewString("web")}),
+			"spec":     tree.NewObject(map[string]*tree.Node{"containers": containers(image)}),
+		})
+	}
+
+	var buf bytes.Buffer
+	opts := Options{
+		IgnorePaths:  []string{"/metadata/*", "!/metadata/name", "/status"},
+		ArraySetKeys: map[string]string{"/spec/*": "name"},
+		Logger:       slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	changes, err := Diff(doc("nginx:1.25", "a"), doc("nginx:1.26", "b"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("changes = %v, want the image change", changes)
+	}
+
+	logged := buf.String()
+	for _, want := range []string{
+		`level=DEBUG msg="ignore rule matched" pattern=/metadata/* paths=2`,
+		`level=DEBUG msg="ignore rule re-included paths" pattern=!/metadata/name paths=1`,
+		`level=DEBUG msg="arrays compared as sets" path=/spec/* key=name arrays=1`,
+		`level=INFO msg="diff complete" changes=1 duration=`,
+	} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log missing %q:\n%s", want, logged)
+		}
+	}
+	if strings.Contains(logged, "/status") {
+		t.Errorf("log reports a rule that matched nothing:\n%s", logged)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	doc := func(replicas float64, image string, extra bool) *tree.Node {
+		obj := map[string]*tree.Node{
+			"metadata": tree.NewObject(map[string]*tree.Node{"uid": tree.NewString(image)}),
+			"spec": tree.NewObject(map[string]*tree.Node{
+				"replicas": tree.NewNumber(replicas),
+				"containers": tree.NewArray([]*tree.Node{
+					tree.NewObject(map[string]*tree.Node{"name": tree.NewString("web"), "image": tree.NewString(image)}),
+				}),
+			}),
+		}
+		if extra {
+			obj["status"] = tree.NewString("ready")
+		}
+		node := tree.NewObject(obj)
+		node.SetPaths("/")
+		return node
+	}
+	a, b := doc(1, "nginx:1.25", true), doc(3, "nginx:1.26", false)
+	opts := Options{
+		IgnorePaths:  []string{"/metadata/*"},
+		ArraySetKeys: map[string]string{"/spec/containers": "name"},
+		StableOrder:  true,
+	}
+	dr, err := NewDiffer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := dr.Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compared a top-level member at a time, in reverse order
+	inc := dr.Incremental()
+	for _, key := range []string{"status", "spec", "metadata"} {
+		inc.Diff(a.Object[key], b.Object[key], "/"+key)
+	}
+	if got := inc.Changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Incremental changes = %v, want %v", got, want)
+	}
+	if len(want) != 3 {
+		t.Errorf("Diff() = %v, want 3 changes", want)
+	}
+}
+
+func TestDiffContext(t *testing.T) {
+	a, b := make(map[string]*tree.Node), make(map[string]*tree.Node)
+	for i := range 2 * contextCheckInterval {
+		a[fmt.Sprintf("key%d", i)], b[fmt.Sprintf("key%d", i)] = tree.NewNumber(float64(i)), tree.NewNumber(float64(i+1))
+	}
+	aNode, bNode := tree.NewObject(a), tree.NewObject(b)
+	aNode.SetPaths("/")
+	bNode.SetPaths("/")
+	dr, err := NewDiffer(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := dr.DiffContext(context.Background(), aNode, bNode)
+	if err != nil || len(changes) != 2*contextCheckInterval {
+		t.Fatalf("DiffContext() = %d changes, %v, want %d changes", len(changes), err, 2*contextCheckInterval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if changes, err := dr.DiffContext(ctx, aNode, bNode); !errors.Is(err, context.Canceled) || changes != nil {
+		t.Errorf("DiffContext() with a canceled context = %d changes, %v, want context.Canceled", len(changes), err)
+	}
+	// The Differ is still usable
+	if changes, err := dr.Diff(aNode, bNode); err != nil || len(changes) != 2*contextCheckInterval {
+		t.Errorf("Diff() after a canceled DiffContext = %d changes, %v", len(changes), err)
+	}
+}
+
+// benchmarkDiffLogger compares two objects differing in n ignored and n
+// compared values.
+func benchmarkDiffLogger(b *testing.B, logger *slog.Logger) {
+	const n = 10000
+	a, c := make(map[string]*tree.Node, 2*n), make(map[string]*tree.Node, 2*n)
+	for i := range n {
+		a[fmt.Sprintf("key%d", i)], c[fmt.Sprintf("key%d", i)] = tree.NewNumber(float64(i)), tree.NewNumber(float64(i+1))
+		a[fmt.Sprintf("skip%d", i)], c[fmt.Sprintf("skip%d", i)] = tree.NewNumber(float64(i)), tree.NewNumber(float64(i+1))
+	}
+	opts := Options{IgnorePaths: []string{"/skip*"}, StableOrder: true, Logger: logger}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Diff(tree.NewObject(a), tree.NewObject(c), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDiff(b *testing.B) {
+	benchmarkDiffLogger(b, nil)
+}
+
+func BenchmarkDiff_Logger(b *testing.B) {
+	benchmarkDiffLogger(b, slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug})))
 }
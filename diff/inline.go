@@ -0,0 +1,174 @@
+package diff
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// InlineDiffMaxLen is the largest string, in bytes, for which inline
+// highlights are computed on modified string values.
+const InlineDiffMaxLen = 1024
+
+// Span is a half-open byte range [Start, End) within a string value.
+type Span struct {
+	Start int
+	End   int
+}
+
+// token is a word, whitespace run, or single symbol within a string.
+type token struct {
+	text  string
+	start int
+}
+
+// inlineHighlights computes the differing spans of two modified string values.
+// It returns nil spans when either value is not a string, is too long, or when
+// the values share no word in common (so highlighting would add nothing).
+func inlineHighlights(a, b *tree.Node) (oldSpans, newSpans []Span) {
+	if a == nil || b == nil || a.Kind != tree.KindString || b.Kind != tree.KindString {
+		return nil, nil
+	}
+	as, _ := a.Value.(string)
+	bs, _ := b.Value.(string)
+	if len(as) > InlineDiffMaxLen || len(bs) > InlineDiffMaxLen {
+		return nil, nil
+	}
+
+	at := tokenize(as)
+	bt := tokenize(bs)
+
+	// Longest common subsequence over tokens
+	lcs := make([][]int, len(at)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bt)+1)
+	}
+	for i := len(at) - 1; i >= 0; i-- {
+		for j := len(bt) - 1; j >= 0; j-- {
+			if at[i].text == bt[j].text {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	oldKeep := make([]bool, len(at))
+	newKeep := make([]bool, len(bt))
+	sharedWord := false
+	for i, j := 0, 0; i < len(at) && j < len(bt); {
+		switch {
+		case at[i].text == bt[j].text:
+			oldKeep[i], newKeep[j] = true, true
+			if !isSpace(at[i].text) {
+				sharedWord = true
+			}
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	if !sharedWord {
+		return nil, nil
+	}
+	return spansFor(at, oldKeep), spansFor(bt, newKeep)
+}
+
+// spansFor merges adjacent unkept tokens into byte spans.
+func spansFor(tokens []token, keep []bool) []Span {
+	var spans []Span
+	for i, t := range tokens {
+		if keep[i] {
+			continue
+		}
+		end := t.start + len(t.text)
+		if n := len(spans); n > 0 && spans[n-1].End == t.start {
+			spans[n-1].End = end
+			continue
+		}
+		spans = append(spans, Span{Start: t.start, End: end})
+	}
+	return spans
+}
+
+// tokenize splits s into words (letters and digits), whitespace runs, and
+// single symbols. Combining marks, variation selectors, emoji modifiers, and
+// zero-width-joiner sequences stay attached to the rune they modify, so a
+// token boundary never splits a user-perceived character.
+func tokenize(s string) []token {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		start := i
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		i = skipExtenders(s, i)
+
+		switch {
+		case isWordRune(r):
+			for i < len(s) {
+				next, n := utf8.DecodeRuneInString(s[i:])
+				if !isWordRune(next) {
+					break
+				}
+				i = skipExtenders(s, i+n)
+			}
+		case unicode.IsSpace(r):
+			for i < len(s) {
+				next, n := utf8.DecodeRuneInString(s[i:])
+				if !unicode.IsSpace(next) {
+					break
+				}
+				i += n
+			}
+		}
+
+		tokens = append(tokens, token{text: s[start:i], start: start})
+	}
+	return tokens
+}
+
+// skipExtenders advances past runes that extend the preceding character.
+func skipExtenders(s string, i int) int {
+	for i < len(s) {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\u200d':
+			// Zero width joiner glues the following rune to this character
+			i += n
+			if i < len(s) {
+				_, m := utf8.DecodeRuneInString(s[i:])
+				i += m
+			}
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc),
+			r >= 0xfe00 && r <= 0xfe0f,
+			r >= 0x1f3fb && r <= 0x1f3ff:
+			i += n
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// isWordRune reports whether r is part of a word token.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isSpace reports whether a token is entirely whitespace.
+func isSpace(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
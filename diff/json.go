@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// changeJSON is the JSON form of a Change.
+type changeJSON struct {
+	Type          ChangeType `json:"type"`
+	Path          string     `json:"path"`
+	OldValue      *tree.Node `json:"oldValue,omitempty"`
+	NewValue      *tree.Node `json:"newValue,omitempty"`
+	ArrayIndex    int        `json:"arrayIndex,omitempty"`
+	OldHighlights []spanJSON `json:"oldHighlights,omitempty"`
+	NewHighlights []spanJSON `json:"newHighlights,omitempty"`
+}
+
+// spanJSON is the JSON form of a Span.
+type spanJSON struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// MarshalJSON encodes the change with lower-case field names, its values
+// encoded by tree.Node.MarshalJSON, and empty fields left out.
+func (c Change) MarshalJSON() ([]byte, error) {
+	return json.Marshal(changeJSON{
+		Type:          c.Type,
+		Path:          c.Path,
+		OldValue:      c.OldValue,
+		NewValue:      c.NewValue,
+		ArrayIndex:    c.ArrayIndex,
+		OldHighlights: toSpanJSON(c.OldHighlights),
+		NewHighlights: toSpanJSON(c.NewHighlights),
+	})
+}
+
+// UnmarshalJSON decodes a change encoded by MarshalJSON.
+func (c *Change) UnmarshalJSON(data []byte) error {
+	var in changeJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	switch in.Type {
+	case ChangeTypeAdd, ChangeTypeRemove, ChangeTypeModify, ChangeTypeMove:
+	default:
+		return fmt.Errorf("unknown change type %q", in.Type)
+	}
+	*c = Change{
+		Type:          in.Type,
+		Path:          in.Path,
+		OldValue:      in.OldValue,
+		NewValue:      in.NewValue,
+		ArrayIndex:    in.ArrayIndex,
+		OldHighlights: fromSpanJSON(in.OldHighlights),
+		NewHighlights: fromSpanJSON(in.NewHighlights),
+	}
+	return nil
+}
+
+func toSpanJSON(spans []Span) []spanJSON {
+	if spans == nil {
+		return nil
+	}
+	out := make([]spanJSON, len(spans))
+	for i, s := range spans {
+		out[i] = spanJSON(s)
+	}
+	return out
+}
+
+func fromSpanJSON(spans []spanJSON) []Span {
+	if spans == nil {
+		return nil
+	}
+	out := make([]Span, len(spans))
+	for i, s := range spans {
+		out[i] = Span(s)
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package diff
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// rules are the ignore paths and array keys of Options compiled once, so
+// that matching a path does not split the same patterns again for every
+// node. They are not modified after compileRules and are safe to share.
+type rules struct {
+	ignore      []pathPattern
+	exactKeys   map[string]string
+	keyPatterns []keyPattern // in sorted order, the first match wins
+}
+
+// pathPattern is a compiled MatchPath pattern, or ignore path.
+type pathPattern struct {
+	negated  bool     // a "!" pattern, re-including what it matches
+	source   string   // the pattern as given, without the "!"
+	trimmed  string   // the pattern without surrounding slashes, for exact matches
+	segments []string // the pattern's segments, nil if it has no wildcard
+	prefix   []string // the pattern's segments, for matchPrefix
+}
+
+// keyPattern is an ArraySetKeys entry whose path has a wildcard.
+type keyPattern struct {
+	path    string
+	pattern pathPattern
+	key     string
+}
+
+// compilePattern compiles a MatchPath pattern.
+func compilePattern(pattern string) pathPattern {
+	var p pathPattern
+	p.trimmed = strings.Trim(pattern, "/")
+	p.prefix = strings.Split(p.trimmed, "/")
+	if strings.Contains(pattern, "*") {
+		p.segments = p.prefix
+	}
+	return p
+}
+
+// match reports whether the pattern matches path, as MatchPath does.
+func (p pathPattern) match(path string) bool {
+	if p.segments == nil {
+		return strings.Trim(path, "/") == p.trimmed
+	}
+	return matchSegments(strings.Split(strings.Trim(path, "/"), "/"), p.segments)
+}
+
+// compileRules compiles the ignore paths and array keys of opts.
+func compileRules(opts Options) *rules {
+	r := &rules{exactKeys: make(map[string]string, len(opts.ArraySetKeys))}
+	for _, pattern := range opts.IgnorePaths {
+		pattern, negated := strings.CutPrefix(pattern, "!")
+		p := compilePattern(pattern)
+		p.negated, p.source = negated, pattern
+		r.ignore = append(r.ignore, p)
+	}
+	for path, key := range opts.ArraySetKeys {
+		r.exactKeys[path] = key
+		if strings.Contains(path, "*") {
+			r.keyPatterns = append(r.keyPatterns, keyPattern{path: path, pattern: compilePattern(path), key: key})
+		}
+	}
+	sort.Slice(r.keyPatterns, func(i, j int) bool {
+		return r.keyPatterns[i].path < r.keyPatterns[j].path
+	})
+	return r
+}
+
+// ignored reports whether path is ignored: the last pattern matching it
+// wins.
+func (r *rules) ignored(path string) bool {
+	i := r.lastMatch(path)
+	return i >= 0 && !r.ignore[i].negated
+}
+
+// lastMatch returns the index of the last ignore pattern matching path, or
+// -1 if none does.
+func (r *rules) lastMatch(path string) int {
+	last := -1
+	for i, p := range r.ignore {
+		if p.match(path) {
+			last = i
+		}
+	}
+	return last
+}
+
+// reincludedBelow reports whether a "!" pattern may re-include a path below
+// path.
+func (r *rules) reincludedBelow(path string) bool {
+	var pathSegments []string
+	for _, p := range r.ignore {
+		if !p.negated {
+			continue
+		}
+		if pathSegments == nil {
+			pathSegments = strings.Split(strings.Trim(path, "/"), "/")
+		}
+		if matchPrefix(pathSegments, p.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// arrayKey returns the key field of the array at path, as ArraySetKey does.
+func (r *rules) arrayKey(path string) (string, bool) {
+	_, key, ok := r.arrayKeyRule(path)
+	return key, ok
+}
+
+// arrayKeyRule is like arrayKey, also returning the ArraySetKeys path that
+// set the key.
+func (r *rules) arrayKeyRule(path string) (rule, key string, ok bool) {
+	if key, ok := r.exactKeys[path]; ok {
+		return path, key, true
+	}
+	for _, kp := range r.keyPatterns {
+		if kp.pattern.match(path) {
+			return kp.path, kp.key, true
+		}
+	}
+	return "", "", false
+}
+
+// ruleStats counts how often each rule applied in one comparison, to be
+// logged once it is done rather than as each path is compared.
+type ruleStats struct {
+	matched []int          // paths decided by each ignore pattern, by index
+	keyed   map[string]int // arrays compared as sets, by ArraySetKeys path
+}
+
+func newRuleStats(r *rules) *ruleStats {
+	return &ruleStats{matched: make([]int, len(r.ignore)), keyed: make(map[string]int)}
+}
+
+// log logs a Debug event for each rule that applied.
+func (s *ruleStats) log(logger *slog.Logger, r *rules) {
+	for i, n := range s.matched {
+		if n == 0 {
+			continue
+		}
+		p := r.ignore[i]
+		if p.negated {
+			logger.Debug("ignore rule re-included paths", "pattern", "!"+p.source, "paths", n)
+		} else {
+			logger.Debug("ignore rule matched", "pattern", p.source, "paths", n)
+		}
+	}
+	for _, rule := range slices.Sorted(maps.Keys(s.keyed)) {
+		logger.Debug("arrays compared as sets", "path", rule, "key", r.exactKeys[rule], "arrays", s.keyed[rule])
+	}
+}
@@ -0,0 +1,95 @@
+package configdiff
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// Differ compares documents with options validated and compiled once. Use
+// one to compare many documents with the same options instead of calling
+// DiffTrees or DiffBytes, which build a Differ for every call.
+//
+// A Differ is safe for concurrent use by multiple goroutines: it is not
+// modified after NewDiffer, and keeps its own copy of the options, so that
+// changing the Options given to NewDiffer afterwards does not change it.
+// The documents compared are only read.
+type Differ struct {
+	differ      *diff.Differ
+	skipReport  bool
+	incremental bool
+	logger      *slog.Logger
+}
+
+// NewDiffer returns a Differ for opts, or an error listing every problem
+// with them; see Options.Validate.
+func NewDiffer(opts Options) (*Differ, error) {
+	d, err := diff.NewDiffer(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+	return &Differ{differ: d, skipReport: opts.SkipReport, incremental: opts.Incremental, logger: opts.Logger}, nil
+}
+
+// DiffBytes compares two configuration byte slices as the package-level
+// DiffBytes does.
+func (d *Differ) DiffBytes(a []byte, aFormat string, b []byte, bFormat string) (*Result, error) {
+	return d.diffInputs(bytesInput("old", "", a, aFormat, false), bytesInput("new", "", b, bFormat, false))
+}
+
+// DiffTrees compares two normalized tree nodes as the package-level
+// DiffTrees does.
+func (d *Differ) DiffTrees(a, b *tree.Node) (*Result, error) {
+	return d.DiffTreesContext(context.Background(), a, b)
+}
+
+// DiffTreesContext compares two normalized tree nodes as the package-level
+// DiffTreesContext does.
+func (d *Differ) DiffTreesContext(ctx context.Context, a, b *tree.Node) (*Result, error) {
+	// Compute the diff
+	changes, err := d.differ.DiffContext(ctx, a, b)
+	if err != nil {
+		return nil, &DiffError{Err: fmt.Errorf("diff failed: %w", err)}
+	}
+	return d.result(changes)
+}
+
+// result returns the result of a comparison that found changes.
+func (d *Differ) result(changes []Change) (*Result, error) {
+	// Generate patch from changes
+	patchObj, err := patch.FromChanges(changes)
+	if err != nil {
+		return nil, &DiffError{Err: fmt.Errorf("patch generation failed: %w", err)}
+	}
+
+	// Build result
+	result := &Result{
+		Changes: changes,
+		Patch:   patchObj,
+	}
+
+	// Generate pretty report
+	if !d.skipReport {
+		result.Report = report.GenerateDetailed(changes)
+	}
+
+	return result, nil
+}
+
+// DiffValues compares two Go values as the package-level DiffValues does.
+func (d *Differ) DiffValues(a, b interface{}) (*Result, error) {
+	aTree, err := tree.FromValue(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert old value: %w", err)
+	}
+	bTree, err := tree.FromValue(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert new value: %w", err)
+	}
+	return d.DiffTrees(aTree, bTree)
+}
@@ -0,0 +1,56 @@
+package configdiff
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestDiffer(t *testing.T) {
+	opts := Options{
+		IgnorePaths:  []string{"/metadata/*", "!/metadata/labels/*"},
+		ArraySetKeys: map[string]string{"/spec/*/containers": "name"},
+		StableOrder:  true,
+	}
+	d, err := NewDiffer(opts)
+	if err != nil {
+		t.Fatalf("NewDiffer() error = %v", err)
+	}
+	// The Differ keeps its own copy of the options
+	opts.IgnorePaths[0] = "/spec"
+	opts.ArraySetKeys["/spec/*/containers"] = "image"
+
+	oldDoc := []byte("metadata: {uid: a, labels: {app: web}}\nspec:\n  template:\n    containers:\n      - {name: web, image: web:1}\n      - {name: log, image: log:1}\n")
+	want := []string{"/metadata/labels/app", "/spec/template/containers[name=web]/image"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			newDoc := []byte(fmt.Sprintf("metadata: {uid: b%d, labels: {app: api}}\nspec:\n  template:\n    containers:\n      - {name: log, image: log:1}\n      - {name: web, image: web:%d}\n", i, i+2))
+			for j := 0; j < 50; j++ {
+				result, err := d.DiffBytes(oldDoc, "yaml", newDoc, "yaml")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if got := result.ChangedPaths(); !slices.Equal(got, want) {
+					errs <- fmt.Errorf("ChangedPaths() = %v, want %v", got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if _, err := NewDiffer(Options{ArraySetKeys: map[string]string{"spec": "name"}}); err == nil {
+		t.Error("NewDiffer() with invalid options succeeded, want an error")
+	}
+}
@@ -0,0 +1,103 @@
+package configdiff_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff"
+)
+
+func ExampleDiffFiles() {
+	opts, err := configdiff.NewOptions(
+		configdiff.WithIgnorePaths("/metadata/generation", "/metadata/creationTimestamp"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	result, err := configdiff.DiffFiles("testdata/config/deployment1.yaml", "testdata/config/deployment2.yaml", opts)
+	var parseErr *configdiff.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		fmt.Println("invalid", parseErr.Format, "in", parseErr.File)
+		return
+	case err != nil:
+		fmt.Println(err)
+		return
+	}
+
+	for _, c := range result.Changes {
+		fmt.Println(c.Type, c.Path)
+	}
+	// Output:
+	// modify /spec/containers[0]/image
+	// modify /spec/replicas
+}
+
+func ExampleDiffReaders() {
+	oldConfig := strings.NewReader("replicas: 2\nimage: nginx:1.19\n")
+	newConfig := strings.NewReader(`{"replicas": 3, "image": "nginx:1.19"}`)
+
+	// Formats are detected from the content
+	result, err := configdiff.DiffReaders(oldConfig, newConfig, "", "", configdiff.Options{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, c := range result.Changes {
+		fmt.Println(c.Type, c.Path, c.OldValue.Value, "->", c.NewValue.Value)
+	}
+	// Output:
+	// modify /replicas 2 -> 3
+}
+
+func ExampleNewOptions() {
+	opts, err := configdiff.NewOptions(
+		configdiff.WithIgnorePaths("/metadata/*", "!/metadata/labels"),
+		configdiff.WithArrayKey("/spec/containers", "name"),
+		configdiff.WithCoercions(configdiff.Coercions{NumericStrings: true}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	result, err := configdiff.DiffYAML(
+		[]byte("metadata: {uid: a}\nspec:\n  containers:\n    - {name: web, port: \"80\"}\n    - {name: log, port: 9000}\n"),
+		[]byte("metadata: {uid: b}\nspec:\n  containers:\n    - {name: log, port: 9001}\n    - {name: web, port: 80}\n"),
+		opts,
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(result.ChangedPaths())
+	// Output:
+	// [/spec/containers[name=log]/port]
+}
+
+func ExampleDiffValues() {
+	type Server struct {
+		Host    string   `json:"host"`
+		Port    int      `json:"port"`
+		Debug   bool     `json:"debug,omitempty"`
+		Origins []string `json:"origins"`
+	}
+
+	old := Server{Host: "0.0.0.0", Port: 8080, Origins: []string{"example.com"}}
+	updated := Server{Host: "0.0.0.0", Port: 9090, Debug: true, Origins: []string{"example.com"}}
+
+	result, err := configdiff.DiffValues(old, updated, configdiff.Options{StableOrder: true})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(result.ChangedPaths())
+	// Output:
+	// [/debug /port]
+}
@@ -0,0 +1,233 @@
+package configdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// ReadError is returned when an input cannot be read.
+type ReadError struct {
+	// Side is "old" or "new".
+	Side string
+
+	// File is the path of the input, "-" for stdin, or empty for the
+	// readers given to DiffReaders.
+	File string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ReadError) Error() string {
+	name := e.File
+	switch name {
+	case "":
+		name = e.Side
+	case "-":
+		name = "stdin"
+	}
+	return fmt.Sprintf("failed to read %s: %v", name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// DiffFiles compares two configuration files and returns the diff result.
+//
+// The format of each file is detected from its extension (.yaml, .yml,
+// .json, .hcl, .tf, .toml), or from its content otherwise; see
+// parse.DetectFileFormat. A path of "-" reads stdin, which only one of the
+// two can do. Invalid options are reported before anything is read. Errors
+// reading or parsing a file are a *ReadError or a *ParseError; a format
+// other than those is ErrUnsupportedFormat.
+//
+// Large JSON files are compared without reading them whole; see
+// IncrementalThreshold.
+func DiffFiles(oldPath, newPath string, opts Options) (*Result, error) {
+	if oldPath == "-" && newPath == "-" {
+		return nil, fmt.Errorf("old and new cannot both be stdin")
+	}
+	d, err := NewDiffer(opts)
+	if err != nil {
+		return nil, err
+	}
+	oldIn, err := openInput("old", oldPath)
+	if err != nil {
+		return nil, err
+	}
+	defer oldIn.close()
+	newIn, err := openInput("new", newPath)
+	if err != nil {
+		return nil, err
+	}
+	defer newIn.close()
+	return d.diffInputs(oldIn, newIn)
+}
+
+// DiffReaders compares two configurations read from oldR and newR and
+// returns the diff result.
+//
+// Formats are as for DiffBytes; "" or "auto" detects a format from the
+// content. Errors reading or parsing an input are a *ReadError or a
+// *ParseError for the side "old" or "new".
+func DiffReaders(oldR, newR io.Reader, oldFormat, newFormat string, opts Options) (*Result, error) {
+	d, err := NewDiffer(opts)
+	if err != nil {
+		return nil, err
+	}
+	oldIn, err := readInput("old", "", oldR, oldFormat)
+	if err != nil {
+		return nil, err
+	}
+	newIn, err := readInput("new", "", newR, newFormat)
+	if err != nil {
+		return nil, err
+	}
+	return d.diffInputs(oldIn, newIn)
+}
+
+// input is one side of a comparison: a document in memory, or a file that
+// is read as the comparison needs it, so that a large document can be
+// compared incrementally without reading it whole.
+type input struct {
+	// side is "old" or "new", and path the file, "-" for stdin, or empty.
+	side string
+	path string
+
+	// format is the format of the document, detected from path and the
+	// content if detect is set.
+	format string
+	detect bool
+
+	// data is the document if it is in memory, r reads it, and size is
+	// its length.
+	data []byte
+	r    io.ReaderAt
+	size int64
+
+	file *os.File
+}
+
+// bytesInput returns the input for a document in memory, in format or, for
+// "" or "auto" if detect is set, in the format detected.
+func bytesInput(side, path string, data []byte, format string, detect bool) *input {
+	return &input{
+		side:   side,
+		path:   path,
+		format: format,
+		detect: detect && (format == "" || format == "auto"),
+		data:   data,
+		r:      bytes.NewReader(data),
+		size:   int64(len(data)),
+	}
+}
+
+// readInput reads an input from r.
+func readInput(side, path string, r io.Reader, format string) (*input, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ReadError{Side: side, File: path, Err: err}
+	}
+	return bytesInput(side, path, data, format, true), nil
+}
+
+// openInput opens a file, or reads stdin for "-". The caller closes it.
+func openInput(side, path string) (*input, error) {
+	if path == "-" {
+		return readInput(side, path, os.Stdin, "")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &ReadError{Side: side, File: path, Err: err}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, &ReadError{Side: side, File: path, Err: err}
+	}
+	return &input{side: side, path: path, detect: true, r: f, size: info.Size(), file: f}, nil
+}
+
+// close closes the file of in, if any.
+func (in *input) close() {
+	if in.file != nil {
+		in.file.Close()
+	}
+}
+
+// tree reads the whole of in, if it is not in memory, and parses it.
+func (in *input) tree(logger *slog.Logger) (*tree.Node, error) {
+	data := in.data
+	if in.file != nil {
+		var err error
+		if data, err = io.ReadAll(io.NewSectionReader(in.r, 0, in.size)); err != nil {
+			return nil, &ReadError{Side: in.side, File: in.path, Err: err}
+		}
+	}
+	format := in.format
+	if in.detect {
+		format = string(parse.DetectFileFormat(in.path, data))
+		if format == "" {
+			return nil, &ParseError{Side: in.side, File: in.path, Err: fmt.Errorf("unable to detect format")}
+		}
+	}
+	return parseTree(logger, in.side, in.path, data, format)
+}
+
+// diffInputs compares two inputs: incrementally if the options ask for it
+// or either is larger than IncrementalThreshold and they can be, and whole
+// otherwise.
+func (d *Differ) diffInputs(a, b *input) (*Result, error) {
+	if d.incremental || IncrementalThreshold > 0 && max(a.size, b.size) > IncrementalThreshold {
+		if result, ok, err := d.diffIncremental(a, b); ok {
+			return result, err
+		}
+	}
+	aTree, err := a.tree(d.logger)
+	if err != nil {
+		return nil, err
+	}
+	bTree, err := b.tree(d.logger)
+	if err != nil {
+		return nil, err
+	}
+	return d.DiffTrees(aTree, bTree)
+}
+
+// parseTree parses one side of a comparison, logging how long it took.
+func parseTree(logger *slog.Logger, side, path string, data []byte, format string) (*tree.Node, error) {
+	start := time.Now()
+	node, err := parse.Parse(data, parse.Format(format))
+	if err != nil {
+		return nil, sideError(side, path, err)
+	}
+	if logger != nil {
+		attrs := []any{"side", side, "format", format, "bytes", len(data), "duration", time.Since(start)}
+		if path != "" {
+			attrs = append(attrs, "file", path)
+		}
+		logger.Info("parsed", attrs...)
+	}
+	return node, nil
+}
+
+// sideError returns err with the side and file of the input it is about
+// set, if it is a *ParseError.
+func sideError(side, file string, err error) error {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		pe.Side, pe.File = side, file
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package configdiff
+
+import (
+	"os"
+	"testing"
+)
+
+func FuzzDiffBytes(f *testing.F) {
+	for _, pair := range [][2]string{
+		{"testdata/config/deployment1.yaml", "testdata/config/deployment2.yaml"},
+		{"testdata/hcl/simple.hcl", "testdata/hcl/simple_modified.hcl"},
+	} {
+		a, err := os.ReadFile(pair[0])
+		if err != nil {
+			f.Fatal(err)
+		}
+		b, err := os.ReadFile(pair[1])
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(a, b, true)
+	}
+	f.Add([]byte(`{"a": [1, 2]}`), []byte(`{"a": [2, 1], "b": null}`), false)
+	f.Add([]byte("items: [{name: x, v: 1}]"), []byte("items: [{name: x, v: 2}, {name: y}]"), true)
+	f.Fuzz(func(t *testing.T, a, b []byte, coerce bool) {
+		opts := Options{
+			ArraySetKeys: map[string]string{"/items": "name"},
+			Coercions:    Coercions{NumericStrings: coerce, BoolStrings: coerce},
+		}
+		// Either document may be any format or garbage: only panics fail
+		for _, format := range []string{"", "yaml", "json", "hcl", "toml"} {
+			result, err := DiffBytes(a, format, b, format, opts)
+			if err == nil && result == nil {
+				t.Fatalf("DiffBytes(%q) returned no result and no error", format)
+			}
+		}
+	})
+}
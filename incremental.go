@@ -0,0 +1,231 @@
+package configdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// IncrementalThreshold is the size in bytes above which DiffBytes,
+// DiffReaders, and DiffFiles compare two documents incrementally, as if
+// Options.Incremental were set, when one of them is larger. 0 or less
+// turns this off.
+//
+// Compared incrementally, two JSON objects are read one top-level member
+// at a time with a streaming decoder: each pair of members is parsed,
+// compared, and released before the next, so that the memory needed is
+// proportional to the largest member, plus the changes found, rather than
+// to the documents. DiffFiles does not even read the files whole. The
+// changes are those of comparing the documents whole, except that:
+//   - no change moves a value from one top-level member to another;
+//   - parse.MaxSize and the other limits of the parse package apply to each
+//     member rather than to the whole document.
+//
+// Documents that are not both JSON objects, such as YAML or a JSON array,
+// are compared whole.
+var IncrementalThreshold int64 = 32 << 20
+
+// jsonMember is where the value of a member of a JSON object is in its
+// document.
+type jsonMember struct {
+	// keyEnd is the offset just past the member's key, and line the line
+	// of the key.
+	keyEnd int64
+	line   int
+
+	// start and end are the offsets of the value.
+	start, end int64
+}
+
+// jsonObject indexes the members of a JSON object by key, without their
+// values.
+type jsonObject struct {
+	members map[string]*jsonMember
+	keys    []string // in the order of the document
+}
+
+// diffIncremental compares a and b one top-level member at a time, as
+// described for IncrementalThreshold. It returns false, to compare them
+// whole, if they are not both JSON objects, which includes JSON that is not
+// valid: comparing it whole reports why.
+func (d *Differ) diffIncremental(a, b *input) (*Result, bool, error) {
+	aObj, ok := indexJSONObject(a)
+	if !ok {
+		return nil, false, nil
+	}
+	bObj, ok := indexJSONObject(b)
+	if !ok {
+		return nil, false, nil
+	}
+	if d.logger != nil {
+		d.logger.Info("comparing incrementally",
+			"old_bytes", a.size, "old_members", len(aObj.keys),
+			"new_bytes", b.size, "new_members", len(bObj.keys))
+	}
+
+	keys := aObj.keys
+	for _, key := range bObj.keys {
+		if aObj.members[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	inc := d.differ.Incremental()
+	for _, key := range keys {
+		aNode, err := aObj.parse(a, key)
+		if err != nil {
+			return nil, true, err
+		}
+		bNode, err := bObj.parse(b, key)
+		if err != nil {
+			return nil, true, err
+		}
+		inc.Diff(aNode, bNode, "/"+key)
+	}
+	result, err := d.result(inc.Changes())
+	return result, true, err
+}
+
+// indexJSONObject indexes the members of in, or returns false if in is not
+// a JSON object, in format "json" or detected as it.
+func indexJSONObject(in *input) (*jsonObject, bool) {
+	if !isJSONObject(in) {
+		return nil, false
+	}
+	dec := json.NewDecoder(io.NewSectionReader(in.r, 0, in.size))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+	obj := &jsonObject{members: make(map[string]*jsonMember)}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, false
+		}
+		m := &jsonMember{keyEnd: dec.InputOffset()}
+		// The value is read to find its end, and dropped
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		m.end = dec.InputOffset()
+		m.start = m.end - int64(len(value))
+		// Of duplicate keys the last wins, as when parsing whole
+		if obj.members[key] == nil {
+			obj.keys = append(obj.keys, key)
+		}
+		obj.members[key] = m
+	}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('}') {
+		return nil, false
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, false
+	}
+	if err := obj.setLines(in); err != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+// isJSONObject reports whether in is JSON, by its format or, if it is to
+// be detected, by its extension or its first character being "{".
+func isJSONObject(in *input) bool {
+	switch {
+	case !in.detect:
+		return in.format == string(parse.FormatJSON)
+	case strings.EqualFold(filepath.Ext(in.path), ".json"):
+		return true
+	}
+	head := make([]byte, 512)
+	n, _ := in.r.ReadAt(head, 0)
+	head = bytes.TrimLeft(head[:n], " \t\r\n")
+	return len(head) > 0 && head[0] == '{'
+}
+
+// setLines sets the line of each member of obj, counting the lines of in
+// up to their keys in one pass.
+func (obj *jsonObject) setLines(in *input) error {
+	members := make([]*jsonMember, 0, len(obj.members))
+	for _, m := range obj.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].keyEnd < members[j].keyEnd
+	})
+
+	r := io.NewSectionReader(in.r, 0, in.size)
+	buf := make([]byte, 64<<10)
+	var offset int64
+	line := 1
+	for _, m := range members {
+		for offset < m.keyEnd {
+			n, err := r.Read(buf[:min(int64(len(buf)), m.keyEnd-offset)])
+			line += bytes.Count(buf[:n], []byte("\n"))
+			offset += int64(n)
+			if err != nil {
+				return err
+			}
+		}
+		m.line = line
+	}
+	return nil
+}
+
+// parse reads and parses the value of the member key of in, indexed by
+// obj, or returns nil if there is no such member. Its paths and lines are
+// those it has in the document.
+func (obj *jsonObject) parse(in *input, key string) (*tree.Node, error) {
+	m := obj.members[key]
+	if m == nil {
+		return nil, nil
+	}
+	var data []byte
+	if in.data != nil {
+		data = in.data[m.keyEnd:m.end]
+	} else {
+		data = make([]byte, m.end-m.keyEnd)
+		if _, err := in.r.ReadAt(data, m.keyEnd); err != nil {
+			return nil, &ReadError{Side: in.side, File: in.path, Err: err}
+		}
+	}
+	// Lines before the value, which the parser counts from 1
+	before := m.line - 1 + bytes.Count(data[:m.start-m.keyEnd], []byte("\n"))
+
+	node, err := parse.ParseJSON(data[m.start-m.keyEnd:])
+	if err != nil {
+		var pe *ParseError
+		if errors.As(err, &pe) && pe.Line > 0 {
+			pe.Line += before
+		}
+		return nil, sideError(in.side, in.path, err)
+	}
+	node.SetPaths("/" + key)
+	shiftLines(node, before)
+	node.Line = m.line
+	return node, nil
+}
+
+// shiftLines adds n to the known lines of node and its descendants.
+func shiftLines(node *tree.Node, n int) {
+	if node.Line > 0 {
+		node.Line += n
+	}
+	for _, child := range node.Object {
+		shiftLines(child, n)
+	}
+	for _, elem := range node.Array {
+		shiftLines(elem, n)
+	}
+}
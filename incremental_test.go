@@ -0,0 +1,155 @@
+package configdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeLargeJSON writes a JSON object of members objects, each with an
+// array of elems items, to w. Version changes one item of every member and
+// adds and removes a member, so that two versions differ in each.
+func writeLargeJSON(w io.Writer, members, elems, version int) error {
+	if _, err := io.WriteString(w, "{\n"); err != nil {
+		return err
+	}
+	for i := range members {
+		items := make([]map[string]any, elems)
+		for j := range items {
+			items[j] = map[string]any{"id": fmt.Sprintf("item-%d", j), "value": j, "enabled": true}
+		}
+		items[(i+version)%elems]["value"] = -version
+		member, err := json.MarshalIndent(map[string]any{"name": fmt.Sprintf("member %d", i), "items": items}, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "  \"member%06d\": %s,\n", i+version, member); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "  \"version\": %d\n}\n", version)
+	return err
+}
+
+func largeJSON(t *testing.T, members, elems, version int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeLargeJSON(&buf, members, elems, version); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDiffIncremental(t *testing.T) {
+	docs := []struct {
+		name string
+		a, b []byte
+	}{
+		{"generated", largeJSON(t, 20, 10, 0), largeJSON(t, 20, 10, 1)},
+		{"keys sharing a prefix", []byte(`{"a": {"x": 1}, "a-b": 1, "a.b": [1]}`), []byte(`{"a-b": 2, "a": {"x": 2}, "a.b": [2, 3]}`)},
+		{"duplicate keys", []byte(`{"a": 1, "b": 1, "a": 2}`), []byte(`{"a": 3, "b": 1}`)},
+		{"empty", []byte(` {} `), []byte("{\n  \"a\": null\n}")},
+		{"nested lines", []byte("{\n  \"a\":\n\n    {\n      \"b\": 1}}"), []byte("{\"a\": {\"b\": 2}}")},
+	}
+	optionSets := []Options{
+		{StableOrder: true},
+		{StableOrder: true, IgnorePaths: []string{"/member*/name", "/a"}, ArraySetKeys: map[string]string{"/*/items": "id"}},
+		{StableOrder: true, Coercions: Coercions{NumericStrings: true}},
+	}
+	for _, doc := range docs {
+		for i, opts := range optionSets {
+			t.Run(fmt.Sprintf("%s/%d", doc.name, i), func(t *testing.T) {
+				whole, err := DiffJSON(doc.a, doc.b, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts.Incremental = true
+				incremental, err := DiffJSON(doc.a, doc.b, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(incremental, whole) {
+					t.Errorf("incremental result =\n%s\nwant\n%s", incremental.Report, whole.Report)
+				}
+			})
+		}
+	}
+}
+
+func TestDiffFilesIncremental(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "old.json"), filepath.Join(dir, "new")
+	if err := os.WriteFile(oldPath, largeJSON(t, 30, 5, 0), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, largeJSON(t, 30, 5, 2), 0600); err != nil {
+		t.Fatal(err)
+	}
+	whole, err := DiffFiles(oldPath, newPath, Options{StableOrder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(threshold int64) { IncrementalThreshold = threshold }(IncrementalThreshold)
+	IncrementalThreshold = 1024
+	var log bytes.Buffer
+	opts := Options{StableOrder: true, Logger: slog.New(slog.NewTextHandler(&log, nil))}
+	incremental, err := DiffFiles(oldPath, newPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "comparing incrementally") {
+		t.Errorf("files larger than IncrementalThreshold were not compared incrementally; log:\n%s", log.String())
+	}
+	opts.Logger = nil
+	if !reflect.DeepEqual(incremental, whole) {
+		t.Errorf("incremental result =\n%s\nwant\n%s", incremental.Report, whole.Report)
+	}
+}
+
+func TestDiffIncrementalFallback(t *testing.T) {
+	opts := Options{StableOrder: true, Incremental: true}
+	tests := []struct {
+		name             string
+		a, b             string
+		aFormat, bFormat string
+		want             []string
+	}{
+		{"YAML", "a: 1\n", `{"a": 2}`, "yaml", "json", []string{"/a"}},
+		{"arrays", `[1, 2]`, `[1, 3]`, "json", "json", []string{"/[1]"}},
+		{"object and array", `{"a": 1}`, `[1]`, "json", "json", []string{"/"}},
+		{"trailing data", `{"a": 1} {}`, `{"a": 1}`, "json", "json", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := DiffBytes([]byte(tt.a), tt.aFormat, []byte(tt.b), tt.bFormat, opts)
+			if tt.want == nil {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) || parseErr.Side != "old" {
+					t.Fatalf("DiffBytes() error = %v, want a *ParseError for old", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DiffBytes() error = %v", err)
+			}
+			if got := result.ChangedPaths(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := DiffBytes([]byte("{\n\"a\": 1,\n\"b\": [1,]\n}"), "json", []byte(`{}`), "json", opts)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Side != "old" || parseErr.Line != 3 {
+		t.Errorf("DiffBytes() of invalid JSON error = %v, want a *ParseError for old on line 3", err)
+	}
+}
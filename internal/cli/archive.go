@@ -0,0 +1,426 @@
+package cli
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/parse"
+)
+
+// DefaultMaxEntrySize caps the size of a file read from an archive at 32 MiB.
+const DefaultMaxEntrySize = 32 << 20
+
+// DefaultMaxArchiveBytes caps the total size of the files held in memory
+// from a tar archive while it is compared as a directory at 256 MiB.
+const DefaultMaxArchiveBytes = 256 << 20
+
+// IsArchivePath reports whether a path names a tar, gzipped tar, or zip
+// archive by its extension.
+func IsArchivePath(p string) bool {
+	lower := strings.ToLower(p)
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsArchive reports whether a path is an archive file on disk, which is
+// compared like a directory.
+func IsArchive(p string) bool {
+	if !IsArchivePath(p) {
+		return false
+	}
+	info, err := os.Stat(p)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// SplitArchivePath splits an argument of the form "archive.tgz!path/inside.yaml"
+// into the archive and the path of a file inside it. ok is false for other
+// paths and for files whose name merely looks like one.
+func SplitArchivePath(arg string) (archive, inner string, ok bool) {
+	if _, err := os.Stat(arg); err == nil {
+		return arg, "", false
+	}
+	for i := strings.Index(arg, "!"); i >= 0; {
+		if IsArchivePath(arg[:i]) && i+1 < len(arg) {
+			return arg[:i], arg[i+1:], true
+		}
+		next := strings.Index(arg[i+1:], "!")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return arg, "", false
+}
+
+// JoinArchivePath returns the "archive!inner" form of a file inside an archive.
+func JoinArchivePath(archive, inner string) string {
+	return archive + "!" + inner
+}
+
+// entryName returns the name of an archive entry with its first strip
+// directories removed, or "" if the entry is not that deep.
+func entryName(name string, strip int) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	for i := 0; i < strip; i++ {
+		_, rest, ok := strings.Cut(name, "/")
+		if !ok {
+			return ""
+		}
+		name = rest
+	}
+	return name
+}
+
+// isZip reports whether an archive is a zip archive rather than a tar.
+func isZip(archive string) bool {
+	return strings.HasSuffix(strings.ToLower(archive), ".zip")
+}
+
+// isConfigName reports whether a file in an archive has the extension of
+// a configuration format, making it one a directory comparison reads.
+func isConfigName(name string) bool {
+	return parse.DetectFileFormat(name, nil) != ""
+}
+
+// errEntryTooLarge is the error reading an archive entry larger than
+// DefaultMaxEntrySize.
+var errEntryTooLarge = fmt.Errorf("entry exceeds %d bytes", DefaultMaxEntrySize)
+
+// errStopWalk stops walkTar once the entry sought is found.
+var errStopWalk = errors.New("stop walking archive")
+
+// readEntryData reads the content of an archive entry, up to
+// DefaultMaxEntrySize.
+func readEntryData(r io.Reader) ([]byte, error) {
+	// Read one byte past the cap to tell a full-size entry from a larger one
+	data, err := io.ReadAll(io.LimitReader(r, DefaultMaxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > DefaultMaxEntrySize {
+		return nil, errEntryTooLarge
+	}
+	return data, nil
+}
+
+// walkTar calls fn with the stripped name, size, and content of every
+// regular file in a tar or gzipped tar archive, one at a time, without
+// unpacking the rest.
+func walkTar(archive string, strip int, fn func(name string, size int64, r io.Reader) error) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %q: %w", archive, err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if lower := strings.ToLower(archive); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open archive %q: %w", archive, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive %q: %w", archive, err)
+		}
+		name := entryName(hdr.Name, strip)
+		if name == "" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(name, hdr.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// scanTar reads the first file named name from a tar archive, or returns
+// nil if there is none.
+func scanTar(archive string, strip int, name string) (*archiveEntry, error) {
+	var entry *archiveEntry
+	err := walkTar(archive, strip, func(n string, size int64, r io.Reader) error {
+		if n != name {
+			return nil
+		}
+		entry = &archiveEntry{size: size, read: true}
+		if size <= DefaultMaxEntrySize {
+			entry.data, entry.err = readEntryData(r)
+		}
+		return errStopWalk
+	})
+	if err != nil && err != errStopWalk {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// readZipEntry reads a file from a zip archive at the offset its index
+// recorded.
+func readZipEntry(archive string, entry *archiveEntry) ([]byte, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = io.NewSectionReader(file, entry.offset, entry.compressed)
+	switch entry.method {
+	case zip.Store:
+	case zip.Deflate:
+		fr := flate.NewReader(r)
+		defer fr.Close()
+		r = fr
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	return readEntryData(r)
+}
+
+// archiveEntry is a file in an archive's index: its size and, in a zip
+// archive, where its compressed data is. Files of a tar archive read while
+// indexing it have read set, and their content or the error reading it.
+type archiveEntry struct {
+	size int64
+
+	offset     int64
+	compressed int64
+	method     uint16
+
+	read bool
+	data []byte
+	err  error
+}
+
+// archiveIndex is the files of an archive, listed in a single pass the
+// first time a directory comparison needs them. A zip archive's files are
+// then read from their offsets. A gzipped tar can only be read from the
+// start, so walking it again for each file would decompress it once per
+// file; instead the pass also reads its config files, which are the ones
+// the comparison reads, up to DefaultMaxArchiveBytes in all. Other files,
+// and any past that budget, are read with a pass of their own.
+type archiveIndex struct {
+	once    sync.Once
+	size    int64
+	modTime time.Time
+	names   []string
+	entries map[string]*archiveEntry
+	err     error
+}
+
+// archiveIndexKey identifies an index by the archive and the number of
+// directories stripped from its names.
+type archiveIndexKey struct {
+	archive string
+	strip   int
+}
+
+// archiveIndexes holds the index of each archive being compared as a
+// directory, until ReleaseArchive drops it. An index is also dropped when
+// the archive's size or modification time changes.
+var (
+	archiveIndexesMu sync.Mutex
+	archiveIndexes   = map[archiveIndexKey]*archiveIndex{}
+)
+
+// indexArchive returns the index of an archive, reading it on first use.
+func indexArchive(archive string, strip int) (*archiveIndex, error) {
+	return lookupArchiveIndex(archive, strip, true)
+}
+
+// lookupArchiveIndex returns the index of an archive, creating it if
+// create is set, or else returning nil if there is none.
+func lookupArchiveIndex(archive string, strip int, create bool) (*archiveIndex, error) {
+	info, err := os.Stat(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive %q: %w", archive, err)
+	}
+
+	key := archiveIndexKey{archive: archive, strip: strip}
+	archiveIndexesMu.Lock()
+	idx := archiveIndexes[key]
+	if idx == nil || idx.size != info.Size() || !idx.modTime.Equal(info.ModTime()) {
+		if !create {
+			archiveIndexesMu.Unlock()
+			return nil, nil
+		}
+		idx = &archiveIndex{size: info.Size(), modTime: info.ModTime()}
+		archiveIndexes[key] = idx
+	}
+	archiveIndexesMu.Unlock()
+
+	idx.once.Do(func() {
+		idx.err = idx.build(archive, strip)
+	})
+	if idx.err != nil {
+		return nil, idx.err
+	}
+	return idx, nil
+}
+
+// build lists the files of an archive into the index.
+func (idx *archiveIndex) build(archive string, strip int) error {
+	idx.entries = make(map[string]*archiveEntry)
+	add := func(name string, entry *archiveEntry) bool {
+		// The first of entries with the same name is the one read
+		if _, ok := idx.entries[name]; ok {
+			return false
+		}
+		idx.names = append(idx.names, name)
+		idx.entries[name] = entry
+		return true
+	}
+
+	if isZip(archive) {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return fmt.Errorf("failed to open archive %q: %w", archive, err)
+		}
+		defer zr.Close()
+
+		for _, f := range zr.File {
+			name := entryName(f.Name, strip)
+			if name == "" || !f.Mode().IsRegular() {
+				continue
+			}
+			offset, err := f.DataOffset()
+			if err != nil {
+				return fmt.Errorf("failed to read %s in %q: %w", f.Name, archive, err)
+			}
+			add(name, &archiveEntry{
+				size:       int64(f.UncompressedSize64),
+				offset:     offset,
+				compressed: int64(f.CompressedSize64),
+				method:     f.Method,
+			})
+		}
+		return nil
+	}
+
+	var held int64
+	return walkTar(archive, strip, func(name string, size int64, r io.Reader) error {
+		entry := &archiveEntry{size: size}
+		if !add(name, entry) || !isConfigName(name) || size > DefaultMaxEntrySize || held+size > DefaultMaxArchiveBytes {
+			return nil
+		}
+		entry.read = true
+		entry.data, entry.err = readEntryData(r)
+		held += int64(len(entry.data))
+		return nil
+	})
+}
+
+// ReleaseArchive drops the indexes of an archive once a directory
+// comparison is done with it, freeing the files they hold. It does
+// nothing for other paths.
+func ReleaseArchive(archive string) {
+	archiveIndexesMu.Lock()
+	defer archiveIndexesMu.Unlock()
+	for key := range archiveIndexes {
+		if key.archive == archive {
+			delete(archiveIndexes, key)
+		}
+	}
+}
+
+// ListArchiveFiles lists the files in an archive, with the first strip
+// directories of each name removed. The archive is indexed until
+// ReleaseArchive is called for it.
+func ListArchiveFiles(archive string, strip int) ([]string, error) {
+	idx, err := indexArchive(archive, strip)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), idx.names...), nil
+}
+
+// readArchiveFile reads one file from an archive: by its index if a
+// directory comparison has one, and otherwise on its own.
+func readArchiveFile(archive, inner string, strip int) ([]byte, error) {
+	label := JoinArchivePath(archive, inner)
+	name := entryName(inner, 0)
+
+	idx, err := lookupArchiveIndex(archive, strip, false)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil && isZip(archive) {
+		// Listing a zip archive only reads its central directory
+		idx = &archiveIndex{}
+		if err := idx.build(archive, strip); err != nil {
+			return nil, err
+		}
+	}
+
+	var entry *archiveEntry
+	if idx != nil {
+		entry = idx.entries[name]
+	}
+	if idx == nil || (entry != nil && !entry.read && !isZip(archive) && entry.size <= DefaultMaxEntrySize) {
+		if entry, err = scanTar(archive, strip, name); err != nil {
+			return nil, err
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%s does not exist in archive %q", inner, archive)
+	}
+
+	data, err := entry.data, entry.err
+	if entry.size > DefaultMaxEntrySize {
+		err = errEntryTooLarge
+	} else if !entry.read {
+		data, err = readZipEntry(archive, entry)
+	}
+	if errors.Is(err, errEntryTooLarge) {
+		return nil, fmt.Errorf("%q exceeds %d bytes", label, DefaultMaxEntrySize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", label, err)
+	}
+	return data, nil
+}
+
+// readArchiveInput reads a single file from an archive.
+func readArchiveInput(archive, inner, formatHint string, strip int) (*InputSource, error) {
+	label := JoinArchivePath(archive, inner)
+
+	data, err := readArchiveFile(archive, inner, strip)
+	if err != nil {
+		return nil, err
+	}
+
+	format := formatHint
+	if format == "" || format == "auto" {
+		format = detectFormat(inner, data)
+		if format == "" {
+			return nil, undetectedFormat(label)
+		}
+	}
+
+	return &InputSource{
+		Path:   label,
+		Data:   data,
+		Format: format,
+	}, nil
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chartFiles is the layout of a packaged Helm chart.
+var chartFiles = map[string]string{
+	"mychart/Chart.yaml":          "name: mychart\nversion: 1.0.0\n",
+	"mychart/values.yaml":         "replicas: 1\n",
+	"mychart/templates/svc.yaml":  "kind: Service\n",
+	"mychart/templates/NOTES.txt": "Thanks\n",
+}
+
+// writeTarGz writes files to a gzipped tar archive.
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "mychart/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeZip writes files to a zip archive.
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitArchivePath(t *testing.T) {
+	tests := []struct {
+		arg         string
+		wantArchive string
+		wantInner   string
+		wantOK      bool
+	}{
+		{"chart.tgz!mychart/values.yaml", "chart.tgz", "mychart/values.yaml", true},
+		{"bundle.tar.gz!a.json", "bundle.tar.gz", "a.json", true},
+		{"dir/bundle.ZIP!a.yaml", "dir/bundle.ZIP", "a.yaml", true},
+		{"odd!name/chart.tar!x.yaml", "odd!name/chart.tar", "x.yaml", true},
+		{"values.yaml", "values.yaml", "", false},
+		{"notes!.yaml", "notes!.yaml", "", false},
+		{"chart.tgz!", "chart.tgz!", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			archive, inner, ok := SplitArchivePath(tt.arg)
+			if archive != tt.wantArchive || inner != tt.wantInner || ok != tt.wantOK {
+				t.Errorf("SplitArchivePath(%q) = %q, %q, %v, want %q, %q, %v",
+					tt.arg, archive, inner, ok, tt.wantArchive, tt.wantInner, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestListArchiveFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	tgz := filepath.Join(tmpDir, "mychart-1.0.0.tgz")
+	zipFile := filepath.Join(tmpDir, "mychart-1.0.0.zip")
+	writeTarGz(t, tgz, chartFiles)
+	writeZip(t, zipFile, chartFiles)
+
+	for _, archive := range []string{tgz, zipFile} {
+		t.Run(filepath.Ext(archive), func(t *testing.T) {
+			if !IsArchive(archive) {
+				t.Fatalf("IsArchive(%q) = false", archive)
+			}
+
+			files, err := ListArchiveFiles(archive, 1)
+			if err != nil {
+				t.Fatalf("ListArchiveFiles() error = %v", err)
+			}
+			sort.Strings(files)
+			want := []string{"Chart.yaml", "templates/NOTES.txt", "templates/svc.yaml", "values.yaml"}
+			if !reflect.DeepEqual(files, want) {
+				t.Errorf("ListArchiveFiles() = %v, want %v", files, want)
+			}
+
+			input, err := ReadInput(JoinArchivePath(archive, "mychart/values.yaml"), "auto")
+			if err != nil {
+				t.Fatalf("ReadInput() error = %v", err)
+			}
+			if string(input.Data) != "replicas: 1\n" || input.Format != "yaml" {
+				t.Errorf("ReadInput() = %q as %s, want the chart values as yaml", input.Data, input.Format)
+			}
+
+			input, err = ReadInputWith(JoinArchivePath(archive, "values.yaml"), "auto", InputOptions{StripComponents: 1})
+			if err != nil {
+				t.Fatalf("ReadInputWith(StripComponents) error = %v", err)
+			}
+			if string(input.Data) != "replicas: 1\n" {
+				t.Errorf("ReadInputWith(StripComponents) = %q, want the chart values", input.Data)
+			}
+
+			_, err = ReadInput(JoinArchivePath(archive, "missing.yaml"), "auto")
+			if err == nil || !strings.Contains(err.Error(), "does not exist in archive") {
+				t.Errorf("ReadInput() of a missing entry error = %v", err)
+			}
+		})
+	}
+}
+
+func TestIndexArchive(t *testing.T) {
+	tgz := filepath.Join(t.TempDir(), "mychart-1.0.0.tgz")
+	writeTarGz(t, tgz, chartFiles)
+
+	idx, err := indexArchive(tgz, 1)
+	if err != nil {
+		t.Fatalf("indexArchive() error = %v", err)
+	}
+	for _, name := range []string{"values.yaml", "Chart.yaml", "templates/svc.yaml"} {
+		if _, err := ReadInputWith(JoinArchivePath(tgz, name), "auto", InputOptions{StripComponents: 1}); err != nil {
+			t.Fatalf("ReadInputWith(%s) error = %v", name, err)
+		}
+		if again, _ := indexArchive(tgz, 1); again != idx {
+			t.Fatalf("reading %s indexed the archive again", name)
+		}
+	}
+	if other, _ := indexArchive(tgz, 0); other == idx {
+		t.Error("indexArchive() shares an index across strip counts")
+	}
+
+	// Rewriting the archive drops its index
+	writeTarGz(t, tgz, map[string]string{"mychart/values.yaml": "replicas: 3\n"})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tgz, later, later); err != nil {
+		t.Fatal(err)
+	}
+	input, err := ReadInputWith(JoinArchivePath(tgz, "values.yaml"), "auto", InputOptions{StripComponents: 1})
+	if err != nil {
+		t.Fatalf("ReadInputWith() after rewriting error = %v", err)
+	}
+	if string(input.Data) != "replicas: 3\n" {
+		t.Errorf("ReadInputWith() after rewriting = %q, want the new values", input.Data)
+	}
+	if files, _ := ListArchiveFiles(tgz, 1); !reflect.DeepEqual(files, []string{"values.yaml"}) {
+		t.Errorf("ListArchiveFiles() after rewriting = %v, want [values.yaml]", files)
+	}
+}
+
+func TestIndexArchiveMemory(t *testing.T) {
+	files := map[string]string{
+		"mychart/values.yaml": "replicas: 1\n",
+		"mychart/huge.yaml":   strings.Repeat("a", DefaultMaxEntrySize+1),
+		"mychart/image.bin":   strings.Repeat("b", 4<<20),
+	}
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("mychart/docs/page%d.txt", i)] = "docs\n"
+	}
+	dir := t.TempDir()
+	tgz := filepath.Join(dir, "mychart-1.0.0.tgz")
+	zipFile := filepath.Join(dir, "mychart-1.0.0.zip")
+	writeTarGz(t, tgz, files)
+	writeZip(t, zipFile, files)
+
+	for _, archive := range []string{tgz, zipFile} {
+		t.Run(filepath.Ext(archive), func(t *testing.T) {
+			defer ReleaseArchive(archive)
+
+			idx, err := indexArchive(archive, 1)
+			if err != nil {
+				t.Fatalf("indexArchive() error = %v", err)
+			}
+			if len(idx.names) != len(files) {
+				t.Errorf("indexArchive() listed %d files, want %d", len(idx.names), len(files))
+			}
+			var held int
+			for name, entry := range idx.entries {
+				held += len(entry.data)
+				if entry.data != nil && name != "values.yaml" {
+					t.Errorf("indexArchive() holds %s", name)
+				}
+			}
+			if held > len("replicas: 1\n") {
+				t.Errorf("indexArchive() holds %d bytes", held)
+			}
+
+			// Files the index does not hold are read on demand
+			for name, want := range map[string]string{"values.yaml": "replicas: 1\n", "docs/page7.txt": "docs\n"} {
+				data, err := readArchiveFile(archive, name, 1)
+				if err != nil || string(data) != want {
+					t.Errorf("readArchiveFile(%s) = %q, %v, want %q", name, data, err, want)
+				}
+			}
+			if _, err := readArchiveFile(archive, "huge.yaml", 1); err == nil || !strings.Contains(err.Error(), "exceeds") {
+				t.Errorf("readArchiveFile(huge.yaml) error = %v, want it to exceed the size cap", err)
+			}
+
+			ReleaseArchive(archive)
+			if again, _ := lookupArchiveIndex(archive, 1, false); again != nil {
+				t.Error("ReleaseArchive() kept the index")
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults of --cache-max-age and --cache-max-size
+const (
+	DefaultCacheMaxAge  = 7 * 24 * time.Hour
+	DefaultCacheMaxSize = "512MB"
+)
+
+// cacheTempPrefix starts the names of entries being written. Those left by
+// a process that stopped before renaming them into place are removed by
+// Evict once they are older than cacheTempMaxAge.
+const (
+	cacheTempPrefix = ".tmp-"
+	cacheTempMaxAge = time.Hour
+)
+
+// Cache is a directory of comparison results, each stored under a key that
+// identifies what was compared and how, see CacheKey. It can be shared by
+// processes running at once: an entry is written under a temporary name and
+// renamed into place, so that it is read whole or not at all.
+//
+// Entries are stored in a subdirectory named by the first two characters
+// of their key, as git stores objects. Evict only removes files named like
+// entries, so pointing a cache at a directory holding other files does not
+// delete them.
+type Cache struct {
+	dir     string
+	maxAge  time.Duration
+	maxSize int64
+}
+
+// OpenCache opens the cache in dir, creating the directory if needed. Evict
+// removes the entries not used for longer than maxAge, and the least
+// recently used ones beyond maxSize bytes in all; 0 turns either limit off.
+func OpenCache(dir string, maxAge time.Duration, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{dir: dir, maxAge: maxAge, maxSize: maxSize}, nil
+}
+
+// CacheKey returns the key of the entry for parts, e.g. the contents of two
+// files and a fingerprint of the options they are compared with. The parts
+// are hashed with their lengths, so that moving bytes from the end of one to
+// the start of the next changes the key.
+func CacheKey(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(part)))
+		h.Write(n[:])
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// path returns the file of the entry for key.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key[2:])
+}
+
+// Get returns the entry for key, or false if there is none. Reading an
+// entry marks it as used now, so that Evict keeps it longer.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return data, true
+}
+
+// Put stores data as the entry for key, replacing any entry there.
+func (c *Cache) Put(key string, data []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), cacheTempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// cacheFile is an entry, or a temporary file, found by Evict.
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Evict removes the entries not used for longer than the cache's maximum
+// age, then the least recently used until the rest fit in its maximum size.
+// It returns the number of entries removed.
+func (c *Cache) Evict() (int, error) {
+	var entries []cacheFile
+	var total int64
+	now := time.Now()
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(c.dir, path)
+		if d.IsDir() {
+			if rel != "." && !isCacheDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Removed by another process since it was listed
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), cacheTempPrefix) && filepath.Dir(rel) != "." {
+			if now.Sub(info.ModTime()) > cacheTempMaxAge {
+				os.Remove(path)
+			}
+			return nil
+		}
+		if !isCacheEntry(rel) {
+			return nil
+		}
+		entries = append(entries, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+
+	// Least recently used first
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	removed := 0
+	var errs []error
+	for _, e := range entries {
+		expired := c.maxAge > 0 && now.Sub(e.modTime) > c.maxAge
+		if !expired && (c.maxSize <= 0 || total <= c.maxSize) {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		total -= e.size
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// isCacheDir reports whether rel, relative to the cache directory, names a
+// subdirectory of entries: two hex digits.
+func isCacheDir(rel string) bool {
+	return len(rel) == 2 && isHex(rel)
+}
+
+// isCacheEntry reports whether rel, relative to the cache directory, names
+// an entry: the rest of a hex SHA-256 key, in the subdirectory named by its
+// first two characters.
+func isCacheEntry(rel string) bool {
+	dir, name := filepath.Split(rel)
+	return isCacheDir(filepath.Clean(dir)) && len(name) == 2*sha256.Size-2 && isHex(name)
+}
+
+// isHex reports whether s is made of lowercase hex digits only.
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
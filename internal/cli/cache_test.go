@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	key := CacheKey([]byte("ab"), []byte("c"))
+	if len(key) != 64 || !isHex(key) {
+		t.Fatalf("CacheKey() = %q, want 64 hex digits", key)
+	}
+	if CacheKey([]byte("ab"), []byte("c")) != key {
+		t.Error("CacheKey() differs for the same parts")
+	}
+	if CacheKey([]byte("a"), []byte("bc")) == key {
+		t.Error("CacheKey() is the same for parts split differently")
+	}
+	if CacheKey([]byte("ab"), []byte("d")) == key {
+		t.Error("CacheKey() is the same for different parts")
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	c, err := OpenCache(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenCache() error = %v", err)
+	}
+	key := CacheKey([]byte("old"), []byte("new"))
+	if _, ok := c.Get(key); ok {
+		t.Fatal("Get() hit in an empty cache")
+	}
+	if err := c.Put(key, []byte("result")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if data, ok := c.Get(key); !ok || string(data) != "result" {
+		t.Errorf("Get() = %q, %v, want result", data, ok)
+	}
+	if err := c.Put(key, []byte("replaced")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if data, ok := c.Get(key); !ok || string(data) != "replaced" {
+		t.Errorf("Get() after a second Put() = %q, %v, want replaced", data, ok)
+	}
+	if removed, err := c.Evict(); err != nil || removed != 0 {
+		t.Errorf("Evict() without limits = %d, %v, want 0 removed", removed, err)
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenCache(dir, time.Hour, 25)
+	if err != nil {
+		t.Fatalf("OpenCache() error = %v", err)
+	}
+
+	// Entries of 10 bytes, last used 3, 2, 1, and 0 minutes ago, and one
+	// used 2 hours ago
+	now := time.Now()
+	keys := make([]string, 5)
+	for i := range keys {
+		keys[i] = CacheKey([]byte{byte(i)})
+		if err := c.Put(keys[i], []byte("0123456789")); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		used := now.Add(-time.Duration(3-i) * time.Minute)
+		if i == 4 {
+			used = now.Add(-2 * time.Hour)
+		}
+		if err := os.Chtimes(c.path(keys[i]), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A temporary file left by an interrupted Put, and files that are not
+	// entries
+	stale := filepath.Join(dir, keys[0][:2], cacheTempPrefix+"1234")
+	other := []string{filepath.Join(dir, "notes.txt"), filepath.Join(dir, cacheTempPrefix+"mine"), filepath.Join(dir, "zz", "file")}
+	for _, path := range append([]string{stale}, other...) {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		old := now.Add(-2 * time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The expired entry goes, then the least recently used until 25 bytes
+	// are left
+	removed, err := c.Evict()
+	if err != nil || removed != 3 {
+		t.Fatalf("Evict() = %d, %v, want 3 removed", removed, err)
+	}
+	for i, key := range keys {
+		_, ok := c.Get(key)
+		if want := i == 2 || i == 3; ok != want {
+			t.Errorf("entry %d kept = %v, want %v", i, ok, want)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale temporary file not removed: %v", err)
+	}
+	for _, path := range other {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Evict() removed %s, which is not an entry: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"golang.org/x/term"
+)
+
+// ColorMode is when output is colored.
+type ColorMode string
+
+const (
+	// ColorAuto colors output written to a terminal.
+	ColorAuto ColorMode = "auto"
+
+	// ColorAlways colors output wherever it is written, e.g. for less -R.
+	ColorAlways ColorMode = "always"
+
+	// ColorNever never colors output.
+	ColorNever ColorMode = "never"
+)
+
+// ColorModes lists the values of --color.
+var ColorModes = []string{string(ColorAuto), string(ColorAlways), string(ColorNever)}
+
+// ParseColorMode parses a --color value. An empty value is ColorAuto.
+func ParseColorMode(s string) (ColorMode, error) {
+	switch ColorMode(s) {
+	case "", ColorAuto:
+		return ColorAuto, nil
+	case ColorAlways, ColorNever:
+		return ColorMode(s), nil
+	}
+	return "", fmt.Errorf("invalid --color %q, must be one of: %s", s, strings.Join(ColorModes, ", "))
+}
+
+// ResolveColorMode returns the effective color mode, from the first of these
+// that decides it:
+//
+//  1. --color=always or --color=never
+//  2. --no-color, or no_color in the config file: never
+//  3. the NO_COLOR environment variable, if not empty: never
+//  4. the CLICOLOR_FORCE environment variable, if not empty or "0": always
+//
+// and otherwise auto. An invalid color is treated as auto; see
+// ParseColorMode.
+func ResolveColorMode(color string, noColor bool) ColorMode {
+	if mode, err := ParseColorMode(color); err == nil && mode != ColorAuto {
+		return mode
+	}
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return ColorNever
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return ColorAlways
+	}
+	return ColorAuto
+}
+
+// ColorDisabled decides whether output written to out should be colorless
+// in an effective color mode: in auto mode, when out is not a terminal.
+func ColorDisabled(mode ColorMode, out *os.File) bool {
+	switch mode {
+	case ColorAlways:
+		return false
+	case ColorNever:
+		return true
+	}
+	if out == nil {
+		return true
+	}
+	fd := out.Fd()
+	return !isatty.IsTerminal(fd) && !isatty.IsCygwinTerminal(fd)
+}
+
+// TerminalWidth returns the width of the terminal attached to out, or 0 when
+// out is not a terminal so generators fall back to their default width.
+func TerminalWidth(out *os.File) int {
+	if out == nil {
+		return 0
+	}
+	width, _, err := term.GetSize(int(out.Fd()))
+	if err != nil || width <= 0 {
+		return 0
+	}
+	return width
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColorDisabled(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	t.Run("never", func(t *testing.T) {
+		if !ColorDisabled(ColorNever, os.Stdout) {
+			t.Error("ColorDisabled(never) = false, want true")
+		}
+	})
+
+	t.Run("always to a file", func(t *testing.T) {
+		if ColorDisabled(ColorAlways, f) {
+			t.Error("ColorDisabled(always) for a regular file = true, want false")
+		}
+	})
+
+	t.Run("auto to a file", func(t *testing.T) {
+		if !ColorDisabled(ColorAuto, f) {
+			t.Error("ColorDisabled(auto) for a regular file = false, want true")
+		}
+	})
+
+	t.Run("auto without output", func(t *testing.T) {
+		if !ColorDisabled(ColorAuto, nil) {
+			t.Error("ColorDisabled(auto) for no file = false, want true")
+		}
+	})
+}
+
+func TestResolveColorMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		color      string
+		noColor    bool
+		noColorEnv string
+		forceEnv   string
+		want       ColorMode
+	}{
+		{"default", "", false, "", "", ColorAuto},
+		{"auto", "auto", false, "", "", ColorAuto},
+		{"always", "always", false, "", "", ColorAlways},
+		{"never", "never", false, "", "", ColorNever},
+		{"--no-color", "auto", true, "", "", ColorNever},
+		{"NO_COLOR", "auto", false, "1", "", ColorNever},
+		{"CLICOLOR_FORCE", "auto", false, "", "1", ColorAlways},
+		{"CLICOLOR_FORCE=0", "auto", false, "", "0", ColorAuto},
+		{"always beats --no-color", "always", true, "", "", ColorAlways},
+		{"always beats NO_COLOR", "always", false, "1", "", ColorAlways},
+		{"never beats CLICOLOR_FORCE", "never", false, "", "1", ColorNever},
+		{"--no-color beats CLICOLOR_FORCE", "auto", true, "", "1", ColorNever},
+		{"NO_COLOR beats CLICOLOR_FORCE", "auto", false, "1", "1", ColorNever},
+		{"invalid is auto", "sometimes", false, "", "", ColorAuto},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColorEnv)
+			t.Setenv("CLICOLOR_FORCE", tt.forceEnv)
+			if got := ResolveColorMode(tt.color, tt.noColor); got != tt.want {
+				t.Errorf("ResolveColorMode(%q, %v) = %q, want %q", tt.color, tt.noColor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseColorMode(t *testing.T) {
+	for _, s := range ColorModes {
+		if mode, err := ParseColorMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseColorMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+	if mode, err := ParseColorMode(""); err != nil || mode != ColorAuto {
+		t.Errorf("ParseColorMode(\"\") = %q, %v, want auto", mode, err)
+	}
+	if _, err := ParseColorMode("yes"); err == nil {
+		t.Error("ParseColorMode(\"yes\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// NormalizeCompose rewrites the services of a Docker Compose file into one
+// form of each setting Compose accepts several forms of:
+//
+//   - environment as a list of "KEY=VALUE" strings becomes a map of string
+//     values, and "KEY" alone a null value
+//   - ports in short syntax, e.g. "127.0.0.1:8080:80/udp", become long
+//     syntax objects with target, published, host_ip, and protocol; the
+//     published port is a string and the protocol defaults to tcp in both
+//   - depends_on as a list of services becomes a map of conditions, which
+//     default to service_started
+//
+// Anything it does not recognize is left as it is. The document given is
+// not modified.
+func NormalizeCompose(doc *tree.Node) *tree.Node {
+	if doc == nil || doc.Kind != tree.KindObject {
+		return doc
+	}
+	services, ok := doc.Object["services"]
+	if !ok || services.Kind != tree.KindObject {
+		return doc
+	}
+
+	doc = doc.Clone()
+	for _, service := range doc.Object["services"].Object {
+		if service.Kind != tree.KindObject {
+			continue
+		}
+		if env, ok := service.Object["environment"]; ok {
+			service.Object["environment"] = composeEnvironment(env)
+		}
+		if ports, ok := service.Object["ports"]; ok && ports.Kind == tree.KindArray {
+			for i, port := range ports.Array {
+				ports.Array[i] = composePort(port)
+			}
+		}
+		if deps, ok := service.Object["depends_on"]; ok {
+			service.Object["depends_on"] = composeDependsOn(deps)
+		}
+	}
+	doc.SetPaths("/")
+	return doc
+}
+
+// composeEnvironment returns a service's environment as a map of strings.
+func composeEnvironment(env *tree.Node) *tree.Node {
+	switch env.Kind {
+	case tree.KindArray:
+		vars := make(map[string]*tree.Node, len(env.Array))
+		for _, entry := range env.Array {
+			if entry.Kind != tree.KindString {
+				return env
+			}
+			key, value, ok := strings.Cut(entry.Value.(string), "=")
+			if ok {
+				vars[key] = tree.NewString(value)
+			} else {
+				vars[key] = tree.NewNull()
+			}
+			vars[key].Line = entry.Line
+		}
+		return withLine(tree.NewObject(vars), env)
+	case tree.KindObject:
+		for key, value := range env.Object {
+			if s, ok := composeString(value); ok {
+				env.Object[key] = withLine(tree.NewString(s), value)
+			}
+		}
+	}
+	return env
+}
+
+// composePort returns a port in long syntax, or the port as it is if it is
+// neither valid short syntax nor an object.
+func composePort(port *tree.Node) *tree.Node {
+	var fields map[string]*tree.Node
+	switch port.Kind {
+	case tree.KindString, tree.KindNumber:
+		s, _ := composeString(port)
+		parsed, ok := parseComposePort(s)
+		if !ok {
+			return port
+		}
+		fields = parsed
+	case tree.KindObject:
+		fields = port.Object
+		if published, ok := composeString(fields["published"]); ok {
+			fields["published"] = withLine(tree.NewString(published), fields["published"])
+		}
+		if target := fields["target"]; target != nil && target.Kind == tree.KindString {
+			fields["target"] = withLine(composePortNumber(target.Value.(string)), target)
+		}
+	default:
+		return port
+	}
+	if _, ok := fields["protocol"]; !ok {
+		fields["protocol"] = tree.NewString("tcp")
+	}
+	return withLine(tree.NewObject(fields), port)
+}
+
+// parseComposePort parses the short syntax of a port,
+// "[[HOST_IP:]PUBLISHED:]TARGET[/PROTOCOL]", where HOST_IP may be an IPv6
+// address in brackets and PUBLISHED may be empty or a range.
+func parseComposePort(s string) (map[string]*tree.Node, bool) {
+	fields := make(map[string]*tree.Node)
+	if spec, protocol, ok := strings.Cut(s, "/"); ok {
+		fields["protocol"] = tree.NewString(protocol)
+		s = spec
+	}
+
+	var hostIP string
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]:")
+		if end < 0 {
+			return nil, false
+		}
+		hostIP, s = s[1:end], s[end+2:]
+	}
+	parts := strings.Split(s, ":")
+	var published string
+	switch {
+	case len(parts) == 3 && hostIP == "":
+		hostIP, published = parts[0], parts[1]
+	case len(parts) == 2:
+		published = parts[0]
+	case len(parts) != 1:
+		return nil, false
+	}
+	target := parts[len(parts)-1]
+	if target == "" {
+		return nil, false
+	}
+
+	fields["target"] = composePortNumber(target)
+	if published != "" {
+		fields["published"] = tree.NewString(published)
+	}
+	if hostIP != "" {
+		fields["host_ip"] = tree.NewString(hostIP)
+	}
+	return fields, true
+}
+
+// composePortNumber returns a port as a number, or a range of ports as the
+// string it is.
+func composePortNumber(s string) *tree.Node {
+	if n, err := strconv.Atoi(s); err == nil {
+		return tree.NewNumber(float64(n))
+	}
+	return tree.NewString(s)
+}
+
+// composeDependsOn returns a service's dependencies as a map of conditions.
+func composeDependsOn(deps *tree.Node) *tree.Node {
+	switch deps.Kind {
+	case tree.KindArray:
+		conditions := make(map[string]*tree.Node, len(deps.Array))
+		for _, dep := range deps.Array {
+			if dep.Kind != tree.KindString {
+				return deps
+			}
+			conditions[dep.Value.(string)] = withLine(composeCondition(nil), dep)
+		}
+		return withLine(tree.NewObject(conditions), deps)
+	case tree.KindObject:
+		for name, dep := range deps.Object {
+			deps.Object[name] = composeCondition(dep)
+		}
+	}
+	return deps
+}
+
+// composeCondition returns the long form of a dependency with its condition
+// defaulted to service_started.
+func composeCondition(dep *tree.Node) *tree.Node {
+	if dep == nil || dep.Kind == tree.KindNull {
+		dep = tree.NewObject(map[string]*tree.Node{})
+	}
+	if dep.Kind != tree.KindObject {
+		return dep
+	}
+	if _, ok := dep.Object["condition"]; !ok {
+		dep.Object["condition"] = tree.NewString("service_started")
+	}
+	return dep
+}
+
+// composeString returns a scalar as the string Compose reads it as.
+func composeString(n *tree.Node) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	switch n.Kind {
+	case tree.KindString:
+		return n.Value.(string), true
+	case tree.KindNumber:
+		return n.NumberString(), true
+	case tree.KindBool:
+		return strconv.FormatBool(n.Value.(bool)), true
+	}
+	return "", false
+}
+
+// withLine returns n with the source line of the node it replaces.
+func withLine(n, replaced *tree.Node) *tree.Node {
+	n.Line = replaced.Line
+	return n
+}
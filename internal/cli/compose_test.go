@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// readCompose parses a Compose file from testdata.
+func readCompose(t *testing.T, name string) *tree.Node {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "compose", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parse.Parse(data, parse.FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// diffWithPreset diffs two documents as --preset does.
+func diffWithPreset(t *testing.T, preset string, oldDoc, newDoc *tree.Node) []string {
+	t.Helper()
+	opts := CLIOptions{Preset: preset, StableOrder: true}
+	diffOpts, err := opts.ToLibraryOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := configdiff.DiffTrees(opts.NormalizeTree(oldDoc), opts.NormalizeTree(newDoc), diffOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []string
+	for _, c := range result.Changes {
+		changes = append(changes, string(c.Type)+" "+c.Path)
+	}
+	return changes
+}
+
+func TestNormalizeCompose(t *testing.T) {
+	short, long := readCompose(t, "short.yaml"), readCompose(t, "long.yaml")
+	shortBefore, err := CanonicalJSON(short)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changes := diffWithPreset(t, PresetCompose, short, long); len(changes) != 0 {
+		t.Errorf("short and long syntax differ with the compose preset: %v", changes)
+	}
+	if changes := diffWithPreset(t, "", short, long); len(changes) == 0 {
+		t.Error("short and long syntax are equal without a preset, want differences")
+	}
+	if after, _ := CanonicalJSON(short); string(after) != string(shortBefore) {
+		t.Error("NormalizeCompose() modified the document it was given")
+	}
+
+	// Ports are matched by published port, whatever their order
+	changed := readCompose(t, "long.yaml")
+	ports := changed.GetByPath("/services/web/ports").Array
+	ports[0], ports[3] = ports[3], ports[0]
+	ports[2].Object["target"] = tree.NewNumber(8443)
+	got := diffWithPreset(t, PresetCompose, short, changed)
+	if len(got) != 1 || got[0] != "modify /services/web/ports[published=443]/target" {
+		t.Errorf("changes = %v, want the target of the port published on 443", got)
+	}
+
+	normalized := NormalizeCompose(short)
+	for path, want := range map[string]string{
+		"/services/web/environment/NGINX_PORT":     `"80"`,
+		"/services/web/environment/DEBUG":          "null",
+		"/services/web/depends_on/app/condition":   `"service_started"`,
+		"/services/app/environment/WORKERS":        `"4"`,
+		"/services/app/ports[1]/protocol":          `"udp"`,
+		"/services/app/ports[0]/published":         `"3000"`,
+		"/services/web/ports[2]/host_ip":           `"127.0.0.1"`,
+		"/services/db/volumes[0]":                  `"db-data:/var/lib/postgresql/data"`,
+		"/services/web/ports[3]/target":            "9000",
+		"/services/db/environment/POSTGRES_USER":   `"app"`,
+		"/services/app/depends_on/cache/condition": `"service_started"`,
+		"/services/web/environment/NGINX_HOST":     `"example.com"`,
+		"/services/app/environment/DATABASE_URL":   `"postgres://app@db:5432/app"`,
+		"/services/app/environment/FEATURE_FLAGS":  `"search,export"`,
+		"/services/web/ports[0]/protocol":          `"tcp"`,
+		"/services/app/ports[1]/target":            "53",
+		"/services/web/ports[2]/published":         `"8080"`,
+		"/services/app/depends_on/db/condition":    `"service_started"`,
+		"/services/db/environment/POSTGRES_DB":     `"app"`,
+		"/services/web/ports[1]/published":         `"443"`,
+	} {
+		node := normalized.GetByPath(path)
+		if node == nil {
+			t.Errorf("%s missing after normalizing", path)
+			continue
+		}
+		if got, _ := CanonicalJSON(node); string(got) != want+"\n" {
+			t.Errorf("%s = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestParseComposePort(t *testing.T) {
+	tests := []struct {
+		port string
+		want string // canonical JSON, or "" if invalid
+	}{
+		{"3000", `{"target":3000}`},
+		{"8000:8000", `{"published":"8000","target":8000}`},
+		{"9090-9091:8080-8081", `{"published":"9090-9091","target":"8080-8081"}`},
+		{"127.0.0.1:8001:8001", `{"host_ip":"127.0.0.1","published":"8001","target":8001}`},
+		{"127.0.0.1::5000", `{"host_ip":"127.0.0.1","target":5000}`},
+		{"6060:6060/udp", `{"protocol":"udp","published":"6060","target":6060}`},
+		{"[::1]:6001:6001", `{"host_ip":"::1","published":"6001","target":6001}`},
+		{"1:2:3:4", ""},
+		{"8080:", ""},
+		{"[::1:6001", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			fields, ok := parseComposePort(tt.port)
+			if !ok {
+				if tt.want != "" {
+					t.Errorf("parseComposePort(%q) failed, want %s", tt.port, tt.want)
+				}
+				return
+			}
+			got, err := CanonicalJSON(tree.NewObject(fields))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want+"\n" {
+				t.Errorf("parseComposePort(%q) = %s, want %s", tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupPreset(t *testing.T) {
+	for _, name := range Presets {
+		if _, err := LookupPreset(name); err != nil {
+			t.Errorf("LookupPreset(%q) error = %v", name, err)
+		}
+	}
+	if _, err := LookupPreset("swarm"); err == nil {
+		t.Error("LookupPreset(\"swarm\") succeeded, want an error")
+	}
+	if err := (&CLIOptions{OutputFormat: "report", Format: "auto", Preset: "swarm"}).Validate(); err == nil {
+		t.Error("Validate() with an unknown preset succeeded, want an error")
+	}
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/report"
+)
+
+const (
+	// FailOnAny selects every change for --fail-on.
+	FailOnAny = "any"
+
+	// FailOnTypeChange selects modifications that change a value's kind.
+	FailOnTypeChange = "type-change"
+
+	// FailOnDestroy selects files and resources removed as a whole,
+	// including resources a Terraform plan replaces.
+	FailOnDestroy = "destroy"
+)
+
+// ValidateFailOn checks the change types given to --fail-on.
+func ValidateFailOn(failOn []string) error {
+	for _, t := range failOn {
+		switch t {
+		case string(diff.ChangeTypeAdd), string(diff.ChangeTypeRemove), string(diff.ChangeTypeModify),
+			string(diff.ChangeTypeMove), FailOnTypeChange, FailOnDestroy, FailOnAny:
+		default:
+			return fmt.Errorf("invalid --fail-on type %q (valid: add, remove, modify, move, %s, %s, %s)", t, FailOnTypeChange, FailOnDestroy, FailOnAny)
+		}
+	}
+	return nil
+}
+
+// FailsOn reports whether changes include one selected by --fail-on types.
+// No types select any change; "modify" includes type changes, and "destroy"
+// selects the removal of the root path "/", the whole document.
+func FailsOn(changes []diff.Change, failOn []string) bool {
+	if len(failOn) == 0 {
+		return len(changes) > 0
+	}
+	for _, c := range changes {
+		for _, t := range failOn {
+			if t == FailOnAny || t == string(c.Type) || (t == FailOnTypeChange && c.IsKindChange()) ||
+				(t == FailOnDestroy && c.Type == diff.ChangeTypeRemove && c.Path == "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DirFailsOn reports whether any file of a directory comparison has a change
+// selected by --fail-on types. Added and removed files count as an add or
+// remove of the whole file, renamed files as a move of it, and replaced
+// files as a remove and an add of it, besides the changes within them.
+func DirFailsOn(dir report.DirResult, failOn []string) bool {
+	for i, f := range dir.FileChanges() {
+		changes := f.Changes
+		switch dir.Files[i].Status {
+		case report.FileRenamed:
+			changes = append([]diff.Change{{Type: diff.ChangeTypeMove, Path: "/"}}, changes...)
+		case report.FileReplaced:
+			changes = append([]diff.Change{{Type: diff.ChangeTypeRemove, Path: "/"}, {Type: diff.ChangeTypeAdd, Path: "/"}}, changes...)
+		}
+		if FailsOn(changes, failOn) {
+			return true
+		}
+	}
+	return false
+}
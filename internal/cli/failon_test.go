@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+func TestValidateFailOn(t *testing.T) {
+	if err := ValidateFailOn([]string{"add", "remove", "modify", "move", "type-change", "destroy", "any"}); err != nil {
+		t.Errorf("ValidateFailOn() error = %v", err)
+	}
+	if err := ValidateFailOn([]string{"delete"}); err == nil {
+		t.Error("ValidateFailOn(delete) succeeded, want an error")
+	}
+}
+
+func TestFailsOn(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeAdd, Path: "/port"},
+		{Type: diff.ChangeTypeModify, Path: "/replicas", OldValue: tree.NewNumber(2), NewValue: tree.NewNumber(3)},
+	}
+	kindChange := []diff.Change{
+		{Type: diff.ChangeTypeModify, Path: "/replicas", OldValue: tree.NewString("2"), NewValue: tree.NewNumber(2)},
+	}
+
+	tests := []struct {
+		name    string
+		changes []diff.Change
+		failOn  []string
+		want    bool
+	}{
+		{"default", changes, nil, true},
+		{"default without changes", nil, nil, false},
+		{"any", changes, []string{"any"}, true},
+		{"selected type", changes, []string{"add"}, true},
+		{"unselected types", changes, []string{"remove", "move"}, false},
+		{"type-change without one", changes, []string{"type-change"}, false},
+		{"type-change", kindChange, []string{"type-change"}, true},
+		{"modify includes type changes", kindChange, []string{"modify"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FailsOn(tt.changes, tt.failOn); got != tt.want {
+				t.Errorf("FailsOn(%v) = %v, want %v", tt.failOn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirFailsOn(t *testing.T) {
+	dir := report.DirResult{Files: []report.FileResult{
+		{Path: "a.yaml", Status: report.FileModified, Changes: []diff.Change{{Type: diff.ChangeTypeAdd, Path: "/x"}}},
+		{Path: "b.yaml", Status: report.FileRemoved},
+		{Path: "c.yaml", Status: report.FileUnchanged},
+	}}
+
+	if !DirFailsOn(dir, nil) {
+		t.Error("DirFailsOn(default) = false, want true")
+	}
+	if !DirFailsOn(dir, []string{"remove"}) {
+		t.Error("DirFailsOn(remove) = false, want true for a removed file")
+	}
+	if DirFailsOn(dir, []string{"modify", "move"}) {
+		t.Error("DirFailsOn(modify, move) = true, want false")
+	}
+	if !DirFailsOn(dir, []string{"destroy"}) {
+		t.Error("DirFailsOn(destroy) = false, want true for a removed file")
+	}
+
+	// A removed key is not a destroyed file, but a replaced file is
+	updated := report.DirResult{Files: []report.FileResult{
+		{Path: "a.yaml", Status: report.FileModified, Changes: []diff.Change{{Type: diff.ChangeTypeRemove, Path: "/x"}}},
+	}}
+	if DirFailsOn(updated, []string{"destroy"}) {
+		t.Error("DirFailsOn(destroy) = true for a removed key, want false")
+	}
+	updated.Files[0].Status = report.FileReplaced
+	if !DirFailsOn(updated, []string{"destroy"}) {
+		t.Error("DirFailsOn(destroy) = false for a replaced file, want true")
+	}
+}
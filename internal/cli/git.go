@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SplitGitRevision splits an argument of the form "path@{rev}" into the
+// path and the git revision it is read at. ok is false for plain paths and
+// for files whose name merely looks like a revision. The revision is not
+// checked; reading it fails if ValidateGitRevision rejects it.
+func SplitGitRevision(arg string) (path, rev string, ok bool) {
+	if !strings.HasSuffix(arg, "}") {
+		return arg, "", false
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return arg, "", false
+	}
+	i := strings.LastIndex(arg, "@{")
+	if i <= 0 || i+2 == len(arg)-1 {
+		return arg, "", false
+	}
+	return arg[:i], arg[i+2 : len(arg)-1], true
+}
+
+// JoinGitRevision returns the "path@{rev}" form of path at revision rev, or
+// path itself if rev is empty.
+func JoinGitRevision(path, rev string) string {
+	if rev == "" {
+		return path
+	}
+	return path + "@{" + rev + "}"
+}
+
+// ValidateGitRevision rejects a revision that git would take for an
+// option.
+func ValidateGitRevision(rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("invalid git revision %q", rev)
+	}
+	return nil
+}
+
+// gitObject splits path into an existing directory to run git in and the
+// "commit:./rel" name of path relative to it, where commit is rev resolved
+// by "git rev-parse". The directory is the closest existing parent, since
+// path may have been deleted since rev.
+func gitObject(path, rev string) (dir, object string, err error) {
+	if err := ValidateGitRevision(rev); err != nil {
+		return "", "", err
+	}
+
+	dir = filepath.Dir(path)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+
+	// --end-of-options keeps git from reading the revision as an option
+	out, err := runGit(dir, path, rev, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", "", err
+	}
+	return dir, strings.TrimSpace(string(out)) + ":./" + filepath.ToSlash(rel), nil
+}
+
+// runGit runs git in dir with args and returns its standard output, turning
+// its standard error into a descriptive error for path at rev.
+func runGit(dir, path, rev string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err == nil {
+		return out, nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("reading %s at revision %s requires git: %w", path, rev, err)
+	}
+
+	msg := strings.TrimSpace(stderr.String())
+	switch {
+	case strings.Contains(msg, "not a git repository"):
+		return nil, fmt.Errorf("cannot read %s at revision %s: not in a git repository", path, rev)
+	case strings.Contains(msg, "does not exist in"), strings.Contains(msg, "exists on disk, but not in"):
+		return nil, fmt.Errorf("%s does not exist at revision %s", path, rev)
+	case strings.Contains(msg, "invalid object name"), strings.Contains(msg, "unknown revision"), strings.Contains(msg, "bad revision"), strings.Contains(msg, "Not a valid object name"), strings.Contains(msg, "Needed a single revision"):
+		return nil, fmt.Errorf("unknown git revision %q", rev)
+	default:
+		return nil, fmt.Errorf("git %s failed: %s", args[0], msg)
+	}
+}
+
+// readGitInput reads path as of git revision rev with "git show".
+func readGitInput(path, rev, formatHint string) (*InputSource, error) {
+	// Running git next to the file finds its repository, wherever the
+	// working directory is
+	dir, object, err := gitObject(path, rev)
+	if err != nil {
+		return nil, err
+	}
+	data, err := runGit(dir, path, rev, "show", object)
+	if err != nil {
+		return nil, err
+	}
+
+	label := JoinGitRevision(path, rev)
+	format := formatHint
+	if format == "" || format == "auto" {
+		format = detectFormat(path, data)
+		if format == "" {
+			return nil, undetectedFormat(label)
+		}
+	}
+
+	return &InputSource{
+		Path:   label,
+		Data:   data,
+		Format: format,
+	}, nil
+}
+
+// IsGitDir reports whether path is a directory at git revision rev.
+func IsGitDir(path, rev string) (bool, error) {
+	dir, object, err := gitObject(path, rev)
+	if err != nil {
+		return false, err
+	}
+	out, err := runGit(dir, path, rev, "cat-file", "-t", object)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) == "tree", nil
+}
+
+// ListGitFiles lists the files under dir at git revision rev, relative to
+// dir, with "git ls-tree -r".
+func ListGitFiles(dir, rev string) ([]string, error) {
+	// --full-tree lists names relative to the tree rather than the working directory
+	gitDir, object, err := gitObject(dir, rev)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit(gitDir, dir, rev, "ls-tree", "--full-tree", "-r", "--name-only", "-z", object)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			files = append(files, filepath.FromSlash(name))
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitGitRevision(t *testing.T) {
+	tests := []struct {
+		arg      string
+		wantPath string
+		wantRev  string
+		wantOK   bool
+	}{
+		{"values.yaml@{HEAD~1}", "values.yaml", "HEAD~1", true},
+		{"config/a.yaml@{v1.2.0}", "config/a.yaml", "v1.2.0", true},
+		{"dir@{main}", "dir", "main", true},
+		{"values.yaml", "values.yaml", "", false},
+		{"values.yaml@{}", "values.yaml@{}", "", false},
+		{"@{HEAD}", "@{HEAD}", "", false},
+		{"-", "-", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			path, rev, ok := SplitGitRevision(tt.arg)
+			if path != tt.wantPath || rev != tt.wantRev || ok != tt.wantOK {
+				t.Errorf("SplitGitRevision(%q) = %q, %q, %v, want %q, %q, %v",
+					tt.arg, path, rev, ok, tt.wantPath, tt.wantRev, tt.wantOK)
+			}
+			if ok && JoinGitRevision(path, rev) != tt.arg {
+				t.Errorf("JoinGitRevision(%q, %q) = %q, want %q", path, rev, JoinGitRevision(path, rev), tt.arg)
+			}
+		})
+	}
+
+	// A file whose name looks like a revision is read as a file
+	file := filepath.Join(t.TempDir(), "odd@{name}")
+	if err := os.WriteFile(file, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := SplitGitRevision(file); ok {
+		t.Errorf("SplitGitRevision(%q) treated an existing file as a revision", file)
+	}
+}
+
+// gitRepo creates a repository with two commits of config/values.yaml and
+// returns its directory.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("config/values.yaml", "replicas: 1\n")
+	write("config/nested/app.json", "{\"port\": 80}\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	write("config/values.yaml", "replicas: 2\n")
+	git("commit", "-q", "-a", "-m", "second")
+	return dir
+}
+
+func TestReadInput_GitRevision(t *testing.T) {
+	dir := gitRepo(t)
+	file := filepath.Join(dir, "config", "values.yaml")
+
+	input, err := ReadInput(JoinGitRevision(file, "HEAD~1"), "auto")
+	if err != nil {
+		t.Fatalf("ReadInput() error = %v", err)
+	}
+	if string(input.Data) != "replicas: 1\n" {
+		t.Errorf("ReadInput() data = %q, want the first commit", input.Data)
+	}
+	if input.Format != "yaml" {
+		t.Errorf("ReadInput() format = %q, want yaml", input.Format)
+	}
+	if input.Path != file+"@{HEAD~1}" {
+		t.Errorf("ReadInput() path = %q, want %q", input.Path, file+"@{HEAD~1}")
+	}
+
+	// Files are read from revisions where their directory no longer exists
+	nested := filepath.Join(dir, "config", "nested")
+	if err := os.RemoveAll(nested); err != nil {
+		t.Fatal(err)
+	}
+	input, err = ReadInput(JoinGitRevision(filepath.Join(nested, "app.json"), "HEAD"), "auto")
+	if err != nil {
+		t.Fatalf("ReadInput() of a deleted file error = %v", err)
+	}
+	if input.Format != "json" {
+		t.Errorf("ReadInput() of a deleted file format = %q, want json", input.Format)
+	}
+
+	tests := []struct {
+		name    string
+		arg     string
+		wantErr string
+	}{
+		{"missing path", JoinGitRevision(filepath.Join(dir, "config", "nope.yaml"), "HEAD"), "does not exist at revision HEAD"},
+		{"unknown revision", JoinGitRevision(file, "no-such-rev"), `unknown git revision "no-such-rev"`},
+		{"not a repository", JoinGitRevision(filepath.Join(t.TempDir(), "a.yaml"), "HEAD"), "not in a git repository"},
+		{"option as revision", JoinGitRevision(file, "--output=x"), `invalid git revision "--output=x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadInput(tt.arg, "auto")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadInput(%q) error = %v, want %q", tt.arg, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListGitFiles(t *testing.T) {
+	dir := gitRepo(t)
+	config := filepath.Join(dir, "config")
+
+	isDir, err := IsGitDir(config, "HEAD")
+	if err != nil || !isDir {
+		t.Errorf("IsGitDir(config) = %v, %v, want true", isDir, err)
+	}
+	isDir, err = IsGitDir(filepath.Join(config, "values.yaml"), "HEAD")
+	if err != nil || isDir {
+		t.Errorf("IsGitDir(values.yaml) = %v, %v, want false", isDir, err)
+	}
+
+	files, err := ListGitFiles(config, "HEAD")
+	if err != nil {
+		t.Fatalf("ListGitFiles() error = %v", err)
+	}
+	want := []string{filepath.Join("nested", "app.json"), "values.yaml"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("ListGitFiles() = %v, want %v", files, want)
+	}
+
+	if _, err := IsGitDir(config, "-p"); err == nil || !strings.Contains(err.Error(), "invalid git revision") {
+		t.Errorf("IsGitDir(-p) error = %v, want an invalid revision", err)
+	}
+	if _, err := ListGitFiles(config, "HEAD:config"); err == nil || !strings.Contains(err.Error(), "unknown git revision") {
+		t.Errorf("ListGitFiles() of a tree revision error = %v, want an unknown revision", err)
+	}
+}
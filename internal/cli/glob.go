@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IsGlob reports whether an argument is a glob pattern rather than a path:
+// it contains *, ?, or [ and does not name an existing file.
+func IsGlob(arg string) bool {
+	if !strings.ContainsAny(arg, "*?[") {
+		return false
+	}
+	_, err := os.Stat(arg)
+	return err != nil
+}
+
+// ExpandGlob returns the files matching a pattern, relative to the pattern's
+// root: the directory before its first wildcard segment. A "**" segment
+// matches any number of directories; other segments use filepath.Match
+// syntax. Results are sorted.
+func ExpandGlob(pattern string) (root string, files []string, err error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	i := 0
+	for i < len(segments) && !strings.ContainsAny(segments[i], "*?[") {
+		i++
+	}
+	for _, seg := range segments[i:] {
+		if _, err := path.Match(seg, ""); err != nil {
+			return "", nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	root = strings.Join(segments[:i], "/")
+	if root == "" && strings.HasPrefix(pattern, "/") {
+		root = "/"
+	} else if root == "" {
+		root = "."
+	}
+	root = filepath.FromSlash(root)
+	patternSegs := segments[i:]
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if matchGlob(strings.Split(filepath.ToSlash(rel), "/"), patternSegs) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to expand %q: %w", pattern, err)
+	}
+	sort.Strings(files)
+	return root, files, nil
+}
+
+// matchGlob reports whether path segments match pattern segments.
+func matchGlob(pathSegs, patternSegs []string) bool {
+	if len(patternSegs) == 0 {
+		return len(pathSegs) == 0
+	}
+	if patternSegs[0] == "**" {
+		// Match no directories, or consume one and try again
+		return matchGlob(pathSegs, patternSegs[1:]) ||
+			(len(pathSegs) > 0 && matchGlob(pathSegs[1:], patternSegs))
+	}
+	if len(pathSegs) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(patternSegs[0], pathSegs[0]); !ok {
+		return false
+	}
+	return matchGlob(pathSegs[1:], patternSegs[1:])
+}
+
+// MatchExclude reports whether a slash-separated relative path matches any
+// of the patterns. Like .gitignore, a pattern without a slash matches the
+// last element of the path at any depth; other patterns, and patterns with
+// a leading slash, match the whole path, with "**" matching any number of
+// directories.
+func MatchExclude(relPath string, patterns []string) bool {
+	segments := strings.Split(relPath, "/")
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		anchored := strings.HasPrefix(pattern, "/")
+		pattern = strings.Trim(pattern, "/")
+		if !anchored && !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, segments[len(segments)-1]); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(segments, strings.Split(pattern, "/")) {
+			return true
+		}
+	}
+	return false
+}
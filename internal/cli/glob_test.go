@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandGlob(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"prod/app.yaml", "prod/db.json", "prod/sub/x.yaml", "prod/sub/deep/y.yaml", "staging/app.yaml"} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("a: 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		pattern  string
+		wantRoot string
+		want     []string
+	}{
+		{"extension", "prod/*.yaml", "prod", []string{"app.yaml"}},
+		{"any file", "prod/*", "prod", []string{"app.yaml", "db.json"}},
+		{"double star", "prod/**/*.yaml", "prod", []string{"app.yaml", "sub/deep/y.yaml", "sub/x.yaml"}},
+		{"wildcard directory", "*/app.yaml", "", []string{"prod/app.yaml", "staging/app.yaml"}},
+		{"no matches", "prod/*.toml", "prod", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, files, err := ExpandGlob(filepath.Join(tmpDir, tt.pattern))
+			if err != nil {
+				t.Fatalf("ExpandGlob() error = %v", err)
+			}
+			if want := filepath.Join(tmpDir, tt.wantRoot); root != want {
+				t.Errorf("ExpandGlob() root = %q, want %q", root, want)
+			}
+			var got []string
+			for _, f := range files {
+				got = append(got, filepath.ToSlash(f))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandGlob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := ExpandGlob(filepath.Join(tmpDir, "[")); err == nil {
+		t.Error("ExpandGlob() with a malformed pattern should fail")
+	}
+}
+
+func TestIsGlob(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "odd[1].yaml")
+	if err := os.WriteFile(file, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"env/*.yaml", true},
+		{"env/**/values.yaml", true},
+		{"values-?.yaml", true},
+		{"values.yaml", false},
+		{file, false},
+	}
+	for _, tt := range tests {
+		if got := IsGlob(tt.arg); got != tt.want {
+			t.Errorf("IsGlob(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestMatchExclude(t *testing.T) {
+	tests := []struct {
+		path    string
+		pattern string
+		want    bool
+	}{
+		{"node_modules", "node_modules", true},
+		{"a/b/node_modules", "node_modules", true},
+		{"a/app.bak.yaml", "*.bak.yaml", true},
+		{"a/app.yaml", "*.bak.yaml", false},
+		{".git", ".*", true},
+		{"generated", "/generated", true},
+		{"env/generated", "/generated", false},
+		{"charts/sub/values.yaml", "charts/**", true},
+		{"charts/sub/values.yaml", "charts/*", false},
+		{"env/prod/values.yaml", "env/*/values.yaml", true},
+		{"env/prod/values.yaml", "**/values.yaml", true},
+	}
+	for _, tt := range tests {
+		if got := MatchExclude(tt.path, []string{tt.pattern}); got != tt.want {
+			t.Errorf("MatchExclude(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+}
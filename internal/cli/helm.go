@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// HelmOptions configures how "helm template" renders a chart.
+type HelmOptions struct {
+	Release   string   // Release name, "release-name" if empty
+	Namespace string   // Release namespace
+	Version   string   // Chart version, for charts from a repository
+	Values    []string // Values files, in order
+	Set       []string // Values set on the command line, as "key=value"
+}
+
+// RenderHelmChart renders a chart, given as a directory, archive, repository
+// reference, or OCI reference, into Kubernetes manifests with
+// "helm template".
+func RenderHelmChart(chart string, opts HelmOptions) (*InputSource, error) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		return nil, fmt.Errorf("rendering chart %s requires helm, which was not found on PATH\nHint: Install helm, or compare manifests rendered with \"helm template\"", chart)
+	}
+
+	release := opts.Release
+	if release == "" {
+		release = "release-name"
+	}
+	args := []string{"template", release, chart}
+	if opts.Namespace != "" {
+		args = append(args, "--namespace", opts.Namespace)
+	}
+	if opts.Version != "" {
+		args = append(args, "--version", opts.Version)
+	}
+	for _, values := range opts.Values {
+		args = append(args, "--values", values)
+	}
+	for _, set := range opts.Set {
+		args = append(args, "--set", set)
+	}
+
+	cmd := exec.Command("helm", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to run helm: %w", err)
+		}
+		return nil, fmt.Errorf("helm template %s failed: %s", chart, strings.TrimSpace(stderr.String()))
+	}
+
+	return &InputSource{
+		Path:   "helm:" + chart,
+		Data:   data,
+		Format: "yaml",
+	}, nil
+}
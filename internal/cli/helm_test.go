@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRenderHelmChart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	// A fake helm that prints its arguments as a manifest
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$3\" = broken ]; then echo 'Error: chart not found' >&2; exit 1; fi\necho \"args: $*\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "helm"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	input, err := RenderHelmChart("./chart", HelmOptions{
+		Namespace: "prod",
+		Version:   "1.2.3",
+		Values:    []string{"a.yaml", "b.yaml"},
+		Set:       []string{"replicas=3"},
+	})
+	if err != nil {
+		t.Fatalf("RenderHelmChart() error = %v", err)
+	}
+	want := "args: template release-name ./chart --namespace prod --version 1.2.3 --values a.yaml --values b.yaml --set replicas=3\n"
+	if string(input.Data) != want || input.Path != "helm:./chart" || input.Format != "yaml" {
+		t.Errorf("RenderHelmChart() = %q from %s as %s, want %q", input.Data, input.Path, input.Format, want)
+	}
+
+	if _, err := RenderHelmChart("broken", HelmOptions{}); err == nil || !strings.Contains(err.Error(), "chart not found") {
+		t.Errorf("RenderHelmChart() of a broken chart error = %v, want helm's error", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err := RenderHelmChart("./chart", HelmOptions{}); err == nil || !strings.Contains(err.Error(), "requires helm") {
+		t.Errorf("RenderHelmChart() without helm error = %v, want a missing helm error", err)
+	}
+}
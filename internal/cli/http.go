@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHTTPTimeout bounds fetching a URL input.
+	DefaultHTTPTimeout = 30 * time.Second
+	// DefaultMaxHTTPSize caps the size of a URL input at 32 MiB.
+	DefaultMaxHTTPSize = 32 << 20
+)
+
+// IsURL reports whether an input path is an http or https URL.
+func IsURL(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// ParseHeaders parses "Name: value" header flags.
+func ParseHeaders(headers []string) (http.Header, error) {
+	h := make(http.Header)
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q: expected \"Name: value\"", header)
+		}
+		h.Add(name, strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+// readURLInput fetches an http(s) URL. Failures to fetch are reported as
+// "failed to fetch" errors, distinct from the parse errors of its content.
+func readURLInput(rawURL, formatHint string, opts InputOptions) (*InputSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	headers, err := ParseHeaders(opts.HTTPHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := opts.HTTPTimeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	maxSize := opts.MaxHTTPSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxHTTPSize
+	}
+
+	client := &http.Client{Timeout: timeout}
+	if opts.Insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // only on request
+		client.Transport = transport
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	req.Header = headers
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch %s: HTTP %s", u.Redacted(), resp.Status)
+	}
+
+	// Read one byte past the cap to tell a full-size body from a larger one
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", u.Redacted(), err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("failed to fetch %s: response exceeds %d bytes", u.Redacted(), maxSize)
+	}
+
+	format := formatHint
+	if format == "" || format == "auto" {
+		format = formatFromContentType(resp.Header.Get("Content-Type"))
+		if format == "" {
+			format = detectFormat(u.Path, data)
+		}
+		if format == "" {
+			return nil, undetectedFormat(u.Redacted())
+		}
+	}
+
+	return &InputSource{
+		Path:   u.Redacted(),
+		Data:   data,
+		Format: format,
+	}, nil
+}
+
+// formatFromContentType maps a Content-Type header to a format, or "" for
+// generic types such as text/plain that leave detection to the URL and content.
+func formatFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "application/yaml", mediaType == "application/x-yaml",
+		mediaType == "text/yaml", mediaType == "text/x-yaml", strings.HasSuffix(mediaType, "+yaml"):
+		return "yaml"
+	case mediaType == "application/toml", mediaType == "text/x-toml":
+		return "toml"
+	case mediaType == "application/hcl", mediaType == "text/x-hcl":
+		return "hcl"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the name of the file listing ignore paths for the
+// configuration files in its directory and below.
+const IgnoreFileName = ".configdiffignore"
+
+// IgnoreRule is an ignore path pattern read from an ignore file.
+type IgnoreRule struct {
+	// Pattern is the path glob, as for --ignore; a leading "!" re-includes
+	// paths an earlier pattern ignored.
+	Pattern string
+
+	// Files is the file glob of the [file:...] section the rule is in, or ""
+	// for rules that apply to every file.
+	Files string
+
+	// Source is where the rule comes from, as "path:line".
+	Source string
+}
+
+// IgnoreFile is a parsed ignore file.
+type IgnoreFile struct {
+	Path  string
+	Rules []IgnoreRule
+}
+
+// ParseIgnoreFile parses the content of an ignore file: one path glob per
+// line, blank lines and # comments skipped, "!pattern" to re-include, and
+// "[file:GLOB]" headers scoping the rules after them to files matching GLOB
+// ("[file:*]" ends a section).
+func ParseIgnoreFile(path string, data []byte) (*IgnoreFile, error) {
+	f := &IgnoreFile{Path: path}
+	files := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+			continue
+		case strings.HasPrefix(text, "["):
+			glob, ok := strings.CutPrefix(text, "[file:")
+			glob, closed := strings.CutSuffix(glob, "]")
+			if !ok || !closed || strings.TrimSpace(glob) == "" {
+				return nil, fmt.Errorf("%s:%d: invalid section header %q: expected [file:GLOB]", path, line, text)
+			}
+			files = strings.TrimSpace(glob)
+			if files == "*" {
+				files = ""
+			}
+		default:
+			if strings.TrimPrefix(text, "!") == "" {
+				return nil, fmt.Errorf("%s:%d: empty pattern", path, line)
+			}
+			f.Rules = append(f.Rules, IgnoreRule{
+				Pattern: text,
+				Files:   files,
+				Source:  fmt.Sprintf("%s:%d", path, line),
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// FindIgnoreFile looks for an ignore file in dir and its parents, up to the
+// root of the git repository containing dir. Outside a repository only dir
+// itself is searched. It returns "" if there is none.
+func FindIgnoreFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	inRepo := repoRoot(dir) != ""
+	for {
+		path := filepath.Join(dir, IgnoreFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if !inRepo || isRepoRoot(dir) || parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// isRepoRoot reports whether dir is the root of a git repository.
+func isRepoRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// repoRoot returns the root of the git repository containing dir, or "".
+func repoRoot(dir string) string {
+	for {
+		if isRepoRoot(dir) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadIgnoreFile finds and parses the ignore file for the configuration
+// files in dir, returning nil if there is none.
+func LoadIgnoreFile(dir string) (*IgnoreFile, error) {
+	path, err := FindIgnoreFile(dir)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return ParseIgnoreFile(path, data)
+}
+
+// RulesFor returns the rules that apply to file, in order. Section globs
+// are matched against file's path relative to the ignore file's directory
+// as --exclude patterns are: without a slash they match the file name.
+func (f *IgnoreFile) RulesFor(file string) []IgnoreRule {
+	if f == nil {
+		return nil
+	}
+	rel := relativePath(filepath.Dir(f.Path), file)
+	var rules []IgnoreRule
+	for _, rule := range f.Rules {
+		if rule.Files == "" || MatchExclude(rel, []string{rule.Files}) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// relativePath returns the slash-separated path of file relative to dir, or
+// its name if it is outside dir, for matching with MatchExclude.
+func relativePath(dir, file string) string {
+	rel := filepath.Base(file)
+	if abs, err := filepath.Abs(file); err == nil {
+		if r, err := filepath.Rel(dir, abs); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+		}
+	}
+	return filepath.ToSlash(rel)
+}
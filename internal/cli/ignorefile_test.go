@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIgnoreFile(t *testing.T) {
+	data := "# generated fields\n/metadata/*\n!/metadata/name\n\n[file:*.tf]\n/tags\n[file:*]\n/status\n"
+	f, err := ParseIgnoreFile("dir/.configdiffignore", []byte(data))
+	if err != nil {
+		t.Fatalf("ParseIgnoreFile() error = %v", err)
+	}
+	want := []IgnoreRule{
+		{Pattern: "/metadata/*", Source: "dir/.configdiffignore:2"},
+		{Pattern: "!/metadata/name", Source: "dir/.configdiffignore:3"},
+		{Pattern: "/tags", Files: "*.tf", Source: "dir/.configdiffignore:6"},
+		{Pattern: "/status", Source: "dir/.configdiffignore:8"},
+	}
+	if !reflect.DeepEqual(f.Rules, want) {
+		t.Errorf("ParseIgnoreFile() rules = %+v, want %+v", f.Rules, want)
+	}
+
+	for _, bad := range []string{"[tf]\n", "[file:]\n", "!\n"} {
+		if _, err := ParseIgnoreFile("x", []byte(bad)); err == nil {
+			t.Errorf("ParseIgnoreFile(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestLoadIgnoreFile(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	nested := filepath.Join(repo, "env", "prod")
+	for _, dir := range []string{filepath.Join(repo, ".git"), nested} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files above the repository root are not used
+	write(filepath.Join(root, IgnoreFileName), "/outside\n")
+	if f, err := LoadIgnoreFile(nested); err != nil || f != nil {
+		t.Errorf("LoadIgnoreFile() = %v, %v, want none inside a repository without one", f, err)
+	}
+
+	// The repository root's file is found from below
+	write(filepath.Join(repo, IgnoreFileName), "/status\n[file:env/prod/*.tf]\n/tags\n")
+	f, err := LoadIgnoreFile(nested)
+	if err != nil || f == nil {
+		t.Fatalf("LoadIgnoreFile() = %v, %v, want the repository's file", f, err)
+	}
+	if got := f.RulesFor(filepath.Join(nested, "main.tf")); len(got) != 2 {
+		t.Errorf("RulesFor(main.tf) = %+v, want both rules", got)
+	}
+	if got := f.RulesFor(filepath.Join(nested, "values.yaml")); len(got) != 1 || got[0].Pattern != "/status" {
+		t.Errorf("RulesFor(values.yaml) = %+v, want only /status", got)
+	}
+
+	// The nearest file wins
+	write(filepath.Join(nested, IgnoreFileName), "/spec\n")
+	f, err = LoadIgnoreFile(nested)
+	if err != nil || f == nil || !strings.HasPrefix(f.Path, nested) {
+		t.Errorf("LoadIgnoreFile() = %v, %v, want the nearest file", f, err)
+	}
+
+	// Outside a repository only the directory itself is searched
+	outside := filepath.Join(root, "plain", "sub")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := LoadIgnoreFile(outside); err != nil || f != nil {
+		t.Errorf("LoadIgnoreFile() outside a repository = %v, %v, want none", f, err)
+	}
+}
@@ -4,13 +4,12 @@
 package cli
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/pfrederiksen/configdiff"
 	"github.com/pfrederiksen/configdiff/parse"
 )
 
@@ -21,21 +20,57 @@ type InputSource struct {
 	Format string
 }
 
-// ReadInput reads configuration data from a file or stdin
+// InputOptions configures how inputs other than local files are read.
+type InputOptions struct {
+	// HTTPTimeout bounds fetching an http(s) URL; 0 means DefaultHTTPTimeout.
+	HTTPTimeout time.Duration
+	// HTTPHeaders are "Name: value" headers sent with every request.
+	HTTPHeaders []string
+	// Insecure skips TLS certificate verification.
+	Insecure bool
+	// MaxHTTPSize caps the response body in bytes; 0 means DefaultMaxHTTPSize.
+	MaxHTTPSize int64
+	// StripComponents removes leading directories from names inside archives.
+	StripComponents int
+}
+
+// ReadInput reads configuration data from a file, stdin, git revision,
+// archive, or URL with default options.
 func ReadInput(path string, formatHint string) (*InputSource, error) {
+	return ReadInputWith(path, formatHint, InputOptions{})
+}
+
+// ReadInputWith reads configuration data from a file or stdin, from git for
+// "path@{rev}", from an archive for "archive.tgz!path", or from an http(s)
+// URL as configured by opts.
+func ReadInputWith(path string, formatHint string, opts InputOptions) (*InputSource, error) {
 	var data []byte
 	var err error
 
+	if IsURL(path) {
+		return readURLInput(path, formatHint, opts)
+	}
+
+	// "path@{rev}" reads path from git
+	if file, rev, ok := SplitGitRevision(path); ok {
+		return readGitInput(file, rev, formatHint)
+	}
+
+	// "archive.tgz!path" reads one file from an archive
+	if archive, inner, ok := SplitArchivePath(path); ok {
+		return readArchiveInput(archive, inner, formatHint, opts.StripComponents)
+	}
+
 	// Read from stdin or file
 	if path == "-" {
 		data, err = io.ReadAll(os.Stdin)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read from stdin: %w", err)
+			return nil, &configdiff.ReadError{File: path, Err: err}
 		}
 	} else {
 		data, err = os.ReadFile(path)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read file %q: %w", path, err)
+			return nil, &configdiff.ReadError{File: path, Err: err}
 		}
 	}
 
@@ -44,7 +79,7 @@ func ReadInput(path string, formatHint string) (*InputSource, error) {
 	if format == "" || format == "auto" {
 		format = detectFormat(path, data)
 		if format == "" {
-			return nil, fmt.Errorf("unable to detect format for %q\nHint: Specify format explicitly with --format", path)
+			return nil, undetectedFormat(path)
 		}
 	}
 
@@ -55,45 +90,19 @@ func ReadInput(path string, formatHint string) (*InputSource, error) {
 	}, nil
 }
 
-// detectFormat attempts to detect the configuration format
-func detectFormat(path string, data []byte) string {
-	// First, try to detect from file extension
-	if path != "-" {
-		ext := strings.ToLower(filepath.Ext(path))
-		switch ext {
-		case ".yaml", ".yml":
-			return "yaml"
-		case ".json":
-			return "json"
-		case ".hcl", ".tf":
-			return "hcl"
-		case ".toml":
-			return "toml"
-		}
-	}
+// undetectedFormat returns the error for an input whose format could not be
+// detected.
+func undetectedFormat(label string) error {
+	return &configdiff.ParseError{File: label, Err: fmt.Errorf("unable to detect format\nHint: Specify format explicitly with --format")}
+}
 
-	// Try to detect from content
-	return detectFromContent(data)
+// detectFormat attempts to detect the configuration format, from the file
+// extension and then from content
+func detectFormat(path string, data []byte) string {
+	return string(parse.DetectFileFormat(path, data))
 }
 
 // detectFromContent attempts to detect format from content
 func detectFromContent(data []byte) string {
-	// Trim leading whitespace
-	trimmed := bytes.TrimLeft(data, " \t\n\r")
-	if len(trimmed) == 0 {
-		return ""
-	}
-
-	// JSON starts with { or [
-	if trimmed[0] == '{' || trimmed[0] == '[' {
-		return "json"
-	}
-
-	// Try parsing as YAML (most permissive)
-	// YAML is the default fallback since it's the most common
-	if _, err := parse.ParseYAML(data); err == nil {
-		return "yaml"
-	}
-
-	return ""
+	return string(parse.DetectFileFormat("", data))
 }
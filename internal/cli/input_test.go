@@ -1,9 +1,17 @@
 package cli
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/pfrederiksen/configdiff"
 )
 
 func TestReadInput(t *testing.T) {
@@ -132,6 +140,31 @@ func TestDetectFromContent(t *testing.T) {
 			data: []byte(""),
 			want: "",
 		},
+		{
+			name: "toml",
+			data: []byte("[server]\nport = 8080\n"),
+			want: "toml",
+		},
+		{
+			name: "plain word",
+			data: []byte("hello\n"),
+			want: "",
+		},
+		{
+			name: "properties",
+			data: []byte("db.host=localhost\ndb.port=5432\n"),
+			want: "",
+		},
+		{
+			name: "terraform",
+			data: readDetect(t, "main.tf"),
+			want: "hcl",
+		},
+		{
+			name: "prose",
+			data: readDetect(t, "README.md"),
+			want: "",
+		},
 	}
 
 	for _, tt := range tests {
@@ -143,3 +176,128 @@ func TestDetectFromContent(t *testing.T) {
 		})
 	}
 }
+
+// readDetect reads a format detection input from testdata.
+func readDetect(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "detect", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadInput_UndetectedFormat(t *testing.T) {
+	// Without the .md extension's help, prose is not guessed to be YAML
+	_, err := ReadInput(filepath.Join("..", "..", "testdata", "detect", "README.md"), "auto")
+	if err == nil {
+		t.Fatal("ReadInput() expected error for prose, got nil")
+	}
+	if !strings.Contains(err.Error(), "--format") {
+		t.Errorf("ReadInput() error = %v, want a hint to use --format", err)
+	}
+}
+
+func TestReadInput_URL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/typed":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"a": 1}`)
+		case "/values.yaml":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "a: 1\n")
+		case "/sniffed":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			fmt.Fprint(w, `[1, 2]`)
+		case "/private":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "a: 1\n")
+		case "/large.yaml":
+			fmt.Fprint(w, strings.Repeat("# padding\n", 10))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		opts       InputOptions
+		wantFormat string
+		wantErr    string
+	}{
+		{name: "content type", path: "/typed", wantFormat: "json"},
+		{name: "extension", path: "/values.yaml", wantFormat: "yaml"},
+		{name: "content sniffing", path: "/sniffed", wantFormat: "json"},
+		{name: "header", path: "/private", opts: InputOptions{HTTPHeaders: []string{"Authorization: Bearer secret"}}, wantFormat: "yaml"},
+		{name: "missing header", path: "/private", wantErr: "HTTP 401"},
+		{name: "not found", path: "/missing.yaml", wantErr: "HTTP 404"},
+		{name: "size cap", path: "/large.yaml", opts: InputOptions{MaxHTTPSize: 50}, wantErr: "exceeds 50 bytes"},
+		{name: "invalid header", path: "/typed", opts: InputOptions{HTTPHeaders: []string{"no colon"}}, wantErr: "invalid header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := ReadInputWith(server.URL+tt.path, "auto", tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadInputWith() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadInputWith() error = %v", err)
+			}
+			if input.Format != tt.wantFormat {
+				t.Errorf("ReadInputWith() format = %q, want %q", input.Format, tt.wantFormat)
+			}
+		})
+	}
+
+	// Network failures are fetch errors, not parse errors
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if _, err := ReadInput(closed.URL+"/values.yaml", "auto"); err == nil || !strings.HasPrefix(err.Error(), "failed to fetch") {
+		t.Errorf("ReadInput() of a closed server error = %v, want a fetch error", err)
+	}
+}
+
+func TestReadInput_URLInsecure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "a: 1\n")
+	}))
+	defer server.Close()
+
+	// The test server's certificate is self-signed
+	if _, err := ReadInput(server.URL+"/values.yaml", "auto"); err == nil {
+		t.Error("ReadInput() accepted an untrusted certificate")
+	}
+	if _, err := ReadInputWith(server.URL+"/values.yaml", "auto", InputOptions{Insecure: true}); err != nil {
+		t.Errorf("ReadInputWith(Insecure) error = %v", err)
+	}
+}
+
+func TestReadInputErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	missing := filepath.Join(tmpDir, "missing.yaml")
+	_, err := ReadInput(missing, "auto")
+	var readErr *configdiff.ReadError
+	if !errors.As(err, &readErr) || readErr.File != missing || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadInput() of a missing file error = %v, want a *configdiff.ReadError", err)
+	}
+
+	unknown := filepath.Join(tmpDir, "data")
+	if err := os.WriteFile(unknown, []byte("a: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadInput(unknown, "auto")
+	var parseErr *configdiff.ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != unknown || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("ReadInput() of an undetectable format error = %v, want a *configdiff.ParseError with a hint", err)
+	}
+}
@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// ErrKubeNotFound reports that a live Kubernetes object does not exist.
+var ErrKubeNotFound = errors.New("not found in the cluster")
+
+// KubeRef identifies a Kubernetes object, as in "kubectl get KIND/NAME".
+type KubeRef struct {
+	// Resource is the kind or resource, optionally qualified as
+	// "kind.version.group", e.g. "deploy" or "deployment.v1.apps".
+	Resource  string
+	Name      string
+	Namespace string
+}
+
+// String returns the reference as "resource/name", with its namespace if set.
+func (r KubeRef) String() string {
+	if r.Namespace == "" {
+		return r.Resource + "/" + r.Name
+	}
+	return r.Namespace + "/" + r.Resource + "/" + r.Name
+}
+
+// ParseKubeRef parses a "KIND/NAME" reference in namespace.
+func ParseKubeRef(ref, namespace string) (KubeRef, error) {
+	resource, name, ok := strings.Cut(ref, "/")
+	if !ok || resource == "" || name == "" || strings.Contains(name, "/") {
+		return KubeRef{}, fmt.Errorf("invalid Kubernetes object %q: expected KIND/NAME, e.g. deploy/myapp", ref)
+	}
+	return KubeRef{Resource: resource, Name: name, Namespace: namespace}, nil
+}
+
+// KubeRefFor returns the reference to the live object a local manifest
+// describes, matching it by apiVersion, kind, namespace, and name. The
+// manifest's own namespace takes precedence over namespace.
+func KubeRefFor(manifest *tree.Node, namespace string) (KubeRef, bool) {
+	apiVersion := stringAt(manifest, "/apiVersion")
+	kind := stringAt(manifest, "/kind")
+	name := stringAt(manifest, "/metadata/name")
+	if apiVersion == "" || kind == "" || name == "" {
+		return KubeRef{}, false
+	}
+	if ns := stringAt(manifest, "/metadata/namespace"); ns != "" {
+		namespace = ns
+	}
+
+	// Qualify the kind so that kinds with the same name in different API
+	// groups are not confused; the core group has no qualified form
+	resource := strings.ToLower(kind)
+	if group, version, ok := strings.Cut(apiVersion, "/"); ok {
+		resource += "." + version + "." + group
+	}
+	return KubeRef{Resource: resource, Name: name, Namespace: namespace}, true
+}
+
+// stringAt returns the string at path in n, or "".
+func stringAt(n *tree.Node, path string) string {
+	if n == nil || n.Kind != tree.KindObject {
+		return ""
+	}
+	v := n.GetByPath(path)
+	if v == nil || v.Kind != tree.KindString {
+		return ""
+	}
+	s, _ := v.Value.(string)
+	return s
+}
+
+// ReadKubeObject fetches a live object from the current kubeconfig context
+// with "kubectl get -o yaml". A missing object is reported with
+// ErrKubeNotFound.
+//
+// kubectl is run rather than a Kubernetes client linked in, as for helm and
+// git: it reads the kubeconfig, contexts, and credential plugins of the
+// user's cluster exactly as they are used to, resolves short and qualified
+// resource names, and keeps client-go and its dependencies, several times
+// the size of configdiff, out of the build. Without kubectl on PATH, the
+// error says so.
+func ReadKubeObject(ref KubeRef) (*InputSource, error) {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return nil, fmt.Errorf("fetching %s requires kubectl, which was not found on PATH\nHint: Install kubectl, or compare the output of \"kubectl get %s/%s -o yaml\" instead", ref, ref.Resource, ref.Name)
+	}
+
+	args := []string{"get", ref.Resource + "/" + ref.Name, "-o", "yaml"}
+	if ref.Namespace != "" {
+		args = append(args, "--namespace", ref.Namespace)
+	}
+
+	cmd := exec.Command("kubectl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("running kubectl to fetch %s failed: %w", ref, err)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "NotFound") || strings.Contains(msg, "not found") {
+			return nil, fmt.Errorf("%s: %w", ref, ErrKubeNotFound)
+		}
+		return nil, fmt.Errorf("kubectl get %s failed: %s", ref, msg)
+	}
+
+	return &InputSource{
+		Path:   "cluster:" + ref.String(),
+		Data:   data,
+		Format: "yaml",
+	}, nil
+}
+
+// kubeServerFields are set by the API server on every object and never
+// appear in manifests.
+var kubeServerFields = []string{
+	"status",
+	"metadata/managedFields",
+	"metadata/uid",
+	"metadata/resourceVersion",
+	"metadata/generation",
+	"metadata/creationTimestamp",
+	"metadata/selfLink",
+	"metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration",
+	"metadata/annotations/deployment.kubernetes.io~1revision",
+}
+
+// NormalizeKubeObject prepares a live object for comparison with the local
+// manifest it was applied from. Fields the API server maintains are removed,
+// and so are fields the manifest does not set, most of which are defaults
+// filled in by the server. Fields removed from the manifest but still set on
+// the live object are therefore not reported either.
+func NormalizeKubeObject(live, local *tree.Node) *tree.Node {
+	live = live.Clone()
+	for _, field := range kubeServerFields {
+		deleteField(live, field)
+	}
+	live = pruneTo(live, local)
+	if live != nil {
+		live.SetPaths("/")
+	}
+	return live
+}
+
+// deleteField removes the object field at a slash-separated path, in which
+// "~1" stands for a slash within a key.
+func deleteField(n *tree.Node, path string) {
+	keys := strings.Split(path, "/")
+	for i, key := range keys {
+		if n == nil || n.Kind != tree.KindObject {
+			return
+		}
+		key = strings.ReplaceAll(key, "~1", "/")
+		if i == len(keys)-1 {
+			delete(n.Object, key)
+			return
+		}
+		n = n.Object[key]
+	}
+}
+
+// pruneTo removes from live the object fields that local does not have.
+// Array elements are matched by their "name" field when every element has
+// one, as containers, ports, and env vars do, and by position otherwise.
+func pruneTo(live, local *tree.Node) *tree.Node {
+	if live == nil || local == nil || live.Kind != local.Kind {
+		return live
+	}
+
+	switch live.Kind {
+	case tree.KindObject:
+		for key, value := range live.Object {
+			localValue, ok := local.Object[key]
+			if !ok {
+				delete(live.Object, key)
+				continue
+			}
+			live.Object[key] = pruneTo(value, localValue)
+		}
+	case tree.KindArray:
+		localByName, named := elementsByName(local.Array)
+		if _, liveNamed := elementsByName(live.Array); !liveNamed {
+			named = false
+		}
+		for i, elem := range live.Array {
+			switch {
+			case named:
+				if localElem, ok := localByName[stringAt(elem, "/name")]; ok {
+					live.Array[i] = pruneTo(elem, localElem)
+				}
+			case i < len(local.Array):
+				live.Array[i] = pruneTo(elem, local.Array[i])
+			}
+		}
+	}
+	return live
+}
+
+// elementsByName indexes array elements by their "name" field, reporting
+// false if any element lacks one.
+func elementsByName(elems []*tree.Node) (map[string]*tree.Node, bool) {
+	byName := make(map[string]*tree.Node, len(elems))
+	for _, elem := range elems {
+		name := stringAt(elem, "/name")
+		if name == "" {
+			return nil, false
+		}
+		byName[name] = elem
+	}
+	return byName, true
+}
+
+// KubeIdentity returns the identity of the Kubernetes object a manifest
+// describes, as "kind.group/name" after its namespace if set, e.g.
+// "prod/deployment.apps/web". The API version is left out, so an object
+// keeps its identity when it moves to another version of its group. ok is
+// false if the manifest has no kind or name.
+func KubeIdentity(manifest *tree.Node) (string, bool) {
+	kind := stringAt(manifest, "/kind")
+	name := stringAt(manifest, "/metadata/name")
+	if kind == "" || name == "" {
+		return "", false
+	}
+	resource := strings.ToLower(kind)
+	if group, _, ok := strings.Cut(stringAt(manifest, "/apiVersion"), "/"); ok {
+		resource += "." + group
+	}
+	id := resource + "/" + name
+	if ns := stringAt(manifest, "/metadata/namespace"); ns != "" {
+		id = ns + "/" + id
+	}
+	return id, true
+}
+
+// SplitKubeResources indexes the objects in a stream of manifests, such as
+// the output of "helm template", by their KubeIdentity. Empty documents are
+// skipped and the items of List kinds are indexed one by one. Each object is
+// a document of its own, with paths from its root.
+func SplitKubeResources(docs []*tree.Node) (map[string]*tree.Node, error) {
+	resources := make(map[string]*tree.Node)
+	var add func(doc *tree.Node) error
+	add = func(doc *tree.Node) error {
+		if doc == nil || doc.Kind == tree.KindNull {
+			return nil
+		}
+		if items := doc.GetByPath("/items"); strings.HasSuffix(stringAt(doc, "/kind"), "List") && items != nil && items.Kind == tree.KindArray {
+			for _, item := range items.Array {
+				if err := add(item); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		id, ok := KubeIdentity(doc)
+		if !ok {
+			line := ""
+			if doc.Line > 0 {
+				line = fmt.Sprintf(" at line %d", doc.Line)
+			}
+			return fmt.Errorf("document%s is not a Kubernetes object: kind and metadata.name are required", line)
+		}
+		if _, ok := resources[id]; ok {
+			return fmt.Errorf("%s is defined more than once", id)
+		}
+		doc = doc.Clone()
+		doc.SetPaths("/")
+		resources[id] = doc
+		return nil
+	}
+	for _, doc := range docs {
+		if err := add(doc); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// kubePodSpecs are the paths of the pod spec in the workload kinds that
+// have one: Pod, the workloads with a pod template, and CronJob.
+var kubePodSpecs = []string{"/spec", "/spec/template/spec", "/spec/jobTemplate/spec/template/spec"}
+
+// KubePreset returns the ignore paths and array keys suited to comparing
+// Kubernetes manifests: fields the API server maintains and the chart
+// version label Helm adds are ignored, and the containers, volumes, and
+// image pull secrets of pod specs are matched by name.
+func KubePreset() (ignorePaths, arrayKeys []string) {
+	for _, field := range kubeServerFields {
+		ignorePaths = append(ignorePaths, "/"+strings.ReplaceAll(field, "~1", "/"))
+	}
+	ignorePaths = append(ignorePaths, "**/labels/helm.sh/chart")
+	for _, spec := range kubePodSpecs {
+		for _, list := range []string{"containers", "initContainers", "ephemeralContainers", "volumes", "imagePullSecrets"} {
+			arrayKeys = append(arrayKeys, spec+"/"+list+"=name")
+		}
+	}
+	return ignorePaths, arrayKeys
+}
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pfrederiksen/configdiff/parse"
+)
+
+func TestKubeRefFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifest  string
+		namespace string
+		want      KubeRef
+		wantOK    bool
+	}{
+		{
+			name:     "grouped kind",
+			manifest: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: prod\n",
+			want:     KubeRef{Resource: "deployment.v1.apps", Name: "web", Namespace: "prod"},
+			wantOK:   true,
+		},
+		{
+			name:      "core kind in flag namespace",
+			manifest:  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+			namespace: "staging",
+			want:      KubeRef{Resource: "configmap", Name: "settings", Namespace: "staging"},
+			wantOK:    true,
+		},
+		{
+			name:      "manifest namespace wins",
+			manifest:  "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  namespace: prod\n",
+			namespace: "staging",
+			want:      KubeRef{Resource: "service", Name: "web", Namespace: "prod"},
+			wantOK:    true,
+		},
+		{
+			name:     "not a manifest",
+			manifest: "replicas: 3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := parse.ParseYAML([]byte(tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := KubeRefFor(manifest, tt.namespace)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("KubeRefFor() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseKubeRef(t *testing.T) {
+	ref, err := ParseKubeRef("deploy/web", "prod")
+	if err != nil {
+		t.Fatalf("ParseKubeRef() error = %v", err)
+	}
+	if want := (KubeRef{Resource: "deploy", Name: "web", Namespace: "prod"}); ref != want {
+		t.Errorf("ParseKubeRef() = %+v, want %+v", ref, want)
+	}
+	if ref.String() != "prod/deploy/web" {
+		t.Errorf("String() = %q, want prod/deploy/web", ref.String())
+	}
+
+	for _, invalid := range []string{"web", "deploy/", "/web", "a/b/c"} {
+		if _, err := ParseKubeRef(invalid, ""); err == nil {
+			t.Errorf("ParseKubeRef(%q) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestNormalizeKubeObject(t *testing.T) {
+	live, err := parse.ParseYAML([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  uid: 1234
+  resourceVersion: "99"
+  generation: 4
+  managedFields:
+  - manager: kubectl
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+    team: platform
+spec:
+  replicas: 2
+  progressDeadlineSeconds: 600
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: proxy:1
+        terminationMessagePath: /dev/termination-log
+      - name: web
+        image: web:1
+        imagePullPolicy: IfNotPresent
+status:
+  readyReplicas: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := parse.ParseYAML([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    team: platform
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:2
+      - name: sidecar
+        image: proxy:1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := parse.ParseYAML([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    team: platform
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: proxy:1
+      - name: web
+        image: web:1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NormalizeKubeObject(live, local)
+	if !got.Equal(want) {
+		t.Errorf("NormalizeKubeObject() = %v, want %v", got.ToInterface(), want.ToInterface())
+	}
+	if live.GetByPath("/status") == nil {
+		t.Error("NormalizeKubeObject() modified the live object")
+	}
+}
+
+func TestKubeIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+		wantOK   bool
+	}{
+		{
+			name:     "grouped kind in a namespace",
+			manifest: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: prod\n",
+			want:     "prod/deployment.apps/web",
+			wantOK:   true,
+		},
+		{
+			name:     "version is left out",
+			manifest: "apiVersion: autoscaling/v2beta2\nkind: HorizontalPodAutoscaler\nmetadata:\n  name: web\n",
+			want:     "horizontalpodautoscaler.autoscaling/web",
+			wantOK:   true,
+		},
+		{
+			name:     "core kind",
+			manifest: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+			want:     "configmap/settings",
+			wantOK:   true,
+		},
+		{
+			name:     "no name",
+			manifest: "apiVersion: v1\nkind: ConfigMap\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := parse.ParseYAML([]byte(tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := KubeIdentity(manifest)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("KubeIdentity() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSplitKubeResources(t *testing.T) {
+	docs, err := parse.ParseYAMLDocuments([]byte(`---
+# Source: chart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := SplitKubeResources(docs)
+	if err != nil {
+		t.Fatalf("SplitKubeResources() error = %v", err)
+	}
+	var ids []string
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if want := []string{"configmap/a", "configmap/b", "service/web"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("SplitKubeResources() ids = %v, want %v", ids, want)
+	}
+	if name := resources["configmap/b"].GetByPath("/metadata/name"); name == nil || name.Path != "/metadata/name" {
+		t.Errorf("SplitKubeResources() paths of a List item = %+v, want /metadata/name", name)
+	}
+
+	for _, doc := range []string{
+		"kind: ConfigMap\nmetadata:\n  name: a\n---\nkind: ConfigMap\nmetadata:\n  name: a\n",
+		"kind: ConfigMap\n---\nreplicas: 3\n",
+	} {
+		docs, err := parse.ParseYAMLDocuments([]byte(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := SplitKubeResources(docs); err == nil {
+			t.Errorf("SplitKubeResources(%q) succeeded, want an error", doc)
+		}
+	}
+}
+
+func TestReadKubeObject(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake kubectl is a shell script")
+	}
+
+	// A fake kubectl that prints its arguments as an object
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$2\" = deploy/missing ]; then echo 'Error from server (NotFound): deployments \"missing\" not found' >&2; exit 1; fi\necho \"args: $*\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	input, err := ReadKubeObject(KubeRef{Resource: "deploy", Name: "web", Namespace: "prod"})
+	if err != nil {
+		t.Fatalf("ReadKubeObject() error = %v", err)
+	}
+	want := "args: get deploy/web -o yaml --namespace prod\n"
+	if string(input.Data) != want || input.Path != "cluster:prod/deploy/web" || input.Format != "yaml" {
+		t.Errorf("ReadKubeObject() = %q from %s as %s, want %q", input.Data, input.Path, input.Format, want)
+	}
+
+	if _, err := ReadKubeObject(KubeRef{Resource: "deploy", Name: "missing"}); !errors.Is(err, ErrKubeNotFound) {
+		t.Errorf("ReadKubeObject() of a missing object error = %v, want ErrKubeNotFound", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err := ReadKubeObject(KubeRef{Resource: "deploy", Name: "web"}); err == nil || !strings.Contains(err.Error(), "requires kubectl, which was not found on PATH") {
+		t.Errorf("ReadKubeObject() without kubectl error = %v, want a missing kubectl error", err)
+	}
+}
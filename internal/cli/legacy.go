@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// legacyChange and legacyNode keep the shape of the json-legacy format, the
+// changes as they marshaled before Change and Node had a JSON encoding of
+// their own: Go field names, and node kinds as numbers.
+type legacyChange struct {
+	Type          diff.ChangeType
+	Path          string
+	OldValue      *legacyNode
+	NewValue      *legacyNode
+	ArrayIndex    int
+	OldHighlights []diff.Span `json:",omitempty"`
+	NewHighlights []diff.Span `json:",omitempty"`
+}
+
+type legacyNode struct {
+	Kind   tree.NodeKind
+	Value  interface{}
+	Object map[string]*legacyNode
+	Array  []*legacyNode
+	Path   string
+	Line   int `json:",omitempty"`
+}
+
+// legacyChanges converts changes to the json-legacy format.
+func legacyChanges(changes []diff.Change) []legacyChange {
+	out := make([]legacyChange, len(changes))
+	for i, c := range changes {
+		out[i] = legacyChange{
+			Type:          c.Type,
+			Path:          c.Path,
+			OldValue:      toLegacyNode(c.OldValue),
+			NewValue:      toLegacyNode(c.NewValue),
+			ArrayIndex:    c.ArrayIndex,
+			OldHighlights: c.OldHighlights,
+			NewHighlights: c.NewHighlights,
+		}
+	}
+	return out
+}
+
+func toLegacyNode(n *tree.Node) *legacyNode {
+	if n == nil {
+		return nil
+	}
+	out := &legacyNode{Kind: n.Kind, Value: n.Value, Path: n.Path, Line: n.Line}
+	if n.Object != nil {
+		out.Object = make(map[string]*legacyNode, len(n.Object))
+		for k, v := range n.Object {
+			out.Object[k] = toLegacyNode(v)
+		}
+	}
+	if n.Array != nil {
+		out.Array = make([]*legacyNode, len(n.Array))
+		for i, elem := range n.Array {
+			out.Array[i] = toLegacyNode(elem)
+		}
+	}
+	return out
+}
@@ -0,0 +1,22 @@
+package cli
+
+import "strings"
+
+// ASCIIRequired decides whether output should be limited to ASCII symbols:
+// when the --ascii flag asks for it, or when the terminal or locale cannot
+// display UTF-8
+func ASCIIRequired(ascii bool) bool {
+	return ascii || !terminalUTF8()
+}
+
+// localeUTF8 reports whether the locale configured in the environment uses
+// UTF-8. As in setlocale, LC_ALL overrides LC_CTYPE, which overrides LANG.
+// An unset locale is assumed to be UTF-8, as on most CI runners
+func localeUTF8(getenv func(string) string) bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := strings.ToLower(getenv(name)); value != "" {
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
+		}
+	}
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package cli
+
+import "os"
+
+// terminalUTF8 reports whether the locale can display UTF-8
+func terminalUTF8() bool {
+	return localeUTF8(os.Getenv)
+}
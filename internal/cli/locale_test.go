@@ -0,0 +1,34 @@
+package cli
+
+import "testing"
+
+func TestLocaleUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{name: "unset", env: nil, want: true},
+		{name: "utf-8 lang", env: map[string]string{"LANG": "en_US.UTF-8"}, want: true},
+		{name: "utf8 lowercase", env: map[string]string{"LANG": "de_DE.utf8"}, want: true},
+		{name: "c locale", env: map[string]string{"LANG": "C"}, want: false},
+		{name: "latin-1", env: map[string]string{"LANG": "en_US.ISO-8859-1"}, want: false},
+		{name: "lc_all overrides lang", env: map[string]string{"LC_ALL": "POSIX", "LANG": "en_US.UTF-8"}, want: false},
+		{name: "lc_ctype overrides lang", env: map[string]string{"LC_CTYPE": "C.UTF-8", "LANG": "C"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(name string) string { return tt.env[name] }
+			if got := localeUTF8(getenv); got != tt.want {
+				t.Errorf("localeUTF8() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestASCIIRequired_Flag(t *testing.T) {
+	if !ASCIIRequired(true) {
+		t.Error("ASCIIRequired(true) = false, want true")
+	}
+}
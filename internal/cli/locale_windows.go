@@ -0,0 +1,18 @@
+//go:build windows
+
+package cli
+
+import "golang.org/x/sys/windows"
+
+// utf8CodePage is the Windows code page identifier for UTF-8
+const utf8CodePage = 65001
+
+// terminalUTF8 reports whether the console uses the UTF-8 code page.
+// Output that is not a console (a file or pipe) is assumed to be UTF-8
+func terminalUTF8() bool {
+	cp, err := windows.GetConsoleOutputCP()
+	if err != nil || cp == 0 {
+		return true
+	}
+	return cp == utf8CodePage
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/pfrederiksen/configdiff/report"
+)
+
+// MaskOptions returns the report options that control secret masking
+func (c *CLIOptions) MaskOptions() report.Options {
+	return report.Options{
+		MaskPaths:   c.MaskPaths,
+		MaskSecrets: c.MaskSecrets,
+		MaskMode:    c.MaskMode,
+	}
+}
+
+// MaskResult returns a copy of result with sensitive values masked in the
+// changes, the patch, and the pretty report. The input is not modified.
+func MaskResult(result *configdiff.Result, opts report.Options) (*configdiff.Result, error) {
+	changes := report.MaskChanges(result.Changes, opts)
+
+	p, err := patch.FromChanges(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mask patch: %w", err)
+	}
+
+	return &configdiff.Result{
+		Changes: changes,
+		Patch:   p,
+		Report:  report.GenerateDetailed(changes),
+	}, nil
+}
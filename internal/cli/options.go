@@ -2,60 +2,114 @@ package cli
 
 import (
 	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/diff"
 	"github.com/pfrederiksen/configdiff/internal/config"
+	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
 )
 
+// OutputFormats lists the valid --output formats.
+var OutputFormats = []string{
+	"report", "compact", "json", "json-legacy", "patch", "stat", "side-by-side", "git-diff", "markdown",
+	"sarif", "gh-annotations", "github-comment", "tree", "unified", "template", "csv", "ndjson", "tap",
+}
+
+// InputFormats lists the valid --format values.
+var InputFormats = []string{"auto", "yaml", "json", "hcl", "toml"}
+
 // CLIOptions holds all CLI flag values
 type CLIOptions struct {
-	OldFile        string
-	NewFile        string
-	Format         string
-	OldFormat      string
-	NewFormat      string
-	IgnorePaths    []string
-	ArrayKeys      []string
-	NumericStrings bool
-	BoolStrings    bool
-	StableOrder    bool
-	OutputFormat   string
-	NoColor        bool
-	MaxValueLength int
-	Quiet          bool
-	ExitCode       bool
+	OldFile          string
+	NewFile          string
+	Format           string
+	OldFormat        string
+	NewFormat        string
+	IgnorePaths      []string
+	ArrayKeys        []string
+	Preset           string
+	NumericStrings   bool
+	BoolStrings      bool
+	StableOrder      bool
+	OutputFormat     string
+	Color            string
+	NoColor          bool
+	MaxValueLength   int
+	Quiet            bool
+	ExitCode         bool
+	GroupBy          string
+	MaskPaths        []string
+	MaskSecrets      bool
+	MaskMode         string
+	Sort             string
+	FilterTypes      []string
+	TemplateFile     string
+	MaxShown         int
+	AnnotationLevels []string
+	ValueStyle       string
+	SeverityRules    []report.SeverityRule
+
+	// Changed reports whether the flag named was given on the command line,
+	// so that ApplyConfigDefaults leaves its value alone. If nil, options
+	// with their zero value, or "report" for OutputFormat, are taken to be
+	// unset.
+	Changed func(flag string) bool `json:"-"`
 }
 
 // ToLibraryOptions converts CLI options to configdiff library options
 func (c *CLIOptions) ToLibraryOptions() (configdiff.Options, error) {
-	// Parse array keys from "path=key" format
-	arraySetKeys := make(map[string]string)
-	for _, keySpec := range c.ArrayKeys {
-		parts := strings.SplitN(keySpec, "=", 2)
-		if len(parts) != 2 {
-			return configdiff.Options{}, fmt.Errorf("invalid array-key format %q, expected path=key", keySpec)
-		}
-		path := parts[0]
-		key := parts[1]
+	var opts []configdiff.Option
 
-		// Ensure path starts with /
-		if !strings.HasPrefix(path, "/") {
-			path = "/" + path
+	// The preset's paths and keys come first, see Preset
+	if c.Preset != "" {
+		preset, err := LookupPreset(c.Preset)
+		if err != nil {
+			return configdiff.Options{}, err
 		}
-
-		arraySetKeys[path] = key
+		keys := make(map[string]string, len(preset.ArrayKeys))
+		for _, keySpec := range preset.ArrayKeys {
+			path, key, err := parseArrayKey(keySpec)
+			if err != nil {
+				return configdiff.Options{}, err
+			}
+			keys[path] = key
+		}
+		opts = append(opts, configdiff.WithPreset(configdiff.Preset{IgnorePaths: preset.IgnorePaths, ArraySetKeys: keys}))
 	}
 
-	return configdiff.Options{
-		IgnorePaths:  c.IgnorePaths,
-		ArraySetKeys: arraySetKeys,
-		Coercions: configdiff.Coercions{
+	opts = append(opts, configdiff.WithIgnorePaths(c.IgnorePaths...))
+	// A later key for the same path replaces an earlier one
+	for _, keySpec := range c.ArrayKeys {
+		path, key, err := parseArrayKey(keySpec)
+		if err != nil {
+			return configdiff.Options{}, err
+		}
+		opts = append(opts, configdiff.WithArrayKey(path, key))
+	}
+	opts = append(opts,
+		configdiff.WithCoercions(configdiff.Coercions{
 			NumericStrings: c.NumericStrings,
 			BoolStrings:    c.BoolStrings,
-		},
-		StableOrder: c.StableOrder,
-	}, nil
+		}),
+		configdiff.WithStableOrder(c.StableOrder),
+		// Every output format renders its own report from the changes
+		configdiff.WithReport(false),
+	)
+	return configdiff.NewOptions(opts...)
+}
+
+// parseArrayKey parses an array key in "path=key" format, as for --array-key.
+func parseArrayKey(keySpec string) (path, key string, err error) {
+	path, key, ok := strings.Cut(keySpec, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid array-key format %q, expected path=key", keySpec)
+	}
+	return path, key, nil
 }
 
 // GetOldFormat returns the format for the old file
@@ -74,96 +128,256 @@ func (c *CLIOptions) GetNewFormat() string {
 	return c.Format
 }
 
-// ApplyConfigDefaults applies configuration file defaults to unset CLI options.
+// Normalizes reports whether the preset has a Normalize, so that
+// NormalizeTree rewrites documents rather than returning them as they are.
+func (c *CLIOptions) Normalizes() bool {
+	if c.Preset == "" {
+		return false
+	}
+	preset, err := LookupPreset(c.Preset)
+	return err == nil && preset.Normalize != nil
+}
+
+// NormalizeTree returns a document rewritten by the preset's Normalize, if
+// it has one, or the document itself.
+func (c *CLIOptions) NormalizeTree(n *tree.Node) *tree.Node {
+	if c.Preset == "" || n == nil {
+		return n
+	}
+	preset, err := LookupPreset(c.Preset)
+	if err != nil || preset.Normalize == nil {
+		return n
+	}
+	return preset.Normalize(n)
+}
+
+// ColorMode returns the effective color mode of --color and --no-color,
+// see ResolveColorMode.
+func (c *CLIOptions) ColorMode() ColorMode {
+	return ResolveColorMode(c.Color, c.NoColor)
+}
+
+// ApplyConfigDefaults applies configuration file defaults to unset CLI options,
+// with the settings of the config file's rules that match NewFile merged in.
 // CLI flags always take precedence over config file values.
+//
+// Lists are merged in a deterministic order, config file first: ignore paths
+// in the order the config file lists them, then those of the CLI in order;
+// array keys sorted by path, as the config file's are a map, then those of
+// the CLI in order. The later of two ignore paths or array keys takes
+// precedence, so the CLI's do.
 func (c *CLIOptions) ApplyConfigDefaults(cfg *config.Config) {
-	// Merge ignore paths (config file + CLI)
+	cfg = configFor(cfg, c.NewFile)
+
+	// Merge ignore paths (config file + CLI). Order matters: a later
+	// "!pattern" re-includes paths an earlier pattern ignores, so the CLI
+	// paths come last and take precedence, and duplicates keep their last
+	// position
 	if len(cfg.IgnorePaths) > 0 {
-		// Create a map to deduplicate
-		pathMap := make(map[string]bool)
-		for _, p := range cfg.IgnorePaths {
-			pathMap[p] = true
-		}
-		for _, p := range c.IgnorePaths {
-			pathMap[p] = true
+		all := append(append([]string(nil), cfg.IgnorePaths...), c.IgnorePaths...)
+		last := make(map[string]int, len(all))
+		for i, p := range all {
+			last[p] = i
 		}
-
-		// Convert back to slice
-		merged := make([]string, 0, len(pathMap))
-		for p := range pathMap {
-			merged = append(merged, p)
+		merged := make([]string, 0, len(last))
+		for i, p := range all {
+			if last[p] == i {
+				merged = append(merged, p)
+			}
 		}
 		c.IgnorePaths = merged
 	}
 
-	// Merge array keys (config file + CLI)
+	// Merge array keys (config file + CLI). A later key for the same path
+	// replaces an earlier one, so the CLI keys come last
 	if len(cfg.ArrayKeys) > 0 {
-		// Convert config map to CLI format (path=key)
-		for path, key := range cfg.ArrayKeys {
-			keySpec := fmt.Sprintf("%s=%s", path, key)
-			c.ArrayKeys = append(c.ArrayKeys, keySpec)
+		// A new slice: the old one may be shared with options built concurrently
+		keys := make([]string, 0, len(cfg.ArrayKeys)+len(c.ArrayKeys))
+		for _, path := range slices.Sorted(maps.Keys(cfg.ArrayKeys)) {
+			keys = append(keys, fmt.Sprintf("%s=%s", path, cfg.ArrayKeys[path]))
+		}
+		c.ArrayKeys = append(keys, c.ArrayKeys...)
+	}
+
+	// Merge mask paths (config file + CLI)
+	if len(cfg.MaskPaths) > 0 {
+		c.MaskPaths = slices.Concat(cfg.MaskPaths, c.MaskPaths)
+	}
+
+	// Severity rules come before any set directly, so those win. Invalid
+	// severities are kept as they are for Validate to report
+	if len(cfg.SeverityRules) > 0 {
+		rules := make([]report.SeverityRule, 0, len(cfg.SeverityRules)+len(c.SeverityRules))
+		for _, rule := range cfg.SeverityRules {
+			severity, err := report.ParseSeverity(rule.Severity)
+			if err != nil {
+				severity = report.Severity(rule.Severity)
+			}
+			rules = append(rules, report.SeverityRule{Match: rule.Match, Severity: severity})
 		}
+		c.SeverityRules = append(rules, c.SeverityRules...)
 	}
 
-	// Apply config defaults only if CLI flag wasn't set
-	// For bool flags, we need to check if they were explicitly set
-	// For now, we'll apply config if the CLI value is false (default)
-	if !c.NumericStrings && cfg.NumericStrings {
+	// Apply config defaults only if the CLI flag wasn't set. A setting the
+	// config sets to false still replaces a default of true
+	if !c.given("numeric-strings", c.NumericStrings) && (cfg.NumericStrings || cfg.IsSet("numeric_strings")) {
 		c.NumericStrings = cfg.NumericStrings
 	}
-	if !c.BoolStrings && cfg.BoolStrings {
+	if !c.given("bool-strings", c.BoolStrings) && (cfg.BoolStrings || cfg.IsSet("bool_strings")) {
 		c.BoolStrings = cfg.BoolStrings
 	}
-	if !c.StableOrder && cfg.StableOrder {
+	if !c.given("stable-order", c.StableOrder) && (cfg.StableOrder || cfg.IsSet("stable_order")) {
 		c.StableOrder = cfg.StableOrder
 	}
-	if !c.NoColor && cfg.NoColor {
+	if !c.given("no-color", c.NoColor) && (cfg.NoColor || cfg.IsSet("no_color")) {
 		c.NoColor = cfg.NoColor
 	}
 
 	// Apply string defaults if not set
-	if (c.OutputFormat == "" || c.OutputFormat == "report") && cfg.OutputFormat != "" {
+	if !c.given("output", c.OutputFormat != "" && c.OutputFormat != "report") && cfg.OutputFormat != "" {
 		c.OutputFormat = cfg.OutputFormat
 	}
 
-	// Apply numeric defaults if not set
-	if c.MaxValueLength == 0 && cfg.MaxValueLength > 0 {
+	if !c.given("preset", c.Preset != "") && cfg.Preset != "" {
+		c.Preset = cfg.Preset
+	}
+
+	if !c.given("template-file", c.TemplateFile != "") && cfg.TemplateFile != "" {
+		c.TemplateFile = cfg.TemplateFile
+	}
+
+	if !c.given("mask-mode", c.MaskMode != "" && c.MaskMode != report.MaskModeRedact) && cfg.MaskMode != "" {
+		c.MaskMode = cfg.MaskMode
+	}
+
+	// Apply numeric defaults if not set; 0 is no limit
+	if !c.given("max-value-length", c.MaxValueLength != 0) && (cfg.MaxValueLength > 0 || cfg.IsSet("max_value_length")) {
 		c.MaxValueLength = cfg.MaxValueLength
 	}
 }
 
+// given reports whether the flag named was given on the command line, as
+// reported by Changed, or without it whether the option is set, as set
+// reports.
+func (c *CLIOptions) given(flag string, set bool) bool {
+	if c.Changed == nil {
+		return set
+	}
+	return c.Changed(flag)
+}
+
+// configFor returns cfg with the settings of its rules that match file
+// merged over its own, in order, so that later rules win. Rule globs are
+// matched against file's path relative to the directory of the config file,
+// or the current directory if it has none. cfg is not modified.
+func configFor(cfg *config.Config, file string) *config.Config {
+	if len(cfg.Rules) == 0 || file == "" {
+		return cfg
+	}
+	dir := "."
+	if cfg.Path != "" {
+		dir = filepath.Dir(cfg.Path)
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	rel := relativePath(dir, file)
+
+	merged := *cfg
+	for _, rule := range cfg.Rules {
+		if !MatchExclude(rel, []string{rule.Match}) {
+			continue
+		}
+		merged.IgnorePaths = slices.Concat(merged.IgnorePaths, rule.IgnorePaths)
+		if len(rule.ArrayKeys) > 0 {
+			arrayKeys := maps.Clone(merged.ArrayKeys)
+			if arrayKeys == nil {
+				arrayKeys = make(map[string]string, len(rule.ArrayKeys))
+			}
+			maps.Copy(arrayKeys, rule.ArrayKeys)
+			merged.ArrayKeys = arrayKeys
+		}
+		if rule.Preset != "" {
+			merged.Preset = rule.Preset
+		}
+		if rule.NumericStrings != nil {
+			merged.NumericStrings = *rule.NumericStrings
+		}
+		if rule.BoolStrings != nil {
+			merged.BoolStrings = *rule.BoolStrings
+		}
+	}
+	return &merged
+}
+
 // Validate validates the CLI options
 func (c *CLIOptions) Validate() error {
 	// Validate output format
-	validFormats := map[string]bool{
-		"report":       true,
-		"compact":      true,
-		"json":         true,
-		"patch":        true,
-		"stat":         true,
-		"side-by-side": true,
-		"git-diff":     true,
+	if !slices.Contains(OutputFormats, c.OutputFormat) {
+		return fmt.Errorf("invalid output format %q, must be one of: %s", c.OutputFormat, strings.Join(OutputFormats, ", "))
 	}
-	if !validFormats[c.OutputFormat] {
-		return fmt.Errorf("invalid output format %q, must be one of: report, compact, json, patch, stat, side-by-side, git-diff", c.OutputFormat)
+	if c.OutputFormat == "template" && c.TemplateFile == "" {
+		return fmt.Errorf("output format %q requires --template-file", c.OutputFormat)
+	}
+
+	if _, err := ParseColorMode(c.Color); err != nil {
+		return err
+	}
+	if c.Preset != "" {
+		if _, err := LookupPreset(c.Preset); err != nil {
+			return err
+		}
 	}
 
 	// Validate input format
-	validInputFormats := map[string]bool{
-		"auto": true,
-		"yaml": true,
-		"json": true,
-		"hcl":  true,
-		"toml": true,
+	if !slices.Contains(InputFormats, c.Format) {
+		return fmt.Errorf("invalid format %q, must be one of: %s", c.Format, strings.Join(InputFormats, ", "))
+	}
+	if c.OldFormat != "" && !slices.Contains(InputFormats, c.OldFormat) {
+		return fmt.Errorf("invalid old-format %q, must be one of: %s", c.OldFormat, strings.Join(InputFormats, ", "))
 	}
-	if !validInputFormats[c.Format] {
-		return fmt.Errorf("invalid format %q, must be one of: auto, yaml, json, hcl, toml", c.Format)
+	if c.NewFormat != "" && !slices.Contains(InputFormats, c.NewFormat) {
+		return fmt.Errorf("invalid new-format %q, must be one of: %s", c.NewFormat, strings.Join(InputFormats, ", "))
+	}
+
+	// Validate grouping mode
+	if _, err := report.ParseGroupBy(c.GroupBy); err != nil {
+		return err
+	}
+
+	// Validate annotation level overrides
+	if _, err := report.ParseAnnotationLevels(c.AnnotationLevels); err != nil {
+		return err
+	}
+
+	// Validate sorting and filtering of rendered changes
+	if err := report.ValidateSort(c.Sort); err != nil {
+		return err
 	}
-	if c.OldFormat != "" && !validInputFormats[c.OldFormat] {
-		return fmt.Errorf("invalid old-format %q, must be one of: auto, yaml, json, hcl, toml", c.OldFormat)
+	if _, err := report.ParseChangeTypes(c.FilterTypes); err != nil {
+		return err
 	}
-	if c.NewFormat != "" && !validInputFormats[c.NewFormat] {
-		return fmt.Errorf("invalid new-format %q, must be one of: auto, yaml, json, hcl, toml", c.NewFormat)
+
+	if c.MaxShown < 0 {
+		return fmt.Errorf("invalid max-shown %d, must be 0 (unlimited) or greater", c.MaxShown)
+	}
+
+	// Validate masking mode
+	if err := report.ValidateMaskMode(c.MaskMode); err != nil {
+		return err
+	}
+	for _, pattern := range c.MaskPaths {
+		if err := diff.ValidatePathPattern(pattern); err != nil {
+			return fmt.Errorf("invalid mask path: %w", err)
+		}
+	}
+	if err := report.ValidateSeverityRules(c.SeverityRules); err != nil {
+		return err
+	}
+
+	// Validate value rendering
+	if err := report.ValidateValueStyle(c.ValueStyle); err != nil {
+		return err
 	}
 
 	return nil
@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
 
 	"github.com/pfrederiksen/configdiff/internal/config"
@@ -127,6 +130,95 @@ func TestCLIOptions_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "markdown output format",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "markdown",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid group-by",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "report",
+				GroupBy:      "everything",
+			},
+			wantErr: true,
+		},
+		{
+			name: "template output without template file",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "template",
+			},
+			wantErr: true,
+		},
+		{
+			name: "template output with template file",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "template",
+				TemplateFile: "report.tmpl",
+			},
+			wantErr: false,
+		},
+		{
+			name: "annotation level override",
+			opts: CLIOptions{
+				Format:           "auto",
+				OutputFormat:     "gh-annotations",
+				AnnotationLevels: []string{"add=warning"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid annotation level",
+			opts: CLIOptions{
+				Format:           "auto",
+				OutputFormat:     "gh-annotations",
+				AnnotationLevels: []string{"add=fatal"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max-shown",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "report",
+				MaxShown:     -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid sort order",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "report",
+				Sort:         "random",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid filter type",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "report",
+				FilterTypes:  []string{"add", "delete"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid mask mode",
+			opts: CLIOptions{
+				Format:       "auto",
+				OutputFormat: "report",
+				MaskSecrets:  true,
+				MaskMode:     "scramble",
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid output format",
 			opts: CLIOptions{
@@ -226,7 +318,7 @@ func TestCLIOptions_ApplyConfigDefaults(t *testing.T) {
 				MaxValueLength: 50,
 			},
 			want: CLIOptions{
-				IgnorePaths:    []string{"/metadata", "/status"}, // Merged
+				IgnorePaths:    []string{"/status", "/metadata"}, // Merged, config first
 				NumericStrings: true,                             // CLI wins (already set)
 				OutputFormat:   "json",                           // CLI wins
 				MaxValueLength: 100,                              // CLI wins
@@ -241,7 +333,7 @@ func TestCLIOptions_ApplyConfigDefaults(t *testing.T) {
 				IgnorePaths: []string{"/status", "/timestamp"},
 			},
 			want: CLIOptions{
-				IgnorePaths: []string{"/metadata", "/status", "/timestamp"},
+				IgnorePaths: []string{"/timestamp", "/metadata", "/status"},
 			},
 		},
 		{
@@ -256,7 +348,19 @@ func TestCLIOptions_ApplyConfigDefaults(t *testing.T) {
 				},
 			},
 			want: CLIOptions{
-				ArrayKeys: []string{"/containers=name", "/volumes=name", "/ports=port"},
+				ArrayKeys: []string{"/ports=port", "/volumes=name", "/containers=name"},
+			},
+		},
+		{
+			name: "CLI array keys take precedence",
+			opts: CLIOptions{
+				ArrayKeys: []string{"/volumes=id"},
+			},
+			config: &config.Config{
+				ArrayKeys: map[string]string{"/volumes": "name"},
+			},
+			want: CLIOptions{
+				ArrayKeys: []string{"/volumes=name", "/volumes=id"},
 			},
 		},
 		{
@@ -311,14 +415,12 @@ func TestCLIOptions_ApplyConfigDefaults(t *testing.T) {
 			opts := tt.opts
 			opts.ApplyConfigDefaults(tt.config)
 
-			// Check arrays with element comparison (order-independent)
-			if !containsAll(opts.IgnorePaths, tt.want.IgnorePaths) {
-				t.Errorf("IgnorePaths = %v, want to contain all of %v", opts.IgnorePaths, tt.want.IgnorePaths)
+			// Check lists, in order
+			if !slices.Equal(opts.IgnorePaths, tt.want.IgnorePaths) {
+				t.Errorf("IgnorePaths = %v, want %v", opts.IgnorePaths, tt.want.IgnorePaths)
 			}
-
-			// Check array keys
-			if len(opts.ArrayKeys) != len(tt.want.ArrayKeys) {
-				t.Errorf("ArrayKeys length = %d, want %d", len(opts.ArrayKeys), len(tt.want.ArrayKeys))
+			if !slices.Equal(opts.ArrayKeys, tt.want.ArrayKeys) {
+				t.Errorf("ArrayKeys = %v, want %v", opts.ArrayKeys, tt.want.ArrayKeys)
 			}
 
 			// Check boolean flags
@@ -348,19 +450,204 @@ func TestCLIOptions_ApplyConfigDefaults(t *testing.T) {
 	}
 }
 
-// containsAll checks if actual contains all elements from expected
-func containsAll(actual, expected []string) bool {
-	if len(actual) < len(expected) {
-		return false
+func TestCLIOptions_ApplyConfigDefaultsChanged(t *testing.T) {
+	// The flag defaults, as cliOptions builds them without any flags given
+	defaults := CLIOptions{StableOrder: true, OutputFormat: "report", MaxValueLength: 80}
+	fileCfg := &config.Config{
+		NumericStrings: true,
+		BoolStrings:    true,
+		StableOrder:    true,
+		NoColor:        true,
+		OutputFormat:   "compact",
+		MaxValueLength: 50,
+		Sources: map[string]string{
+			"numeric_strings":  ".configdiffrc:1",
+			"bool_strings":     ".configdiffrc:2",
+			"stable_order":     ".configdiffrc:3",
+			"no_color":         ".configdiffrc:4",
+			"output_format":    ".configdiffrc:5",
+			"max_value_length": ".configdiffrc:6",
+		},
 	}
-	expectedMap := make(map[string]bool)
-	for _, e := range expected {
-		expectedMap[e] = true
+
+	tests := []struct {
+		name    string
+		opts    CLIOptions
+		changed []string
+		config  *config.Config
+		check   func(CLIOptions) bool
+	}{
+		{"--numeric-strings=false over true", defaults, []string{"numeric-strings"}, fileCfg,
+			func(o CLIOptions) bool { return !o.NumericStrings && o.BoolStrings }},
+		{"--bool-strings=false over true", defaults, []string{"bool-strings"}, fileCfg,
+			func(o CLIOptions) bool { return !o.BoolStrings && o.NumericStrings }},
+		{"--stable-order=false over true", CLIOptions{OutputFormat: "report"}, []string{"stable-order"}, fileCfg,
+			func(o CLIOptions) bool { return !o.StableOrder && o.NoColor }},
+		{"--no-color=false over true", defaults, []string{"no-color"}, fileCfg,
+			func(o CLIOptions) bool { return !o.NoColor && o.StableOrder }},
+		{"-o report over compact", defaults, []string{"output"}, fileCfg,
+			func(o CLIOptions) bool { return o.OutputFormat == "report" && o.MaxValueLength == 50 }},
+		{"--max-value-length 80 over 50", defaults, []string{"max-value-length"}, fileCfg,
+			func(o CLIOptions) bool { return o.MaxValueLength == 80 && o.OutputFormat == "compact" }},
+		{"stable_order: false over the default", defaults, nil,
+			&config.Config{Sources: map[string]string{"stable_order": ".configdiffrc:1"}},
+			func(o CLIOptions) bool { return !o.StableOrder }},
+		{"max_value_length: 0 over the default", defaults, nil,
+			&config.Config{Env: []string{"max_value_length"}},
+			func(o CLIOptions) bool { return o.MaxValueLength == 0 }},
+		{"unset settings leave the defaults", defaults, nil, &config.Config{},
+			func(o CLIOptions) bool { return o.StableOrder && o.OutputFormat == "report" && o.MaxValueLength == 80 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Changed = func(flag string) bool { return slices.Contains(tt.changed, flag) }
+			opts.ApplyConfigDefaults(tt.config)
+			if !tt.check(opts) {
+				t.Errorf("ApplyConfigDefaults() = %+v", opts)
+			}
+		})
+	}
+}
+
+func TestCLIOptions_ApplyConfigDefaultsDeterministic(t *testing.T) {
+	cfg := &config.Config{
+		IgnorePaths: []string{"/status", "/metadata/*", "!/metadata/name"},
+		ArrayKeys: map[string]string{
+			"/spec/containers": "name", "/spec/volumes": "name", "/spec/ports": "port",
+			"/items": "id", "/rules/*": "id", "/env": "key",
+		},
+		Rules: []config.Rule{
+			{Match: "*.yaml", ArrayKeys: map[string]string{"/spec/initContainers": "name", "/spec/volumes": "id"}},
+		},
 	}
-	for _, a := range actual {
-		if expectedMap[a] {
-			delete(expectedMap, a)
+	flags := CLIOptions{
+		NewFile:     "app.yaml",
+		IgnorePaths: []string{"/metadata/uid", "/status"},
+		ArrayKeys:   []string{"/items=name", "/extra=id"},
+	}
+
+	var first CLIOptions
+	for i := 0; i < 100; i++ {
+		opts := flags
+		opts.ApplyConfigDefaults(cfg)
+		if i == 0 {
+			first = opts
+			continue
 		}
+		if !reflect.DeepEqual(opts, first) {
+			t.Fatalf("run %d: ApplyConfigDefaults() = %+v, want %+v as in the first run", i, opts, first)
+		}
+	}
+
+	wantPaths := []string{"/metadata/*", "!/metadata/name", "/metadata/uid", "/status"}
+	if !slices.Equal(first.IgnorePaths, wantPaths) {
+		t.Errorf("IgnorePaths = %v, want %v", first.IgnorePaths, wantPaths)
+	}
+	wantKeys := []string{
+		"/env=key", "/items=id", "/rules/*=id", "/spec/containers=name", "/spec/initContainers=name",
+		"/spec/ports=port", "/spec/volumes=id", "/items=name", "/extra=id",
+	}
+	if !slices.Equal(first.ArrayKeys, wantKeys) {
+		t.Errorf("ArrayKeys = %v, want %v", first.ArrayKeys, wantKeys)
+	}
+}
+
+func TestCLIOptions_ApplyConfigRules(t *testing.T) {
+	dir := t.TempDir()
+	yes, no := true, false
+	cfg := &config.Config{
+		Path:        filepath.Join(dir, ".configdiffrc"),
+		IgnorePaths: []string{"/status"},
+		ArrayKeys:   map[string]string{"/items": "id"},
+		Rules: []config.Rule{
+			{Match: "*.tf", IgnorePaths: []string{"/provider/**"}},
+			{
+				Match:          "k8s/**/*.yaml",
+				Preset:         PresetKubernetes,
+				ArrayKeys:      map[string]string{"/spec/containers": "name"},
+				NumericStrings: &yes,
+			},
+			// Overlaps the rule above for production manifests
+			{
+				Match:          "k8s/prod/*.yaml",
+				IgnorePaths:    []string{"/metadata/annotations"},
+				ArrayKeys:      map[string]string{"/spec/containers": "image"},
+				NumericStrings: &no,
+				BoolStrings:    &yes,
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		file  string
+		flags CLIOptions
+		want  CLIOptions
+	}{
+		{
+			name: "no rule matches",
+			file: filepath.Join(dir, "app.yaml"),
+			want: CLIOptions{IgnorePaths: []string{"/status"}, ArrayKeys: []string{"/items=id"}},
+		},
+		{
+			name: "name glob at any depth",
+			file: filepath.Join(dir, "infra", "main.tf"),
+			want: CLIOptions{IgnorePaths: []string{"/status", "/provider/**"}, ArrayKeys: []string{"/items=id"}},
+		},
+		{
+			name: "one rule",
+			file: filepath.Join(dir, "k8s", "dev", "web.yaml"),
+			want: CLIOptions{
+				IgnorePaths:    []string{"/status"},
+				ArrayKeys:      []string{"/items=id", "/spec/containers=name"},
+				Preset:         PresetKubernetes,
+				NumericStrings: true,
+			},
+		},
+		{
+			name: "later rules win",
+			file: filepath.Join(dir, "k8s", "prod", "web.yaml"),
+			want: CLIOptions{
+				IgnorePaths: []string{"/status", "/metadata/annotations"},
+				ArrayKeys:   []string{"/items=id", "/spec/containers=image"},
+				Preset:      PresetKubernetes,
+				BoolStrings: true,
+			},
+		},
+		{
+			name:  "flags win",
+			file:  filepath.Join(dir, "k8s", "prod", "web.yaml"),
+			flags: CLIOptions{IgnorePaths: []string{"!/status"}, Preset: PresetCompose, NumericStrings: true},
+			want: CLIOptions{
+				IgnorePaths:    []string{"/status", "/metadata/annotations", "!/status"},
+				ArrayKeys:      []string{"/items=id", "/spec/containers=image"},
+				Preset:         PresetCompose,
+				NumericStrings: true,
+				BoolStrings:    true,
+			},
+		},
+		{
+			name: "outside the config file's directory",
+			file: filepath.Join(t.TempDir(), "k8s", "prod", "web.yaml"),
+			want: CLIOptions{IgnorePaths: []string{"/status"}, ArrayKeys: []string{"/items=id"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.flags
+			opts.NewFile = tt.file
+			opts.ApplyConfigDefaults(cfg)
+			opts.NewFile = ""
+			if !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("ApplyConfigDefaults() = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+
+	// The config is left as it was
+	if len(cfg.IgnorePaths) != 1 || len(cfg.ArrayKeys) != 1 || cfg.Preset != "" {
+		t.Errorf("ApplyConfigDefaults() modified the config: %+v", cfg)
 	}
-	return len(expectedMap) == 0
 }
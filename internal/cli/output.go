@@ -3,77 +3,378 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/pfrederiksen/configdiff"
+	"github.com/pfrederiksen/configdiff/diff"
 	"github.com/pfrederiksen/configdiff/report"
+	"github.com/pfrederiksen/configdiff/tree"
 )
 
 // OutputOptions controls how output is formatted
 type OutputOptions struct {
-	Format         string
-	NoColor        bool
-	MaxValueLength int
-	OldFile        string // For git-diff format
-	NewFile        string // For git-diff format
+	Format           string
+	NoColor          bool // Final decision, see ResolveColorMode and ColorDisabled
+	MaxValueLength   int
+	NoCollapse       bool                  // For markdown and github-comment formats, truncate long values instead of collapsing them
+	OldFile          string                // For report, compact, and git-diff formats
+	NewFile          string                // For report, compact, git-diff, github-comment, and sarif formats
+	GroupBy          string                // For report and compact formats
+	ContextLines     int                   // For unified format
+	ContextKeys      int                   // For report format, unchanged sibling keys around each change
+	Width            int                   // For side-by-side format, 0 = default
+	OldTree          *tree.Node            // For unified and report formats
+	NewTree          *tree.Node            // For unified and report formats
+	Sort             string                // Order of rendered changes, see report.Options.Sort
+	FilterTypes      []string              // Change types to render (add, remove, modify, move)
+	TemplateFile     string                // For template format
+	MaxChanges       int                   // For report, compact, markdown, and github-comment formats, 0 = all
+	LineNumbers      bool                  // For report and compact formats
+	AnnotationLevels []string              // For gh-annotations format, e.g. "add=warning"
+	ASCII            bool                  // For report, compact, side-by-side, tree, and git-diff formats
+	ExpandValues     bool                  // For report format, show added and removed containers as YAML
+	ExpandLimit      int                   // For report format, largest expanded container in nodes, 0 = default
+	MaxPathSegments  int                   // For report, compact, side-by-side, and tree formats, 0 = full paths
+	ShowLegend       bool                  // For report and compact formats
+	ZeroCounts       bool                  // For report, compact, side-by-side, and tree summaries
+	Severity         bool                  // Classify changes by severity, see report.Options.ClassifySeverity
+	SeverityRules    []report.SeverityRule // Override severities by path, see report.Options.SeverityRules
+	ValueStyle       string                // For human formats, see report.Options.ValueStyle
+	MaxSize          int                   // For github-comment format, in bytes, 0 = report.GitHubCommentLimit
 }
 
 // FormatOutput formats the diff result according to the specified options
 func FormatOutput(result *configdiff.Result, opts OutputOptions) (string, error) {
+	var b strings.Builder
+	if err := WriteOutput(&b, result, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// WriteOutput writes the diff result to w in the specified format. The
+// report and compact formats are streamed change by change; other formats
+// are rendered in full first
+func WriteOutput(w io.Writer, result *configdiff.Result, opts OutputOptions) error {
 	switch opts.Format {
-	case "report":
-		// Detailed report with values
-		return report.Generate(result.Changes, report.Options{
-			Compact:        false,
-			ShowValues:     true,
-			MaxValueLength: opts.MaxValueLength,
-			NoColor:        opts.NoColor,
-		}), nil
+	case "report", "compact":
+		filterTypes, err := report.ParseChangeTypes(opts.FilterTypes)
+		if err != nil {
+			return err
+		}
+		if err := report.WriteReportWithContext(w, result.Changes, opts.OldTree, opts.NewTree, reportOptions(opts, filterTypes)); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
 
-	case "compact":
+	output, err := formatOutput(result, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, output); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// BrowseItems returns the changes of result as the interactive browser
+// lists them, rendered as the report format renders them with opts
+func BrowseItems(result *configdiff.Result, opts OutputOptions) ([]report.BrowseItem, error) {
+	filterTypes, err := report.ParseChangeTypes(opts.FilterTypes)
+	if err != nil {
+		return nil, err
+	}
+	opts.Format = "report"
+	return report.BrowseItems(result.Changes, reportOptions(opts, filterTypes)), nil
+}
+
+// reportOptions returns the options for the report and compact formats
+func reportOptions(opts OutputOptions, filterTypes []diff.ChangeType) report.Options {
+	if opts.Format == "compact" {
 		// Compact report (paths only)
-		return report.Generate(result.Changes, report.Options{
-			Compact:    true,
-			ShowValues: false,
-			NoColor:    opts.NoColor,
-		}), nil
+		return report.Options{
+			Compact:           true,
+			ShowValues:        false,
+			NoColor:           opts.NoColor,
+			GroupBy:           opts.GroupBy,
+			Sort:              opts.Sort,
+			FilterTypes:       filterTypes,
+			MaxChanges:        opts.MaxChanges,
+			OldFile:           opts.OldFile,
+			NewFile:           opts.NewFile,
+			ShowLineNumbers:   opts.LineNumbers,
+			ASCIIOnly:         opts.ASCII,
+			MaxPathSegments:   opts.MaxPathSegments,
+			ShowLegend:        opts.ShowLegend,
+			IncludeZeroCounts: opts.ZeroCounts,
+			ClassifySeverity:  opts.Severity,
+			SeverityRules:     opts.SeverityRules,
+		}
+	}
 
-	case "json":
-		// JSON serialized changes
-		data, err := json.MarshalIndent(result.Changes, "", "  ")
+	// Detailed report with values
+	return report.Options{
+		Compact:           false,
+		ContextLines:      opts.ContextKeys,
+		ShowValues:        true,
+		MaxValueLength:    opts.MaxValueLength,
+		ValueStyle:        opts.ValueStyle,
+		NoColor:           opts.NoColor,
+		GroupBy:           opts.GroupBy,
+		InlineDiff:        true,
+		Sort:              opts.Sort,
+		FilterTypes:       filterTypes,
+		MaxChanges:        opts.MaxChanges,
+		OldFile:           opts.OldFile,
+		NewFile:           opts.NewFile,
+		ShowLineNumbers:   opts.LineNumbers,
+		ASCIIOnly:         opts.ASCII,
+		ExpandContainers:  opts.ExpandValues,
+		ExpandLimit:       opts.ExpandLimit,
+		MaxPathSegments:   opts.MaxPathSegments,
+		ShowLegend:        opts.ShowLegend,
+		IncludeZeroCounts: opts.ZeroCounts,
+		ClassifySeverity:  opts.Severity,
+		SeverityRules:     opts.SeverityRules,
+	}
+}
+
+// formatOutput renders the formats that are not streamed, building the
+// report options of each from opts and leaving the rendering to
+// configdiff.RenderReport
+func formatOutput(result *configdiff.Result, opts OutputOptions) (string, error) {
+	filterTypes, err := report.ParseChangeTypes(opts.FilterTypes)
+	if err != nil {
+		return "", err
+	}
+	selection := report.Options{Sort: opts.Sort, FilterTypes: filterTypes, ClassifySeverity: opts.Severity, SeverityRules: opts.SeverityRules}
+
+	var reportOpts report.Options
+	switch opts.Format {
+	case "json-legacy":
+		// Changes marshaled as-is; deprecated in favor of json
+		data, err := json.MarshalIndent(legacyChanges(report.SelectChanges(result.Changes, selection)), "", "  ")
 		if err != nil {
 			return "", fmt.Errorf("failed to marshal changes to JSON: %w", err)
 		}
 		return string(data), nil
 
-	case "patch":
-		// JSON Patch format
-		data, err := result.Patch.ToJSONIndent()
+	case "unified":
+		// Line diff of the canonicalized documents
+		if opts.OldTree == nil || opts.NewTree == nil {
+			return "", fmt.Errorf("unified output requires the parsed documents")
+		}
+		return report.GenerateUnified(opts.OldTree, opts.NewTree, opts.OldFile, opts.NewFile, report.Options{
+			ContextLines: opts.ContextLines,
+			NoColor:      opts.NoColor,
+		})
+
+	case "template":
+		// User-defined text/template
+		if opts.TemplateFile == "" {
+			return "", fmt.Errorf("template output requires --template-file")
+		}
+		text, err := os.ReadFile(opts.TemplateFile)
 		if err != nil {
-			return "", fmt.Errorf("failed to marshal patch to JSON: %w", err)
+			return "", fmt.Errorf("failed to read template: %w", err)
 		}
-		return string(data), nil
+		return report.GenerateTemplate(filepath.Base(opts.TemplateFile), string(text), result.Changes, opts.OldFile, opts.NewFile, report.Options{
+			MaxValueLength:   opts.MaxValueLength,
+			ValueStyle:       opts.ValueStyle,
+			NoColor:          opts.NoColor,
+			Sort:             opts.Sort,
+			ClassifySeverity: opts.Severity,
+			SeverityRules:    opts.SeverityRules,
+			FilterTypes:      filterTypes,
+		})
 
-	case "stat":
-		// Statistics summary
-		return report.GenerateStat(result.Changes), nil
+	case "github-comment":
+		// Markdown PR comment, capped at --max-size rather than GitHub's
+		// comment size limit
+		return report.GenerateGitHubComment(result.Changes, opts.NewFile, report.Options{
+			MaxValueLength:     opts.MaxValueLength,
+			ValueStyle:         opts.ValueStyle,
+			CollapseLongValues: !opts.NoCollapse,
+			Sort:               opts.Sort,
+			ClassifySeverity:   opts.Severity,
+			SeverityRules:      opts.SeverityRules,
+			FilterTypes:        filterTypes,
+			MaxChanges:         opts.MaxChanges,
+		}, opts.MaxSize), nil
+
+	case "json", "patch", "stat", "csv", "ndjson", "tap", "sarif":
+		// Machine formats and the stat summary only select changes
+		reportOpts = selection
 
 	case "side-by-side":
-		// Side-by-side comparison
-		return report.GenerateSideBySide(result.Changes, report.Options{
-			NoColor:        opts.NoColor,
-			MaxValueLength: opts.MaxValueLength,
-		}), nil
+		reportOpts = report.Options{
+			NoColor:           opts.NoColor,
+			MaxValueLength:    opts.MaxValueLength,
+			ValueStyle:        opts.ValueStyle,
+			Width:             opts.Width,
+			Sort:              opts.Sort,
+			ClassifySeverity:  opts.Severity,
+			SeverityRules:     opts.SeverityRules,
+			FilterTypes:       filterTypes,
+			ASCIIOnly:         opts.ASCII,
+			MaxPathSegments:   opts.MaxPathSegments,
+			IncludeZeroCounts: opts.ZeroCounts,
+		}
 
 	case "git-diff":
-		// Git diff format
-		return report.GenerateGitDiff(result.Changes, opts.OldFile, opts.NewFile), nil
+		reportOpts = report.Options{
+			NoColor:          opts.NoColor,
+			Sort:             opts.Sort,
+			ClassifySeverity: opts.Severity,
+			SeverityRules:    opts.SeverityRules,
+			FilterTypes:      filterTypes,
+			ASCIIOnly:        opts.ASCII,
+			ValueStyle:       opts.ValueStyle,
+		}
 
+	case "tree":
+		reportOpts = report.Options{
+			MaxValueLength:    opts.MaxValueLength,
+			ValueStyle:        opts.ValueStyle,
+			NoColor:           opts.NoColor,
+			Sort:              opts.Sort,
+			ClassifySeverity:  opts.Severity,
+			SeverityRules:     opts.SeverityRules,
+			FilterTypes:       filterTypes,
+			ASCIIOnly:         opts.ASCII,
+			MaxPathSegments:   opts.MaxPathSegments,
+			IncludeZeroCounts: opts.ZeroCounts,
+		}
+
+	case "markdown":
+		reportOpts = report.Options{
+			MaxValueLength:     opts.MaxValueLength,
+			ValueStyle:         opts.ValueStyle,
+			CollapseLongValues: !opts.NoCollapse,
+			Sort:               opts.Sort,
+			ClassifySeverity:   opts.Severity,
+			SeverityRules:      opts.SeverityRules,
+			FilterTypes:        filterTypes,
+			MaxChanges:         opts.MaxChanges,
+		}
+
+	case "gh-annotations":
+		levels, err := report.ParseAnnotationLevels(opts.AnnotationLevels)
+		if err != nil {
+			return "", err
+		}
+		reportOpts = report.Options{
+			MaxValueLength:   opts.MaxValueLength,
+			ValueStyle:       opts.ValueStyle,
+			Sort:             opts.Sort,
+			ClassifySeverity: opts.Severity,
+			SeverityRules:    opts.SeverityRules,
+			FilterTypes:      filterTypes,
+			AnnotationLevels: levels,
+		}
+	}
+
+	reportOpts.OldFile, reportOpts.NewFile = opts.OldFile, opts.NewFile
+	return configdiff.RenderReport(result, opts.Format, reportOpts)
+}
+
+// IsRecordFormat reports whether format exports one flat record per change,
+// so directory comparisons emit a single combined stream
+func IsRecordFormat(format string) bool {
+	return format == "csv" || format == "ndjson"
+}
+
+// IsPagedFormat reports whether format is meant to be read on a terminal,
+// so output in it is shown through a pager. Machine-readable formats never
+// are
+func IsPagedFormat(format string) bool {
+	switch format {
+	case "report", "compact", "stat", "side-by-side", "git-diff", "tree", "unified":
+		return true
+	}
+	return false
+}
+
+// IsMachineFormat reports whether format is meant to be read by programs,
+// so that nothing but the output in it may be written to stdout: headers,
+// summaries, and messages go to stderr instead
+func IsMachineFormat(format string) bool {
+	switch format {
+	case "json", "json-legacy", "patch", "csv", "ndjson", "sarif", "tap", "gh-annotations":
+		return true
+	}
+	return false
+}
+
+// AggregatesDirectory reports whether format renders a directory comparison
+// as a single aggregate output, see FormatDirectory. Other formats render
+// one output per file
+func AggregatesDirectory(format string) bool {
+	switch format {
+	case "report", "compact", "json", "markdown", "stat", "tap":
+		return true
+	}
+	return IsRecordFormat(format)
+}
+
+// FormatDirectory renders a directory comparison as one output: a report
+// with a section per file and a global summary, a single JSON document with
+// a files array, Markdown with a collapsible section per file, a TAP test
+// point per file, csv or ndjson records, or a per-file stat rollup
+func FormatDirectory(dir report.DirResult, opts OutputOptions) (string, error) {
+	filterTypes, err := report.ParseChangeTypes(opts.FilterTypes)
+	if err != nil {
+		return "", err
+	}
+
+	switch opts.Format {
+	case "report", "compact":
+		return report.GenerateDirReport(dir, reportOptions(opts, filterTypes)), nil
+	case "json":
+		return report.GenerateDirJSON(dir, report.Options{Sort: opts.Sort, FilterTypes: filterTypes, ClassifySeverity: opts.Severity, SeverityRules: opts.SeverityRules})
+	case "markdown":
+		return report.GenerateDirMarkdown(dir, report.Options{
+			MaxValueLength:     opts.MaxValueLength,
+			ValueStyle:         opts.ValueStyle,
+			CollapseLongValues: !opts.NoCollapse,
+			Sort:               opts.Sort,
+			ClassifySeverity:   opts.Severity,
+			SeverityRules:      opts.SeverityRules,
+			FilterTypes:        filterTypes,
+			MaxChanges:         opts.MaxChanges,
+		}), nil
+	case "tap":
+		return report.GenerateDirTAP(dir, report.Options{Sort: opts.Sort, FilterTypes: filterTypes, ClassifySeverity: opts.Severity, SeverityRules: opts.SeverityRules})
 	default:
-		return "", fmt.Errorf("unsupported output format: %s", opts.Format)
+		return FormatFiles(dir.FileChanges(), opts)
 	}
 }
 
-// HasChanges returns true if there are any changes in the result
-func HasChanges(result *configdiff.Result) bool {
-	return len(result.Changes) > 0
+// FormatFiles renders the changes of several files as one output: csv or
+// ndjson records, or a per-file stat rollup
+func FormatFiles(files []report.FileChanges, opts OutputOptions) (string, error) {
+	filterTypes, err := report.ParseChangeTypes(opts.FilterTypes)
+	if err != nil {
+		return "", err
+	}
+	reportOpts := report.Options{Sort: opts.Sort, FilterTypes: filterTypes, ClassifySeverity: opts.Severity, SeverityRules: opts.SeverityRules}
+
+	switch opts.Format {
+	case "csv":
+		return report.GenerateCSV(files, reportOpts)
+	case "ndjson":
+		return report.GenerateNDJSON(files, reportOpts)
+	case "stat":
+		summaries := make(map[string]report.Summary, len(files))
+		for _, f := range files {
+			summaries[f.File] = report.Summarize(report.SelectChanges(f.Changes, reportOpts))
+		}
+		return report.GenerateDirStat(summaries, opts.Width), nil
+	default:
+		return "", fmt.Errorf("unsupported multi-file format: %s", opts.Format)
+	}
 }
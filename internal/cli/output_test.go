@@ -7,6 +7,7 @@ import (
 	"github.com/pfrederiksen/configdiff"
 	"github.com/pfrederiksen/configdiff/diff"
 	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/pfrederiksen/configdiff/report"
 	"github.com/pfrederiksen/configdiff/tree"
 )
 
@@ -66,7 +67,17 @@ func TestFormatOutput(t *testing.T) {
 			},
 			wantErr: false,
 			check: func(s string) bool {
-				return strings.Contains(s, "\"Type\"") || strings.Contains(s, "\"type\"")
+				return strings.Contains(s, `"schemaVersion": "1"`) && strings.Contains(s, `"type": "modify"`)
+			},
+		},
+		{
+			name: "json-legacy format",
+			opts: OutputOptions{
+				Format: "json-legacy",
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return strings.Contains(s, "\"Type\"") && !strings.Contains(s, "schemaVersion")
 			},
 		},
 		{
@@ -79,6 +90,96 @@ func TestFormatOutput(t *testing.T) {
 				return strings.Contains(s, "operations")
 			},
 		},
+		{
+			name: "markdown format with long values",
+			opts: OutputOptions{
+				Format:         "markdown",
+				MaxValueLength: 4,
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return strings.Contains(s, "<details><summary>") && strings.Contains(s, "<code>&#34;new&#34;</code></details>")
+			},
+		},
+		{
+			name: "markdown format with NoCollapse",
+			opts: OutputOptions{
+				Format:         "markdown",
+				MaxValueLength: 4,
+				NoCollapse:     true,
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return strings.Contains(s, "| `/test` | modified |") && !strings.Contains(s, "<details>")
+			},
+		},
+		{
+			name: "markdown format",
+			opts: OutputOptions{
+				Format: "markdown",
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return strings.Contains(s, "| `/test` | modified |")
+			},
+		},
+		{
+			name: "github-comment format",
+			opts: OutputOptions{
+				Format:  "github-comment",
+				NewFile: "new.yaml",
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return strings.Contains(s, "#### new.yaml") && strings.Contains(s, "<details>")
+			},
+		},
+		{
+			name: "template format",
+			opts: OutputOptions{
+				Format:       "template",
+				NoColor:      true,
+				OldFile:      "old.yaml",
+				NewFile:      "new.yaml",
+				TemplateFile: "../../testdata/templates/changelog.tmpl",
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return strings.Contains(s, "Changes in new.yaml (from old.yaml)") &&
+					strings.Contains(s, `~ /test: "old" -> "new"`)
+			},
+		},
+		{
+			name: "template format with missing file",
+			opts: OutputOptions{
+				Format:       "template",
+				TemplateFile: "does-not-exist.tmpl",
+			},
+			wantErr: true,
+		},
+		{
+			name: "csv format",
+			opts: OutputOptions{
+				Format:  "csv",
+				NewFile: "new.yaml",
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return strings.HasPrefix(s, "file,type,path,old,new,severity\n") &&
+					strings.Contains(s, "new.yaml,modify,/test,old,new,warning")
+			},
+		},
+		{
+			name: "ndjson format",
+			opts: OutputOptions{
+				Format:  "ndjson",
+				NewFile: "new.yaml",
+			},
+			wantErr: false,
+			check: func(s string) bool {
+				return s == `{"file":"new.yaml","type":"modify","path":"/test","old":"old","new":"new","severity":"warning"}`+"\n"
+			},
+		},
 		{
 			name: "invalid format",
 			opts: OutputOptions{
@@ -104,43 +205,127 @@ func TestFormatOutput(t *testing.T) {
 	}
 }
 
-func TestHasChanges(t *testing.T) {
+func TestMaskResult(t *testing.T) {
+	oldTree := tree.NewObject(map[string]*tree.Node{
+		"db": tree.NewObject(map[string]*tree.Node{
+			"host":     tree.NewString("db1"),
+			"password": tree.NewString("hunter2"),
+		}),
+	})
+	newTree := tree.NewObject(map[string]*tree.Node{
+		"db": tree.NewObject(map[string]*tree.Node{
+			"host":     tree.NewString("db2"),
+			"password": tree.NewString("correct-horse"),
+		}),
+		"api": tree.NewObject(map[string]*tree.Node{
+			"apiKey": tree.NewString("sk-live-123"),
+		}),
+	})
+
+	result, err := configdiff.DiffTrees(oldTree, newTree, configdiff.Options{})
+	if err != nil {
+		t.Fatalf("DiffTrees() error = %v", err)
+	}
+
+	masked, err := MaskResult(result, (&CLIOptions{MaskSecrets: true}).MaskOptions())
+	if err != nil {
+		t.Fatalf("MaskResult() error = %v", err)
+	}
+	if len(masked.Changes) != len(result.Changes) {
+		t.Fatalf("MaskResult() changed the number of changes: %d != %d", len(masked.Changes), len(result.Changes))
+	}
+
+	secrets := []string{"hunter2", "correct-horse", "sk-live-123"}
+	for _, format := range []string{"report", "json", "patch", "side-by-side", "git-diff", "markdown", "github-comment", "tree"} {
+		t.Run(format, func(t *testing.T) {
+			out, err := FormatOutput(masked, OutputOptions{Format: format, NoColor: true})
+			if err != nil {
+				t.Fatalf("FormatOutput() error = %v", err)
+			}
+			for _, secret := range secrets {
+				if strings.Contains(out, secret) {
+					t.Errorf("%s output leaks %q:\n%s", format, secret, out)
+				}
+			}
+			if !strings.Contains(out, "db2") {
+				t.Errorf("%s output should keep unmasked values:\n%s", format, out)
+			}
+		})
+	}
+
+	if strings.Contains(masked.Report, "hunter2") {
+		t.Errorf("Report leaks secret:\n%s", masked.Report)
+	}
+}
+
+func TestFormatDirectory(t *testing.T) {
+	dir := report.DirResult{
+		OldDir: "old",
+		NewDir: "new",
+		Files: []report.FileResult{
+			{Path: "a.yaml", Status: report.FileModified, Changes: []diff.Change{
+				{Type: diff.ChangeTypeAdd, Path: "/key", NewValue: tree.NewString("value")},
+			}},
+			{Path: "b.yaml", Status: report.FileAdded},
+		},
+	}
+
 	tests := []struct {
-		name   string
-		result *configdiff.Result
-		want   bool
+		format string
+		want   []string
 	}{
-		{
-			name: "has changes",
-			result: &configdiff.Result{
-				Changes: []diff.Change{
-					{Type: diff.ChangeTypeAdd, Path: "/test"},
-				},
-			},
-			want: true,
-		},
-		{
-			name: "no changes",
-			result: &configdiff.Result{
-				Changes: []diff.Change{},
-			},
-			want: false,
-		},
-		{
-			name: "nil changes",
-			result: &configdiff.Result{
-				Changes: nil,
-			},
-			want: false,
-		},
+		{"report", []string{"=== a.yaml ===", "/key", "+++ b.yaml (added)", "1 file compared (1 changed), 1 added, 0 removed"}},
+		{"compact", []string{"=== a.yaml ===", "+ /key", "+++ b.yaml (added)"}},
+		{"json", []string{`"files": [`, `"path": "a.yaml"`, `"status": "added"`}},
+		{"markdown", []string{"<summary><code>a.yaml</code>", "- `b.yaml` added"}},
+		{"csv", []string{"a.yaml,add,/key", "b.yaml,add,/"}},
+		{"tap", []string{"1..2", "not ok 1 - a.yaml", "not ok 2 - b.yaml", "status: added"}},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := HasChanges(tt.result)
-			if got != tt.want {
-				t.Errorf("HasChanges() = %v, want %v", got, tt.want)
+		t.Run(tt.format, func(t *testing.T) {
+			if !AggregatesDirectory(tt.format) {
+				t.Errorf("AggregatesDirectory(%q) = false, want true", tt.format)
+			}
+			got, err := FormatDirectory(dir, OutputOptions{Format: tt.format, NoColor: true})
+			if err != nil {
+				t.Fatalf("FormatDirectory() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("FormatDirectory() missing %q, got:\n%s", want, got)
+				}
 			}
 		})
 	}
+
+	if AggregatesDirectory("patch") {
+		t.Error("AggregatesDirectory(patch) = true, want false")
+	}
+}
+
+func TestIsPagedFormat(t *testing.T) {
+	for _, format := range []string{"report", "stat", "tree", "unified"} {
+		if !IsPagedFormat(format) {
+			t.Errorf("IsPagedFormat(%q) = false, want true", format)
+		}
+	}
+	for _, format := range []string{"json", "patch", "csv"} {
+		if IsPagedFormat(format) {
+			t.Errorf("IsPagedFormat(%q) = true, want false", format)
+		}
+	}
+}
+
+func TestIsMachineFormat(t *testing.T) {
+	for _, format := range []string{"json", "patch", "csv", "ndjson", "sarif", "tap"} {
+		if !IsMachineFormat(format) {
+			t.Errorf("IsMachineFormat(%q) = false, want true", format)
+		}
+	}
+	for _, format := range []string{"report", "compact", "markdown", "unified"} {
+		if IsMachineFormat(format) {
+			t.Errorf("IsMachineFormat(%q) = true, want false", format)
+		}
+	}
 }
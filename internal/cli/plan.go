@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Plan is a list of comparisons for the batch command, read from a YAML
+// file by LoadPlan.
+type Plan struct {
+	Comparisons []PlanEntry `yaml:"comparisons"`
+}
+
+// PlanEntry is one comparison of a plan. Its options override those of
+// flags and the config file for this comparison only: Format and FailOn
+// replace them, and Ignore and ArrayKeys come after them.
+type PlanEntry struct {
+	Name      string   `yaml:"name"`
+	Old       string   `yaml:"old"`
+	New       string   `yaml:"new"`
+	Format    string   `yaml:"format"`
+	Ignore    []string `yaml:"ignore"`
+	ArrayKeys []string `yaml:"array_keys"`
+	Preset    string   `yaml:"preset"`
+	FailOn    []string `yaml:"fail_on"`
+}
+
+// Label returns the name an entry is reported under: its name, or else its
+// new file, or its old file if it has no new one.
+func (e PlanEntry) Label() string {
+	switch {
+	case e.Name != "":
+		return e.Name
+	case e.New != "":
+		return e.New
+	}
+	return e.Old
+}
+
+// LoadPlan reads and validates a plan file. Unknown keys are errors, so
+// that a misspelled option is not silently dropped. Relative paths in the
+// plan are relative to the directory of the plan file.
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan Plan
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&plan); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid plan %s: %s", path, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	if len(plan.Comparisons) == 0 {
+		return nil, fmt.Errorf("plan %s lists no comparisons", path)
+	}
+
+	labels := make(map[string]bool, len(plan.Comparisons))
+	for i := range plan.Comparisons {
+		e := &plan.Comparisons[i]
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("plan %s: comparison %d: %w", path, i+1, err)
+		}
+		e.Old = planPath(filepath.Dir(path), e.Old)
+		e.New = planPath(filepath.Dir(path), e.New)
+		label := e.Label()
+		if labels[label] {
+			return nil, fmt.Errorf("plan %s: comparison %d: %q is already the name of a comparison\nHint: Give one of them a different name", path, i+1, label)
+		}
+		labels[label] = true
+	}
+	return &plan, nil
+}
+
+// validate checks the options of a plan entry.
+func (e *PlanEntry) validate() error {
+	if e.Old == "" && e.New == "" {
+		return fmt.Errorf("old or new is required")
+	}
+	if e.Old == "-" || e.New == "-" {
+		return fmt.Errorf("stdin cannot be compared in a plan")
+	}
+	if e.Format != "" && !slices.Contains(InputFormats, e.Format) {
+		return fmt.Errorf("invalid format %q, must be one of: %s", e.Format, strings.Join(InputFormats, ", "))
+	}
+	if e.Preset != "" {
+		if _, err := LookupPreset(e.Preset); err != nil {
+			return err
+		}
+	}
+	if err := ValidateFailOn(e.FailOn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// planPath resolves a path in a plan against the plan's directory, keeping
+// the revision of a "path@{rev}" path. URLs and absolute paths are kept as
+// they are.
+func planPath(dir, path string) string {
+	if path == "" || IsURL(path) {
+		return path
+	}
+	file, rev, _ := SplitGitRevision(path)
+	if filepath.IsAbs(file) {
+		return path
+	}
+	return JoinGitRevision(filepath.Join(dir, file), rev)
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadPlan(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plan.yaml")
+	plan := `comparisons:
+  - name: deployment
+    old: old/deploy.yaml
+    new: new/deploy.yaml
+    preset: kubernetes
+    fail_on: [remove]
+  - old: app.yaml@{HEAD~1}
+    new: https://example.com/app.yaml
+    format: yaml
+    ignore: [/port]
+    array_keys: [/env=name]
+  - new: /etc/added.yaml
+`
+	if err := os.WriteFile(path, []byte(plan), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadPlan(path)
+	if err != nil {
+		t.Fatalf("LoadPlan() error = %v", err)
+	}
+	want := []PlanEntry{
+		{Name: "deployment", Old: filepath.Join(dir, "old/deploy.yaml"), New: filepath.Join(dir, "new/deploy.yaml"), Preset: PresetKubernetes, FailOn: []string{"remove"}},
+		{Old: filepath.Join(dir, "app.yaml") + "@{HEAD~1}", New: "https://example.com/app.yaml", Format: "yaml", Ignore: []string{"/port"}, ArrayKeys: []string{"/env=name"}},
+		{New: "/etc/added.yaml"},
+	}
+	if !reflect.DeepEqual(got.Comparisons, want) {
+		t.Errorf("LoadPlan() = %+v, want %+v", got.Comparisons, want)
+	}
+	for i, label := range []string{"deployment", "https://example.com/app.yaml", "/etc/added.yaml"} {
+		if got := got.Comparisons[i].Label(); got != label {
+			t.Errorf("Label() of comparison %d = %q, want %q", i+1, got, label)
+		}
+	}
+}
+
+func TestLoadPlanErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		plan    string
+		wantErr string
+	}{
+		{"empty", "", "lists no comparisons"},
+		{"unknown key", "comparisons:\n  - old: a.yaml\n    nwe: b.yaml\n", "field nwe not found"},
+		{"no files", "comparisons:\n  - name: nothing\n", "comparison 1: old or new is required"},
+		{"stdin", "comparisons:\n  - old: '-'\n    new: b.yaml\n", "stdin"},
+		{"bad format", "comparisons:\n  - old: a\n    new: b\n    format: xml\n", `invalid format "xml"`},
+		{"bad preset", "comparisons:\n  - old: a\n    new: b\n    preset: k8\n", `unknown preset "k8"`},
+		{"bad fail_on", "comparisons:\n  - old: a\n    new: b\n    fail_on: [delete]\n", `invalid --fail-on type "delete"`},
+		{"duplicate", "comparisons:\n  - old: a\n    new: b\n  - old: c\n    new: b\n", "comparison 2: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.yaml")
+			if err := os.WriteFile(path, []byte(tt.plan), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadPlan(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadPlan() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// Names of the presets for --preset
+const (
+	// PresetKubernetes is the preset for Kubernetes manifests, see
+	// KubePreset.
+	PresetKubernetes = "kubernetes"
+
+	// PresetCompose is the preset for Docker Compose files, see
+	// NormalizeCompose.
+	PresetCompose = "compose"
+)
+
+// Presets lists the presets for --preset.
+var Presets = []string{PresetCompose, PresetKubernetes}
+
+// Preset is a set of options for comparing a kind of configuration file.
+// Its ignore paths and array keys come before those of flags and the config
+// file, so that these can re-include its paths and rekey its arrays.
+type Preset struct {
+	IgnorePaths []string
+	ArrayKeys   []string // "path=key", as for --array-key
+
+	// Normalize, if set, rewrites a document before it is diffed, so that
+	// equivalent ways of writing a setting compare equal. It must not
+	// modify the document it is given.
+	Normalize func(*tree.Node) *tree.Node
+}
+
+// LookupPreset returns the preset with a name from Presets.
+func LookupPreset(name string) (Preset, error) {
+	switch name {
+	case PresetKubernetes:
+		ignorePaths, arrayKeys := KubePreset()
+		return Preset{IgnorePaths: ignorePaths, ArrayKeys: arrayKeys}, nil
+	case PresetCompose:
+		return Preset{
+			// The top-level version is obsolete and ignored by Compose
+			IgnorePaths: []string{"/version"},
+			ArrayKeys:   []string{"/services/*/ports=published"},
+			Normalize:   NormalizeCompose,
+		}, nil
+	}
+	return Preset{}, fmt.Errorf("unknown preset %q (valid: %s)", name, strings.Join(Presets, ", "))
+}
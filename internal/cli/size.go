@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxFileSize is the default --max-file-size: files larger than this
+// are skipped in recursive comparisons.
+const DefaultMaxFileSize = "50MB"
+
+// DefaultMaxParseSize is the default --max-parse-size: documents larger
+// than this fail to parse, as parse.MaxSize does by default.
+const DefaultMaxParseSize = "64MB"
+
+// sizeUnits are the multipliers of the size suffixes ParseSize accepts,
+// longest first so that "MB" is not read as "B".
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// ParseSize parses a size in bytes such as "1048576", "512K", or "50MB".
+// Suffixes are case-insensitive powers of 1024: K, KB, and KiB are all
+// 1024 bytes.
+func ParseSize(s string) (int64, error) {
+	num, factor := strings.ToLower(strings.TrimSpace(s)), int64(1)
+	for _, unit := range sizeUnits {
+		if rest, ok := strings.CutSuffix(num, unit.suffix); ok {
+			num, factor = strings.TrimSpace(rest), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes with an optional K, M, or G suffix", s)
+	}
+	if n > (1<<63-1)/factor {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * factor, nil
+}
+
+// FormatSize formats a size in bytes with the largest whole unit, e.g. 50MB.
+func FormatSize(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= unit.factor && n%unit.factor == 0 {
+			return fmt.Sprintf("%d%s", n/unit.factor, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,41 @@
+package cli
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1048576", 1 << 20, false},
+		{"512K", 512 << 10, false},
+		{"50MB", 50 << 20, false},
+		{"50 mb", 50 << 20, false},
+		{"2GiB", 2 << 30, false},
+		{"10B", 10, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-1", 0, true},
+		{"1.5GB", 0, true},
+		{"99999999999G", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for n, want := range map[int64]string{50 << 20: "50MB", 1536: "1536B", 2 << 30: "2GB", 4096: "4KB"} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
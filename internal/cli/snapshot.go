@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// SnapshotVersion is the version of the snapshot format WriteSnapshot
+// writes. ReadSnapshot reads every version up to it.
+const SnapshotVersion = 1
+
+// Names of the entries in a snapshot archive
+const (
+	snapshotManifestName = "manifest.json"
+	snapshotTreeDir      = "trees/"
+)
+
+// Snapshot is the parsed configuration files of a directory, saved to be
+// compared with later.
+type Snapshot struct {
+	Manifest SnapshotManifest
+
+	// Trees are the parsed files by their path in Manifest.Files
+	Trees map[string]*tree.Node
+}
+
+// SnapshotManifest describes a snapshot and the files in it.
+type SnapshotManifest struct {
+	Version   int            `json:"version"`
+	Generator string         `json:"generator,omitempty"` // configdiff version that wrote it
+	Created   time.Time      `json:"created"`
+	Root      string         `json:"root"` // directory the snapshot was taken of
+	Files     []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is a file in a snapshot.
+type SnapshotFile struct {
+	Path   string `json:"path"`   // slash-separated, relative to the root
+	Format string `json:"format"` // format the file was parsed as
+	SHA256 string `json:"sha256"` // hash of the file's canonical JSON
+}
+
+// CanonicalJSON renders a parsed document as JSON with sorted keys, so that
+// equal documents render identically whatever their source format.
+func CanonicalJSON(n *tree.Node) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(n.ToInterface()); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// CanonicalHash returns the SHA-256 hash of a document's CanonicalJSON, in
+// hex.
+func CanonicalHash(n *tree.Node) (string, error) {
+	data, err := CanonicalJSON(n)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// WriteSnapshot writes s as a gzipped tar archive: the manifest, then the
+// canonical JSON of every file. Files are written sorted by path, and the
+// manifest's file list and hashes are filled in from s.Trees.
+func WriteSnapshot(w io.Writer, s *Snapshot) error {
+	paths := make([]string, 0, len(s.Trees))
+	for p := range s.Trees {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	formats := make(map[string]string, len(s.Manifest.Files))
+	for _, f := range s.Manifest.Files {
+		formats[f.Path] = f.Format
+	}
+	manifest := s.Manifest
+	manifest.Version = SnapshotVersion
+	manifest.Files = make([]SnapshotFile, 0, len(paths))
+	docs := make([][]byte, 0, len(paths))
+	for _, p := range paths {
+		data, err := CanonicalJSON(s.Trees[p])
+		if err != nil {
+			return fmt.Errorf("%s cannot be saved: %w", p, err)
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, SnapshotFile{Path: p, Format: formats[p], SHA256: hex.EncodeToString(sum[:])})
+		docs = append(docs, data)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	entry := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: manifest.Created, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := entry(snapshotManifestName, append(manifestData, '\n')); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	for i, p := range paths {
+		if err := entry(snapshotTreeDir+p+".json", docs[i]); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot, by this or an
+// earlier version of configdiff, and checks every file against its hash.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest *SnapshotManifest
+	docs := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, DefaultMaxEntrySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if len(data) > DefaultMaxEntrySize {
+			return nil, fmt.Errorf("snapshot entry %s is larger than %d bytes", hdr.Name, DefaultMaxEntrySize)
+		}
+		if hdr.Name == snapshotManifestName {
+			manifest = &SnapshotManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("invalid snapshot manifest: %w", err)
+			}
+			if manifest.Version < 1 || manifest.Version > SnapshotVersion {
+				return nil, fmt.Errorf("snapshot format version %d is not supported, this configdiff reads versions up to %d\nHint: Upgrade configdiff to compare with this snapshot", manifest.Version, SnapshotVersion)
+			}
+			continue
+		}
+		docs[hdr.Name] = data
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("not a snapshot: %s is missing", snapshotManifestName)
+	}
+
+	s := &Snapshot{Manifest: *manifest, Trees: make(map[string]*tree.Node, len(manifest.Files))}
+	for _, f := range manifest.Files {
+		if !fs.ValidPath(f.Path) || f.Path == "." {
+			return nil, fmt.Errorf("invalid snapshot: bad file path %q", f.Path)
+		}
+		data, ok := docs[snapshotTreeDir+f.Path+".json"]
+		if !ok {
+			return nil, fmt.Errorf("invalid snapshot: %s is missing", f.Path)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, fmt.Errorf("invalid snapshot: %s does not match its hash", f.Path)
+		}
+		node, err := parse.Parse(data, parse.FormatJSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %s: %w", f.Path, err)
+		}
+		s.Trees[f.Path] = node
+	}
+	return s, nil
+}
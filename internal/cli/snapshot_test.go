@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// snapshotArchive returns a gzipped tar archive of name and content pairs,
+// in order.
+func snapshotArchive(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	for i := 0; i+1 < len(entries); i += 2 {
+		name, content := entries[i], entries[i+1]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// canonical returns the canonical JSON of a tree, failing the test on error.
+func canonical(t *testing.T, n *tree.Node) string {
+	t.Helper()
+	data, err := CanonicalJSON(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	app, err := parse.Parse([]byte("name: app\nports: [80, 443]\nlimits: {cpu: 0.5, memory: 1Gi}\nhtml: <b>&</b>\n"), parse.FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := parse.Parse([]byte("[server]\nhost = \"example.com\"\n"), parse.FormatTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s := &Snapshot{
+		Manifest: SnapshotManifest{
+			Generator: "configdiff test",
+			Created:   created,
+			Root:      "config",
+			Files:     []SnapshotFile{{Path: "nested/server.toml", Format: "toml"}, {Path: "app.yaml", Format: "yaml"}},
+		},
+		Trees: map[string]*tree.Node{"app.yaml": app, "nested/server.toml": server},
+	}
+
+	var b bytes.Buffer
+	if err := WriteSnapshot(&b, s); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+	got, err := ReadSnapshot(&b)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+
+	m := got.Manifest
+	if m.Version != SnapshotVersion || m.Generator != "configdiff test" || !m.Created.Equal(created) || m.Root != "config" {
+		t.Errorf("manifest = %+v", m)
+	}
+	if len(m.Files) != 2 || m.Files[0].Path != "app.yaml" || m.Files[0].Format != "yaml" || m.Files[1].Format != "toml" {
+		t.Fatalf("manifest files = %+v, want sorted by path with formats", m.Files)
+	}
+	for path, want := range s.Trees {
+		if got := canonical(t, got.Trees[path]); got != canonical(t, want) {
+			t.Errorf("%s = %s, want %s", path, got, canonical(t, want))
+		}
+	}
+	if want, _ := CanonicalHash(app); m.Files[0].SHA256 != want {
+		t.Errorf("app.yaml hash = %s, want %s", m.Files[0].SHA256, want)
+	}
+}
+
+// TestReadSnapshotV1 reads a snapshot saved by an earlier configdiff, which
+// every later version must still read the same way.
+func TestReadSnapshotV1(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "..", "testdata", "snapshot", "v1.snap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := ReadSnapshot(f)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+
+	if s.Manifest.Version != 1 || s.Manifest.Root != "cfg" {
+		t.Errorf("manifest = %+v", s.Manifest)
+	}
+	want := map[string]string{
+		"app.yaml":           `{"empty":null,"enabled":true,"name":"app","ports":[80,443],"ratio":0.5,"replicas":3}` + "\n",
+		"nested/server.toml": `{"server":{"host":"example.com"}}` + "\n",
+	}
+	if len(s.Trees) != len(want) {
+		t.Errorf("files = %d, want %d", len(s.Trees), len(want))
+	}
+	for path, json := range want {
+		node, ok := s.Trees[path]
+		if !ok {
+			t.Errorf("%s missing", path)
+			continue
+		}
+		if got := canonical(t, node); got != json {
+			t.Errorf("%s = %s, want %s", path, got, json)
+		}
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	manifest := func(version int, hash string) string {
+		return `{"version": ` + strconv.Itoa(version) + `, "root": "cfg", "files": [{"path": "a.yaml", "format": "yaml", "sha256": "` + hash + `"}]}`
+	}
+	doc := `{"a":1}` + "\n"
+	hash := "e346432021b04179518d9614f3560ccd71354a4ee101ddcb893d6959a9d6301c"
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"not gzip", []byte("plain text"), "not a snapshot"},
+		{"no manifest", snapshotArchive(t, "trees/a.yaml.json", doc), "manifest.json is missing"},
+		{"newer version", snapshotArchive(t, "manifest.json", manifest(2, hash), "trees/a.yaml.json", doc), "Upgrade configdiff"},
+		{"missing file", snapshotArchive(t, "manifest.json", manifest(1, hash)), "a.yaml is missing"},
+		{"wrong hash", snapshotArchive(t, "manifest.json", manifest(1, hash), "trees/a.yaml.json", `{"a":2}`+"\n"), "does not match its hash"},
+		{"escaping path", snapshotArchive(t, "manifest.json", strings.Replace(manifest(1, hash), "a.yaml", "../a.yaml", 1)), "bad file path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadSnapshot(bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadSnapshot() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The hash above is the hash of doc
+	s, err := ReadSnapshot(bytes.NewReader(snapshotArchive(t, "manifest.json", manifest(1, hash), "trees/a.yaml.json", doc)))
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+	if got := canonical(t, s.Trees["a.yaml"]); got != doc {
+		t.Errorf("a.yaml = %s, want %s", got, doc)
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pfrederiksen/configdiff"
+)
+
+// SplitStdin splits data into the old and new documents at the line equal
+// to separator, ignoring a trailing carriage return. The separator line
+// belongs to neither document. It is an error for the separator to be
+// missing or to appear more than once.
+func SplitStdin(data []byte, separator string) (oldData, newData []byte, err error) {
+	if separator == "" {
+		return nil, nil, fmt.Errorf("the stdin separator must not be empty")
+	}
+
+	found := false
+	var next int
+	for start := 0; start < len(data); start = next {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			next = len(data)
+		} else {
+			next = start + end + 1
+		}
+		line := bytes.TrimSuffix(bytes.TrimSuffix(data[start:next], []byte("\n")), []byte("\r"))
+		if string(line) != separator {
+			continue
+		}
+		if found {
+			return nil, nil, fmt.Errorf("separator %q appears more than once on stdin\nHint: Choose a separator that does not occur in either document", separator)
+		}
+		found = true
+		oldData, newData = data[:start], data[next:]
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("separator %q not found on stdin\nHint: Write a line containing only the separator between the old and new documents", separator)
+	}
+	return oldData, newData, nil
+}
+
+// ReadStdinPair reads stdin once and returns the old and new documents
+// separated by separator, detecting the format of each independently.
+func ReadStdinPair(separator, oldFormatHint, newFormatHint string) (oldInput, newInput *InputSource, err error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, nil, &configdiff.ReadError{File: "-", Err: err}
+	}
+	oldData, newData, err := SplitStdin(data, separator)
+	if err != nil {
+		return nil, nil, err
+	}
+	if oldInput, err = stdinInput("old", oldData, oldFormatHint); err != nil {
+		return nil, nil, err
+	}
+	if newInput, err = stdinInput("new", newData, newFormatHint); err != nil {
+		return nil, nil, err
+	}
+	return oldInput, newInput, nil
+}
+
+// stdinInput returns one side of a pair read from stdin.
+func stdinInput(side string, data []byte, formatHint string) (*InputSource, error) {
+	format := formatHint
+	if format == "" || format == "auto" {
+		format = detectFromContent(data)
+		if format == "" {
+			return nil, &configdiff.ParseError{Side: side, File: "-", Err: fmt.Errorf("unable to detect format\nHint: Specify format explicitly with --%s-format", side)}
+		}
+	}
+
+	return &InputSource{
+		Path:   "-",
+		Data:   data,
+		Format: format,
+	}, nil
+}
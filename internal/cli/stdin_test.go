@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSplitStdin(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantOld string
+		wantNew string
+		wantErr string
+	}{
+		{"split", "a: 1\n---8<---\na: 2\n", "a: 1\n", "a: 2\n", ""},
+		{"crlf", "a: 1\r\n---8<---\r\na: 2\r\n", "a: 1\r\n", "a: 2\r\n", ""},
+		{"no trailing newline", "{}\n---8<---", "{}\n", "", ""},
+		{"inside a line", "a: ---8<---\nb: 1\n", "", "", "not found"},
+		{"missing", "a: 1\n", "", "", "not found"},
+		{"twice", "a: 1\n---8<---\na: 2\n---8<---\na: 3\n", "", "", "more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldData, newData, err := SplitStdin([]byte(tt.data), "---8<---")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SplitStdin() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SplitStdin() error = %v", err)
+			}
+			if string(oldData) != tt.wantOld || string(newData) != tt.wantNew {
+				t.Errorf("SplitStdin() = %q, %q, want %q, %q", oldData, newData, tt.wantOld, tt.wantNew)
+			}
+		})
+	}
+}
+
+func TestReadStdinPair(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	os.Stdin = r
+	go func() {
+		w.WriteString("a: 1\n--\n{\"a\": 2}\n")
+		w.Close()
+	}()
+
+	oldInput, newInput, err := ReadStdinPair("--", "auto", "auto")
+	if err != nil {
+		t.Fatalf("ReadStdinPair() error = %v", err)
+	}
+	if oldInput.Format != "yaml" || newInput.Format != "json" {
+		t.Errorf("formats = %s, %s, want yaml, json", oldInput.Format, newInput.Format)
+	}
+}
@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// TFAction is what a Terraform plan does to a resource.
+type TFAction string
+
+const (
+	// TFCreate creates a resource that does not exist yet.
+	TFCreate TFAction = "create"
+
+	// TFDelete destroys a resource.
+	TFDelete TFAction = "delete"
+
+	// TFReplace destroys a resource and creates it anew, in either order.
+	TFReplace TFAction = "replace"
+
+	// TFUpdate changes a resource in place.
+	TFUpdate TFAction = "update"
+
+	// TFNoOp leaves a resource as it is.
+	TFNoOp TFAction = "no-op"
+
+	// tfRead reads a data source, which ParseTFPlan leaves out.
+	tfRead TFAction = "read"
+)
+
+// TFUnknownValue stands in for values that are only known after apply.
+const TFUnknownValue = "(known after apply)"
+
+// TFResourceChange is the change a Terraform plan makes to one resource.
+type TFResourceChange struct {
+	// Address is the resource's address, e.g. module.db.aws_db_instance.main,
+	// followed by "(deposed KEY)" for a deposed object.
+	Address string
+
+	Action TFAction
+
+	// Before and After are the resource's attributes before and after
+	// apply, nil for a resource created or destroyed. Values only known
+	// after apply are TFUnknownValue in After.
+	Before *tree.Node
+	After  *tree.Node
+
+	// SensitivePaths are the paths of attributes Terraform marks sensitive
+	// on either side, whose values must not be shown.
+	SensitivePaths []string
+}
+
+// ParseTFPlan parses a plan in the JSON format of "terraform show -json",
+// returning its resource changes in plan order. Data sources read during
+// apply are left out, since reading them changes nothing.
+func ParseTFPlan(data []byte) ([]TFResourceChange, error) {
+	if bytes.HasPrefix(data, []byte("PK")) {
+		return nil, fmt.Errorf("binary plan files are not supported\nHint: Convert the plan to JSON with: terraform show -json plan.out > plan.json")
+	}
+	doc, err := parse.Parse(data, parse.FormatJSON)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind != tree.KindObject || doc.Object["format_version"] == nil {
+		return nil, fmt.Errorf("not a Terraform plan: format_version is missing\nHint: Convert the plan to JSON with: terraform show -json plan.out > plan.json")
+	}
+
+	resources := doc.Object["resource_changes"]
+	if resources == nil || resources.Kind == tree.KindNull {
+		return nil, nil
+	}
+	if resources.Kind != tree.KindArray {
+		return nil, fmt.Errorf("resource_changes must be an array, got %s", resources.Kind)
+	}
+
+	var changes []TFResourceChange
+	for i, rc := range resources.Array {
+		address := stringAt(rc, "/address")
+		if address == "" {
+			return nil, fmt.Errorf("resource_changes[%d]: address is missing", i)
+		}
+		if deposed := stringAt(rc, "/deposed"); deposed != "" {
+			address += " (deposed " + deposed + ")"
+		}
+		change := rc.GetByPath("/change")
+		if change == nil || change.Kind != tree.KindObject {
+			return nil, fmt.Errorf("%s: change is missing", address)
+		}
+		action, err := tfAction(change.Object["actions"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", address, err)
+		}
+		if action == tfRead {
+			continue
+		}
+
+		c := TFResourceChange{
+			Address: address,
+			Action:  action,
+			Before:  tfValue(change.Object["before"]),
+			After:   markUnknown(tfValue(change.Object["after"]), change.Object["after_unknown"]),
+		}
+		c.SensitivePaths = append(markedPaths(change.Object["before_sensitive"], "/"), markedPaths(change.Object["after_sensitive"], "/")...)
+		if c.Before != nil {
+			c.Before.SetPaths("/")
+		}
+		if c.After != nil {
+			c.After.SetPaths("/")
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// tfAction returns the action of a change's actions list: a create and a
+// delete in either order are a replace.
+func tfAction(actions *tree.Node) (TFAction, error) {
+	if actions == nil || actions.Kind != tree.KindArray {
+		return "", fmt.Errorf("change.actions is missing")
+	}
+	var names []string
+	for _, a := range actions.Array {
+		if a.Kind != tree.KindString {
+			return "", fmt.Errorf("change.actions must be strings")
+		}
+		names = append(names, a.Value.(string))
+	}
+
+	switch len(names) {
+	case 1:
+		switch action := TFAction(names[0]); action {
+		case TFCreate, TFDelete, TFUpdate, TFNoOp, tfRead:
+			return action, nil
+		}
+	case 2:
+		first, second := TFAction(names[0]), TFAction(names[1])
+		if (first == TFDelete && second == TFCreate) || (first == TFCreate && second == TFDelete) {
+			return TFReplace, nil
+		}
+	}
+	return "", fmt.Errorf("unknown change.actions %v", names)
+}
+
+// tfValue returns the attributes of one side of a change, nil if the
+// resource does not exist on that side.
+func tfValue(n *tree.Node) *tree.Node {
+	if n == nil || n.Kind == tree.KindNull {
+		return nil
+	}
+	return n.Clone()
+}
+
+// markUnknown replaces the values of value marked true in unknown, a
+// structure of the same shape as after_unknown, with TFUnknownValue. It
+// returns nil if value is nil and nothing in it is unknown.
+func markUnknown(value, unknown *tree.Node) *tree.Node {
+	if unknown == nil {
+		return value
+	}
+	switch unknown.Kind {
+	case tree.KindBool:
+		if unknown.Value.(bool) {
+			return withLine(tree.NewString(TFUnknownValue), unknown)
+		}
+	case tree.KindObject:
+		if value != nil && value.Kind != tree.KindObject && value.Kind != tree.KindNull {
+			return value
+		}
+		for key, u := range unknown.Object {
+			var child *tree.Node
+			if value != nil && value.Kind == tree.KindObject {
+				child = value.Object[key]
+			}
+			marked := markUnknown(child, u)
+			if marked == nil || marked == child {
+				continue
+			}
+			if value == nil || value.Kind == tree.KindNull {
+				value = withLine(tree.NewObject(map[string]*tree.Node{}), unknown)
+			}
+			value.Object[key] = marked
+		}
+	case tree.KindArray:
+		if value != nil && value.Kind != tree.KindArray && value.Kind != tree.KindNull {
+			return value
+		}
+		for i, u := range unknown.Array {
+			var elem *tree.Node
+			if value != nil && value.Kind == tree.KindArray && i < len(value.Array) {
+				elem = value.Array[i]
+			}
+			marked := markUnknown(elem, u)
+			if marked == nil || marked == elem {
+				continue
+			}
+			if value == nil || value.Kind == tree.KindNull {
+				value = withLine(tree.NewArray(nil), unknown)
+			}
+			for len(value.Array) <= i {
+				value.Array = append(value.Array, tree.NewNull())
+			}
+			value.Array[i] = marked
+		}
+	}
+	return value
+}
+
+// markedPaths returns the paths marked true in marks, a structure of the
+// same shape as the attributes, e.g. after_sensitive.
+func markedPaths(marks *tree.Node, path string) []string {
+	if marks == nil {
+		return nil
+	}
+	var paths []string
+	switch marks.Kind {
+	case tree.KindBool:
+		if marks.Value.(bool) {
+			paths = append(paths, path)
+		}
+	case tree.KindObject:
+		for _, key := range marks.SortedKeys() {
+			child := "/" + key
+			if path != "/" {
+				child = path + child
+			}
+			paths = append(paths, markedPaths(marks.Object[key], child)...)
+		}
+	case tree.KindArray:
+		for i, m := range marks.Array {
+			paths = append(paths, markedPaths(m, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTFPlan(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "tfplan", "plan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := ParseTFPlan(data)
+	if err != nil {
+		t.Fatalf("ParseTFPlan() error = %v", err)
+	}
+
+	actions := make(map[string]TFAction)
+	for _, rc := range resources {
+		actions[rc.Address] = rc.Action
+	}
+	want := map[string]TFAction{
+		"aws_instance.web":                TFReplace,
+		"aws_s3_bucket.logs":              TFUpdate,
+		"aws_db_instance.main":            TFUpdate,
+		"module.queue.aws_sqs_queue.jobs": TFCreate,
+		"aws_iam_user.legacy":             TFDelete,
+		"aws_vpc.main":                    TFNoOp,
+	}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions = %v, want %v", actions, want)
+	}
+
+	web := resources[0]
+	if got := web.After.GetByPath("/id"); got == nil || got.Value != TFUnknownValue {
+		t.Errorf("/id after = %v, want %q", got, TFUnknownValue)
+	}
+	if got := web.After.GetByPath("/tags/Name"); got == nil || got.Value != "web" {
+		t.Errorf("/tags/Name after = %v, want it unchanged", got)
+	}
+	if got := web.After.GetByPath("/id").Path; got != "/id" {
+		t.Errorf("/id path = %q, want /id", got)
+	}
+
+	db := resources[2]
+	if want := []string{"/password", "/password"}; !reflect.DeepEqual(db.SensitivePaths, want) {
+		t.Errorf("SensitivePaths = %v, want %v", db.SensitivePaths, want)
+	}
+
+	for _, rc := range resources {
+		switch rc.Action {
+		case TFCreate:
+			if rc.Before != nil {
+				t.Errorf("%s: Before = %v, want nil for a created resource", rc.Address, rc.Before)
+			}
+		case TFDelete:
+			if rc.After != nil {
+				t.Errorf("%s: After = %v, want nil for a destroyed resource", rc.Address, rc.After)
+			}
+		}
+	}
+}
+
+func TestParseTFPlanErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		plan string
+		want string
+	}{
+		{"binary plan", "PK\x03\x04", "binary plan"},
+		{"not a plan", `{"apiVersion": "v1"}`, "not a Terraform plan"},
+		{"missing address", `{"format_version": "1.2", "resource_changes": [{"change": {"actions": ["create"]}}]}`, "address is missing"},
+		{"unknown action", `{"format_version": "1.2", "resource_changes": [{"address": "a.b", "change": {"actions": ["destroy"]}}]}`, "unknown change.actions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTFPlan([]byte(tt.plan))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseTFPlan() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	resources, err := ParseTFPlan([]byte(`{"format_version": "1.2"}`))
+	if err != nil || len(resources) != 0 {
+		t.Errorf("ParseTFPlan() of an empty plan = %v, %v, want no resources", resources, err)
+	}
+}
@@ -1,9 +1,18 @@
-// Package config handles loading configuration from files.
+// Package config handles loading configuration from files and the
+// environment.
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -22,7 +31,7 @@ type Config struct {
 	// BoolStrings enables treating string booleans as booleans.
 	BoolStrings bool `yaml:"bool_strings"`
 
-	// StableOrder enables stable sorting of object keys and array elements.
+	// StableOrder sorts changes by path rather than in the order compared.
 	StableOrder bool `yaml:"stable_order"`
 
 	// OutputFormat specifies the default output format (report/compact/json/patch).
@@ -33,52 +42,350 @@ type Config struct {
 
 	// NoColor disables colored output.
 	NoColor bool `yaml:"no_color"`
+
+	// TemplateFile is the text/template used by the template output format.
+	TemplateFile string `yaml:"template_file"`
+
+	// ExcludePaths are file and directory patterns skipped in recursive comparisons.
+	ExcludePaths []string `yaml:"exclude_paths"`
+
+	// MaxParseSize is the largest document parsed, as for --max-parse-size.
+	MaxParseSize string `yaml:"max_parse_size"`
+
+	// Preset is the preset to compare with, as for --preset.
+	Preset string `yaml:"preset"`
+
+	// MaskPaths are path globs whose values are masked in all output.
+	MaskPaths []string `yaml:"mask_paths"`
+
+	// MaskMode is how masked values are shown (redact/hash).
+	MaskMode string `yaml:"mask_mode"`
+
+	// SeverityRules rate the changes at the paths they match, in order, so
+	// that later rules win.
+	SeverityRules []SeverityRule `yaml:"severity_rules"`
+
+	// Rules are settings for the files matching a glob, applied over the
+	// settings above in order.
+	Rules []Rule `yaml:"rules"`
+
+	// Extends are the config files this one is applied over, see LoadFile.
+	Extends Paths `yaml:"extends"`
+
+	// Sources maps each key set by a config file to where it is set, as
+	// "path:line", or several of those joined by ", " for settings merged
+	// from more than one file, see Merge.
+	Sources map[string]string `yaml:"-"`
+
+	// Path is the highest precedence file Load read settings from, whose
+	// directory rules are matched relative to, or "" if none.
+	Path string `yaml:"-"`
+
+	// Files are the files Load merged, from lowest to highest precedence.
+	Files []string `yaml:"-"`
+
+	// Env lists the keys of the settings Load took from the environment.
+	Env []string `yaml:"-"`
+}
+
+// IsSet reports whether the setting key was set by a config file or the
+// environment, rather than left at its zero value.
+func (c *Config) IsSet(key string) bool {
+	_, ok := c.Sources[key]
+	return ok || slices.Contains(c.Env, key)
 }
 
-// Load attempts to load configuration from standard locations.
-// It checks the following locations in order:
+// Rule is a set of settings for the files whose new side matches a glob.
+// Unset settings leave those of the config file and earlier rules as they
+// are.
+type Rule struct {
+	// Match is the file glob, matched as --exclude patterns are against the
+	// file's path relative to the config file's directory: without a slash
+	// it matches the file name.
+	Match string `yaml:"match" json:"match"`
+
+	// IgnorePaths are added to the ignore paths.
+	IgnorePaths []string `yaml:"ignore_paths" json:"ignore_paths,omitempty"`
+
+	// ArrayKeys are added to the array keys, replacing the key of a path
+	// already keyed.
+	ArrayKeys map[string]string `yaml:"array_keys" json:"array_keys,omitempty"`
+
+	// Preset replaces the preset.
+	Preset string `yaml:"preset" json:"preset,omitempty"`
+
+	// NumericStrings and BoolStrings, if set, replace the settings.
+	NumericStrings *bool `yaml:"numeric_strings" json:"numeric_strings,omitempty"`
+	BoolStrings    *bool `yaml:"bool_strings" json:"bool_strings,omitempty"`
+}
+
+// SeverityRule rates the changes at the paths matching a glob, as --ignore
+// patterns are matched, when changes are classified by severity.
+type SeverityRule struct {
+	// Match is the path glob, e.g. /spec/template/**.
+	Match string `yaml:"match" json:"match"`
+
+	// Severity is info, warning (or warn), or breaking (or error).
+	Severity string `yaml:"severity" json:"severity"`
+}
+
+// names are the file names a configuration file is looked for under in a
+// directory, in order of precedence.
+var names = []string{".configdiffrc", ".configdiff.yaml"}
+
+// Locations returns the paths a configuration file is looked for at, in
+// order of precedence:
 //   1. ./.configdiffrc
 //   2. ./.configdiff.yaml
 //   3. ~/.configdiffrc
 //   4. ~/.configdiff.yaml
-//
-// Returns the first config file found, or an empty config if none exist.
-func Load() (*Config, error) {
-	locations := []string{
-		".configdiffrc",
-		".configdiff.yaml",
-	}
+func Locations() []string {
+	locations := append([]string(nil), names...)
 
 	// Add home directory locations
 	if home, err := os.UserHomeDir(); err == nil {
-		locations = append(locations,
-			filepath.Join(home, ".configdiffrc"),
-			filepath.Join(home, ".configdiff.yaml"),
-		)
+		for _, name := range names {
+			locations = append(locations, filepath.Join(home, name))
+		}
+	}
+	return locations
+}
+
+// LocationsFrom returns the paths a configuration file is looked for at when
+// comparing files in dir, in order of precedence: the files named as in
+// Locations in dir and then each of its parents, nearest first, up to the
+// first directory containing .git (a repository root) or the filesystem
+// root, followed by Locations. With dir "" it returns Locations.
+//
+// For example, from /src/repo/deploy/prod in a repository at /src/repo:
+//   1. /src/repo/deploy/prod/.configdiffrc
+//   2. /src/repo/deploy/prod/.configdiff.yaml
+//   3. /src/repo/deploy/.configdiffrc
+//   4. /src/repo/deploy/.configdiff.yaml
+//   5. /src/repo/.configdiffrc
+//   6. /src/repo/.configdiff.yaml
+//   7. the paths returned by Locations
+func LocationsFrom(dir string) []string {
+	if dir == "" {
+		return Locations()
+	}
+	var locations []string
+	if abs, err := filepath.Abs(dir); err == nil {
+		for dir = abs; ; dir = filepath.Dir(dir) {
+			for _, name := range names {
+				locations = append(locations, filepath.Join(dir, name))
+			}
+			if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	return append(locations, Locations()...)
+}
+
+// Find returns the first of Locations that exists, or "" if none do.
+func Find() string {
+	return FindFrom("")
+}
+
+// FindFrom returns the first of LocationsFrom(dir) that exists, or "" if
+// none do.
+func FindFrom(dir string) string {
+	for _, path := range LocationsFrom(dir) {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// FindAll returns every one of Locations that exists, from lowest to
+// highest precedence.
+func FindAll() []string {
+	return FindAllFrom("")
+}
+
+// FindAllFrom returns every one of LocationsFrom(dir) that exists, from
+// lowest to highest precedence, so the home directory's files come first
+// and the nearest file last. A file reached by more than one location,
+// e.g. when dir is the current directory, is returned once.
+func FindAllFrom(dir string) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, path := range LocationsFrom(dir) {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			paths = append(paths, path)
+		}
+	}
+	slices.Reverse(paths)
+	return paths
+}
+
+// Load loads the configuration files returned by FindAll, merged as by
+// Merge from lowest to highest precedence, or an empty config if none
+// exist, and overrides their settings with the environment variables named
+// by EnvVar. So the settings of ~/.configdiff.yaml apply unless a
+// ./.configdiffrc sets them too. Files are parsed strictly, see LoadFile. A
+// file that exists but cannot be read or parsed is reported in the error as
+// a *FileError, and none of the files' settings are used, and variables
+// with invalid values are reported as *EnvError, along with the settings
+// that did load, so callers can decide whether to carry on.
+func Load() (*Config, error) {
+	return LoadFrom("", false)
+}
+
+// LoadFrom is like Load, but loads the configuration files returned by
+// FindAllFrom(dir), leniently if lenient is set.
+func LoadFrom(dir string, lenient bool) (*Config, error) {
+	return load(FindAllFrom(dir), lenient)
+}
+
+// LoadNearest is like LoadFrom, but loads only the configuration file
+// returned by FindFrom(dir), as Load did before files were merged.
+func LoadNearest(dir string, lenient bool) (*Config, error) {
+	var paths []string
+	if path := FindFrom(dir); path != "" {
+		paths = append(paths, path)
 	}
+	return load(paths, lenient)
+}
+
+// LoadPath is like LoadFrom, but loads the configuration file at path
+// instead of looking for one, so a missing file is an error too.
+func LoadPath(path string, lenient bool) (*Config, error) {
+	return load([]string{path}, lenient)
+}
 
-	// Try each location
-	for _, path := range locations {
-		if cfg, err := loadFile(path); err == nil {
-			return cfg, nil
+// load loads the configuration files at paths, merging each over the ones
+// before, and the environment.
+func load(paths []string, lenient bool) (*Config, error) {
+	cfg := &Config{}
+	var errs []error
+	for _, path := range paths {
+		loaded, err := LoadFile(path, lenient)
+		if err != nil {
+			errs = append(errs, &FileError{Path: path, Err: err})
+			continue
 		}
+		cfg.Merge(loaded)
+		cfg.Path = path
+		cfg.Files = append(cfg.Files, path)
 	}
+	// The other files' settings alone are not what any of them asked for
+	if len(errs) > 0 {
+		cfg = &Config{}
+	}
+	keys, envErr := cfg.ApplyEnv(os.LookupEnv)
+	cfg.Env = keys
+	return cfg, errors.Join(append(errs, envErr)...)
+}
 
-	// No config file found, return empty config
-	return &Config{}, nil
+// FileError is a configuration file that could not be loaded.
+type FileError struct {
+	Path string
+	Err  error
 }
 
-// loadFile loads configuration from a specific file path.
-func loadFile(path string) (*Config, error) {
+func (e *FileError) Error() string {
+	return fmt.Sprintf("failed to load config file %s: %v", e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Problem is an error in a configuration file found by Validate.
+type Problem struct {
+	// Line is the line of the file the problem is on, or 0 if unknown.
+	Line int
+
+	// Key is the top-level key the problem is under, or "" if unknown.
+	Key     string
+	Message string
+}
+
+// String returns the problem as "line N: message".
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// File is a configuration file parsed by Validate.
+type File struct {
+	Path   string
+	Config *Config
+
+	// Lines maps each top-level key set in the file to its line.
+	Lines map[string]int
+}
+
+var (
+	// lineMessage matches the "line N: message" form of yaml.v3 errors.
+	lineMessage = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+	// unknownField matches the yaml.v3 error for an unknown key.
+	unknownField = regexp.MustCompile(`^field (.*) not found in type .*$`)
+)
+
+// Validate parses the configuration file at path strictly: unknown keys and
+// values of the wrong type are reported as problems with their lines rather
+// than ignored. The error is only set if the file cannot be read.
+func Validate(path string) (*File, []Problem, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	f := &File{Path: path, Config: &Config{}, Lines: make(map[string]int)}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return f, []Problem{toProblem(err.Error())}, nil
+	}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		mapping := doc.Content[0]
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			f.Lines[mapping.Content[i].Value] = mapping.Content[i].Line
+		}
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(f.Config)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+		return f, nil, nil
+	case errors.As(err, &typeErr):
+		problems := make([]Problem, 0, len(typeErr.Errors))
+		for _, msg := range typeErr.Errors {
+			problems = append(problems, toProblem(msg))
+		}
+		return f, problems, nil
+	default:
+		return f, []Problem{toProblem(err.Error())}, nil
 	}
+}
 
-	return &cfg, nil
+// toProblem converts a yaml.v3 error message to a Problem.
+func toProblem(msg string) Problem {
+	m := lineMessage.FindStringSubmatch(msg)
+	if m == nil {
+		return Problem{Message: strings.TrimPrefix(msg, "yaml: ")}
+	}
+	line, _ := strconv.Atoi(m[1])
+	msg = m[2]
+	if field := unknownField.FindStringSubmatch(msg); field != nil {
+		msg = fmt.Sprintf("unknown key %q", field[1])
+	}
+	return Problem{Line: line, Message: msg}
 }
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -150,9 +153,9 @@ func TestLoadFile(t *testing.T) {
 			t.Fatalf("Failed to write file: %v", err)
 		}
 
-		cfg, err := loadFile(path)
+		cfg, err := LoadFile(path, false)
 		if err != nil {
-			t.Errorf("loadFile() error = %v, want nil", err)
+			t.Errorf("LoadFile() error = %v, want nil", err)
 		}
 		if len(cfg.IgnorePaths) != 2 {
 			t.Errorf("IgnorePaths length = %d, want 2", len(cfg.IgnorePaths))
@@ -160,9 +163,9 @@ func TestLoadFile(t *testing.T) {
 	})
 
 	t.Run("file not found", func(t *testing.T) {
-		_, err := loadFile("/nonexistent/file.yaml")
+		_, err := LoadFile("/nonexistent/file.yaml", false)
 		if err == nil {
-			t.Error("loadFile() error = nil, want error")
+			t.Error("LoadFile() error = nil, want error")
 		}
 	})
 
@@ -174,9 +177,594 @@ func TestLoadFile(t *testing.T) {
 			t.Fatalf("Failed to write file: %v", err)
 		}
 
-		_, err := loadFile(path)
+		_, err := LoadFile(path, false)
 		if err == nil {
-			t.Error("loadFile() error = nil, want YAML parse error")
+			t.Error("LoadFile() error = nil, want YAML parse error")
 		}
 	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "unknown.yaml")
+		content := "ignorePaths: [/status]\nno_color: true\nrules:\n  - match: \"*.tf\"\n    ignore: [/a]\n"
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		want := `line 1: unknown key "ignorePaths"; line 5: unknown key "ignore"`
+		if _, err := LoadFile(path, false); err == nil || err.Error() != want {
+			t.Errorf("LoadFile() error = %v, want %q", err, want)
+		}
+		cfg, err := LoadFile(path, true)
+		if err != nil {
+			t.Fatalf("LoadFile() lenient error = %v", err)
+		}
+		if !cfg.NoColor || len(cfg.Rules) != 1 {
+			t.Errorf("LoadFile() lenient = %+v, want the known keys set", cfg)
+		}
+	})
+}
+
+func TestLoadFile_Extends(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		return path
+	}
+
+	// A diamond: repo extends left and right, which both extend base
+	write("shared/base.yaml", `ignore_paths: [/base]
+array_keys:
+  /a: id
+  /b: id
+output_format: json
+rules:
+  - match: "*.tf"
+`)
+	write("shared/left.yaml", `extends: [base.yaml]
+output_format: markdown
+array_keys:
+  /a: name
+rules:
+  - match: "*.yaml"
+`)
+	write("shared/right.yaml", `extends: base.yaml
+numeric_strings: true
+`)
+	top := write("repo/.configdiffrc", `extends:
+  - ../shared/left.yaml
+  - ../shared/right.yaml
+ignore_paths: [/top]
+`)
+
+	cfg, err := LoadFile(top, false)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := &Config{
+		IgnorePaths:    []string{"/top"},
+		ArrayKeys:      map[string]string{"/a": "name", "/b": "id"},
+		NumericStrings: true,
+		// right.yaml does not apply base.yaml's output_format over left.yaml's
+		OutputFormat: "markdown",
+		Rules:        []Rule{{Match: "*.tf"}, {Match: "*.yaml"}},
+		Extends:      Paths{"../shared/left.yaml", "../shared/right.yaml"},
+	}
+	sources := cfg.Sources
+	cfg.Sources = nil
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadFile() = %+v, want %+v", cfg, want)
+	}
+	wantSources := map[string]string{
+		"ignore_paths":    top + ":4",
+		"array_keys":      filepath.Join(tmpDir, "shared", "left.yaml") + ":3",
+		"numeric_strings": filepath.Join(tmpDir, "shared", "right.yaml") + ":2",
+		"output_format":   filepath.Join(tmpDir, "shared", "left.yaml") + ":2",
+		"rules":           filepath.Join(tmpDir, "shared", "left.yaml") + ":5",
+		"extends":         top + ":1",
+	}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("LoadFile() Sources = %v, want %v", sources, wantSources)
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "cycle",
+			files:   map[string]string{"a.yaml": "extends: b.yaml\n", "b.yaml": "extends: [c.yaml]\n", "c.yaml": "extends: ./a.yaml\n"},
+			wantErr: "extends cycle: a.yaml extends b.yaml extends c.yaml extends a.yaml",
+		},
+		{
+			name:    "extends itself",
+			files:   map[string]string{"a.yaml": "extends: a.yaml\n"},
+			wantErr: "extends cycle: a.yaml extends a.yaml",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"a.yaml": "extends: b.yaml\n", "b.yaml": "extends: c.yaml\n"},
+			wantErr: "a.yaml extends b.yaml extends c.yaml: open c.yaml: no such file or directory",
+		},
+		{
+			name:    "invalid file",
+			files:   map[string]string{"a.yaml": "extends: b.yaml\n", "b.yaml": "ignore_paths: [\n"},
+			wantErr: "a.yaml extends b.yaml: yaml: line 1: did not find expected node content",
+		},
+		{
+			name:    "URL",
+			files:   map[string]string{"a.yaml": "extends: https://example.com/base.yaml\n"},
+			wantErr: "a.yaml: cannot extend https://example.com/base.yaml: only local files can be extended",
+		},
+		{
+			name: "too deep",
+			files: map[string]string{
+				"a.yaml": "extends: b.yaml\n", "b.yaml": "extends: c.yaml\n", "c.yaml": "extends: d.yaml\n",
+				"d.yaml": "extends: e.yaml\n", "e.yaml": "extends: f.yaml\n", "f.yaml": "extends: g.yaml\n",
+				"g.yaml": "extends: h.yaml\n", "h.yaml": "extends: i.yaml\n", "i.yaml": "",
+			},
+			wantErr: "extends nested more than 8 files deep",
+		},
+	}
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tt.files {
+				if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := LoadFile("a.yaml", false); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_InvalidFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+
+	// A broken file is reported rather than skipped for the next location
+	if err := os.WriteFile(".configdiffrc", []byte("ignore_paths: [[[\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := os.WriteFile(".configdiff.yaml", []byte("output_format: json\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load()
+	if err == nil || !strings.Contains(err.Error(), ".configdiffrc") {
+		t.Errorf("Load() error = %v, want an error naming .configdiffrc", err)
+	}
+	if cfg == nil || cfg.OutputFormat != "" {
+		t.Errorf("Load() = %+v, want an empty config", cfg)
+	}
+}
+
+func TestLoadFrom(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+
+	// outside/.configdiffrc is above the repository root and never found
+	repo := filepath.Join(tmpDir, "repo")
+	deep := filepath.Join(repo, "deploy", "prod", "eu")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".configdiffrc":                "output_format: markdown\n",
+		"repo/.configdiff.yaml":        "output_format: json\nignore_paths: [/status]\n",
+		"repo/deploy/.configdiff.yaml": "output_format: tree\n",
+		"repo/deploy/.configdiffrc":    "output_format: compact\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		dir        string
+		wantPath   string
+		wantFormat string
+	}{
+		{"nearest file in a parent", deep, filepath.Join(repo, "deploy", ".configdiffrc"), "compact"},
+		{".configdiffrc wins in a directory", filepath.Join(repo, "deploy"), filepath.Join(repo, "deploy", ".configdiffrc"), "compact"},
+		{"repository root", repo, filepath.Join(repo, ".configdiff.yaml"), "json"},
+		{"outside the repository", tmpDir, filepath.Join(tmpDir, ".configdiffrc"), "markdown"},
+		{"no discovery", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindFrom(tt.dir); got != tt.wantPath {
+				t.Errorf("FindFrom() = %q, want %q", got, tt.wantPath)
+			}
+			cfg, err := LoadFrom(tt.dir, false)
+			if err != nil {
+				t.Fatalf("LoadFrom() error = %v", err)
+			}
+			if cfg.Path != tt.wantPath || cfg.OutputFormat != tt.wantFormat {
+				t.Errorf("LoadFrom() = %+v, want output_format %q from %q", cfg, tt.wantFormat, tt.wantPath)
+			}
+			// Files further up are merged under the nearest one, unless
+			// only it is loaded
+			if tt.wantFormat == "compact" && !reflect.DeepEqual(cfg.IgnorePaths, []string{"/status"}) {
+				t.Errorf("LoadFrom() IgnorePaths = %v, want [/status]", cfg.IgnorePaths)
+			}
+			nearest, err := LoadNearest(tt.dir, false)
+			if err != nil {
+				t.Fatalf("LoadNearest() error = %v", err)
+			}
+			if nearest.Path != tt.wantPath || nearest.OutputFormat != tt.wantFormat {
+				t.Errorf("LoadNearest() = %+v, want output_format %q from %q", nearest, tt.wantFormat, tt.wantPath)
+			}
+			if tt.wantFormat == "compact" && nearest.IgnorePaths != nil {
+				t.Errorf("LoadNearest() IgnorePaths = %v, want none", nearest.IgnorePaths)
+			}
+		})
+	}
+
+	// Without a file along the chain the current and home directories are used
+	if err := os.WriteFile(".configdiff.yaml", []byte("output_format: stat\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := t.TempDir()
+	if err := os.Mkdir(filepath.Join(empty, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindFrom(empty); got != ".configdiff.yaml" {
+		t.Errorf("FindFrom() of a directory without config = %q, want .configdiff.yaml", got)
+	}
+}
+
+func TestLoadFrom_Merge(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	repo := t.TempDir()
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(repo); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(home, ".configdiff.yaml"): "ignore_paths: [/status]\narray_keys:\n  /containers: name\n  /volumes: name\nno_color: true\noutput_format: json\n",
+		filepath.Join(repo, ".configdiff.yaml"): "max_value_length: 40\n",
+		filepath.Join(repo, ".configdiffrc"):    "output_format: compact\nignore_paths: [/metadata/generation]\narray_keys:\n  /volumes: id\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The current directory is the repository, and its files are merged once
+	cfg, err := LoadFrom(repo, false)
+	if err != nil {
+		t.Fatalf("LoadFrom() error = %v", err)
+	}
+	wantFiles := []string{
+		filepath.Join(home, ".configdiff.yaml"),
+		filepath.Join(repo, ".configdiff.yaml"),
+		filepath.Join(repo, ".configdiffrc"),
+	}
+	if !reflect.DeepEqual(cfg.Files, wantFiles) || cfg.Path != wantFiles[2] {
+		t.Errorf("LoadFrom() Files = %v, Path = %q, want %v", cfg.Files, cfg.Path, wantFiles)
+	}
+	if want := []string{"/status", "/metadata/generation"}; !reflect.DeepEqual(cfg.IgnorePaths, want) {
+		t.Errorf("IgnorePaths = %v, want %v", cfg.IgnorePaths, want)
+	}
+	if want := map[string]string{"/containers": "name", "/volumes": "id"}; !reflect.DeepEqual(cfg.ArrayKeys, want) {
+		t.Errorf("ArrayKeys = %v, want %v", cfg.ArrayKeys, want)
+	}
+	if cfg.OutputFormat != "compact" || !cfg.NoColor || cfg.MaxValueLength != 40 {
+		t.Errorf("LoadFrom() = %+v, want compact, no_color, and max_value_length 40", cfg)
+	}
+
+	wantSources := map[string]string{
+		"ignore_paths":     wantFiles[0] + ":1, " + wantFiles[2] + ":2",
+		"array_keys":       wantFiles[0] + ":2, " + wantFiles[2] + ":3",
+		"no_color":         wantFiles[0] + ":5",
+		"output_format":    wantFiles[2] + ":1",
+		"max_value_length": wantFiles[1] + ":1",
+	}
+	if !reflect.DeepEqual(cfg.Sources, wantSources) {
+		t.Errorf("Sources = %v, want %v", cfg.Sources, wantSources)
+	}
+
+	// A broken file leaves none of the files' settings in effect
+	if err := os.WriteFile(filepath.Join(repo, ".configdiff.yaml"), []byte("max_value_length: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadFrom(repo, false)
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) || fileErr.Path != wantFiles[1] {
+		t.Errorf("LoadFrom() with a broken file error = %v, want a *FileError for it", err)
+	}
+	if cfg.OutputFormat != "" || cfg.IgnorePaths != nil {
+		t.Errorf("LoadFrom() with a broken file = %+v, want an empty config", cfg)
+	}
+}
+
+func TestLoadPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+
+	// The file found in the current directory is not used
+	if err := os.WriteFile(".configdiffrc", []byte("output_format: compact\nno_color: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "ci.yaml")
+	if err := os.WriteFile(path, []byte("output_format: json\nmax_value_length: 20\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("CONFIGDIFF_MAX_VALUE_LENGTH", "30")
+
+	cfg, err := LoadPath(path, false)
+	if err != nil {
+		t.Fatalf("LoadPath() error = %v", err)
+	}
+	if cfg.Path != path || cfg.OutputFormat != "json" || cfg.NoColor || cfg.MaxValueLength != 30 {
+		t.Errorf("LoadPath() = %+v, want the file's settings under the environment's", cfg)
+	}
+
+	var fileErr *FileError
+	if _, err := LoadPath(filepath.Join(tmpDir, "missing.yaml"), true); !errors.As(err, &fileErr) {
+		t.Errorf("LoadPath() of a missing file error = %v, want a *FileError", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"CONFIGDIFF_IGNORE_PATHS":     "/status/**, /metadata/generation,,/a\\,b,/c\\\\",
+		"CONFIGDIFF_ARRAY_KEYS":       "/spec/containers=name,/spec/volumes=name",
+		"CONFIGDIFF_NUMERIC_STRINGS":  "1",
+		"CONFIGDIFF_STABLE_ORDER":     "false",
+		"CONFIGDIFF_OUTPUT_FORMAT":    "json",
+		"CONFIGDIFF_MAX_VALUE_LENGTH": "40",
+		"CONFIGDIFF_TEMPLATE_FILE":    "",
+		"NO_COLOR":                    "1",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	cfg := &Config{IgnorePaths: []string{"/file"}, StableOrder: true, TemplateFile: "file.tmpl", NoColor: true}
+	keys, err := cfg.ApplyEnv(lookup)
+	if err != nil {
+		t.Fatalf("ApplyEnv() error = %v", err)
+	}
+	want := &Config{
+		IgnorePaths:    []string{"/status/**", "/metadata/generation", "/a,b", `/c\`},
+		ArrayKeys:      map[string]string{"/spec/containers": "name", "/spec/volumes": "name"},
+		NumericStrings: true,
+		OutputFormat:   "json",
+		MaxValueLength: 40,
+		NoColor:        true,
+		TemplateFile:   "file.tmpl",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("ApplyEnv() config = %+v, want %+v", cfg, want)
+	}
+	wantKeys := []string{"ignore_paths", "array_keys", "numeric_strings", "stable_order", "output_format", "max_value_length"}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("ApplyEnv() keys = %v, want %v", keys, wantKeys)
+	}
+
+	env = map[string]string{
+		"CONFIGDIFF_NO_COLOR":         "yes please",
+		"CONFIGDIFF_MAX_VALUE_LENGTH": "long",
+		"CONFIGDIFF_ARRAY_KEYS":       "/spec/containers",
+		"CONFIGDIFF_BOOL_STRINGS":     "true",
+	}
+	cfg = &Config{MaxValueLength: 80}
+	keys, err = cfg.ApplyEnv(lookup)
+	var envErr *EnvError
+	if !errors.As(err, &envErr) {
+		t.Fatalf("ApplyEnv() error = %v, want an *EnvError", err)
+	}
+	for _, name := range []string{"CONFIGDIFF_NO_COLOR", "CONFIGDIFF_MAX_VALUE_LENGTH", "CONFIGDIFF_ARRAY_KEYS"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("ApplyEnv() error = %v, want it to name %s", err, name)
+		}
+	}
+	if !reflect.DeepEqual(keys, []string{"bool_strings"}) || !cfg.BoolStrings || cfg.MaxValueLength != 80 {
+		t.Errorf("ApplyEnv() = %v, %+v, want only bool_strings set", keys, cfg)
+	}
+}
+
+func TestLoad_Env(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+
+	if err := os.WriteFile(".configdiffrc", []byte("output_format: compact\nmax_value_length: 50\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("CONFIGDIFF_OUTPUT_FORMAT", "json")
+	t.Setenv("CONFIGDIFF_NO_COLOR", "maybe")
+
+	// The environment overrides the file, and an invalid variable is
+	// reported without losing the rest
+	cfg, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "CONFIGDIFF_NO_COLOR") {
+		t.Errorf("Load() error = %v, want an error naming CONFIGDIFF_NO_COLOR", err)
+	}
+	if cfg.OutputFormat != "json" || cfg.MaxValueLength != 50 || cfg.NoColor {
+		t.Errorf("Load() = %+v, want output_format from the environment and max_value_length from the file", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Env, []string{"output_format"}) {
+		t.Errorf("Load() Env = %v, want [output_format]", cfg.Env)
+	}
+
+	// The environment applies without a file, or with one that fails to load
+	if err := os.WriteFile(".configdiffrc", []byte("output_format: [\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("CONFIGDIFF_NO_COLOR", "")
+	cfg, err = Load()
+	if err == nil || !strings.Contains(err.Error(), ".configdiffrc") {
+		t.Errorf("Load() error = %v, want an error naming .configdiffrc", err)
+	}
+	if cfg.OutputFormat != "json" {
+		t.Errorf("Load() OutputFormat = %q, want json", cfg.OutputFormat)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []Problem
+	}{
+		{
+			name:    "valid",
+			content: "ignore_paths: [/a]\noutput_format: json\n",
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name:    "unknown key",
+			content: "ignore_paths: [/a]\nouput_format: json\n",
+			want:    []Problem{{Line: 2, Message: `unknown key "ouput_format"`}},
+		},
+		{
+			name:    "wrong type",
+			content: "max_value_length: long\n",
+			want:    []Problem{{Line: 1, Message: "cannot unmarshal !!str `long` into int"}},
+		},
+		{
+			name:    "syntax error",
+			content: "ignore_paths: [\n",
+			want:    []Problem{{Line: 1, Message: "did not find expected node content"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, strings.ReplaceAll(tt.name, " ", "-")+".yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			f, problems, err := Validate(path)
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("Validate() problems = %v, want %v", problems, tt.want)
+			}
+			if tt.name == "valid" && (f.Lines["output_format"] != 2 || f.Config.OutputFormat != "json") {
+				t.Errorf("Validate() = %+v, want output_format json on line 2", f)
+			}
+		})
+	}
+
+	if _, _, err := Validate(filepath.Join(tmpDir, "missing.yaml")); err == nil {
+		t.Error("Validate() of a missing file error = nil, want error")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	if schema["$schema"] != SchemaDraft || schema["additionalProperties"] != false {
+		t.Errorf("Schema() = %v, want a closed draft-07 object", schema)
+	}
+	properties := schema["properties"].(map[string]any)
+	for _, key := range []string{"ignore_paths", "array_keys", "rules", "severity_rules", "extends", "preset"} {
+		if _, ok := properties[key]; !ok {
+			t.Errorf("Schema() is missing %s", key)
+		}
+	}
+	for _, key := range []string{"Sources", "Path", "Files", "Env", "-"} {
+		if _, ok := properties[key]; ok {
+			t.Errorf("Schema() has %s, which is not read from config files", key)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		want map[string]any
+	}{
+		{"max_value_length", map[string]any{"type": "integer"}},
+		{"array_keys", map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}}},
+		{"exclude_paths", map[string]any{"type": "array", "items": map[string]any{"type": "string"}}},
+	}
+	for _, tt := range tests {
+		if got := properties[tt.key]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Schema() %s = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	// Fields without omitempty are required
+	rule := properties["rules"].(map[string]any)["items"].(map[string]any)
+	if !reflect.DeepEqual(rule["required"], []any{"match"}) {
+		t.Errorf("Schema() rule required = %v, want [match]", rule["required"])
+	}
+	if got := rule["properties"].(map[string]any)["numeric_strings"]; !reflect.DeepEqual(got, map[string]any{"type": "boolean"}) {
+		t.Errorf("Schema() rule numeric_strings = %v, want a boolean", got)
+	}
+	severityRule := properties["severity_rules"].(map[string]any)["items"].(map[string]any)
+	if !reflect.DeepEqual(severityRule["required"], []any{"match", "severity"}) {
+		t.Errorf("Schema() severity rule required = %v, want [match severity]", severityRule["required"])
+	}
 }
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables that override config
+// file settings. Each setting has the variable named by EnvVar, e.g.
+// CONFIGDIFF_IGNORE_PATHS for ignore_paths.
+const EnvPrefix = "CONFIGDIFF_"
+
+// EnvVar returns the environment variable that overrides the config file
+// key, e.g. CONFIGDIFF_OUTPUT_FORMAT for output_format.
+func EnvVar(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// EnvError is an environment variable whose value is not valid for the
+// setting it overrides.
+type EnvError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *EnvError) Error() string {
+	return fmt.Sprintf("invalid %s=%q: %v", e.Name, e.Value, e.Err)
+}
+
+func (e *EnvError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyEnv overrides the settings of c with the environment variables named
+// by EnvVar that lookup finds, and returns the keys of the settings it
+// overrode. Variables set to the empty string are ignored, and rules,
+// severity_rules, and extends cannot be set this way.
+//
+// Values are parsed by the type of the setting:
+//   - booleans as by strconv.ParseBool: 1, true, 0, false, ...
+//   - lists as comma-separated items, where "\," is a literal comma and "\\"
+//     a literal backslash: CONFIGDIFF_IGNORE_PATHS="/status/**,/metadata/generation"
+//   - array_keys as a list of path=key items: CONFIGDIFF_ARRAY_KEYS="/spec/containers=name"
+//
+// A list replaces the config file's rather than adding to it. Variables with
+// invalid values are skipped and reported as *EnvError in the error.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) ([]string, error) {
+	var keys []string
+	var errs []error
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := yamlKey(v.Type().Field(i))
+		// Rules and extends have no single value to set them to
+		if key == "" || key == "rules" || key == "severity_rules" || key == "extends" {
+			continue
+		}
+		name := EnvVar(key)
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setEnvValue(v.Field(i), value); err != nil {
+			errs = append(errs, &EnvError{Name: name, Value: value, Err: err})
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, errors.Join(errs...)
+}
+
+// setEnvValue sets field to the environment variable value parsed by the
+// field's type.
+func setEnvValue(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		field.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		field.SetInt(int64(n))
+	case []string:
+		field.Set(reflect.ValueOf(splitList(value)))
+	case map[string]string:
+		m := make(map[string]string)
+		for _, item := range splitList(value) {
+			path, key, ok := strings.Cut(item, "=")
+			if !ok || path == "" || key == "" {
+				return fmt.Errorf("item %q must be path=key", item)
+			}
+			m[path] = key
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, where "\," is a literal comma
+// and "\\" a literal backslash. Items are trimmed of spaces and empty items
+// dropped.
+func splitList(s string) []string {
+	items := []string{}
+	var item strings.Builder
+	add := func() {
+		if trimmed := strings.TrimSpace(item.String()); trimmed != "" {
+			items = append(items, trimmed)
+		}
+		item.Reset()
+	}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && (s[i+1] == ',' || s[i+1] == '\\'):
+			i++
+			item.WriteByte(s[i])
+		case s[i] == ',':
+			add()
+		default:
+			item.WriteByte(s[i])
+		}
+	}
+	add()
+	return items
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxExtendsDepth is how many files deep extends may nest.
+const MaxExtendsDepth = 8
+
+// Paths is a list of paths that may also be written as a single path.
+type Paths []string
+
+// UnmarshalYAML decodes a single path or a list of them.
+func (p *Paths) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = Paths{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// LoadFile loads the configuration file at path over the files it extends.
+//
+// Extended paths are relative to the directory of the file naming them, and
+// must be local files. They are applied in order, each over the one before,
+// and then the file itself over them: a setting in a file replaces that of
+// the files it extends, except that array_keys are merged by path and rules
+// and severity_rules are added after theirs. A file extended more than once, e.g. by two files
+// that both extend it, is applied the first time only, so it does not undo
+// the settings of files applied since. A file may not extend itself or a
+// file extending it, and extends may nest MaxExtendsDepth files deep.
+// Errors in an extended file name the chain of files that extends it.
+//
+// Files are parsed strictly: keys that are not settings are errors naming
+// the key and its line, e.g. `line 2: unknown key "ignorePaths"`. With
+// lenient set they are ignored.
+func LoadFile(path string, lenient bool) (*Config, error) {
+	cfg := &Config{}
+	if err := cfg.applyFile(path, nil, make(map[string]bool), lenient); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyFile applies the files that the configuration file at path extends,
+// and then the file itself, over c. chain is the files extending it, and
+// applied the absolute paths of the files already applied.
+func (c *Config) applyFile(path string, chain []string, applied map[string]bool, lenient bool) error {
+	chain = append(slices.Clip(chain), path)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	for _, p := range chain[:len(chain)-1] {
+		if a, err := filepath.Abs(p); err == nil && a == abs {
+			return fmt.Errorf("extends cycle: %s", chainString(chain))
+		}
+	}
+	if applied[abs] {
+		return nil
+	}
+	if len(chain) > MaxExtendsDepth {
+		return fmt.Errorf("%s: extends nested more than %d files deep", chainString(chain), MaxExtendsDepth)
+	}
+
+	file, lines, err := parseFile(path, lenient)
+	if err != nil {
+		if len(chain) > 1 {
+			return fmt.Errorf("%s: %w", chainString(chain), err)
+		}
+		return err
+	}
+	for _, ext := range file.Extends {
+		if strings.Contains(ext, "://") {
+			return fmt.Errorf("%s: cannot extend %s: only local files can be extended", chainString(chain), ext)
+		}
+		if !filepath.IsAbs(ext) {
+			ext = filepath.Join(filepath.Dir(path), ext)
+		}
+		if err := c.applyFile(ext, chain, applied, lenient); err != nil {
+			return err
+		}
+	}
+
+	file.Sources = make(map[string]string, len(lines))
+	for key, line := range lines {
+		file.Sources[key] = fmt.Sprintf("%s:%d", path, line)
+	}
+	c.overlay(file)
+	applied[abs] = true
+	return nil
+}
+
+// chainString returns a chain of extending files as "a extends b extends c".
+func chainString(chain []string) string {
+	return strings.Join(chain, " extends ")
+}
+
+// parseFile parses the configuration file at path, returning the line of
+// each top-level key set in it. Unknown keys are errors unless lenient is
+// set.
+func parseFile(path string, lenient bool) (*Config, map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	cfg := &Config{}
+	lines := make(map[string]int)
+	if len(doc.Content) == 0 {
+		return cfg, lines, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(!lenient)
+	err = dec.Decode(cfg)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs := make([]string, 0, len(typeErr.Errors))
+		for _, msg := range typeErr.Errors {
+			msgs = append(msgs, toProblem(msg).String())
+		}
+		return nil, nil, errors.New(strings.Join(msgs, "; "))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if mapping := doc.Content[0]; mapping.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			lines[mapping.Content[i].Value] = mapping.Content[i].Line
+		}
+	}
+	return cfg, lines, nil
+}
+
+// overlay sets the settings of c that over sets, as listed in its Sources,
+// to those of over: array_keys are merged by path, rules and severity_rules
+// added after c's, and other settings replaced.
+func (c *Config) overlay(over *Config) {
+	v, ov := reflect.ValueOf(c).Elem(), reflect.ValueOf(over).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := yamlKey(v.Type().Field(i))
+		source, ok := over.Sources[key]
+		if !ok {
+			continue
+		}
+		switch key {
+		case "array_keys":
+			arrayKeys := maps.Clone(c.ArrayKeys)
+			if arrayKeys == nil {
+				arrayKeys = make(map[string]string, len(over.ArrayKeys))
+			}
+			maps.Copy(arrayKeys, over.ArrayKeys)
+			c.ArrayKeys = arrayKeys
+		case "rules":
+			c.Rules = slices.Concat(c.Rules, over.Rules)
+		case "severity_rules":
+			c.SeverityRules = slices.Concat(c.SeverityRules, over.SeverityRules)
+		default:
+			v.Field(i).Set(ov.Field(i))
+		}
+		if c.Sources == nil {
+			c.Sources = make(map[string]string)
+		}
+		c.Sources[key] = source
+	}
+}
+
+// mergedKeys are the settings Merge combines rather than replaces.
+var mergedKeys = []string{"ignore_paths", "exclude_paths", "mask_paths", "array_keys", "rules", "severity_rules"}
+
+// Merge applies the settings that over sets, as listed in its Sources, over
+// those of c, as a higher precedence config file: ignore_paths,
+// exclude_paths, mask_paths, rules, and severity_rules are added after c's,
+// array_keys are merged by path, and other settings replaced. The sources of combined settings are
+// joined with ", ", lowest precedence first.
+func (c *Config) Merge(over *Config) {
+	sources := maps.Clone(c.Sources)
+	ignorePaths, excludePaths, maskPaths := c.IgnorePaths, c.ExcludePaths, c.MaskPaths
+	c.overlay(over)
+	if _, ok := over.Sources["ignore_paths"]; ok {
+		c.IgnorePaths = slices.Concat(ignorePaths, over.IgnorePaths)
+	}
+	if _, ok := over.Sources["exclude_paths"]; ok {
+		c.ExcludePaths = slices.Concat(excludePaths, over.ExcludePaths)
+	}
+	if _, ok := over.Sources["mask_paths"]; ok {
+		c.MaskPaths = slices.Concat(maskPaths, over.MaskPaths)
+	}
+	for _, key := range mergedKeys {
+		prev, ok := sources[key]
+		if _, set := over.Sources[key]; ok && set {
+			c.Sources[key] = prev + ", " + over.Sources[key]
+		}
+	}
+}
+
+// yamlKey returns the config file key of a Config field, or "" for fields
+// not read from config files.
+func yamlKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if key == "-" {
+		return ""
+	}
+	return key
+}
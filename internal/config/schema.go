@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SchemaDraft is the JSON Schema version Schema describes config files in,
+// the one yaml-language-server and most editors support.
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// Schema returns a JSON Schema for config files, generated from the yaml
+// tags of Config so that it describes every setting there is and no other:
+// keys that are not settings are not allowed, as when loading. Settings are
+// typed by their fields; extends may be a path or a list of them. The
+// fields of rules with a json tag lacking omitempty, such as a rule's
+// match, are required.
+//
+// The schema is a tree of maps, so callers can add to it, e.g. the allowed
+// values of a setting as an "enum", before encoding it as JSON.
+func Schema() map[string]any {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = SchemaDraft
+	schema["title"] = "configdiff configuration"
+	return schema
+}
+
+// typeSchema returns the JSON Schema of values of type t.
+func typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(Paths(nil)) {
+		return map[string]any{"anyOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		}}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		// Not a type config files can set; anything is accepted
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the JSON Schema of a struct read from config files:
+// an object with a property for each field with a yaml key.
+func structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []any
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := yamlKey(field)
+		if key == "" || !field.IsExported() {
+			continue
+		}
+		properties[key] = typeSchema(field.Type)
+		if tag, ok := field.Tag.Lookup("json"); ok && !strings.Contains(tag, ",omitempty") {
+			required = append(required, key)
+		}
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
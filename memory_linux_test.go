@@ -0,0 +1,83 @@
+//go:build linux
+
+package configdiff
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// memoryHelperEnv runs TestDiffMemoryHelper in a process of its own, with
+// the old file, the new file, and whether to compare them incrementally.
+const memoryHelperEnv = "CONFIGDIFF_MEMORY_HELPER"
+
+// BenchmarkDiffMemory reports the peak RSS of a process comparing two JSON
+// files, of members of about 50KB each, whole and incrementally. Whole,
+// the peak grows with the number of members; incrementally, it stays
+// about the same, set by the largest member:
+//
+//	go test -run '^$' -bench DiffMemory -benchtime 1x
+func BenchmarkDiffMemory(b *testing.B) {
+	for _, members := range []int{32, 256} {
+		dir := b.TempDir()
+		oldPath, newPath := filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")
+		for version, path := range []string{oldPath, newPath} {
+			if err := writeLargeJSONFile(path, members, version); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for _, incremental := range []bool{false, true} {
+			b.Run(fmt.Sprintf("members=%d/incremental=%t", members, incremental), func(b *testing.B) {
+				var peak int64
+				for i := 0; i < b.N; i++ {
+					cmd := exec.Command(os.Args[0], "-test.run=^TestDiffMemoryHelper$")
+					cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s,%s,%t", memoryHelperEnv, oldPath, newPath, incremental))
+					if out, err := cmd.CombinedOutput(); err != nil {
+						b.Fatalf("%v\n%s", err, out)
+					}
+					// Linux reports the maximum resident set size in KB
+					peak = max(peak, cmd.ProcessState.SysUsage().(*syscall.Rusage).Maxrss)
+				}
+				b.ReportMetric(float64(peak)/1024, "peak-RSS-MB")
+			})
+		}
+	}
+}
+
+func writeLargeJSONFile(path string, members, version int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := writeLargeJSON(w, members, 500, version); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// TestDiffMemoryHelper compares the files BenchmarkDiffMemory gives it.
+func TestDiffMemoryHelper(t *testing.T) {
+	args := os.Getenv(memoryHelperEnv)
+	if args == "" {
+		t.Skip("run by BenchmarkDiffMemory")
+	}
+	oldPath, rest, _ := strings.Cut(args, ",")
+	newPath, incremental, _ := strings.Cut(rest, ",")
+	IncrementalThreshold = 0
+	opts := Options{StableOrder: true, SkipReport: true, Incremental: incremental == "true"}
+	if _, err := DiffFiles(oldPath, newPath, opts); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,121 @@
+package configdiff
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Option configures the Options built by NewOptions.
+type Option func(*Options) error
+
+// Preset is a set of ignore paths and array keys for comparing a kind of
+// configuration file, applied with WithPreset.
+type Preset struct {
+	IgnorePaths  []string
+	ArraySetKeys map[string]string
+}
+
+// NewOptions returns Options with the defaults below, changed by opts in
+// order, and checked with Options.Validate. It is the recommended way to
+// build Options: unlike the zero value of the struct, which remains
+// supported, it starts from the same defaults as the command line.
+//
+// Defaults:
+//   - StableOrder is true
+//
+// The result does not share slices or maps with the arguments of opts, so
+// changing those afterwards does not change it.
+func NewOptions(opts ...Option) (Options, error) {
+	o := Options{
+		ArraySetKeys: map[string]string{},
+		StableOrder:  true,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return Options{}, err
+		}
+	}
+	if err := o.Validate(); err != nil {
+		return Options{}, err
+	}
+	return o, nil
+}
+
+// WithIgnorePaths adds paths to ignore, after those of earlier options, so
+// that a "!" pattern can re-include paths an earlier one ignored. See
+// Options.IgnorePaths.
+func WithIgnorePaths(patterns ...string) Option {
+	return func(o *Options) error {
+		o.IgnorePaths = append(o.IgnorePaths, patterns...)
+		return nil
+	}
+}
+
+// WithArrayKey compares the arrays at path as sets keyed by the field key,
+// replacing a key an earlier option set for the same path. A path without
+// a leading "/" gets one; "/" is the document root. See Options.ArraySetKeys.
+func WithArrayKey(path, key string) Option {
+	return func(o *Options) error {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		if o.ArraySetKeys == nil {
+			o.ArraySetKeys = map[string]string{}
+		}
+		o.ArraySetKeys[path] = key
+		return nil
+	}
+}
+
+// WithPreset adds the ignore paths and array keys of a preset. Given first,
+// later options can re-include its paths and rekey its arrays.
+func WithPreset(p Preset) Option {
+	return func(o *Options) error {
+		if err := WithIgnorePaths(p.IgnorePaths...)(o); err != nil {
+			return err
+		}
+		for _, path := range slices.Sorted(maps.Keys(p.ArraySetKeys)) {
+			if err := WithArrayKey(path, p.ArraySetKeys[path])(o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithCoercions sets the type coercion rules.
+func WithCoercions(c Coercions) Option {
+	return func(o *Options) error {
+		o.Coercions = c
+		return nil
+	}
+}
+
+// WithStableOrder sets whether changes are sorted by path, which
+// NewOptions does by default.
+func WithStableOrder(stable bool) Option {
+	return func(o *Options) error {
+		o.StableOrder = stable
+		return nil
+	}
+}
+
+// WithReport sets whether Result.Report is generated, which it is by
+// default. See Options.SkipReport.
+func WithReport(generate bool) Option {
+	return func(o *Options) error {
+		o.SkipReport = !generate
+		return nil
+	}
+}
+
+// WithLogger sets the logger that receives events about the comparison.
+// See Options.Logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) error {
+		o.Logger = logger
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package configdiff
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestNewOptions(t *testing.T) {
+	defaults, err := NewOptions()
+	if err != nil {
+		t.Fatalf("NewOptions() error = %v", err)
+	}
+	if !defaults.StableOrder || defaults.SkipReport {
+		t.Errorf("StableOrder = %v, SkipReport = %v by default, want true and false", defaults.StableOrder, defaults.SkipReport)
+	}
+
+	ignore := []string{"/status"}
+	opts, err := NewOptions(
+		WithPreset(Preset{IgnorePaths: []string{"/metadata/*"}, ArraySetKeys: map[string]string{"/spec/containers": "name"}}),
+		WithIgnorePaths(ignore...),
+		WithIgnorePaths("!/metadata/labels"),
+		WithArrayKey("spec/containers", "image"),
+		WithArrayKey("/spec/volumes", "name"),
+		WithCoercions(Coercions{NumericStrings: true}),
+		WithStableOrder(false),
+		WithReport(false),
+		WithLogger(slog.Default()),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions() error = %v", err)
+	}
+	ignore[0] = "/changed"
+
+	if want := []string{"/metadata/*", "/status", "!/metadata/labels"}; !slices.Equal(opts.IgnorePaths, want) {
+		t.Errorf("IgnorePaths = %v, want %v", opts.IgnorePaths, want)
+	}
+	if want := map[string]string{"/spec/containers": "image", "/spec/volumes": "name"}; !maps.Equal(opts.ArraySetKeys, want) {
+		t.Errorf("ArraySetKeys = %v, want %v", opts.ArraySetKeys, want)
+	}
+	if opts.Logger != slog.Default() {
+		t.Error("Logger is not the one given to WithLogger")
+	}
+	if !opts.Coercions.NumericStrings || opts.StableOrder || !opts.SkipReport {
+		t.Errorf("Coercions = %+v, StableOrder = %v, SkipReport = %v, want numeric strings, no stable order, and no report", opts.Coercions, opts.StableOrder, opts.SkipReport)
+	}
+}
+
+func TestNewOptionsInvalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"empty ignore path":    WithIgnorePaths("/a", ""),
+		"empty re-include":     WithIgnorePaths("!"),
+		"empty array key path": WithArrayKey("", "name"),
+		"empty array key":      WithArrayKey("/spec/containers", ""),
+		"invalid preset":       WithPreset(Preset{ArraySetKeys: map[string]string{"": "name"}}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewOptions(opt); err == nil {
+				t.Error("NewOptions() succeeded, want an error")
+			}
+		})
+	}
+}
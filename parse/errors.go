@@ -0,0 +1,115 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl/v2"
+)
+
+// ErrUnsupportedFormat is returned by Parse for a format it does not support.
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// ParseError reports a document that is not valid in its format, at the
+// position the parser reports, if any.
+type ParseError struct {
+	// Side and File name the document when a caller sets them: Side is
+	// "old" or "new" for a document being compared, File its path, or "-"
+	// for stdin.
+	Side string
+	File string
+
+	Format Format
+
+	// Line and Column are where the error is, counting from 1, or 0 if the
+	// parser does not report them.
+	Line   int
+	Column int
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	switch name := e.name(); {
+	case name == "":
+		return e.Err.Error()
+	case e.Line == 0:
+		return fmt.Sprintf("%s: %v", name, e.Err)
+	case e.Column == 0:
+		return fmt.Sprintf("%s:%d: %v", name, e.Line, e.Err)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %v", name, e.Line, e.Column, e.Err)
+	}
+}
+
+// name returns how the error names the document: its file, "stdin" for a
+// File of "-", or its side.
+func (e *ParseError) name() string {
+	switch {
+	case e.File == "-" && e.Side != "":
+		return "stdin (" + e.Side + ")"
+	case e.File == "-":
+		return "stdin"
+	case e.File != "":
+		return e.File
+	}
+	return e.Side
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// yamlLine matches the line number in yaml.v3 error messages.
+var yamlLine = regexp.MustCompile(`\bline (\d+)\b`)
+
+// newParseError returns a ParseError for an error parsing data in format,
+// with the position the parser reports.
+func newParseError(format Format, data []byte, err error) *ParseError {
+	pe := &ParseError{Format: format, Err: err}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tomlErr toml.ParseError
+	var diags hcl.Diagnostics
+	switch {
+	case errors.As(err, &syntaxErr):
+		pe.Line, pe.Column = position(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		pe.Line, pe.Column = position(data, typeErr.Offset)
+	case errors.As(err, &tomlErr):
+		pe.Line, pe.Column = tomlErr.Position.Line, tomlErr.Position.Col
+	case errors.As(err, &diags):
+		for _, d := range diags {
+			if d.Severity == hcl.DiagError && d.Subject != nil {
+				pe.Line, pe.Column = d.Subject.Start.Line, d.Subject.Start.Column
+				break
+			}
+		}
+	case format == FormatYAML:
+		if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+			pe.Line, _ = strconv.Atoi(m[1])
+		}
+	}
+	return pe
+}
+
+// position returns the line and column of the byte before offset in data,
+// the last byte a JSON decoder read before it failed.
+func position(data []byte, offset int64) (line, column int) {
+	if offset <= 0 || offset > int64(len(data)) {
+		return 0, 0
+	}
+	before := data[:offset-1]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
@@ -0,0 +1,66 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     Format
+		data       string
+		wantLine   int
+		wantColumn int
+	}{
+		{"json syntax", FormatJSON, "{\n  \"a\": 1,\n  \"b\" 2\n}", 3, 7},
+		{"json end", FormatJSON, "{\"a\": ", 1, 6},
+		{"yaml", FormatYAML, "a: 1\nb: [\n", 2, 0},
+		{"yaml document", FormatYAML, "a: 1\n  b: 2\n", 2, 0},
+		{"toml", FormatTOML, "a = 1\nb = \n", 2, 5},
+		{"hcl", FormatHCL, "a = 1\nb = {\n", 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), tt.format)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse() error = %v, want a *ParseError", err)
+			}
+			if parseErr.Format != tt.format || parseErr.Line != tt.wantLine || parseErr.Column != tt.wantColumn {
+				t.Errorf("Parse() error at %s %d:%d, want %s %d:%d", parseErr.Format, parseErr.Line, parseErr.Column, tt.format, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	_, err := ParseJSON([]byte("{\n  x"))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("ParseJSON() error = %v, want a *ParseError", err)
+	}
+	if got := err.Error(); !strings.HasPrefix(got, "failed to parse JSON: ") {
+		t.Errorf("Error() = %q, want the message without a name", got)
+	}
+
+	parseErr.File = "app.json"
+	if got := err.Error(); !strings.HasPrefix(got, "app.json:2:3: failed to parse JSON: ") {
+		t.Errorf("Error() = %q, want it to start with the file and position", got)
+	}
+	parseErr.File, parseErr.Side = "-", "old"
+	if got := err.Error(); !strings.HasPrefix(got, "stdin (old):2:3: ") {
+		t.Errorf("Error() = %q, want it to name the old side on stdin", got)
+	}
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	_, err := Parse([]byte("a"), "xml")
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Parse() error = %v, want ErrUnsupportedFormat", err)
+	}
+	if err == nil || err.Error() != "unsupported format: xml" {
+		t.Errorf("Parse() error = %v, want \"unsupported format: xml\"", err)
+	}
+}
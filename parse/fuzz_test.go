@@ -0,0 +1,72 @@
+package parse
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addSeeds adds the files matching the glob patterns, relative to the
+// repository's testdata, and seeds to the corpus of f.
+func addSeeds(f *testing.F, patterns []string, seeds ...string) {
+	f.Helper()
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(filepath.Join("..", "testdata", pattern))
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(data)
+		}
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+}
+
+// checkFuzzResult fails t if the parser panicked, or returned neither a
+// tree nor an error.
+func checkFuzzResult(t *testing.T, valid bool, err error) {
+	t.Helper()
+	var pe *panicError
+	if errors.As(err, &pe) {
+		t.Fatalf("parser panicked: %v\n%s", pe.value, pe.stack)
+	}
+	if err == nil && !valid {
+		t.Fatal("no tree and no error")
+	}
+}
+
+func FuzzParseJSON(f *testing.F) {
+	addSeeds(f, []string{"tfplan/*.json", "*/*.json"},
+		`{}`, `[]`, `null`, `{"a": [1, 2.5, "x", true, null]}`, `[[[[[]]]]]`)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		node, err := ParseJSON(data)
+		checkFuzzResult(t, node != nil, err)
+	})
+}
+
+func FuzzParseYAML(f *testing.F) {
+	addSeeds(f, []string{"config/*.yaml", "configfile/*.yaml", "compose/*.yaml"},
+		"", "a: &x [1, 2]\nb: *x\n", "<<: {a: 1}\nb: 2\n", "---\na: 1\n---\nb: 2\n", "!!binary aGk=")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		node, err := ParseYAML(data)
+		checkFuzzResult(t, node != nil, err)
+		nodes, err := ParseYAMLDocuments(data)
+		checkFuzzResult(t, len(nodes) > 0, err)
+	})
+}
+
+func FuzzParseHCL(f *testing.F) {
+	addSeeds(f, []string{"hcl/*.hcl", "detect/*.tf"},
+		`a = 1 + 2 * 3`, `b = "x${1}y"`, "c = <<EOT\nhi\nEOT\n", `d = [for x in [1, 2] : x]`, `e = true ? {a = 1} : null`)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		node, err := ParseHCL(data)
+		checkFuzzResult(t, node != nil, err)
+	})
+}
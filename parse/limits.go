@@ -0,0 +1,262 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"gopkg.in/yaml.v3"
+)
+
+// Limits on the documents the parsers accept, so that a crafted document,
+// such as an untrusted upload, fails to parse rather than exhausting the
+// memory or the stack of the process parsing it. They apply to every
+// Parse function; a limit of 0 or less turns it off. Set them before
+// parsing, not while documents are being parsed.
+var (
+	// MaxSize is the largest document, in bytes.
+	MaxSize = 64 << 20
+
+	// MaxDepth is the deepest that objects and arrays may nest. In HCL,
+	// operators and template interpolations count as nesting too, since
+	// they nest in the expressions the parser builds.
+	MaxDepth = 1000
+
+	// MaxAliasExpansion is the most values YAML aliases may repeat in a
+	// document, counting every value in the nodes they refer to, which
+	// keeps a "billion laughs" document of aliases to aliases from
+	// expanding without bound.
+	MaxAliasExpansion = 100000
+)
+
+// ErrLimit is wrapped by the *ParseError for a document that exceeds
+// MaxSize, MaxDepth, or MaxAliasExpansion.
+var ErrLimit = errors.New("document exceeds parser limits")
+
+// panicError is a panic in a parser, recovered by guard.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("internal error: %v", e.value)
+}
+
+// guard turns a panic in the parser of format into a *ParseError in *err
+// and clears *result, so that a document that trips a bug in a parser is
+// rejected instead of crashing the process. It must be deferred.
+func guard[T any](format Format, data []byte, result *T, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	var zero T
+	*result = zero
+	*err = newParseError(format, data, fmt.Errorf("failed to parse %s: %w", formatName(format), &panicError{value: r, stack: debug.Stack()}))
+}
+
+// formatName returns how error messages name format, e.g. "YAML".
+func formatName(format Format) string {
+	switch format {
+	case FormatYAML:
+		return "YAML"
+	case FormatJSON:
+		return "JSON"
+	case FormatHCL:
+		return "HCL"
+	case FormatTOML:
+		return "TOML"
+	}
+	return string(format)
+}
+
+// checkSize returns an error if data is larger than MaxSize.
+func checkSize(format Format, data []byte) error {
+	if MaxSize > 0 && len(data) > MaxSize {
+		return &ParseError{Format: format, Err: fmt.Errorf("%w: %d bytes, more than %d", ErrLimit, len(data), MaxSize)}
+	}
+	return nil
+}
+
+// depthError returns the error for a document nested more than MaxDepth
+// levels deep at line, which is 0 if unknown.
+func depthError(format Format, line int) error {
+	return &ParseError{Format: format, Line: line, Err: fmt.Errorf("%w: nested more than %d levels deep", ErrLimit, MaxDepth)}
+}
+
+// checkYAML returns an error if the YAML document doc, with its aliases
+// expanded, nests more than MaxDepth levels deep or its aliases repeat
+// more than MaxAliasExpansion values. It runs before the document is
+// decoded, which would expand the aliases.
+func checkYAML(doc *yaml.Node) error {
+	type extent struct{ size, height int }
+	extents := make(map[*yaml.Node]extent)
+	visiting := make(map[*yaml.Node]bool)
+	expanded := 0
+
+	// walk returns the number of values n stands for and how deep they
+	// nest, at depth levels below the document.
+	var walk func(n *yaml.Node, depth int) (extent, error)
+	walk = func(n *yaml.Node, depth int) (extent, error) {
+		if MaxDepth > 0 && depth > MaxDepth {
+			return extent{}, depthError(FormatYAML, n.Line)
+		}
+		if e, ok := extents[n]; ok {
+			if MaxDepth > 0 && depth+e.height > MaxDepth {
+				return extent{}, depthError(FormatYAML, n.Line)
+			}
+			return e, nil
+		}
+		if visiting[n] {
+			return extent{}, &ParseError{Format: FormatYAML, Line: n.Line, Err: fmt.Errorf("anchor %q contains an alias to itself", n.Anchor)}
+		}
+		visiting[n] = true
+		defer delete(visiting, n)
+
+		e := extent{size: 1}
+		if n.Kind == yaml.AliasNode {
+			if n.Alias == nil {
+				return e, nil
+			}
+			target, err := walk(n.Alias, depth)
+			if err != nil {
+				return extent{}, err
+			}
+			expanded += target.size
+			if MaxAliasExpansion > 0 && expanded > MaxAliasExpansion {
+				return extent{}, &ParseError{Format: FormatYAML, Line: n.Line, Err: fmt.Errorf("%w: aliases repeat more than %d values", ErrLimit, MaxAliasExpansion)}
+			}
+			// Aliases are not memoized: each one adds to the expansion
+			return target, nil
+		}
+		for _, child := range n.Content {
+			// Keys and documents are not levels of nesting
+			childDepth := depth + 1
+			if n.Kind == yaml.DocumentNode {
+				childDepth = depth
+			}
+			c, err := walk(child, childDepth)
+			if err != nil {
+				return extent{}, err
+			}
+			e.size += c.size
+			e.height = max(e.height, c.height+childDepth-depth)
+		}
+		extents[n] = e
+		return e, nil
+	}
+	_, err := walk(doc, 0)
+	return err
+}
+
+// hclOpeners and hclClosers are the HCL tokens that open and close a level
+// of nesting.
+var (
+	hclOpeners = map[hclsyntax.TokenType]bool{
+		hclsyntax.TokenOBrace: true, hclsyntax.TokenOBrack: true, hclsyntax.TokenOParen: true,
+		hclsyntax.TokenOQuote: true, hclsyntax.TokenOHeredoc: true,
+		hclsyntax.TokenTemplateInterp: true, hclsyntax.TokenTemplateControl: true,
+	}
+	hclClosers = map[hclsyntax.TokenType]bool{
+		hclsyntax.TokenCBrace: true, hclsyntax.TokenCBrack: true, hclsyntax.TokenCParen: true,
+		hclsyntax.TokenCQuote: true, hclsyntax.TokenCHeredoc: true, hclsyntax.TokenTemplateSeqEnd: true,
+	}
+	hclOperators = map[hclsyntax.TokenType]bool{
+		hclsyntax.TokenStar: true, hclsyntax.TokenSlash: true, hclsyntax.TokenPlus: true,
+		hclsyntax.TokenMinus: true, hclsyntax.TokenPercent: true,
+		hclsyntax.TokenEqualOp: true, hclsyntax.TokenNotEqual: true,
+		hclsyntax.TokenLessThan: true, hclsyntax.TokenLessThanEq: true,
+		hclsyntax.TokenGreaterThan: true, hclsyntax.TokenGreaterThanEq: true,
+		hclsyntax.TokenAnd: true, hclsyntax.TokenOr: true, hclsyntax.TokenBang: true,
+		hclsyntax.TokenQuestion: true,
+	}
+)
+
+// checkHCLDepth returns an error if the HCL in data nests more than
+// MaxDepth levels deep. The HCL parser and evaluator recurse once per level
+// of brackets and once per operator in an expression, so both count: an
+// expression's operators add to the depth of the brackets it is in.
+func checkHCLDepth(data []byte) error {
+	if MaxDepth <= 0 {
+		return nil
+	}
+	tokens, _ := hclsyntax.LexConfig(data, "config.hcl", hcl.InitialPos)
+	var outer []int // operators in the expressions enclosing the current one
+	depth, operators := 0, 0
+	for _, tok := range tokens {
+		switch {
+		case hclOpeners[tok.Type]:
+			outer = append(outer, operators)
+			depth++
+			operators = 0
+		case hclClosers[tok.Type]:
+			if len(outer) == 0 {
+				continue
+			}
+			depth -= operators + 1
+			operators = outer[len(outer)-1]
+			outer = outer[:len(outer)-1]
+		case tok.Type == hclsyntax.TokenNewline || tok.Type == hclsyntax.TokenComma:
+			// A new attribute, element, or argument starts
+			depth -= operators
+			operators = 0
+		case hclOperators[tok.Type]:
+			operators++
+			depth++
+		}
+		if depth > MaxDepth {
+			return depthError(FormatHCL, tok.Range.Start.Line)
+		}
+	}
+	return nil
+}
+
+// checkTOMLDepth returns an error if the arrays and inline tables of the
+// TOML in data nest more than MaxDepth levels deep, which the TOML parser
+// does not limit.
+func checkTOMLDepth(data []byte) error {
+	if MaxDepth <= 0 {
+		return nil
+	}
+	depth, line := 0, 1
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '\n':
+			line++
+		case '#':
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case '"', '\'':
+			// Skip the string, counting the lines of multi-line ones
+			quote := string(c)
+			if i+2 < len(data) && data[i+1] == c && data[i+2] == c {
+				quote = string([]byte{c, c, c})
+			}
+			for i += len(quote); i < len(data); i++ {
+				if data[i] == '\n' {
+					line++
+				}
+				if c == '"' && data[i] == '\\' {
+					i++
+					continue
+				}
+				if len(data)-i >= len(quote) && string(data[i:i+len(quote)]) == quote {
+					i += len(quote) - 1
+					break
+				}
+			}
+		case '[', '{':
+			depth++
+			if depth > MaxDepth {
+				return depthError(FormatTOML, line)
+			}
+		case ']', '}':
+			depth = max(depth-1, 0)
+		}
+	}
+	return nil
+}
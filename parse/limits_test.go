@@ -0,0 +1,136 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+func TestParseLimits(t *testing.T) {
+	deep := 100000
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+	}{
+		{"JSON arrays", FormatJSON, strings.Repeat("[", 5000) + strings.Repeat("]", 5000)},
+		{"JSON objects", FormatJSON, strings.Repeat(`{"a":`, 5000) + "1" + strings.Repeat("}", 5000)},
+		{"YAML flow", FormatYAML, strings.Repeat("[", 5000) + strings.Repeat("]", 5000)},
+		{"YAML aliases", FormatYAML, "a: &a " + strings.Repeat("[", 10) + strings.Repeat("]", 10) + "\n" +
+			"b: " + strings.Repeat("[", 995) + "*a" + strings.Repeat("]", 995) + "\n"},
+		{"YAML alias bomb", FormatYAML, yamlAliasBomb(20)},
+		{"TOML arrays", FormatTOML, "a = " + strings.Repeat("[", deep) + strings.Repeat("]", deep)},
+		{"TOML inline tables", FormatTOML, "a = " + strings.Repeat("{b = ", deep) + "1" + strings.Repeat("}", deep)},
+		{"HCL tuples", FormatHCL, "a = " + strings.Repeat("[", deep) + strings.Repeat("]", deep)},
+		{"HCL parentheses", FormatHCL, "a = " + strings.Repeat("(", deep) + "1" + strings.Repeat(")", deep)},
+		{"HCL negation", FormatHCL, "a = " + strings.Repeat("-", deep) + "1"},
+		{"HCL operators", FormatHCL, "a = 1" + strings.Repeat(" + 1", deep)},
+		{"HCL conditionals", FormatHCL, "a = " + strings.Repeat("true ? 1 : ", deep) + "1"},
+		{"HCL templates", FormatHCL, "a = " + strings.Repeat(`"${`, deep) + "1" + strings.Repeat(`}"`, deep)},
+		{"HCL blocks", FormatHCL, strings.Repeat("b {\n", deep) + strings.Repeat("}\n", deep)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse([]byte(tt.data), tt.format)
+			if !errors.Is(err, ErrLimit) {
+				t.Fatalf("Parse() = %v, %v, want error wrapping ErrLimit", node, err)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) || pe.Format != tt.format {
+				t.Errorf("Parse() error = %#v, want *ParseError for %s", err, tt.format)
+			}
+		})
+	}
+}
+
+// yamlAliasBomb returns a "billion laughs" document of n anchors, each a
+// list of ten aliases to the one before, which expands to 10^n values.
+func yamlAliasBomb(n int) string {
+	var b strings.Builder
+	b.WriteString("a0: &a0 [x, x, x, x, x, x, x, x, x, x]\n")
+	for i := 1; i <= n; i++ {
+		aliases := strings.Repeat(fmt.Sprintf("*a%d, ", i-1), 10)
+		fmt.Fprintf(&b, "a%d: &a%d [%s]\n", i, i, strings.TrimSuffix(aliases, ", "))
+	}
+	return b.String()
+}
+
+func TestParseWithinLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+	}{
+		{"JSON", FormatJSON, strings.Repeat("[", 500) + strings.Repeat("]", 500)},
+		{"YAML aliases", FormatYAML, "base: &base {x: 1, y: [1, 2]}\n" + "items: [" + strings.Repeat("*base, ", 1000) + "]\n"},
+		{"TOML brackets in strings", FormatTOML, `a = "` + strings.Repeat("[", 5000) + `"` + "\nb = '''\n" + strings.Repeat("{", 5000) + "\n'''\n# " + strings.Repeat("[", 5000)},
+		{"HCL", FormatHCL, "a = [" + strings.Repeat("1 + 1,\n", 5000) + "]\nb = " + strings.Repeat("(", 300) + "1" + strings.Repeat(" + 1)", 300)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data), tt.format); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseMaxSize(t *testing.T) {
+	defer func(size int) { MaxSize = size }(MaxSize)
+	MaxSize = 8
+
+	for _, format := range []Format{FormatYAML, FormatJSON, FormatHCL, FormatTOML} {
+		if _, err := Parse([]byte(`a = "123456789"`), format); !errors.Is(err, ErrLimit) {
+			t.Errorf("Parse(%s) error = %v, want error wrapping ErrLimit", format, err)
+		}
+	}
+	if _, err := ParseJSON([]byte(`[1, 2]`)); err != nil {
+		t.Errorf("ParseJSON() error = %v", err)
+	}
+
+	MaxSize = 0
+	if _, err := ParseJSON([]byte(`"123456789"`)); err != nil {
+		t.Errorf("ParseJSON() with no limit: error = %v", err)
+	}
+}
+
+func TestParseLimitsDisabled(t *testing.T) {
+	defer func(depth, aliases int) { MaxDepth, MaxAliasExpansion = depth, aliases }(MaxDepth, MaxAliasExpansion)
+	MaxDepth, MaxAliasExpansion = 0, 0
+
+	if _, err := ParseJSON([]byte(strings.Repeat("[", 2000) + strings.Repeat("]", 2000))); err != nil {
+		t.Errorf("ParseJSON() error = %v", err)
+	}
+	aliases := []byte("base: &base {x: 1, y: [1, 2]}\nitems: [" + strings.Repeat("*base, ", 100) + "]\n")
+	if _, err := ParseYAML(aliases); err != nil {
+		t.Errorf("ParseYAML() error = %v", err)
+	}
+
+	MaxAliasExpansion = 100
+	if _, err := ParseYAML(aliases); !errors.Is(err, ErrLimit) {
+		t.Errorf("ParseYAML() with MaxAliasExpansion = 100: error = %v, want error wrapping ErrLimit", err)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	parse := func() (node *tree.Node, err error) {
+		defer guard(FormatJSON, nil, &node, &err)
+		node = tree.NewNull()
+		panic("boom")
+	}
+	node, err := parse()
+	if node != nil {
+		t.Errorf("node = %v, want nil", node)
+	}
+	var pe *ParseError
+	var panicErr *panicError
+	if !errors.As(err, &pe) || !errors.As(err, &panicErr) {
+		t.Fatalf("error = %#v, want *ParseError wrapping a panic", err)
+	}
+	if want := "failed to parse JSON: internal error: boom"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
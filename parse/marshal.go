@@ -0,0 +1,91 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pfrederiksen/configdiff/tree"
+	"gopkg.in/yaml.v3"
+)
+
+// Marshal serializes a normalized tree into the specified format.
+//
+// Output is canonical: object keys are sorted and indentation is fixed, so two
+// semantically equal trees always produce identical bytes.
+func Marshal(node *tree.Node, format Format) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		return MarshalYAML(node)
+	case FormatJSON:
+		return MarshalJSON(node)
+	case FormatTOML:
+		return MarshalTOML(node)
+	default:
+		return nil, fmt.Errorf("marshaling is not supported for format: %s", format)
+	}
+}
+
+// MarshalYAML serializes a tree to canonical YAML with two-space indentation.
+func MarshalYAML(node *tree.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(YAMLValue(node)); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// YAMLValue converts a tree to a plain Go value for a YAML encoder, as
+// ToInterface does, except that numbers kept as json.Number, e.g. integers
+// too large for a float64, become YAML numbers rather than quoted strings.
+func YAMLValue(node *tree.Node) interface{} {
+	return yamlValue(node.ToInterface())
+}
+
+func yamlValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(val.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: val.String()}
+	case map[string]interface{}:
+		for k, elem := range val {
+			val[k] = yamlValue(elem)
+		}
+	case []interface{}:
+		for i, elem := range val {
+			val[i] = yamlValue(elem)
+		}
+	}
+	return v
+}
+
+// MarshalJSON serializes a tree to canonical, indented JSON.
+func MarshalJSON(node *tree.Node) ([]byte, error) {
+	data, err := json.MarshalIndent(node.ToInterface(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// MarshalTOML serializes a tree to TOML. The root must be an object.
+func MarshalTOML(node *tree.Node) ([]byte, error) {
+	if node == nil || node.Kind != tree.KindObject {
+		return nil, fmt.Errorf("failed to marshal TOML: root must be an object")
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(node.ToInterface()); err != nil {
+		return nil, fmt.Errorf("failed to marshal TOML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,182 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	input := `{"name": "app", "replicas": 3, "ratio": 0.5, "tags": ["a", "b"], "meta": {"z": null, "a": true}}`
+
+	tests := []struct {
+		name    string
+		format  Format
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			want: `meta:
+  a: true
+  z: null
+name: app
+ratio: 0.5
+replicas: 3
+tags:
+  - a
+  - b
+`,
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			want: `{
+  "meta": {
+    "a": true,
+    "z": null
+  },
+  "name": "app",
+  "ratio": 0.5,
+  "replicas": 3,
+  "tags": [
+    "a",
+    "b"
+  ]
+}
+`,
+		},
+		{
+			name:    "hcl unsupported",
+			format:  FormatHCL,
+			wantErr: true,
+		},
+	}
+
+	node, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(node, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Marshal() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	input := "server:\n  host: localhost\n  ports: [80, 443]\nenabled: false\n"
+	node, err := ParseYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseYAML() error = %v", err)
+	}
+
+	for _, format := range []Format{FormatYAML, FormatJSON, FormatTOML} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := Marshal(node, format)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			back, err := Parse(data, format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v\n%s", err, data)
+			}
+			if !node.Equal(back) {
+				t.Errorf("round trip through %s changed the tree:\n%s", format, data)
+			}
+		})
+	}
+}
+
+func TestMarshal_Idempotent(t *testing.T) {
+	input := "b: 'quoted'\na:\n    script: |\n      echo one\n      echo two\n    ratio: 1.0\n    big: 1e3\n    empty: ~\n"
+
+	for _, format := range []Format{FormatYAML, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			node, err := ParseYAML([]byte(input))
+			if err != nil {
+				t.Fatalf("ParseYAML() error = %v", err)
+			}
+			first, err := Marshal(node, format)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			back, err := Parse(first, format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v\n%s", err, first)
+			}
+			second, err := Marshal(back, format)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(first) != string(second) {
+				t.Errorf("marshaling a marshaled document changed it:\n%s\n---\n%s", first, second)
+			}
+			if format == FormatYAML && !strings.Contains(string(first), "script: |\n    echo one\n    echo two\n") {
+				t.Errorf("multi-line string not written as a block scalar:\n%s", first)
+			}
+		})
+	}
+}
+
+func TestMarshalTOML_NonObjectRoot(t *testing.T) {
+	node, err := ParseJSON([]byte(`[1, 2]`))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	if _, err := MarshalTOML(node); err == nil {
+		t.Error("MarshalTOML() with array root expected error, got nil")
+	}
+}
+
+func TestMarshal_BigIntegers(t *testing.T) {
+	inputs := map[Format]string{
+		FormatJSON: `{"id": 9007199254740993, "neg": -9007199254740993, "small": 3}`,
+		FormatYAML: "id: 9007199254740993\nneg: -9007199254740993\nsmall: 3\n",
+		FormatTOML: "id = 9007199254740993\nneg = -9007199254740993\nsmall = 3\n",
+	}
+	for format, input := range inputs {
+		t.Run(string(format), func(t *testing.T) {
+			node, err := Parse([]byte(input), format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := node.Object["id"].NumberString(); got != "9007199254740993" {
+				t.Errorf("parsed id = %s, want 9007199254740993", got)
+			}
+			if got := node.Object["neg"].NumberString(); got != "-9007199254740993" {
+				t.Errorf("parsed neg = %s, want -9007199254740993", got)
+			}
+
+			for _, out := range []Format{FormatYAML, FormatJSON, FormatTOML} {
+				data, err := Marshal(node, out)
+				if err != nil {
+					t.Fatalf("Marshal(%s) error = %v", out, err)
+				}
+				if !strings.Contains(string(data), " 9007199254740993") || strings.Contains(string(data), `"9007199254740993"`) {
+					t.Errorf("Marshal(%s) did not write id as the number 9007199254740993:\n%s", out, data)
+				}
+				back, err := Parse(data, out)
+				if err != nil {
+					t.Fatalf("Parse() error = %v\n%s", err, data)
+				}
+				if !node.Equal(back) {
+					t.Errorf("round trip through %s changed the tree:\n%s", out, data)
+				}
+			}
+		})
+	}
+}
@@ -2,11 +2,21 @@
 package parse
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/pfrederiksen/configdiff/tree"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/gocty"
@@ -42,22 +52,76 @@ func Parse(data []byte, format Format) (*tree.Node, error) {
 	case FormatTOML:
 		return ParseTOML(data)
 	default:
-		return nil, fmt.Errorf("unsupported format: %s", format)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
 	}
 }
 
 // ParseYAML parses YAML data into a normalized tree.
-func ParseYAML(data []byte) (*tree.Node, error) {
+func ParseYAML(data []byte) (node *tree.Node, err error) {
+	defer guard(FormatYAML, data, &node, &err)
+	if err := checkSize(FormatYAML, data); err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, newParseError(FormatYAML, data, fmt.Errorf("failed to parse YAML: %w", err))
+	}
+	node, err = yamlToNode(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	setLines(node, &doc)
+	return node, nil
+}
+
+// ParseYAMLDocuments parses every document of a multi-document YAML stream
+// into its own normalized tree. ParseYAML reads only the first. A stream
+// without documents yields a single null tree, as ParseYAML does.
+func ParseYAMLDocuments(data []byte) (nodes []*tree.Node, err error) {
+	defer guard(FormatYAML, data, &nodes, &err)
+	if err := checkSize(FormatYAML, data); err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 1; ; i++ {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, newParseError(FormatYAML, data, fmt.Errorf("failed to parse YAML document %d: %w", i, err))
+		}
+		node, err := yamlToNode(data, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("YAML document %d: %w", i, err)
+		}
+		setLines(node, &doc)
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		nodes = append(nodes, tree.NewNull())
+	}
+	return nodes, nil
+}
+
+// yamlToNode converts the YAML document doc, parsed from data, to a tree
+// with canonical paths, once checkYAML has found that expanding its
+// aliases stays within the limits.
+func yamlToNode(data []byte, doc *yaml.Node) (*tree.Node, error) {
+	if err := checkYAML(doc); err != nil {
+		return nil, err
+	}
 	var v interface{}
-	if err := yaml.Unmarshal(data, &v); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	// An empty document is a zero node, which decodes to nothing
+	if doc.Kind != 0 {
+		if err := doc.Decode(&v); err != nil {
+			return nil, newParseError(FormatYAML, data, fmt.Errorf("failed to parse YAML: %w", err))
+		}
 	}
 
 	// YAML unmarshals into map[interface{}]interface{}, need to normalize
-	normalized := normalizeYAMLValue(v)
-	node, err := valueToNode(normalized)
+	node, err := valueToNode(normalizeYAMLValue(v), 0)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Format: FormatYAML, Err: err}
 	}
 
 	// Set canonical paths
@@ -66,32 +130,61 @@ func ParseYAML(data []byte) (*tree.Node, error) {
 }
 
 // ParseJSON parses JSON data into a normalized tree.
-func ParseJSON(data []byte) (*tree.Node, error) {
-	var v interface{}
-	if err := json.Unmarshal(data, &v); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+func ParseJSON(data []byte) (node *tree.Node, err error) {
+	defer guard(FormatJSON, data, &node, &err)
+	if err := checkSize(FormatJSON, data); err != nil {
+		return nil, err
+	}
+	v, err := decodeJSON(data)
+	if err != nil {
+		return nil, newParseError(FormatJSON, data, fmt.Errorf("failed to parse JSON: %w", err))
 	}
 
-	node, err := valueToNode(v)
+	node, err = valueToNode(v, 0)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Format: FormatJSON, Err: err}
 	}
 
 	// Set canonical paths
 	node.SetPaths("/")
+	annotateLines(node, data)
 	return node, nil
 }
 
+// decodeJSON decodes a JSON document with its numbers as json.Number, so
+// that valueToNode keeps integers too large for a float64 exact. Invalid
+// documents are decoded again by json.Unmarshal, for its error.
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err == nil && len(bytes.TrimLeft(data[dec.InputOffset():], " \t\r\n")) == 0 {
+		return v, nil
+	}
+	var check interface{}
+	if err := json.Unmarshal(data, &check); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
 // ParseTOML parses TOML data into a normalized tree.
-func ParseTOML(data []byte) (*tree.Node, error) {
+func ParseTOML(data []byte) (node *tree.Node, err error) {
+	defer guard(FormatTOML, data, &node, &err)
+	if err := checkSize(FormatTOML, data); err != nil {
+		return nil, err
+	}
+	if err := checkTOMLDepth(data); err != nil {
+		return nil, err
+	}
 	var v interface{}
 	if err := toml.Unmarshal(data, &v); err != nil {
-		return nil, fmt.Errorf("failed to parse TOML: %w", err)
+		return nil, newParseError(FormatTOML, data, fmt.Errorf("failed to parse TOML: %w", err))
 	}
 
-	node, err := valueToNode(v)
+	node, err = valueToNode(v, 0)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Format: FormatTOML, Err: err}
 	}
 
 	// Set canonical paths
@@ -100,24 +193,36 @@ func ParseTOML(data []byte) (*tree.Node, error) {
 }
 
 // ParseHCL parses HCL data into a normalized tree.
-func ParseHCL(data []byte) (*tree.Node, error) {
+func ParseHCL(data []byte) (node *tree.Node, err error) {
+	defer guard(FormatHCL, data, &node, &err)
+	if err := checkSize(FormatHCL, data); err != nil {
+		return nil, err
+	}
+	if err := checkHCLDepth(data); err != nil {
+		return nil, err
+	}
 	parser := hclparse.NewParser()
 	file, diags := parser.ParseHCL(data, "config.hcl")
 	if diags.HasErrors() {
-		return nil, fmt.Errorf("failed to parse HCL: %s", diags.Error())
+		return nil, newParseError(FormatHCL, data, fmt.Errorf("failed to parse HCL: %w", diags))
 	}
 
 	// Extract attributes into a map
 	attrs, diags := file.Body.JustAttributes()
 	if diags.HasErrors() {
-		return nil, fmt.Errorf("failed to extract HCL attributes: %s", diags.Error())
+		return nil, newParseError(FormatHCL, data, fmt.Errorf("failed to extract HCL attributes: %w", diags))
 	}
 
+	// Attributes are evaluated in the order of the document, so that an
+	// error is reported for the first that fails
+	names := slices.SortedFunc(maps.Keys(attrs), func(a, b string) int {
+		return attrs[a].Range.Start.Byte - attrs[b].Range.Start.Byte
+	})
 	result := make(map[string]interface{})
-	for name, attr := range attrs {
-		val, diags := attr.Expr.Value(nil)
+	for _, name := range names {
+		val, diags := attrs[name].Expr.Value(nil)
 		if diags.HasErrors() {
-			return nil, fmt.Errorf("failed to evaluate HCL attribute %q: %s", name, diags.Error())
+			return nil, newParseError(FormatHCL, data, fmt.Errorf("failed to evaluate HCL attribute %q: %w", name, diags))
 		}
 
 		goVal, err := ctyToGo(val)
@@ -127,9 +232,9 @@ func ParseHCL(data []byte) (*tree.Node, error) {
 		result[name] = goVal
 	}
 
-	node, err := valueToNode(result)
+	node, err = valueToNode(result, 0)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Format: FormatHCL, Err: err}
 	}
 
 	// Set canonical paths
@@ -198,6 +303,64 @@ func ctyToGo(val cty.Value) (interface{}, error) {
 	}
 }
 
+// annotateLines records source line numbers on node, which was parsed from
+// data. JSON is valid YAML, so both formats share the YAML node parser.
+// This is best-effort: if data cannot be re-read as YAML, lines stay 0.
+func annotateLines(node *tree.Node, data []byte) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return
+	}
+	setLines(node, &doc)
+}
+
+// setLines copies line numbers from the YAML node yn onto node, walking both
+// trees in step. Keys without a counterpart in node (such as merge keys) are
+// skipped.
+func setLines(node *tree.Node, yn *yaml.Node) {
+	if node == nil || yn == nil {
+		return
+	}
+
+	switch yn.Kind {
+	case yaml.DocumentNode:
+		if len(yn.Content) > 0 {
+			setLines(node, yn.Content[0])
+		}
+		return
+	case yaml.AliasNode:
+		node.Line = yn.Line
+		if yn.Alias != nil {
+			line := node.Line
+			setLines(node, yn.Alias)
+			node.Line = line
+		}
+		return
+	}
+
+	node.Line = yn.Line
+
+	switch {
+	case yn.Kind == yaml.MappingNode && node.Kind == tree.KindObject:
+		for i := 0; i+1 < len(yn.Content); i += 2 {
+			key, value := yn.Content[i], yn.Content[i+1]
+			child, ok := node.Object[key.Value]
+			if !ok {
+				continue
+			}
+			setLines(child, value)
+			// Point at the key, not the first line of a nested block
+			child.Line = key.Line
+		}
+	case yn.Kind == yaml.SequenceNode && node.Kind == tree.KindArray:
+		for i, elem := range yn.Content {
+			if i < len(node.Array) {
+				setLines(node.Array[i], elem)
+			}
+		}
+	}
+}
+
 // normalizeYAMLValue converts YAML's map[interface{}]interface{} to map[string]interface{}
 // for consistent handling with JSON.
 func normalizeYAMLValue(v interface{}) interface{} {
@@ -209,6 +372,12 @@ func normalizeYAMLValue(v interface{}) interface{} {
 			normalized[keyStr] = normalizeYAMLValue(v)
 		}
 		return normalized
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			normalized[k] = normalizeYAMLValue(v)
+		}
+		return normalized
 	case []interface{}:
 		normalized := make([]interface{}, len(val))
 		for i, item := range val {
@@ -220,8 +389,13 @@ func normalizeYAMLValue(v interface{}) interface{} {
 	}
 }
 
-// valueToNode converts a Go value to a tree.Node.
-func valueToNode(v interface{}) (*tree.Node, error) {
+// valueToNode converts a Go value, nested depth levels deep in its document,
+// to a tree.Node. It returns an error wrapping ErrLimit for values that
+// nest more than MaxDepth levels deep.
+func valueToNode(v interface{}, depth int) (*tree.Node, error) {
+	if MaxDepth > 0 && depth > MaxDepth {
+		return nil, fmt.Errorf("%w: nested more than %d levels deep", ErrLimit, MaxDepth)
+	}
 	if v == nil {
 		return tree.NewNull(), nil
 	}
@@ -231,7 +405,7 @@ func valueToNode(v interface{}) (*tree.Node, error) {
 		return tree.NewBool(val), nil
 
 	case int:
-		return tree.NewNumber(float64(val)), nil
+		return valueToNode(int64(val), depth)
 	case int8:
 		return tree.NewNumber(float64(val)), nil
 	case int16:
@@ -239,9 +413,14 @@ func valueToNode(v interface{}) (*tree.Node, error) {
 	case int32:
 		return tree.NewNumber(float64(val)), nil
 	case int64:
+		// Integers beyond tree.MaxExactInt are kept as json.Number, so they
+		// are not rounded
+		if val > tree.MaxExactInt || val < -tree.MaxExactInt {
+			return &tree.Node{Kind: tree.KindNumber, Value: json.Number(strconv.FormatInt(val, 10))}, nil
+		}
 		return tree.NewNumber(float64(val)), nil
 	case uint:
-		return tree.NewNumber(float64(val)), nil
+		return valueToNode(uint64(val), depth)
 	case uint8:
 		return tree.NewNumber(float64(val)), nil
 	case uint16:
@@ -249,19 +428,33 @@ func valueToNode(v interface{}) (*tree.Node, error) {
 	case uint32:
 		return tree.NewNumber(float64(val)), nil
 	case uint64:
+		if val > tree.MaxExactInt {
+			return &tree.Node{Kind: tree.KindNumber, Value: json.Number(strconv.FormatUint(val, 10))}, nil
+		}
 		return tree.NewNumber(float64(val)), nil
 	case float32:
 		return tree.NewNumber(float64(val)), nil
 	case float64:
 		return tree.NewNumber(val), nil
+	case json.Number:
+		f, err := val.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s: %w", val, err)
+		}
+		// An integer a float64 rounds, e.g. 9007199254740993 to 2^53
+		if s := val.String(); !strings.ContainsAny(s, ".eE") && strconv.FormatFloat(f, 'f', -1, 64) != s {
+			return &tree.Node{Kind: tree.KindNumber, Value: val}, nil
+		}
+		return tree.NewNumber(f), nil
 
 	case string:
 		return tree.NewString(val), nil
 
 	case map[string]interface{}:
 		obj := make(map[string]*tree.Node)
-		for k, v := range val {
-			node, err := valueToNode(v)
+		// In key order, so that an error is the same from run to run
+		for _, k := range slices.Sorted(maps.Keys(val)) {
+			node, err := valueToNode(val[k], depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -272,7 +465,7 @@ func valueToNode(v interface{}) (*tree.Node, error) {
 	case []interface{}:
 		arr := make([]*tree.Node, len(val))
 		for i, item := range val {
-			node, err := valueToNode(item)
+			node, err := valueToNode(item, depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -284,7 +477,7 @@ func valueToNode(v interface{}) (*tree.Node, error) {
 		// TOML array of tables
 		arr := make([]*tree.Node, len(val))
 		for i, item := range val {
-			node, err := valueToNode(item)
+			node, err := valueToNode(item, depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -297,26 +490,114 @@ func valueToNode(v interface{}) (*tree.Node, error) {
 	}
 }
 
-// DetectFormat attempts to detect the format based on content.
-// Returns the detected format or an error if detection fails.
-func DetectFormat(data []byte) (Format, error) {
-	// Try JSON first (stricter format)
-	var jsonVal interface{}
-	if err := json.Unmarshal(data, &jsonVal); err == nil {
-		return FormatJSON, nil
+// DetectFileFormat returns the format of a file from its extension, or
+// from its content if the extension is not a known one. Content is JSON if
+// it is a JSON object or array, or starts with "{"; TOML or HCL if it has
+// their assignments, [table] headers, or blocks and parses as them, trying
+// TOML first; and YAML if it parses as a YAML mapping or sequence. INI
+// files are read as TOML when TOML can read them. It returns "" rather
+// than guess if none of these identifies the format, e.g. for prose or a
+// single YAML scalar.
+func DetectFileFormat(path string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".hcl", ".tf":
+		return FormatHCL
+	case ".toml":
+		return FormatTOML
 	}
 
-	// Try TOML
-	var tomlVal interface{}
-	if err := toml.Unmarshal(data, &tomlVal); err == nil {
-		return FormatTOML, nil
+	trimmed := bytes.TrimLeft(data, " \t\n\r")
+	if len(trimmed) == 0 {
+		return ""
+	}
+	// A "[" may also start a TOML table header, so only a valid array is
+	// taken to be JSON
+	if trimmed[0] == '{' || json.Valid(trimmed) {
+		return FormatJSON
+	}
+	if hasAssignments(data) {
+		if _, err := ParseTOML(data); err == nil {
+			return FormatTOML
+		}
+		if isHCL(data) {
+			return FormatHCL
+		}
+	}
+	if trimmed[0] == '[' {
+		line, rest, _ := bytes.Cut(trimmed, []byte("\n"))
+		if tableHeader.Match(bytes.TrimSpace(line)) && len(bytes.TrimSpace(rest)) > 0 {
+			// A section header TOML could not read; YAML would take it for a
+			// flow sequence and drop the lines after it
+			return ""
+		}
 	}
+	if isCollection(data) {
+		return FormatYAML
+	}
+	if trimmed[0] == '[' {
+		// Report it as the broken JSON array it looks like
+		return FormatJSON
+	}
+	return ""
+}
 
-	// Try YAML (most permissive)
-	var yamlVal interface{}
-	if err := yaml.Unmarshal(data, &yamlVal); err == nil {
-		return FormatYAML, nil
+var (
+	// tableHeader matches a TOML table or INI section header line
+	tableHeader = regexp.MustCompile(`^\[\[?[^\[\]]+\]\]?$`)
+	// assignment matches a TOML, HCL, or INI key = value line
+	assignment = regexp.MustCompile(`^"?[A-Za-z_][\w.-]*"?\s*=($|[^=])`)
+	// blockStart matches the first line of an HCL block, e.g.
+	// resource "aws_instance" "web" {
+	blockStart = regexp.MustCompile(`^[A-Za-z_][\w-]*(\s+("[^"]*"|[A-Za-z_][\w-]*))*\s*\{$`)
+)
+
+// isCollection reports whether data is YAML whose first document is a
+// mapping or sequence; plain text parses as a YAML scalar.
+func isCollection(data []byte) bool {
+	node, err := ParseYAML(data)
+	return err == nil && (node.Kind == tree.KindObject || node.Kind == tree.KindArray)
+}
+
+// hasAssignments reports whether a line of data, ignoring comments, is a
+// key = value assignment, a table header, or the start of an HCL block.
+func hasAssignments(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' || bytes.HasPrefix(line, []byte("//")) {
+			continue
+		}
+		if tableHeader.Match(line) || assignment.Match(line) || blockStart.Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHCL reports whether data is HCL: syntactically valid with blocks, or
+// attributes that ParseHCL can evaluate. Unquoted "key = value" lines, as
+// in .properties files, are valid syntax but not values.
+func isHCL(data []byte) bool {
+	file, diags := hclparse.NewParser().ParseHCL(data, "config.hcl")
+	if diags.HasErrors() {
+		return false
+	}
+	if body, ok := file.Body.(*hclsyntax.Body); ok && len(body.Blocks) > 0 {
+		return true
 	}
+	_, err := ParseHCL(data)
+	return err == nil
+}
 
+// DetectFormat detects the format of data from its content, as
+// DetectFileFormat does for a file without a known extension.
+// Returns the detected format or an error if detection fails.
+func DetectFormat(data []byte) (Format, error) {
+	if format := DetectFileFormat("", data); format != "" {
+		return format, nil
+	}
 	return "", fmt.Errorf("unable to detect format")
 }
@@ -1,7 +1,10 @@
 package parse
 
 import (
+	"encoding/json"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/pfrederiksen/configdiff/tree"
@@ -548,7 +551,7 @@ func TestValueToNode_AllTypes(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			node, err := valueToNode(tt.value)
+			node, err := valueToNode(tt.value, 0)
 			if tt.wantErr {
 				if err == nil {
 					t.Error("valueToNode() expected error, got nil")
@@ -612,6 +615,16 @@ func TestNormalizeYAMLValue(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:  "non-string keys below string keys",
+			input: map[string]interface{}{"ports": map[interface{}]interface{}{80: "http"}},
+			check: func(t *testing.T, v interface{}) {
+				ports := v.(map[string]interface{})["ports"].(map[string]interface{})
+				if ports["80"] != "http" {
+					t.Errorf("ports = %v, want 80: http", ports)
+				}
+			},
+		},
 		{
 			name:  "passthrough scalar",
 			input: "string",
@@ -881,6 +894,17 @@ enabled = true`,
 	}
 }
 
+func TestParseHCL_FirstErrorInDocumentOrder(t *testing.T) {
+	// Of several attributes that fail, the first in the document is reported
+	input := "zone = var.zone\nname = \"app\"\nanimal = local.animal\n"
+	for i := 0; i < 20; i++ {
+		_, err := ParseHCL([]byte(input))
+		if err == nil || !strings.Contains(err.Error(), `attribute "zone"`) {
+			t.Fatalf("ParseHCL() error = %v, want one for attribute \"zone\"", err)
+		}
+	}
+}
+
 // Integration tests using testdata files
 func TestParseHCL_Integration(t *testing.T) {
 	tests := []struct {
@@ -1121,3 +1145,140 @@ tokio = { version = "1.0", features = ["full"] }`,
 		})
 	}
 }
+
+func TestParse_LineNumbers(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		parse func([]byte) (*tree.Node, error)
+		want  map[string]int
+	}{
+		{
+			name:  "yaml",
+			input: "name: app\nspec:\n  replicas: 3\n  ports:\n    - 80\n    - name: https\n      port: 443\n",
+			parse: ParseYAML,
+			want: map[string]int{
+				"/name":               1,
+				"/spec":               2,
+				"/spec/replicas":      3,
+				"/spec/ports":         4,
+				"/spec/ports[0]":      5,
+				"/spec/ports[1]":      6,
+				"/spec/ports[1]/port": 7,
+			},
+		},
+		{
+			name:  "yaml alias",
+			input: "base: &base\n  image: nginx\ncopy: *base\n",
+			parse: ParseYAML,
+			want: map[string]int{
+				"/base":       1,
+				"/base/image": 2,
+				"/copy":       3,
+			},
+		},
+		{
+			name:  "json",
+			input: "{\n  \"name\": \"app\",\n  \"spec\": {\n    \"replicas\": 3\n  },\n  \"tags\": [\"a\",\n    \"b\"]\n}\n",
+			parse: ParseJSON,
+			want: map[string]int{
+				"/name":          2,
+				"/spec":          3,
+				"/spec/replicas": 4,
+				"/tags[1]":       7,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := tt.parse([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("parse error = %v", err)
+			}
+			for path, want := range tt.want {
+				node := root.GetByPath(path)
+				if node == nil {
+					t.Fatalf("no node at %s", path)
+				}
+				if node.Line != want {
+					t.Errorf("%s: Line = %d, want %d", path, node.Line, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseYAMLDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{"single document", "a: 1\n", []string{`{"a":1}`}, false},
+		{"multiple documents", "a: 1\n---\nb: 2\n---\n- x\n", []string{`{"a":1}`, `{"b":2}`, `["x"]`}, false},
+		{"non-string keys", "ports:\n  80: http\n", []string{`{"ports":{"80":"http"}}`}, false},
+		{"empty", "", []string{"null"}, false},
+		{"invalid second document", "a: 1\n---\nb: [\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := ParseYAMLDocuments([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseYAMLDocuments() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, node := range nodes {
+				data, err := json.Marshal(node.ToInterface())
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, string(data))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseYAMLDocuments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	nodes, err := ParseYAMLDocuments([]byte("a: 1\n---\nb:\n  c: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := nodes[1].GetByPath("/b/c"); c == nil || c.Line != 4 {
+		t.Errorf("/b/c of document 2 = %+v, want line 4", c)
+	}
+}
+
+func TestDetectFileFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		data string
+		want Format
+	}{
+		{"app.yml", "{}", FormatYAML},
+		{"main.tf", "", FormatHCL},
+		{"Cargo.TOML", "", FormatTOML},
+		{"config", `  {"a": 1}`, FormatJSON},
+		{"config.txt", "a: 1\n", FormatYAML},
+		{"", "a: [\n", ""},
+		{"", " \n", ""},
+		{"", "[1, 2]", FormatJSON},
+		{"", "[server]\nport = 8080\n", FormatTOML},
+		{"", "name = \"app\"\n", FormatTOML},
+		{"", "resource \"a\" \"b\" {\n  x = 1\n}\n", FormatHCL},
+		{"", "locals {\n  port = 8080\n}\n", FormatHCL},
+		{"", "run: |\n  FOO=bar\n", FormatYAML},
+		{"", "just a word", ""},
+		{"", "key=value\n", ""},
+		{"", "[section]\nkey=value\n", ""},
+		{"", "- a\n- b\n", FormatYAML},
+	}
+	for _, tt := range tests {
+		if got := DetectFileFormat(tt.path, []byte(tt.data)); got != tt.want {
+			t.Errorf("DetectFileFormat(%q, %q) = %q, want %q", tt.path, tt.data, got, tt.want)
+		}
+	}
+}
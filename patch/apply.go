@@ -0,0 +1,466 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/tree"
+	"gopkg.in/yaml.v3"
+)
+
+// ConflictError describes a patch operation that does not apply to the target.
+type ConflictError struct {
+	// Index is the position of the operation in the patch.
+	Index int
+
+	// Op and Path identify the operation.
+	Op   string
+	Path string
+
+	// Reason explains why the operation does not apply.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Reason)
+}
+
+// FromYAML deserializes a patch from YAML with the same shape as FromJSON.
+func FromYAML(data []byte) (*Patch, error) {
+	var p Patch
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal patch: %w", err)
+	}
+	return &p, nil
+}
+
+// UnmarshalYAML decodes an operation using its JSON field names.
+func (o *Operation) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Op    string      `yaml:"op"`
+		Path  string      `yaml:"path"`
+		Value interface{} `yaml:"value"`
+		From  string      `yaml:"from"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	*o = Operation{Op: raw.Op, Path: raw.Path, Value: raw.Value, From: raw.From}
+	return nil
+}
+
+// Apply applies the operations of p in order to a copy of target and
+// returns the result. It fails on the first operation that does not apply;
+// Check reports all of them.
+//
+// Paths use the diff engine's syntax: "/spec/containers[0]/image" for
+// positional array elements and "/spec/containers[name=web]/image" for
+// elements of arrays keyed by a field. Removing a positional element leaves
+// the indices of the others unchanged until the whole patch is applied, so
+// the indices of a patch built by FromChanges always refer to the document
+// it was computed from.
+func Apply(target *tree.Node, p Patch) (*tree.Node, error) {
+	a := &applier{root: target.Clone()}
+	for i, op := range p.Operations {
+		if err := a.apply(i, op); err != nil {
+			return nil, err
+		}
+	}
+	return a.result(), nil
+}
+
+// Check reports every operation of p that does not apply cleanly to target,
+// without modifying it: adds of paths that exist with a different value,
+// removals and replacements of missing paths, and failed tests. Operations
+// that fail are skipped so that later ones are checked against the document
+// the rest of the patch produces. A nil slice means Apply would succeed.
+func Check(target *tree.Node, p Patch) []error {
+	a := &applier{root: target.Clone()}
+	var errs []error
+	for i, op := range p.Operations {
+		if err := a.apply(i, op); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// applier holds the document while a patch is applied to it.
+type applier struct {
+	root *tree.Node
+}
+
+// result compacts arrays with removed elements and sets canonical paths.
+func (a *applier) result() *tree.Node {
+	compact(a.root)
+	a.root.SetPaths("/")
+	return a.root
+}
+
+// compact drops the holes left in arrays by removed elements.
+func compact(n *tree.Node) {
+	if n == nil {
+		return
+	}
+	switch n.Kind {
+	case tree.KindObject:
+		for _, v := range n.Object {
+			compact(v)
+		}
+	case tree.KindArray:
+		elems := n.Array[:0]
+		for _, elem := range n.Array {
+			if elem != nil {
+				compact(elem)
+				elems = append(elems, elem)
+			}
+		}
+		n.Array = elems
+	}
+}
+
+// apply applies a single operation, returning a *ConflictError if it does not apply.
+func (a *applier) apply(index int, op Operation) error {
+	conflict := func(format string, args ...interface{}) error {
+		return &ConflictError{Index: index, Op: op.Op, Path: op.Path, Reason: fmt.Sprintf(format, args...)}
+	}
+	if err := op.Validate(); err != nil {
+		return conflict("%v", err)
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := valueToNode(op.Value)
+		if err != nil {
+			return conflict("%v", err)
+		}
+		current, err := a.get(op.Path)
+		if err != nil {
+			return conflict("%v", err)
+		}
+		switch {
+		case op.Op == "test" && !value.Equal(current):
+			return conflict("value does not match")
+		case op.Op == "test":
+			return nil
+		case op.Op == "add" && current != nil && !isPositional(op.Path):
+			if !current.Equal(value) {
+				return conflict("path already exists with a different value")
+			}
+			// Already applied
+			return nil
+		case op.Op == "replace" && current == nil:
+			return conflict("path does not exist")
+		}
+		if err := a.set(op.Path, value, op.Op == "add"); err != nil {
+			return conflict("%v", err)
+		}
+
+	case "remove":
+		if err := a.remove(op.Path); err != nil {
+			return conflict("%v", err)
+		}
+
+	case "move", "copy":
+		value, err := a.get(op.From)
+		if err != nil {
+			return conflict("%v", err)
+		}
+		if value == nil {
+			return conflict("from path %s does not exist", op.From)
+		}
+		if op.Op == "move" {
+			if err := a.remove(op.From); err != nil {
+				return conflict("%v", err)
+			}
+		}
+		if err := a.set(op.Path, value.Clone(), true); err != nil {
+			return conflict("%v", err)
+		}
+	}
+
+	return nil
+}
+
+// step is one navigation step of a path: an object key, an array index, or
+// the array element whose field equals a value.
+type step struct {
+	key   string
+	index int
+	field string
+	value string
+	kind  byte // 'k' key, 'i' index, 'm' match
+}
+
+// parsePath splits a path into navigation steps.
+func parsePath(path string) ([]step, error) {
+	var steps []step
+	for _, segment := range tree.ParsePath(path) {
+		open := strings.Index(segment, "[")
+		if open == -1 {
+			steps = append(steps, step{kind: 'k', key: segment})
+			continue
+		}
+		if open > 0 {
+			steps = append(steps, step{kind: 'k', key: segment[:open]})
+		}
+		for rest := segment[open:]; rest != ""; {
+			end := strings.Index(rest, "]")
+			if rest[0] != '[' || end == -1 {
+				return nil, fmt.Errorf("invalid path segment %q", segment)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if field, value, ok := strings.Cut(inner, "="); ok {
+				steps = append(steps, step{kind: 'm', field: field, value: value})
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid array index in path segment %q", segment)
+			}
+			steps = append(steps, step{kind: 'i', index: idx})
+		}
+	}
+	return steps, nil
+}
+
+// isPositional reports whether path ends in a positional array index.
+func isPositional(path string) bool {
+	steps, err := parsePath(path)
+	return err == nil && len(steps) > 0 && steps[len(steps)-1].kind == 'i'
+}
+
+// child returns the child of n at s, or nil if it does not exist.
+func child(n *tree.Node, s step) *tree.Node {
+	if n == nil {
+		return nil
+	}
+	switch s.kind {
+	case 'k':
+		if n.Kind == tree.KindObject {
+			return n.Object[s.key]
+		}
+	case 'i':
+		if n.Kind == tree.KindArray && s.index < len(n.Array) {
+			return n.Array[s.index]
+		}
+	case 'm':
+		if i := matchIndex(n, s); i >= 0 {
+			return n.Array[i]
+		}
+	}
+	return nil
+}
+
+// matchIndex returns the index of the element of array n whose field equals
+// the step's value, a string or a number in its shortest form, or -1.
+func matchIndex(n *tree.Node, s step) int {
+	if n.Kind != tree.KindArray {
+		return -1
+	}
+	for i, elem := range n.Array {
+		if elem == nil || elem.Kind != tree.KindObject {
+			continue
+		}
+		key, ok := elem.Object[s.field]
+		if !ok {
+			continue
+		}
+		switch key.Kind {
+		case tree.KindString:
+			if key.Value == s.value {
+				return i
+			}
+		case tree.KindNumber:
+			if key.NumberString() == s.value {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// errNoParent reports a path whose parent does not exist.
+var errNoParent = errors.New("parent does not exist")
+
+// parent resolves every step but the last, returning the container and the
+// final step. An empty step list means the root itself.
+func (a *applier) parent(path string) (*tree.Node, *step, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(steps) == 0 {
+		return nil, nil, nil
+	}
+	n := a.root
+	for _, s := range steps[:len(steps)-1] {
+		if n = child(n, s); n == nil {
+			return nil, nil, fmt.Errorf("%w: %s", errNoParent, path)
+		}
+	}
+	return n, &steps[len(steps)-1], nil
+}
+
+// get returns the node at path, or nil if it does not exist.
+func (a *applier) get(path string) (*tree.Node, error) {
+	parent, last, err := a.parent(path)
+	if errors.Is(err, errNoParent) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return a.root, nil
+	}
+	return child(parent, *last), nil
+}
+
+// set adds or replaces the node at path. An index at or past the end of an
+// array extends it, and an index of a removed element fills its place; any
+// other index replaces the existing element, or with insert, inserts before it.
+func (a *applier) set(path string, value *tree.Node, insert bool) error {
+	parent, last, err := a.parent(path)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		a.root = value
+		return nil
+	}
+
+	switch last.kind {
+	case 'k':
+		if parent.Kind != tree.KindObject {
+			return fmt.Errorf("cannot set key %q in %s", last.key, parent.Kind)
+		}
+		if parent.Object == nil {
+			parent.Object = make(map[string]*tree.Node)
+		}
+		parent.Object[last.key] = value
+	case 'i':
+		if parent.Kind != tree.KindArray {
+			return fmt.Errorf("cannot index %s", parent.Kind)
+		}
+		switch {
+		case last.index >= len(parent.Array):
+			for len(parent.Array) < last.index {
+				parent.Array = append(parent.Array, nil)
+			}
+			parent.Array = append(parent.Array, value)
+		case parent.Array[last.index] == nil || !insert:
+			parent.Array[last.index] = value
+		default:
+			parent.Array = append(parent.Array[:last.index], append([]*tree.Node{value}, parent.Array[last.index:]...)...)
+		}
+	case 'm':
+		if parent.Kind != tree.KindArray {
+			return fmt.Errorf("cannot match %s=%s in %s", last.field, last.value, parent.Kind)
+		}
+		if i := matchIndex(parent, *last); i >= 0 {
+			parent.Array[i] = value
+		} else {
+			parent.Array = append(parent.Array, value)
+		}
+	}
+	return nil
+}
+
+// remove deletes the node at path, leaving a hole in positional arrays.
+func (a *applier) remove(path string) error {
+	parent, last, err := a.parent(path)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		return fmt.Errorf("cannot remove the root")
+	}
+	if child(parent, *last) == nil {
+		return fmt.Errorf("path does not exist")
+	}
+
+	switch last.kind {
+	case 'k':
+		delete(parent.Object, last.key)
+	case 'i':
+		parent.Array[last.index] = nil
+	case 'm':
+		parent.Array[matchIndex(parent, *last)] = nil
+	}
+	return nil
+}
+
+// valueToNode converts an operation value, as decoded by FromJSON or
+// FromYAML, to a tree node. Numbers become float64 unless they are integers
+// too large to represent exactly, which keep their json.Number.
+func valueToNode(v interface{}) (*tree.Node, error) {
+	switch val := v.(type) {
+	case nil:
+		return tree.NewNull(), nil
+	case bool:
+		return tree.NewBool(val), nil
+	case string:
+		return tree.NewString(val), nil
+	case int:
+		return tree.NewNumber(float64(val)), nil
+	case int64:
+		return tree.NewNumber(float64(val)), nil
+	case uint64:
+		return tree.NewNumber(float64(val)), nil
+	case float64:
+		return tree.NewNumber(val), nil
+	case json.Number:
+		f, err := val.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s: %w", val, err)
+		}
+		// An integer a float64 rounds, e.g. 9007199254740993 to 2^53
+		if s := val.String(); !strings.ContainsAny(s, ".eE") && strconv.FormatFloat(f, 'f', -1, 64) != s {
+			return &tree.Node{Kind: tree.KindNumber, Value: val}, nil
+		}
+		return tree.NewNumber(f), nil
+	case map[string]interface{}:
+		obj := make(map[string]*tree.Node, len(val))
+		// In key order, so that an error is the same from run to run
+		for _, k := range slices.Sorted(maps.Keys(val)) {
+			node, err := valueToNode(val[k])
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = node
+		}
+		return tree.NewObject(obj), nil
+	case []interface{}:
+		arr := make([]*tree.Node, len(val))
+		for i, item := range val {
+			node, err := valueToNode(item)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = node
+		}
+		return tree.NewArray(arr), nil
+	default:
+		// Anything else, e.g. a Go struct in a hand-built patch, goes through JSON
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported value type %T", v)
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var decoded interface{}
+		if err := dec.Decode(&decoded); err != nil {
+			return nil, fmt.Errorf("unsupported value type %T", v)
+		}
+		return valueToNode(decoded)
+	}
+}
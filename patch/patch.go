@@ -5,6 +5,7 @@
 package patch
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -33,6 +34,23 @@ type Operation struct {
 	From string `json:"from,omitempty"`
 }
 
+// MarshalJSON encodes the operation as RFC 6902 requires: the value of an
+// add, replace, or test operation is always present, even when it is null,
+// and is left out of the others when empty.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	switch o.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			Op    string      `json:"op"`
+			Path  string      `json:"path"`
+			Value interface{} `json:"value"`
+			From  string      `json:"from,omitempty"`
+		}{o.Op, o.Path, o.Value, o.From})
+	}
+	type operation Operation
+	return json.Marshal(operation(o))
+}
+
 // FromChanges converts a list of changes into a patch.
 func FromChanges(changes []diff.Change) (*Patch, error) {
 	ops := make([]Operation, 0, len(changes))
@@ -93,40 +111,16 @@ func changeToOperation(change diff.Change) (Operation, error) {
 }
 
 // nodeToValue converts a tree node to a plain Go value for JSON serialization.
+// Integer/float distinction, large integers, and nulls are preserved by
+// tree.Node.ToInterface.
 func nodeToValue(node *tree.Node) (interface{}, error) {
 	if node == nil {
 		return nil, nil
 	}
 
 	switch node.Kind {
-	case tree.KindNull:
-		return nil, nil
-
-	case tree.KindBool, tree.KindNumber, tree.KindString:
-		return node.Value, nil
-
-	case tree.KindObject:
-		result := make(map[string]interface{})
-		for k, v := range node.Object {
-			value, err := nodeToValue(v)
-			if err != nil {
-				return nil, err
-			}
-			result[k] = value
-		}
-		return result, nil
-
-	case tree.KindArray:
-		result := make([]interface{}, len(node.Array))
-		for i, elem := range node.Array {
-			value, err := nodeToValue(elem)
-			if err != nil {
-				return nil, err
-			}
-			result[i] = value
-		}
-		return result, nil
-
+	case tree.KindNull, tree.KindBool, tree.KindNumber, tree.KindString, tree.KindObject, tree.KindArray:
+		return node.ToInterface(), nil
 	default:
 		return nil, fmt.Errorf("unknown node kind: %v", node.Kind)
 	}
@@ -143,9 +137,13 @@ func (p *Patch) ToJSONIndent() ([]byte, error) {
 }
 
 // FromJSON deserializes a patch from JSON.
+// Numeric values are decoded as json.Number so that large integers survive
+// a round trip without float64 precision loss.
 func FromJSON(data []byte) (*Patch, error) {
 	var p Patch
-	if err := json.Unmarshal(data, &p); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&p); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal patch: %w", err)
 	}
 	return &p, nil
@@ -180,6 +178,68 @@ func (p *Patch) Validate() error {
 	return nil
 }
 
+// PolicyError describes a patch operation that violates an allow/deny path policy.
+type PolicyError struct {
+	// Index is the position of the offending operation in the patch.
+	Index int
+
+	// Path is the operation path that violated the policy.
+	Path string
+
+	// Pattern is the deny pattern that matched, empty if no allow pattern matched.
+	Pattern string
+}
+
+// Error implements the error interface.
+func (e *PolicyError) Error() string {
+	if e.Pattern != "" {
+		return fmt.Sprintf("operation %d: path %s is denied by %s", e.Index, e.Path, e.Pattern)
+	}
+	return fmt.Sprintf("operation %d: path %s is not in the allowed paths", e.Index, e.Path)
+}
+
+// Validate checks every operation of p against allow and deny path patterns.
+//
+// Patterns use the same glob syntax as ignore paths (see diff.MatchPath).
+// When allow is non-empty an operation must match at least one allow pattern;
+// an operation matching any deny pattern is always rejected. For move and copy
+// operations the from path is checked as well. One *PolicyError is returned
+// per violating operation; a nil slice means the patch is permitted.
+func Validate(p Patch, allow []string, deny []string) []error {
+	var errs []error
+	for i, op := range p.Operations {
+		paths := []string{op.Path}
+		if op.From != "" {
+			paths = append(paths, op.From)
+		}
+		for _, path := range paths {
+			if err := checkPolicy(i, path, allow, deny); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// checkPolicy returns a *PolicyError if path violates the allow/deny patterns.
+func checkPolicy(index int, path string, allow, deny []string) error {
+	for _, pattern := range deny {
+		if diff.MatchPath(path, pattern) {
+			return &PolicyError{Index: index, Path: path, Pattern: pattern}
+		}
+	}
+	if len(allow) == 0 {
+		return nil
+	}
+	for _, pattern := range allow {
+		if diff.MatchPath(path, pattern) {
+			return nil
+		}
+	}
+	return &PolicyError{Index: index, Path: path}
+}
+
 // Validate checks if an operation is valid.
 func (o *Operation) Validate() error {
 	// Check operation type
@@ -2,9 +2,11 @@ package patch
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/parse"
 	"github.com/pfrederiksen/configdiff/tree"
 )
 
@@ -222,6 +224,146 @@ func TestNodeToValue(t *testing.T) {
 	}
 }
 
+func TestOperation_MarshalValueKinds(t *testing.T) {
+	tests := []struct {
+		name string
+		node *tree.Node
+		want string
+	}{
+		{
+			name: "null",
+			node: tree.NewNull(),
+			want: `{"op":"add","path":"/x","value":null}`,
+		},
+		{
+			name: "bool",
+			node: tree.NewBool(false),
+			want: `{"op":"add","path":"/x","value":false}`,
+		},
+		{
+			name: "integer",
+			node: tree.NewNumber(3),
+			want: `{"op":"add","path":"/x","value":3}`,
+		},
+		{
+			name: "float",
+			node: tree.NewNumber(2.5),
+			want: `{"op":"add","path":"/x","value":2.5}`,
+		},
+		{
+			name: "string",
+			node: tree.NewString("v"),
+			want: `{"op":"add","path":"/x","value":"v"}`,
+		},
+		{
+			name: "object",
+			node: tree.NewObject(map[string]*tree.Node{
+				"b": tree.NewNumber(1),
+				"a": tree.NewNull(),
+			}),
+			want: `{"op":"add","path":"/x","value":{"a":null,"b":1}}`,
+		},
+		{
+			name: "array",
+			node: tree.NewArray([]*tree.Node{
+				tree.NewNumber(1),
+				tree.NewNumber(1.5),
+				tree.NewString("s"),
+			}),
+			want: `{"op":"add","path":"/x","value":[1,1.5,"s"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := changeToOperation(diff.Change{
+				Type:     diff.ChangeTypeAdd,
+				Path:     "/x",
+				NewValue: tt.node,
+			})
+			if err != nil {
+				t.Fatalf("changeToOperation() error = %v", err)
+			}
+
+			data, err := json.Marshal(op)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("marshaled operation = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatch_BigIntegerRoundTrip(t *testing.T) {
+	data := []byte(`{"operations":[{"op":"replace","path":"/id","value":9007199254740993}]}`)
+
+	p, err := FromJSON(data)
+	if err != nil {
+		t.Fatalf("FromJSON() error = %v", err)
+	}
+
+	out, err := p.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v", err)
+	}
+
+	if string(out) != string(data) {
+		t.Errorf("round trip = %s, want %s", out, data)
+	}
+}
+
+func TestOperation_MarshalNullValue(t *testing.T) {
+	p := &Patch{Operations: []Operation{
+		{Op: "replace", Path: "/a"},
+		{Op: "test", Path: "/b"},
+		{Op: "remove", Path: "/c"},
+		{Op: "move", Path: "/d", From: "/e"},
+	}}
+	data, err := p.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v", err)
+	}
+	want := `{"operations":[{"op":"replace","path":"/a","value":null},{"op":"test","path":"/b","value":null},` +
+		`{"op":"remove","path":"/c"},{"op":"move","path":"/d","from":"/e"}]}`
+	if string(data) != want {
+		t.Errorf("ToJSON() = %s, want %s", data, want)
+	}
+}
+
+func TestFromChanges_BigIntegers(t *testing.T) {
+	for _, format := range []parse.Format{parse.FormatJSON, parse.FormatYAML} {
+		t.Run(string(format), func(t *testing.T) {
+			oldTree, err := parse.Parse([]byte(`{"id": 1, "big": 9007199254740993}`), format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			newTree, err := parse.Parse([]byte(`{"id": 9007199254740993, "big": 9007199254740993}`), format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			changes, err := diff.Diff(oldTree, newTree, diff.Options{})
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+
+			p, err := FromChanges(changes)
+			if err != nil {
+				t.Fatalf("FromChanges() error = %v", err)
+			}
+			data, err := p.ToJSON()
+			if err != nil {
+				t.Fatalf("ToJSON() error = %v", err)
+			}
+			want := `{"operations":[{"op":"replace","path":"/id","value":9007199254740993}]}`
+			if string(data) != want {
+				t.Errorf("ToJSON() = %s, want %s", data, want)
+			}
+		})
+	}
+}
+
 func TestPatch_ToJSON(t *testing.T) {
 	patch := &Patch{
 		Operations: []Operation{
@@ -503,6 +645,64 @@ func TestPatch_Validate(t *testing.T) {
 	}
 }
 
+func TestValidatePolicy(t *testing.T) {
+	p := Patch{
+		Operations: []Operation{
+			{Op: "replace", Path: "/spec/replicas", Value: 3},
+			{Op: "add", Path: "/metadata/labels/team", Value: "core"},
+			{Op: "replace", Path: "/spec/serviceAccountName", Value: "admin"},
+			{Op: "remove", Path: "/metadata/annotations/note"},
+			{Op: "move", Path: "/spec/b", From: "/status/a"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		allow       []string
+		deny        []string
+		wantIndexes []int
+	}{
+		{
+			name:        "no policy",
+			wantIndexes: nil,
+		},
+		{
+			name:        "allow only",
+			allow:       []string{"/spec/**", "/metadata/labels/**"},
+			wantIndexes: []int{3, 4},
+		},
+		{
+			name:        "allow and deny",
+			allow:       []string{"/spec/**", "/metadata/labels/**"},
+			deny:        []string{"/spec/serviceAccountName"},
+			wantIndexes: []int{2, 3, 4},
+		},
+		{
+			name:        "deny only",
+			deny:        []string{"/metadata/*"},
+			wantIndexes: []int{1, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Validate(p, tt.allow, tt.deny)
+			if len(errs) != len(tt.wantIndexes) {
+				t.Fatalf("Validate() returned %d errors, want %d: %v", len(errs), len(tt.wantIndexes), errs)
+			}
+			for i, err := range errs {
+				pe, ok := err.(*PolicyError)
+				if !ok {
+					t.Fatalf("Validate() error %d is %T, want *PolicyError", i, err)
+				}
+				if pe.Index != tt.wantIndexes[i] {
+					t.Errorf("error %d index = %d, want %d", i, pe.Index, tt.wantIndexes[i])
+				}
+			}
+		})
+	}
+}
+
 func TestIntegration_FullPatchWorkflow(t *testing.T) {
 	// Simulate a real diff -> patch workflow
 	changes := []diff.Change{
@@ -569,3 +769,213 @@ func TestIntegration_FullPatchWorkflow(t *testing.T) {
 		t.Errorf("Parsed patch validation failed: %v", err)
 	}
 }
+
+func TestApply_RoundTrip(t *testing.T) {
+	obj := func(kvs map[string]*tree.Node) *tree.Node { return tree.NewObject(kvs) }
+	arr := func(elems ...*tree.Node) *tree.Node { return tree.NewArray(elems) }
+	num := tree.NewNumber
+	container := func(name, image string) *tree.Node {
+		return obj(map[string]*tree.Node{"name": tree.NewString(name), "image": tree.NewString(image)})
+	}
+
+	tests := []struct {
+		name string
+		old  *tree.Node
+		new  *tree.Node
+		opts diff.Options
+	}{
+		{
+			name: "objects",
+			old:  obj(map[string]*tree.Node{"a": num(1), "b": obj(map[string]*tree.Node{"c": num(2)})}),
+			new:  obj(map[string]*tree.Node{"a": num(2), "d": tree.NewString("x")}),
+		},
+		{
+			name: "array shrinks",
+			old:  obj(map[string]*tree.Node{"l": arr(num(1), num(2), num(3), num(4), num(5), num(6), num(7), num(8), num(9), num(10), num(11))}),
+			new:  obj(map[string]*tree.Node{"l": arr(num(0), num(2))}),
+		},
+		{
+			name: "array grows",
+			old:  obj(map[string]*tree.Node{"l": arr(num(1))}),
+			new:  obj(map[string]*tree.Node{"l": arr(num(1), num(2), num(3), num(4), num(5), num(6), num(7), num(8), num(9), num(10), num(11))}),
+		},
+		{
+			name: "keyed array",
+			old:  obj(map[string]*tree.Node{"c": arr(container("a", "a1"), container("b", "b1"))}),
+			new:  obj(map[string]*tree.Node{"c": arr(container("a", "a2"), container("c", "c1"))}),
+			opts: diff.Options{ArraySetKeys: map[string]string{"/c": "name"}},
+		},
+		{
+			name: "root replaced",
+			old:  tree.NewString("x"),
+			new:  arr(num(1)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.StableOrder = true
+			changes, err := diff.Diff(tt.old, tt.new, tt.opts)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			p, err := FromChanges(changes)
+			if err != nil {
+				t.Fatalf("FromChanges() error = %v", err)
+			}
+			data, err := p.ToJSON()
+			if err != nil {
+				t.Fatalf("ToJSON() error = %v", err)
+			}
+			parsed, err := FromJSON(data)
+			if err != nil {
+				t.Fatalf("FromJSON() error = %v", err)
+			}
+
+			if errs := Check(tt.old, *parsed); len(errs) > 0 {
+				t.Errorf("Check() = %v, want no conflicts", errs)
+			}
+			got, err := Apply(tt.old, *parsed)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if rest, _ := diff.Diff(got, tt.new, tt.opts); len(rest) > 0 {
+				t.Errorf("Apply() = %v, want %v", got.ToInterface(), tt.new.ToInterface())
+			}
+		})
+	}
+}
+
+func TestApply_Operations(t *testing.T) {
+	target := tree.NewObject(map[string]*tree.Node{
+		"a": tree.NewNumber(1),
+		"l": tree.NewArray([]*tree.Node{tree.NewString("x"), tree.NewString("y")}),
+	})
+
+	p := Patch{Operations: []Operation{
+		{Op: "test", Path: "/a", Value: json.Number("1")},
+		{Op: "copy", From: "/a", Path: "/b"},
+		{Op: "move", From: "/l[1]", Path: "/m"},
+		{Op: "add", Path: "/l[0]", Value: "w"},
+	}}
+	got, err := Apply(target, p)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := map[string]interface{}{"a": int64(1), "b": int64(1), "m": "y", "l": []interface{}{"w", "x"}}
+	gotJSON, _ := json.Marshal(got.ToInterface())
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("Apply() = %s, want %s", gotJSON, wantJSON)
+	}
+
+	// The target itself is not modified
+	if _, exists := target.Object["b"]; exists {
+		t.Error("Apply() modified the target")
+	}
+}
+
+func TestApply_BigIntegers(t *testing.T) {
+	target := tree.NewObject(map[string]*tree.Node{
+		"items": tree.NewArray([]*tree.Node{
+			tree.NewObject(map[string]*tree.Node{"id": tree.NewNumber(5), "v": tree.NewString("a")}),
+		}),
+	})
+	data := []byte(`{"operations":[
+		{"op":"add","path":"/items[1]","value":{"id":9007199254740995}},
+		{"op":"replace","path":"/items[id=5]/v","value":"b"},
+		{"op":"test","path":"/items[id=9007199254740995]/id","value":9007199254740995},
+		{"op":"add","path":"/exact","value":9007199254740992},
+		{"op":"add","path":"/rounded","value":9007199254740993}
+	]}`)
+	p, err := FromJSON(data)
+	if err != nil {
+		t.Fatalf("FromJSON() error = %v", err)
+	}
+	got, err := Apply(target, *p)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// Selecting by a key compares with elements whose key is too large for
+	// a float64 too
+	if v := got.GetByPath("/items[0]/v"); v == nil || v.Value != "b" {
+		t.Errorf("/items[0]/v = %v, want b", v)
+	}
+	if n := got.GetByPath("/items[1]/id"); n == nil || n.Value != json.Number("9007199254740995") {
+		t.Errorf("/items[1]/id = %v, want 9007199254740995", n)
+	}
+	// 2^53 is exact; the integer after it rounds to it as a float64
+	if n := got.GetByPath("/exact"); n == nil || n.Value != float64(1<<53) {
+		t.Errorf("/exact = %#v, want float64 2^53", n.Value)
+	}
+	if n := got.GetByPath("/rounded"); n == nil || n.Value != json.Number("9007199254740993") {
+		t.Errorf("/rounded = %#v, want json.Number 9007199254740993", n.Value)
+	}
+}
+
+func TestCheck_Conflicts(t *testing.T) {
+	target := tree.NewObject(map[string]*tree.Node{"a": tree.NewNumber(1)})
+
+	p := Patch{Operations: []Operation{
+		{Op: "add", Path: "/a", Value: 2},
+		{Op: "add", Path: "/a", Value: 1},
+		{Op: "replace", Path: "/missing", Value: 1},
+		{Op: "remove", Path: "/missing/child"},
+		{Op: "test", Path: "/a", Value: "1"},
+		{Op: "add", Path: "/b", Value: true},
+	}}
+
+	errs := Check(target, p)
+	wantIndices := []int{0, 2, 3, 4}
+	if len(errs) != len(wantIndices) {
+		t.Fatalf("Check() = %v, want conflicts in operations %v", errs, wantIndices)
+	}
+	for i, err := range errs {
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("Check()[%d] = %T, want *ConflictError", i, err)
+		}
+		if conflict.Index != wantIndices[i] {
+			t.Errorf("Check()[%d].Index = %d, want %d", i, conflict.Index, wantIndices[i])
+		}
+	}
+
+	if _, err := Apply(target, p); err == nil {
+		t.Error("Apply() with conflicts should fail")
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	data := []byte(`operations:
+  - op: replace
+    path: /spec/replicas
+    value: 3
+  - op: add
+    path: /metadata/labels
+    value:
+      app: web
+`)
+	p, err := FromYAML(data)
+	if err != nil {
+		t.Fatalf("FromYAML() error = %v", err)
+	}
+	if p.Size() != 2 {
+		t.Fatalf("FromYAML() has %d operations, want 2", p.Size())
+	}
+
+	target := tree.NewObject(map[string]*tree.Node{
+		"spec":     tree.NewObject(map[string]*tree.Node{"replicas": tree.NewNumber(1)}),
+		"metadata": tree.NewObject(map[string]*tree.Node{}),
+	})
+	got, err := Apply(target, *p)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if n := got.GetByPath("/spec/replicas"); n == nil || n.Value != float64(3) {
+		t.Errorf("replicas = %v, want 3", n)
+	}
+	if n := got.GetByPath("/metadata/labels/app"); n == nil || n.Value != "web" {
+		t.Errorf("labels/app = %v, want web", n)
+	}
+}
@@ -0,0 +1,101 @@
+package configdiff
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/pfrederiksen/configdiff/report"
+)
+
+// ApplyPatch applies p to a document in docFormat and returns the result
+// serialized in the same format, with sorted keys and fixed indentation;
+// see parse.Marshal. A docFormat of "" or "auto" detects the format from
+// the content. A document that does not parse is a *ParseError, and an
+// operation that does not apply a *patch.ConflictError. HCL documents can
+// be patched but not serialized, so they are an error.
+func ApplyPatch(doc []byte, docFormat string, p Patch) ([]byte, error) {
+	format := parse.Format(docFormat)
+	if format == "" || format == "auto" {
+		if format = parse.DetectFileFormat("", doc); format == "" {
+			return nil, &ParseError{Err: errors.New("unable to detect format")}
+		}
+	}
+
+	node, err := parse.Parse(doc, format)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := patch.Apply(node, p)
+	if err != nil {
+		return nil, fmt.Errorf("patch does not apply: %w", err)
+	}
+	out, err := parse.Marshal(patched, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write result as %s: %w", format, err)
+	}
+	return out, nil
+}
+
+// RenderReport renders the changes of result in one of the output formats
+// of the command line: report, compact, json, patch, stat, side-by-side,
+// git-diff, tree, markdown, github-comment, csv, ndjson, tap,
+// gh-annotations, or sarif. opts.OldFile and opts.NewFile name the compared
+// documents where a format shows them; opts.Sort and opts.FilterTypes select
+// the changes in every format, and in patch FilterTypes only.
+//
+// The unified and template formats of the command line need more than the
+// changes, the parsed documents and a template; use report.GenerateUnified
+// and report.GenerateTemplate for them.
+func RenderReport(result *Result, format string, opts report.Options) (string, error) {
+	changes := result.Changes
+	switch format {
+	case "report":
+		return report.Generate(changes, opts), nil
+	case "compact":
+		opts.Compact, opts.ShowValues = true, false
+		return report.Generate(changes, opts), nil
+	case "json":
+		return report.GenerateJSON(changes, opts.OldFile, opts.NewFile, opts)
+	case "patch":
+		// Operations keep their order since it is significant
+		p := result.Patch
+		if len(opts.FilterTypes) > 0 || p == nil {
+			var err error
+			p, err = patch.FromChanges(report.SelectChanges(changes, report.Options{FilterTypes: opts.FilterTypes}))
+			if err != nil {
+				return "", fmt.Errorf("failed to build filtered patch: %w", err)
+			}
+		}
+		data, err := p.ToJSONIndent()
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal patch to JSON: %w", err)
+		}
+		return string(data), nil
+	case "stat":
+		return report.GenerateStat(report.SelectChanges(changes, opts)), nil
+	case "side-by-side":
+		return report.GenerateSideBySide(changes, opts), nil
+	case "git-diff":
+		return report.GenerateGitDiffWithOptions(changes, opts.OldFile, opts.NewFile, opts), nil
+	case "tree":
+		return report.GenerateTree(changes, opts), nil
+	case "markdown":
+		return report.GenerateMarkdown(changes, opts), nil
+	case "github-comment":
+		return report.GenerateGitHubComment(changes, opts.NewFile, opts, 0), nil
+	case "csv":
+		return report.GenerateCSV([]report.FileChanges{{File: opts.NewFile, Changes: changes}}, opts)
+	case "ndjson":
+		return report.GenerateNDJSON([]report.FileChanges{{File: opts.NewFile, Changes: changes}}, opts)
+	case "tap":
+		return report.GenerateTAP(changes, opts.OldFile, opts.NewFile, opts)
+	case "gh-annotations":
+		return report.GenerateGitHubAnnotations(changes, opts.NewFile, opts), nil
+	case "sarif":
+		return report.GenerateSARIF(report.SelectChanges(changes, opts), opts.NewFile, opts)
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
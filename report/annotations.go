@@ -0,0 +1,125 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+)
+
+// Annotation levels for GitHub Actions workflow commands.
+const (
+	AnnotationError   = "error"
+	AnnotationWarning = "warning"
+	AnnotationNotice  = "notice"
+)
+
+// AnnotationTypeChange is the Options.AnnotationLevels key for modifications
+// that change a value's kind, e.g. a string becoming an object.
+const AnnotationTypeChange = "type-change"
+
+// annotationTitle is the title shown on every annotation.
+const annotationTitle = "config change"
+
+// defaultAnnotationLevels maps change kinds to annotation levels.
+var defaultAnnotationLevels = map[string]string{
+	string(diff.ChangeTypeRemove): AnnotationError,
+	AnnotationTypeChange:          AnnotationError,
+	string(diff.ChangeTypeModify): AnnotationWarning,
+	string(diff.ChangeTypeAdd):    AnnotationNotice,
+	string(diff.ChangeTypeMove):   AnnotationNotice,
+}
+
+// ParseAnnotationLevels parses overrides such as "add=warning" into a map
+// for Options.AnnotationLevels. Keys are change types or "type-change";
+// levels are error, warning, or notice.
+func ParseAnnotationLevels(specs []string) (map[string]string, error) {
+	levels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		key, level, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid annotation level %q, expected TYPE=LEVEL", spec)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		level = strings.ToLower(strings.TrimSpace(level))
+		if _, known := defaultAnnotationLevels[key]; !known {
+			return nil, fmt.Errorf("invalid annotation type %q (valid: add, remove, modify, move, %s)", key, AnnotationTypeChange)
+		}
+		switch level {
+		case AnnotationError, AnnotationWarning, AnnotationNotice:
+		default:
+			return nil, fmt.Errorf("invalid annotation level %q (valid: %s, %s, %s)", level, AnnotationError, AnnotationWarning, AnnotationNotice)
+		}
+		levels[key] = level
+	}
+	return levels, nil
+}
+
+// GenerateGitHubAnnotations renders each change as a GitHub Actions workflow
+// command, e.g.
+//
+//	::warning file=new.yaml,line=14,title=config change::/spec/replicas changed 2 → 5
+//
+// so that changes show up inline on a pull request's Files view. The line
+// property is included when the parser recorded one; removals have no line
+// in file and never carry one. Levels follow Options.AnnotationLevels,
+// falling back to error for removals and type changes, warning for
+// modifications, and notice otherwise.
+func GenerateGitHubAnnotations(changes []diff.Change, file string, opts Options) string {
+	var b strings.Builder
+	for _, change := range SelectChanges(changes, opts) {
+		props := []string{"file=" + escapeAnnotationProperty(file)}
+		if change.Type != diff.ChangeTypeRemove && change.NewValue != nil && change.NewValue.Line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", change.NewValue.Line))
+		}
+		props = append(props, "title="+escapeAnnotationProperty(annotationTitle))
+
+		fmt.Fprintf(&b, "::%s %s::%s\n",
+			annotationLevel(change, opts),
+			strings.Join(props, ","),
+			escapeAnnotationData(annotationMessage(change, opts)))
+	}
+	return b.String()
+}
+
+// annotationLevel picks the workflow command for change.
+func annotationLevel(change diff.Change, opts Options) string {
+	key := string(change.Type)
+	if change.IsKindChange() {
+		key = AnnotationTypeChange
+	}
+	if level, ok := opts.AnnotationLevels[key]; ok {
+		return level
+	}
+	if level, ok := defaultAnnotationLevels[key]; ok {
+		return level
+	}
+	return AnnotationNotice
+}
+
+// annotationMessage describes change in one line.
+func annotationMessage(change diff.Change, opts Options) string {
+	switch change.Type {
+	case diff.ChangeTypeAdd:
+		return fmt.Sprintf("%s added: %s", change.Path, formatValueStyle(change.NewValue, opts.MaxValueLength, opts.ValueStyle))
+	case diff.ChangeTypeRemove:
+		return fmt.Sprintf("%s removed (was: %s)", change.Path, formatValueStyle(change.OldValue, opts.MaxValueLength, opts.ValueStyle))
+	case diff.ChangeTypeModify:
+		return fmt.Sprintf("%s changed %s → %s", change.Path,
+			formatValueStyle(change.OldValue, opts.MaxValueLength, opts.ValueStyle),
+			formatValueStyle(change.NewValue, opts.MaxValueLength, opts.ValueStyle))
+	default:
+		return fmt.Sprintf("%s %s", change.Path, changeTypeLabel(change.Type))
+	}
+}
+
+// escapeAnnotationData escapes a workflow command message.
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeAnnotationProperty escapes a workflow command property value, which
+// additionally cannot contain the ":" and "," separators.
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// BrowseItem is a change as listed by the interactive browser.
+type BrowseItem struct {
+	Change diff.Change
+
+	// Group is the top-level key the change is under, e.g. "spec/", or "/"
+	// for top-level keys.
+	Group string
+
+	// Line is the change as the report format shows it, on one line and
+	// without indentation.
+	Line string
+
+	// Details are the complete old and new values as YAML, shown when the
+	// change is expanded.
+	Details []string
+}
+
+// BrowseItems returns the changes selected by opts's Sort and FilterTypes as
+// browser items. Lines are rendered as by WriteReport with opts, so values
+// are styled and truncated the same way.
+func BrowseItems(changes []diff.Change, opts Options) []BrowseItem {
+	p := newPalette(opts.NoColor)
+	selected := SelectChanges(changes, opts)
+	items := make([]BrowseItem, 0, len(selected))
+	for _, change := range selected {
+		var b strings.Builder
+		writeChange(&b, change, opts, p)
+		line, _, _ := strings.Cut(b.String(), "\n")
+
+		var details []string
+		if change.Type != diff.ChangeTypeAdd {
+			details = append(details, valueDetails(change.OldValue, "old", p.remove)...)
+		}
+		if change.Type != diff.ChangeTypeRemove {
+			details = append(details, valueDetails(change.NewValue, "new", p.add)...)
+		}
+
+		items = append(items, BrowseItem{
+			Change:  change,
+			Group:   groupKey(change.Path, 1),
+			Line:    strings.TrimPrefix(line, "  "),
+			Details: details,
+		})
+	}
+	return items
+}
+
+// valueDetails renders node in full as block-style YAML nested under label.
+func valueDetails(node *tree.Node, label string, style func(a ...interface{}) string) []string {
+	if node == nil {
+		return nil
+	}
+	data, err := marshalYAMLValue(node, label, false)
+	if err != nil {
+		return []string{style(label + ": " + formatValue(node, 0))}
+	}
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		lines[i] = style(line)
+	}
+	return lines
+}
@@ -0,0 +1,68 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/pfrederiksen/configdiff/diff"
+)
+
+// palette holds the styling functions used by the generators.
+// Whether colors are emitted is decided entirely by Options.NoColor;
+// terminal and environment detection is the caller's responsibility.
+type palette struct {
+	add    func(a ...interface{}) string
+	remove func(a ...interface{}) string
+	modify func(a ...interface{}) string
+	move   func(a ...interface{}) string
+	info   func(a ...interface{}) string
+	path   func(a ...interface{}) string
+	dim    func(a ...interface{}) string
+	header func(a ...interface{}) string
+
+	// addEmphasis and removeEmphasis mark the differing spans of an inline diff.
+	addEmphasis    func(a ...interface{}) string
+	removeEmphasis func(a ...interface{}) string
+}
+
+// newPalette creates a palette that colors output unless noColor is set.
+func newPalette(noColor bool) palette {
+	style := func(attrs ...color.Attribute) func(a ...interface{}) string {
+		if noColor {
+			return fmt.Sprint
+		}
+		c := color.New(attrs...)
+		c.EnableColor()
+		return c.SprintFunc()
+	}
+
+	return palette{
+		add:    style(color.FgGreen),
+		remove: style(color.FgRed),
+		modify: style(color.FgYellow),
+		move:   style(color.FgCyan),
+		info:   style(color.FgBlue),
+		path:   style(color.Bold),
+		dim:    style(color.Faint),
+		header: style(color.FgCyan),
+
+		addEmphasis:    style(color.FgGreen, color.ReverseVideo),
+		removeEmphasis: style(color.FgRed, color.ReverseVideo),
+	}
+}
+
+// forType returns the styling function for a change type.
+func (p palette) forType(ct diff.ChangeType) func(a ...interface{}) string {
+	switch ct {
+	case diff.ChangeTypeAdd:
+		return p.add
+	case diff.ChangeTypeRemove:
+		return p.remove
+	case diff.ChangeTypeModify:
+		return p.modify
+	case diff.ChangeTypeMove:
+		return p.move
+	default:
+		return fmt.Sprint
+	}
+}
@@ -0,0 +1,152 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// changeRenderer writes a change, and anything shown with it, to w.
+type changeRenderer func(w io.Writer, change diff.Change)
+
+// contextRenderer returns a renderer writing a change with writeChange,
+// surrounded by unchanged siblings when opts.ContextLines and the trees allow.
+func contextRenderer(changes []diff.Change, oldTree, newTree *tree.Node, opts Options) changeRenderer {
+	p := newPalette(opts.NoColor)
+	if opts.ContextLines <= 0 || opts.Compact || (oldTree == nil && newTree == nil) {
+		return func(w io.Writer, change diff.Change) { writeChange(w, change, opts, p) }
+	}
+
+	changed := make(map[string]bool, len(changes))
+	for _, change := range changes {
+		changed[change.Path] = true
+	}
+
+	return func(w io.Writer, change diff.Change) {
+		before, after := changeContext(change, oldTree, newTree, changed, opts.ContextLines)
+		for _, entry := range before {
+			fmt.Fprint(w, formatContextLine(entry, opts, p))
+		}
+		writeChange(w, change, opts, p)
+		for _, entry := range after {
+			fmt.Fprint(w, formatContextLine(entry, opts, p))
+		}
+	}
+}
+
+// contextEntry is an unchanged sibling shown around a change.
+type contextEntry struct {
+	path string
+	node *tree.Node
+}
+
+// changeContext finds up to n unchanged siblings of change on each side,
+// nearest last in before and nearest first in after. Siblings come from
+// newTree, or from oldTree when the parent no longer exists. Object keys
+// are in sorted order; siblings that are themselves changed are skipped.
+func changeContext(change diff.Change, oldTree, newTree *tree.Node, changed map[string]bool, n int) (before, after []contextEntry) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	parentPath, key, index, ok := splitLastSegment(change.Path)
+	if !ok {
+		return nil, nil
+	}
+	parent := newTree.GetByPath(parentPath)
+	if parent == nil {
+		parent = oldTree.GetByPath(parentPath)
+	}
+	if parent == nil {
+		return nil, nil
+	}
+
+	// siblings lists candidate paths in document order; pos is where the
+	// changed entry sits, and present reports whether it occupies that slot.
+	var siblings []contextEntry
+	var pos int
+	var present bool
+
+	switch {
+	case parent.Kind == tree.KindObject && index < 0:
+		keys := parent.SortedKeys()
+		for _, k := range keys {
+			siblings = append(siblings, contextEntry{path: joinContextPath(parentPath, k), node: parent.Object[k]})
+		}
+		pos = sort.SearchStrings(keys, key)
+		present = pos < len(keys) && keys[pos] == key
+	case parent.Kind == tree.KindArray && index >= 0:
+		for i, elem := range parent.Array {
+			siblings = append(siblings, contextEntry{path: fmt.Sprintf("%s[%d]", parentPath, i), node: elem})
+		}
+		pos = min(index, len(siblings))
+		present = change.Type != diff.ChangeTypeRemove && pos < len(siblings)
+	default:
+		return nil, nil
+	}
+
+	for i := pos - 1; i >= 0 && len(before) < n; i-- {
+		if !changed[siblings[i].path] {
+			before = append([]contextEntry{siblings[i]}, before...)
+		}
+	}
+	start := pos
+	if present {
+		start++
+	}
+	for i := start; i < len(siblings) && len(after) < n; i++ {
+		if !changed[siblings[i].path] {
+			after = append(after, siblings[i])
+		}
+	}
+	return before, after
+}
+
+// splitLastSegment splits a path into its parent and final key or array
+// index; index is -1 for keys. The root path has no parent.
+func splitLastSegment(path string) (parent, key string, index int, ok bool) {
+	if strings.HasSuffix(path, "]") {
+		open := strings.LastIndex(path, "[")
+		if open < 0 {
+			return "", "", 0, false
+		}
+		idx, err := strconv.Atoi(path[open+1 : len(path)-1])
+		if err != nil {
+			return "", "", 0, false
+		}
+		parent = path[:open]
+		if parent == "" {
+			parent = "/"
+		}
+		return parent, "", idx, true
+	}
+
+	slash := strings.LastIndex(path, "/")
+	if slash < 0 || slash == len(path)-1 {
+		return "", "", 0, false
+	}
+	parent = path[:slash]
+	if parent == "" {
+		parent = "/"
+	}
+	return parent, path[slash+1:], -1, true
+}
+
+// joinContextPath builds the path of key under parent.
+func joinContextPath(parent, key string) string {
+	if parent == "/" {
+		return "/" + key
+	}
+	return parent + "/" + key
+}
+
+// formatContextLine renders an unchanged sibling, dimmed and indented to
+// line up with change paths.
+func formatContextLine(entry contextEntry, opts Options, p palette) string {
+	return p.dim(fmt.Sprintf("    %s = %s", displayPath(entry.path, opts), formatValueStyle(entry.node, opts.MaxValueLength, opts.ValueStyle))) + "\n"
+}
@@ -0,0 +1,469 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/pfrederiksen/configdiff/diff"
+)
+
+// FileStatus describes how a file differs between two directories.
+type FileStatus string
+
+const (
+	// FileModified is a file present in both directories with changes.
+	FileModified FileStatus = "modified"
+
+	// FileUnchanged is a file present in both directories without changes.
+	FileUnchanged FileStatus = "unchanged"
+
+	// FileAdded is a file present only in the new directory.
+	FileAdded FileStatus = "added"
+
+	// FileRemoved is a file present only in the old directory.
+	FileRemoved FileStatus = "removed"
+
+	// FileRenamed is a file present only in the old directory paired with
+	// a similar file present only in the new one.
+	FileRenamed FileStatus = "renamed"
+
+	// FileReplaced is a file or resource removed and added anew at the same
+	// path, e.g. a Terraform resource a plan replaces. Its changes are those
+	// between the old and the new one.
+	FileReplaced FileStatus = "replaced"
+
+	// FileError is a file present in both directories that could not be
+	// compared, e.g. because one side does not parse.
+	FileError FileStatus = "error"
+
+	// FileSkipped is a file left out of the comparison, e.g. because it is
+	// larger than the size limit.
+	FileSkipped FileStatus = "skipped"
+)
+
+// FileResult is the comparison of a single file within a DirResult.
+type FileResult struct {
+	// Path is the file's slash-separated path relative to the directories.
+	Path string
+
+	// Status is how the file differs.
+	Status FileStatus
+
+	// Changes are the changes within the file. Added and removed files
+	// have none; the file as a whole is the change.
+	Changes []diff.Change
+
+	// OldPath is the path of the file in the old directory when it differs
+	// from Path, its path in the new one: a renamed file, or a file paired
+	// with one in another format. It is empty otherwise.
+	OldPath string
+
+	// Similarity is the fraction of a renamed file's values found in both
+	// the old and the new file, 1 for an exact rename.
+	Similarity float64
+
+	// Error is why a file with status FileError could not be compared, or
+	// why one with status FileSkipped was skipped.
+	Error string
+
+	// TimedOut is set for a file with status FileError that was given up on
+	// for taking too long to compare.
+	TimedOut bool
+
+	// ParseDuration and DiffDuration are how long reading and parsing both
+	// sides of the file, and then comparing them, took, if measured.
+	ParseDuration time.Duration
+	DiffDuration  time.Duration
+}
+
+// DirResult is the comparison of two directories, one FileResult per file
+// in either of them, in path order.
+type DirResult struct {
+	OldDir string
+	NewDir string
+	Files  []FileResult
+
+	// MaxDepth is the number of directory levels walked, 0 for no limit.
+	MaxDepth int
+}
+
+// DirSummary counts files by status and the changes within them.
+type DirSummary struct {
+	// Compared counts files present in both directories.
+	Compared int
+
+	// Changed counts compared files with changes.
+	Changed int
+
+	Added   int
+	Removed int
+
+	// Renamed counts files paired with a file at another path.
+	Renamed int
+
+	// Replaced counts files removed and added anew.
+	Replaced int
+
+	// Errors counts files that could not be compared, and TimedOut those
+	// of them that took too long to compare.
+	Errors   int
+	TimedOut int
+
+	// Skipped counts files left out of the comparison.
+	Skipped int
+
+	// Changes totals the changes within compared, renamed, and replaced
+	// files.
+	Changes Summary
+}
+
+// Summarize counts files and the changes selected by opts.FilterTypes.
+func (d DirResult) Summarize(opts Options) DirSummary {
+	var s DirSummary
+	for _, f := range d.Files {
+		switch f.Status {
+		case FileAdded:
+			s.Added++
+		case FileRemoved:
+			s.Removed++
+		case FileError:
+			s.Errors++
+			if f.TimedOut {
+				s.TimedOut++
+			}
+		case FileSkipped:
+			s.Skipped++
+		default:
+			_, summary := selectChanges(f.Changes, opts)
+			switch f.Status {
+			case FileRenamed:
+				s.Renamed++
+			case FileReplaced:
+				s.Replaced++
+			default:
+				s.Compared++
+				if summary.Total > 0 {
+					s.Changed++
+				}
+			}
+			s.Changes.Total += summary.Total
+			s.Changes.Added += summary.Added
+			s.Changes.Removed += summary.Removed
+			s.Changes.Modified += summary.Modified
+			s.Changes.Moved += summary.Moved
+			s.Changes.Hidden += summary.Hidden
+		}
+	}
+	return s
+}
+
+// HasChanges reports whether any file was added, removed, renamed, or
+// changed. Files that could not be compared, or were skipped, are not
+// changes.
+func (d DirResult) HasChanges() bool {
+	for _, f := range d.Files {
+		if f.Status != FileUnchanged && f.Status != FileError && f.Status != FileSkipped {
+			return true
+		}
+	}
+	return false
+}
+
+// FileChanges flattens d for the record and stat exports. Added and removed
+// files become a single add or remove change of their root path "/".
+func (d DirResult) FileChanges() []FileChanges {
+	files := make([]FileChanges, 0, len(d.Files))
+	for _, f := range d.Files {
+		changes := f.Changes
+		switch f.Status {
+		case FileAdded:
+			changes = []diff.Change{{Type: diff.ChangeTypeAdd, Path: "/"}}
+		case FileRemoved:
+			changes = []diff.Change{{Type: diff.ChangeTypeRemove, Path: "/"}}
+		}
+		files = append(files, FileChanges{File: f.Path, Changes: changes})
+	}
+	return files
+}
+
+// GenerateDirReport renders a directory comparison as one human-readable
+// report: a "=== path ===" section with the Generate report of each changed
+// file, "+++ path (added)" and "--- path (removed)" lines for files present
+// on one side only, a "renamed: old → new (similarity N%)" line followed by
+// the changes of each renamed file, a "-/+ path (replaced)" line followed by
+// the changes of each replaced file, "!!! path (skipped: reason)" lines for
+// skipped files, and a global summary. Unchanged files,
+// and files that could not be compared, whose errors are reported
+// separately, are only counted.
+func GenerateDirReport(d DirResult, opts Options) string {
+	p := newPalette(opts.NoColor)
+	var b strings.Builder
+
+	// The legend is shown once, above all sections
+	sectionOpts := opts
+	sectionOpts.OldFile, sectionOpts.NewFile = "", ""
+	sectionOpts.ShowLegend = false
+	if opts.ShowLegend && d.HasChanges() {
+		b.WriteString(formatLegend(opts) + "\n")
+	}
+
+	for _, f := range d.Files {
+		switch f.Status {
+		case FileAdded:
+			b.WriteString(p.add(fmt.Sprintf("+++ %s (added)", f.Path)) + "\n\n")
+		case FileRemoved:
+			b.WriteString(p.remove(fmt.Sprintf("--- %s (removed)", f.Path)) + "\n\n")
+		case FileSkipped:
+			b.WriteString(fmt.Sprintf("!!! %s (skipped: %s)", f.Path, f.Error) + "\n\n")
+		case FileRenamed, FileReplaced:
+			if f.Status == FileRenamed {
+				b.WriteString(p.path(renamedLine(f, opts)) + "\n")
+			} else {
+				b.WriteString(p.path(fmt.Sprintf("-/+ %s (replaced)", f.Path)) + "\n")
+			}
+			if len(SelectChanges(f.Changes, opts)) > 0 {
+				b.WriteString(Generate(f.Changes, sectionOpts))
+			}
+			b.WriteString("\n")
+		case FileModified:
+			if len(SelectChanges(f.Changes, opts)) == 0 {
+				continue
+			}
+			b.WriteString(p.path(fmt.Sprintf("=== %s ===", f.label(opts))) + "\n")
+			b.WriteString(Generate(f.Changes, sectionOpts))
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString(formatDirSummary(d.Summarize(opts), opts))
+	return b.String()
+}
+
+// label names a file in output: its path, or "old → new" for a file compared
+// with one at another path.
+func (f FileResult) label(opts Options) string {
+	if f.OldPath == "" {
+		return f.Path
+	}
+	return f.OldPath + " " + symbolsFor(opts).arrow + " " + f.Path
+}
+
+// renamedLine describes a renamed file as "renamed: old → new (similarity N%)".
+func renamedLine(f FileResult, opts Options) string {
+	return fmt.Sprintf("renamed: %s %s %s (similarity %s)",
+		f.OldPath, symbolsFor(opts).arrow, f.Path, similarityPercent(f.Similarity))
+}
+
+// similarityPercent formats a similarity as a whole percentage, rounded
+// down so that only exact renames show 100%.
+func similarityPercent(similarity float64) string {
+	return fmt.Sprintf("%d%%", int(similarity*100))
+}
+
+// fileCounts describes the files of a directory comparison for its summary
+// line; renamed, replaced, failed, timed out, and skipped files are only
+// mentioned when there are some.
+func fileCounts(s DirSummary) string {
+	line := fmt.Sprintf("%d %s compared (%d changed), %d added, %d removed",
+		s.Compared, plural(s.Compared, "file", "files"), s.Changed, s.Added, s.Removed)
+	if s.Renamed > 0 {
+		line += fmt.Sprintf(", %d renamed", s.Renamed)
+	}
+	if s.Replaced > 0 {
+		line += fmt.Sprintf(", %d replaced", s.Replaced)
+	}
+	if failed := s.Errors - s.TimedOut; failed > 0 {
+		line += fmt.Sprintf(", %d failed", failed)
+	}
+	if s.TimedOut > 0 {
+		line += fmt.Sprintf(", %d timed out", s.TimedOut)
+	}
+	if s.Skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", s.Skipped)
+	}
+	return line
+}
+
+// formatDirSummary creates the closing summary of a directory report.
+func formatDirSummary(s DirSummary, opts Options) string {
+	p := newPalette(opts.NoColor)
+	line := "Summary: " + fileCounts(s)
+	if s.Changes.Total > 0 || s.Changes.Hidden > 0 || opts.IncludeZeroCounts {
+		line += fmt.Sprintf("; %s (%s)", summaryParts(s.Changes, p, symbolsFor(opts), opts.IncludeZeroCounts), s.Changes.totalLabel())
+	}
+	return line + "\n"
+}
+
+// JSONDirOutput is the stable JSON document for a directory comparison,
+// produced by GenerateDirJSON. Its schema is published in
+// docs/schema/dir-output.v1.json.
+type JSONDirOutput struct {
+	SchemaVersion string         `json:"schemaVersion" jsonschema:"enum=1"`
+	Old           string         `json:"old"`
+	New           string         `json:"new"`
+	MaxDepth      int            `json:"maxDepth,omitempty"`
+	Summary       JSONDirSummary `json:"summary"`
+	Files         []JSONFile     `json:"files"`
+}
+
+// JSONDirSummary counts files by status, plus the changes within them.
+type JSONDirSummary struct {
+	Compared int         `json:"compared"`
+	Changed  int         `json:"changed"`
+	Added    int         `json:"added"`
+	Removed  int         `json:"removed"`
+	Renamed  int         `json:"renamed"`
+	Replaced int         `json:"replaced,omitempty"`
+	Errors   int         `json:"errors"`
+	TimedOut int         `json:"timedOut,omitempty"`
+	Skipped  int         `json:"skipped"`
+	Changes  JSONSummary `json:"changes"`
+}
+
+// JSONFile is one file of a JSONDirOutput.
+type JSONFile struct {
+	Path   string `json:"path"`
+	Status string `json:"status" jsonschema:"enum=modified|unchanged|added|removed|renamed|replaced|error|skipped"`
+
+	// OldPath and Similarity are set for renamed files; Similarity is a
+	// fraction, 1 for an exact rename.
+	OldPath    string  `json:"oldPath,omitempty"`
+	Similarity float64 `json:"similarity,omitempty"`
+
+	// Error is set for files with status "error" or "skipped", and
+	// TimedOut for files with status "error" that took too long to compare.
+	Error    string `json:"error,omitempty"`
+	TimedOut bool   `json:"timedOut,omitempty"`
+
+	// ParseMs and DiffMs are how long parsing and comparing the file took,
+	// in milliseconds, if measured.
+	ParseMs float64 `json:"parseMs,omitempty"`
+	DiffMs  float64 `json:"diffMs,omitempty"`
+
+	Summary JSONSummary  `json:"summary"`
+	Changes []JSONChange `json:"changes"`
+}
+
+// NewJSONDirOutput builds the stable JSON document for d, honoring
+// opts.FilterTypes and opts.Sort within each file.
+func NewJSONDirOutput(d DirResult, opts Options) (JSONDirOutput, error) {
+	s := d.Summarize(opts)
+	out := JSONDirOutput{
+		SchemaVersion: JSONSchemaVersion,
+		Old:           d.OldDir,
+		New:           d.NewDir,
+		MaxDepth:      d.MaxDepth,
+		Summary: JSONDirSummary{
+			Compared: s.Compared,
+			Changed:  s.Changed,
+			Added:    s.Added,
+			Removed:  s.Removed,
+			Renamed:  s.Renamed,
+			Replaced: s.Replaced,
+			Errors:   s.Errors,
+			TimedOut: s.TimedOut,
+			Skipped:  s.Skipped,
+			Changes:  jsonSummary(s.Changes),
+		},
+		Files: make([]JSONFile, 0, len(d.Files)),
+	}
+
+	for _, f := range d.Files {
+		file, err := NewJSONOutput(f.Changes, "", "", opts)
+		if err != nil {
+			return JSONDirOutput{}, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		out.Files = append(out.Files, JSONFile{
+			Path:       f.Path,
+			Status:     string(f.Status),
+			OldPath:    f.OldPath,
+			Similarity: f.Similarity,
+			Error:      f.Error,
+			TimedOut:   f.TimedOut,
+			ParseMs:    milliseconds(f.ParseDuration),
+			DiffMs:     milliseconds(f.DiffDuration),
+			Summary:    file.Summary,
+			Changes:    file.Changes,
+		})
+	}
+	return out, nil
+}
+
+// milliseconds converts d to milliseconds, to the microsecond.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// GenerateDirJSON renders d as an indented JSONDirOutput document.
+func GenerateDirJSON(d DirResult, opts Options) (string, error) {
+	out, err := NewJSONDirOutput(d, opts)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON output: %w", err)
+	}
+	return string(data), nil
+}
+
+// GenerateDirMarkdown renders d as Markdown: the global summary, then one
+// list of added, removed, renamed, replaced, failed, and skipped files, then one collapsible <details>
+// section per changed, renamed, or replaced file holding its GenerateMarkdown table.
+func GenerateDirMarkdown(d DirResult, opts Options) string {
+	var b strings.Builder
+	s := d.Summarize(opts)
+	fmt.Fprintf(&b, "**Summary:** %s\n", fileCounts(s))
+
+	listed := false
+	for _, f := range d.Files {
+		if f.Status == FileModified || f.Status == FileUnchanged {
+			continue
+		}
+		if !listed {
+			b.WriteString("\n")
+			listed = true
+		}
+		switch f.Status {
+		case FileRenamed:
+			fmt.Fprintf(&b, "- %s renamed from %s (similarity %s)\n",
+				markdownCode(f.Path), markdownCode(f.OldPath), similarityPercent(f.Similarity))
+		case FileError:
+			fmt.Fprintf(&b, "- %s could not be compared: %s\n", markdownCode(f.label(opts)), markdownCode(f.Error))
+		case FileSkipped:
+			fmt.Fprintf(&b, "- %s skipped: %s\n", markdownCode(f.Path), f.Error)
+		default:
+			fmt.Fprintf(&b, "- %s %s\n", markdownCode(f.Path), f.Status)
+		}
+	}
+
+	for _, f := range d.Files {
+		switch f.Status {
+		case FileModified, FileRenamed, FileReplaced:
+			changes, summary := selectChanges(f.Changes, opts)
+			if len(changes) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "\n<details>\n<summary><code>%s</code> (%s)</summary>\n\n",
+				html.EscapeString(f.label(opts)), summary.totalLabel())
+			b.WriteString(GenerateMarkdown(f.Changes, opts))
+			b.WriteString("\n</details>\n")
+		}
+	}
+	return b.String()
+}
+
+// jsonSummary converts a Summary for JSON output.
+func jsonSummary(s Summary) JSONSummary {
+	return JSONSummary{
+		Total:    s.Total,
+		Added:    s.Added,
+		Removed:  s.Removed,
+		Modified: s.Modified,
+		Moved:    s.Moved,
+		Hidden:   s.Hidden,
+	}
+}
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// minStatBarWidth is the smallest bar GenerateDirStat draws, however narrow
+// the terminal.
+const minStatBarWidth = 10
+
+// GenerateDirStat creates a per-file rollup like git diff --stat:
+//
+//	app/config.yaml | 12 +++++~~~~---
+//	values.yaml     |  3 ++~
+//	2 files changed, 6 additions(+), 3 deletions(-), 6 modifications(~)
+//
+// Each line shows the file's change count and a bar of additions (+),
+// modifications and moves (~), and removals (-). Bars are scaled down so the
+// widest fits in width terminal cells (DefaultWidth when 0). Files without
+// changes are omitted.
+func GenerateDirStat(files map[string]Summary, width int) string {
+	names := make([]string, 0, len(files))
+	var total Summary
+	maxCount := 0
+	for name, s := range files {
+		if s.Total == 0 {
+			continue
+		}
+		names = append(names, name)
+		total.Total += s.Total
+		total.Added += s.Added
+		total.Removed += s.Removed
+		total.Modified += s.Modified
+		total.Moved += s.Moved
+		if s.Total > maxCount {
+			maxCount = s.Total
+		}
+	}
+	if len(names) == 0 {
+		return "No changes detected.\n"
+	}
+	sort.Strings(names)
+
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	countWidth := len(fmt.Sprint(maxCount))
+
+	// Leave the bar at least minStatBarWidth cells, shortening names if needed
+	nameWidth := 0
+	for _, name := range names {
+		if w := displayWidth(name); w > nameWidth {
+			nameWidth = w
+		}
+	}
+	fixed := 1 + 3 + countWidth + 1 // " " + " | " + count + " "
+	if limit := width - fixed - minStatBarWidth; nameWidth > limit {
+		nameWidth = max(limit, minStatBarWidth)
+	}
+	barWidth := max(width-fixed-nameWidth, minStatBarWidth)
+
+	var b strings.Builder
+	for _, name := range names {
+		s := files[name]
+		display := truncateWidthLeft(name, nameWidth)
+		fmt.Fprintf(&b, " %s%s | %*d %s\n",
+			display, strings.Repeat(" ", nameWidth-displayWidth(display)),
+			countWidth, s.Total, statBar(s, maxCount, barWidth))
+	}
+
+	fmt.Fprintf(&b, " %d %s changed", len(names), plural(len(names), "file", "files"))
+	if total.Added > 0 {
+		fmt.Fprintf(&b, ", %d additions(+)", total.Added)
+	}
+	if total.Removed > 0 {
+		fmt.Fprintf(&b, ", %d deletions(-)", total.Removed)
+	}
+	if changed := total.Modified + total.Moved; changed > 0 {
+		fmt.Fprintf(&b, ", %d modifications(~)", changed)
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// statBar draws a file's +~- bar, scaled so maxCount fills barWidth. Like
+// git, every non-zero part keeps at least one character.
+func statBar(s Summary, maxCount, barWidth int) string {
+	scale := func(n int) int {
+		if n == 0 || maxCount <= barWidth {
+			return n
+		}
+		return max(n*barWidth/maxCount, 1)
+	}
+	return strings.Repeat("+", scale(s.Added)) +
+		strings.Repeat("~", scale(s.Modified+s.Moved)) +
+		strings.Repeat("-", scale(s.Removed))
+}
+
+// plural returns singular when n is 1 and pluralForm otherwise.
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
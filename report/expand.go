@@ -0,0 +1,61 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// DefaultExpandLimit is the node count up to which Options.ExpandContainers
+// renders added and removed containers when Options.ExpandLimit is 0.
+const DefaultExpandLimit = 50
+
+// expandIndent nests expanded values under their change line.
+const expandIndent = "      "
+
+// writeExpandedValue writes node as indented YAML below its change line if
+// opts.ExpandContainers is set and node is a non-empty object or array
+// within the expand limit, and reports whether it did. Larger containers
+// keep only their "{...} (N keys)" placeholder.
+func writeExpandedValue(w io.Writer, node *tree.Node, opts Options, style func(a ...interface{}) string) bool {
+	if !opts.ExpandContainers || node == nil || (node.Kind != tree.KindObject && node.Kind != tree.KindArray) {
+		return false
+	}
+	if len(node.Object) == 0 && len(node.Array) == 0 {
+		return false
+	}
+	limit := opts.ExpandLimit
+	if limit <= 0 {
+		limit = DefaultExpandLimit
+	}
+	if countNodes(node) > limit {
+		return false
+	}
+
+	data, err := parse.MarshalYAML(node)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fmt.Fprint(w, expandIndent+style(line)+"\n")
+	}
+	return true
+}
+
+// countNodes counts node and all of its descendants.
+func countNodes(node *tree.Node) int {
+	if node == nil {
+		return 0
+	}
+	n := 1
+	for _, child := range node.Object {
+		n += countNodes(child)
+	}
+	for _, child := range node.Array {
+		n += countNodes(child)
+	}
+	return n
+}
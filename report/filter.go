@@ -0,0 +1,177 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+)
+
+// Sort orders for Options.Sort.
+const (
+	// SortPath orders changes lexically by path.
+	SortPath = "path"
+
+	// SortType orders changes as added, removed, modified, moved.
+	SortType = "type"
+
+	// SortSeverity puts the most disruptive changes first: removals,
+	// modifications, moves, then additions. Under Options.ClassifySeverity,
+	// changes are ordered by ClassifyChange first.
+	SortSeverity = "severity"
+)
+
+// ValidateSort returns an error if order is not a supported sort order.
+// The empty string keeps the order produced by the diff.
+func ValidateSort(order string) error {
+	switch order {
+	case "", SortPath, SortType, SortSeverity:
+		return nil
+	default:
+		return fmt.Errorf("invalid sort order %q (valid: %s, %s, %s)", order, SortPath, SortType, SortSeverity)
+	}
+}
+
+// ParseChangeTypes converts names such as "add" or "remove" to change types.
+func ParseChangeTypes(names []string) ([]diff.ChangeType, error) {
+	types := make([]diff.ChangeType, 0, len(names))
+	for _, name := range names {
+		ct := diff.ChangeType(strings.ToLower(strings.TrimSpace(name)))
+		switch ct {
+		case diff.ChangeTypeAdd, diff.ChangeTypeRemove, diff.ChangeTypeModify, diff.ChangeTypeMove:
+			types = append(types, ct)
+		default:
+			return nil, fmt.Errorf("invalid change type %q (valid: add, remove, modify, move)", name)
+		}
+	}
+	return types, nil
+}
+
+// SelectChanges returns the changes to render: those matching
+// opts.FilterTypes (all when empty), ordered by opts.Sort. The input slice
+// is not modified.
+func SelectChanges(changes []diff.Change, opts Options) []diff.Change {
+	if len(opts.FilterTypes) == 0 && opts.Sort == "" {
+		return changes
+	}
+
+	selected := make([]diff.Change, 0, len(changes))
+	for _, change := range changes {
+		if matchesTypes(change.Type, opts.FilterTypes) {
+			selected = append(selected, change)
+		}
+	}
+
+	switch opts.Sort {
+	case SortPath:
+		sort.SliceStable(selected, func(i, j int) bool {
+			return selected[i].Path < selected[j].Path
+		})
+	case SortType:
+		sort.SliceStable(selected, func(i, j int) bool {
+			return typeRank(selected[i].Type) < typeRank(selected[j].Type)
+		})
+	case SortSeverity:
+		sort.SliceStable(selected, func(i, j int) bool {
+			if opts.ClassifySeverity {
+				si, sj := severityOrder(classifyChange(selected[i], opts)), severityOrder(classifyChange(selected[j], opts))
+				if si != sj {
+					return si < sj
+				}
+			}
+			return severityRank(selected[i].Type) < severityRank(selected[j].Type)
+		})
+	}
+
+	return selected
+}
+
+// selectChanges applies SelectChanges and summarizes the result, recording
+// how many changes the filter hid.
+func selectChanges(changes []diff.Change, opts Options) ([]diff.Change, Summary) {
+	selected := SelectChanges(changes, opts)
+	summary := summarizeChanges(selected)
+	summary.Hidden = len(changes) - len(selected)
+	return selected, summary
+}
+
+// limitChanges keeps the first limit changes (all when limit is 0) and
+// reports how many were left out.
+func limitChanges(changes []diff.Change, limit int) ([]diff.Change, int) {
+	if limit <= 0 || len(changes) <= limit {
+		return changes, 0
+	}
+	return changes[:limit], len(changes) - limit
+}
+
+// moreChangesNotice explains that Options.MaxChanges left changes out.
+func moreChangesNotice(more int, sym symbolSet) string {
+	noun := "changes"
+	if more == 1 {
+		noun = "change"
+	}
+	return fmt.Sprintf("%s and %s more %s (re-run with --max-shown 0 to see all)", sym.ellipsis, formatCount(more), noun)
+}
+
+// formatCount formats n with thousands separators, e.g. 1234 as "1,234".
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// noMatchingChanges is the message shown when every change was filtered out.
+func noMatchingChanges(hidden int) string {
+	return fmt.Sprintf("No matching changes (%d hidden by filter).\n", hidden)
+}
+
+// matchesTypes reports whether ct is one of types, or types is empty.
+func matchesTypes(ct diff.ChangeType, types []diff.ChangeType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// typeRank orders change types as the summary lists them.
+func typeRank(ct diff.ChangeType) int {
+	switch ct {
+	case diff.ChangeTypeAdd:
+		return 0
+	case diff.ChangeTypeRemove:
+		return 1
+	case diff.ChangeTypeModify:
+		return 2
+	case diff.ChangeTypeMove:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// severityRank orders change types from most to least disruptive.
+func severityRank(ct diff.ChangeType) int {
+	switch ct {
+	case diff.ChangeTypeRemove:
+		return 0
+	case diff.ChangeTypeModify:
+		return 1
+	case diff.ChangeTypeMove:
+		return 2
+	case diff.ChangeTypeAdd:
+		return 3
+	default:
+		return 4
+	}
+}
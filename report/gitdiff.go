@@ -10,21 +10,29 @@ import (
 // GenerateGitDiff creates output in git diff format.
 // This is useful for git diff driver integration.
 func GenerateGitDiff(changes []diff.Change, oldFile, newFile string) string {
+	return GenerateGitDiffWithOptions(changes, oldFile, newFile, Options{NoColor: true})
+}
+
+// GenerateGitDiffWithOptions creates git diff format output, colored like
+// git's own diff unless opts.NoColor is set.
+func GenerateGitDiffWithOptions(changes []diff.Change, oldFile, newFile string, opts Options) string {
+	changes = SelectChanges(changes, opts)
 	if len(changes) == 0 {
 		return ""
 	}
 
+	p := newPalette(opts.NoColor)
 	var b strings.Builder
-	
+
 	// Git diff header
-	b.WriteString(fmt.Sprintf("diff --configdiff a/%s b/%s\n", oldFile, newFile))
-	b.WriteString(fmt.Sprintf("--- a/%s\n", oldFile))
-	b.WriteString(fmt.Sprintf("+++ b/%s\n", newFile))
-	
+	b.WriteString(p.path(fmt.Sprintf("diff --configdiff a/%s b/%s", oldFile, newFile)) + "\n")
+	b.WriteString(p.path(fmt.Sprintf("--- a/%s", oldFile)) + "\n")
+	b.WriteString(p.path(fmt.Sprintf("+++ b/%s", newFile)) + "\n")
+
 	// Group changes by path for better readability
 	pathChanges := make(map[string][]diff.Change)
 	var paths []string
-	
+
 	for _, change := range changes {
 		// Extract base path (before array indices)
 		basePath := strings.Split(change.Path, "[")[0]
@@ -33,34 +41,34 @@ func GenerateGitDiff(changes []diff.Change, oldFile, newFile string) string {
 		}
 		pathChanges[basePath] = append(pathChanges[basePath], change)
 	}
-	
+
 	// Output changes grouped by path
 	for _, basePath := range paths {
-		b.WriteString(fmt.Sprintf("@@ %s @@\n", basePath))
-		
+		b.WriteString(p.header(fmt.Sprintf("@@ %s @@", basePath)) + "\n")
+
 		for _, change := range pathChanges[basePath] {
 			switch change.Type {
 			case diff.ChangeTypeAdd:
-				val := formatValue(change.NewValue, 0)
-				b.WriteString(fmt.Sprintf("+%s: %s\n", change.Path, val))
-				
+				val := formatValueStyle(change.NewValue, 0, opts.ValueStyle)
+				b.WriteString(p.add(fmt.Sprintf("+%s: %s", change.Path, val)) + "\n")
+
 			case diff.ChangeTypeRemove:
-				val := formatValue(change.OldValue, 0)
-				b.WriteString(fmt.Sprintf("-%s: %s\n", change.Path, val))
-				
+				val := formatValueStyle(change.OldValue, 0, opts.ValueStyle)
+				b.WriteString(p.remove(fmt.Sprintf("-%s: %s", change.Path, val)) + "\n")
+
 			case diff.ChangeTypeModify:
-				oldVal := formatValue(change.OldValue, 0)
-				newVal := formatValue(change.NewValue, 0)
-				b.WriteString(fmt.Sprintf("-%s: %s\n", change.Path, oldVal))
-				b.WriteString(fmt.Sprintf("+%s: %s\n", change.Path, newVal))
-				
+				oldVal := formatValueStyle(change.OldValue, 0, opts.ValueStyle)
+				newVal := formatValueStyle(change.NewValue, 0, opts.ValueStyle)
+				b.WriteString(p.remove(fmt.Sprintf("-%s: %s", change.Path, oldVal)) + "\n")
+				b.WriteString(p.add(fmt.Sprintf("+%s: %s", change.Path, newVal)) + "\n")
+
 			case diff.ChangeTypeMove:
-				oldVal := formatValue(change.OldValue, 0)
-				newVal := formatValue(change.NewValue, 0)
-				b.WriteString(fmt.Sprintf("~%s: %s → %s\n", change.Path, oldVal, newVal))
+				oldVal := formatValueStyle(change.OldValue, 0, opts.ValueStyle)
+				newVal := formatValueStyle(change.NewValue, 0, opts.ValueStyle)
+				b.WriteString(p.move(fmt.Sprintf("~%s: %s %s %s", change.Path, oldVal, symbolsFor(opts).arrow, newVal)) + "\n")
 			}
 		}
 	}
-	
+
 	return b.String()
 }
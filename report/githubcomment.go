@@ -0,0 +1,111 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+)
+
+// GitHubCommentLimit is the maximum size of a GitHub issue or PR comment body.
+const GitHubCommentLimit = 65536
+
+// GitHubStepSummaryLimit is the maximum size of a GitHub Actions job step
+// summary.
+const GitHubStepSummaryLimit = 1024 * 1024
+
+// GenerateGitHubComment creates a Markdown section suitable for a GitHub PR comment.
+//
+// The section has an optional "#### title" heading, an emoji summary line, and
+// the change table collapsed behind a <details> block. Output is kept within
+// maxSize bytes (0 means GitHubCommentLimit); when the table does not fit,
+// whole rows are dropped from the end and a truncation notice is appended.
+func GenerateGitHubComment(changes []diff.Change, title string, opts Options, maxSize int) string {
+	if maxSize <= 0 {
+		maxSize = GitHubCommentLimit
+	}
+
+	var head strings.Builder
+	if title != "" {
+		fmt.Fprintf(&head, "#### %s\n\n", title)
+	}
+
+	if len(changes) == 0 {
+		head.WriteString("✅ No changes detected.\n")
+		return head.String()
+	}
+
+	changes, summary := selectChanges(changes, opts)
+	if len(changes) == 0 {
+		head.WriteString(noMatchingChanges(summary.Hidden))
+		return head.String()
+	}
+
+	head.WriteString(formatEmojiSummary(summary))
+	head.WriteString("\n<details>\n")
+	fmt.Fprintf(&head, "<summary>Show %d changes</summary>\n\n", summary.Total)
+	head.WriteString(markdownTableHeader(opts))
+
+	const footer = "\n</details>\n"
+
+	var b strings.Builder
+	b.WriteString(head.String())
+	size := b.Len() + len(footer)
+
+	changes, more := limitChanges(changes, opts.MaxChanges)
+	moreNotice := ""
+	if more > 0 {
+		moreNotice = markdownMoreNotice(more)
+	}
+
+	for i, change := range changes {
+		row := markdownRow(change, opts)
+		remaining := len(changes) - i - 1 + more
+		notice := ""
+		if remaining > 0 {
+			// Reserve room for a notice in case a later row does not fit
+			notice = truncationNotice(remaining)
+			if len(moreNotice) > len(notice) {
+				notice = moreNotice
+			}
+		}
+		if size+len(row)+len(notice) > maxSize {
+			b.WriteString(truncationNotice(len(changes) - i + more))
+			b.WriteString(footer)
+			return b.String()
+		}
+		b.WriteString(row)
+		size += len(row)
+	}
+
+	b.WriteString(moreNotice)
+	b.WriteString(footer)
+	return b.String()
+}
+
+// truncationNotice explains how many changes were left out of a comment.
+func truncationNotice(omitted int) string {
+	return fmt.Sprintf("\n_⚠️ Output truncated: %d more changes not shown (GitHub comment size limit)._\n", omitted)
+}
+
+// formatEmojiSummary creates a summary line such as "🔧 3 modified, ➕ 1 added".
+func formatEmojiSummary(s Summary) string {
+	parts := make([]string, 0, 4)
+	if s.Modified > 0 {
+		parts = append(parts, fmt.Sprintf("🔧 %d modified", s.Modified))
+	}
+	if s.Added > 0 {
+		parts = append(parts, fmt.Sprintf("➕ %d added", s.Added))
+	}
+	if s.Removed > 0 {
+		parts = append(parts, fmt.Sprintf("➖ %d removed", s.Removed))
+	}
+	if s.Moved > 0 {
+		parts = append(parts, fmt.Sprintf("🔀 %d moved", s.Moved))
+	}
+	summary := strings.Join(parts, ", ")
+	if s.Hidden > 0 {
+		summary += fmt.Sprintf(" (%s)", s.totalLabel())
+	}
+	return summary + "\n"
+}
@@ -0,0 +1,115 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// Grouping modes accepted by Options.GroupBy.
+const (
+	// GroupByNone renders changes as a flat list.
+	GroupByNone = "none"
+
+	// GroupByTopLevel buckets changes by their first path segment.
+	GroupByTopLevel = "top-level"
+)
+
+// changeGroup is a set of changes sharing a path prefix.
+type changeGroup struct {
+	name    string
+	changes []diff.Change
+}
+
+// ParseGroupBy converts a GroupBy value ("", "none", "top-level", or "depth-N")
+// into the number of leading path segments used as the group key.
+// A depth of 0 means no grouping.
+func ParseGroupBy(groupBy string) (int, error) {
+	switch groupBy {
+	case "", GroupByNone:
+		return 0, nil
+	case GroupByTopLevel:
+		return 1, nil
+	}
+
+	if n, ok := strings.CutPrefix(groupBy, "depth-"); ok {
+		depth, err := strconv.Atoi(n)
+		if err == nil && depth > 0 {
+			return depth, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid group-by %q, must be one of: none, top-level, depth-N", groupBy)
+}
+
+// groupChanges buckets changes by their first depth path segments.
+// Groups keep the order in which they first appear.
+func groupChanges(changes []diff.Change, depth int) []changeGroup {
+	var groups []changeGroup
+	index := make(map[string]int)
+
+	for _, change := range changes {
+		key := groupKey(change.Path, depth)
+		i, exists := index[key]
+		if !exists {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, changeGroup{name: key})
+		}
+		groups[i].changes = append(groups[i].changes, change)
+	}
+
+	return groups
+}
+
+// groupKey returns the group header for a path, e.g. "spec/" for depth 1.
+// The leaf segment is never part of the key, so top-level keys group under "/".
+func groupKey(path string, depth int) string {
+	segments := tree.ParsePath(path)
+	if len(segments) > 0 {
+		segments = segments[:len(segments)-1]
+	}
+	if len(segments) > depth {
+		segments = segments[:depth]
+	}
+	if len(segments) == 0 {
+		return "/"
+	}
+	return strings.Join(segments, "/") + "/"
+}
+
+// writeGroupedChanges renders changes under per-group headers with mini-summaries.
+// Each change is rendered by render and indented under its header.
+func writeGroupedChanges(b *reportWriter, changes []diff.Change, depth int, opts Options, render changeRenderer) {
+	p := newPalette(opts.NoColor)
+	groups := groupChanges(changes, depth)
+
+	for gi, group := range groups {
+		summary := summarizeChanges(group.changes)
+		noun := "changes"
+		if summary.Total == 1 {
+			noun = "change"
+		}
+		fmt.Fprintf(b, "%s (%d %s: %s)\n", p.path(group.name), summary.Total, noun, summaryParts(summary, p, symbolsFor(opts), false))
+
+		for i, change := range group.changes {
+			var rendered strings.Builder
+			render(&rendered, change)
+			for _, line := range strings.SplitAfter(rendered.String(), "\n") {
+				if line != "" {
+					b.WriteString("  " + line)
+				}
+			}
+			if !opts.Compact && i < len(group.changes)-1 {
+				b.WriteString("\n")
+			}
+		}
+
+		if !opts.Compact && gi < len(groups)-1 {
+			b.WriteString("\n")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// Markers wrapped around differing spans when colors are disabled.
+const (
+	inlineRemoveOpen  = "[-"
+	inlineRemoveClose = "-]"
+	inlineAddOpen     = "{+"
+	inlineAddClose    = "+}"
+)
+
+// formatModifyInline renders both sides of a modified string value with the
+// differing spans highlighted. It reports false when the change carries no
+// highlights or the value would be truncated, so callers fall back to the
+// plain rendering.
+func formatModifyInline(change diff.Change, opts Options, p palette) (oldVal, newVal string, ok bool) {
+	if len(change.OldHighlights) == 0 && len(change.NewHighlights) == 0 {
+		return "", "", false
+	}
+	if exceedsMaxLength(change.OldValue, opts.MaxValueLength) ||
+		exceedsMaxLength(change.NewValue, opts.MaxValueLength) {
+		return "", "", false
+	}
+
+	if opts.NoColor {
+		oldVal = highlightString(change.OldValue, change.OldHighlights, fmt.Sprint, markWith(inlineRemoveOpen, inlineRemoveClose))
+		newVal = highlightString(change.NewValue, change.NewHighlights, fmt.Sprint, markWith(inlineAddOpen, inlineAddClose))
+		return oldVal, newVal, true
+	}
+
+	oldVal = highlightString(change.OldValue, change.OldHighlights, p.remove, p.removeEmphasis)
+	newVal = highlightString(change.NewValue, change.NewHighlights, p.add, p.addEmphasis)
+	return oldVal, newVal, true
+}
+
+// exceedsMaxLength reports whether formatValue would truncate node.
+func exceedsMaxLength(node *tree.Node, maxLen int) bool {
+	return maxLen > 0 && len(formatValue(node, 0)) > maxLen
+}
+
+// highlightString quotes a string value like formatValue, styling unchanged
+// text with base and each span with emphasis. Spans are byte offsets into the
+// raw value and fall on character boundaries, so quoting piecewise produces
+// the same escapes as quoting the whole string.
+func highlightString(node *tree.Node, spans []diff.Span, base, emphasis func(a ...interface{}) string) string {
+	s, _ := node.Value.(string)
+
+	var b strings.Builder
+	b.WriteString(base(`"`))
+	pos := 0
+	for _, span := range spans {
+		if span.Start < pos || span.End > len(s) || span.Start > span.End {
+			continue
+		}
+		if span.Start > pos {
+			b.WriteString(base(quoteBody(s[pos:span.Start])))
+		}
+		b.WriteString(emphasis(quoteBody(s[span.Start:span.End])))
+		pos = span.End
+	}
+	if pos < len(s) {
+		b.WriteString(base(quoteBody(s[pos:])))
+	}
+	b.WriteString(base(`"`))
+	return b.String()
+}
+
+// quoteBody returns s quoted as a Go string literal, without the quotes.
+func quoteBody(s string) string {
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
+
+// markWith returns a styling function that wraps text in open and close markers.
+func markWith(open, close string) func(a ...interface{}) string {
+	return func(a ...interface{}) string {
+		return open + fmt.Sprint(a...) + close
+	}
+}
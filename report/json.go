@@ -0,0 +1,107 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// JSONSchemaVersion identifies the shape of JSONOutput. It changes only when
+// fields are renamed or removed; new optional fields keep the version.
+const JSONSchemaVersion = "1"
+
+// JSONOutput is the stable, versioned JSON document produced by GenerateJSON.
+// Its schema is published in docs/schema/output.v1.json.
+type JSONOutput struct {
+	SchemaVersion string       `json:"schemaVersion" jsonschema:"enum=1"`
+	Old           string       `json:"old"`
+	New           string       `json:"new"`
+	Summary       JSONSummary  `json:"summary"`
+	Changes       []JSONChange `json:"changes"`
+}
+
+// JSONSummary counts the changes in a JSONOutput by type. Hidden counts
+// changes excluded by Options.FilterTypes.
+type JSONSummary struct {
+	Total    int `json:"total"`
+	Added    int `json:"added"`
+	Removed  int `json:"removed"`
+	Modified int `json:"modified"`
+	Moved    int `json:"moved"`
+	Hidden   int `json:"hidden,omitempty"`
+}
+
+// JSONChange is a single change in a JSONOutput. Old and New hold the plain
+// JSON value and are omitted when absent, so a removed key and a key set to
+// null are distinguishable. OldLine and NewLine are the source lines, when
+// known.
+type JSONChange struct {
+	Type     string          `json:"type" jsonschema:"enum=add|remove|modify|move"`
+	Path     string          `json:"path"`
+	Old      json.RawMessage `json:"old,omitempty"`
+	New      json.RawMessage `json:"new,omitempty"`
+	Severity string          `json:"severity" jsonschema:"enum=warning|note|breaking|info"`
+	OldLine  int             `json:"oldLine,omitempty"`
+	NewLine  int             `json:"newLine,omitempty"`
+}
+
+// NewJSONOutput builds the stable JSON document for changes between oldFile
+// and newFile, honoring opts.FilterTypes and opts.Sort.
+func NewJSONOutput(changes []diff.Change, oldFile, newFile string, opts Options) (JSONOutput, error) {
+	selected, summary := selectChanges(changes, opts)
+
+	out := JSONOutput{
+		SchemaVersion: JSONSchemaVersion,
+		Old:           oldFile,
+		New:           newFile,
+		Summary:       jsonSummary(summary),
+		Changes:       make([]JSONChange, 0, len(selected)),
+	}
+
+	for _, change := range selected {
+		jc := JSONChange{
+			Type:     string(change.Type),
+			Path:     change.Path,
+			Severity: exportSeverity(change, opts),
+		}
+		var err error
+		if jc.Old, err = jsonValue(change.OldValue); err != nil {
+			return JSONOutput{}, fmt.Errorf("failed to encode old value at %s: %w", change.Path, err)
+		}
+		if jc.New, err = jsonValue(change.NewValue); err != nil {
+			return JSONOutput{}, fmt.Errorf("failed to encode new value at %s: %w", change.Path, err)
+		}
+		if change.OldValue != nil {
+			jc.OldLine = change.OldValue.Line
+		}
+		if change.NewValue != nil {
+			jc.NewLine = change.NewValue.Line
+		}
+		out.Changes = append(out.Changes, jc)
+	}
+
+	return out, nil
+}
+
+// GenerateJSON renders changes as an indented JSONOutput document.
+func GenerateJSON(changes []diff.Change, oldFile, newFile string, opts Options) (string, error) {
+	out, err := NewJSONOutput(changes, oldFile, newFile, opts)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON output: %w", err)
+	}
+	return string(data), nil
+}
+
+// jsonValue encodes a node as plain JSON, or returns nil when node is absent.
+func jsonValue(node *tree.Node) (json.RawMessage, error) {
+	if node == nil {
+		return nil, nil
+	}
+	return json.Marshal(node.ToInterface())
+}
@@ -0,0 +1,156 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// GenerateMarkdown creates a Markdown report suitable for PR descriptions and chat.
+// Changes are rendered as a table with code-formatted paths and values.
+func GenerateMarkdown(changes []diff.Change, opts Options) string {
+	if len(changes) == 0 {
+		return "No changes detected.\n"
+	}
+	changes, summary := selectChanges(changes, opts)
+	if len(changes) == 0 {
+		return noMatchingChanges(summary.Hidden)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(formatMarkdownSummary(summary))
+	b.WriteString("\n")
+
+	b.WriteString(markdownTableHeader(opts))
+
+	changes, more := limitChanges(changes, opts.MaxChanges)
+	for _, change := range changes {
+		b.WriteString(markdownRow(change, opts))
+	}
+	if more > 0 {
+		b.WriteString(markdownMoreNotice(more))
+	}
+
+	return b.String()
+}
+
+// markdownMoreNotice renders moreChangesNotice as an italic line below a table.
+func markdownMoreNotice(more int) string {
+	return "\n_" + moreChangesNotice(more, unicodeSymbols) + "_\n"
+}
+
+// markdownTableHeader returns the header of the Path | Change | Old | New
+// table, with a Severity column under opts.ClassifySeverity.
+func markdownTableHeader(opts Options) string {
+	if opts.ClassifySeverity {
+		return "| Path | Change | Severity | Old | New |\n| --- | --- | --- | --- | --- |\n"
+	}
+	return "| Path | Change | Old | New |\n| --- | --- | --- | --- |\n"
+}
+
+// markdownRow renders a single change as a Markdown table row.
+func markdownRow(change diff.Change, opts Options) string {
+	oldVal := ""
+	newVal := ""
+	switch change.Type {
+	case diff.ChangeTypeAdd:
+		newVal = markdownValue(change.NewValue, opts)
+	case diff.ChangeTypeRemove:
+		oldVal = markdownValue(change.OldValue, opts)
+	case diff.ChangeTypeModify, diff.ChangeTypeMove:
+		oldVal = markdownValue(change.OldValue, opts)
+		newVal = markdownValue(change.NewValue, opts)
+	}
+
+	if opts.ClassifySeverity {
+		return fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+			markdownCode(change.Path), changeTypeLabel(change.Type), severityLabel(classifyChange(change, opts)), oldVal, newVal)
+	}
+	return fmt.Sprintf("| %s | %s | %s | %s |\n",
+		markdownCode(change.Path), changeTypeLabel(change.Type), oldVal, newVal)
+}
+
+// formatMarkdownSummary creates the bold summary line for Markdown output.
+func formatMarkdownSummary(s Summary) string {
+	parts := make([]string, 0, 4)
+	if s.Added > 0 {
+		parts = append(parts, fmt.Sprintf("+%d added", s.Added))
+	}
+	if s.Removed > 0 {
+		parts = append(parts, fmt.Sprintf("-%d removed", s.Removed))
+	}
+	if s.Modified > 0 {
+		parts = append(parts, fmt.Sprintf("~%d modified", s.Modified))
+	}
+	if s.Moved > 0 {
+		parts = append(parts, fmt.Sprintf("↔%d moved", s.Moved))
+	}
+	return fmt.Sprintf("**Summary:** %s (%s)\n", strings.Join(parts, ", "), s.totalLabel())
+}
+
+// changeTypeLabel returns a human-readable label for a change type.
+func changeTypeLabel(ct diff.ChangeType) string {
+	switch ct {
+	case diff.ChangeTypeAdd:
+		return "added"
+	case diff.ChangeTypeRemove:
+		return "removed"
+	case diff.ChangeTypeModify:
+		return "modified"
+	case diff.ChangeTypeMove:
+		return "moved"
+	default:
+		return string(ct)
+	}
+}
+
+// markdownValue renders a value for a Markdown table cell.
+// With CollapseLongValues set, values longer than MaxValueLength are shown
+// truncated with the full value behind a <details> block.
+func markdownValue(node *tree.Node, opts Options) string {
+	if !opts.CollapseLongValues || opts.MaxValueLength <= 0 {
+		return markdownCode(formatValueStyle(node, opts.MaxValueLength, opts.ValueStyle))
+	}
+
+	full := formatValueStyle(node, 0, opts.ValueStyle)
+	if len(full) <= opts.MaxValueLength {
+		return markdownCode(full)
+	}
+
+	short := formatValueStyle(node, opts.MaxValueLength, opts.ValueStyle)
+	escaped := strings.ReplaceAll(html.EscapeString(full), "|", "&#124;")
+	escaped = strings.ReplaceAll(escaped, "\n", "<br>")
+	return fmt.Sprintf("<details><summary>%s</summary><code>%s</code></details>",
+		markdownCode(short), escaped)
+}
+
+// markdownCode wraps s in an inline code span that is safe inside a table cell.
+// Pipes are escaped, newlines are flattened, and the backtick fence is made
+// longer than any backtick run in s.
+func markdownCode(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	s = strings.ReplaceAll(s, "|", "\\|")
+
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	if longest == 0 {
+		return "`" + s + "`"
+	}
+
+	fence := strings.Repeat("`", longest+1)
+	return fence + " " + s + " " + fence
+}
@@ -0,0 +1,212 @@
+package report
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// Masking modes for Options.MaskMode.
+const (
+	// MaskModeRedact replaces masked values with MaskPlaceholder.
+	MaskModeRedact = "redact"
+
+	// MaskModeHash replaces masked values with "hmac:<prefix>" so equal
+	// secrets can still be recognized without revealing them. The hash is
+	// keyed at random for each run, so it only matches within one run.
+	MaskModeHash = "hash"
+)
+
+// MaskPlaceholder is the replacement text for redacted values.
+const MaskPlaceholder = "********"
+
+// maskHashPrefixLen is the number of hex digits kept from a value's hash.
+const maskHashPrefixLen = 12
+
+// maskHashKey keys the HMAC of values masked in hash mode. It is random
+// for each run, since an unkeyed hash of a low-entropy secret, such as a
+// short password or a PIN, can be reversed by hashing guesses.
+var maskHashKey = newMaskHashKey()
+
+// newMaskHashKey returns a random key for maskHashKey.
+func newMaskHashKey() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("report: cannot generate mask hash key: %v", err))
+	}
+	return key
+}
+
+// secretKeyPattern matches keys that commonly hold credentials.
+var secretKeyPattern = regexp.MustCompile(`(?i)password|secret|token|api[-_]?key`)
+
+// ValidateMaskMode returns an error if mode is not a supported masking mode.
+// The empty string is accepted and means MaskModeRedact.
+func ValidateMaskMode(mode string) error {
+	switch mode {
+	case "", MaskModeRedact, MaskModeHash:
+		return nil
+	default:
+		return fmt.Errorf("invalid mask mode %q (valid: %s, %s)", mode, MaskModeRedact, MaskModeHash)
+	}
+}
+
+// masking reports whether opts asks for any values to be masked.
+func (opts Options) masking() bool {
+	return opts.MaskSecrets || len(opts.MaskPaths) > 0
+}
+
+// MaskChanges returns a copy of changes with sensitive values replaced
+// according to opts.MaskPaths, opts.MaskSecrets, and opts.MaskMode.
+// A value is sensitive if its path matches a MaskPaths glob or, with
+// MaskSecrets, its key looks like a credential. Values nested inside added or
+// removed objects are masked too. Change types are preserved, so a modified
+// secret is still reported as modified, just without the plaintext.
+//
+// Masking is not idempotent in hash mode; apply it once, before rendering.
+func MaskChanges(changes []diff.Change, opts Options) []diff.Change {
+	if !opts.masking() {
+		return changes
+	}
+
+	masked := make([]diff.Change, len(changes))
+	for i, change := range changes {
+		oldVal := maskNode(change.OldValue, change.Path, opts)
+		newVal := maskNode(change.NewValue, change.Path, opts)
+		if oldVal != change.OldValue || newVal != change.NewValue {
+			// Highlights index into the plaintext and must not leak it
+			change.OldHighlights = nil
+			change.NewHighlights = nil
+		}
+		change.OldValue = oldVal
+		change.NewValue = newVal
+		masked[i] = change
+	}
+	return masked
+}
+
+// MaskTree returns a copy of the document rooted at node with sensitive
+// values masked as in MaskChanges. The input tree is not modified.
+func MaskTree(node *tree.Node, opts Options) *tree.Node {
+	if !opts.masking() {
+		return node
+	}
+	return maskNode(node, "/", opts)
+}
+
+// maskNode masks node (located at path) or any sensitive descendants. It
+// returns node itself when nothing needed masking.
+func maskNode(node *tree.Node, path string, opts Options) *tree.Node {
+	if node == nil {
+		return nil
+	}
+	if isSensitivePath(path, opts) {
+		masked := tree.NewString(maskValue(node, opts.MaskMode))
+		masked.Line = node.Line
+		return masked
+	}
+
+	switch node.Kind {
+	case tree.KindObject:
+		var out *tree.Node
+		for k, v := range node.Object {
+			mv := maskNode(v, childPath(path, k), opts)
+			if mv == v {
+				continue
+			}
+			if out == nil {
+				out = shallowCopy(node)
+			}
+			out.Object[k] = mv
+		}
+		if out != nil {
+			return out
+		}
+
+	case tree.KindArray:
+		var out *tree.Node
+		for i, v := range node.Array {
+			mv := maskNode(v, fmt.Sprintf("%s[%d]", path, i), opts)
+			if mv == v {
+				continue
+			}
+			if out == nil {
+				out = shallowCopy(node)
+			}
+			out.Array[i] = mv
+		}
+		if out != nil {
+			return out
+		}
+	}
+
+	return node
+}
+
+// isSensitivePath reports whether the value at path must be masked.
+func isSensitivePath(path string, opts Options) bool {
+	for _, pattern := range opts.MaskPaths {
+		if diff.MatchPath(path, pattern) {
+			return true
+		}
+	}
+	if !opts.MaskSecrets {
+		return false
+	}
+
+	segments := tree.ParsePath(path)
+	if len(segments) == 0 {
+		return false
+	}
+	key := segments[len(segments)-1]
+	if i := strings.Index(key, "["); i >= 0 {
+		key = key[:i]
+	}
+	return secretKeyPattern.MatchString(key)
+}
+
+// maskValue returns the replacement text for a sensitive value.
+func maskValue(node *tree.Node, mode string) string {
+	if mode != MaskModeHash {
+		return MaskPlaceholder
+	}
+	// Hash the canonical JSON so equal values hash equally across formats
+	data, err := json.Marshal(node.ToInterface())
+	if err != nil {
+		return MaskPlaceholder
+	}
+	mac := hmac.New(sha256.New, maskHashKey)
+	mac.Write(data)
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:maskHashPrefixLen]
+}
+
+// childPath joins an object key onto path.
+func childPath(path, key string) string {
+	if path == "" || path == "/" {
+		return "/" + key
+	}
+	return path + "/" + key
+}
+
+// shallowCopy copies a container node's own map or slice, sharing children.
+func shallowCopy(node *tree.Node) *tree.Node {
+	out := &tree.Node{Kind: node.Kind, Value: node.Value, Path: node.Path, Line: node.Line}
+	if node.Object != nil {
+		out.Object = make(map[string]*tree.Node, len(node.Object))
+		for k, v := range node.Object {
+			out.Object[k] = v
+		}
+	}
+	if node.Array != nil {
+		out.Array = append([]*tree.Node(nil), node.Array...)
+	}
+	return out
+}
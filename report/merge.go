@@ -0,0 +1,93 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// GenerateConflicts lists the conflicts of a three-way merge of oursFile and
+// theirsFile with the base, ours, and theirs value of each, e.g.
+//
+//	Merge conflicts: 1 path changed in both ours.yaml and theirs.yaml
+//
+//	  /spec/replicas
+//	    base:   2
+//	    ours:   3
+//	    theirs: 4
+func GenerateConflicts(conflicts []diff.Conflict, oursFile, theirsFile string, opts Options) string {
+	if len(conflicts) == 0 {
+		return "No conflicts.\n"
+	}
+
+	p := newPalette(opts.NoColor)
+	noun := "paths"
+	if len(conflicts) == 1 {
+		noun = "path"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Merge conflicts: %d %s changed in both %s and %s\n", len(conflicts), noun, oursFile, theirsFile)
+	for _, c := range conflicts {
+		b.WriteString("\n  " + p.path(displayPath(c.Path, opts)) + "\n")
+		b.WriteString("    base:   " + p.dim(conflictValue(c.Base, opts)) + "\n")
+		b.WriteString("    ours:   " + p.remove(conflictValue(c.Ours, opts)) + "\n")
+		b.WriteString("    theirs: " + p.add(conflictValue(c.Theirs, opts)) + "\n")
+	}
+	return b.String()
+}
+
+// conflictValue renders one side of a conflict, which may be absent.
+func conflictValue(node *tree.Node, opts Options) string {
+	if node == nil {
+		return "(absent)"
+	}
+	return formatValueStyle(node, opts.MaxValueLength, opts.ValueStyle)
+}
+
+// GenerateConflictMarkers combines two renderings of the same merged
+// document, one with conflicts resolved to ours and one to theirs, into a
+// single document with git-style conflict markers around the lines that
+// differ:
+//
+//	<<<<<<< ours.yaml
+//	replicas: 3
+//	=======
+//	replicas: 4
+//	>>>>>>> theirs.yaml
+func GenerateConflictMarkers(oursDoc, theirsDoc, oursLabel, theirsLabel string) string {
+	var b strings.Builder
+	var ours, theirs []string
+	flush := func() {
+		if len(ours) == 0 && len(theirs) == 0 {
+			return
+		}
+		b.WriteString("<<<<<<< " + oursLabel + "\n")
+		for _, line := range ours {
+			b.WriteString(line + "\n")
+		}
+		b.WriteString("=======\n")
+		for _, line := range theirs {
+			b.WriteString(line + "\n")
+		}
+		b.WriteString(">>>>>>> " + theirsLabel + "\n")
+		ours, theirs = nil, nil
+	}
+
+	for _, op := range diffLines(splitLines(oursDoc), splitLines(theirsDoc)) {
+		switch op.kind {
+		case '-':
+			ours = append(ours, op.text)
+		case '+':
+			theirs = append(theirs, op.text)
+		default:
+			flush()
+			b.WriteString(op.text + "\n")
+		}
+	}
+	flush()
+
+	return b.String()
+}
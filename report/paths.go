@@ -0,0 +1,45 @@
+package report
+
+import "strings"
+
+// DefaultMaxPathSegments is the path depth the CLI shortens human-readable
+// output to, unless --full-paths is given.
+const DefaultMaxPathSegments = 5
+
+// shortenPath elides the middle segments of a path deeper than max,
+// keeping the first max/2 segments and the rest from the end, e.g. with max 3
+//
+//	/spec/template/spec/containers[0]/livenessProbe/httpGet/httpHeaders[2]/value
+//
+// becomes /spec/…/httpHeaders[2]/value. Array indices stay attached to their
+// key. The result depends only on path and max, so a path shortens the same
+// way everywhere it appears. A max of 0 or less returns path unchanged.
+func shortenPath(path string, max int, sym symbolSet) string {
+	if max <= 0 {
+		return path
+	}
+	rooted := strings.HasPrefix(path, "/")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) <= max {
+		return path
+	}
+
+	head := max / 2
+	tail := max - head
+	kept := make([]string, 0, max+1)
+	kept = append(kept, segments[:head]...)
+	kept = append(kept, sym.ellipsis)
+	kept = append(kept, segments[len(segments)-tail:]...)
+
+	short := strings.Join(kept, "/")
+	if rooted {
+		short = "/" + short
+	}
+	return short
+}
+
+// displayPath returns path as shown by the human-readable formats, shortened
+// to opts.MaxPathSegments.
+func displayPath(path string, opts Options) string {
+	return shortenPath(path, opts.MaxPathSegments, symbolsFor(opts))
+}
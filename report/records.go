@@ -0,0 +1,125 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// FileChanges pairs a file name with the changes found in it.
+type FileChanges struct {
+	File    string
+	Changes []diff.Change
+}
+
+// RecordColumns are the CSV header columns and NDJSON field names, in order.
+// They are part of the stable export format and must not be renamed.
+var RecordColumns = []string{"file", "type", "path", "old", "new", "severity"}
+
+// changeRecord is one change in CSV and NDJSON exports.
+type changeRecord struct {
+	File     string `json:"file"`
+	Type     string `json:"type"`
+	Path     string `json:"path"`
+	Old      string `json:"old"`
+	New      string `json:"new"`
+	Severity string `json:"severity"`
+}
+
+// GenerateCSV exports changes as CSV with a header row of RecordColumns:
+//
+//	file      the file the change belongs to
+//	type      add, remove, modify, or move
+//	path      the changed path, e.g. /spec/replicas
+//	old, new  the values; strings as-is, other values as compact JSON,
+//	          empty when absent
+//	severity  warning (remove, modify) or note (add, move); breaking,
+//	          warning, or info under Options.ClassifySeverity
+//
+// Rows follow the order of files and, within a file, of SelectChanges.
+func GenerateCSV(files []FileChanges, opts Options) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(RecordColumns); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
+	}
+	for _, rec := range changeRecords(files, opts) {
+		row := []string{rec.File, rec.Type, rec.Path, rec.Old, rec.New, rec.Severity}
+		if err := w.Write(row); err != nil {
+			return "", fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// GenerateNDJSON exports changes as newline-delimited JSON, one flat object
+// per change with the fields described for GenerateCSV.
+func GenerateNDJSON(files []FileChanges, opts Options) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	for _, rec := range changeRecords(files, opts) {
+		if err := enc.Encode(rec); err != nil {
+			return "", fmt.Errorf("failed to encode NDJSON: %w", err)
+		}
+	}
+	return buf.String(), nil
+}
+
+// changeRecords flattens files into export records.
+func changeRecords(files []FileChanges, opts Options) []changeRecord {
+	var records []changeRecord
+	for _, f := range files {
+		for _, change := range SelectChanges(f.Changes, opts) {
+			records = append(records, changeRecord{
+				File:     f.File,
+				Type:     string(change.Type),
+				Path:     change.Path,
+				Old:      recordValue(change.OldValue),
+				New:      recordValue(change.NewValue),
+				Severity: exportSeverity(change, opts),
+			})
+		}
+	}
+	return records
+}
+
+// recordValue renders a value for export: strings verbatim, everything else
+// as compact JSON, and "" when there is no value.
+func recordValue(node *tree.Node) string {
+	if node == nil {
+		return ""
+	}
+	if node.Kind == tree.KindString {
+		if s, ok := node.Value.(string); ok {
+			return s
+		}
+	}
+	data, err := json.Marshal(node.ToInterface())
+	if err != nil {
+		return fmt.Sprintf("%v", node.Value)
+	}
+	return string(data)
+}
+
+// changeSeverity rates a change type: "warning" for changes that can break
+// consumers (removals and modifications), "note" otherwise.
+func changeSeverity(ct diff.ChangeType) string {
+	switch ct {
+	case diff.ChangeTypeRemove, diff.ChangeTypeModify:
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -3,10 +3,10 @@ package report
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/fatih/color"
 	"github.com/pfrederiksen/configdiff/diff"
 	"github.com/pfrederiksen/configdiff/tree"
 )
@@ -23,11 +23,121 @@ type Options struct {
 	// Values longer than this are truncated. 0 means no limit.
 	MaxValueLength int
 
-	// ContextLines shows N lines of context around changes (not implemented yet).
+	// ContextLines shows up to N unchanged sibling keys before and after
+	// each change in GenerateWithContext, and N lines of context in
+	// GenerateUnified (DefaultUnifiedContext when 0).
 	ContextLines int
 
-	// NoColor disables colored output.
+	// NoColor disables colored output. When false, ANSI color codes are
+	// always emitted; callers decide based on the terminal and environment.
 	NoColor bool
+
+	// GroupBy buckets changes under per-section headers in Generate.
+	// One of "none" (default), "top-level", or "depth-N".
+	GroupBy string
+
+	// Width is the terminal width in cells for column-based layouts such as
+	// side-by-side. 0 means DefaultWidth.
+	Width int
+
+	// ASCIIOnly replaces arrows, the move symbol, and box-drawing
+	// characters with plain ASCII ("->", "<->", "-", "|") in the terminal
+	// formats: Generate, GenerateSideBySide, GenerateTree, and
+	// GenerateGitDiffWithOptions. The +, -, and ~ symbols are unchanged.
+	ASCIIOnly bool
+
+	// CollapseLongValues hides values longer than MaxValueLength behind a
+	// <details> block in Markdown output instead of truncating them.
+	CollapseLongValues bool
+
+	// InlineDiff highlights the differing words of modified string values
+	// in the detailed report, using colors or [-old-]{+new+} markers.
+	InlineDiff bool
+
+	// MaskPaths lists path globs whose values are masked by MaskChanges.
+	MaskPaths []string
+
+	// MaskSecrets also masks values whose key looks like a credential
+	// (password, secret, token, apikey; case-insensitive).
+	MaskSecrets bool
+
+	// MaskMode selects how masked values are shown: MaskModeRedact
+	// (default) or MaskModeHash.
+	MaskMode string
+
+	// Sort orders the rendered changes: SortPath, SortType, or
+	// SortSeverity. Empty keeps the order produced by the diff.
+	Sort string
+
+	// FilterTypes limits the rendered changes to these types. Empty shows
+	// all changes. The summary reports both shown and total counts.
+	FilterTypes []diff.ChangeType
+
+	// MaxChanges renders only the first N changes (after sorting) followed
+	// by a note counting the rest. The summary still reflects all changes.
+	// 0 means no limit. Used by Generate, GenerateMarkdown, and
+	// GenerateGitHubComment.
+	MaxChanges int
+
+	// OldFile and NewFile name the compared files. When either is set,
+	// Generate starts with a "Comparing old → new" header so that
+	// concatenated reports stay unambiguous.
+	OldFile string
+	NewFile string
+
+	// ShowLineNumbers appends the source location, e.g. "(new.yaml:42)", to
+	// each change in Generate when the parser recorded line numbers.
+	// Removals point into OldFile, everything else into NewFile.
+	ShowLineNumbers bool
+
+	// AnnotationLevels overrides the workflow command used per change kind
+	// by GenerateGitHubAnnotations, keyed by change type or
+	// AnnotationTypeChange. See ParseAnnotationLevels.
+	AnnotationLevels map[string]string
+
+	// ExpandContainers renders added and removed objects and arrays as
+	// indented YAML nested under their change line in Generate, instead of
+	// only "{...} (N keys)". Modified containers are not expanded; their
+	// child-level changes already show what differs.
+	ExpandContainers bool
+
+	// ExpandLimit is the largest container, in nodes, that ExpandContainers
+	// renders. 0 means DefaultExpandLimit.
+	ExpandLimit int
+
+	// MaxPathSegments shortens paths deeper than this many segments in
+	// Generate, GenerateSideBySide, and GenerateTree by eliding the middle
+	// ones, e.g. /spec/…/httpHeaders[2]/value. Machine-readable formats
+	// always use full paths. 0 means no limit.
+	MaxPathSegments int
+
+	// ShowLegend starts Generate output with a line explaining the change
+	// symbols: "+ added  - removed  ~ modified  ↔ moved".
+	ShowLegend bool
+
+	// IncludeZeroCounts lists every change type in summary lines, including
+	// those with no changes, e.g. "+0 added, -1 removed, ~0 modified, ↔0
+	// moved", so that tools parsing the line always see the same shape.
+	IncludeZeroCounts bool
+
+	// ValueStyle selects how values are rendered in the human-readable
+	// formats: ValueStyleAuto (the default when empty), ValueStyleJSON,
+	// ValueStyleYAML, or ValueStyleGo. MaxValueLength applies to the styled
+	// text.
+	ValueStyle string
+
+	// ClassifySeverity rates each change with ClassifyChange. Generate
+	// colors changes red, yellow, or blue by severity and marks them with
+	// an icon, or a [BREAKING], [WARN], or [INFO] tag under ASCIIOnly;
+	// Markdown tables gain a Severity column; exports report the
+	// classified severity; and SortSeverity orders by it. When unset,
+	// output is colored by change type.
+	ClassifySeverity bool
+
+	// SeverityRules rate the changes at the paths they match instead of
+	// ClassifyChange under ClassifySeverity; the last rule matching a path
+	// wins. See ValidateSeverityRules.
+	SeverityRules []SeverityRule
 }
 
 // DefaultOptions returns sensible defaults for report generation.
@@ -37,28 +147,55 @@ func DefaultOptions() Options {
 		ShowValues:     true,
 		MaxValueLength: 80,
 		ContextLines:   0,
+		NoColor:        true,
+		InlineDiff:     true,
 	}
 }
 
 // Generate creates a human-friendly report from changes.
 func Generate(changes []diff.Change, opts Options) string {
-	if len(changes) == 0 {
-		return "No changes detected.\n"
-	}
+	return GenerateWithContext(changes, nil, nil, opts)
+}
 
-	// Save original color.NoColor value to restore later
-	originalNoColor := color.NoColor
-	defer func() { color.NoColor = originalNoColor }()
+// GenerateWithContext is like Generate, but also shows up to
+// opts.ContextLines unchanged sibling keys around each change, taken from
+// newTree (or oldTree for removed sections), so the reader can see where in
+// the document the change sits. Trees may be nil, which disables context.
+func GenerateWithContext(changes []diff.Change, oldTree, newTree *tree.Node, opts Options) string {
+	var b strings.Builder
+	// A strings.Builder never fails to write
+	_ = WriteReportWithContext(&b, changes, oldTree, newTree, opts)
+	return b.String()
+}
 
-	// Disable color if requested or if NO_COLOR env var is set
-	if opts.NoColor || os.Getenv("NO_COLOR") != "" {
-		color.NoColor = true
-	}
+// WriteReport writes the report produced by Generate to w, one change at a
+// time, so large reports are never held in memory in full. It returns the
+// first error from w.
+func WriteReport(w io.Writer, changes []diff.Change, opts Options) error {
+	return WriteReportWithContext(w, changes, nil, nil, opts)
+}
 
-	var b strings.Builder
+// WriteReportWithContext writes the report produced by GenerateWithContext
+// to w. It returns the first error from w.
+func WriteReportWithContext(w io.Writer, changes []diff.Change, oldTree, newTree *tree.Node, opts Options) error {
+	b := &reportWriter{w: w}
+	b.WriteString(formatFileHeader(opts))
+	if len(changes) == 0 {
+		b.WriteString("No changes detected.\n")
+		return b.err
+	}
+	// Filtered-out changes are still changes and must not appear as context
+	render := contextRenderer(changes, oldTree, newTree, opts)
+	changes, summary := selectChanges(changes, opts)
+	if len(changes) == 0 {
+		b.WriteString(noMatchingChanges(summary.Hidden))
+		return b.err
+	}
 
-	// Write summary
-	summary := summarizeChanges(changes)
+	// Write legend and summary
+	if opts.ShowLegend {
+		b.WriteString(formatLegend(opts))
+	}
 	b.WriteString(formatSummary(summary, opts))
 
 	if !opts.Compact {
@@ -66,15 +203,67 @@ func Generate(changes []diff.Change, opts Options) string {
 	}
 
 	// Write detailed changes
+	changes, more := limitChanges(changes, opts.MaxChanges)
 	b.WriteString("Changes:\n")
-	for i, change := range changes {
-		b.WriteString(formatChange(change, opts))
-		if !opts.Compact && i < len(changes)-1 {
+	if depth, err := ParseGroupBy(opts.GroupBy); err == nil && depth > 0 {
+		writeGroupedChanges(b, changes, depth, opts, render)
+	} else {
+		for i, change := range changes {
+			if b.err != nil {
+				return b.err
+			}
+			render(b, change)
+			if !opts.Compact && i < len(changes)-1 {
+				b.WriteString("\n")
+			}
+		}
+	}
+
+	if more > 0 {
+		if !opts.Compact {
 			b.WriteString("\n")
 		}
+		b.WriteString("  " + moreChangesNotice(more, symbolsFor(opts)) + "\n")
 	}
 
-	return b.String()
+	return b.err
+}
+
+// reportWriter writes to an io.Writer, remembering the first error so that
+// report code can write unconditionally and check once at the end.
+type reportWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Write implements io.Writer. After a failure it discards p.
+func (rw *reportWriter) Write(p []byte) (int, error) {
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	var n int
+	n, rw.err = rw.w.Write(p)
+	return n, rw.err
+}
+
+// WriteString writes s, recording any error.
+func (rw *reportWriter) WriteString(s string) {
+	if rw.err == nil {
+		_, rw.err = io.WriteString(rw.w, s)
+	}
+}
+
+// formatFileHeader names the compared files, or returns "" when
+// Options.OldFile and Options.NewFile are both empty.
+func formatFileHeader(opts Options) string {
+	if opts.OldFile == "" && opts.NewFile == "" {
+		return ""
+	}
+	header := newPalette(opts.NoColor).path(fmt.Sprintf("Comparing %s %s %s", opts.OldFile, symbolsFor(opts).arrow, opts.NewFile)) + "\n"
+	if !opts.Compact {
+		header += "\n"
+	}
+	return header
 }
 
 // Summary holds statistics about changes.
@@ -84,6 +273,15 @@ type Summary struct {
 	Removed  int
 	Modified int
 	Moved    int
+
+	// Hidden counts changes excluded by Options.FilterTypes; they are not
+	// included in Total or the per-type counts.
+	Hidden int
+}
+
+// Summarize counts changes by type.
+func Summarize(changes []diff.Change) Summary {
+	return summarizeChanges(changes)
 }
 
 // summarizeChanges counts changes by type.
@@ -109,78 +307,135 @@ func summarizeChanges(changes []diff.Change) Summary {
 
 // formatSummary creates a summary header.
 func formatSummary(s Summary, opts Options) string {
-	parts := make([]string, 0, 4)
+	p := newPalette(opts.NoColor)
+	return fmt.Sprintf("Summary: %s (%s)\n", summaryParts(s, p, symbolsFor(opts), opts.IncludeZeroCounts), s.totalLabel())
+}
 
-	green := color.New(color.FgGreen).SprintFunc()
-	red := color.New(color.FgRed).SprintFunc()
-	yellow := color.New(color.FgYellow).SprintFunc()
-	cyan := color.New(color.FgCyan).SprintFunc()
+// formatLegend creates the line explaining the change symbols.
+func formatLegend(opts Options) string {
+	p := newPalette(opts.NoColor)
+	sym := symbolsFor(opts)
+	return strings.Join([]string{
+		p.add(sym.change(diff.ChangeTypeAdd)) + " added",
+		p.remove(sym.change(diff.ChangeTypeRemove)) + " removed",
+		p.modify(sym.change(diff.ChangeTypeModify)) + " modified",
+		p.move(sym.change(diff.ChangeTypeMove)) + " moved",
+	}, "  ") + "\n"
+}
 
-	if s.Added > 0 {
-		parts = append(parts, green(fmt.Sprintf("+%d added", s.Added)))
+// totalLabel returns "N total", or "N shown, M total" when changes were hidden.
+func (s Summary) totalLabel() string {
+	if s.Hidden > 0 {
+		return fmt.Sprintf("%d shown, %d total", s.Total, s.Total+s.Hidden)
 	}
-	if s.Removed > 0 {
-		parts = append(parts, red(fmt.Sprintf("-%d removed", s.Removed)))
+	return fmt.Sprintf("%d total", s.Total)
+}
+
+// summaryParts lists the non-zero change counts, e.g. "+1 added, ~2 modified",
+// or every count when all is set.
+func summaryParts(s Summary, p palette, sym symbolSet, all bool) string {
+	parts := make([]string, 0, 4)
+
+	if s.Added > 0 || all {
+		parts = append(parts, p.add(fmt.Sprintf("+%d added", s.Added)))
+	}
+	if s.Removed > 0 || all {
+		parts = append(parts, p.remove(fmt.Sprintf("-%d removed", s.Removed)))
 	}
-	if s.Modified > 0 {
-		parts = append(parts, yellow(fmt.Sprintf("~%d modified", s.Modified)))
+	if s.Modified > 0 || all {
+		parts = append(parts, p.modify(fmt.Sprintf("~%d modified", s.Modified)))
 	}
-	if s.Moved > 0 {
-		parts = append(parts, cyan(fmt.Sprintf("↔%d moved", s.Moved)))
+	if s.Moved > 0 || all {
+		parts = append(parts, p.move(fmt.Sprintf("%s%d moved", sym.move, s.Moved)))
 	}
 
-	summary := strings.Join(parts, ", ")
-	return fmt.Sprintf("Summary: %s (%d total)\n", summary, s.Total)
+	return strings.Join(parts, ", ")
 }
 
 // formatChange creates a formatted string for a single change.
 func formatChange(change diff.Change, opts Options) string {
 	var b strings.Builder
+	writeChange(&b, change, opts, newPalette(opts.NoColor))
+	return b.String()
+}
 
-	// Color functions
-	green := color.New(color.FgGreen).SprintFunc()
-	red := color.New(color.FgRed).SprintFunc()
-	yellow := color.New(color.FgYellow).SprintFunc()
-	cyan := color.New(color.FgCyan).SprintFunc()
-
+// writeChange writes the line for a single change to w.
+func writeChange(w io.Writer, change diff.Change, opts Options, p palette) {
 	// Change type symbol and path with color
-	symbol := getChangeSymbol(change.Type)
-	var coloredSymbol string
-	switch change.Type {
-	case diff.ChangeTypeAdd:
-		coloredSymbol = green(symbol)
-	case diff.ChangeTypeRemove:
-		coloredSymbol = red(symbol)
-	case diff.ChangeTypeModify:
-		coloredSymbol = yellow(symbol)
-	case diff.ChangeTypeMove:
-		coloredSymbol = cyan(symbol)
-	default:
-		coloredSymbol = symbol
+	sym := symbolsFor(opts)
+	symbol := p.forType(change.Type)(sym.change(change.Type))
+	if opts.ClassifySeverity {
+		severity := classifyChange(change, opts)
+		style := p.forSeverity(severity)
+		symbol = style(severityMarker(severity, opts)) + " " + style(sym.change(change.Type))
 	}
-
-	b.WriteString(fmt.Sprintf("  %s %s", coloredSymbol, change.Path))
+	fmt.Fprintf(w, "  %s %s", symbol, p.path(displayPath(change.Path, opts)))
 
 	// Add values if requested
 	if opts.ShowValues {
 		switch change.Type {
 		case diff.ChangeTypeAdd:
-			val := formatValue(change.NewValue, opts.MaxValueLength)
-			b.WriteString(fmt.Sprintf(" = %s", green(val)))
+			val := formatValueStyle(change.NewValue, opts.MaxValueLength, opts.ValueStyle)
+			fmt.Fprintf(w, " = %s", p.add(val))
 
 		case diff.ChangeTypeRemove:
-			val := formatValue(change.OldValue, opts.MaxValueLength)
-			b.WriteString(fmt.Sprintf(" (was: %s)", red(val)))
+			val := formatValueStyle(change.OldValue, opts.MaxValueLength, opts.ValueStyle)
+			fmt.Fprint(w, p.dim(" (was: "+val+")"))
 
 		case diff.ChangeTypeModify:
-			oldVal := formatValue(change.OldValue, opts.MaxValueLength)
-			newVal := formatValue(change.NewValue, opts.MaxValueLength)
-			b.WriteString(fmt.Sprintf(": %s → %s", red(oldVal), green(newVal)))
+			// Inline highlights are positioned within Go-quoted strings
+			if opts.InlineDiff && (opts.ValueStyle == "" || opts.ValueStyle == ValueStyleAuto) {
+				if oldVal, newVal, ok := formatModifyInline(change, opts, p); ok {
+					fmt.Fprintf(w, ": %s %s %s", oldVal, sym.arrow, newVal)
+					break
+				}
+			}
+			oldVal := formatValueStyle(change.OldValue, opts.MaxValueLength, opts.ValueStyle)
+			newVal := formatValueStyle(change.NewValue, opts.MaxValueLength, opts.ValueStyle)
+			fmt.Fprintf(w, ": %s %s %s", p.remove(oldVal), sym.arrow, p.add(newVal))
 		}
 	}
 
-	b.WriteString("\n")
-	return b.String()
+	if opts.ShowLineNumbers {
+		if loc := changeLocation(change, opts); loc != "" {
+			fmt.Fprint(w, p.dim(" ("+loc+")"))
+		}
+	}
+
+	fmt.Fprint(w, "\n")
+
+	if opts.ShowValues {
+		switch change.Type {
+		case diff.ChangeTypeAdd:
+			if !writeExpandedValue(w, change.NewValue, opts, p.add) {
+				writeYAMLBlock(w, change.NewValue, "", opts, p.add)
+			}
+		case diff.ChangeTypeRemove:
+			if !writeExpandedValue(w, change.OldValue, opts, p.remove) {
+				writeYAMLBlock(w, change.OldValue, "", opts, p.remove)
+			}
+		case diff.ChangeTypeModify:
+			writeYAMLBlock(w, change.OldValue, "old", opts, p.remove)
+			writeYAMLBlock(w, change.NewValue, "new", opts, p.add)
+		}
+	}
+}
+
+// changeLocation returns where change appears in the source, e.g.
+// "new.yaml:42", or "" when no line number is known. Removals are located
+// in the old file; other changes in the new file, falling back to the old.
+func changeLocation(change diff.Change, opts Options) string {
+	file, node := opts.NewFile, change.NewValue
+	if change.Type == diff.ChangeTypeRemove || node == nil || node.Line == 0 {
+		file, node = opts.OldFile, change.OldValue
+	}
+	if node == nil || node.Line == 0 {
+		return ""
+	}
+	if file == "" {
+		return fmt.Sprintf("line %d", node.Line)
+	}
+	return fmt.Sprintf("%s:%d", file, node.Line)
 }
 
 // getChangeSymbol returns a symbol for each change type.
@@ -241,13 +496,49 @@ func formatValue(node *tree.Node, maxLen int) string {
 	}
 
 	// Truncate if needed
-	if maxLen > 0 && len(val) > maxLen {
-		val = val[:maxLen-3] + "..."
+	if maxLen > 0 && utf8.RuneCountInString(val) > maxLen {
+		if node.Kind == tree.KindString {
+			s, _ := node.Value.(string)
+			return truncateQuoted(s, maxLen)
+		}
+		return truncateRunes(val, maxLen)
 	}
 
 	return val
 }
 
+// truncateRunes shortens val to maxLen runes ending in "...". Limits too
+// small to keep any text still show the ellipsis.
+func truncateRunes(val string, maxLen int) string {
+	keep := maxLen - len("...")
+	if keep <= 0 {
+		return "..."
+	}
+	return string([]rune(val)[:keep]) + "..."
+}
+
+// truncateQuoted quotes s like %q, shortened to maxLen runes with the
+// closing quote kept so the output stays balanced, e.g. "abc...". Escape
+// sequences are never split. The shortest result is "...", in quotes.
+func truncateQuoted(s string, maxLen int) string {
+	const tail = `..."`
+
+	var b strings.Builder
+	b.WriteString(`"`)
+	n := 1
+	for _, r := range s {
+		q := quoteBody(string(r))
+		w := utf8.RuneCountInString(q)
+		if n+w+len(tail) > maxLen {
+			break
+		}
+		b.WriteString(q)
+		n += w
+	}
+	b.WriteString(tail)
+	return b.String()
+}
+
 // GenerateCompact is a convenience function for compact reports.
 func GenerateCompact(changes []diff.Change) string {
 	opts := DefaultOptions()
@@ -1,12 +1,21 @@
 package report
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/parse"
 	"github.com/pfrederiksen/configdiff/tree"
 )
 
@@ -85,6 +94,61 @@ func TestGenerate(t *testing.T) {
 			opts:   DefaultOptions(),
 			golden: "multiple_changes.txt",
 		},
+		{
+			name: "multiple changes grouped by top level",
+			changes: []diff.Change{
+				{
+					Type:     diff.ChangeTypeAdd,
+					Path:     "/spec/replicas",
+					NewValue: tree.NewNumber(5),
+				},
+				{
+					Type:     diff.ChangeTypeModify,
+					Path:     "/spec/image",
+					OldValue: tree.NewString("nginx:1.19"),
+					NewValue: tree.NewString("nginx:1.20"),
+				},
+				{
+					Type:     diff.ChangeTypeRemove,
+					Path:     "/metadata/annotations/deprecated",
+					OldValue: tree.NewString("true"),
+				},
+			},
+			opts: Options{
+				ShowValues:     true,
+				MaxValueLength: 80,
+				NoColor:        true,
+				GroupBy:        GroupByTopLevel,
+			},
+			golden: "multiple_changes_grouped.txt",
+		},
+		{
+			name: "compact grouped by depth",
+			changes: []diff.Change{
+				{
+					Type:     diff.ChangeTypeAdd,
+					Path:     "/spec/replicas",
+					NewValue: tree.NewNumber(5),
+				},
+				{
+					Type:     diff.ChangeTypeModify,
+					Path:     "/spec/image",
+					OldValue: tree.NewString("nginx:1.19"),
+					NewValue: tree.NewString("nginx:1.20"),
+				},
+				{
+					Type:     diff.ChangeTypeRemove,
+					Path:     "/metadata/annotations/deprecated",
+					OldValue: tree.NewString("true"),
+				},
+			},
+			opts: Options{
+				Compact: true,
+				NoColor: true,
+				GroupBy: "depth-2",
+			},
+			golden: "compact_grouped.txt",
+		},
 		{
 			name: "complex values",
 			changes: []diff.Change{
@@ -123,6 +187,7 @@ func TestGenerate(t *testing.T) {
 			opts: Options{
 				Compact:    true,
 				ShowValues: false,
+				NoColor:    true,
 			},
 			golden: "compact_format.txt",
 		},
@@ -143,6 +208,7 @@ func TestGenerate(t *testing.T) {
 			},
 			opts: Options{
 				ShowValues: false,
+				NoColor:    true,
 			},
 			golden: "without_values.txt",
 		},
@@ -158,6 +224,7 @@ func TestGenerate(t *testing.T) {
 			opts: Options{
 				ShowValues:     true,
 				MaxValueLength: 30,
+				NoColor:        true,
 			},
 			golden: "value_truncation.txt",
 		},
@@ -178,6 +245,199 @@ func TestGenerate(t *testing.T) {
 			opts:   DefaultOptions(),
 			golden: "number_formatting.txt",
 		},
+		{
+			name: "filtered and sorted by severity",
+			changes: []diff.Change{
+				{Type: diff.ChangeTypeAdd, Path: "/a", NewValue: tree.NewNumber(1)},
+				{Type: diff.ChangeTypeModify, Path: "/b", OldValue: tree.NewNumber(1), NewValue: tree.NewNumber(2)},
+				{Type: diff.ChangeTypeRemove, Path: "/c", OldValue: tree.NewNumber(3)},
+				{Type: diff.ChangeTypeAdd, Path: "/d", NewValue: tree.NewNumber(4)},
+			},
+			opts: func() Options {
+				o := DefaultOptions()
+				o.Sort = SortSeverity
+				o.FilterTypes = []diff.ChangeType{diff.ChangeTypeRemove, diff.ChangeTypeModify}
+				return o
+			}(),
+			golden: "filtered_sorted.txt",
+		},
+		{
+			name: "limited to max changes",
+			changes: []diff.Change{
+				{Type: diff.ChangeTypeAdd, Path: "/a", NewValue: tree.NewNumber(1)},
+				{Type: diff.ChangeTypeModify, Path: "/b", OldValue: tree.NewNumber(1), NewValue: tree.NewNumber(2)},
+				{Type: diff.ChangeTypeRemove, Path: "/c", OldValue: tree.NewNumber(3)},
+				{Type: diff.ChangeTypeAdd, Path: "/d", NewValue: tree.NewNumber(4)},
+			},
+			opts: func() Options {
+				o := DefaultOptions()
+				o.Sort = SortPath
+				o.MaxChanges = 2
+				return o
+			}(),
+			golden: "max_changes.txt",
+		},
+		{
+			name: "file header and line numbers",
+			changes: []diff.Change{
+				{Type: diff.ChangeTypeRemove, Path: "/debug", OldValue: &tree.Node{Kind: tree.KindBool, Value: true, Line: 7}},
+				{Type: diff.ChangeTypeModify, Path: "/spec/replicas", OldValue: &tree.Node{Kind: tree.KindNumber, Value: 2.0, Line: 3}, NewValue: &tree.Node{Kind: tree.KindNumber, Value: 3.0, Line: 4}},
+				{Type: diff.ChangeTypeAdd, Path: "/spec/port", NewValue: &tree.Node{Kind: tree.KindNumber, Value: 443.0, Line: 9}},
+				{Type: diff.ChangeTypeAdd, Path: "/unknown", NewValue: tree.NewString("no line")},
+			},
+			opts: func() Options {
+				o := DefaultOptions()
+				o.OldFile = "old.yaml"
+				o.NewFile = "new.yaml"
+				o.ShowLineNumbers = true
+				return o
+			}(),
+			golden: "file_header.txt",
+		},
+		{
+			name:    "file header without changes",
+			changes: []diff.Change{},
+			opts: func() Options {
+				o := DefaultOptions()
+				o.Compact = true
+				o.ASCIIOnly = true
+				o.OldFile = "old.yaml"
+				o.NewFile = "new.yaml"
+				return o
+			}(),
+			golden: "file_header_empty.txt",
+		},
+		{
+			name: "ascii symbols",
+			changes: []diff.Change{
+				{Type: diff.ChangeTypeAdd, Path: "/a", NewValue: tree.NewNumber(1)},
+				{Type: diff.ChangeTypeModify, Path: "/b", OldValue: tree.NewNumber(1), NewValue: tree.NewNumber(2)},
+				{Type: diff.ChangeTypeModify, Path: "/c", OldValue: tree.NewString("nginx:1.19"), NewValue: tree.NewString("nginx:1.20")},
+				{Type: diff.ChangeTypeMove, Path: "/d[0]", OldValue: tree.NewString("x"), NewValue: tree.NewString("x")},
+				{Type: diff.ChangeTypeRemove, Path: "/e", OldValue: tree.NewNumber(3)},
+			},
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ASCIIOnly = true
+				o.OldFile = "old.yaml"
+				o.NewFile = "new.yaml"
+				o.MaxChanges = 4
+				return o
+			}(),
+			golden: "ascii.txt",
+		},
+		{
+			name: "expanded containers",
+			changes: MaskChanges([]diff.Change{
+				{Type: diff.ChangeTypeAdd, Path: "/volumes[0]", NewValue: tree.NewObject(map[string]*tree.Node{
+					"name":      tree.NewString("data"),
+					"mountPath": tree.NewString("/data"),
+					"options":   tree.NewArray([]*tree.Node{tree.NewString("ro"), tree.NewString("noexec")}),
+				})},
+				{Type: diff.ChangeTypeRemove, Path: "/db", OldValue: tree.NewObject(map[string]*tree.Node{
+					"host":     tree.NewString("db.internal"),
+					"password": tree.NewString("hunter2"),
+				})},
+				{Type: diff.ChangeTypeAdd, Path: "/big", NewValue: tree.NewArray([]*tree.Node{
+					tree.NewNumber(1), tree.NewNumber(2), tree.NewNumber(3), tree.NewNumber(4), tree.NewNumber(5), tree.NewNumber(6),
+				})},
+				{Type: diff.ChangeTypeAdd, Path: "/empty", NewValue: tree.NewObject(map[string]*tree.Node{})},
+				{Type: diff.ChangeTypeModify, Path: "/mode", OldValue: tree.NewString("simple"), NewValue: tree.NewObject(map[string]*tree.Node{
+					"kind": tree.NewString("advanced"),
+				})},
+			}, Options{MaskSecrets: true}),
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ExpandContainers = true
+				o.ExpandLimit = 6
+				return o
+			}(),
+			golden: "expand_containers.txt",
+		},
+		{
+			name: "legend and zero counts",
+			changes: []diff.Change{
+				{Type: diff.ChangeTypeModify, Path: "/replicas", OldValue: tree.NewNumber(2), NewValue: tree.NewNumber(3)},
+			},
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ShowLegend = true
+				o.IncludeZeroCounts = true
+				return o
+			}(),
+			golden: "legend_zero_counts.txt",
+		},
+		{
+			name: "compact legend",
+			changes: []diff.Change{
+				{Type: diff.ChangeTypeAdd, Path: "/a", NewValue: tree.NewNumber(1)},
+				{Type: diff.ChangeTypeRemove, Path: "/b", OldValue: tree.NewNumber(1)},
+			},
+			opts: func() Options {
+				o := DefaultOptions()
+				o.Compact = true
+				o.ShowValues = false
+				o.ShowLegend = true
+				o.ASCIIOnly = true
+				return o
+			}(),
+			golden: "compact_legend.txt",
+		},
+		{
+			name:    "severity",
+			changes: severityChanges(),
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ClassifySeverity = true
+				return o
+			}(),
+			golden: "severity.txt",
+		},
+		{
+			name:    "severity ascii sorted",
+			changes: severityChanges(),
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ClassifySeverity = true
+				o.ASCIIOnly = true
+				o.Sort = SortSeverity
+				return o
+			}(),
+			golden: "severity_ascii.txt",
+		},
+		{
+			name:    "value style json",
+			changes: valueStyleChanges(),
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ValueStyle = ValueStyleJSON
+				o.MaxValueLength = 40
+				return o
+			}(),
+			golden: "value_style_json.txt",
+		},
+		{
+			name:    "value style yaml",
+			changes: valueStyleChanges(),
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ValueStyle = ValueStyleYAML
+				o.MaxValueLength = 40
+				return o
+			}(),
+			golden: "value_style_yaml.txt",
+		},
+		{
+			name:    "value style go",
+			changes: valueStyleChanges(),
+			opts: func() Options {
+				o := DefaultOptions()
+				o.ValueStyle = ValueStyleGo
+				o.MaxValueLength = 40
+				return o
+			}(),
+			golden: "value_style_go.txt",
+		},
 	}
 
 	for _, tt := range tests {
@@ -389,7 +649,43 @@ func TestFormatValue(t *testing.T) {
 			name:   "truncation",
 			node:   tree.NewString("this is a long string"),
 			maxLen: 10,
-			want:   `"this i...`,
+			want:   `"this ..."`,
+		},
+		{name: "limit 0 means no limit", node: tree.NewString("hello world"), maxLen: 0, want: `"hello world"`},
+		{name: "limit 1 string", node: tree.NewString("hello world"), maxLen: 1, want: `"..."`},
+		{name: "limit 2 string", node: tree.NewString("hello world"), maxLen: 2, want: `"..."`},
+		{name: "limit 3 string", node: tree.NewString("hello world"), maxLen: 3, want: `"..."`},
+		{name: "limit 4 string", node: tree.NewString("hello world"), maxLen: 4, want: `"..."`},
+		{name: "limit 5 string", node: tree.NewString("hello world"), maxLen: 5, want: `"..."`},
+		{name: "limit 6 string", node: tree.NewString("hello world"), maxLen: 6, want: `"h..."`},
+		{name: "limit 1 number", node: tree.NewNumber(1234567), maxLen: 1, want: "..."},
+		{name: "limit 3 number", node: tree.NewNumber(1234567), maxLen: 3, want: "..."},
+		{name: "limit 4 number", node: tree.NewNumber(1234567), maxLen: 4, want: "1..."},
+		{name: "limit 5 number", node: tree.NewNumber(1234567), maxLen: 5, want: "12..."},
+		{name: "fits exactly", node: tree.NewString("abc"), maxLen: 5, want: `"abc"`},
+		{
+			name:   "french multi-byte",
+			node:   tree.NewString("élève à l'école"),
+			maxLen: 9,
+			want:   `"élèv..."`,
+		},
+		{
+			name:   "japanese multi-byte",
+			node:   tree.NewString("設定ファイルの差分"),
+			maxLen: 8,
+			want:   `"設定フ..."`,
+		},
+		{
+			name:   "escape sequences are not split",
+			node:   tree.NewString("ab\ncdef"),
+			maxLen: 8,
+			want:   `"ab..."`,
+		},
+		{
+			name:   "multi-byte within limit",
+			node:   tree.NewString("日本語"),
+			maxLen: 5,
+			want:   `"日本語"`,
 		},
 	}
 
@@ -399,6 +695,9 @@ func TestFormatValue(t *testing.T) {
 			if got != tt.want {
 				t.Errorf("formatValue() = %q, want %q", got, tt.want)
 			}
+			if !utf8.ValidString(got) {
+				t.Errorf("formatValue() = %q is not valid UTF-8", got)
+			}
 		})
 	}
 }
@@ -536,7 +835,7 @@ func TestGenerateSideBySide(t *testing.T) {
 		{
 			name:    "empty changes",
 			changes: []diff.Change{},
-			opts:    Options{NoColor: true},
+			opts:    Options{NoColor: true, Width: 80},
 			golden:  "side_by_side_empty.txt",
 		},
 		{
@@ -548,7 +847,7 @@ func TestGenerateSideBySide(t *testing.T) {
 					NewValue: tree.NewString("value"),
 				},
 			},
-			opts:   Options{NoColor: true},
+			opts:   Options{NoColor: true, Width: 80},
 			golden: "side_by_side_add.txt",
 		},
 		{
@@ -560,7 +859,7 @@ func TestGenerateSideBySide(t *testing.T) {
 					OldValue: tree.NewString("value"),
 				},
 			},
-			opts:   Options{NoColor: true},
+			opts:   Options{NoColor: true, Width: 80},
 			golden: "side_by_side_remove.txt",
 		},
 		{
@@ -573,7 +872,7 @@ func TestGenerateSideBySide(t *testing.T) {
 					NewValue: tree.NewString("new"),
 				},
 			},
-			opts:   Options{NoColor: true},
+			opts:   Options{NoColor: true, Width: 80},
 			golden: "side_by_side_modify.txt",
 		},
 		{
@@ -596,9 +895,18 @@ func TestGenerateSideBySide(t *testing.T) {
 					NewValue: tree.NewNumber(5),
 				},
 			},
-			opts:   Options{NoColor: true},
+			opts:   Options{NoColor: true, Width: 80},
 			golden: "side_by_side_multiple.txt",
 		},
+		{
+			name: "ascii",
+			changes: []diff.Change{
+				{Type: diff.ChangeTypeModify, Path: "/replicas", OldValue: tree.NewNumber(2), NewValue: tree.NewNumber(5)},
+				{Type: diff.ChangeTypeMove, Path: "/items[1]", OldValue: tree.NewString("b"), NewValue: tree.NewString("b")},
+			},
+			opts:   Options{NoColor: true, Width: 80, ASCIIOnly: true},
+			golden: "side_by_side_ascii.txt",
+		},
 	}
 
 	for _, tt := range tests {
@@ -741,3 +1049,2129 @@ func TestGenerateGitDiff(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []diff.Change
+		opts    Options
+		golden  string
+	}{
+		{
+			name:    "empty changes",
+			changes: []diff.Change{},
+			opts:    DefaultOptions(),
+			golden:  "markdown_empty.txt",
+		},
+		{
+			name: "multiple changes",
+			changes: []diff.Change{
+				{
+					Type:     diff.ChangeTypeAdd,
+					Path:     "/env",
+					NewValue: tree.NewString("production"),
+				},
+				{
+					Type:     diff.ChangeTypeRemove,
+					Path:     "/debug",
+					OldValue: tree.NewBool(true),
+				},
+				{
+					Type:     diff.ChangeTypeModify,
+					Path:     "/replicas",
+					OldValue: tree.NewNumber(2),
+					NewValue: tree.NewNumber(5),
+				},
+			},
+			opts:   DefaultOptions(),
+			golden: "markdown_multiple.txt",
+		},
+		{
+			name: "escaping",
+			changes: []diff.Change{
+				{
+					Type:     diff.ChangeTypeModify,
+					Path:     "/command",
+					OldValue: tree.NewString("a | b"),
+					NewValue: tree.NewString("run `make`"),
+				},
+			},
+			opts:   DefaultOptions(),
+			golden: "markdown_escaping.txt",
+		},
+		{
+			name: "collapsed long values",
+			changes: []diff.Change{
+				{
+					Type:     diff.ChangeTypeAdd,
+					Path:     "/description",
+					NewValue: tree.NewString("This is a very long string that should be collapsed <behind> a details block"),
+				},
+			},
+			opts: Options{
+				MaxValueLength:     30,
+				CollapseLongValues: true,
+			},
+			golden: "markdown_collapsed.txt",
+		},
+		{
+			name:    "severity column",
+			changes: severityChanges(),
+			opts:    Options{ClassifySeverity: true, Sort: SortSeverity},
+			golden:  "markdown_severity.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateMarkdown(tt.changes, tt.opts)
+
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+
+			if *updateGolden {
+				// Update golden file
+				if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+
+			// Read golden file
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+
+			if got != string(want) {
+				t.Errorf("GenerateMarkdown() output differs from golden file %s\nGot:\n%s\nWant:\n%s", tt.golden, got, string(want))
+				t.Logf("Run with -update flag to update golden files")
+			}
+		})
+	}
+}
+
+func TestMarkdownCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "`plain`"},
+		{"a|b", "`a\\|b`"},
+		{"x`y", "`` x`y ``"},
+		{"two\nlines", "`two lines`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := markdownCode(tt.in); got != tt.want {
+				t.Errorf("markdownCode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSARIF(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Type:     diff.ChangeTypeAdd,
+			Path:     "/env",
+			NewValue: &tree.Node{Kind: tree.KindString, Value: "production", Line: 4},
+		},
+		{
+			Type:     diff.ChangeTypeRemove,
+			Path:     "/debug",
+			OldValue: &tree.Node{Kind: tree.KindBool, Value: true, Line: 7},
+		},
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/replicas",
+			OldValue: tree.NewNumber(2),
+			NewValue: tree.NewNumber(5),
+		},
+	}
+
+	got, err := GenerateSARIF(changes, "config/new.yaml", Options{})
+	if err != nil {
+		t.Fatalf("GenerateSARIF() error = %v", err)
+	}
+
+	goldenPath := filepath.Join("..", "testdata", "report", "sarif_multiple.txt")
+	if *updateGolden {
+		if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+	}
+	if got != string(want) {
+		t.Errorf("GenerateSARIF() output differs from golden file\nGot:\n%s\nWant:\n%s", got, string(want))
+	}
+
+	// Check the properties required by the SARIF 2.1.0 schema
+	var log map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &log); err != nil {
+		t.Fatalf("GenerateSARIF() produced invalid JSON: %v", err)
+	}
+	if log["version"] != "2.1.0" {
+		t.Errorf("version = %v, want 2.1.0", log["version"])
+	}
+	runs, ok := log["runs"].([]interface{})
+	if !ok || len(runs) != 1 {
+		t.Fatalf("runs = %v, want exactly one run", log["runs"])
+	}
+	run := runs[0].(map[string]interface{})
+	driver := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+	if driver["name"] != "configdiff" {
+		t.Errorf("driver name = %v, want configdiff", driver["name"])
+	}
+	if rules := driver["rules"].([]interface{}); len(rules) != 4 {
+		t.Errorf("got %d rules, want 4", len(rules))
+	}
+	results := run["results"].([]interface{})
+	if len(results) != len(changes) {
+		t.Fatalf("got %d results, want %d", len(results), len(changes))
+	}
+	for i, r := range results {
+		result := r.(map[string]interface{})
+		if result["ruleId"] != "configdiff/"+string(changes[i].Type) {
+			t.Errorf("result %d ruleId = %v", i, result["ruleId"])
+		}
+		if msg := result["message"].(map[string]interface{}); msg["text"] == "" {
+			t.Errorf("result %d has empty message", i)
+		}
+		locs := result["locations"].([]interface{})
+		if len(locs) != 1 {
+			t.Fatalf("result %d has %d locations, want 1", i, len(locs))
+		}
+		region := locs[0].(map[string]interface{})["physicalLocation"].(map[string]interface{})["region"]
+		wantLines := []interface{}{4.0, 7.0, nil}
+		if r, _ := region.(map[string]interface{}); r["startLine"] != wantLines[i] {
+			t.Errorf("result %d region = %v, want startLine %v", i, region, wantLines[i])
+		}
+	}
+}
+
+func TestGenerateSARIF_Severity(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeAdd, Path: "/env", NewValue: tree.NewString("production")},
+		{Type: diff.ChangeTypeRemove, Path: "/debug", OldValue: tree.NewBool(true)},
+		{Type: diff.ChangeTypeModify, Path: "/replicas", OldValue: tree.NewNumber(2), NewValue: tree.NewNumber(5)},
+		{Type: diff.ChangeTypeModify, Path: "/labels/team", OldValue: tree.NewString("a"), NewValue: tree.NewString("b")},
+	}
+
+	levels := func(opts Options) []string {
+		t.Helper()
+		got, err := GenerateSARIF(changes, "new.yaml", opts)
+		if err != nil {
+			t.Fatalf("GenerateSARIF() error = %v", err)
+		}
+		var log struct {
+			Runs []struct {
+				Results []struct {
+					Level string `json:"level"`
+				} `json:"results"`
+			} `json:"runs"`
+		}
+		if err := json.Unmarshal([]byte(got), &log); err != nil {
+			t.Fatalf("GenerateSARIF() produced invalid JSON: %v", err)
+		}
+		var levels []string
+		for _, r := range log.Runs[0].Results {
+			levels = append(levels, r.Level)
+		}
+		return levels
+	}
+
+	if got, want := levels(Options{}), []string{"note", "warning", "warning", "warning"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("levels by change type = %v, want %v", got, want)
+	}
+	opts := Options{
+		ClassifySeverity: true,
+		SeverityRules:    []SeverityRule{{Match: "/labels/**", Severity: SeverityInfo}, {Match: "/env", Severity: SeverityBreaking}},
+	}
+	if got, want := levels(opts), []string{"error", "error", "warning", "note"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("levels by classified severity = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateSARIF_Empty(t *testing.T) {
+	got, err := GenerateSARIF(nil, "new.yaml", Options{})
+	if err != nil {
+		t.Fatalf("GenerateSARIF() error = %v", err)
+	}
+	if !contains(got, `"results": []`) {
+		t.Errorf("GenerateSARIF() with no changes should have empty results, got:\n%s", got)
+	}
+}
+
+func TestGenerateGitHubComment(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/replicas",
+			OldValue: tree.NewNumber(2),
+			NewValue: tree.NewNumber(5),
+		},
+		{
+			Type:     diff.ChangeTypeAdd,
+			Path:     "/env",
+			NewValue: tree.NewString("production"),
+		},
+	}
+
+	got := GenerateGitHubComment(changes, "deploy.yaml", DefaultOptions(), 0)
+
+	goldenPath := filepath.Join("..", "testdata", "report", "github_comment.txt")
+	if *updateGolden {
+		if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+	}
+	if got != string(want) {
+		t.Errorf("GenerateGitHubComment() output differs from golden file\nGot:\n%s\nWant:\n%s", got, string(want))
+	}
+}
+
+func TestGenerateGitHubComment_SizeCap(t *testing.T) {
+	changes := make([]diff.Change, 0, 200)
+	for i := 0; i < 200; i++ {
+		changes = append(changes, diff.Change{
+			Type:     diff.ChangeTypeAdd,
+			Path:     fmt.Sprintf("/items/key%03d", i),
+			NewValue: tree.NewString(strings.Repeat("x", 40)),
+		})
+	}
+
+	full := GenerateGitHubComment(changes, "", DefaultOptions(), 0)
+	if contains(full, "truncated") {
+		t.Fatalf("output under the limit should not be truncated")
+	}
+
+	const maxSize = 2000
+	got := GenerateGitHubComment(changes, "", DefaultOptions(), maxSize)
+	if len(got) > maxSize {
+		t.Errorf("output is %d bytes, want at most %d", len(got), maxSize)
+	}
+	if !contains(got, "Output truncated") {
+		t.Errorf("truncated output should contain a notice, got:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "</details>\n") {
+		t.Errorf("truncated output should still close the details block")
+	}
+
+	// Every table line must be a complete row
+	rows := 0
+	for _, line := range strings.Split(got, "\n") {
+		if strings.HasPrefix(line, "| `/items/") {
+			rows++
+			if !strings.HasSuffix(line, " |") {
+				t.Errorf("row was cut mid-way: %q", line)
+			}
+		}
+	}
+	if !contains(got, fmt.Sprintf("%d more changes not shown", len(changes)-rows)) {
+		t.Errorf("notice should count the %d omitted changes, got:\n%s", len(changes)-rows, got)
+	}
+}
+
+func TestColorOutput(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Type:     diff.ChangeTypeAdd,
+			Path:     "/added",
+			NewValue: tree.NewString("a"),
+		},
+		{
+			Type:     diff.ChangeTypeRemove,
+			Path:     "/removed",
+			OldValue: tree.NewString("r"),
+		},
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/modified",
+			OldValue: tree.NewNumber(1),
+			NewValue: tree.NewNumber(2),
+		},
+	}
+
+	const (
+		green  = "\x1b[32m"
+		red    = "\x1b[31m"
+		yellow = "\x1b[33m"
+		bold   = "\x1b[1m"
+		faint  = "\x1b[2m"
+	)
+
+	colored := Options{ShowValues: true}
+	plain := Options{ShowValues: true, NoColor: true}
+
+	tests := []struct {
+		name     string
+		generate func(Options) string
+		want     []string
+	}{
+		{
+			name:     "report",
+			generate: func(o Options) string { return Generate(changes, o) },
+			want:     []string{green, red, yellow, bold, faint},
+		},
+		{
+			name:     "side-by-side",
+			generate: func(o Options) string { return GenerateSideBySide(changes, o) },
+			want:     []string{green, red, yellow, bold},
+		},
+		{
+			name: "git-diff",
+			generate: func(o Options) string {
+				return GenerateGitDiffWithOptions(changes, "old.yaml", "new.yaml", o)
+			},
+			want: []string{green, red, bold},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.generate(colored)
+			for _, seq := range tt.want {
+				if !strings.Contains(got, seq) {
+					t.Errorf("colored output missing escape sequence %q:\n%s", seq, got)
+				}
+			}
+
+			if got := tt.generate(plain); strings.Contains(got, "\x1b[") {
+				t.Errorf("NoColor output contains escape sequences:\n%q", got)
+			}
+		})
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"none", 0, false},
+		{"top-level", 1, false},
+		{"depth-3", 3, false},
+		{"depth-0", 0, true},
+		{"depth-x", 0, true},
+		{"section", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseGroupBy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGroupBy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseGroupBy(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTree(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/spec/template/spec/containers[0]/image",
+			OldValue: tree.NewString("nginx:1.19"),
+			NewValue: tree.NewString("nginx:1.20"),
+		},
+		{
+			Type: diff.ChangeTypeAdd,
+			Path: "/spec/template/spec/containers[0]/resources",
+			NewValue: tree.NewObject(map[string]*tree.Node{
+				"limits": tree.NewString("1"),
+			}),
+		},
+		{
+			Type:     diff.ChangeTypeAdd,
+			Path:     "/spec/replicas",
+			NewValue: tree.NewNumber(3),
+		},
+		{
+			Type:     diff.ChangeTypeRemove,
+			Path:     "/metadata/labels/tier",
+			OldValue: tree.NewString("This value is long enough to be truncated by the limit"),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		opts   Options
+		golden string
+	}{
+		{
+			name:   "unicode",
+			opts:   Options{MaxValueLength: 30, NoColor: true},
+			golden: "tree_multiple.txt",
+		},
+		{
+			name:   "ascii",
+			opts:   Options{MaxValueLength: 30, NoColor: true, ASCIIOnly: true},
+			golden: "tree_ascii.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateTree(changes, tt.opts)
+
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+			if got != string(want) {
+				t.Errorf("GenerateTree() output differs from golden file %s\nGot:\n%s\nWant:\n%s", tt.golden, got, string(want))
+			}
+		})
+	}
+
+	if got := GenerateTree(nil, DefaultOptions()); got != "No changes detected.\n" {
+		t.Errorf("GenerateTree(nil) = %q", got)
+	}
+}
+
+func TestGenerateUnified(t *testing.T) {
+	oldTree, err := parse.ParseYAML([]byte(`
+# comment that should not matter
+spec:
+  replicas: 2
+  image: nginx:1.19
+  ports: [80, 443]
+metadata:
+  name: web
+  labels: {app: web, tier: frontend}
+`))
+	if err != nil {
+		t.Fatalf("ParseYAML() error = %v", err)
+	}
+	newTree, err := parse.ParseYAML([]byte(`
+metadata:
+  labels: {tier: frontend, app: web}
+  name: web
+spec:
+  image: nginx:1.20
+  ports: [80, 443]
+  replicas: 2
+`))
+	if err != nil {
+		t.Fatalf("ParseYAML() error = %v", err)
+	}
+
+	got, err := GenerateUnified(oldTree, newTree, "old.yaml", "new.yaml", Options{ContextLines: 1, NoColor: true})
+	if err != nil {
+		t.Fatalf("GenerateUnified() error = %v", err)
+	}
+
+	goldenPath := filepath.Join("..", "testdata", "report", "unified_modify.txt")
+	if *updateGolden {
+		if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+	}
+	if got != string(want) {
+		t.Errorf("GenerateUnified() output differs from golden file\nGot:\n%s\nWant:\n%s", got, string(want))
+	}
+
+	// Ordering-only differences vanish after canonicalization
+	same, err := GenerateUnified(oldTree, oldTree.Clone(), "a.yaml", "b.yaml", Options{NoColor: true})
+	if err != nil {
+		t.Fatalf("GenerateUnified() error = %v", err)
+	}
+	if same != "" {
+		t.Errorf("GenerateUnified() for equal trees = %q, want empty", same)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{"both empty", nil, nil, ""},
+		{"all added", nil, []string{"x", "y"}, "+x+y"},
+		{"all removed", []string{"x", "y"}, nil, "-x-y"},
+		{"replace middle", []string{"a", "b", "c"}, []string{"a", "x", "c"}, " a-b+x c"},
+		{"insert", []string{"a", "c"}, []string{"a", "b", "c"}, " a+b c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			for _, op := range diffLines(tt.a, tt.b) {
+				b.WriteByte(op.kind)
+				b.WriteString(op.text)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("diffLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSideBySide_Width(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/spec/template/spec/containers[0]/env[name=DATABASE_URL]/value",
+			OldValue: tree.NewString("postgres://db1.internal:5432/app?sslmode=require"),
+			NewValue: tree.NewString("postgres://db2.internal:5432/app?sslmode=require"),
+		},
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/greeting",
+			OldValue: tree.NewString("こんにちは世界"),
+			NewValue: tree.NewString("hello"),
+		},
+	}
+
+	t.Run("narrow", func(t *testing.T) {
+		got := GenerateSideBySide(changes, Options{NoColor: true, Width: 50})
+		for _, line := range strings.Split(got, "\n") {
+			if w := displayWidth(line); w > 50 {
+				t.Errorf("line is %d cells wide, want at most 50: %q", w, line)
+			}
+		}
+	})
+
+	t.Run("wide terminal grows to fit content", func(t *testing.T) {
+		got := GenerateSideBySide(changes, Options{NoColor: true, Width: 200})
+		if !contains(got, "postgres://db1.internal:5432/app?sslmode=require") {
+			t.Errorf("wide layout should not truncate values:\n%s", got)
+		}
+		if contains(got, strings.Repeat("─", 200)) {
+			t.Errorf("layout should not stretch beyond its content:\n%s", got)
+		}
+	})
+
+	t.Run("wide runes stay aligned", func(t *testing.T) {
+		got := GenerateSideBySide(changes[1:], Options{NoColor: true, Width: 80})
+		var row string
+		for _, line := range strings.Split(got, "\n") {
+			if strings.Contains(line, "こんにちは") {
+				row = line
+			}
+		}
+		sep := strings.Index(row, " | ")
+		if sep < 0 {
+			t.Fatalf("row has no column separator: %q", row)
+		}
+		if w := displayWidth(row[:sep]); w != 38 {
+			t.Errorf("left column is %d cells wide, want 38: %q", w, row)
+		}
+	})
+}
+
+func TestTruncateWidth(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"abcdefghij", 8, "abcde..."},
+		{"日本語テキスト", 9, "日本語..."},
+		{"e\u0301e\u0301e\u0301e\u0301", 4, "e\u0301e\u0301e\u0301e\u0301"},
+		{"e\u0301e\u0301e\u0301e\u0301e\u0301", 4, "e\u0301..."},
+		{"anything", 2, ".."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := truncateWidth(tt.in, tt.width)
+			if got != tt.want {
+				t.Errorf("truncateWidth(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+			}
+			if displayWidth(got) > tt.width {
+				t.Errorf("truncateWidth(%q, %d) is %d cells wide", tt.in, tt.width, displayWidth(got))
+			}
+		})
+	}
+}
+
+func TestGenerate_InlineDiff(t *testing.T) {
+	oldVal := tree.NewString("host=db1 port=5432")
+	newVal := tree.NewString("host=db2 port=5433")
+	changes, err := diff.Diff(oldVal, newVal, diff.Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	opts := DefaultOptions()
+	got := Generate(changes, opts)
+	want := `"host=[-db1-] port=[-5432-]" → "host={+db2+} port={+5433+}"`
+	if !strings.Contains(got, want) {
+		t.Errorf("Generate() missing inline markers %q:\n%s", want, got)
+	}
+
+	opts.InlineDiff = false
+	if got := Generate(changes, opts); !strings.Contains(got, `"host=db1 port=5432" → "host=db2 port=5433"`) {
+		t.Errorf("Generate() with InlineDiff off should render plain values:\n%s", got)
+	}
+
+	opts = DefaultOptions()
+	opts.NoColor = false
+	got = Generate(changes, opts)
+	if !strings.Contains(got, "\x1b[31;7mdb1") || !strings.Contains(got, "\x1b[32;7mdb2") {
+		t.Errorf("colored inline diff missing emphasis:\n%q", got)
+	}
+	if strings.Contains(got, "[-") || strings.Contains(got, "{+") {
+		t.Errorf("colored inline diff should not contain markers:\n%q", got)
+	}
+
+	opts = DefaultOptions()
+	opts.MaxValueLength = 10
+	if got := Generate(changes, opts); strings.Contains(got, "[-") {
+		t.Errorf("truncated values should fall back to plain rendering:\n%s", got)
+	}
+}
+
+func TestGenerate_InlineDiffUnicode(t *testing.T) {
+	changes, err := diff.Diff(
+		tree.NewString("status \U0001F44D\U0001F3FD cafe\u0301"),
+		tree.NewString("status \U0001F44E cafe\u0301"),
+		diff.Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	got := Generate(changes, DefaultOptions())
+	want := `"status [-` + "\U0001F44D\U0001F3FD" + `-] cafe` + "\u0301" + `" → "status {+` + "\U0001F44E" + `+} cafe` + "\u0301" + `"`
+	if !strings.Contains(got, want) {
+		t.Errorf("Generate() = %q, want substring %q", got, want)
+	}
+}
+
+func TestMaskChanges(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Type:          diff.ChangeTypeModify,
+			Path:          "/db/password",
+			OldValue:      tree.NewString("hunter2 old"),
+			NewValue:      tree.NewString("hunter2 new"),
+			OldHighlights: []diff.Span{{Start: 8, End: 11}},
+			NewHighlights: []diff.Span{{Start: 8, End: 11}},
+		},
+		{
+			Type: diff.ChangeTypeAdd,
+			Path: "/auth",
+			NewValue: tree.NewObject(map[string]*tree.Node{
+				"user":      tree.NewString("admin"),
+				"API_TOKEN": tree.NewString("t0ken"),
+			}),
+		},
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/internal/dsn",
+			OldValue: tree.NewString("postgres://a"),
+			NewValue: tree.NewString("postgres://b"),
+		},
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/replicas",
+			OldValue: tree.NewNumber(1),
+			NewValue: tree.NewNumber(2),
+		},
+	}
+
+	t.Run("redact", func(t *testing.T) {
+		got := MaskChanges(changes, Options{MaskSecrets: true, MaskPaths: []string{"/internal/*"}})
+
+		if got[0].Type != diff.ChangeTypeModify {
+			t.Errorf("masked change type = %v, want modify", got[0].Type)
+		}
+		if got[0].OldValue.Value != MaskPlaceholder || got[0].NewValue.Value != MaskPlaceholder {
+			t.Errorf("password not masked: %v -> %v", got[0].OldValue.Value, got[0].NewValue.Value)
+		}
+		if got[0].OldHighlights != nil || got[0].NewHighlights != nil {
+			t.Errorf("highlights should be dropped for masked values")
+		}
+		if v := got[1].NewValue.Object["API_TOKEN"].Value; v != MaskPlaceholder {
+			t.Errorf("nested token = %v, want masked", v)
+		}
+		if v := got[1].NewValue.Object["user"].Value; v != "admin" {
+			t.Errorf("nested user = %v, want unmasked", v)
+		}
+		if got[2].NewValue.Value != MaskPlaceholder {
+			t.Errorf("MaskPaths value = %v, want masked", got[2].NewValue.Value)
+		}
+		if got[3].NewValue != changes[3].NewValue {
+			t.Errorf("unrelated values should be left alone")
+		}
+
+		// Input must not be modified
+		if changes[0].NewValue.Value != "hunter2 new" || changes[1].NewValue.Object["API_TOKEN"].Value != "t0ken" {
+			t.Errorf("MaskChanges() modified its input")
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		got := MaskChanges(changes, Options{MaskSecrets: true, MaskMode: MaskModeHash})
+
+		oldHash, _ := got[0].OldValue.Value.(string)
+		newHash, _ := got[0].NewValue.Value.(string)
+		if !strings.HasPrefix(oldHash, "hmac:") || len(oldHash) != len("hmac:")+12 {
+			t.Errorf("hash = %q, want hmac:<12 hex digits>", oldHash)
+		}
+		if oldHash == newHash {
+			t.Errorf("different secrets should hash differently")
+		}
+
+		again := MaskChanges(changes, Options{MaskSecrets: true, MaskMode: MaskModeHash})
+		if again[0].OldValue.Value != oldHash {
+			t.Errorf("hashing is not deterministic")
+		}
+
+		// Another run hashes with another key
+		defer func(key []byte) { maskHashKey = key }(maskHashKey)
+		maskHashKey = newMaskHashKey()
+		other := MaskChanges(changes, Options{MaskSecrets: true, MaskMode: MaskModeHash})
+		if other[0].OldValue.Value == oldHash {
+			t.Errorf("hash does not depend on the run's key")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		got := MaskChanges(changes, Options{})
+		if got[0].NewValue.Value != "hunter2 new" {
+			t.Errorf("values masked without masking options")
+		}
+	})
+}
+
+func TestMaskTree(t *testing.T) {
+	doc := tree.NewObject(map[string]*tree.Node{
+		"tokens": tree.NewArray([]*tree.Node{tree.NewString("a"), tree.NewString("b")}),
+		"name":   tree.NewString("app"),
+	})
+
+	got := MaskTree(doc, Options{MaskSecrets: true})
+	if got.Object["tokens"].Value != MaskPlaceholder {
+		t.Errorf("tokens = %v, want masked", got.Object["tokens"])
+	}
+	if got.Object["name"] != doc.Object["name"] {
+		t.Errorf("name should be shared, not masked")
+	}
+	if doc.Object["tokens"].Kind != tree.KindArray {
+		t.Errorf("MaskTree() modified its input")
+	}
+}
+
+func TestSelectChanges(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeModify, Path: "/m"},
+		{Type: diff.ChangeTypeAdd, Path: "/z"},
+		{Type: diff.ChangeTypeMove, Path: "/v"},
+		{Type: diff.ChangeTypeRemove, Path: "/b"},
+		{Type: diff.ChangeTypeAdd, Path: "/a"},
+	}
+
+	paths := func(cs []diff.Change) string {
+		var out []string
+		for _, c := range cs {
+			out = append(out, c.Path)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "unchanged", opts: Options{}, want: "/m,/z,/v,/b,/a"},
+		{name: "by path", opts: Options{Sort: SortPath}, want: "/a,/b,/m,/v,/z"},
+		{name: "by type", opts: Options{Sort: SortType}, want: "/z,/a,/b,/m,/v"},
+		{name: "by severity", opts: Options{Sort: SortSeverity}, want: "/b,/m,/v,/z,/a"},
+		{
+			name: "filter adds",
+			opts: Options{FilterTypes: []diff.ChangeType{diff.ChangeTypeAdd}},
+			want: "/z,/a",
+		},
+		{
+			name: "filter and sort",
+			opts: Options{Sort: SortPath, FilterTypes: []diff.ChangeType{diff.ChangeTypeAdd, diff.ChangeTypeRemove}},
+			want: "/a,/b,/z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paths(SelectChanges(changes, tt.opts)); got != tt.want {
+				t.Errorf("SelectChanges() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := paths(changes); got != "/m,/z,/v,/b,/a" {
+		t.Errorf("SelectChanges() modified its input: %s", got)
+	}
+}
+
+func TestSelectChanges_AllFiltered(t *testing.T) {
+	changes := []diff.Change{{Type: diff.ChangeTypeAdd, Path: "/a", NewValue: tree.NewNumber(1)}}
+	opts := DefaultOptions()
+	opts.FilterTypes = []diff.ChangeType{diff.ChangeTypeRemove}
+
+	want := "No matching changes (1 hidden by filter).\n"
+	if got := Generate(changes, opts); got != want {
+		t.Errorf("Generate() = %q, want %q", got, want)
+	}
+	if got := GenerateMarkdown(changes, opts); got != want {
+		t.Errorf("GenerateMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestParseChangeTypes(t *testing.T) {
+	got, err := ParseChangeTypes([]string{"add", " Remove "})
+	if err != nil {
+		t.Fatalf("ParseChangeTypes() error = %v", err)
+	}
+	if len(got) != 2 || got[0] != diff.ChangeTypeAdd || got[1] != diff.ChangeTypeRemove {
+		t.Errorf("ParseChangeTypes() = %v", got)
+	}
+	if _, err := ParseChangeTypes([]string{"delete"}); err == nil {
+		t.Error("ParseChangeTypes() expected error for unknown type")
+	}
+	if err := ValidateSort("random"); err == nil {
+		t.Error("ValidateSort() expected error for unknown order")
+	}
+}
+
+func TestGenerateTemplate(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Type:     diff.ChangeTypeAdd,
+			Path:     "/spec/replicas",
+			NewValue: tree.NewNumber(5),
+		},
+		{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/spec/image",
+			OldValue: tree.NewString("nginx:1.19"),
+			NewValue: tree.NewString("nginx:1.20"),
+		},
+		{
+			Type:     diff.ChangeTypeRemove,
+			Path:     "/metadata/annotations/deprecated",
+			OldValue: tree.NewString("true"),
+		},
+	}
+
+	tests := []struct {
+		template string
+		golden   string
+	}{
+		{template: "changelog.tmpl", golden: "template_changelog.txt"},
+		{template: "slack.tmpl", golden: "template_slack.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			text, err := os.ReadFile(filepath.Join("..", "testdata", "templates", tt.template))
+			if err != nil {
+				t.Fatalf("Failed to read template: %v", err)
+			}
+
+			got, err := GenerateTemplate(tt.template, string(text), changes, "old.yaml", "new.yaml", DefaultOptions())
+			if err != nil {
+				t.Fatalf("GenerateTemplate() error = %v", err)
+			}
+
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+			if got != string(want) {
+				t.Errorf("GenerateTemplate() output differs from golden file %s\nGot:\n%s\nWant:\n%s", tt.golden, got, string(want))
+			}
+		})
+	}
+}
+
+func TestGenerateTemplate_Errors(t *testing.T) {
+	changes := []diff.Change{{Type: diff.ChangeTypeAdd, Path: "/a", NewValue: tree.NewNumber(1)}}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "parse error",
+			text: "line one\n{{range .Changes}}\n{{.Path}\n",
+			want: "custom.tmpl:3",
+		},
+		{
+			name: "unknown field",
+			text: "ok\n\n{{.Nope}}\n",
+			want: "custom.tmpl:3",
+		},
+		{
+			name: "unknown color",
+			text: "{{color \"purple\" .NewFile}}",
+			want: `unknown color "purple"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateTemplate("custom.tmpl", tt.text, changes, "old.yaml", "new.yaml", DefaultOptions())
+			if err == nil {
+				t.Fatal("GenerateTemplate() expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("GenerateTemplate() error = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplate_Funcs(t *testing.T) {
+	changes := []diff.Change{{
+		Type:     diff.ChangeTypeAdd,
+		Path:     "/labels",
+		NewValue: tree.NewObject(map[string]*tree.Node{"app": tree.NewString("web")}),
+	}}
+	text := `{{range .Changes}}{{json .NewValue}}|{{yaml .NewValue}}|{{truncate 6 .Path}}|{{color .Type .Path}}{{end}}`
+
+	got, err := GenerateTemplate("funcs", text, changes, "", "", DefaultOptions())
+	if err != nil {
+		t.Fatalf("GenerateTemplate() error = %v", err)
+	}
+	if want := `{"app":"web"}|app: web|/la...|/labels`; got != want {
+		t.Errorf("GenerateTemplate() = %q, want %q", got, want)
+	}
+
+	opts := DefaultOptions()
+	opts.NoColor = false
+	got, err = GenerateTemplate("funcs", `{{color "remove" "x"}}`, changes, "", "", opts)
+	if err != nil {
+		t.Fatalf("GenerateTemplate() error = %v", err)
+	}
+	if !strings.Contains(got, "\x1b[31m") {
+		t.Errorf("color should emit ANSI codes when enabled, got %q", got)
+	}
+}
+
+func TestGenerateRecords(t *testing.T) {
+	files := []FileChanges{
+		{
+			File: "app/config.yaml",
+			Changes: []diff.Change{
+				{
+					Type:     diff.ChangeTypeModify,
+					Path:     "/db/dsn",
+					OldValue: tree.NewString("host=a,port=1"),
+					NewValue: tree.NewString("line one\nline \"two\""),
+				},
+				{
+					Type: diff.ChangeTypeAdd,
+					Path: "/labels",
+					NewValue: tree.NewObject(map[string]*tree.Node{
+						"tier": tree.NewString("web"),
+						"app":  tree.NewString("shop"),
+					}),
+				},
+				{
+					Type:     diff.ChangeTypeRemove,
+					Path:     "/replicas",
+					OldValue: tree.NewNumber(3),
+				},
+			},
+		},
+		{
+			File: "new.json",
+			Changes: []diff.Change{
+				{Type: diff.ChangeTypeAdd, Path: "/"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		generate func([]FileChanges, Options) (string, error)
+		golden   string
+	}{
+		{name: "csv", generate: GenerateCSV, golden: "records.csv"},
+		{name: "ndjson", generate: GenerateNDJSON, golden: "records.ndjson"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.generate(files, Options{})
+			if err != nil {
+				t.Fatalf("generate error = %v", err)
+			}
+
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from golden file %s\nGot:\n%s\nWant:\n%s", tt.golden, got, string(want))
+			}
+		})
+	}
+}
+
+func TestGenerateCSV_RoundTrip(t *testing.T) {
+	files := []FileChanges{{
+		File: "c.yaml",
+		Changes: []diff.Change{{
+			Type:     diff.ChangeTypeModify,
+			Path:     "/motd",
+			OldValue: tree.NewString("a, \"b\"\nc"),
+			NewValue: tree.NewString("plain"),
+		}},
+	}}
+
+	out, err := GenerateCSV(files, Options{})
+	if err != nil {
+		t.Fatalf("GenerateCSV() error = %v", err)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(RecordColumns, ",") {
+		t.Errorf("header = %v, want %v", rows[0], RecordColumns)
+	}
+	if rows[1][3] != "a, \"b\"\nc" {
+		t.Errorf("old column = %q, want original value", rows[1][3])
+	}
+}
+
+func TestGenerateDirStat(t *testing.T) {
+	files := map[string]Summary{
+		"app/config.yaml":                    {Total: 12, Added: 5, Modified: 4, Removed: 3},
+		"values.yaml":                        {Total: 3, Added: 2, Modified: 1},
+		"charts/very/deeply/nested/big.yaml": {Total: 200, Added: 100, Removed: 60, Moved: 40},
+		"unchanged.yaml":                     {},
+	}
+
+	tests := []struct {
+		name   string
+		width  int
+		golden string
+	}{
+		{name: "default width", width: 0, golden: "dirstat.txt"},
+		{name: "narrow", width: 40, golden: "dirstat_narrow.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateDirStat(files, tt.width)
+
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+			if got != string(want) {
+				t.Errorf("GenerateDirStat() differs from golden file %s\nGot:\n%s\nWant:\n%s", tt.golden, got, string(want))
+			}
+
+			width := tt.width
+			if width == 0 {
+				width = DefaultWidth
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+				if strings.Contains(line, "|") && displayWidth(line) > width {
+					t.Errorf("line exceeds width %d: %q", width, line)
+				}
+			}
+		})
+	}
+
+	if got := GenerateDirStat(map[string]Summary{"a.yaml": {}}, 0); got != "No changes detected.\n" {
+		t.Errorf("GenerateDirStat() with no changes = %q", got)
+	}
+}
+
+func TestMaxChanges(t *testing.T) {
+	var changes []diff.Change
+	for i := 0; i < 1240; i++ {
+		changes = append(changes, diff.Change{
+			Type:     diff.ChangeTypeAdd,
+			Path:     fmt.Sprintf("/key%04d", i),
+			NewValue: tree.NewNumber(float64(i)),
+		})
+	}
+	opts := Options{MaxChanges: 6, NoColor: true}
+	notice := "… and 1,234 more changes (re-run with --max-shown 0 to see all)"
+
+	t.Run("compact", func(t *testing.T) {
+		o := opts
+		o.Compact = true
+		got := Generate(changes, o)
+		if !strings.Contains(got, "(1240 total)") {
+			t.Errorf("summary should count all changes:\n%s", got)
+		}
+		if strings.Count(got, "  + /key") != 6 {
+			t.Errorf("expected 6 rendered changes:\n%s", got)
+		}
+		if !strings.HasSuffix(got, "  "+notice+"\n") {
+			t.Errorf("missing remainder note:\n%s", got)
+		}
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		got := GenerateMarkdown(changes, opts)
+		if strings.Count(got, "| `/key") != 6 || !strings.Contains(got, "_"+notice+"_") {
+			t.Errorf("unexpected markdown:\n%s", got)
+		}
+	})
+
+	t.Run("github-comment", func(t *testing.T) {
+		got := GenerateGitHubComment(changes, "", opts, 0)
+		if strings.Count(got, "| `/key") != 6 || !strings.Contains(got, "_"+notice+"_") {
+			t.Errorf("unexpected comment:\n%s", got)
+		}
+
+		// The size cap still applies and counts the limited-out changes
+		small := GenerateGitHubComment(changes, "", opts, 400)
+		if len(small) > 400 {
+			t.Errorf("comment exceeds size cap: %d bytes", len(small))
+		}
+		if !strings.Contains(small, "more changes not shown") {
+			t.Errorf("expected size truncation notice:\n%s", small)
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		if got := Generate(changes[:3], Options{MaxChanges: 3, NoColor: true}); strings.Contains(got, "more change") {
+			t.Errorf("no note expected when nothing is left out:\n%s", got)
+		}
+	})
+}
+
+func TestFormatCount(t *testing.T) {
+	tests := map[int]string{0: "0", 7: "7", 999: "999", 1000: "1,000", 1234: "1,234", 1234567: "1,234,567", -4321: "-4,321"}
+	for n, want := range tests {
+		if got := formatCount(n); got != want {
+			t.Errorf("formatCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestGenerateJSON(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeModify, Path: "/spec/replicas", OldValue: &tree.Node{Kind: tree.KindNumber, Value: 2.0, Line: 3}, NewValue: &tree.Node{Kind: tree.KindNumber, Value: 3.0, Line: 3}},
+		{Type: diff.ChangeTypeAdd, Path: "/metadata/labels", NewValue: tree.NewObject(map[string]*tree.Node{"app": tree.NewString("web")})},
+		{Type: diff.ChangeTypeRemove, Path: "/debug", OldValue: tree.NewNull()},
+		{Type: diff.ChangeTypeAdd, Path: "/ports", NewValue: tree.NewArray([]*tree.Node{tree.NewNumber(80), tree.NewNumber(443)})},
+	}
+
+	got, err := GenerateJSON(changes, "old.yaml", "new.yaml", Options{Sort: SortPath})
+	if err != nil {
+		t.Fatalf("GenerateJSON() error = %v", err)
+	}
+
+	goldenPath := filepath.Join("..", "testdata", "report", "json_output.json")
+	if *updateGolden {
+		if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+	}
+	if got != string(want) {
+		t.Errorf("GenerateJSON() mismatch\nGot:\n%s\nWant:\n%s", got, want)
+	}
+
+	// A removed null must stay distinguishable from an absent value
+	var out JSONOutput
+	if err := json.Unmarshal([]byte(got), &out); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	for _, c := range out.Changes {
+		if c.Path == "/debug" && (string(c.Old) != "null" || c.New != nil) {
+			t.Errorf("/debug old = %s, new = %s, want null and absent", c.Old, c.New)
+		}
+	}
+}
+
+// TestJSONSchema regenerates the published JSON Schemas from JSONOutput and
+// JSONDirOutput so they cannot drift. Run with -update after changing the
+// output types.
+func TestJSONSchema(t *testing.T) {
+	schemas := []struct {
+		name        string
+		typ         reflect.Type
+		title       string
+		description string
+	}{
+		{"output", reflect.TypeOf(JSONOutput{}), "configdiff JSON output", "Document produced by configdiff -o json."},
+		{"dir-output", reflect.TypeOf(JSONDirOutput{}), "configdiff directory JSON output", "Document produced by configdiff -r -o json for two directories."},
+	}
+
+	for _, s := range schemas {
+		t.Run(s.name, func(t *testing.T) {
+			file := s.name + ".v" + JSONSchemaVersion + ".json"
+			schema := map[string]interface{}{
+				"$schema":     "https://json-schema.org/draft/2020-12/schema",
+				"$id":         "https://github.com/pfrederiksen/configdiff/docs/schema/" + file,
+				"title":       s.title,
+				"description": s.description,
+			}
+			for k, v := range jsonSchemaFor(s.typ) {
+				schema[k] = v
+			}
+			data, err := json.MarshalIndent(schema, "", "  ")
+			if err != nil {
+				t.Fatalf("failed to marshal schema: %v", err)
+			}
+			got := string(data) + "\n"
+
+			schemaPath := filepath.Join("..", "docs", "schema", file)
+			if *updateGolden {
+				if err := os.WriteFile(schemaPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update schema file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(schemaPath)
+			if err != nil {
+				t.Fatalf("Failed to read schema file %s: %v (run with -update to create)", schemaPath, err)
+			}
+			if got != string(want) {
+				t.Errorf("%s is out of date; run go test ./report/ -run TestJSONSchema -update", schemaPath)
+			}
+		})
+	}
+}
+
+// jsonSchemaFor describes typ as a JSON Schema, following encoding/json tags.
+// A `jsonschema:"enum=a|b"` tag restricts a string field to the listed values.
+func jsonSchemaFor(typ reflect.Type) map[string]interface{} {
+	if typ == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{"description": "Any JSON value."}
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "minimum": 0}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchemaFor(typ.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			prop := jsonSchemaFor(field.Type)
+			if enum, ok := strings.CutPrefix(field.Tag.Get("jsonschema"), "enum="); ok {
+				prop["enum"] = strings.Split(enum, "|")
+			}
+			properties[name] = prop
+			if opts != "omitempty" {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		panic(fmt.Sprintf("jsonSchemaFor: unsupported type %s", typ))
+	}
+}
+
+func TestGenerateGitHubAnnotations(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeModify, Path: "/spec/replicas", OldValue: &tree.Node{Kind: tree.KindNumber, Value: 2.0, Line: 14}, NewValue: &tree.Node{Kind: tree.KindNumber, Value: 5.0, Line: 14}},
+		{Type: diff.ChangeTypeRemove, Path: "/debug", OldValue: &tree.Node{Kind: tree.KindBool, Value: true, Line: 3}},
+		{Type: diff.ChangeTypeModify, Path: "/port", OldValue: tree.NewString("80"), NewValue: tree.NewNumber(80)},
+		{Type: diff.ChangeTypeAdd, Path: "/motd", NewValue: tree.NewString("100%\nready\r")},
+	}
+
+	tests := []struct {
+		name   string
+		file   string
+		levels map[string]string
+		want   string
+	}{
+		{
+			name: "default levels",
+			file: "new.yaml",
+			want: "::warning file=new.yaml,line=14,title=config change::/spec/replicas changed 2 → 5\n" +
+				"::error file=new.yaml,title=config change::/debug removed (was: true)\n" +
+				"::error file=new.yaml,title=config change::/port changed \"80\" → 80\n" +
+				"::notice file=new.yaml,title=config change::/motd added: \"100%25\\nready\\r\"\n",
+		},
+		{
+			name:   "overridden levels and escaped file",
+			file:   "dir,1/a:b.yaml",
+			levels: map[string]string{"remove": AnnotationWarning, AnnotationTypeChange: AnnotationNotice},
+			want: "::warning file=dir%2C1/a%3Ab.yaml,line=14,title=config change::/spec/replicas changed 2 → 5\n" +
+				"::warning file=dir%2C1/a%3Ab.yaml,title=config change::/debug removed (was: true)\n" +
+				"::notice file=dir%2C1/a%3Ab.yaml,title=config change::/port changed \"80\" → 80\n" +
+				"::notice file=dir%2C1/a%3Ab.yaml,title=config change::/motd added: \"100%25\\nready\\r\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateGitHubAnnotations(changes, tt.file, Options{AnnotationLevels: tt.levels})
+			if got != tt.want {
+				t.Errorf("GenerateGitHubAnnotations() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeAnnotation(t *testing.T) {
+	if got, want := escapeAnnotationData("50% done\r\nnext: a,b"), "50%25 done%0D%0Anext: a,b"; got != want {
+		t.Errorf("escapeAnnotationData() = %q, want %q", got, want)
+	}
+	if got, want := escapeAnnotationProperty("50% a:b,c\n"), "50%25 a%3Ab%2Cc%0A"; got != want {
+		t.Errorf("escapeAnnotationProperty() = %q, want %q", got, want)
+	}
+}
+
+func TestParseAnnotationLevels(t *testing.T) {
+	got, err := ParseAnnotationLevels([]string{"add=warning", " Type-Change = NOTICE "})
+	if err != nil {
+		t.Fatalf("ParseAnnotationLevels() error = %v", err)
+	}
+	want := map[string]string{"add": AnnotationWarning, AnnotationTypeChange: AnnotationNotice}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAnnotationLevels() = %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"add", "rename=error", "add=fatal"} {
+		if _, err := ParseAnnotationLevels([]string{spec}); err == nil {
+			t.Errorf("ParseAnnotationLevels(%q) expected error", spec)
+		}
+	}
+}
+
+func TestGenerateWithContext(t *testing.T) {
+	oldTree, err := parse.ParseYAML([]byte("spec:\n  a: 1\n  b: 2\n  c: 3\n  d: 4\n  e: 5\n  ports: [80, 443, 8080, 9090]\nname: web\n"))
+	if err != nil {
+		t.Fatalf("ParseYAML() error = %v", err)
+	}
+	newTree, err := parse.ParseYAML([]byte("spec:\n  a: 1\n  b: 2\n  c: 30\n  d: 4\n  f: 5\n  ports: [80, 443, 9090]\nname: web\n"))
+	if err != nil {
+		t.Fatalf("ParseYAML() error = %v", err)
+	}
+	changes, err := diff.Diff(oldTree, newTree, diff.Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	tests := []struct {
+		context int
+		golden  string
+	}{
+		{context: 0, golden: "context_0.txt"},
+		{context: 1, golden: "context_1.txt"},
+		{context: 3, golden: "context_3.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Sort = SortPath
+			opts.ContextLines = tt.context
+			got := GenerateWithContext(changes, oldTree, newTree, opts)
+
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+			if got != string(want) {
+				t.Errorf("GenerateWithContext() mismatch\nGot:\n%s\nWant:\n%s", got, want)
+			}
+		})
+	}
+
+	// Without trees there is nothing to show, whatever ContextLines says
+	opts := DefaultOptions()
+	opts.Sort = SortPath
+	plain := Generate(changes, opts)
+	opts.ContextLines = 3
+	if got, want := GenerateWithContext(changes, nil, nil, opts), plain; got != want {
+		t.Errorf("GenerateWithContext() without trees =\n%s\nwant Generate output:\n%s", got, want)
+	}
+}
+
+func TestSplitLastSegment(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantParent string
+		wantKey    string
+		wantIndex  int
+		wantOK     bool
+	}{
+		{path: "/spec/replicas", wantParent: "/spec", wantKey: "replicas", wantIndex: -1, wantOK: true},
+		{path: "/name", wantParent: "/", wantKey: "name", wantIndex: -1, wantOK: true},
+		{path: "/spec/ports[2]", wantParent: "/spec/ports", wantIndex: 2, wantOK: true},
+		{path: "/matrix[0][1]", wantParent: "/matrix[0]", wantIndex: 1, wantOK: true},
+		{path: "/[3]", wantParent: "/", wantIndex: 3, wantOK: true},
+		{path: "/", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			parent, key, index, ok := splitLastSegment(tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("splitLastSegment(%q) ok = %v, want %v", tt.path, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if parent != tt.wantParent || key != tt.wantKey || index != tt.wantIndex {
+				t.Errorf("splitLastSegment(%q) = %q, %q, %d; want %q, %q, %d", tt.path, parent, key, index, tt.wantParent, tt.wantKey, tt.wantIndex)
+			}
+		})
+	}
+}
+
+// largeChangeSet builds n synthetic changes of mixed types.
+func largeChangeSet(n int) []diff.Change {
+	changes := make([]diff.Change, n)
+	for i := range changes {
+		path := fmt.Sprintf("/services/svc%d/config/value", i)
+		switch i % 3 {
+		case 0:
+			changes[i] = diff.Change{Type: diff.ChangeTypeAdd, Path: path, NewValue: tree.NewString(fmt.Sprintf("value-%d", i))}
+		case 1:
+			changes[i] = diff.Change{Type: diff.ChangeTypeRemove, Path: path, OldValue: tree.NewNumber(float64(i))}
+		default:
+			changes[i] = diff.Change{Type: diff.ChangeTypeModify, Path: path, OldValue: tree.NewNumber(float64(i)), NewValue: tree.NewNumber(float64(i + 1))}
+		}
+	}
+	return changes
+}
+
+// failingWriter fails every write after the first n bytes.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, fmt.Errorf("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteReport(t *testing.T) {
+	changes := largeChangeSet(50)
+	for _, opts := range []Options{DefaultOptions(), {Compact: true, NoColor: true, GroupBy: "depth-1", MaxChanges: 10}} {
+		var b strings.Builder
+		if err := WriteReport(&b, changes, opts); err != nil {
+			t.Fatalf("WriteReport() error = %v", err)
+		}
+		if got, want := b.String(), Generate(changes, opts); got != want {
+			t.Errorf("WriteReport() differs from Generate()\nGot:\n%s\nWant:\n%s", got, want)
+		}
+	}
+
+	err := WriteReport(&failingWriter{n: 100}, changes, DefaultOptions())
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("WriteReport() error = %v, want disk full", err)
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	changes := largeChangeSet(100000)
+	opts := DefaultOptions()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = io.WriteString(io.Discard, Generate(changes, opts))
+	}
+}
+
+func BenchmarkWriteReport(b *testing.B) {
+	changes := largeChangeSet(100000)
+	opts := DefaultOptions()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := WriteReport(io.Discard, changes, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGenerateGitDiff_ASCII(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeMove, Path: "/items[1]", OldValue: tree.NewString("b"), NewValue: tree.NewString("b")},
+	}
+	got := GenerateGitDiffWithOptions(changes, "old.yaml", "new.yaml", Options{NoColor: true, ASCIIOnly: true})
+	if !utf8ValidASCII(got) {
+		t.Errorf("GenerateGitDiffWithOptions() with ASCIIOnly contains non-ASCII characters:\n%s", got)
+	}
+	if !strings.Contains(got, `~/items[1]: "b" -> "b"`) {
+		t.Errorf("GenerateGitDiffWithOptions() = %s, want ASCII move arrow", got)
+	}
+}
+
+// utf8ValidASCII reports whether s contains only ASCII characters.
+func utf8ValidASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func testDirResult() DirResult {
+	return DirResult{
+		OldDir: "old",
+		NewDir: "new",
+		Files: []FileResult{
+			{Path: "app/config.yaml", Status: FileModified, Changes: []diff.Change{
+				{Type: diff.ChangeTypeModify, Path: "/replicas", OldValue: tree.NewNumber(2), NewValue: tree.NewNumber(3)},
+				{Type: diff.ChangeTypeAdd, Path: "/debug", NewValue: tree.NewBool(true)},
+			}},
+			{Path: "app/same.yaml", Status: FileUnchanged},
+			{Path: "broken.yaml", Status: FileError, Error: "failed to parse new/broken.yaml: yaml: line 2: did not find expected key"},
+			{Path: "data/dump.json", Status: FileSkipped, Error: "too large, over --max-file-size 50MB"},
+			{Path: "legacy.json", Status: FileRemoved},
+			{Path: "svc/api.yaml", Status: FileRenamed, OldPath: "api.yaml", Similarity: 0.875, Changes: []diff.Change{
+				{Type: diff.ChangeTypeModify, Path: "/port", OldValue: tree.NewNumber(80), NewValue: tree.NewNumber(8080)},
+			}},
+			{Path: "values.yaml", OldPath: "values.json", Status: FileModified, Changes: []diff.Change{
+				{Type: diff.ChangeTypeRemove, Path: "/image/tag", OldValue: tree.NewString("1.0")},
+			}},
+			{Path: "zz-new.toml", Status: FileAdded},
+		},
+		MaxDepth: 3,
+	}
+}
+
+func TestGenerateDir(t *testing.T) {
+	dir := testDirResult()
+	opts := Options{ShowValues: true, NoColor: true, Sort: SortPath}
+
+	dirJSON, err := GenerateDirJSON(dir, Options{Sort: SortPath})
+	if err != nil {
+		t.Fatalf("GenerateDirJSON() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		golden string
+		got    string
+	}{
+		{"report", "dir_report.txt", GenerateDirReport(dir, opts)},
+		{"compact", "dir_compact.txt", GenerateDirReport(dir, Options{Compact: true, NoColor: true, Sort: SortPath})},
+		{"json", "dir_output.json", dirJSON},
+		{"markdown", "dir_markdown.md", GenerateDirMarkdown(dir, Options{Sort: SortPath})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(tt.got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+			if tt.got != string(want) {
+				t.Errorf("%s mismatch\nGot:\n%s\nWant:\n%s", tt.name, tt.got, want)
+			}
+		})
+	}
+}
+
+func TestDirResult_Summarize(t *testing.T) {
+	dir := testDirResult()
+
+	got := dir.Summarize(Options{})
+	want := DirSummary{Compared: 3, Changed: 2, Added: 1, Removed: 1, Renamed: 1, Errors: 1, Skipped: 1,
+		Changes: Summary{Total: 4, Added: 1, Removed: 1, Modified: 2}}
+	if got != want {
+		t.Errorf("Summarize() = %+v, want %+v", got, want)
+	}
+
+	// Filtered-out changes leave a file unchanged in the summary
+	got = dir.Summarize(Options{FilterTypes: []diff.ChangeType{diff.ChangeTypeRemove}})
+	if got.Changed != 1 || got.Changes.Total != 1 || got.Changes.Hidden != 3 {
+		t.Errorf("Summarize(remove) = %+v, want 1 changed file, 1 change, 3 hidden", got)
+	}
+
+	if !dir.HasChanges() {
+		t.Error("HasChanges() = false, want true")
+	}
+	if (DirResult{Files: []FileResult{{Path: "a.yaml", Status: FileUnchanged}}}).HasChanges() {
+		t.Error("HasChanges() = true for unchanged files, want false")
+	}
+	if !(DirResult{Files: []FileResult{{Path: "b.yaml", Status: FileRenamed, OldPath: "a.yaml", Similarity: 1}}}).HasChanges() {
+		t.Error("HasChanges() = false for an exact rename, want true")
+	}
+	if (DirResult{Files: []FileResult{{Path: "a.yaml", Status: FileError, Error: "bad"}}}).HasChanges() {
+		t.Error("HasChanges() = true for a file that could not be compared, want false")
+	}
+
+	files := dir.FileChanges()
+	if len(files) != 8 || files[4].File != "legacy.json" || len(files[4].Changes) != 1 ||
+		files[4].Changes[0].Type != diff.ChangeTypeRemove || files[4].Changes[0].Path != "/" {
+		t.Errorf("FileChanges() removed file = %+v, want a root remove", files[4])
+	}
+	if len(files[2].Changes) != 0 {
+		t.Errorf("FileChanges() failed file = %+v, want no changes", files[2])
+	}
+}
+
+func TestDirResult_TimedOut(t *testing.T) {
+	dir := DirResult{OldDir: "old", NewDir: "new", Files: []FileResult{
+		{Path: "a.yaml", Status: FileUnchanged, ParseDuration: 1500 * time.Microsecond, DiffDuration: 250 * time.Microsecond},
+		{Path: "b.yaml", Status: FileError, Error: "bad"},
+		{Path: "huge.json", Status: FileError, Error: "timed out after 1s (--timeout-per-file)", TimedOut: true},
+	}}
+
+	s := dir.Summarize(Options{})
+	if s.Errors != 2 || s.TimedOut != 1 {
+		t.Errorf("Summarize() = %+v, want 2 errors, 1 timed out", s)
+	}
+	if got := GenerateDirReport(dir, Options{NoColor: true}); !strings.Contains(got, "1 failed, 1 timed out") {
+		t.Errorf("GenerateDirReport() summary should count the failed and timed out files apart:\n%s", got)
+	}
+
+	out, err := NewJSONDirOutput(dir, Options{})
+	if err != nil {
+		t.Fatalf("NewJSONDirOutput() error = %v", err)
+	}
+	if out.Summary.Errors != 2 || out.Summary.TimedOut != 1 {
+		t.Errorf("JSON summary = %+v, want 2 errors, 1 timed out", out.Summary)
+	}
+	if f := out.Files[0]; f.ParseMs != 1.5 || f.DiffMs != 0.25 || f.TimedOut {
+		t.Errorf("JSON files[0] = %+v, want parseMs 1.5, diffMs 0.25", f)
+	}
+	if f := out.Files[2]; !f.TimedOut || f.Status != "error" {
+		t.Errorf("JSON files[2] = %+v, want a timed out error", f)
+	}
+
+	// Unmeasured durations and files that did not time out are left out
+	data, err := GenerateDirJSON(dir, Options{})
+	if err != nil {
+		t.Fatalf("GenerateDirJSON() error = %v", err)
+	}
+	if strings.Count(data, `"parseMs"`) != 1 || strings.Count(data, `"timedOut"`) != 2 {
+		t.Errorf("GenerateDirJSON() should only include measured timings and timed out files:\n%s", data)
+	}
+}
+
+func TestShortenPath(t *testing.T) {
+	deep := "/spec/template/spec/containers[0]/livenessProbe/httpGet/httpHeaders[2]/value"
+	tests := []struct {
+		path string
+		max  int
+		sym  symbolSet
+		want string
+	}{
+		{deep, 3, unicodeSymbols, "/spec/…/httpHeaders[2]/value"},
+		{deep, 5, unicodeSymbols, "/spec/template/…/httpGet/httpHeaders[2]/value"},
+		{deep, 5, asciiSymbols, "/spec/template/.../httpGet/httpHeaders[2]/value"},
+		{deep, 1, unicodeSymbols, "/…/value"},
+		{deep, 8, unicodeSymbols, deep},
+		{deep, 0, unicodeSymbols, deep},
+		{"/a/b/c", 2, unicodeSymbols, "/a/…/c"},
+		{"/", 2, unicodeSymbols, "/"},
+		{"spec/template/spec/containers[0]", 2, unicodeSymbols, "spec/…/containers[0]"},
+	}
+
+	for _, tt := range tests {
+		if got := shortenPath(tt.path, tt.max, tt.sym); got != tt.want {
+			t.Errorf("shortenPath(%q, %d) = %q, want %q", tt.path, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestMaxPathSegments(t *testing.T) {
+	deep := "/spec/template/spec/containers[0]/livenessProbe/httpGet/httpHeaders[2]/value"
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeModify, Path: deep, OldValue: tree.NewString("a"), NewValue: tree.NewString("b")},
+		{Type: diff.ChangeTypeAdd, Path: "/spec/replicas", NewValue: tree.NewNumber(3)},
+	}
+	short := "/spec/template/…/httpGet/httpHeaders[2]/value"
+	opts := Options{ShowValues: true, NoColor: true, Sort: SortPath, MaxPathSegments: DefaultMaxPathSegments}
+
+	outputs := map[string]string{
+		"report":       Generate(changes, opts),
+		"compact":      Generate(changes, Options{Compact: true, NoColor: true, MaxPathSegments: DefaultMaxPathSegments}),
+		"side-by-side": GenerateSideBySide(changes, opts),
+	}
+	for name, got := range outputs {
+		if !strings.Contains(got, short) || strings.Contains(got, deep) {
+			t.Errorf("%s: want %q instead of the full path, got:\n%s", name, short, got)
+		}
+		if !strings.Contains(got, "/spec/replicas") {
+			t.Errorf("%s: shallow path should be unchanged, got:\n%s", name, got)
+		}
+	}
+
+	// The tree shortens the collapsed chain above the changed leaf
+	got := GenerateTree(changes, opts)
+	if !strings.Contains(got, "└─ template/spec/…/httpGet/httpHeaders[2]/value ~") {
+		t.Errorf("tree: want a shortened chain, got:\n%s", got)
+	}
+
+	// Machine-readable output keeps full paths
+	jsonOut, err := GenerateJSON(changes, "", "", opts)
+	if err != nil {
+		t.Fatalf("GenerateJSON() error = %v", err)
+	}
+	if !strings.Contains(jsonOut, deep) {
+		t.Errorf("json: want the full path, got:\n%s", jsonOut)
+	}
+}
+
+func TestGenerateTAP(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeRemove, Path: "/debug", OldValue: tree.NewBool(true)},
+		{Type: diff.ChangeTypeModify, Path: "/spec/replicas", OldValue: tree.NewNumber(2), NewValue: tree.NewNumber(3)},
+		{Type: diff.ChangeTypeAdd, Path: "/labels", NewValue: tree.NewObject(map[string]*tree.Node{"app": tree.NewString("web")})},
+	}
+	single, err := GenerateTAP(changes, "old.yaml", "new #1.yaml", Options{})
+	if err != nil {
+		t.Fatalf("GenerateTAP() error = %v", err)
+	}
+	dir, err := GenerateDirTAP(testDirResult(), Options{})
+	if err != nil {
+		t.Fatalf("GenerateDirTAP() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		golden string
+		got    string
+	}{
+		{"single", "tap_single.txt", single},
+		{"directory", "tap_dir.txt", dir},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goldenPath := filepath.Join("..", "testdata", "report", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(tt.got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file %s: %v (run with -update to create)", goldenPath, err)
+			}
+			if tt.got != string(want) {
+				t.Errorf("%s mismatch\nGot:\n%s\nWant:\n%s", tt.name, tt.got, want)
+			}
+		})
+	}
+
+	// No changes is a single passing test point
+	got, err := GenerateTAP(nil, "old.yaml", "new.yaml", Options{})
+	if err != nil {
+		t.Fatalf("GenerateTAP() error = %v", err)
+	}
+	if want := "TAP version 13\n1..1\nok 1 - old.yaml vs new.yaml\n"; got != want {
+		t.Errorf("GenerateTAP(no changes) = %q, want %q", got, want)
+	}
+
+	// Filtered-out changes pass
+	got, err = GenerateTAP(changes[:1], "old.yaml", "new.yaml", Options{FilterTypes: []diff.ChangeType{diff.ChangeTypeAdd}})
+	if err != nil {
+		t.Fatalf("GenerateTAP() error = %v", err)
+	}
+	if !strings.Contains(got, "\nok 1 - ") {
+		t.Errorf("GenerateTAP(filtered) = %q, want a passing test point", got)
+	}
+}
+
+// severityChanges has a change of every severity: an addition and a move
+// (info), a modification (warning), and a removal and a kind change
+// (breaking).
+func severityChanges() []diff.Change {
+	return []diff.Change{
+		{Type: diff.ChangeTypeAdd, Path: "/labels/team", NewValue: tree.NewString("web")},
+		{Type: diff.ChangeTypeModify, Path: "/replicas", OldValue: tree.NewNumber(2), NewValue: tree.NewNumber(3)},
+		{Type: diff.ChangeTypeMove, Path: "/ports[1]", OldValue: tree.NewNumber(443), NewValue: tree.NewNumber(443)},
+		{Type: diff.ChangeTypeModify, Path: "/resources", OldValue: tree.NewString("small"), NewValue: tree.NewObject(map[string]*tree.Node{"cpu": tree.NewString("1")})},
+		{Type: diff.ChangeTypeRemove, Path: "/required", OldValue: tree.NewBool(true)},
+	}
+}
+
+func TestClassifyChange(t *testing.T) {
+	want := []Severity{SeverityInfo, SeverityWarning, SeverityInfo, SeverityBreaking, SeverityBreaking}
+	for i, change := range severityChanges() {
+		if got := ClassifyChange(change); got != want[i] {
+			t.Errorf("ClassifyChange(%s %s) = %s, want %s", change.Type, change.Path, got, want[i])
+		}
+	}
+
+	// Colors follow severity rather than change type
+	colors := map[string]string{"/required": "\x1b[31m", "/replicas": "\x1b[33m", "/labels/team": "\x1b[34m"}
+	for _, change := range severityChanges() {
+		code, ok := colors[change.Path]
+		if !ok {
+			continue
+		}
+		got := formatChange(change, Options{ClassifySeverity: true})
+		if !strings.HasPrefix(got, "  "+code) {
+			t.Errorf("formatChange(%s) = %q, want it to start with %q", change.Path, got, code)
+		}
+	}
+
+	// Sorting by severity puts breaking changes first, then by change type
+	got := SelectChanges(severityChanges(), Options{Sort: SortSeverity, ClassifySeverity: true})
+	order := []string{"/required", "/resources", "/replicas", "/ports[1]", "/labels/team"}
+	for i, change := range got {
+		if change.Path != order[i] {
+			t.Errorf("SelectChanges(severity)[%d] = %s, want %s", i, change.Path, order[i])
+		}
+	}
+
+	// Exports report the classified severity only when enabled
+	records := changeRecords([]FileChanges{{File: "f", Changes: severityChanges()}}, Options{})
+	if records[3].Severity != "warning" || records[0].Severity != "note" {
+		t.Errorf("unclassified severities = %s, %s, want warning, note", records[3].Severity, records[0].Severity)
+	}
+	records = changeRecords([]FileChanges{{File: "f", Changes: severityChanges()}}, Options{ClassifySeverity: true})
+	if records[3].Severity != "breaking" || records[0].Severity != "info" {
+		t.Errorf("classified severities = %s, %s, want breaking, info", records[3].Severity, records[0].Severity)
+	}
+}
+
+func TestSeverityRules(t *testing.T) {
+	opts := Options{ClassifySeverity: true, SeverityRules: []SeverityRule{
+		{Match: "/labels/**", Severity: SeverityBreaking},
+		{Match: "/replicas", Severity: SeverityInfo},
+		{Match: "/labels/team", Severity: SeverityWarning},
+	}}
+
+	// The last matching rule wins; other changes keep their classification
+	records := changeRecords([]FileChanges{{File: "f", Changes: severityChanges()}}, opts)
+	want := []string{"warning", "info", "info", "breaking", "breaking"}
+	for i, record := range records {
+		if record.Severity != want[i] {
+			t.Errorf("severity of %s = %s, want %s", record.Path, record.Severity, want[i])
+		}
+	}
+	got := SelectChanges(severityChanges(), Options{Sort: SortSeverity, ClassifySeverity: true, SeverityRules: opts.SeverityRules})
+	order := []string{"/required", "/resources", "/labels/team", "/replicas", "/ports[1]"}
+	for i, change := range got {
+		if change.Path != order[i] {
+			t.Errorf("SelectChanges(severity)[%d] = %s, want %s", i, change.Path, order[i])
+		}
+	}
+
+	for _, name := range []string{"error", "Breaking", "warn", "info"} {
+		if _, err := ParseSeverity(name); err != nil {
+			t.Errorf("ParseSeverity(%q) error = %v", name, err)
+		}
+	}
+	if err := ValidateSeverityRules([]SeverityRule{{Match: "/a", Severity: "critical"}}); err == nil {
+		t.Error("ValidateSeverityRules() with an unknown severity = nil, want error")
+	}
+	if err := ValidateSeverityRules([]SeverityRule{{Match: "/db*", Severity: SeverityInfo}}); err == nil {
+		t.Error("ValidateSeverityRules() with a partial wildcard = nil, want error")
+	}
+}
+
+// valueStyleChanges has scalars, containers, a multi-line string, and a
+// value longer than 40 characters.
+func valueStyleChanges() []diff.Change {
+	return []diff.Change{
+		{Type: diff.ChangeTypeModify, Path: "/name", OldValue: tree.NewString("web"), NewValue: tree.NewString(`we"b <1>`)},
+		{Type: diff.ChangeTypeAdd, Path: "/labels", NewValue: tree.NewObject(map[string]*tree.Node{
+			"app":   tree.NewString("web"),
+			"ports": tree.NewArray([]*tree.Node{tree.NewNumber(80), tree.NewNumber(443)}),
+		})},
+		{Type: diff.ChangeTypeRemove, Path: "/debug", OldValue: tree.NewNull()},
+		{Type: diff.ChangeTypeModify, Path: "/script", OldValue: tree.NewString("echo hi\nexit 0\n"), NewValue: tree.NewString("echo bye\nexit 0\n")},
+		{Type: diff.ChangeTypeAdd, Path: "/description", NewValue: tree.NewString("a description that is much longer than forty characters")},
+	}
+}
+
+func TestFormatValueStyle(t *testing.T) {
+	obj := tree.NewObject(map[string]*tree.Node{
+		"b": tree.NewArray([]*tree.Node{tree.NewNumber(1), tree.NewBool(true)}),
+		"a": tree.NewString("x<y"),
+	})
+	tests := []struct {
+		node   *tree.Node
+		style  string
+		maxLen int
+		want   string
+	}{
+		{tree.NewString("say \"hi\"\n\t<b>"), ValueStyleJSON, 0, `"say \"hi\"\n\t<b>"`},
+		{tree.NewString("\u2028"), ValueStyleJSON, 0, `"\u2028"`},
+		{obj, ValueStyleJSON, 0, `{"a":"x<y","b":[1,true]}`},
+		{obj, ValueStyleJSON, 10, `{"a":"x...`},
+		{tree.NewNumber(1.5), ValueStyleJSON, 0, "1.5"},
+		{tree.NewNull(), ValueStyleJSON, 0, "null"},
+		{obj, ValueStyleYAML, 0, "{a: x<y, b: [1, true]}"},
+		{tree.NewString("two\nlines"), ValueStyleYAML, 0, `"two\nlines"`},
+		{tree.NewString("true"), ValueStyleYAML, 0, `"true"`},
+		{tree.NewString("plain"), ValueStyleYAML, 0, "plain"},
+		{tree.NewString("tab\t"), ValueStyleGo, 0, `"tab\t"`},
+		{tree.NewString("abcdefghij"), ValueStyleGo, 8, `"abc..."`},
+		{obj, ValueStyleAuto, 0, "{...} (2 keys)"},
+		{obj, "", 0, "{...} (2 keys)"},
+	}
+
+	for _, tt := range tests {
+		if got := formatValueStyle(tt.node, tt.maxLen, tt.style); got != tt.want {
+			t.Errorf("formatValueStyle(%v, %d, %q) = %s, want %s", tt.node.ToInterface(), tt.maxLen, tt.style, got, tt.want)
+		}
+	}
+
+	if err := ValidateValueStyle("xml"); err == nil {
+		t.Error("ValidateValueStyle(xml) = nil, want error")
+	}
+}
+
+func TestGenerateConflicts(t *testing.T) {
+	conflicts := []diff.Conflict{
+		{Path: "/replicas", Base: tree.NewNumber(2), Ours: tree.NewNumber(3), Theirs: tree.NewNumber(4)},
+		{Path: "/image", Base: tree.NewString("v1"), Ours: tree.NewString("v2")},
+	}
+
+	got := GenerateConflicts(conflicts, "ours.yaml", "theirs.yaml", Options{NoColor: true})
+	want := `Merge conflicts: 2 paths changed in both ours.yaml and theirs.yaml
+
+  /replicas
+    base:   2
+    ours:   3
+    theirs: 4
+
+  /image
+    base:   "v1"
+    ours:   "v2"
+    theirs: (absent)
+`
+	if got != want {
+		t.Errorf("GenerateConflicts() =\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := GenerateConflicts(nil, "ours.yaml", "theirs.yaml", Options{}); got != "No conflicts.\n" {
+		t.Errorf("GenerateConflicts(nil) = %q", got)
+	}
+}
+
+func TestGenerateConflictMarkers(t *testing.T) {
+	ours := "image: v2\nname: app\nreplicas: 3\n"
+	theirs := "image: v2\nname: app\nreplicas: 4\n"
+
+	got := GenerateConflictMarkers(ours, theirs, "ours.yaml", "theirs.yaml")
+	want := `image: v2
+name: app
+<<<<<<< ours.yaml
+replicas: 3
+=======
+replicas: 4
+>>>>>>> theirs.yaml
+`
+	if got != want {
+		t.Errorf("GenerateConflictMarkers() =\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := GenerateConflictMarkers(ours, ours, "a", "b"); got != ours {
+		t.Errorf("GenerateConflictMarkers() of equal documents = %q, want %q", got, ours)
+	}
+}
+
+func TestBrowseItems(t *testing.T) {
+	changes := []diff.Change{
+		{Type: diff.ChangeTypeModify, Path: "/spec/image", OldValue: tree.NewString("web:1"), NewValue: tree.NewString("web:2")},
+		{Type: diff.ChangeTypeAdd, Path: "/spec/env", NewValue: tree.NewObject(map[string]*tree.Node{"MODE": tree.NewString("prod")})},
+		{Type: diff.ChangeTypeRemove, Path: "/debug", OldValue: tree.NewString(strings.Repeat("x", 40))},
+	}
+	opts := Options{ShowValues: true, NoColor: true, MaxValueLength: 20, FilterTypes: []diff.ChangeType{diff.ChangeTypeModify, diff.ChangeTypeRemove, diff.ChangeTypeAdd}}
+
+	items := BrowseItems(changes, opts)
+	if len(items) != 3 {
+		t.Fatalf("BrowseItems() returned %d items, want 3", len(items))
+	}
+	tests := []struct {
+		group   string
+		line    string
+		details []string
+	}{
+		{"spec/", `~ /spec/image: "web:1" → "web:2"`, []string{"old: web:1", "new: web:2"}},
+		{"spec/", "+ /spec/env = {...} (1 keys)", []string{"new:", "  MODE: prod"}},
+		{"/", `- /debug (was: "` + strings.Repeat("x", 15) + `...")`, []string{"old: " + strings.Repeat("x", 40)}},
+	}
+	for i, tt := range tests {
+		if items[i].Group != tt.group || items[i].Line != tt.line || !reflect.DeepEqual(items[i].Details, tt.details) {
+			t.Errorf("item %d = %q %q %q, want %q %q %q", i, items[i].Group, items[i].Line, items[i].Details, tt.group, tt.line, tt.details)
+		}
+	}
+
+	opts.FilterTypes = []diff.ChangeType{diff.ChangeTypeAdd}
+	if items := BrowseItems(changes, opts); len(items) != 1 || items[0].Change.Path != "/spec/env" {
+		t.Errorf("BrowseItems() with FilterTypes add = %v, want only /spec/env", items)
+	}
+}
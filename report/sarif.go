@@ -0,0 +1,210 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pfrederiksen/configdiff/diff"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolURI = "https://github.com/pfrederiksen/configdiff"
+)
+
+// sarifLog is the top-level SARIF 2.1.0 document.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifChangeTypes lists the change types in rule order.
+var sarifChangeTypes = []diff.ChangeType{
+	diff.ChangeTypeAdd,
+	diff.ChangeTypeRemove,
+	diff.ChangeTypeModify,
+	diff.ChangeTypeMove,
+}
+
+// GenerateSARIF creates a SARIF 2.1.0 log for code-scanning integration.
+// Each change becomes a result located in file, with one rule per change type.
+// A result's region is the line of the new value, or of the old value for
+// removals, and is left out when the parser recorded none. Result levels
+// follow the classified severity under opts.ClassifySeverity.
+func GenerateSARIF(changes []diff.Change, file string, opts Options) (string, error) {
+	rules := make([]sarifRule, len(sarifChangeTypes))
+	ruleIndex := make(map[diff.ChangeType]int, len(sarifChangeTypes))
+	for i, ct := range sarifChangeTypes {
+		rules[i] = sarifRule{
+			ID:               sarifRuleID(ct),
+			Name:             fmt.Sprintf("Value%s", changeTypeVerb(ct)),
+			ShortDescription: sarifMessage{Text: fmt.Sprintf("Configuration value %s", changeTypeLabel(ct))},
+			DefaultConfiguration: sarifConfiguration{
+				Level: changeSeverity(ct),
+			},
+		}
+		ruleIndex[ct] = i
+	}
+
+	uri := filepath.ToSlash(file)
+	results := make([]sarifResult, 0, len(changes))
+	for _, change := range changes {
+		results = append(results, sarifResult{
+			RuleID:    sarifRuleID(change.Type),
+			RuleIndex: ruleIndex[change.Type],
+			Level:     sarifLevel(change, opts),
+			Message:   sarifMessage{Text: describeChange(change)},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: uri},
+					Region:           sarifChangeRegion(change),
+				},
+			}},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "configdiff",
+				InformationURI: sarifToolURI,
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal SARIF: %w", err)
+	}
+	return string(data), nil
+}
+
+// sarifRuleID returns the rule identifier for a change type.
+func sarifRuleID(ct diff.ChangeType) string {
+	return "configdiff/" + string(ct)
+}
+
+// sarifLevel maps a change to a SARIF result level. Under
+// opts.ClassifySeverity, breaking changes are errors, warnings warnings,
+// and info notes, as rated by classifyChange; otherwise the level is that
+// of its change type, which is the default of its rule: removals and
+// modifications may break consumers, so they are warnings.
+func sarifLevel(change diff.Change, opts Options) string {
+	if !opts.ClassifySeverity {
+		return changeSeverity(change.Type)
+	}
+	switch classifyChange(change, opts) {
+	case SeverityBreaking:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// sarifChangeRegion returns the region of change in its file: the line of
+// the new value, or of the old value for removals, or nil if unknown.
+func sarifChangeRegion(change diff.Change) *sarifRegion {
+	node := change.NewValue
+	if change.Type == diff.ChangeTypeRemove {
+		node = change.OldValue
+	}
+	if node == nil || node.Line <= 0 {
+		return nil
+	}
+	return &sarifRegion{StartLine: node.Line}
+}
+
+// changeTypeVerb returns the capitalized past-tense verb for a change type.
+func changeTypeVerb(ct diff.ChangeType) string {
+	switch ct {
+	case diff.ChangeTypeAdd:
+		return "Added"
+	case diff.ChangeTypeRemove:
+		return "Removed"
+	case diff.ChangeTypeModify:
+		return "Modified"
+	case diff.ChangeTypeMove:
+		return "Moved"
+	default:
+		return "Changed"
+	}
+}
+
+// describeChange returns a one-line plain-text description of a change.
+func describeChange(change diff.Change) string {
+	switch change.Type {
+	case diff.ChangeTypeAdd:
+		return fmt.Sprintf("Added %s = %s", change.Path, formatValue(change.NewValue, 0))
+	case diff.ChangeTypeRemove:
+		return fmt.Sprintf("Removed %s (was: %s)", change.Path, formatValue(change.OldValue, 0))
+	case diff.ChangeTypeModify, diff.ChangeTypeMove:
+		return fmt.Sprintf("%s %s: %s → %s", changeTypeVerb(change.Type), change.Path,
+			formatValue(change.OldValue, 0), formatValue(change.NewValue, 0))
+	default:
+		return fmt.Sprintf("Changed %s", change.Path)
+	}
+}
@@ -0,0 +1,154 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+)
+
+// Severity is how disruptive a change is likely to be for consumers of the
+// configuration, see ClassifyChange.
+type Severity string
+
+const (
+	// SeverityBreaking marks changes that can break consumers: removals and
+	// modifications that change a value's kind.
+	SeverityBreaking Severity = "breaking"
+
+	// SeverityWarning marks other modifications.
+	SeverityWarning Severity = "warning"
+
+	// SeverityInfo marks additions and moves.
+	SeverityInfo Severity = "info"
+)
+
+// ClassifyChange rates change as breaking, warning, or info.
+func ClassifyChange(change diff.Change) Severity {
+	switch {
+	case change.Type == diff.ChangeTypeRemove, change.IsKindChange():
+		return SeverityBreaking
+	case change.Type == diff.ChangeTypeModify:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// ParseSeverity parses a severity name: breaking, warning, or info, or the
+// aliases error for breaking and warn for warning.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case string(SeverityBreaking), "error":
+		return SeverityBreaking, nil
+	case string(SeverityWarning), "warn":
+		return SeverityWarning, nil
+	case string(SeverityInfo):
+		return SeverityInfo, nil
+	default:
+		return "", fmt.Errorf("invalid severity %q (valid: %s, %s, %s)", s, SeverityBreaking, SeverityWarning, SeverityInfo)
+	}
+}
+
+// SeverityRule rates the changes at paths matching a glob, as for
+// diff.MatchPath, instead of ClassifyChange.
+type SeverityRule struct {
+	Match    string
+	Severity Severity
+}
+
+// ValidateSeverityRules returns an error for the first rule with an invalid
+// glob or severity.
+func ValidateSeverityRules(rules []SeverityRule) error {
+	for _, rule := range rules {
+		if err := diff.ValidatePathPattern(rule.Match); err != nil {
+			return fmt.Errorf("invalid severity rule: %w", err)
+		}
+		if _, err := ParseSeverity(string(rule.Severity)); err != nil {
+			return fmt.Errorf("invalid severity rule for %s: %w", rule.Match, err)
+		}
+	}
+	return nil
+}
+
+// classifyChange rates change as ClassifyChange does, unless one of
+// opts.SeverityRules matches its path: the last rule that does wins.
+func classifyChange(change diff.Change, opts Options) Severity {
+	severity := ClassifyChange(change)
+	for _, rule := range opts.SeverityRules {
+		if diff.MatchPath(change.Path, rule.Match) {
+			severity = rule.Severity
+		}
+	}
+	return severity
+}
+
+// severityOrder orders severities from most to least disruptive.
+func severityOrder(s Severity) int {
+	switch s {
+	case SeverityBreaking:
+		return 0
+	case SeverityWarning:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// exportSeverity is the severity reported by the machine-readable exports:
+// the classified severity under opts.ClassifySeverity, otherwise the
+// two-level changeSeverity.
+func exportSeverity(change diff.Change, opts Options) string {
+	if opts.ClassifySeverity {
+		return string(classifyChange(change, opts))
+	}
+	return changeSeverity(change.Type)
+}
+
+// forSeverity returns the styling function for a severity: red, yellow,
+// or blue.
+func (p palette) forSeverity(s Severity) func(a ...interface{}) string {
+	switch s {
+	case SeverityBreaking:
+		return p.remove
+	case SeverityWarning:
+		return p.modify
+	default:
+		return p.info
+	}
+}
+
+// severityMarker returns the icon, or in ASCII mode the tag, that
+// precedes a change of severity s in Generate output.
+func severityMarker(s Severity, opts Options) string {
+	if opts.ASCIIOnly {
+		switch s {
+		case SeverityBreaking:
+			return "[BREAKING]"
+		case SeverityWarning:
+			return "[WARN]"
+		default:
+			return "[INFO]"
+		}
+	}
+	switch s {
+	case SeverityBreaking:
+		return "✖"
+	case SeverityWarning:
+		return "⚠"
+	default:
+		return "ℹ"
+	}
+}
+
+// severityLabel is the capitalized severity for Markdown tables.
+func severityLabel(s Severity) string {
+	switch s {
+	case SeverityBreaking:
+		return "Breaking"
+	case SeverityWarning:
+		return "Warning"
+	default:
+		return "Info"
+	}
+}
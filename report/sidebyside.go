@@ -4,82 +4,110 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/fatih/color"
 	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
 )
 
 // GenerateSideBySide creates a side-by-side comparison view.
+// The layout grows with the longest path and value, capped at Options.Width
+// terminal cells (DefaultWidth when unset), and splits into equal old and new
+// value columns.
 func GenerateSideBySide(changes []diff.Change, opts Options) string {
 	if len(changes) == 0 {
 		return "No changes detected.\n"
 	}
-
-	// Save and restore color state
-	originalNoColor := color.NoColor
-	defer func() { color.NoColor = originalNoColor }()
-	if opts.NoColor {
-		color.NoColor = true
+	changes, summary := selectChanges(changes, opts)
+	if len(changes) == 0 {
+		return noMatchingChanges(summary.Hidden)
 	}
 
+	width := sideBySideWidth(changes, opts)
+	half := (width - 4) / 2
+	leftWidth := half - 2
+	rightWidth := width - 2 - leftWidth - 3
+
+	sym := symbolsFor(opts)
 	var b strings.Builder
-	summary := summarizeChanges(changes)
-	
+
 	// Header
 	b.WriteString("Summary: ")
 	b.WriteString(formatSummary(summary, opts))
 	b.WriteString("\n")
-	b.WriteString(strings.Repeat("─", 80))
+	b.WriteString(strings.Repeat(sym.rule, width))
 	b.WriteString("\n")
-	b.WriteString(fmt.Sprintf("%-38s | %-38s\n", "Old Value", "New Value"))
-	b.WriteString(strings.Repeat("─", 80))
+	b.WriteString(fmt.Sprintf("%-*s | %-*s\n", half, "Old Value", half, "New Value"))
+	b.WriteString(strings.Repeat(sym.rule, width))
 	b.WriteString("\n")
-	
-	green := color.New(color.FgGreen).SprintFunc()
-	red := color.New(color.FgRed).SprintFunc()
-	yellow := color.New(color.FgYellow).SprintFunc()
-	
+
+	p := newPalette(opts.NoColor)
+
+	// Values are truncated to their column rather than to MaxValueLength
+	cell := func(node *tree.Node, w int) string {
+		return truncateWidth(formatValueStyle(node, 0, opts.ValueStyle), w)
+	}
+
 	for _, change := range changes {
-		path := change.Path
-		if len(path) > 76 {
-			path = "..." + path[len(path)-73:]
-		}
-		
-		b.WriteString(fmt.Sprintf("%s\n", path))
-		
+		path := truncateWidthLeft(displayPath(change.Path, opts), width-4)
+
+		b.WriteString(fmt.Sprintf("%s\n", p.path(path)))
+
 		switch change.Type {
 		case diff.ChangeTypeAdd:
 			oldVal := "(none)"
-			newVal := formatValue(change.NewValue, opts.MaxValueLength)
-			if !opts.NoColor {
-				newVal = green(newVal)
-			}
-			b.WriteString(fmt.Sprintf("  %-36s | %s\n", oldVal, newVal))
-			
+			newVal := cell(change.NewValue, rightWidth)
+			b.WriteString(fmt.Sprintf("  %s | %s\n", padRight(oldVal, oldVal, leftWidth), p.add(newVal)))
+
 		case diff.ChangeTypeRemove:
-			oldVal := formatValue(change.OldValue, opts.MaxValueLength)
-			if !opts.NoColor {
-				oldVal = red(oldVal)
-			}
+			oldVal := cell(change.OldValue, leftWidth)
 			newVal := "(removed)"
-			b.WriteString(fmt.Sprintf("  %-36s | %s\n", oldVal, newVal))
-			
+			b.WriteString(fmt.Sprintf("  %s | %s\n", padRight(p.remove(oldVal), oldVal, leftWidth), newVal))
+
 		case diff.ChangeTypeModify:
-			oldVal := formatValue(change.OldValue, opts.MaxValueLength)
-			newVal := formatValue(change.NewValue, opts.MaxValueLength)
-			if !opts.NoColor {
-				oldVal = yellow(oldVal)
-				newVal = yellow(newVal)
-			}
-			b.WriteString(fmt.Sprintf("  %-36s | %s\n", oldVal, newVal))
-			
+			oldVal := cell(change.OldValue, leftWidth)
+			newVal := cell(change.NewValue, rightWidth)
+			b.WriteString(fmt.Sprintf("  %s | %s\n", padRight(p.modify(oldVal), oldVal, leftWidth), p.modify(newVal)))
+
 		case diff.ChangeTypeMove:
-			oldVal := formatValue(change.OldValue, opts.MaxValueLength)
-			newVal := formatValue(change.NewValue, opts.MaxValueLength)
-			b.WriteString(fmt.Sprintf("  %-36s → %s\n", oldVal, newVal))
+			oldVal := cell(change.OldValue, leftWidth)
+			newVal := cell(change.NewValue, rightWidth)
+			b.WriteString(fmt.Sprintf("  %s %s %s\n", padRight(p.move(oldVal), oldVal, leftWidth), sym.arrow, p.move(newVal)))
 		}
-		
+
 		b.WriteString("\n")
 	}
-	
+
 	return b.String()
 }
+
+// padRight pads a styled string to width based on the display width of its
+// plain text, so ANSI escape codes and wide runes do not disturb alignment.
+func padRight(styled, plain string, width int) string {
+	if pad := width - displayWidth(plain); pad > 0 {
+		return styled + strings.Repeat(" ", pad)
+	}
+	return styled
+}
+
+// sideBySideWidth sizes the layout to fit the longest path and value,
+// never narrower than DefaultWidth and never wider than limit.
+func sideBySideWidth(changes []diff.Change, opts Options) int {
+	limit := layoutWidth(opts)
+	needed := DefaultWidth
+	for _, change := range changes {
+		if w := displayWidth(displayPath(change.Path, opts)) + 4; w > needed {
+			needed = w
+		}
+		for _, node := range []*tree.Node{change.OldValue, change.NewValue} {
+			if node == nil {
+				continue
+			}
+			if w := 2*displayWidth(formatValueStyle(node, 0, opts.ValueStyle)) + 9; w > needed {
+				needed = w
+			}
+		}
+	}
+	if needed > limit {
+		return limit
+	}
+	return needed
+}
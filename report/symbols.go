@@ -0,0 +1,41 @@
+package report
+
+import "github.com/pfrederiksen/configdiff/diff"
+
+// symbolSet holds the non-ASCII characters shared by the text generators.
+type symbolSet struct {
+	// arrow separates old and new values.
+	arrow string
+
+	// move marks moved values.
+	move string
+
+	// rule draws horizontal separators.
+	rule string
+
+	// ellipsis starts the note about changes left out by Options.MaxChanges
+	// and replaces path segments elided by Options.MaxPathSegments.
+	ellipsis string
+}
+
+var (
+	unicodeSymbols = symbolSet{arrow: "→", move: "↔", rule: "─", ellipsis: "…"}
+	asciiSymbols   = symbolSet{arrow: "->", move: "<->", rule: "-", ellipsis: "..."}
+)
+
+// symbolsFor returns the symbols to use under opts.
+func symbolsFor(opts Options) symbolSet {
+	if opts.ASCIIOnly {
+		return asciiSymbols
+	}
+	return unicodeSymbols
+}
+
+// change returns the symbol for a change type; only moves differ from
+// getChangeSymbol.
+func (s symbolSet) change(ct diff.ChangeType) string {
+	if ct == diff.ChangeTypeMove {
+		return s.move
+	}
+	return getChangeSymbol(ct)
+}
@@ -0,0 +1,138 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/parse"
+	"gopkg.in/yaml.v3"
+)
+
+// tapPoint is one test point of TAP output.
+type tapPoint struct {
+	description string
+	status      FileStatus
+	from        string // old path of a renamed file
+	err         string // why the file could not be compared
+	changes     []diff.Change
+}
+
+// tapDiagnostic is the YAML diagnostic block of a failing test point.
+type tapDiagnostic struct {
+	Status  string      `yaml:"status,omitempty"`
+	From    string      `yaml:"from,omitempty"`
+	Message string      `yaml:"message,omitempty"`
+	Changes []tapChange `yaml:"changes,omitempty"`
+}
+
+// tapChange is a change in a TAP diagnostic block.
+type tapChange struct {
+	Type string      `yaml:"type"`
+	Path string      `yaml:"path"`
+	Old  interface{} `yaml:"old,omitempty"`
+	New  interface{} `yaml:"new,omitempty"`
+}
+
+// GenerateTAP renders the comparison of oldFile with newFile as a TAP
+// version 13 stream with a single test point, e.g.
+//
+//	TAP version 13
+//	1..1
+//	ok 1 - old.yaml vs new.yaml
+//
+// Any change selected by opts.FilterTypes makes the point "not ok" and adds
+// a YAML diagnostic block listing the changes.
+func GenerateTAP(changes []diff.Change, oldFile, newFile string, opts Options) (string, error) {
+	return generateTAP([]tapPoint{{
+		description: oldFile + " vs " + newFile,
+		status:      FileModified,
+		changes:     changes,
+	}}, opts)
+}
+
+// GenerateDirTAP renders a directory comparison as a TAP version 13 stream
+// with one test point per file, in path order. Added, removed, replaced,
+// and changed files are "not ok"; skipped files are "ok" with a SKIP directive.
+func GenerateDirTAP(d DirResult, opts Options) (string, error) {
+	points := make([]tapPoint, 0, len(d.Files))
+	for _, f := range d.Files {
+		description := f.Path
+		if f.Status != FileRenamed {
+			description = f.label(opts)
+		}
+		points = append(points, tapPoint{description: description, status: f.Status, from: f.OldPath, err: f.Error, changes: f.Changes})
+	}
+	return generateTAP(points, opts)
+}
+
+// generateTAP writes the plan and test points. Changes within a diagnostic
+// are in path order unless opts.Sort says otherwise, so output is stable.
+func generateTAP(points []tapPoint, opts Options) (string, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortPath
+	}
+
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(points))
+
+	for i, point := range points {
+		var diag tapDiagnostic
+		switch point.status {
+		case FileAdded, FileRemoved:
+			diag.Status = string(point.status)
+		case FileError:
+			diag.Status, diag.Message = string(point.status), point.err
+		default:
+			switch point.status {
+			case FileRenamed:
+				diag.Status, diag.From = string(point.status), point.from
+			case FileReplaced:
+				diag.Status = string(point.status)
+			}
+			for _, change := range SelectChanges(point.changes, opts) {
+				tc := tapChange{Type: string(change.Type), Path: change.Path}
+				if change.OldValue != nil {
+					tc.Old = parse.YAMLValue(change.OldValue)
+				}
+				if change.NewValue != nil {
+					tc.New = parse.YAMLValue(change.NewValue)
+				}
+				diag.Changes = append(diag.Changes, tc)
+			}
+		}
+
+		description := escapeTAPDescription(point.description)
+		if point.status == FileSkipped {
+			fmt.Fprintf(&b, "ok %d - %s # SKIP %s\n", i+1, description, escapeTAPDescription(point.err))
+			continue
+		}
+		if diag.Status == "" && len(diag.Changes) == 0 {
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, description)
+			continue
+		}
+
+		fmt.Fprintf(&b, "not ok %d - %s\n", i+1, description)
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(diag); err != nil {
+			return "", fmt.Errorf("failed to encode TAP diagnostic for %s: %w", point.description, err)
+		}
+		b.WriteString("  ---\n")
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+		b.WriteString("  ...\n")
+	}
+
+	return b.String(), nil
+}
+
+// escapeTAPDescription escapes "#", which would otherwise start a directive,
+// and folds line breaks so the description stays on its test line.
+func escapeTAPDescription(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "#", `\#`, "\r", " ", "\n", " ").Replace(s)
+}
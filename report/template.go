@@ -0,0 +1,189 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateData is the value user-defined templates execute against.
+type TemplateData struct {
+	// OldFile and NewFile are the compared file names.
+	OldFile string
+	NewFile string
+
+	// Summary counts the rendered changes by type.
+	Summary Summary
+
+	// Changes are the rendered changes, after Options.FilterTypes and Options.Sort.
+	Changes []TemplateChange
+
+	// Stats holds aggregate figures about the rendered changes.
+	Stats TemplateStats
+}
+
+// TemplateChange is a single change as seen by a template.
+type TemplateChange struct {
+	// Type is "add", "remove", "modify", or "move".
+	Type diff.ChangeType
+
+	// Symbol is the report symbol for Type, e.g. "+" or "~".
+	Symbol string
+
+	// Path is the location of the change.
+	Path string
+
+	// Old and New are the values formatted as in the report (quoted strings,
+	// truncated to Options.MaxValueLength), or "" when absent.
+	Old string
+	New string
+
+	// OldValue and NewValue are the raw values (nil when absent).
+	OldValue *tree.Node
+	NewValue *tree.Node
+}
+
+// TemplateStats holds aggregate figures for templates.
+type TemplateStats struct {
+	// Paths is the number of distinct changed paths.
+	Paths int
+
+	// Sections is the number of distinct top-level keys touched.
+	Sections int
+}
+
+// GenerateTemplate renders changes with a user-defined text/template. name
+// identifies the template in error messages, which include line numbers.
+//
+// Besides the text/template builtins, templates can use:
+//
+//	color NAME TEXT   colors TEXT by change type (add, remove, modify, move)
+//	                  or color name (red, green, yellow, cyan, bold, dim);
+//	                  plain when Options.NoColor is set
+//	truncate N TEXT   shortens TEXT to N terminal cells
+//	json VALUE        encodes VALUE (including tree nodes) as compact JSON
+//	yaml VALUE        encodes VALUE (including tree nodes) as YAML
+func GenerateTemplate(name, text string, changes []diff.Change, oldFile, newFile string, opts Options) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs(opts)).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, NewTemplateData(changes, oldFile, newFile, opts)); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// NewTemplateData builds the data passed to templates by GenerateTemplate.
+func NewTemplateData(changes []diff.Change, oldFile, newFile string, opts Options) TemplateData {
+	selected, summary := selectChanges(changes, opts)
+
+	data := TemplateData{
+		OldFile: oldFile,
+		NewFile: newFile,
+		Summary: summary,
+		Changes: make([]TemplateChange, 0, len(selected)),
+	}
+
+	paths := make(map[string]bool)
+	sections := make(map[string]bool)
+	for _, change := range selected {
+		tc := TemplateChange{
+			Type:     change.Type,
+			Symbol:   getChangeSymbol(change.Type),
+			Path:     change.Path,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		}
+		if change.OldValue != nil {
+			tc.Old = formatValueStyle(change.OldValue, opts.MaxValueLength, opts.ValueStyle)
+		}
+		if change.NewValue != nil {
+			tc.New = formatValueStyle(change.NewValue, opts.MaxValueLength, opts.ValueStyle)
+		}
+		data.Changes = append(data.Changes, tc)
+
+		paths[change.Path] = true
+		if segments := tree.ParsePath(change.Path); len(segments) > 0 {
+			sections[segments[0]] = true
+		}
+	}
+	data.Stats = TemplateStats{Paths: len(paths), Sections: len(sections)}
+
+	return data
+}
+
+// templateFuncs returns the helper functions available to templates.
+func templateFuncs(opts Options) template.FuncMap {
+	p := newPalette(opts.NoColor)
+
+	return template.FuncMap{
+		"color": func(name, text interface{}) (string, error) {
+			style, err := templateColor(p, fmt.Sprint(name))
+			if err != nil {
+				return "", err
+			}
+			return style(text), nil
+		},
+		"truncate": func(width int, text string) string {
+			return truncateWidth(text, width)
+		},
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(templateValue(v))
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
+		},
+		"yaml": func(v interface{}) (string, error) {
+			if node, ok := v.(*tree.Node); ok {
+				v = parse.YAMLValue(node)
+			}
+			data, err := yaml.Marshal(templateValue(v))
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(string(data), "\n"), nil
+		},
+	}
+}
+
+// templateColor resolves a change type or color name to a styling function.
+func templateColor(p palette, name string) (func(a ...interface{}) string, error) {
+	switch name {
+	case string(diff.ChangeTypeAdd), "green":
+		return p.add, nil
+	case string(diff.ChangeTypeRemove), "red":
+		return p.remove, nil
+	case string(diff.ChangeTypeModify), "yellow":
+		return p.modify, nil
+	case string(diff.ChangeTypeMove), "cyan":
+		return p.move, nil
+	case "bold":
+		return p.path, nil
+	case "dim":
+		return p.dim, nil
+	default:
+		return nil, fmt.Errorf("unknown color %q", name)
+	}
+}
+
+// templateValue converts tree nodes to plain Go values for encoding.
+func templateValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case *tree.Node:
+		return val.ToInterface()
+	case diff.ChangeType:
+		return string(val)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,138 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// trieNode is a path segment in the change hierarchy built by GenerateTree.
+type trieNode struct {
+	name     string
+	change   *diff.Change
+	children []*trieNode
+	index    map[string]*trieNode
+}
+
+// child returns the child for segment, creating it if needed.
+func (t *trieNode) child(segment string) *trieNode {
+	if c, ok := t.index[segment]; ok {
+		return c
+	}
+	c := &trieNode{name: segment, index: make(map[string]*trieNode)}
+	t.index[segment] = c
+	t.children = append(t.children, c)
+	return c
+}
+
+// collapse merges chains of single-child intermediate nodes into one node,
+// e.g. "spec" → "template" → "spec" becomes "spec/template/spec". Merged
+// names are shortened to opts.MaxPathSegments.
+func (t *trieNode) collapse(opts Options) {
+	for _, c := range t.children {
+		for c.change == nil && len(c.children) == 1 {
+			only := c.children[0]
+			c.name = c.name + "/" + only.name
+			c.change = only.change
+			c.children = only.children
+			c.index = only.index
+		}
+		c.name = displayPath(c.name, opts)
+		c.collapse(opts)
+	}
+}
+
+// treeGlyphs holds the connector strings used to draw the tree.
+type treeGlyphs struct {
+	branch, last, pipe, space string
+	symbolSet
+}
+
+var (
+	unicodeGlyphs = treeGlyphs{branch: "├─ ", last: "└─ ", pipe: "│  ", space: "   ", symbolSet: unicodeSymbols}
+	asciiGlyphs   = treeGlyphs{branch: "|-- ", last: "`-- ", pipe: "|   ", space: "    ", symbolSet: asciiSymbols}
+)
+
+// GenerateTree renders changes as a hierarchy with shared ancestors drawn once.
+// Chains of single-child path segments are collapsed, and each changed node is
+// marked with its change symbol and values.
+func GenerateTree(changes []diff.Change, opts Options) string {
+	if len(changes) == 0 {
+		return "No changes detected.\n"
+	}
+	changes, summary := selectChanges(changes, opts)
+	if len(changes) == 0 {
+		return noMatchingChanges(summary.Hidden)
+	}
+
+	root := &trieNode{index: make(map[string]*trieNode)}
+	for i := range changes {
+		node := root
+		segments := tree.ParsePath(changes[i].Path)
+		if len(segments) == 0 {
+			segments = []string{"/"}
+		}
+		for _, segment := range segments {
+			node = node.child(segment)
+		}
+		node.change = &changes[i]
+	}
+	root.collapse(opts)
+
+	glyphs := unicodeGlyphs
+	if opts.ASCIIOnly {
+		glyphs = asciiGlyphs
+	}
+	p := newPalette(opts.NoColor)
+
+	var b strings.Builder
+	b.WriteString(formatSummary(summary, opts))
+	b.WriteString("\n")
+
+	for _, top := range root.children {
+		b.WriteString(formatTrieLabel(top, opts, glyphs, p))
+		b.WriteString("\n")
+		writeTrieChildren(&b, top, "", opts, glyphs, p)
+	}
+
+	return b.String()
+}
+
+// writeTrieChildren draws the children of node with box-drawing connectors.
+func writeTrieChildren(b *strings.Builder, node *trieNode, prefix string, opts Options, g treeGlyphs, p palette) {
+	for i, c := range node.children {
+		connector, next := g.branch, g.pipe
+		if i == len(node.children)-1 {
+			connector, next = g.last, g.space
+		}
+		b.WriteString(prefix + connector + formatTrieLabel(c, opts, g, p) + "\n")
+		writeTrieChildren(b, c, prefix+next, opts, g, p)
+	}
+}
+
+// formatTrieLabel renders a node name, plus its symbol and values if it changed.
+func formatTrieLabel(node *trieNode, opts Options, g treeGlyphs, p palette) string {
+	if node.change == nil {
+		return p.path(node.name)
+	}
+
+	change := node.change
+	symbol := p.forType(change.Type)(g.change(change.Type))
+	label := fmt.Sprintf("%s %s", p.path(node.name), symbol)
+
+	switch change.Type {
+	case diff.ChangeTypeAdd:
+		label += " " + p.add(formatValueStyle(change.NewValue, opts.MaxValueLength, opts.ValueStyle))
+	case diff.ChangeTypeRemove:
+		label += " " + p.dim(fmt.Sprintf("(was: %s)", formatValueStyle(change.OldValue, opts.MaxValueLength, opts.ValueStyle)))
+	case diff.ChangeTypeModify, diff.ChangeTypeMove:
+		label += fmt.Sprintf(" %s %s %s",
+			p.remove(formatValueStyle(change.OldValue, opts.MaxValueLength, opts.ValueStyle)),
+			g.arrow,
+			p.add(formatValueStyle(change.NewValue, opts.MaxValueLength, opts.ValueStyle)))
+	}
+
+	return label
+}
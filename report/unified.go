@@ -0,0 +1,225 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// DefaultUnifiedContext is the number of context lines used by GenerateUnified
+// when Options.ContextLines is zero.
+const DefaultUnifiedContext = 3
+
+// lineOp is a single line of an edit script: ' ' (equal), '-' (delete), or '+' (insert).
+type lineOp struct {
+	kind byte
+	text string
+}
+
+// GenerateUnified creates a real unified diff of the two documents after
+// canonicalizing both to YAML (sorted keys, stable formatting), so formatting,
+// comment, and key-order differences disappear. Unlike GenerateGitDiff, hunks
+// show actual surrounding lines; Options.ContextLines sets how many.
+func GenerateUnified(oldTree, newTree *tree.Node, oldFile, newFile string, opts Options) (string, error) {
+	oldDoc, err := parse.MarshalYAML(oldTree)
+	if err != nil {
+		return "", fmt.Errorf("failed to canonicalize %s: %w", oldFile, err)
+	}
+	newDoc, err := parse.MarshalYAML(newTree)
+	if err != nil {
+		return "", fmt.Errorf("failed to canonicalize %s: %w", newFile, err)
+	}
+
+	ops := diffLines(splitLines(string(oldDoc)), splitLines(string(newDoc)))
+
+	context := opts.ContextLines
+	if context <= 0 {
+		context = DefaultUnifiedContext
+	}
+	hunks := buildHunks(ops, context)
+	if len(hunks) == 0 {
+		return "", nil
+	}
+
+	p := newPalette(opts.NoColor)
+	var b strings.Builder
+	b.WriteString(p.path(fmt.Sprintf("--- a/%s", oldFile)) + "\n")
+	b.WriteString(p.path(fmt.Sprintf("+++ b/%s", newFile)) + "\n")
+
+	for _, h := range hunks {
+		b.WriteString(p.header(h.header()) + "\n")
+		for _, op := range h.ops {
+			line := string(op.kind) + op.text
+			switch op.kind {
+			case '-':
+				line = p.remove(line)
+			case '+':
+				line = p.add(line)
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+
+	return b.String(), nil
+}
+
+// splitLines splits a document into lines without trailing newlines.
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines computes a shortest edit script between a and b using Myers' algorithm.
+func diffLines(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+	done := false
+	for d := 0; d <= maxD && !done; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the edit script
+	ops := make([]lineOp, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, lineOp{kind: ' ', text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, lineOp{kind: '+', text: b[y-1]})
+			} else {
+				ops = append(ops, lineOp{kind: '-', text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunk is a contiguous region of a unified diff.
+type hunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	ops                []lineOp
+}
+
+// header returns the "@@ -l,s +l,s @@" line for the hunk.
+func (h hunk) header() string {
+	oldStart, newStart := h.oldStart, h.newStart
+	if h.oldCount == 0 {
+		oldStart--
+	}
+	if h.newCount == 0 {
+		newStart--
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, h.oldCount, newStart, h.newCount)
+}
+
+// buildHunks groups an edit script into hunks with the given lines of context.
+// Changes separated by no more than 2*context equal lines share a hunk.
+func buildHunks(ops []lineOp, context int) []hunk {
+	// Line numbers (1-based) in old and new documents before each op
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	oldLine[0], newLine[0] = 1, 1
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	var hunks []hunk
+	i := 0
+	for i < len(ops) {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next < len(ops) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			end += context
+			if end > len(ops) {
+				end = len(ops)
+			}
+			break
+		}
+
+		hunks = append(hunks, hunk{
+			oldStart: oldLine[start],
+			oldCount: oldLine[end] - oldLine[start],
+			newStart: newLine[start],
+			newCount: newLine[end] - newLine[start],
+			ops:      ops[start:end],
+		})
+		i = end
+	}
+
+	return hunks
+}
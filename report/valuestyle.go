@@ -0,0 +1,161 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pfrederiksen/configdiff/parse"
+	"github.com/pfrederiksen/configdiff/tree"
+	"gopkg.in/yaml.v3"
+)
+
+// Value styles for Options.ValueStyle.
+const (
+	// ValueStyleAuto quotes strings Go-style and summarizes objects and
+	// arrays as "{...} (N keys)" and "[...] (N items)". It is the default.
+	ValueStyleAuto = "auto"
+
+	// ValueStyleJSON renders values as compact JSON, ready for jq.
+	ValueStyleJSON = "json"
+
+	// ValueStyleYAML renders values as flow-style YAML, e.g. {a: 1, b: [x]}.
+	// Generate additionally shows multi-line strings, and values too long
+	// for MaxValueLength, in block style below the change line.
+	ValueStyleYAML = "yaml"
+
+	// ValueStyleGo renders values in Go syntax, as fmt's %#v does.
+	ValueStyleGo = "go"
+)
+
+// ValidateValueStyle returns an error if style is not a supported value
+// style. The empty string means ValueStyleAuto.
+func ValidateValueStyle(style string) error {
+	switch style {
+	case "", ValueStyleAuto, ValueStyleJSON, ValueStyleYAML, ValueStyleGo:
+		return nil
+	default:
+		return fmt.Errorf("invalid value style %q (valid: %s, %s, %s, %s)", style, ValueStyleAuto, ValueStyleJSON, ValueStyleYAML, ValueStyleGo)
+	}
+}
+
+// formatValueStyle renders node in style on a single line, then truncates
+// the result to maxLen runes.
+func formatValueStyle(node *tree.Node, maxLen int, style string) string {
+	if node == nil || style == "" || style == ValueStyleAuto {
+		return formatValue(node, maxLen)
+	}
+
+	val := styleValue(node, style)
+	if maxLen > 0 && utf8.RuneCountInString(val) > maxLen {
+		if style == ValueStyleGo && node.Kind == tree.KindString {
+			s, _ := node.Value.(string)
+			return truncateQuoted(s, maxLen)
+		}
+		return truncateRunes(val, maxLen)
+	}
+	return val
+}
+
+// styleValue renders node in a non-auto style without truncation, falling
+// back to the auto style if the value cannot be encoded.
+func styleValue(node *tree.Node, style string) string {
+	switch style {
+	case ValueStyleJSON:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(node.ToInterface()); err != nil {
+			return formatValue(node, 0)
+		}
+		return strings.TrimSuffix(buf.String(), "\n")
+
+	case ValueStyleYAML:
+		data, err := marshalYAMLValue(node, "", true)
+		if err != nil {
+			return formatValue(node, 0)
+		}
+		return data
+
+	case ValueStyleGo:
+		if node.Kind == tree.KindNull {
+			return "nil"
+		}
+		return fmt.Sprintf("%#v", node.ToInterface())
+
+	default:
+		return formatValue(node, 0)
+	}
+}
+
+// marshalYAMLValue encodes node as YAML without a trailing newline, in
+// flow style on one line or in block style. A non-empty label nests the
+// value under that key.
+func marshalYAMLValue(node *tree.Node, label string, flow bool) (string, error) {
+	var yn yaml.Node
+	if err := yn.Encode(parse.YAMLValue(node)); err != nil {
+		return "", err
+	}
+	if flow {
+		setFlowStyle(&yn)
+	}
+	doc := &yn
+	if label != "" {
+		doc = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: label}, &yn,
+		}}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// setFlowStyle switches yn and its descendants to flow style, quoting
+// multi-line strings so that they stay on one line.
+func setFlowStyle(yn *yaml.Node) {
+	switch yn.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		yn.Style = yaml.FlowStyle
+	case yaml.ScalarNode:
+		if strings.Contains(yn.Value, "\n") {
+			yn.Style = yaml.DoubleQuotedStyle
+		}
+	}
+	for _, child := range yn.Content {
+		setFlowStyle(child)
+	}
+}
+
+// writeYAMLBlock writes node in block-style YAML below its change line when
+// opts.ValueStyle is ValueStyleYAML and the value is a multi-line string or
+// too long for its line, nested under label if one is given. Other values
+// are fully shown on the line.
+func writeYAMLBlock(w io.Writer, node *tree.Node, label string, opts Options, style func(a ...interface{}) string) {
+	if node == nil || opts.ValueStyle != ValueStyleYAML {
+		return
+	}
+	multiline := node.Kind == tree.KindString && strings.Contains(fmt.Sprint(node.Value), "\n")
+	truncated := opts.MaxValueLength > 0 && utf8.RuneCountInString(styleValue(node, ValueStyleYAML)) > opts.MaxValueLength
+	if !multiline && !truncated {
+		return
+	}
+
+	data, err := marshalYAMLValue(node, label, false)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprint(w, expandIndent+style(line)+"\n")
+	}
+}
@@ -0,0 +1,103 @@
+package report
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultWidth is the output width used when Options.Width is zero.
+const DefaultWidth = 80
+
+// minWidth is the narrowest layout the column-based generators will produce.
+const minWidth = 40
+
+// runeWidth returns the number of terminal cells a rune occupies:
+// 0 for combining marks, 2 for East Asian wide characters and emoji, else 1.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0 || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || r == '\u200d':
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// displayWidth returns the number of terminal cells s occupies.
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// truncateWidth shortens s to at most width cells, ending in "..." when cut.
+// It never splits a rune.
+func truncateWidth(s string, width int) string {
+	if width <= 0 || displayWidth(s) <= width {
+		return s
+	}
+	if width <= 3 {
+		return strings.Repeat(".", width)
+	}
+
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if used+w > width-3 {
+			break
+		}
+		b.WriteRune(r)
+		used += w
+	}
+	b.WriteString("...")
+	return b.String()
+}
+
+// truncateWidthLeft shortens s to at most width cells by keeping its end,
+// prefixed with "...". Used for long paths where the leaf matters most.
+func truncateWidthLeft(s string, width int) string {
+	if width <= 0 || displayWidth(s) <= width {
+		return s
+	}
+	if width <= 3 {
+		return strings.Repeat(".", width)
+	}
+
+	runes := []rune(s)
+	used := 0
+	i := len(runes)
+	for i > 0 {
+		w := runeWidth(runes[i-1])
+		if used+w > width-3 {
+			break
+		}
+		used += w
+		i--
+	}
+	return "..." + string(runes[i:])
+}
+
+// layoutWidth returns the effective output width for opts.
+func layoutWidth(opts Options) int {
+	switch {
+	case opts.Width <= 0:
+		return DefaultWidth
+	case opts.Width < minWidth:
+		return minWidth
+	default:
+		return opts.Width
+	}
+}
@@ -0,0 +1,154 @@
+package configdiff
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pfrederiksen/configdiff/diff"
+	"github.com/pfrederiksen/configdiff/patch"
+	"github.com/pfrederiksen/configdiff/tree"
+)
+
+// resultVersion is the version of the JSON encoding of Result written by
+// MarshalJSON. Bump it when the encoding changes, and keep reading the
+// older versions in UnmarshalJSON.
+const resultVersion = 1
+
+// resultJSON is version 1 of the JSON encoding of Result.
+type resultJSON struct {
+	Version int             `json:"version"`
+	Changes []Change        `json:"changes"`
+	Patch   json.RawMessage `json:"patch,omitempty"`
+	Report  string          `json:"report,omitempty"`
+}
+
+// MarshalJSON encodes the result with a version, so that LoadResult can
+// read it back after the encoding changes. Values keep their kind and
+// type, and encoding a loaded result gives the same bytes again.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	out := resultJSON{Version: resultVersion, Changes: r.Changes, Report: r.Report}
+	if out.Changes == nil {
+		out.Changes = []Change{}
+	}
+	if r.Patch != nil {
+		data, err := r.Patch.ToJSON()
+		if err != nil {
+			return nil, err
+		}
+		out.Patch = data
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON, of this or an
+// earlier version, or by the default encoding of Result used before it
+// had a version.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	switch {
+	case header.Version == nil:
+		return r.unmarshalUnversioned(data)
+	case *header.Version < 1 || *header.Version > resultVersion:
+		return fmt.Errorf("unsupported result version %d, want at most %d", *header.Version, resultVersion)
+	}
+
+	var in resultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*r = Result{Changes: in.Changes, Report: in.Report}
+	if len(in.Patch) > 0 && string(in.Patch) != "null" {
+		p, err := patch.FromJSON(in.Patch)
+		if err != nil {
+			return err
+		}
+		r.Patch = p
+	}
+	return nil
+}
+
+// unversionedResult, unversionedChange, and unversionedNode are the
+// default encoding of Result before it had a version, with Go field names
+// and node kinds as numbers.
+type unversionedResult struct {
+	Changes []unversionedChange
+	Patch   *Patch
+	Report  string
+}
+
+type unversionedChange struct {
+	Type          ChangeType
+	Path          string
+	OldValue      *unversionedNode
+	NewValue      *unversionedNode
+	ArrayIndex    int
+	OldHighlights []diff.Span
+	NewHighlights []diff.Span
+}
+
+type unversionedNode struct {
+	Kind   tree.NodeKind
+	Value  interface{}
+	Object map[string]*unversionedNode
+	Array  []*unversionedNode
+	Path   string
+	Line   int
+}
+
+// unmarshalUnversioned decodes the encoding of Result before it had a
+// version.
+func (r *Result) unmarshalUnversioned(data []byte) error {
+	var in unversionedResult
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*r = Result{Patch: in.Patch, Report: in.Report}
+	for _, c := range in.Changes {
+		r.Changes = append(r.Changes, Change{
+			Type:          c.Type,
+			Path:          c.Path,
+			OldValue:      c.OldValue.node(),
+			NewValue:      c.NewValue.node(),
+			ArrayIndex:    c.ArrayIndex,
+			OldHighlights: c.OldHighlights,
+			NewHighlights: c.NewHighlights,
+		})
+	}
+	return nil
+}
+
+// node converts n to a tree node.
+func (n *unversionedNode) node() *tree.Node {
+	if n == nil {
+		return nil
+	}
+	out := &tree.Node{Kind: n.Kind, Value: n.Value, Path: n.Path, Line: n.Line}
+	if n.Object != nil {
+		out.Object = make(map[string]*tree.Node, len(n.Object))
+		for k, v := range n.Object {
+			out.Object[k] = v.node()
+		}
+	}
+	if n.Array != nil {
+		out.Array = make([]*tree.Node, len(n.Array))
+		for i, elem := range n.Array {
+			out.Array[i] = elem.node()
+		}
+	}
+	return out
+}
+
+// LoadResult decodes a result stored with json.Marshal, as written by
+// Result.MarshalJSON.
+func LoadResult(data []byte) (*Result, error) {
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to load result: %w", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,157 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// nodeJSON is the JSON form of a Node, tagged with its kind so that a
+// decoded node has the kind and value type it was encoded with.
+type nodeJSON struct {
+	Kind   string           `json:"kind"`
+	Value  json.RawMessage  `json:"value,omitempty"`
+	Object map[string]*Node `json:"object,omitempty"`
+	Array  []*Node          `json:"array,omitempty"`
+	Path   string           `json:"path,omitempty"`
+	Line   int              `json:"line,omitempty"`
+}
+
+// MarshalJSON encodes the node as an object tagged with its kind:
+//
+//	{"kind": "number", "value": 3, "path": "/spec/replicas"}
+//	{"kind": "object", "object": {"name": {"kind": "string", "value": "web"}}}
+//
+// Numbers that are not finite are encoded as the strings "NaN", "+Inf", and
+// "-Inf". Object keys are sorted, so equal nodes encode to the same bytes.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	out := nodeJSON{Kind: n.Kind.String(), Path: n.Path, Line: n.Line}
+	switch n.Kind {
+	case KindNull:
+	case KindBool, KindString:
+		value, err := json.Marshal(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		out.Value = value
+	case KindNumber:
+		value, err := marshalNumber(n.Value)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.Path, err)
+		}
+		out.Value = value
+	case KindObject:
+		out.Object = n.Object
+	case KindArray:
+		out.Array = n.Array
+	default:
+		return nil, fmt.Errorf("node %s: unknown node kind: %d", n.Path, n.Kind)
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a node encoded by MarshalJSON. Numbers are decoded
+// as float64, or as json.Number if a float64 cannot represent them exactly.
+func (n *Node) UnmarshalJSON(data []byte) error {
+	var in nodeJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	kind, ok := parseKind(in.Kind)
+	if !ok {
+		return fmt.Errorf("unknown node kind %q", in.Kind)
+	}
+	*n = Node{Kind: kind, Path: in.Path, Line: in.Line}
+
+	switch kind {
+	case KindBool:
+		var v bool
+		if err := json.Unmarshal(in.Value, &v); err != nil {
+			return fmt.Errorf("invalid bool value %s", in.Value)
+		}
+		n.Value = v
+	case KindString:
+		var v string
+		if err := json.Unmarshal(in.Value, &v); err != nil {
+			return fmt.Errorf("invalid string value %s", in.Value)
+		}
+		n.Value = v
+	case KindNumber:
+		v, err := unmarshalNumber(in.Value)
+		if err != nil {
+			return err
+		}
+		n.Value = v
+	case KindObject:
+		n.Object = in.Object
+		if n.Object == nil {
+			n.Object = map[string]*Node{}
+		}
+	case KindArray:
+		n.Array = in.Array
+		if n.Array == nil {
+			n.Array = []*Node{}
+		}
+	}
+	return nil
+}
+
+// parseKind returns the NodeKind named s, as returned by NodeKind.String.
+func parseKind(s string) (NodeKind, bool) {
+	for k := KindNull; k <= KindArray; k++ {
+		if k.String() == s {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// marshalNumber encodes the value of a number node.
+func marshalNumber(v interface{}) ([]byte, error) {
+	if f, ok := v.(float64); ok {
+		switch {
+		case math.IsNaN(f):
+			return []byte(`"NaN"`), nil
+		case math.IsInf(f, 1):
+			return []byte(`"+Inf"`), nil
+		case math.IsInf(f, -1):
+			return []byte(`"-Inf"`), nil
+		}
+	}
+	return json.Marshal(v)
+}
+
+// unmarshalNumber decodes the value of a number node encoded by
+// marshalNumber.
+func unmarshalNumber(data []byte) (interface{}, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		switch s {
+		case "NaN":
+			return math.NaN(), nil
+		case "+Inf":
+			return math.Inf(1), nil
+		case "-Inf":
+			return math.Inf(-1), nil
+		}
+		return nil, fmt.Errorf("invalid number value %s", data)
+	}
+
+	var number json.Number
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&number); err != nil {
+		return nil, fmt.Errorf("invalid number value %s", data)
+	}
+	f, err := strconv.ParseFloat(number.String(), 64)
+	if err != nil {
+		return number, nil
+	}
+	// Keep the literal when it does not encode back the same as a float64
+	if encoded, err := json.Marshal(f); err != nil || string(encoded) != number.String() {
+		return number, nil
+	}
+	return f, nil
+}
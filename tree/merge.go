@@ -0,0 +1,168 @@
+package tree
+
+import "fmt"
+
+// ArrayStrategy is how Merge combines an array in the base document with an
+// array at the same path in the override.
+type ArrayStrategy string
+
+const (
+	// ArraysReplace replaces the base array with the override's.
+	ArraysReplace ArrayStrategy = "replace"
+
+	// ArraysConcat appends the override's elements to the base array.
+	ArraysConcat ArrayStrategy = "concat"
+
+	// ArraysMergeByKey merges the elements of arrays listed in
+	// MergeOptions.ArrayKeys by their key field, and replaces other arrays.
+	ArraysMergeByKey ArrayStrategy = "merge-by-key"
+)
+
+// MergeOptions configures Merge.
+type MergeOptions struct {
+	// Arrays is how arrays are combined; the zero value replaces them.
+	Arrays ArrayStrategy
+
+	// ArrayKeys maps array paths to the field identifying their elements,
+	// as diff.Options.ArraySetKeys does: elements of keyed arrays appear in
+	// paths as [field=value], e.g. /spec/containers[name=web]/ports.
+	ArrayKeys map[string]string
+
+	// DeleteNulls removes the keys set to null in the override instead of
+	// setting them to null.
+	DeleteNulls bool
+}
+
+// MergeConflict is a path where the base and override values have different
+// kinds, so the override's replaces the base's instead of merging with it.
+type MergeConflict struct {
+	Path     string
+	Base     NodeKind
+	Override NodeKind
+}
+
+// Merge layers override on top of base and returns the result, with paths
+// set, and the paths whose kinds conflict, in document order. Objects are
+// merged key by key, arrays as opts.Arrays says, and any other value in
+// override replaces the base's. Null in override is a value like any other,
+// and replaces without a conflict, unless opts.DeleteNulls is set. Neither
+// input is modified.
+func Merge(base, override *Node, opts MergeOptions) (*Node, []MergeConflict) {
+	m := &layerMerger{opts: opts}
+	result := m.merge(base, override, "/")
+	if result == nil {
+		result = NewNull()
+	}
+	result.SetPaths("/")
+	return result, m.conflicts
+}
+
+// layerMerger holds state during Merge.
+type layerMerger struct {
+	opts      MergeOptions
+	conflicts []MergeConflict
+}
+
+// merge merges override into base at path. A nil result removes the path.
+func (m *layerMerger) merge(base, override *Node, path string) *Node {
+	switch {
+	case override == nil:
+		return base.Clone()
+	case override.Kind == KindNull && m.opts.DeleteNulls:
+		return nil
+	case base == nil || base.Kind == KindNull || override.Kind == KindNull:
+		return override.Clone()
+	case base.Kind != override.Kind:
+		m.conflicts = append(m.conflicts, MergeConflict{Path: path, Base: base.Kind, Override: override.Kind})
+		return override.Clone()
+	case base.Kind == KindObject:
+		return m.mergeObjects(base, override, path)
+	case base.Kind == KindArray:
+		return m.mergeArrays(base, override, path)
+	default:
+		return override.Clone()
+	}
+}
+
+// mergeObjects merges two objects key by key, in key order.
+func (m *layerMerger) mergeObjects(base, override *Node, path string) *Node {
+	result := make(map[string]*Node, len(base.Object))
+	for key, value := range base.Object {
+		if _, ok := override.Object[key]; !ok {
+			result[key] = value.Clone()
+		}
+	}
+	for _, key := range override.SortedKeys() {
+		if merged := m.merge(base.Object[key], override.Object[key], joinPath(path, key)); merged != nil {
+			result[key] = merged
+		}
+	}
+	return NewObject(result)
+}
+
+// mergeArrays combines two arrays as opts.Arrays says.
+func (m *layerMerger) mergeArrays(base, override *Node, path string) *Node {
+	switch m.opts.Arrays {
+	case ArraysConcat:
+		elems := make([]*Node, 0, len(base.Array)+len(override.Array))
+		for _, elem := range append(append([]*Node{}, base.Array...), override.Array...) {
+			elems = append(elems, elem.Clone())
+		}
+		return NewArray(elems)
+	case ArraysMergeByKey:
+		if keyField, ok := m.opts.ArrayKeys[path]; ok {
+			if merged, ok := m.mergeArrayByKey(base, override, path, keyField); ok {
+				return merged
+			}
+		}
+	}
+	return override.Clone()
+}
+
+// mergeArrayByKey merges two arrays of objects by their keyField. Elements
+// keep the base's order, followed by the elements only the override has, in
+// its order. It returns false if any element lacks a string key, leaving the
+// array to be replaced.
+func (m *layerMerger) mergeArrayByKey(base, override *Node, path, keyField string) (*Node, bool) {
+	var keys []string
+	baseElems := make(map[string]*Node)
+	overrideElems := make(map[string]*Node)
+	for _, side := range []struct {
+		array *Node
+		elems map[string]*Node
+	}{{base, baseElems}, {override, overrideElems}} {
+		for _, elem := range side.array.Array {
+			key, ok := elementKey(elem, keyField)
+			if !ok {
+				return nil, false
+			}
+			if _, seen := baseElems[key]; !seen {
+				if _, seen := overrideElems[key]; !seen {
+					keys = append(keys, key)
+				}
+			}
+			side.elems[key] = elem
+		}
+	}
+
+	elems := make([]*Node, 0, len(keys))
+	for _, key := range keys {
+		childPath := fmt.Sprintf("%s[%s=%s]", path, keyField, key)
+		if merged := m.merge(baseElems[key], overrideElems[key], childPath); merged != nil {
+			elems = append(elems, merged)
+		}
+	}
+	return NewArray(elems), true
+}
+
+// elementKey returns the string value of an array element's keyField.
+func elementKey(elem *Node, keyField string) (string, bool) {
+	if elem == nil || elem.Kind != KindObject {
+		return "", false
+	}
+	key, ok := elem.Object[keyField]
+	if !ok || key.Kind != KindString {
+		return "", false
+	}
+	return key.Value.(string), true
+}
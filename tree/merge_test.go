@@ -0,0 +1,134 @@
+package tree
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// fromJSON builds a tree from a JSON document.
+func fromJSON(t *testing.T, doc string) *Node {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	var build func(v interface{}) *Node
+	build = func(v interface{}) *Node {
+		switch val := v.(type) {
+		case nil:
+			return NewNull()
+		case bool:
+			return NewBool(val)
+		case float64:
+			return NewNumber(val)
+		case string:
+			return NewString(val)
+		case []interface{}:
+			elems := make([]*Node, len(val))
+			for i, elem := range val {
+				elems[i] = build(elem)
+			}
+			return NewArray(elems)
+		default:
+			obj := make(map[string]*Node)
+			for k, elem := range val.(map[string]interface{}) {
+				obj[k] = build(elem)
+			}
+			return NewObject(obj)
+		}
+	}
+	return build(v)
+}
+
+func TestMerge(t *testing.T) {
+	keyed := map[string]string{"/containers": "name"}
+	tests := []struct {
+		name      string
+		base      string
+		override  string
+		opts      MergeOptions
+		want      string
+		conflicts []MergeConflict
+	}{
+		{
+			name:     "objects merge key by key",
+			base:     `{"a":1,"b":{"c":2,"d":3}}`,
+			override: `{"b":{"c":4},"e":5}`,
+			want:     `{"a":1,"b":{"c":4,"d":3},"e":5}`,
+		},
+		{
+			name:     "arrays replace by default",
+			base:     `{"a":[1,2]}`,
+			override: `{"a":[3]}`,
+			want:     `{"a":[3]}`,
+		},
+		{
+			name:     "arrays concat",
+			base:     `{"a":[1,2]}`,
+			override: `{"a":[3]}`,
+			opts:     MergeOptions{Arrays: ArraysConcat},
+			want:     `{"a":[1,2,3]}`,
+		},
+		{
+			name:     "arrays merge by key",
+			base:     `{"containers":[{"name":"web","image":"web:1","port":80},{"name":"db","image":"db:1"}]}`,
+			override: `{"containers":[{"name":"proxy","image":"proxy:1"},{"name":"web","image":"web:2"}]}`,
+			opts:     MergeOptions{Arrays: ArraysMergeByKey, ArrayKeys: keyed},
+			want: `{"containers":[{"image":"web:2","name":"web","port":80},{"image":"db:1","name":"db"},` +
+				`{"image":"proxy:1","name":"proxy"}]}`,
+		},
+		{
+			name:     "unkeyed elements replace the array",
+			base:     `{"containers":[{"name":"web"}]}`,
+			override: `{"containers":[{"image":"x"}]}`,
+			opts:     MergeOptions{Arrays: ArraysMergeByKey, ArrayKeys: keyed},
+			want:     `{"containers":[{"image":"x"}]}`,
+		},
+		{
+			name:     "nulls set null",
+			base:     `{"a":1,"b":2}`,
+			override: `{"a":null}`,
+			want:     `{"a":null,"b":2}`,
+		},
+		{
+			name:     "nulls delete",
+			base:     `{"a":1,"b":2,"containers":[{"name":"web"},{"name":"db"}]}`,
+			override: `{"a":null,"containers":[{"name":"db","x":null}]}`,
+			opts:     MergeOptions{Arrays: ArraysMergeByKey, ArrayKeys: keyed, DeleteNulls: true},
+			want:     `{"b":2,"containers":[{"name":"web"},{"name":"db"}]}`,
+		},
+		{
+			name:      "kind conflicts",
+			base:      `{"a":1,"b":{"c":1},"d":"x"}`,
+			override:  `{"a":"1","b":[1],"d":"y"}`,
+			want:      `{"a":"1","b":[1],"d":"y"}`,
+			conflicts: []MergeConflict{{"/a", KindNumber, KindString}, {"/b", KindObject, KindArray}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, override := fromJSON(t, tt.base), fromJSON(t, tt.override)
+			got, conflicts := Merge(base, override, tt.opts)
+			data, err := json.Marshal(got.ToInterface())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Merge() = %s, want %s", data, tt.want)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("Merge() conflicts = %v, want %v", conflicts, tt.conflicts)
+			}
+			if !base.Equal(fromJSON(t, tt.base)) || !override.Equal(fromJSON(t, tt.override)) {
+				t.Error("Merge() modified its inputs")
+			}
+		})
+	}
+
+	got, _ := Merge(fromJSON(t, `{"a":{"b":1}}`), fromJSON(t, `{"a":{"c":2}}`), MergeOptions{})
+	if c := got.GetByPath("/a/c"); c == nil || c.Path != "/a/c" {
+		t.Errorf("Merge() path of /a/c = %+v, want /a/c", c)
+	}
+}
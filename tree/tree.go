@@ -5,8 +5,11 @@
 package tree
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -70,6 +73,11 @@ type Node struct {
 	// Path is the canonical path to this node from the root.
 	// Example: "/spec/template/spec/containers[0]/image"
 	Path string
+
+	// Line is the 1-based line in the source document where this node's key
+	// (or, for array elements and the root, the value itself) appears.
+	// 0 means unknown; not every parser records it.
+	Line int `json:",omitempty"`
 }
 
 // NewNull creates a null node.
@@ -112,6 +120,7 @@ func (n *Node) Clone() *Node {
 		Kind:  n.Kind,
 		Value: n.Value,
 		Path:  n.Path,
+		Line:  n.Line,
 	}
 
 	if n.Object != nil {
@@ -174,6 +183,84 @@ func (n *Node) Equal(other *Node) bool {
 	return false
 }
 
+// MaxExactInt is the largest integer magnitude a float64 represents exactly (2^53).
+const MaxExactInt = 1 << 53
+
+// ToInterface converts the node to a plain Go value suitable for serialization.
+//
+// Whole numbers within the exactly-representable float64 range are returned as
+// int64 so they marshal as 3 rather than 3.0, json.Number values are passed
+// through untouched so large integers are not mangled, and null nodes become nil.
+func (n *Node) ToInterface() interface{} {
+	if n == nil {
+		return nil
+	}
+
+	switch n.Kind {
+	case KindNull:
+		return nil
+
+	case KindNumber:
+		switch v := n.Value.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= MaxExactInt {
+				return int64(v)
+			}
+			return v
+		case json.Number:
+			return v
+		default:
+			return n.Value
+		}
+
+	case KindBool, KindString:
+		return n.Value
+
+	case KindObject:
+		result := make(map[string]interface{}, len(n.Object))
+		for k, v := range n.Object {
+			result[k] = v.ToInterface()
+		}
+		return result
+
+	case KindArray:
+		result := make([]interface{}, len(n.Array))
+		for i, elem := range n.Array {
+			result[i] = elem.ToInterface()
+		}
+		return result
+
+	default:
+		return n.Value
+	}
+}
+
+// NumberString returns the value of a number node in its shortest form: a
+// float64 formatted without an exponent, or the digits of a json.Number
+// kept for an integer too large for a float64.
+func (n *Node) NumberString() string {
+	switch v := n.Value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprint(n.Value)
+}
+
+// Float returns the value of a number node as a float64, rounding the
+// digits of a json.Number to the nearest one.
+func (n *Node) Float() float64 {
+	switch v := n.Value.(type) {
+	case float64:
+		return v
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return math.NaN()
+}
+
 // SortedKeys returns the sorted keys of an object node.
 // Returns nil for non-object nodes.
 func (n *Node) SortedKeys() []string {
@@ -189,7 +276,8 @@ func (n *Node) SortedKeys() []string {
 	return keys
 }
 
-// SetPaths recursively sets the canonical path for all nodes in the tree.
+// SetPaths recursively sets the canonical path for all nodes in the tree,
+// visiting object keys in sorted order.
 func (n *Node) SetPaths(basePath string) {
 	if n == nil {
 		return
@@ -199,9 +287,9 @@ func (n *Node) SetPaths(basePath string) {
 
 	switch n.Kind {
 	case KindObject:
-		for k, v := range n.Object {
+		for _, k := range n.SortedKeys() {
 			childPath := joinPath(basePath, k)
-			v.SetPaths(childPath)
+			n.Object[k].SetPaths(childPath)
 		}
 	case KindArray:
 		for i, elem := range n.Array {
@@ -1,7 +1,11 @@
 package tree
 
 import (
+	"encoding/json"
+	"math"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNodeKindString(t *testing.T) {
@@ -269,6 +273,49 @@ func TestNodeClone(t *testing.T) {
 	})
 }
 
+func TestNodeToInterface(t *testing.T) {
+	tests := []struct {
+		name string
+		node *Node
+		want interface{}
+	}{
+		{"nil", nil, nil},
+		{"null", NewNull(), nil},
+		{"bool", NewBool(true), true},
+		{"integer", NewNumber(3), int64(3)},
+		{"negative integer", NewNumber(-7), int64(-7)},
+		{"float", NewNumber(3.5), 3.5},
+		{"beyond exact range", NewNumber(1e300), 1e300},
+		{"string", NewString("s"), "s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.node.ToInterface()
+			if got != tt.want {
+				t.Errorf("ToInterface() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		n := NewObject(map[string]*Node{
+			"list": NewArray([]*Node{NewNumber(1), NewNull()}),
+		})
+		got, ok := n.ToInterface().(map[string]interface{})
+		if !ok {
+			t.Fatalf("ToInterface() returned %T, want map", n.ToInterface())
+		}
+		list, ok := got["list"].([]interface{})
+		if !ok || len(list) != 2 {
+			t.Fatalf("ToInterface() list = %#v", got["list"])
+		}
+		if list[0] != int64(1) || list[1] != nil {
+			t.Errorf("ToInterface() list = %#v, want [1 <nil>]", list)
+		}
+	})
+}
+
 func TestNodeSortedKeys(t *testing.T) {
 	t.Run("object node", func(t *testing.T) {
 		n := NewObject(map[string]*Node{
@@ -436,3 +483,143 @@ func TestGetByPath(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeJSON(t *testing.T) {
+	node := NewObject(map[string]*Node{
+		"name":     NewString("web"),
+		"replicas": NewNumber(3),
+		"ratio":    NewNumber(0.25),
+		"big":      {Kind: KindNumber, Value: json.Number("12345678901234567890")},
+		"inf":      NewNumber(math.Inf(1)),
+		"enabled":  NewBool(false),
+		"empty":    NewString(""),
+		"none":     NewNull(),
+		"ports":    NewArray([]*Node{NewNumber(80), NewString("443")}),
+		"labels":   NewObject(map[string]*Node{}),
+	})
+	node.SetPaths("")
+	node.Line = 1
+
+	data, err := json.Marshal(node)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var got *Node
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !got.Equal(node) {
+		t.Errorf("decoded node = %v, want %v", got.ToInterface(), node.ToInterface())
+	}
+	for _, key := range []string{"replicas", "ratio", "big", "inf"} {
+		if got.Object[key].Value != node.Object[key].Value {
+			t.Errorf("%s = %#v, want %#v", key, got.Object[key].Value, node.Object[key].Value)
+		}
+	}
+	if got.Object["ports"].Array[1].Kind != KindString || got.Path != "" || got.Object["name"].Path != "/name" || got.Line != 1 {
+		t.Errorf("decoded node lost kinds, paths, or lines: %s", data)
+	}
+
+	again, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("Marshal() of decoded node error = %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("Marshal() is not stable:\n%s\n%s", data, again)
+	}
+
+	for _, invalid := range []string{`{"kind":"date"}`, `{"kind":"number","value":"3"}`, `{"kind":"bool","value":1}`} {
+		var n Node
+		if err := json.Unmarshal([]byte(invalid), &n); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+type valueBase struct {
+	Name   string `json:"name"`
+	Hidden string `json:"-"`
+}
+
+type valueSpec struct {
+	valueBase
+	Replicas int               `json:"replicas"`
+	Ratio    float32           `json:"ratio,omitempty"`
+	Port     int               `json:"port,string"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Ports    map[int]bool      `json:"ports"`
+	Image    *string           `json:"image"`
+	Data     []byte            `json:"data"`
+	Tags     []string          `json:"tags"`
+	Started  time.Time         `json:"started"`
+	Timeout  time.Duration     `json:"timeout"`
+	Extra    interface{}       `json:"extra"`
+	Doc      *Node             `json:"doc"`
+	NoTag    bool
+	private  string
+}
+
+func TestFromValue(t *testing.T) {
+	spec := valueSpec{
+		valueBase: valueBase{Name: "web", Hidden: "x"},
+		Replicas:  3,
+		Port:      8080,
+		Ports:     map[int]bool{80: true},
+		Data:      []byte("hi"),
+		Started:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Timeout:   time.Second,
+		Extra:     map[string]interface{}{"debug": true, "level": 2},
+		Doc:       NewObject(map[string]*Node{"kept": NewString("as is")}),
+		private:   "y",
+	}
+	node, err := FromValue(&spec)
+	if err != nil {
+		t.Fatalf("FromValue() error = %v", err)
+	}
+
+	// Everything but the embedded node is as encoding/json would have it
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]interface{}
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	want["doc"] = map[string]interface{}{"kept": "as is"}
+	got, _ := json.Marshal(node.ToInterface())
+	wantData, _ := json.Marshal(want)
+	if string(got) != string(wantData) {
+		t.Errorf("FromValue() =\n%s\nwant\n%s", got, wantData)
+	}
+	if n := node.GetByPath("/doc/kept"); n == nil || n.Path != "/doc/kept" {
+		t.Errorf("node paths not set: %v", n)
+	}
+	if n := node.GetByPath("/replicas"); n.Value != 3.0 {
+		t.Errorf("replicas = %#v, want float64 3", n.Value)
+	}
+
+	type cycle struct {
+		Next *cycle `json:"next"`
+	}
+	loop := &cycle{}
+	loop.Next = loop
+	for name, v := range map[string]interface{}{
+		"func":  struct{ Hook func() }{Hook: func() {}},
+		"chan":  map[string]interface{}{"events": make(chan int)},
+		"cycle": loop,
+	} {
+		if _, err := FromValue(v); err == nil {
+			t.Errorf("FromValue(%s) succeeded, want an error", name)
+		} else if name != "cycle" && !strings.Contains(err.Error(), "unsupported type") {
+			t.Errorf("FromValue(%s) error = %v", name, err)
+		}
+	}
+	if _, err := FromValue(struct{ Hook func() }{}); err == nil || !strings.HasPrefix(err.Error(), "/Hook: ") {
+		t.Errorf("FromValue() error = %v, want one naming /Hook", err)
+	}
+
+	if node, err := FromValue(nil); err != nil || node.Kind != KindNull {
+		t.Errorf("FromValue(nil) = %v, %v, want null", node, err)
+	}
+}
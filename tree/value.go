@@ -0,0 +1,388 @@
+package tree
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	nodeType          = reflect.TypeOf(Node{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// FromValue converts a Go value to a normalized tree, as it would be after
+// encoding it as JSON and parsing the result:
+//
+//   - Struct fields are named by their json tags, with "-" fields and empty
+//     "omitempty" fields left out, ",string" fields quoted, and the fields
+//     of embedded structs promoted, as encoding/json does. Unexported
+//     fields are left out.
+//   - Values implementing json.Marshaler or encoding.TextMarshaler, such as
+//     time.Time, are converted from what they marshal to.
+//   - Numbers become float64, []byte a base64 string, and nil pointers,
+//     interfaces, maps, and slices null. Map keys must be strings, integers,
+//     or implement encoding.TextMarshaler.
+//   - A *Node or Node is used as is, so a parsed document can be embedded.
+//
+// Functions, channels, complex numbers, and pointer cycles cannot be
+// converted and return an error naming the path of the value.
+func FromValue(v interface{}) (*Node, error) {
+	c := &valueConverter{visiting: make(map[uintptr]bool)}
+	node, err := c.convert(reflect.ValueOf(v), "/")
+	if err != nil {
+		return nil, err
+	}
+	node.SetPaths("/")
+	return node, nil
+}
+
+// valueConverter holds the state of one FromValue call.
+type valueConverter struct {
+	// visiting holds the pointers and maps being converted, to detect cycles
+	visiting map[uintptr]bool
+}
+
+func (c *valueConverter) convert(v reflect.Value, path string) (*Node, error) {
+	if !v.IsValid() {
+		return NewNull(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NewNull(), nil
+		}
+	}
+
+	// Values reached through unexported embedded structs cannot be used as
+	// interfaces, but neither can they be a Node or a marshaler
+	if v.CanInterface() {
+		if v.Type() == nodeType {
+			n := v.Interface().(Node)
+			return n.Clone(), nil
+		}
+		if v.Kind() == reflect.Pointer && v.Type().Elem() == nodeType {
+			return v.Interface().(*Node).Clone(), nil
+		}
+		if node, ok, err := c.convertMarshaler(v, path); ok {
+			return node, err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return NewBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewNumber(float64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewNumber(float64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NewNumber(v.Float()), nil
+	case reflect.String:
+		return NewString(v.String()), nil
+
+	case reflect.Interface:
+		return c.convert(v.Elem(), path)
+
+	case reflect.Pointer:
+		ptr := v.Pointer()
+		if c.visiting[ptr] {
+			return nil, fmt.Errorf("%s: pointer cycle through %s", path, v.Type())
+		}
+		c.visiting[ptr] = true
+		defer delete(c.visiting, ptr)
+		return c.convert(v.Elem(), path)
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return NewNull(), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 && !implementsMarshaler(reflect.PointerTo(v.Type().Elem())) {
+			return NewString(base64.StdEncoding.EncodeToString(v.Bytes())), nil
+		}
+		return c.convertArray(v, path)
+	case reflect.Array:
+		return c.convertArray(v, path)
+
+	case reflect.Map:
+		if v.IsNil() {
+			return NewNull(), nil
+		}
+		ptr := v.Pointer()
+		if c.visiting[ptr] {
+			return nil, fmt.Errorf("%s: map cycle through %s", path, v.Type())
+		}
+		c.visiting[ptr] = true
+		defer delete(c.visiting, ptr)
+		return c.convertMap(v, path)
+
+	case reflect.Struct:
+		return c.convertStruct(v, path)
+	}
+
+	return nil, fmt.Errorf("%s: unsupported type %s", path, v.Type())
+}
+
+// implementsMarshaler reports whether t implements json.Marshaler or
+// encoding.TextMarshaler.
+func implementsMarshaler(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)
+}
+
+// convertMarshaler converts v from what it marshals to, if it implements
+// json.Marshaler or encoding.TextMarshaler itself or through a pointer to
+// it. The bool result reports whether it does.
+func (c *valueConverter) convertMarshaler(v reflect.Value, path string) (*Node, bool, error) {
+	if !implementsMarshaler(v.Type()) {
+		if !v.CanAddr() || !implementsMarshaler(reflect.PointerTo(v.Type())) {
+			return nil, false, nil
+		}
+		v = v.Addr()
+	}
+
+	if m, ok := v.Interface().(json.Marshaler); ok {
+		data, err := m.MarshalJSON()
+		if err != nil {
+			return nil, true, fmt.Errorf("%s: %w", path, err)
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return nil, true, fmt.Errorf("%s: invalid JSON from %s: %w", path, v.Type(), err)
+		}
+		node, err := c.convert(reflect.ValueOf(decoded), path)
+		return node, true, err
+	}
+
+	text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewString(string(text)), true, nil
+}
+
+func (c *valueConverter) convertArray(v reflect.Value, path string) (*Node, error) {
+	elems := make([]*Node, v.Len())
+	for i := range elems {
+		elem, err := c.convert(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = elem
+	}
+	return NewArray(elems), nil
+}
+
+func (c *valueConverter) convertMap(v reflect.Value, path string) (*Node, error) {
+	obj := make(map[string]*Node, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := mapKey(iter.Key())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		elem, err := c.convert(iter.Value(), joinPath(path, key))
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = elem
+	}
+	return NewObject(obj), nil
+}
+
+// mapKey returns the object key of a map key, as encoding/json does.
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if k.CanInterface() {
+		if m, ok := k.Interface().(encoding.TextMarshaler); ok {
+			if k.Kind() == reflect.Pointer && k.IsNil() {
+				return "", nil
+			}
+			text, err := m.MarshalText()
+			return string(text), err
+		}
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type %s", k.Type())
+}
+
+func (c *valueConverter) convertStruct(v reflect.Value, path string) (*Node, error) {
+	obj := make(map[string]*Node)
+	for _, f := range structFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		fieldPath := joinPath(path, f.name)
+		node, err := c.convert(fv, fieldPath)
+		if err != nil {
+			return nil, err
+		}
+		if f.quoted && (node.Kind == KindBool || node.Kind == KindNumber || node.Kind == KindString) {
+			data, err := json.Marshal(node.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fieldPath, err)
+			}
+			node = NewString(string(data))
+		}
+		obj[f.name] = node
+	}
+	return NewObject(obj), nil
+}
+
+// fieldByIndex returns the field at index, or false if it is in an embedded
+// struct reached through a nil pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue reports whether v is empty for "omitempty", as in
+// encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// structField is a field of a struct as encoding/json names it.
+type structField struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	quoted    bool
+}
+
+// structFields returns the fields of t that encoding/json encodes, with
+// those of embedded structs promoted: of the fields with the same name, the
+// least nested one wins, or the only tagged one of those equally nested.
+func structFields(t reflect.Type) []structField {
+	var all []structField
+	var collect func(t reflect.Type, index []int, seen map[reflect.Type]bool)
+	collect = func(t reflect.Type, index []int, seen map[reflect.Type]bool) {
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			fieldIndex := append(append([]int(nil), index...), i)
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				// Unexported embedded structs still promote exported fields,
+				// but not through a pointer, which cannot be set
+				if !sf.IsExported() && sf.Type.Kind() == reflect.Pointer {
+					continue
+				}
+				collect(ft, fieldIndex, seen)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+
+			f := structField{name: name, index: fieldIndex, tagged: name != ""}
+			if f.name == "" {
+				f.name = sf.Name
+			}
+			for _, opt := range strings.Split(opts, ",") {
+				switch opt {
+				case "omitempty":
+					f.omitEmpty = true
+				case "string":
+					f.quoted = true
+				}
+			}
+			all = append(all, f)
+		}
+	}
+	collect(t, nil, make(map[reflect.Type]bool))
+
+	byName := make(map[string][]structField)
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	fields := make([]structField, 0, len(byName))
+	for _, candidates := range byName {
+		if f, ok := dominantField(candidates); ok {
+			fields = append(fields, f)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	return fields
+}
+
+// dominantField returns the field of those with the same name that wins, or
+// false if none does.
+func dominantField(fields []structField) (structField, bool) {
+	depth := len(fields[0].index)
+	for _, f := range fields[1:] {
+		depth = min(depth, len(f.index))
+	}
+	var winners []structField
+	for _, f := range fields {
+		if len(f.index) == depth {
+			winners = append(winners, f)
+		}
+	}
+	if len(winners) == 1 {
+		return winners[0], true
+	}
+	var tagged []structField
+	for _, f := range winners {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return structField{}, false
+}